@@ -9,6 +9,11 @@ export DOCKER_IMAGE_AND_TAG=${1}
 make deps
 make test
 make coverage
+
+# The same tests against RedisGraph, proving the queries the in-memory graph accepts.
+docker run -d --rm --name search-aggregator-redisgraph -p 6379:6379 redislabs/redisgraph:2.4.7
+trap "docker stop search-aggregator-redisgraph" EXIT
+REDISGRAPH_TEST_ADDRESS=localhost:6379 make test-redisgraph
 make lint
 
 exit 0
\ No newline at end of file
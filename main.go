@@ -10,22 +10,31 @@ The source code for this program is not published or otherwise divested of its t
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
-	"github.com/golang/glog"
 	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/cli"
 	"github.com/open-cluster-management/search-aggregator/pkg/clustermgmt"
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
 	"github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
 	"github.com/open-cluster-management/search-aggregator/pkg/handlers"
+	"github.com/open-cluster-management/search-aggregator/pkg/logging"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	"github.com/open-cluster-management/search-aggregator/pkg/rbac"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+var logger = logging.Module("main")
+
 func main() {
 	// parse flags
 	flag.Parse()
@@ -34,31 +43,170 @@ func main() {
 	if err != nil {
 		fmt.Println("Error setting default flag:", err) // Uses fmt.Println in case something is wrong with glog args
 		os.Exit(1)
-		glog.Fatal("Error setting default flag: ", err)
 	}
-	defer glog.Flush() // This should ensure that everything makes it out on to the console if the program crashes.
+	// The -v flag is the initial verbosity of every module, the logging admin API changes it.
+	if verbosity, err := strconv.Atoi(flag.Lookup("v").Value.String()); err == nil {
+		_ = logging.SetVerbosity("", verbosity)
+	}
+	if config.Cfg.LogBackend == "zap" {
+		backend, err := logging.NewZapBackend()
+		if err != nil {
+			fmt.Println("Error creating the zap logger:", err)
+			os.Exit(1)
+		}
+		logging.SetBackend("zap", backend)
+	}
+	defer logging.Flush() // This should ensure that everything makes it out on to the console if the program crashes.
 
-	glog.Info("Starting search-aggregator")
+	// Admin subcommands, e.g. search-aggregator stats
+	if flag.NArg() > 0 {
+		exitCode := cli.Run(flag.Args(), os.Stdout)
+		logging.Flush()
+		os.Exit(exitCode)
+	}
+
+	logger.Info("Starting search-aggregator")
 	if commit, ok := os.LookupEnv("VCS_REF"); ok {
-		glog.Info("Built from git commit: ", commit)
+		logger.Info("Built from git commit: ", commit)
 	}
 
+	dbconnector.DetectGraphFeatures()
 	dbconnector.GetIndexes()
 	go dbconnector.RedisWatcher()
+	// Preload the caches before the readiness probe reports ready.
+	go handlers.WarmUp()
 	// Watch clusters and sync status to Redis.
 	go clustermgmt.WatchClusters()
+	// Keep the ManagedClusterSet membership of nodes up to date.
+	go clustermgmt.ReconcileClusterSets()
+	// Reconcile the settings with the SearchAggregator resource.
+	go clustermgmt.WatchAggregatorConfig(handlers.PushConfigChanges)
 
 	// Run routine to build intercluster edges
 	go handlers.BuildInterClusterEdges()
+	// Compact the graph in the maintenance window after mass deletions.
+	go dbconnector.CompactionJob()
+	// Enforce the retention policies of ephemeral kinds.
+	go dbconnector.RetentionJob()
+	// Delete the resources queued by large resyncs at LAZY_DELETE_RATE.
+	go dbconnector.LazyDeleteJob()
+	// Move the clusters that stopped syncing to Stale and Offline.
+	go handlers.ClusterHealthJob()
+	// Give the cluster label of the metrics to the busiest clusters, the others share the "other" label.
+	go metrics.ClusterLabelsJob()
+	// Ping the health URLs of the collectors, to tell the ones that are down from empty clusters.
+	go handlers.CollectorPingJob()
+	// Count the resources of each cluster, kind and namespace, to diff with later counts.
+	go handlers.TopologySnapshotJob()
+	// Publish the applied changes to EVENT_SINK.
+	go handlers.EventSinkJob()
+	// Recommend indexes for the properties searched the most, and create them with INDEX_ADVISOR_AUTO_CREATE.
+	go handlers.IndexAdvisorJob()
+	// Apply the KIND_MAPPINGS to the resources stored with an old kind or API group.
+	go handlers.RelabelJob()
+	// Repair or delete the nodes stored without the cluster property, the resyncs of their cluster can't see them.
+	go handlers.ClusterlessNodesJob()
+	// Retry the resources that failed to be inserted or updated, until the next resync of their cluster.
+	go handlers.ResourceRetryJob()
+	// Keep the Aggregator node with the health of the search index up to date.
+	go handlers.AggregatorStatusJob()
+	// Count the graph against GRAPH_MAX_NODES and GRAPH_MAX_EDGES.
+	go handlers.GraphLimitsJob()
+	// Reject the writes to the graph while Redis is above READ_ONLY_MEMORY_PERCENT of its maxmemory.
+	go handlers.ReadOnlyJob()
+	// Cache the resources each user can see, to filter the search API.
+	if config.Cfg.RBACFilter == "true" {
+		go rbac.Watch()
+		handlers.RegisterReadinessCheck("rbac-cache", false, rbac.Ready)
+	}
+	handlers.RegisterReadinessCheck("cluster-watch", false, clustermgmt.ClusterWatchReady)
 
 	router := mux.NewRouter()
+	router.Use(handlers.RecoverPanics)
 
 	router.HandleFunc("/liveness", handlers.LivenessProbe).Methods("GET")
 	router.HandleFunc("/readiness", handlers.ReadinessProbe).Methods("GET")
-	router.HandleFunc("/aggregator/clusters/{id}/sync", handlers.SyncResources).Methods("POST")
+	router.HandleFunc("/aggregator/clusters/{id}/sync", handlers.RequireCollectorCert(handlers.SyncResources)).
+		Methods("POST")
+	router.HandleFunc("/aggregator/clusters/{id}/inventory", handlers.RequireCollectorCert(handlers.ClusterInventory)).
+		Methods("POST")
+	router.HandleFunc("/aggregator/clusters/{id}/status", handlers.ClusterStatus).Methods("GET")
+	router.HandleFunc("/aggregator/sync/schema", handlers.SyncSchema).Methods("GET")
+	router.HandleFunc("/aggregator/clusters/{id}/session", handlers.RequireCollectorCert(handlers.CollectorSession)).
+		Methods("GET")
+	router.HandleFunc("/aggregator/search/compile", handlers.CompileSearch).Methods("POST")
+	router.HandleFunc("/aggregator/search", handlers.Search).Methods("POST")
+	router.HandleFunc("/aggregator/search/aggregate", handlers.Aggregate).Methods("POST")
+	router.HandleFunc("/aggregator/search/explain", handlers.ExplainSearch).Methods("POST")
+	router.HandleFunc("/aggregator/clusters/{id}/resources/{uid}/related", handlers.RelatedResources).Methods("GET")
+	router.HandleFunc("/aggregator/clusters/{id}/resources/{uid}/owned", handlers.OwnershipTree).Methods("GET")
+	router.HandleFunc("/aggregator/clusters/{id}/deleted", handlers.DeletedResources).Methods("GET")
+	router.HandleFunc("/aggregator/clusters/{id}/resources/{uid}/blobs/{property}", handlers.ResourceBlob).
+		Methods("GET")
+	router.HandleFunc("/aggregator/edges", handlers.Edges).Methods("GET")
+	router.HandleFunc("/aggregator/schema", handlers.Schema).Methods("GET")
+	router.HandleFunc("/errors", handlers.ErrorDocs).Methods("GET")
+	router.HandleFunc("/errors/{code}", handlers.ErrorDocs).Methods("GET")
+	router.HandleFunc(handlers.OPENAPI_PATH, handlers.OpenAPI).Methods("GET")
+	router.HandleFunc(handlers.API_DISCOVERY_PATH, handlers.APIDiscovery).Methods("GET")
 
-	// Configure TLS
-	cfg := &tls.Config{
+	// Admin and metrics traffic can be served on a separate address, so it can be firewalled differently.
+	adminRouter := router
+	if config.Cfg.AdminAddress != "" {
+		adminRouter = mux.NewRouter()
+		adminRouter.Use(handlers.RecoverPanics)
+		adminRouter.HandleFunc("/liveness", handlers.LivenessProbe).Methods("GET")
+		adminRouter.HandleFunc("/readiness", handlers.ReadinessProbe).Methods("GET")
+	}
+	adminRouter.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	// The admin APIs require the ADMIN_TOKEN, or the separate ADMIN_ADDRESS listener without it.
+	admin := handlers.RequireAdmin
+	adminRouter.HandleFunc("/aggregator/admin/datastores/compare", admin(handlers.CompareDatastores)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/admin/compact", admin(handlers.CompactGraph)).Methods("POST")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/history", admin(handlers.SyncHistory)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/lastSync", admin(handlers.ClusterLastSync)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/resyncDiff", admin(handlers.ClusterResyncDiff)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/tombstones", admin(handlers.Tombstones)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/remap", admin(handlers.RemapCluster)).Methods("POST")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/quarantine", admin(handlers.QuarantineCluster)).
+		Methods("POST", "DELETE")
+	adminRouter.HandleFunc("/aggregator/admin/quarantines", admin(handlers.QuarantinedClusters)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/captures", admin(handlers.SyncCaptures)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/captures/{capture}", admin(handlers.DownloadSyncCapture)).
+		Methods("GET")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/captures/{capture}/replay", admin(handlers.ReplaySyncCapture)).
+		Methods("POST")
+	adminRouter.HandleFunc("/aggregator/admin/edges/stats", admin(handlers.EdgeTypeStats)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/edges", admin(handlers.PruneEdges)).Methods("DELETE")
+	adminRouter.HandleFunc("/aggregator/admin/uidcollisions", admin(handlers.UIDCollisions)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/admin/cardinality", admin(handlers.PropertyCardinalityReport)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/admin/indexes/advisor", admin(handlers.IndexAdvisor)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/admin/relabel", admin(handlers.Relabel)).Methods("POST")
+	adminRouter.HandleFunc("/aggregator/admin/clusterless-nodes", admin(handlers.ClusterlessNodes)).
+		Methods("GET", "POST")
+	adminRouter.HandleFunc("/aggregator/admin/topology/snapshots", admin(handlers.CreateTopologySnapshot)).
+		Methods("POST")
+	adminRouter.HandleFunc("/aggregator/admin/topology/snapshots", admin(handlers.TopologySnapshots)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/admin/topology/diff", admin(handlers.TopologyDiff)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/admin/rebuild", admin(handlers.StartRebuild)).Methods("POST")
+	adminRouter.HandleFunc("/aggregator/admin/rebuild", admin(handlers.GetRebuild)).Methods("GET")
+	adminRouter.HandleFunc("/aggregator/admin/rebuild", admin(handlers.UpdateRebuild)).Methods("PATCH")
+	adminRouter.HandleFunc("/aggregator/admin/rebuild", admin(handlers.CancelRebuild)).Methods("DELETE")
+	adminRouter.HandleFunc("/aggregator/admin/faults", admin(handlers.FaultInjection)).Methods("GET", "PUT")
+	adminRouter.HandleFunc("/aggregator/admin/readonly", admin(handlers.ReadOnly)).Methods("GET", "PUT")
+	adminRouter.HandleFunc("/aggregator/admin/logging", admin(handlers.Logging)).Methods("GET", "PUT")
+	adminRouter.HandleFunc("/aggregator/clusters/{id}/session/directives", admin(handlers.SessionDirective)).
+		Methods("POST")
+	adminRouter.HandleFunc("/aggregator/admin/watch", admin(handlers.WatchEvents)).Methods("GET")
+
+	// Configure TLS. The certificates are reloaded when their Secrets are rotated.
+	certs, err := config.NewCertificateReloader(config.TLS_CERT_FILE, config.TLS_KEY_FILE,
+		config.ParseList(config.Cfg.CollectorCAFiles))
+	if err != nil {
+		log.Fatal(err, " Use ./setup.sh to generate certificates for local development.")
+	}
+	go certs.Watch()
+	base := &tls.Config{
 		MinVersion:               tls.VersionTLS12,
 		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
 		PreferServerCipherSuites: true,
@@ -66,17 +214,55 @@ func main() {
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
 		},
 	}
+	cfg := certs.TLSConfig(base)
+	externalCfg := cfg
+	if config.Cfg.RequireClientCert == "true" {
+		if config.Cfg.CollectorCAFiles == "" {
+			log.Fatal("REQUIRE_CLIENT_CERT needs COLLECTOR_CA_FILES to verify the client certificates.")
+		}
+		externalCfg = certs.MutualTLSConfig(base)
+	}
+
+	errs := make(chan error)
+	for _, address := range config.ParseAddresses(config.Cfg.AggregatorAddress) {
+		go listenAndServe(address, router, externalCfg, errs)
+	}
+	// The internal listeners are for the components in the cluster, without TLS nor collector certificates.
+	for _, address := range config.ParseAddresses(config.Cfg.InternalAddress) {
+		go listenAndServe(address, router, nil, errs)
+	}
+	if config.Cfg.AdminAddress != "" {
+		for _, address := range config.ParseAddresses(config.Cfg.AdminAddress) {
+			go listenAndServe(address, adminRouter, cfg, errs)
+		}
+	}
+	log.Fatal(<-errs, " Use ./setup.sh to generate certificates for local development.")
+}
+
+// Serves the handler on the given address until the server fails, then sends the error. Without TLS config, the
+// requests are served in plaintext and marked as internal.
+func listenAndServe(address string, handler http.Handler, tlsConfig *tls.Config, errs chan<- error) {
 	srv := &http.Server{
-		Addr:              config.Cfg.AggregatorAddress,
-		Handler:           router,
-		TLSConfig:         cfg,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
 		ReadTimeout:       time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
 		WriteTimeout:      time.Duration(config.Cfg.HTTPTimeout) * time.Millisecond,
 		TLSNextProto:      make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
 	}
-
-	glog.Info("Listening on: ", config.Cfg.AggregatorAddress)
-	log.Fatal(srv.ListenAndServeTLS("./sslcert/tls.crt", "./sslcert/tls.key"),
-		" Use ./setup.sh to generate certificates for local development.")
+	listener, err := net.Listen(config.Cfg.ListenNetwork, address)
+	if err != nil {
+		errs <- err
+		return
+	}
+	if tlsConfig == nil {
+		srv.BaseContext = func(net.Listener) context.Context {
+			return handlers.WithInternalListener(context.Background())
+		}
+		logger.Info("Listening without TLS on: ", listener.Addr())
+		errs <- srv.Serve(listener)
+		return
+	}
+	logger.Info("Listening on: ", listener.Addr())
+	errs <- srv.ServeTLS(listener, "", "") // The certificate is from TLSConfig.GetCertificate.
 }
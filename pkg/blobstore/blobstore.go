@@ -0,0 +1,211 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package blobstore keeps large property values out of the graph. Blobs are addressed by the SHA-256 of their
+// content, so a blob is written once however many resources share it, and it's never changed.
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Returned by Get for a blob that isn't in the store.
+var ErrNotFound = errors.New("Blob not found")
+
+// Where the blobs are written. The key is the hex SHA-256 of the data.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Returns the key of the data, the hex SHA-256 of its content.
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the store at the location: a directory, e.g. a mounted volume, s3://bucket/prefix or
+// configmap://namespace. S3 credentials and region are read from the AWS environment variables, the endpoint is for
+// S3 compatible stores. ConfigMaps are created with the client, they're limited to 1MiB each.
+func New(location, s3Endpoint string, client kubernetes.Interface) (Store, error) {
+	switch {
+	case location == "":
+		return nil, fmt.Errorf("A directory, s3://bucket/prefix or configmap://namespace is required")
+	case strings.HasPrefix(location, "configmap://"):
+		namespace := strings.Trim(strings.TrimPrefix(location, "configmap://"), "/")
+		if namespace == "" || client == nil {
+			return nil, fmt.Errorf("Missing namespace or kube client for %s", location)
+		}
+		return &configMaps{client: client, namespace: namespace}, nil
+	case strings.HasPrefix(location, "s3://"):
+		bucket := strings.TrimPrefix(location, "s3://")
+		prefix := ""
+		if i := strings.Index(bucket, "/"); i >= 0 {
+			bucket, prefix = bucket[:i], strings.Trim(bucket[i+1:], "/")
+		}
+		if bucket == "" {
+			return nil, fmt.Errorf("Missing bucket in %s", location)
+		}
+		awsConfig := aws.NewConfig()
+		if s3Endpoint != "" {
+			awsConfig = awsConfig.WithEndpoint(s3Endpoint).WithS3ForcePathStyle(true)
+		}
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config:            *awsConfig,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s3Bucket{client: s3.New(sess), bucket: bucket, prefix: prefix}, nil
+	}
+	return directory(location), nil
+}
+
+// Checks the key is a hex SHA-256, so it can't escape the directory or the prefix of the store.
+func validKey(key string) error {
+	if _, err := hex.DecodeString(key); err != nil || len(key) != sha256.Size*2 {
+		return fmt.Errorf("Invalid blob key %q", key)
+	}
+	return nil
+}
+
+type directory string
+
+func (d directory) file(key string) string {
+	return filepath.Join(string(d), key[:2], key)
+}
+
+func (d directory) Put(ctx context.Context, key string, data []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	file := d.file(key)
+	if _, err := os.Stat(file); err == nil {
+		return nil // Same key, same content.
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		return err
+	}
+	// Written to a temporary file first, so a reader never sees a partial blob.
+	tmp, err := ioutil.TempFile(filepath.Dir(file), key+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func (d directory) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(d.file(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+type s3Bucket struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func (b *s3Bucket) Put(ctx context.Context, key string, data []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	_, err := b.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(path.Join(b.prefix, key)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (b *s3Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	output, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(path.Join(b.prefix, key)),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return ioutil.ReadAll(output.Body)
+}
+
+// Prefix of the names of the ConfigMaps holding the blobs, followed by the key.
+const configMapPrefix = "search-blob-"
+
+type configMaps struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+func (c *configMaps) Put(ctx context.Context, key string, data []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	_, err := c.client.CoreV1().ConfigMaps(c.namespace).Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   configMapPrefix + key,
+			Labels: map[string]string{"app": "search-aggregator", "component": "blob"},
+		},
+		BinaryData: map[string][]byte{"blob": data},
+	})
+	if k8serrors.IsAlreadyExists(err) {
+		return nil // Same key, same content.
+	}
+	return err
+}
+
+func (c *configMaps) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	configMap, err := c.client.CoreV1().ConfigMaps(c.namespace).Get(configMapPrefix+key, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	data, ok := configMap.BinaryData["blob"]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
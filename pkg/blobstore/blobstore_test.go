@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package blobstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	data := []byte(`{"replicas":3}`)
+	key := Key(data)
+
+	_, err := store.Get(ctx, key)
+	assert.Equal(t, ErrNotFound, err)
+	assert.NoError(t, store.Put(ctx, key, data))
+	assert.NoError(t, store.Put(ctx, key, data), "Writing the same blob again is a no-op.")
+	stored, err := store.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, data, stored)
+
+	assert.Error(t, store.Put(ctx, "../../etc/passwd", data))
+	_, err = store.Get(ctx, "abc")
+	assert.Error(t, err)
+}
+
+func TestDirectory(t *testing.T) {
+	store, err := New(t.TempDir(), "", nil)
+	assert.NoError(t, err)
+	testStore(t, store)
+}
+
+func TestConfigMaps(t *testing.T) {
+	store, err := New("configmap://open-cluster-management", "", fake.NewSimpleClientset())
+	assert.NoError(t, err)
+	testStore(t, store)
+
+	_, err = New("configmap://", "", fake.NewSimpleClientset())
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("", "", nil)
+	assert.Error(t, err)
+	_, err = New("s3://", "", nil)
+	assert.Error(t, err)
+	store, err := New("s3://bucket/blobs/", "http://localhost:9000", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "blobs", store.(*s3Bucket).prefix)
+}
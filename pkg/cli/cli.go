@@ -0,0 +1,267 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package cli has the admin subcommands of the search-aggregator binary, e.g. search-aggregator stats.
+// They connect to the datastore with the same config as the aggregator.
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/export"
+	"github.com/open-cluster-management/search-aggregator/pkg/generator"
+	"github.com/open-cluster-management/search-aggregator/pkg/handlers"
+)
+
+type command struct {
+	usage   string
+	run     func(ctx context.Context, args []string, out io.Writer) error
+	untimed bool // Runs longer than QUERY_TIMEOUT_MS, each query still times out.
+}
+
+var commands = map[string]command{
+	"check": {"Checks the connection to the datastore.", check, false},
+	"export": {"Dumps the nodes and edges: export --format csv|parquet --output <dir|s3://bucket/prefix> " +
+		"[--cluster <name>] [--s3-endpoint <url>]", exportGraph, true},
+	"loadtest": {"Syncs synthetic clusters and prints the latencies: loadtest [--clusters <n>] [--nodes <n>] " +
+		"[--edges <n>] [--kinds Pod=50,Deployment=10] [--deltas <n>] [--churn <percent>] [--concurrency <n>] " +
+		"[--keep]", loadTest, true},
+	"prune": {"Deletes the resources of a cluster: prune --cluster <name> [--all] [--dry-run]", prune, false},
+	"stats": {"Prints the number of resources of each cluster and the number of edges.", stats, false},
+}
+
+// Runs the subcommand in args[0] and returns the exit code.
+func Run(args []string, out io.Writer) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		printUsage(out)
+		if args[0] == "help" {
+			return 0
+		}
+		return 2
+	}
+	ctx := context.Background()
+	if !cmd.untimed {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.QueryTimeoutMS())*time.Millisecond)
+		defer cancel()
+	}
+	if err := cmd.run(ctx, args[1:], out); err != nil {
+		fmt.Fprintf(out, "%s failed: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func printUsage(out io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(out, "Usage: search-aggregator [flags] <command> [args]")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-8s %s\n", name, commands[name].usage)
+	}
+}
+
+func check(ctx context.Context, args []string, out io.Writer) error {
+	conn, err := db.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("PING")
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = db.Store.Query(ctx, "CALL db.labels()"); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Datastore OK (%s)\n", config.Cfg.Datastore)
+	return nil
+}
+
+func prune(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.SetOutput(out)
+	clusterName := flags.String("cluster", "", "Cluster to delete the resources of.")
+	all := flags.Bool("all", false, "Also delete the Cluster node, its summary and namespace usage.")
+	dryRun := flags.Bool("dry-run", false, "Print the number of resources without deleting them.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := db.ValidateClusterName(*clusterName); err != nil {
+		return fmt.Errorf("--cluster: %w", err)
+	}
+
+	total, err := db.TotalNodes(ctx, *clusterName)
+	if err != nil {
+		return err
+	}
+	count := 0
+	if total.Next() {
+		count, _ = total.Record().GetByIndex(0).(int)
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "Would delete %d resources from cluster %s\n", count, *clusterName)
+		return nil
+	}
+
+	result, err := db.DeleteCluster(ctx, *clusterName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Deleted %d resources from cluster %s\n", result.NodesDeleted(), *clusterName)
+	if *all {
+		if _, err = db.Delete(ctx, []string{"cluster__" + *clusterName}); err != nil {
+			return err
+		}
+		if _, err = db.DeleteClusterSummary(ctx, *clusterName); err != nil {
+			return err
+		}
+		if err = db.DeleteNamespaceUsage(ctx, *clusterName); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Deleted the Cluster node, summary and namespace usage of cluster %s\n", *clusterName)
+	}
+	return nil
+}
+
+func exportGraph(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(out)
+	format := flags.String("format", "csv", "csv or parquet.")
+	output := flags.String("output", "", "Directory, e.g. a mounted volume, or s3://bucket/prefix to write the files to.")
+	clusterName := flags.String("cluster", "", "Only export the resources of the cluster, all clusters when empty.")
+	s3Endpoint := flags.String("s3-endpoint", "", "Endpoint of an S3 compatible store, AWS S3 when empty.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	destination, err := export.NewDestination(*output, *s3Endpoint)
+	if err != nil {
+		return fmt.Errorf("--output: %w", err)
+	}
+
+	result, err := export.Run(ctx, export.Options{Format: *format, Cluster: *clusterName, Destination: destination},
+		time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Exported %d nodes and %d edges to %s: %s\n", result.Nodes, result.Edges, *output,
+		strings.Join(result.Files, ", "))
+	return nil
+}
+
+func loadTest(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	flags.SetOutput(out)
+	opts := generator.LoadOptions{}
+	flags.IntVar(&opts.Clusters, "clusters", 1, "Synthetic clusters syncing.")
+	flags.StringVar(&opts.Prefix, "prefix", "loadtest", "Prefix of the cluster names, e.g. loadtest-1.")
+	flags.IntVar(&opts.Nodes, "nodes", 1000, "Resources of each cluster.")
+	flags.IntVar(&opts.Edges, "edges", 2000, "Edges of each cluster.")
+	kinds := flags.String("kinds", "", "Share of each kind in the resources, a cluster running apps when empty.")
+	flags.IntVar(&opts.Deltas, "deltas", 10, "Deltas sent by each cluster after its resync.")
+	flags.IntVar(&opts.ChurnPercent, "churn", 1, "Percent of the resources changed by each delta.")
+	flags.IntVar(&opts.Concurrency, "concurrency", 1, "Clusters syncing at the same time.")
+	flags.Int64Var(&opts.Seed, "seed", 1, "Seed of the synthetic clusters, the same seed generates the same clusters.")
+	keep := flags.Bool("keep", false, "Keep the resources of the clusters in the datastore after the test.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if opts.Kinds, err = generator.ParseKinds(*kinds); err != nil {
+		return fmt.Errorf("--kinds: %w", err)
+	}
+	if err = db.ValidateClusterName(opts.Prefix + "-1"); err != nil {
+		return fmt.Errorf("--prefix: %w", err)
+	}
+
+	// The synthetic clusters don't have a ManagedCluster, their Cluster nodes are created by their first sync.
+	config.Cfg.SkipClusterValidation = "true"
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", handlers.SyncResources).Methods("POST")
+	report, err := generator.LoadTest(ctx, router, opts)
+	if !*keep {
+		for _, clusterName := range report.Clusters {
+			if _, deleteErr := db.DeleteCluster(ctx, clusterName); deleteErr != nil {
+				fmt.Fprintf(out, "Error deleting the resources of cluster %s: %s\n", clusterName, deleteErr)
+				continue
+			}
+			_, _ = db.Delete(ctx, []string{"cluster__" + clusterName})
+			_, _ = db.DeleteClusterSummary(ctx, clusterName)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SYNC\tCOUNT\tFAILED\tMEAN\tP50\tP95\tMAX")
+	for _, row := range []struct {
+		name      string
+		latencies generator.Latencies
+	}{{"resync", report.Resyncs}, {"delta", report.Deltas}} {
+		l := row.latencies
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", row.name, l.Count, l.Failed, l.Mean.Round(time.Microsecond),
+			l.P50.Round(time.Microsecond), l.P95.Round(time.Microsecond), l.Max.Round(time.Microsecond))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Synced %d resources and %d edges of %d clusters in %s\n", report.Resources, report.Edges,
+		len(report.Clusters), report.Duration.Round(time.Millisecond))
+	return nil
+}
+
+func stats(ctx context.Context, args []string, out io.Writer) error {
+	result, err := db.Store.Query(ctx, "MATCH (n) WHERE n.cluster IS NOT NULL RETURN n.cluster, count(n)")
+	if err != nil {
+		return err
+	}
+	resources := make(map[string]int)
+	clusters := []string{}
+	for result.Next() {
+		record := result.Record()
+		clusterName, _ := record.GetByIndex(0).(string)
+		resources[clusterName], _ = record.GetByIndex(1).(int)
+		clusters = append(clusters, clusterName)
+	}
+	sort.Strings(clusters)
+
+	edges, err := db.Store.Query(ctx, "MATCH ()-[e]->() RETURN count(e)")
+	if err != nil {
+		return err
+	}
+	totalEdges := 0
+	if edges.Next() {
+		totalEdges, _ = edges.Record().GetByIndex(0).(int)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tRESOURCES")
+	totalResources := 0
+	for _, clusterName := range clusters {
+		fmt.Fprintf(w, "%s\t%d\n", clusterName, resources[clusterName])
+		totalResources += resources[clusterName]
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\n", totalResources)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Clusters: %d, edges: %d\n", len(clusters), totalEdges)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func useClusterGraph(t *testing.T) {
+	t.Cleanup(db.UseTestDatastore())
+
+	_, err := db.Store.Query(context.Background(), "CREATE (c:Cluster {_uid:'cluster__c1', name:'c1', kind:'cluster'}), "+
+		"(:Pod {_uid:'c1/a', cluster:'c1'})-[:inCluster {_interCluster: true}]->(c), "+
+		"(:Pod {_uid:'c1/b', cluster:'c1'}), (:Pod {_uid:'c2/a', cluster:'c2'})")
+	assert.Nil(t, err)
+}
+
+func Test_stats(t *testing.T) {
+	useClusterGraph(t)
+	var out bytes.Buffer
+	assert.Equal(t, 0, Run([]string{"stats"}, &out))
+	assert.Equal(t, "CLUSTER  RESOURCES\nc1       2\nc2       1\nTOTAL    3\nClusters: 2, edges: 1\n", out.String())
+}
+
+func Test_prune(t *testing.T) {
+	useClusterGraph(t)
+	var out bytes.Buffer
+	assert.Equal(t, 1, Run([]string{"prune"}, &out), "--cluster is required")
+
+	out.Reset()
+	assert.Equal(t, 0, Run([]string{"prune", "--cluster", "c1", "--dry-run"}, &out))
+	assert.Equal(t, "Would delete 2 resources from cluster c1\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 0, Run([]string{"prune", "--cluster", "c1", "--all"}, &out))
+	assert.Contains(t, out.String(), "Deleted 2 resources from cluster c1\n")
+	result, err := db.Store.Query(context.Background(), "MATCH (n) RETURN count(n)")
+	assert.Nil(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, 1, result.Record().GetByIndex(0))
+}
+
+func Test_check(t *testing.T) {
+	useClusterGraph(t)
+	var out bytes.Buffer
+	assert.Equal(t, 0, Run([]string{"check"}, &out))
+	assert.Contains(t, out.String(), "Datastore OK")
+
+	out.Reset()
+	assert.Equal(t, 2, Run([]string{"unknown"}, &out))
+	assert.Contains(t, out.String(), "Usage:")
+}
+
+func Test_loadTest(t *testing.T) {
+	useClusterGraph(t)
+	var out bytes.Buffer
+	assert.Equal(t, 0, Run([]string{"loadtest", "--clusters", "2", "--nodes", "50", "--edges", "50", "--deltas", "2",
+		"--churn", "10"}, &out), out.String())
+	assert.Contains(t, out.String(), "Synced 120 resources and 100 edges of 2 clusters in ")
+	assert.Regexp(t, `resync\s+2\s+0\s`, out.String())
+	assert.Regexp(t, `delta\s+4\s+0\s`, out.String())
+
+	result, err := db.Store.Query(context.Background(),
+		"MATCH (n) WHERE n.cluster STARTS WITH 'loadtest' RETURN count(n)")
+	assert.Nil(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, 0, result.Record().GetByIndex(0), "The synthetic clusters are deleted.")
+
+	out.Reset()
+	assert.Equal(t, 1, Run([]string{"loadtest", "--kinds", "Pod=none"}, &out))
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package client is a typed client for the aggregator API, for the collector and other consumers.
+// The request and response bodies are the types of the handlers, so they can't drift from the aggregator.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/handlers"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// Client for the aggregator API. Safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	user       string
+	groups     []string
+	retries    int
+	backoff    time.Duration
+	compress   bool
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// Uses the HTTP client for the requests, e.g. with the TLS config trusting the certificate of the aggregator.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// Sends the token in the Authorization header of every request.
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// Sends the user and groups in the Impersonate-User and Impersonate-Group headers, searches are filtered by their
+// RBAC when RBAC_FILTER is enabled.
+func WithImpersonation(user string, groups ...string) Option {
+	return func(c *Client) { c.user, c.groups = user, groups }
+}
+
+// Retries the requests that failed to connect or were rejected with 429, 502, 503 or 504 up to retries times.
+// The wait starts at backoff and doubles on each retry, or follows the Retry-After header.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = retries, backoff }
+}
+
+// Compresses the sync bodies with gzip, enabled by default.
+func WithCompression(enabled bool) Option {
+	return func(c *Client) { c.compress = enabled }
+}
+
+// Returns a client for the aggregator at the base URL, e.g. https://search-aggregator:3010
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+		compress:   true,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Error for a response with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("aggregator responded with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Tells whether the aggregator rejected a delta sync because its epoch is stale, the collector must resync.
+func IsStaleEpoch(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.StatusCode == http.StatusConflict
+}
+
+// Sends the changes to the resources of the cluster since the last sync.
+// When the sync is rejected the response is returned with the error, e.g. with the current epoch for a stale epoch.
+func (c *Client) SyncDelta(ctx context.Context, clusterName string, event handlers.SyncEvent) (
+	handlers.SyncResponse, error) {
+	event.ClearAll = false
+	return c.sync(ctx, clusterName, event)
+}
+
+// Replaces the resources of the cluster with the ones in the event. The response has the new epoch for the deltas.
+func (c *Client) Resync(ctx context.Context, clusterName string, event handlers.SyncEvent) (
+	handlers.SyncResponse, error) {
+	event.ClearAll = true
+	return c.sync(ctx, clusterName, event)
+}
+
+func (c *Client) sync(ctx context.Context, clusterName string, event handlers.SyncEvent) (
+	handlers.SyncResponse, error) {
+	response := handlers.SyncResponse{}
+	// For the clock skew detection. Retries send the same time, their backoff is below the default skew threshold.
+	if event.SentAt.IsZero() {
+		event.SentAt = time.Now()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return response, err
+	}
+	encoding := ""
+	if c.compress {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err = writer.Write(body); err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			return response, err
+		}
+		body, encoding = compressed.Bytes(), "gzip"
+	}
+	// The aggregator responds with the SyncResponse for rejected syncs too.
+	err = c.do(ctx, http.MethodPost, clusterPath(clusterName, "sync"), body, encoding, &response)
+	return response, err
+}
+
+// Returns the resources and edges of the cluster in the graph, its epoch and its last sync.
+func (c *Client) GetClusterStatus(ctx context.Context, clusterName string) (handlers.ClusterStatusResponse, error) {
+	status := handlers.ClusterStatusResponse{}
+	err := c.do(ctx, http.MethodGet, clusterPath(clusterName, "status"), nil, "", &status)
+	return status, err
+}
+
+// Runs a saved search, e.g. {Search: "kind:pod namespace:default", Limit: 100}
+func (c *Client) Search(ctx context.Context, request handlers.SearchRequest) (handlers.SearchResponse, error) {
+	response := handlers.SearchResponse{}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	err = c.do(ctx, http.MethodPost, "/aggregator/search", body, "", &response)
+	return response, err
+}
+
+func clusterPath(clusterName string, action string) string {
+	return "/aggregator/clusters/" + url.PathEscape(clusterName) + "/" + action
+}
+
+// Sends the request, retrying as configured, and decodes the JSON response into result.
+// Returns a StatusError for a status other than 200, the body is still decoded when it's JSON.
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, encoding string,
+	result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		wait, err := c.try(ctx, method, path, body, encoding, result)
+		if wait < 0 || attempt >= c.retries {
+			return err
+		}
+		if wait == 0 {
+			wait = c.backoff << uint(attempt)
+			if wait > maxBackoff || wait <= 0 {
+				wait = maxBackoff
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Sends the request once. Returns a negative wait when the request must not be retried, or the wait from the
+// Retry-After header, 0 to use the backoff.
+func (c *Client) try(ctx context.Context, method string, path string, body []byte, encoding string,
+	result interface{}) (time.Duration, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bodyReader)
+	if err != nil {
+		return -1, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.user != "" {
+		req.Header.Set("Impersonate-User", c.user)
+		for _, group := range c.groups {
+			req.Header.Add("Impersonate-Group", group)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		}
+		return 0, err // Failed to connect, or the connection dropped.
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	isJSON := strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json")
+	if resp.StatusCode == http.StatusOK {
+		return -1, json.Unmarshal(respBody, result)
+	}
+
+	statusErr := &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+	if isJSON && json.Unmarshal(respBody, result) == nil {
+		statusErr.Message = http.StatusText(resp.StatusCode)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return retryAfter(resp.Header.Get("Retry-After")), statusErr
+	}
+	return -1, statusErr
+}
+
+// Returns the wait in a Retry-After header in seconds, 0 when it isn't set.
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
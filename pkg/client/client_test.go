@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/handlers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Resync(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "Aggregator has many pending requests, retry later.", http.StatusTooManyRequests)
+			return
+		}
+		assert.Equal(t, "/aggregator/clusters/cluster1/sync", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		body, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		event := handlers.SyncEvent{}
+		assert.NoError(t, json.NewDecoder(body).Decode(&event))
+		assert.True(t, event.ClearAll)
+		assert.Equal(t, "c1/pod", event.AddResources[0].UID)
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(handlers.SyncResponse{TotalAdded: 1, Epoch: 5}))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithBearerToken("secret"), WithRetries(2, time.Millisecond))
+	response, err := c.Resync(context.Background(), "cluster1", handlers.SyncEvent{
+		AddResources: []*db.Resource{{Kind: "Pod", UID: "c1/pod", Properties: map[string]interface{}{"kind": "Pod"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, response.TotalAdded)
+	assert.Equal(t, int64(5), response.Epoch)
+}
+
+func TestClient_SyncDelta_staleEpoch(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		assert.NoError(t, json.NewEncoder(w).Encode(handlers.SyncResponse{Epoch: 9}))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithCompression(false), WithRetries(2, time.Millisecond))
+	response, err := c.SyncDelta(context.Background(), "cluster1", handlers.SyncEvent{Epoch: 5})
+	assert.True(t, IsStaleEpoch(err))
+	assert.Equal(t, 1, attempts, "Conflicts are not retried.")
+	assert.Equal(t, int64(9), response.Epoch)
+}
+
+func TestClient_Search(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/aggregator/search", r.URL.Path)
+		assert.Equal(t, "alice", r.Header.Get("Impersonate-User"))
+		assert.Equal(t, []string{"dev", "ops"}, r.Header.Values("Impersonate-Group"))
+		request := handlers.SearchRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		if request.Search == "bad" {
+			http.Error(w, "Invalid search", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(handlers.SearchResponse{
+			Items: []map[string]interface{}{{"name": "pod1"}},
+		}))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithImpersonation("alice", "dev", "ops"))
+	response, err := c.Search(context.Background(), handlers.SearchRequest{Search: "kind:pod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "pod1", response.Items[0]["name"])
+
+	_, err = c.Search(context.Background(), handlers.SearchRequest{Search: "bad"})
+	assert.Equal(t, &StatusError{StatusCode: http.StatusBadRequest, Message: "Invalid search"}, err)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const aggregatorConfigGroupVersion = "search.open-cluster-management.io/v1alpha1"
+
+// Watches the cluster-scoped SearchAggregator resource named in the config and reconciles the settings
+// of the running aggregator with its spec. Deleting the resource goes back to the environment values.
+// onChange is called with the settings that changed, e.g. to tell the collectors.
+func WatchAggregatorConfig(onChange func(changes []string)) {
+	if config.Cfg.ConfigResourceName == "" {
+		logger.Info("CONFIG_RESOURCE_NAME is empty, settings are only read from the environment.")
+		return
+	}
+	logger.Info("Begin SearchAggregator config watch routine for resource ", config.Cfg.ConfigResourceName)
+
+	dynamicClient := config.GetDynamicClient()
+	dynamicFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 60*time.Second,
+		metav1.NamespaceAll, func(options *metav1.ListOptions) {
+			options.FieldSelector = "metadata.name=" + config.Cfg.ConfigResourceName
+		})
+	searchAggregatorGvr, _ := schema.ParseResourceArg("searchaggregators.v1alpha1.search.open-cluster-management.io")
+	informer := dynamicFactory.ForResource(*searchAggregatorGvr).Informer()
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			onChange(applyAggregatorConfig(obj))
+		},
+		UpdateFunc: func(prev interface{}, next interface{}) {
+			onChange(applyAggregatorConfig(next))
+		},
+		DeleteFunc: func(obj interface{}) {
+			logger.Infof("SearchAggregator %s deleted, using the settings from the environment.",
+				config.Cfg.ConfigResourceName)
+			onChange(config.ApplySpec(config.AggregatorSpec{}))
+		},
+	})
+
+	// Periodically check if the SearchAggregator resource exists
+	go stopAndStartInformer(aggregatorConfigGroupVersion, informer)
+}
+
+func applyAggregatorConfig(obj interface{}) []string {
+	resource, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		logger.Warning("SearchAggregator config watch received an unexpected object.")
+		return nil
+	}
+	spec, err := parseAggregatorSpec(resource)
+	if err != nil {
+		logger.Warningf("Error reading the spec of SearchAggregator %s, keeping the current settings: %s",
+			resource.GetName(), err)
+		return nil
+	}
+	changes := config.ApplySpec(spec)
+	logger.Infof("Reconciled settings with SearchAggregator %s generation %d, %d settings changed.",
+		resource.GetName(), resource.GetGeneration(), len(changes))
+	return changes
+}
+
+func parseAggregatorSpec(resource *unstructured.Unstructured) (config.AggregatorSpec, error) {
+	spec := config.AggregatorSpec{}
+	rawSpec, found, err := unstructured.NestedMap(resource.Object, "spec")
+	if err != nil || !found {
+		return spec, err
+	}
+	j, err := json.Marshal(rawSpec)
+	if err != nil {
+		return spec, err
+	}
+	err = json.Unmarshal(j, &spec)
+	return spec, err
+}
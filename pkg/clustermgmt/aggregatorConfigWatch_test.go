@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_parseAggregatorSpec(t *testing.T) {
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": aggregatorConfigGroupVersion,
+		"kind":       "SearchAggregator",
+		"metadata":   map[string]interface{}{"name": "search-aggregator"},
+		"spec": map[string]interface{}{
+			"chunkSize":     int64(100),
+			"excludedKinds": []interface{}{"Event"},
+		},
+	}}
+	spec, err := parseAggregatorSpec(resource)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, *spec.ChunkSize)
+	assert.Equal(t, []string{"Event"}, spec.ExcludedKinds)
+	assert.Nil(t, spec.RequestLimit)
+
+	resource.Object["spec"] = map[string]interface{}{"chunkSize": "lots"}
+	_, err = parseAggregatorSpec(resource)
+	assert.NotNil(t, err)
+
+	delete(resource.Object, "spec")
+	spec, err = parseAggregatorSpec(resource)
+	assert.Nil(t, err)
+	assert.Nil(t, spec.ChunkSize)
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"context"
+	"sort"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Properties last set on the nodes of each cluster, to remove the ones taken out of CLUSTER_PROPERTIES.
+var appliedClusterProperties = make(map[string]map[string]string)
+
+// Sets the CLUSTER_PROPERTIES on the nodes stored before they were configured or changed, and removes the
+// properties since taken out of the config. The new resources get them when they're written.
+func reconcileClusterProperties() {
+	clusters := db.ClusterPropertiesClusters()
+	for clusterName := range appliedClusterProperties {
+		if len(db.ClusterPropertiesOf(clusterName)) == 0 {
+			clusters = append(clusters, clusterName)
+		}
+	}
+	for _, clusterName := range clusters {
+		properties := db.ClusterPropertiesOf(clusterName)
+		unset := []string{}
+		for property := range appliedClusterProperties[clusterName] {
+			if _, ok := properties[property]; !ok {
+				unset = append(unset, property)
+			}
+		}
+		sort.Strings(unset)
+		logger.V(3).Infof("Tagging resources from cluster %s with %d cluster properties, removing %d.", clusterName,
+			len(properties), len(unset))
+		if err := db.RetagClusterProperties(context.Background(), clusterName, properties, unset); err != nil {
+			logger.Warningf("Error tagging resources from cluster %s with the cluster properties: %s", clusterName, err)
+			continue
+		}
+		if len(properties) == 0 {
+			delete(appliedClusterProperties, clusterName)
+		} else {
+			appliedClusterProperties[clusterName] = properties
+		}
+	}
+}
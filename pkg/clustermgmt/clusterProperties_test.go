@@ -0,0 +1,42 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_reconcileClusterProperties(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	defer func() {
+		appliedClusterProperties = make(map[string]map[string]string)
+	}()
+	t.Cleanup(db.UseTestDatastore())
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a', cluster:'c1'}), (:Pod {_uid:'c2/a', cluster:'c2'})")
+	assert.NoError(t, err)
+	count := func(condition string) interface{} {
+		result, err := db.Store.Query(ctx, "MATCH (n) WHERE "+condition+" RETURN count(n)")
+		assert.NoError(t, err)
+		assert.True(t, result.Next())
+		return result.Record().GetByIndex(0)
+	}
+
+	config.Cfg.ClusterProperties = `{"c1": {"environment": "prod", "region": "eu"}, "c2": {"region": "us"}}`
+	reconcileClusterProperties()
+	assert.Equal(t, 1, count("n.environment = 'prod' AND n.region = 'eu'"))
+	assert.Equal(t, 1, count("n.region = 'us'"))
+
+	// The properties taken out of the config are removed from the nodes.
+	config.Cfg.ClusterProperties = `{"c1": {"region": "eu"}}`
+	reconcileClusterProperties()
+	assert.Equal(t, 0, count("n.environment IS NOT NULL"))
+	assert.Equal(t, 1, count("n.region IS NOT NULL"))
+	assert.Equal(t, map[string]map[string]string{"c1": {"region": "eu"}}, appliedClusterProperties)
+}
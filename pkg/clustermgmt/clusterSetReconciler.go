@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Clusters whose ManagedClusterSet membership changed and need their nodes retagged.
+var clusterSetChanges = make(chan string, 100)
+
+// Clusters to retag on the next periodic reconcile. A cluster stays pending after its immediate retag, in case a sync
+// that read the previous membership wrote after it, and until its retag succeeds.
+var (
+	pendingClusterSetRetags      = make(map[string]bool)
+	pendingClusterSetRetagsMutex = sync.Mutex{}
+)
+
+// Queues a retag for the cluster. If the queue is full the periodic reconcile picks up the change.
+func requestClusterSetRetag(clusterName string) {
+	pendingClusterSetRetagsMutex.Lock()
+	pendingClusterSetRetags[clusterName] = true
+	pendingClusterSetRetagsMutex.Unlock()
+	select {
+	case clusterSetChanges <- clusterName:
+	default:
+		logger.V(3).Info("ClusterSet retag queue is full, deferring to periodic reconcile for cluster ", clusterName)
+	}
+}
+
+// Keeps the clusterset property on nodes in sync with the ManagedClusterSet membership of their cluster.
+// Retags a cluster as soon as its membership changes, and again with the periodic reconcile. The retag scans the
+// nodes of the cluster, so the clusters whose membership didn't change aren't retagged, their new resources are tagged
+// when they're written. The periodic reconcile also sets the CLUSTER_PROPERTIES.
+func ReconcileClusterSets() {
+	logger.Info("Begin ClusterSet reconcile routine")
+	ticker := time.NewTicker(time.Duration(config.Cfg.ClusterSetReconcileRateMS) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case clusterName := <-clusterSetChanges:
+			retagClusterSet(clusterName, db.GetClusterSet(clusterName))
+		case <-ticker.C:
+			reconcilePendingClusterSets()
+			reconcileClusterProperties()
+		}
+	}
+}
+
+// Retags the pending clusters, the ones that fail stay pending.
+func reconcilePendingClusterSets() {
+	pendingClusterSetRetagsMutex.Lock()
+	pending := pendingClusterSetRetags
+	pendingClusterSetRetags = make(map[string]bool)
+	pendingClusterSetRetagsMutex.Unlock()
+	for clusterName := range pending {
+		if !retagClusterSet(clusterName, db.GetClusterSet(clusterName)) {
+			pendingClusterSetRetagsMutex.Lock()
+			pendingClusterSetRetags[clusterName] = true
+			pendingClusterSetRetagsMutex.Unlock()
+		}
+	}
+}
+
+// Returns false if the retag failed.
+func retagClusterSet(clusterName, clusterSet string) bool {
+	logger.V(3).Infof("Tagging resources from cluster %s with clusterset '%s'", clusterName, clusterSet)
+	_, err := db.RetagClusterSet(context.Background(), clusterName, clusterSet)
+	if err != nil {
+		logger.Warningf("Error tagging resources from cluster %s with clusterset '%s': %s", clusterName, clusterSet, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"context"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+// Only the clusters whose membership changed are retagged.
+func Test_reconcilePendingClusterSets(t *testing.T) {
+	t.Cleanup(db.UseTestDatastore())
+	defer func() {
+		db.DeleteClusterSet("c1")
+		db.DeleteClusterSet("c2")
+		for len(clusterSetChanges) > 0 {
+			<-clusterSetChanges
+		}
+	}()
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a', cluster:'c1'}), (:Pod {_uid:'c2/a', cluster:'c2'})")
+	assert.NoError(t, err)
+	count := func(condition string) interface{} {
+		result, err := db.Store.Query(ctx, "MATCH (n) WHERE "+condition+" RETURN count(n)")
+		assert.NoError(t, err)
+		assert.True(t, result.Next())
+		return result.Record().GetByIndex(0)
+	}
+
+	db.SetClusterSet("c1", "set1")
+	db.SetClusterSet("c2", "set2")
+	requestClusterSetRetag("c1")
+	reconcilePendingClusterSets()
+	assert.Equal(t, 1, count("n.clusterset = 'set1'"))
+	assert.Equal(t, 0, count("n.clusterset = 'set2'"), "The membership of c2 didn't change.")
+	assert.Empty(t, pendingClusterSetRetags)
+}
@@ -12,12 +12,14 @@ Copyright (c) 2020 Red Hat, Inc.
 package clustermgmt
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/golang/glog"
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -32,7 +34,7 @@ import (
 // Watches ManagedCluster and ManagedClusterInfo objects and updates
 // the search graph with a Cluster pseudo node.
 func WatchClusters() {
-	glog.Info("Begin ClusterWatch routine")
+	logger.Info("Begin ClusterWatch routine")
 
 	dynamicClient := config.GetDynamicClient()
 	dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 60*time.Second)
@@ -65,6 +67,48 @@ func WatchClusters() {
 	// Periodically check if the ManagedCluster/ManagedClusterInfo resource exists
 	go stopAndStartInformer("cluster.open-cluster-management.io/v1", managedClusterInformer)
 	go stopAndStartInformer("internal.open-cluster-management.io/v1beta1", managedClusterInfoInformer)
+	if config.Cfg.CollectorAddonName != "" {
+		watchCollectorAddons(dynamicFactory)
+	}
+}
+
+// State of the cluster informers by group version, for the readiness check.
+type informerState struct {
+	informer cache.SharedIndexInformer // nil while it isn't running.
+	err      error                     // Error reading the resources of the group version.
+}
+
+var (
+	informerStates      = make(map[string]informerState)
+	informerStatesMutex = sync.Mutex{}
+)
+
+func setInformerState(groupVersion string, informer cache.SharedIndexInformer, err error) {
+	informerStatesMutex.Lock()
+	defer informerStatesMutex.Unlock()
+	informerStates[groupVersion] = informerState{informer: informer, err: err}
+}
+
+// Readiness check of the cluster watch, failing while the hub API can't be read or a running informer isn't synced.
+// The informers that aren't running because their resource doesn't exist on the hub are ready.
+func ClusterWatchReady() error {
+	informerStatesMutex.Lock()
+	defer informerStatesMutex.Unlock()
+	groupVersions := make([]string, 0, len(informerStates))
+	for groupVersion := range informerStates {
+		groupVersions = append(groupVersions, groupVersion)
+	}
+	sort.Strings(groupVersions)
+	for _, groupVersion := range groupVersions {
+		state := informerStates[groupVersion]
+		if state.err != nil {
+			return fmt.Errorf("Cannot fetch the resources of %s: %v", groupVersion, state.err)
+		}
+		if state.informer != nil && !state.informer.HasSynced() {
+			return fmt.Errorf("The %s cluster informer isn't synced yet", groupVersion)
+		}
+	}
+	return nil
 }
 
 // Stop and Start informer according to Rediscover Rate
@@ -76,18 +120,24 @@ func stopAndStartInformer(groupVersion string, informer cache.SharedIndexInforme
 		_, err := config.GetKubeClient().ServerResourcesForGroupVersion(groupVersion)
 		// we fail to fetch for some reason other than not found
 		if err != nil && !isClusterMissing(err) {
-			glog.Errorf("Cannot fetch resource list for %s, error message: %s ", groupVersion, err)
+			logger.Errorf("Cannot fetch resource list for %s, error message: %s ", groupVersion, err)
+			setInformerState(groupVersion, nil, err)
 		} else {
 			if informerRunning && isClusterMissing(err) {
-				glog.Infof("Stopping cluster informer routine because %s resource not found.", groupVersion)
+				logger.Infof("Stopping cluster informer routine because %s resource not found.", groupVersion)
 				stopper <- struct{}{}
 				informerRunning = false
 			} else if !informerRunning && !isClusterMissing(err) {
-				glog.Infof("Starting cluster informer routine for cluster watch for %s resource", groupVersion)
+				logger.Infof("Starting cluster informer routine for cluster watch for %s resource", groupVersion)
 				stopper = make(chan struct{})
 				informerRunning = true
 				go informer.Run(stopper)
 			}
+			if informerRunning {
+				setInformerState(groupVersion, informer, nil)
+			} else {
+				setInformerState(groupVersion, nil, nil)
+			}
 		}
 		time.Sleep(time.Duration(config.Cfg.RediscoverRateMS) * time.Millisecond)
 	}
@@ -102,7 +152,7 @@ func processClusterUpsert(obj interface{}) {
 	defer mux.Unlock()
 	j, err := json.Marshal(obj.(*unstructured.Unstructured))
 	if err != nil {
-		glog.Warning("Error unmarshalling object from Informer in processClusterUpsert.")
+		logger.Warning("Error unmarshalling object from Informer in processClusterUpsert.")
 	}
 
 	// We update by name, and the name *should be* the same for a given cluster in either object
@@ -116,44 +166,47 @@ func processClusterUpsert(obj interface{}) {
 		managedCluster := clusterv1.ManagedCluster{}
 		err = json.Unmarshal(j, &managedCluster)
 		if err != nil {
-			glog.Warning("Failed to Unmarshal MangedCluster", err)
+			logger.Warning("Failed to Unmarshal MangedCluster", err)
 		}
 		resource = transformManagedCluster(&managedCluster)
+		if db.SetClusterSet(managedCluster.GetName(), managedCluster.GetLabels()[db.CLUSTERSET_LABEL]) {
+			requestClusterSetRetag(managedCluster.GetName())
+		}
 	case "ManagedClusterInfo":
 		managedClusterInfo := clusterv1beta1.ManagedClusterInfo{}
 		err = json.Unmarshal(j, &managedClusterInfo)
 		if err != nil {
-			glog.Warning("Failed to Unmarshal ManagedclusterInfo", err)
+			logger.Warning("Failed to Unmarshal ManagedclusterInfo", err)
 		}
 		resource = transformManagedClusterInfo(&managedClusterInfo)
 	default:
-		glog.Warning("ClusterWatch received unknown kind.", obj.(*unstructured.Unstructured).GetKind())
+		logger.Warning("ClusterWatch received unknown kind.", obj.(*unstructured.Unstructured).GetKind())
 	}
 
 	// Upsert (attempt update, attempt insert on failure)
-	glog.V(2).Info("Updating Cluster resource by name in RedisGraph. ", resource)
-	res, err, alreadySET := db.UpdateByName(resource)
+	logger.V(2).Info("Updating Cluster resource by name in RedisGraph. ", resource)
+	res, err, alreadySET := db.UpdateByName(context.Background(), resource)
 	if err != nil {
-		glog.Warning("Error on UpdateByName() ", err)
+		logger.Warning("Error on UpdateByName() ", err)
 	}
 
 	if alreadySET {
-		glog.V(4).Infof("Node for cluster %s already exist on DB.", resource.Properties["name"])
+		logger.V(4).Infof("Node for cluster %s already exist on DB.", resource.Properties["name"])
 		return
 	}
 
 	if db.IsGraphMissing(err) || (err == nil && !db.IsPropertySet(res)) {
-		glog.Infof("Node for cluster %s does not exist, inserting it.", resource.Properties["name"])
-		_, _, err = db.Insert([]*db.Resource{&resource}, "")
+		logger.Infof("Node for cluster %s does not exist, inserting it.", resource.Properties["name"])
+		_, _, err = db.Insert(context.Background(), []*db.Resource{&resource}, "")
 		if err != nil {
-			glog.Error("Error adding Cluster node with error: ", err)
+			logger.Error("Error adding Cluster node with error: ", err)
 			return
 		}
 	}
 
 	// If a cluster is offline we remove the resources from that cluster, but leave the cluster resource object.
 	/*if resource.Properties["status"] == "offline" {
-		glog.Infof("Cluster %s is offline, removing cluster resources from datastore.", cluster.GetName())
+		logger.Infof("Cluster %s is offline, removing cluster resources from datastore.", cluster.GetName())
 		delClusterResources(cluster)
 	}*/
 
@@ -185,7 +238,8 @@ func transformManagedCluster(managedCluster *clusterv1.ManagedCluster) db.Resour
 	}
 
 	props["kind"] = "Cluster"
-	props["name"] = managedCluster.GetName()                  // must match ManagedClusterInfo
+	props["name"] = managedCluster.GetName() // must match ManagedClusterInfo
+	props[db.CLUSTERSET_PROPERTY] = managedCluster.GetLabels()[db.CLUSTERSET_LABEL]
 	props["_clusterNamespace"] = managedCluster.GetName()     // maps to the namespace of ManagedClusterInfo
 	props["apigroup"] = "internal.open-cluster-management.io" // maps rbac to ManagedClusterInfo
 	props["created"] = managedCluster.GetCreationTimestamp().UTC().Format(time.RFC3339)
@@ -236,25 +290,36 @@ func transformManagedClusterInfo(managedClusterInfo *clusterv1beta1.ManagedClust
 
 // Deletes a cluster resource and all resources from the cluster.
 func processClusterDelete(obj interface{}) {
-	glog.Info("Processing Cluster Delete.")
+	logger.Info("Processing Cluster Delete.")
 
 	clusterName := obj.(*unstructured.Unstructured).GetName()
 	clusterUID := string("cluster__" + obj.(*unstructured.Unstructured).GetName())
-	glog.Infof("Deleting Cluster resource %s and all resources from the cluster. UID %s", clusterName, clusterUID)
+	logger.Infof("Deleting Cluster resource %s and all resources from the cluster. UID %s", clusterName, clusterUID)
 
-	_, err := db.Delete([]string{clusterUID})
+	_, err := db.Delete(context.Background(), []string{clusterUID})
 	if err != nil {
-		glog.Error("Error deleting Cluster node with error: ", err)
+		logger.Error("Error deleting Cluster node with error: ", err)
 	}
 	delClusterResources(clusterUID, clusterName)
+	db.DeleteClusterSet(clusterName)
+	_, err = db.DeleteClusterSummary(context.Background(), clusterName)
+	if err != nil {
+		logger.Error("Error deleting summary for cluster: ", err)
+	}
+	err = db.DeleteNamespaceUsage(context.Background(), clusterName)
+	if err != nil {
+		logger.Error("Error deleting namespace usage for cluster: ", err)
+	}
 }
 
 // Removes all the resources for a cluster, but doesn't remove the Cluster resource object.
 func delClusterResources(clusterUID string, clusterName string) {
-	_, err := db.DeleteCluster(clusterName)
+	_, err := db.DeleteCluster(context.Background(), clusterName)
 	if err != nil {
-		glog.Error("Error deleting current resources for cluster: ", err)
+		logger.Error("Error deleting current resources for cluster: ", err)
 	} else {
 		db.DeleteClustersCache(clusterUID)
+		db.DropPendingDeletes(clusterName)
+		db.DropRetries(clusterName)
 	}
 }
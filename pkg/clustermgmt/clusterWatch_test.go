@@ -5,6 +5,7 @@ package clustermgmt
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"testing"
 
@@ -12,6 +13,8 @@ import (
 	clusterv1 "github.com/open-cluster-management/api/cluster/v1"
 	clusterv1beta1 "github.com/open-cluster-management/multicloud-operators-foundation/pkg/apis/cluster/v1beta1"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
 )
 
 func unmarshalFile(filepath string, resourceType interface{}, t *testing.T) {
@@ -51,6 +54,16 @@ func Test_transformManagedCluster(t *testing.T) {
 	assert.Equal(t, "cluster__managed-cluster-01", result.UID, "Test property: UID")
 }
 
+func Test_transformManagedCluster_clusterSet(t *testing.T) {
+	managedCluster := clusterv1.ManagedCluster{}
+	unmarshalFile("managed-cluster.json", &managedCluster, t)
+	managedCluster.Labels["cluster.open-cluster-management.io/clusterset"] = "set-a"
+
+	result := transformManagedCluster(&managedCluster)
+
+	assert.Equal(t, "set-a", result.Properties["clusterset"], "Test property: clusterset")
+}
+
 func Test_transformManagedClusterInfo(t *testing.T) {
 	managedClusterInfo := clusterv1beta1.ManagedClusterInfo{}
 	unmarshalFile("managed-cluster-info.json", &managedClusterInfo, t)
@@ -66,3 +79,26 @@ func Test_transformManagedClusterInfo(t *testing.T) {
 	assert.Equal(t, "managedclusterinfos", result.ResourceString, "Test property: ResourceString")
 	assert.Equal(t, "cluster__managed-cluster-01", result.UID, "Test property: UID")
 }
+
+func TestClusterWatchReady(t *testing.T) {
+	informerStatesMutex.Lock()
+	prevStates := informerStates
+	informerStates = make(map[string]informerState)
+	informerStatesMutex.Unlock()
+	defer func() {
+		informerStatesMutex.Lock()
+		informerStates = prevStates
+		informerStatesMutex.Unlock()
+	}()
+
+	setInformerState("internal.open-cluster-management.io/v1beta1", nil, nil)
+	assert.NoError(t, ClusterWatchReady(), "An informer without its resource on the hub is ready.")
+
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &unstructured.Unstructured{}, 0, cache.Indexers{})
+	setInformerState("cluster.open-cluster-management.io/v1", informer, nil)
+	assert.EqualError(t, ClusterWatchReady(), "The cluster.open-cluster-management.io/v1 cluster informer isn't synced yet")
+
+	setInformerState("cluster.open-cluster-management.io/v1", nil, errors.New("connection refused"))
+	assert.EqualError(t, ClusterWatchReady(),
+		"Cannot fetch the resources of cluster.open-cluster-management.io/v1: connection refused")
+}
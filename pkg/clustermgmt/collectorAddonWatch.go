@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watches the ManagedClusterAddOn of the collectors, named COLLECTOR_ADDON_NAME in the namespace of each cluster,
+// so the status API tells a cluster whose collector is down from an empty one.
+func watchCollectorAddons(dynamicFactory dynamicinformer.DynamicSharedInformerFactory) {
+	addonGvr, _ := schema.ParseResourceArg("managedclusteraddons.v1alpha1.addon.open-cluster-management.io")
+	addonInformer := dynamicFactory.ForResource(*addonGvr).Informer()
+	addonInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			processCollectorAddon(obj)
+		},
+		UpdateFunc: func(prev interface{}, next interface{}) {
+			processCollectorAddon(next)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if addon, ok := obj.(*unstructured.Unstructured); ok && addon.GetName() == config.Cfg.CollectorAddonName {
+				db.DeleteCollectorAddon(addon.GetNamespace())
+			}
+		},
+	})
+	go stopAndStartInformer("addon.open-cluster-management.io/v1alpha1", addonInformer)
+}
+
+func processCollectorAddon(obj interface{}) {
+	addon, ok := obj.(*unstructured.Unstructured)
+	if !ok || addon.GetName() != config.Cfg.CollectorAddonName {
+		return
+	}
+	if status, ok := collectorAddonStatus(addon); ok {
+		logger.V(3).Infof("Collector addon of cluster %s available: %t", addon.GetNamespace(), status.Available)
+		db.SetCollectorAddon(addon.GetNamespace(), status)
+	}
+}
+
+// Returns the status from the Available condition of the addon, false when it has none yet.
+func collectorAddonStatus(addon *unstructured.Unstructured) (db.CollectorAddon, bool) {
+	conditions, _, _ := unstructured.NestedSlice(addon.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Available" {
+			continue
+		}
+		status := db.CollectorAddon{Available: condition["status"] == "True"}
+		status.Reason, _ = condition["reason"].(string)
+		status.Message, _ = condition["message"].(string)
+		if transition, ok := condition["lastTransitionTime"].(string); ok {
+			status.Since, _ = time.Parse(time.RFC3339, transition)
+		}
+		return status, true
+	}
+	return db.CollectorAddon{}, false
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func Test_collectorAddonStatus(t *testing.T) {
+	addon := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "search-collector", "namespace": "c1"},
+		"status": map[string]interface{}{"conditions": []interface{}{
+			map[string]interface{}{"type": "Progressing", "status": "False"},
+			map[string]interface{}{"type": "Available", "status": "False", "reason": "ProbeUnavailable",
+				"message": "Probe addon unavailable", "lastTransitionTime": "2021-06-01T10:00:00Z"},
+		}},
+	}}
+
+	status, ok := collectorAddonStatus(addon)
+	assert.True(t, ok)
+	assert.False(t, status.Available)
+	assert.Equal(t, "ProbeUnavailable", status.Reason)
+	assert.Equal(t, "Probe addon unavailable", status.Message)
+	assert.Equal(t, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), status.Since)
+
+	addon.Object["status"] = map[string]interface{}{}
+	_, ok = collectorAddonStatus(addon)
+	assert.False(t, ok, "No Available condition yet.")
+}
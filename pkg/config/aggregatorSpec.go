@@ -0,0 +1,141 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Config from the environment and defaults, before any setting from the SearchAggregator resource.
+// Settings removed from the resource go back to these values.
+var envCfg Config
+
+// Guards the settings of the SearchAggregator resource in Cfg. ApplySpec changes them from the informer while the
+// handlers and background jobs read them, so they're read with the accessors below.
+var specMutex sync.RWMutex
+
+// Spec of the cluster-scoped SearchAggregator resource. Unset fields keep the value from the environment.
+type AggregatorSpec struct {
+	ChunkSize                 *int                         `json:"chunkSize,omitempty"`
+	ClusterProperties         map[string]map[string]string `json:"clusterProperties,omitempty"`
+	EdgeBuildRateMS           *int                         `json:"edgeBuildRateMS,omitempty"`
+	ExcludedKinds             []string                     `json:"excludedKinds,omitempty"`
+	QueryTimeoutMS            *int                         `json:"queryTimeoutMS,omitempty"`
+	RequestLimit              *int                         `json:"requestLimit,omitempty"`
+	SyncHistoryRetentionHours *int                         `json:"syncHistoryRetentionHours,omitempty"`
+	TombstoneRetentionHours   *int                         `json:"tombstoneRetentionHours,omitempty"`
+}
+
+// Reconciles the running config with the spec and logs each setting changed.
+// Returns the changes, e.g. "chunkSize: 40 -> 100". Apply an empty spec to go back to the environment values.
+func ApplySpec(spec AggregatorSpec) []string {
+	specMutex.Lock()
+	defer specMutex.Unlock()
+	changes := []string{}
+	applyInt := func(name string, field *int, envValue int, value *int) {
+		next := envValue
+		if value != nil && *value > 0 {
+			next = *value
+		} else if value != nil {
+			logger.Warningf("Ignoring %s from the SearchAggregator resource, it must be greater than 0: %d", name, *value)
+		}
+		if *field != next {
+			changes = append(changes, fmt.Sprintf("%s: %d -> %d", name, *field, next))
+			*field = next
+		}
+	}
+	applyInt("chunkSize", &Cfg.ChunkSize, envCfg.ChunkSize, spec.ChunkSize)
+	applyInt("edgeBuildRateMS", &Cfg.EdgeBuildRateMS, envCfg.EdgeBuildRateMS, spec.EdgeBuildRateMS)
+	applyInt("queryTimeoutMS", &Cfg.QueryTimeoutMS, envCfg.QueryTimeoutMS, spec.QueryTimeoutMS)
+	applyInt("requestLimit", &Cfg.RequestLimit, envCfg.RequestLimit, spec.RequestLimit)
+	applyInt("syncHistoryRetentionHours", &Cfg.SyncHistoryRetentionHours, envCfg.SyncHistoryRetentionHours,
+		spec.SyncHistoryRetentionHours)
+	applyInt("tombstoneRetentionHours", &Cfg.TombstoneRetentionHours, envCfg.TombstoneRetentionHours,
+		spec.TombstoneRetentionHours)
+
+	excludedKinds := envCfg.ExcludedKinds
+	if spec.ExcludedKinds != nil {
+		excludedKinds = strings.Join(spec.ExcludedKinds, ",")
+	}
+	if Cfg.ExcludedKinds != excludedKinds {
+		changes = append(changes, fmt.Sprintf("excludedKinds: '%s' -> '%s'", Cfg.ExcludedKinds, excludedKinds))
+		Cfg.ExcludedKinds = excludedKinds
+	}
+
+	clusterProperties := envCfg.ClusterProperties
+	if spec.ClusterProperties != nil {
+		if encoded, err := json.Marshal(spec.ClusterProperties); err == nil {
+			clusterProperties = string(encoded)
+		}
+	}
+	if Cfg.ClusterProperties != clusterProperties {
+		changes = append(changes, fmt.Sprintf("clusterProperties: '%s' -> '%s'", Cfg.ClusterProperties,
+			clusterProperties))
+		Cfg.ClusterProperties = clusterProperties
+	}
+
+	for _, change := range changes {
+		logger.Info("Applied setting from the SearchAggregator resource. ", change)
+	}
+	return changes
+}
+
+// Returns CHUNK_SIZE, or the chunkSize of the SearchAggregator resource.
+func ChunkSize() int {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.ChunkSize
+}
+
+// Returns CLUSTER_PROPERTIES, or the clusterProperties of the SearchAggregator resource as JSON.
+func ClusterProperties() string {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.ClusterProperties
+}
+
+// Returns EDGE_BUILD_RATE_MS, or the edgeBuildRateMS of the SearchAggregator resource.
+func EdgeBuildRateMS() int {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.EdgeBuildRateMS
+}
+
+// Returns EXCLUDED_KINDS, or the excludedKinds of the SearchAggregator resource joined with commas.
+func ExcludedKinds() string {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.ExcludedKinds
+}
+
+// Returns QUERY_TIMEOUT_MS, or the queryTimeoutMS of the SearchAggregator resource.
+func QueryTimeoutMS() int {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.QueryTimeoutMS
+}
+
+// Returns REQUEST_LIMIT, or the requestLimit of the SearchAggregator resource.
+func RequestLimit() int {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.RequestLimit
+}
+
+// Returns SYNC_HISTORY_RETENTION_HOURS, or the syncHistoryRetentionHours of the SearchAggregator resource.
+func SyncHistoryRetentionHours() int {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.SyncHistoryRetentionHours
+}
+
+// Returns TOMBSTONE_RETENTION_HOURS, or the tombstoneRetentionHours of the SearchAggregator resource.
+func TombstoneRetentionHours() int {
+	specMutex.RLock()
+	defer specMutex.RUnlock()
+	return Cfg.TombstoneRetentionHours
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ApplySpec(t *testing.T) {
+	t.Cleanup(Snapshot())
+
+	chunkSize, requestLimit := 100, 0
+	changes := ApplySpec(AggregatorSpec{ChunkSize: &chunkSize, RequestLimit: &requestLimit,
+		ExcludedKinds: []string{"Event", "ReplicaSet"}})
+	assert.Equal(t, []string{"chunkSize: 40 -> 100", "excludedKinds: '' -> 'Event,ReplicaSet'"}, changes)
+	assert.Equal(t, 100, Cfg.ChunkSize)
+	assert.Equal(t, envCfg.RequestLimit, Cfg.RequestLimit, "Invalid values are ignored")
+	assert.Empty(t, ApplySpec(AggregatorSpec{ChunkSize: &chunkSize, ExcludedKinds: []string{"Event", "ReplicaSet"}}))
+
+	// Removing the settings goes back to the environment values.
+	changes = ApplySpec(AggregatorSpec{})
+	assert.Equal(t, []string{"chunkSize: 100 -> 40", "excludedKinds: 'Event,ReplicaSet' -> ''"}, changes)
+	assert.Equal(t, DEFAULT_CHUNK_SIZE, Cfg.ChunkSize)
+
+	// The cluster properties are kept as JSON, like CLUSTER_PROPERTIES.
+	changes = ApplySpec(AggregatorSpec{ClusterProperties: map[string]map[string]string{"c1": {"region": "eu"}}})
+	assert.Equal(t, []string{`clusterProperties: '' -> '{"c1":{"region":"eu"}}'`}, changes)
+	assert.Equal(t, `{"c1":{"region":"eu"}}`, Cfg.ClusterProperties)
+}
+
+// The settings are read while the informer applies the spec, run with -race.
+func Test_ApplySpec_concurrentReads(t *testing.T) {
+	t.Cleanup(Snapshot())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			chunkSize := i
+			ApplySpec(AggregatorSpec{ChunkSize: &chunkSize, ExcludedKinds: []string{"Event"}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Greater(t, ChunkSize(), 0)
+		assert.Contains(t, []string{"", "Event"}, ExcludedKinds())
+	}
+	<-done
+	assert.Equal(t, 100, ChunkSize())
+	assert.Equal(t, "Event", ExcludedKinds())
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Serving certificate and key of the aggregator, mounted from a Secret.
+const (
+	TLS_CERT_FILE = "./sslcert/tls.crt"
+	TLS_KEY_FILE  = "./sslcert/tls.key"
+)
+
+// Serving certificate and collector CA bundles, reloaded when their files change so a rotated Secret is used
+// without restarting the aggregator or dropping the open connections.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+	caFiles  []string // PEM bundles verifying the collector client certificates, none when mTLS is disabled.
+
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	contents  map[string][]byte // Last loaded content of each file.
+}
+
+// Returns a reloader for the serving certificate and the collector CA bundles, loaded from the files. Fails when
+// they can't be loaded, the aggregator can't serve without them.
+func NewCertificateReloader(certFile, keyFile string, caFiles []string) (*CertificateReloader, error) {
+	c := &CertificateReloader{certFile: certFile, keyFile: keyFile, caFiles: caFiles,
+		contents: make(map[string][]byte)}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Loads the files again when one changed. Returns whether they were reloaded. The previous certificate and CAs are
+// kept when the new ones are invalid, e.g. while the Secret is half updated.
+func (c *CertificateReloader) Reload() (bool, error) {
+	files := append([]string{c.certFile, c.keyFile}, c.caFiles...)
+	contents := make(map[string][]byte, len(files))
+	changed := false
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file) // #nosec G304 - The files are from the configuration.
+		if err != nil {
+			return false, err
+		}
+		contents[file] = content
+		changed = changed || !bytes.Equal(content, c.contents[file])
+	}
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(contents[c.certFile], contents[c.keyFile])
+	if err != nil {
+		return false, fmt.Errorf("Invalid serving certificate %s: %w", c.certFile, err)
+	}
+	var clientCAs *x509.CertPool
+	if len(c.caFiles) > 0 {
+		// The bundles are merged, so the old and the new CA are both trusted while the collectors move to the new one.
+		clientCAs = x509.NewCertPool()
+		for _, file := range c.caFiles {
+			if !clientCAs.AppendCertsFromPEM(contents[file]) {
+				return false, errors.New("No certificates found in collector CA file " + file)
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cert, c.clientCAs, c.contents = &cert, clientCAs, contents
+	return true, nil
+}
+
+// Returns the current serving certificate, for tls.Config.GetCertificate.
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.cert, nil
+}
+
+// Returns the TLS config serving the current certificate. With collector CA bundles, the client certificates are
+// verified with the current CAs when they're sent. They aren't required, the search API calls without one, so the
+// collector routes check them.
+func (c *CertificateReloader) TLSConfig(base *tls.Config) *tls.Config {
+	return c.tlsConfig(base, tls.VerifyClientCertIfGiven)
+}
+
+// Like TLSConfig, but the handshake fails without a client certificate verified with the collector CAs, so every
+// route of the listener requires one.
+func (c *CertificateReloader) MutualTLSConfig(base *tls.Config) *tls.Config {
+	return c.tlsConfig(base, tls.RequireAndVerifyClientCert)
+}
+
+func (c *CertificateReloader) tlsConfig(base *tls.Config, clientAuth tls.ClientAuthType) *tls.Config {
+	cfg := base.Clone()
+	cfg.GetCertificate = c.GetCertificate
+	if len(c.caFiles) == 0 {
+		return cfg
+	}
+	cfg.ClientAuth = clientAuth
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c.mutex.RLock()
+		defer c.mutex.RUnlock()
+		clientCfg := cfg.Clone()
+		clientCfg.GetConfigForClient = nil
+		clientCfg.ClientCAs = c.clientCAs
+		return clientCfg, nil
+	}
+	return cfg
+}
+
+// Checks the files for changes every TLS_RELOAD_RATE_MS. New connections use the new certificate, the open ones
+// keep the one they were established with.
+func (c *CertificateReloader) Watch() {
+	if Cfg.TLSReloadRateMS <= 0 {
+		logger.Info("Disabled reloading the certificates, TLS_RELOAD_RATE_MS is 0.")
+		return
+	}
+	for {
+		time.Sleep(time.Duration(Cfg.TLSReloadRateMS) * time.Millisecond)
+		if reloaded, err := c.Reload(); err != nil {
+			logger.Error("Error reloading the certificates, still using the previous ones. ", err)
+		} else if reloaded {
+			logger.Info("Reloaded the serving certificate and collector CAs.")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a self-signed certificate and its key to the files.
+func writeTestCert(t *testing.T, name, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func servingName(t *testing.T, c *CertificateReloader) string {
+	cert, err := c.GetCertificate(nil)
+	assert.NoError(t, err)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	oldCA, newCA := filepath.Join(dir, "old-ca.crt"), filepath.Join(dir, "new-ca.crt")
+	writeTestCert(t, "server-1", certFile, keyFile)
+	writeTestCert(t, "old-ca", oldCA, filepath.Join(dir, "old-ca.key"))
+	writeTestCert(t, "new-ca", newCA, filepath.Join(dir, "new-ca.key"))
+
+	certs, err := NewCertificateReloader(certFile, keyFile, []string{oldCA, newCA})
+	assert.NoError(t, err)
+	assert.Equal(t, "server-1", servingName(t, certs))
+
+	// Both CAs are trusted.
+	cfg := certs.TLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+	clientCfg, err := cfg.GetConfigForClient(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(clientCfg.ClientCAs.Subjects()))
+	assert.Equal(t, uint16(tls.VersionTLS12), clientCfg.MinVersion)
+	mutualCfg, err := certs.MutualTLSConfig(&tls.Config{}).GetConfigForClient(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, mutualCfg.ClientAuth)
+	assert.Equal(t, 2, len(mutualCfg.ClientCAs.Subjects()))
+
+	reloaded, err := certs.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded, "Nothing changed")
+
+	// The rotated certificate is served.
+	writeTestCert(t, "server-2", certFile, keyFile)
+	reloaded, err = certs.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "server-2", servingName(t, certs))
+
+	// An invalid file keeps the previous certificates.
+	assert.NoError(t, ioutil.WriteFile(newCA, []byte("not a certificate"), 0600))
+	_, err = certs.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "server-2", servingName(t, certs))
+	clientCfg, _ = cfg.GetConfigForClient(nil)
+	assert.Equal(t, 2, len(clientCfg.ClientCAs.Subjects()))
+
+	_, err = NewCertificateReloader(filepath.Join(dir, "missing.crt"), keyFile, nil)
+	assert.Error(t, err)
+}
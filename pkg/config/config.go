@@ -16,56 +16,408 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"github.com/golang/glog"
 )
 
 const (
-	AGGREGATOR_API_VERSION          = "2.2.0"
-	DEFAULT_AGGREGATOR_ADDRESS      = ":3010"
-	DEFAULT_EDGE_BUILD_RATE_MS      = 15000  // 15 sec
-	DEFAULT_HTTP_TIMEOUT            = 300000 // 5 min, to fix the EOF response at the collector
-	DEFAULT_REDISCOVER_RATE_MS      = 300000 // 5 min
-	DEFAULT_REDIS_HOST              = "localhost"
-	DEFAULT_REDIS_PORT              = "6379"
-	DEFAULT_REDIS_WATCH_INTERVAL    = 15000 // 15 seconds
-	DEFAULT_REQUEST_LIMIT           = 10    // Max number of concurrent requests.
-	DEFAULT_SKIP_CLUSTER_VALIDATION = "false"
+	AGGREGATOR_API_VERSION               = "2.2.0"
+	DEFAULT_AGGREGATOR_ADDRESS           = ":3010"
+	DEFAULT_AGGREGATOR_STATUS_RATE_MS    = 60000               // 1 min
+	DEFAULT_BIDIRECTIONAL_EDGE_TYPES     = "attachedTo"        // Edge types followed both ways.
+	DEFAULT_BLOB_MIN_BYTES               = 4096                // Smaller values of the BLOB_PROPERTIES stay in the graph.
+	DEFAULT_CHUNK_PARALLELISM            = 1                   // Chunks written at the same time, 1 writes them in order.
+	DEFAULT_CHUNK_SHARD_KEY              = "namespace"         // namespace or uid
+	DEFAULT_CHUNK_SIZE                   = 40                  // Resources or edges in each query of the chunked operations.
+	DEFAULT_CLOCK_SKEW_THRESHOLD_MS      = 60000               // 1 min
+	DEFAULT_CLUSTER_OFFLINE_AFTER_MS     = 1800000             // 30 min
+	DEFAULT_CLUSTER_STALE_AFTER_MS       = 600000              // 10 min
+	DEFAULT_CLUSTERLESS_NODES_RATE_MS    = 3600000             // 1 hour
+	DEFAULT_CLUSTERSET_RECONCILE_RATE_MS = 60000               // 1 min
+	DEFAULT_COLLECTOR_ADDON_NAME         = "search-collector"  // ManagedClusterAddOn of the collectors
+	DEFAULT_COLLECTOR_PING_RATE_MS       = 0                   // Disabled
+	DEFAULT_COLLECTOR_PING_TIMEOUT_MS    = 5000                // 5 sec
+	DEFAULT_COLLISION_RETENTION_HOURS    = 168                 // 7 days
+	DEFAULT_COMPACTION_MIN_DELETES       = 10000               // Nodes deleted since the last compaction.
+	DEFAULT_CONFIG_RESOURCE_NAME         = "search-aggregator" // SearchAggregator resource with the settings to reconcile
+	DEFAULT_DATASTORE                    = "redisgraph"        // redisgraph or memory
+	DEFAULT_DELTA_RESERVED_CONNECTIONS   = 5                   // Connections bulk queries can't use.
+	DEFAULT_DUAL_WRITE_ENABLED           = "false"
+	DEFAULT_DUAL_WRITE_PRIMARY           = "redisgraph" // redisgraph or secondary
+	DEFAULT_DUPLICATE_SYNC_LIMIT         = 3            // Identical syncs in a row processed before the next ones are skipped.
+	DEFAULT_EDGE_BUILD_IDLE_RATE_MS      = 3000         // 3 sec
+	DEFAULT_EDGE_BUILD_MAX_DEFER_MS      = 300000       // 5 min
+	DEFAULT_EDGE_BUILD_MAX_LATENCY_MS    = 500
+	DEFAULT_EDGE_BUILD_MAX_WRITE_QPS     = 100
+	DEFAULT_EDGE_BUILD_RATE_MS           = 15000 // 15 sec
+	DEFAULT_EVENT_SINK_BATCH_SIZE        = 500   // Events published to the event sink at once.
+	DEFAULT_EVENT_SINK_FLUSH_MS          = 1000  // 1 sec
+	DEFAULT_EVENT_SINK_QUEUE_SIZE        = 50000 // Events waiting to be published, the next ones are dropped.
+	DEFAULT_EVENT_SINK_TLS               = "false"
+	DEFAULT_FAULT_INJECTION_ENABLED      = "false"
+	DEFAULT_GRAPH_LIMIT_RATE_MS          = 60000 // 1 min
+	DEFAULT_GRAPH_LIMIT_REJECT_CLUSTERS  = "true"
+	DEFAULT_GRAPH_LIMIT_WARN_PERCENT     = 80
+	DEFAULT_GRAPH_MAX_EDGES              = 0      // Disabled
+	DEFAULT_GRAPH_MAX_NODES              = 0      // Disabled
+	DEFAULT_HTTP_TIMEOUT                 = 300000 // 5 min, to fix the EOF response at the collector
+	DEFAULT_INDEX_ADVISOR_AUTO_CREATE    = "false"
+	DEFAULT_INDEX_ADVISOR_MIN_SEARCHES   = 100    // Searches filtering on a property before an index is recommended.
+	DEFAULT_INDEX_ADVISOR_RATE_MS        = 600000 // 10 min
+	DEFAULT_KIND_LABELS                  = "true"
+	DEFAULT_LAZY_DELETE_RATE             = 1000 // Resources per second.
+	DEFAULT_LAZY_DELETE_THRESHOLD        = 10000
+	DEFAULT_LISTEN_NETWORK               = "tcp"   // tcp (dual-stack), tcp4 or tcp6
+	DEFAULT_LOG_BACKEND                  = "glog"  // glog or zap
+	DEFAULT_METRICS_CLUSTER_LABEL_LIMIT  = 500     // Clusters with their own cluster label in the metrics.
+	DEFAULT_METRICS_CLUSTER_RANK_MS      = 3600000 // 1 hour
+	DEFAULT_NAMESPACE_USAGE_PROPERTIES   = "cpuRequest,cpuLimit,memoryRequest,memoryLimit"
+	DEFAULT_PLACEHOLDER_NODES            = "false"
+	DEFAULT_POOL_IDLE_TIMEOUT_MS         = 300000 // 5 min
+	DEFAULT_POOL_MAX_ACTIVE              = 20
+	DEFAULT_POOL_MAX_IDLE                = 10
+	DEFAULT_POOL_MAX_LIFETIME_MS         = 1800000 // 30 min
+	DEFAULT_POOL_PING_IDLE_MS            = 0       // PING every connection before reuse
+	DEFAULT_PROPERTY_CARDINALITY_LIMIT   = 10000   // Distinct values of a property of a kind before it's capped.
+	DEFAULT_QUERY_TIMEOUT_MS             = 120000  // 2 min
+	DEFAULT_RBAC_CACHE_TTL_MS            = 60000   // 1 min
+	DEFAULT_RBAC_FILTER                  = "false"
+	DEFAULT_READ_ONLY_CHECK_RATE_MS      = 15000  // 15 seconds
+	DEFAULT_READ_ONLY_MEMORY_PERCENT     = 0      // The memory of Redis doesn't enable the read-only mode.
+	DEFAULT_REDISCOVER_RATE_MS           = 300000 // 5 min
+	DEFAULT_REDIS_HOST                   = "localhost"
+	DEFAULT_REDIS_PORT                   = "6379"
+	DEFAULT_REDIS_WATCH_INTERVAL         = 15000   // 15 seconds
+	DEFAULT_RELABEL_BATCH_SIZE           = 100     // Nodes relabeled by each query.
+	DEFAULT_RELABEL_RATE_MS              = 3600000 // 1 hour
+	DEFAULT_REQUEST_LIMIT                = 10      // Max number of concurrent requests.
+	DEFAULT_REQUIRE_CLIENT_CERT          = "false"
+	DEFAULT_RESOURCE_RETRY_ATTEMPTS      = 5      // Retries of a failed resource before it's dropped.
+	DEFAULT_RESOURCE_RETRY_BACKOFF_MS    = 5000   // 5 seconds, doubled by each failed retry.
+	DEFAULT_RESOURCE_RETRY_QUEUE_SIZE    = 1000   // Failed resources queued for each cluster.
+	DEFAULT_RESYNC_CHECKPOINT_MAX_AGE_MS = 600000 // 10 min
+	DEFAULT_RESYNC_DIFF_PAGE_SIZE        = 5000   // Stored resources read by each query of a paged resync diff.
+	DEFAULT_RESYNC_PAGED_DIFF_NODES      = 100000 // Clusters with more nodes are compared page by page.
+	DEFAULT_RETENTION_REAP_RATE_MS       = 300000 // 5 min
+	DEFAULT_SEARCH_MAX_HOPS              = 3
+	DEFAULT_SEARCH_RESULT_LIMIT          = 1000
+	DEFAULT_SEARCH_TIMEOUT_MS            = 10000 // 10 sec
+	DEFAULT_SECONDARY_REDIS_SSL          = "false"
+	DEFAULT_SESSION_PING_INTERVAL_MS     = 30000 // 30 sec
+	DEFAULT_SKIP_CLUSTER_VALIDATION      = "false"
+	DEFAULT_SYNC_CAPTURE_COUNT           = 0        // Disabled
+	DEFAULT_SYNC_CAPTURE_MAX_BYTES       = 1048576  // 1 MiB compressed
+	DEFAULT_SYNC_HISTORY_RETENTION_HOURS = 168      // 7 days
+	DEFAULT_SYNC_LOCKS                   = "memory" // memory or redis
+	DEFAULT_SYNC_LOCK_TTL_MS             = 30000    // 30 sec
+	DEFAULT_SYNC_PAYLOAD_HINT            = 10000    // Resources and edges suggested for each sync.
+	DEFAULT_SYNC_SCHEMA_VALIDATION       = "off"    // off, warn or enforce
+	DEFAULT_TLS_RELOAD_RATE_MS           = 60000    // 1 min
+	DEFAULT_TOMBSTONE_RETENTION_HOURS    = 168      // 7 days
+	DEFAULT_TOPOLOGY_RETENTION_HOURS     = 48       // 2 days
+	DEFAULT_TOPOLOGY_SNAPSHOT_RATE_MS    = 3600000  // 1 hour
+	DEFAULT_UID_COLLISION_POLICY         = "suffix" // keep-newest, reject or suffix
+	DEFAULT_WARM_UP_TIMEOUT_MS           = 120000   // 2 min
+	DEFAULT_WRITE_BATCH_MAX_RESOURCES    = 50
+	DEFAULT_WRITE_BATCH_WINDOW_MS        = 0     // Disabled
+	DEFAULT_WRITE_BUDGET_BYTES           = 0     // Disabled
+	DEFAULT_WRITE_BUDGET_INTERVAL_MS     = 1000  // 1 sec
+	DEFAULT_WRITE_BUDGET_MAX_DELAY_MS    = 30000 // 30 sec
 )
 
 // Define a config type to hold our config properties.
 type Config struct {
-	AggregatorAddress     string // address for collector <-> aggregator
-	EdgeBuildRateMS       int    // rate at which intercluster edges should be build
-	HTTPTimeout           int    // timeout when the http server should drop connections
-	KubeConfig            string // Local kubeconfig path
-	RedisHost             string // host path for redis
-	RedisPassword         string // password for redis
-	RedisPort             string // port for redis
-	RedisSSHPort          string // ssh port for redis
-	RedisWatchRate        int    // rate at which Redis Ping hapens to check health
-	RediscoverRateMS      int    // time in MS we should check on cluster resource type
-	RequestLimit          int    // Max number of concurrent requests. Used to prevent from overloading Redis.
-	SkipClusterValidation string // Skips cluster validation. Intended only for performance tests.
+	AdminAddress              string // address(es) for admin and metrics traffic. Uses AggregatorAddress when empty.
+	AdminToken                string // bearer token for the admin options of the sync and search APIs, e.g. debugQueries
+	AggregatorAddress         string // address(es) for collector <-> aggregator, comma separated
+	AggregatorStatusRateMS    int    // rate at which the Aggregator node with the health of the search index is updated, 0 to disable
+	BidirectionalEdgeTypes    string // comma separated edge types that are logically bidirectional, queried both ways
+	BlobMinBytes              int    // size of the JSON value of a blob property before it's offloaded
+	BlobProperties            string // comma separated properties, or kind.property, offloaded to the blob store
+	BlobS3Endpoint            string // endpoint of an S3 compatible blob store
+	BlobStore                 string // directory, s3://bucket/prefix or configmap://namespace for the blob properties
+	ChunkParallelism          int    // chunks of resources written at the same time, in shards of disjoint keys
+	ChunkShardKey             string // namespace or uid, resources with the same key are written in order
+	ChunkSize                 int    // number of resources or edges in each query of the chunked operations
+	ClockSkewThresholdMS      int    // skew of a collector clock before its timestamps are corrected, 0 to never correct them
+	ClusterOfflineAfterMS     int    // time without a successful sync before a cluster is Offline
+	ClusterProperties         string // JSON object of the properties set on the nodes of each cluster, by cluster name
+	ClusterStaleAfterMS       int    // time without a successful sync before a cluster is Stale
+	ClusterlessNodesRateMS    int    // how often the nodes without the cluster property are repaired or deleted, 0 to disable
+	ClusterSetReconcileRateMS int    // rate at which nodes are retagged with the ManagedClusterSet of their cluster
+	CollectorAddonName        string // name of the ManagedClusterAddOn of the collectors, its status tells if they're up. Empty to disable
+	CollectorCAFiles          string // comma separated PEM bundles verifying the collector client certificates, empty to disable
+	CollectorPingRateMS       int    // how often the health URLs sent by the collectors are pinged, 0 to disable
+	CollectorPingTimeoutMS    int    // timeout of a ping to a collector health URL
+	CollisionRetentionHours   int    // how long the detected UID collisions are kept for the admin report
+	CompactionMinDeletes      int    // nodes deleted since the last compaction before the graph is compacted
+	CompactionWindow          string // UTC maintenance window for the compaction job, e.g. 02:00-04:00. Empty to disable
+	ConfigResourceName        string // name of the SearchAggregator resource with the settings to reconcile, empty to disable
+	Datastore                 string // redisgraph, or memory to keep the graph in the aggregator process (tests and local dev)
+	DeltaReservedConnections  int    // connections of the pool kept for delta syncs, resyncs and background jobs can't use them
+	DualWriteEnabled          string // Send all writes to both the RedisGraph and the secondary datastore.
+	DualWritePrimary          string // Datastore used for reads when dual write is enabled. (redisgraph or secondary)
+	DuplicateSyncLimit        int    // identical syncs in a row processed for a cluster before the next ones are skipped, 0 to disable
+	EdgeBuildIdleRateMS       int    // rate of the intercluster edge builder while the graph is idle
+	EdgeBuildMaxDeferMS       int    // longest the intercluster edge builder is deferred by the write load before it runs anyway
+	EdgeBuildMaxLatencyMS     int    // mean query latency over which the intercluster edge builder is deferred, 0 to disable
+	EdgeBuildMaxWriteQPS      int    // write queries per second over which the intercluster edge builder is deferred, 0 to disable
+	EdgeBuildRateMS           int    // rate at which intercluster edges should be build
+	EdgeWeights               string // JSON object of the weights from 0 to 1 of the intercluster edges by rule
+	EventSink                 string // kafka://brokers/topic or nats://host:port/subject the applied changes are published to
+	EventSinkBatchSize        int    // events published to the event sink at once
+	EventSinkCAFile           string // PEM bundle verifying the certificate of the event sink brokers
+	EventSinkCertFile         string // PEM client certificate presented to the event sink brokers
+	EventSinkCredsFile        string // NATS credentials file (JWT and NKey seed) for the event sink
+	EventSinkFilter           string // property filters of the events published, in the search syntax, e.g. kind:pod
+	EventSinkFlushMS          int    // longest an event waits for its batch to fill before it's published
+	EventSinkKeyFile          string // PEM key of EventSinkCertFile
+	EventSinkPassword         string // password of EventSinkUser
+	EventSinkQueueSize        int    // events waiting to be published to the event sink before the next ones are dropped
+	EventSinkTLS              string // "true" to connect to the event sink brokers with TLS
+	EventSinkUser             string // user for the event sink, SASL/PLAIN with Kafka
+	ExcludedKinds             string // comma separated kinds of resources that aren't added to the graph
+	FaultInjectionEnabled     string // "true" to allow faults to be injected into the datastore queries, for staging only
+	GraphLimitRateMS          int    // how often the nodes and edges of the graph are counted against their caps
+	GraphLimitRejectClusters  string // "true" to reject the syncs of new clusters once the graph is near its caps
+	GraphLimitWarnPercent     int    // percent of GraphMaxNodes or GraphMaxEdges from which the graph is near its caps
+	GraphMaxEdges             int    // max edges of the graph for the graph limits, 0 for no cap
+	GraphMaxNodes             int    // max nodes of the graph for the graph limits, 0 for no cap
+	HashedProperties          string // comma separated properties, or kind.property, stored as a keyed hash
+	HTTPTimeout               int    // timeout when the http server should drop connections
+	IndexAdvisorAutoCreate    string // "true" to create the indexes recommended by the index advisor
+	IndexAdvisorMinSearches   int    // searches filtering on a property of a kind before the index advisor recommends an index
+	IndexAdvisorRateMS        int    // how often the index advisor checks its recommendations
+	InternalAddress           string // plaintext address(es) for the components in the cluster, no collector certificate required
+	KindLabels                string // "true" to match the kind label of the nodes in generated queries
+	KindMappings              string // JSON list of old to new kind and API group applied to the nodes by the relabel job
+	KubeConfig                string // Local kubeconfig path
+	LazyDeleteRate            int    // resources deleted per second by the lazy deleter, 0 for no limit
+	LazyDeleteThreshold       int    // resources deleted by a resync before they're queued for the lazy deleter, 0 to disable
+	ListenNetwork             string // network for the listeners: tcp (dual-stack), tcp4 or tcp6
+	LogBackend                string // writes the logs with glog, or zap for JSON logs
+	MetricsClusterLabelLimit  int    // clusters with their own cluster label in the metrics, the others are "other", 0 for no limit
+	MetricsClusterRankMS      int    // how often the clusters with the most metric samples get the cluster labels
+	NamespaceUsageProperties  string // comma separated pod properties summed for each namespace in the NamespaceUsage nodes
+	PlaceholderNodes          string // "true" to create placeholder nodes for the edge destinations that aren't synced yet
+	PoolIdleTimeoutMS         int    // time in MS before an idle connection is closed
+	PoolMaxActive             int    // max connections to RedisGraph, in use and idle
+	PoolMaxIdle               int    // max idle connections kept in the pool
+	PoolMaxLifetimeMS         int    // time in MS before a connection is closed and replaced, 0 to keep it open
+	PoolPingIdleMS            int    // connections idle longer than this are checked with PING before reuse, 0 checks all
+	PropertyCardinalityLimit  int    // distinct values of a property of a kind before it's no longer stored, 0 to disable
+	PayloadMappings           string // JSON list of legacy fields of older collectors mapped to the current sync payload
+	PropertyHashKey           string // key for the hash of HashedProperties
+	PropertyTransforms        string // JSON list of transforms applied to the properties of incoming resources
+	QueryTimeoutMS            int    // timeout for a single query to RedisGraph
+	RBACCacheTTLMS            int    // how long the resources each user can see are cached
+	RBACFilter                string // "true" to filter the search API by the hub RBAC of the requesting user
+	ReadOnlyCheckRateMS       int    // how often the memory of Redis is checked against ReadOnlyMemoryPercent
+	ReadOnlyMemoryPercent     int    // percent of the maxmemory of Redis from which the aggregator is read-only, 0 to disable
+	RedactedProperties        string // comma separated properties, or kind.property, stored as REDACTED
+	RedisGraphVersion         string // RedisGraph version, e.g. 2.4.12, when it can't be detected with MODULE LIST
+	RedisHost                 string // host path for redis
+	RedisPassword             string // password for redis
+	RedisPort                 string // port for redis
+	RedisSSHPort              string // ssh port for redis
+	RedisWatchRate            int    // rate at which Redis Ping hapens to check health
+	RediscoverRateMS          int    // time in MS we should check on cluster resource type
+	RelabelBatchSize          int    // nodes relabeled by each query of the relabel job
+	RelabelRateMS             int    // how often the relabel job applies the KIND_MAPPINGS to the graph
+	RequestLimit              int    // Max number of concurrent requests. Used to prevent from overloading Redis.
+	RequireClientCert         string // "true" to reject the connections to AggregatorAddress without a verified client certificate
+	ResourceRetryAttempts     int    // retries of a resource that failed to be written before it's dropped, 0 to disable
+	ResourceRetryBackoffMS    int    // wait before the first retry of a failed resource, doubled by each failed retry
+	ResourceRetryQueueSize    int    // failed resources queued for retries for each cluster, 0 for no limit
+	ResyncCheckpointMaxAgeMS  int    // longest an interrupted resync can be resumed from its checkpoint, 0 to disable
+	ResyncDiffPageSize        int    // stored resources read by each query of a paged resync diff
+	ResyncPagedDiffNodes      int    // nodes of a cluster above which its resyncs are compared page by page, 0 to disable
+	ResyncTimeBudgetMS        int    // longest a resync runs before it's interrupted at a checkpoint, 0 for no limit
+	RetentionPolicies         string // JSON list of retention policies for ephemeral kinds, enforced at ingest and by the reaper
+	RetentionReapRateMS       int    // rate at which the retention policies are enforced on the graph
+	SearchMaxHops             int    // max length of the variable length paths in search API queries
+	SearchResultLimit         int    // max number of results returned by the search API
+	SearchTimeoutMS           int    // timeout for a single query from the search API
+	SecondaryRedisHost        string // host for the secondary datastore used during migrations
+	SecondaryRedisPassword    string // password for the secondary datastore
+	SecondaryRedisPort        string // port for the secondary datastore
+	SecondaryRedisSSL         string // "true" to connect to the secondary datastore with SSL
+	SessionPingIntervalMS     int    // how often collector sessions are pinged, closed when no pong comes in twice the time
+	SkipClusterValidation     string // Skips cluster validation. Intended only for performance tests.
+	SyncCaptureCount          int    // raw sync payloads captured for each cluster to replay them, 0 disables the capture
+	SyncCaptureMaxBytes       int    // max compressed size of a captured payload, larger ones aren't captured
+	SyncHistoryRetentionHours int    // how long the sync stats of each cluster are kept
+	SyncLocks                 string // memory, or redis to lock the syncs of each cluster across the replicas
+	SyncLockTTLMS             int    // expiry of a sync lock in redis, renewed while the sync runs
+	SyncPayloadHint           int    // max resources and edges suggested to collectors for each sync, halved when busy
+	SyncSchemaValidation      string // off, warn to report the sync payloads not matching the sync schema, or enforce to reject them
+	TLSReloadRateMS           int    // how often the serving certificate and collector CAs are checked for changes
+	TombstoneRetentionHours   int    // how long the records of deleted resources are kept
+	TopologyRetentionHours    int    // how long the topology snapshots are kept
+	TopologySnapshotRateMS    int    // how often the resources of each cluster, kind and namespace are counted
+	UIDCollisionPolicy        string // what happens to a resource with the UID of a resource in another cluster
+	UncappedProperties        string // comma separated properties, or kind.property, never capped by PropertyCardinalityLimit
+	WarmUpTimeoutMS           int    // max time the readiness probe waits for the warm up, 0 to be ready without it
+	WriteBatchMaxResources    int    // max resources of a delta write batched with the writes of other clusters
+	WriteBatchWindowMS        int    // how long small delta writes wait to be batched with other clusters, 0 to disable
+	WriteBudgetBytes          int    // estimated bytes written to the graph per interval before bulk writes wait, 0 to disable
+	WriteBudgetIntervalMS     int    // interval of the write budget
+	WriteBudgetMaxDelayMS     int    // longest a bulk write waits for the write budget
 }
 
 var Cfg = Config{}
 
+// Returns the function restoring the config as it is now, so the tests changing it can restore it with
+// t.Cleanup(config.Snapshot()).
+func Snapshot() (restore func()) {
+	specMutex.RLock()
+	saved := Cfg
+	specMutex.RUnlock()
+	return func() {
+		specMutex.Lock()
+		Cfg = saved
+		specMutex.Unlock()
+	}
+}
+
 func init() {
 	// If environment variables are set, use those values constants
 	// Simply put, the order of preference is env -> default constants (from left to right)
 	setDefault(&Cfg.AggregatorAddress, "AGGREGATOR_ADDRESS", DEFAULT_AGGREGATOR_ADDRESS)
+	setDefault(&Cfg.AdminAddress, "ADMIN_ADDRESS", "")
+	setDefault(&Cfg.InternalAddress, "INTERNAL_ADDRESS", "")
+	setDefault(&Cfg.AdminToken, "ADMIN_TOKEN", "")
+	setDefault(&Cfg.ListenNetwork, "LISTEN_NETWORK", DEFAULT_LISTEN_NETWORK)
+	setDefault(&Cfg.LogBackend, "LOG_BACKEND", DEFAULT_LOG_BACKEND)
 	setDefault(&Cfg.RedisHost, "REDIS_HOST", DEFAULT_REDIS_HOST)
 	setDefault(&Cfg.RedisPort, "REDIS_PORT", DEFAULT_REDIS_PORT)
 	setDefault(&Cfg.RedisSSHPort, "REDIS_SSH_PORT", "")
 	setDefault(&Cfg.RedisPassword, "REDIS_PASSWORD", "")
+	setDefault(&Cfg.RedisGraphVersion, "REDISGRAPH_VERSION", "")
+	setDefault(&Cfg.Datastore, "DATASTORE", DEFAULT_DATASTORE)
 	setDefault(&Cfg.SkipClusterValidation, "SKIP_CLUSTER_VALIDATION", DEFAULT_SKIP_CLUSTER_VALIDATION)
+	setDefault(&Cfg.DualWriteEnabled, "DUAL_WRITE_ENABLED", DEFAULT_DUAL_WRITE_ENABLED)
+	setDefault(&Cfg.DualWritePrimary, "DUAL_WRITE_PRIMARY", DEFAULT_DUAL_WRITE_PRIMARY)
+	setDefault(&Cfg.SecondaryRedisHost, "SECONDARY_REDIS_HOST", "")
+	setDefault(&Cfg.SecondaryRedisPort, "SECONDARY_REDIS_PORT", DEFAULT_REDIS_PORT)
+	setDefault(&Cfg.SecondaryRedisPassword, "SECONDARY_REDIS_PASSWORD", "")
+	setDefault(&Cfg.SecondaryRedisSSL, "SECONDARY_REDIS_SSL", DEFAULT_SECONDARY_REDIS_SSL)
+	setDefault(&Cfg.ConfigResourceName, "CONFIG_RESOURCE_NAME", DEFAULT_CONFIG_RESOURCE_NAME)
+	setDefault(&Cfg.ExcludedKinds, "EXCLUDED_KINDS", "")
+	setDefault(&Cfg.EventSink, "EVENT_SINK", "")
+	setDefault(&Cfg.EventSinkFilter, "EVENT_SINK_FILTER", "")
+	setDefault(&Cfg.EventSinkTLS, "EVENT_SINK_TLS", DEFAULT_EVENT_SINK_TLS)
+	setDefault(&Cfg.EventSinkCAFile, "EVENT_SINK_CA_FILE", "")
+	setDefault(&Cfg.EventSinkCertFile, "EVENT_SINK_CERT_FILE", "")
+	setDefault(&Cfg.EventSinkKeyFile, "EVENT_SINK_KEY_FILE", "")
+	setDefault(&Cfg.EventSinkUser, "EVENT_SINK_USER", "")
+	setDefault(&Cfg.EventSinkPassword, "EVENT_SINK_PASSWORD", "")
+	setDefault(&Cfg.EventSinkCredsFile, "EVENT_SINK_CREDS_FILE", "")
+	setDefault(&Cfg.ChunkShardKey, "CHUNK_SHARD_KEY", DEFAULT_CHUNK_SHARD_KEY)
+	setDefault(&Cfg.BidirectionalEdgeTypes, "BIDIRECTIONAL_EDGE_TYPES", DEFAULT_BIDIRECTIONAL_EDGE_TYPES)
+	setDefault(&Cfg.BlobProperties, "BLOB_PROPERTIES", "")
+	setDefault(&Cfg.BlobS3Endpoint, "BLOB_S3_ENDPOINT", "")
+	setDefault(&Cfg.BlobStore, "BLOB_STORE", "")
+	setDefault(&Cfg.KindLabels, "KIND_LABELS", DEFAULT_KIND_LABELS)
+	setDefault(&Cfg.KindMappings, "KIND_MAPPINGS", "")
+	setDefault(&Cfg.ClusterProperties, "CLUSTER_PROPERTIES", "")
+	setDefault(&Cfg.EdgeWeights, "EDGE_WEIGHTS", "")
+	setDefault(&Cfg.IndexAdvisorAutoCreate, "INDEX_ADVISOR_AUTO_CREATE", DEFAULT_INDEX_ADVISOR_AUTO_CREATE)
+	setDefault(&Cfg.FaultInjectionEnabled, "FAULT_INJECTION_ENABLED", DEFAULT_FAULT_INJECTION_ENABLED)
+	setDefault(&Cfg.GraphLimitRejectClusters, "GRAPH_LIMIT_REJECT_CLUSTERS", DEFAULT_GRAPH_LIMIT_REJECT_CLUSTERS)
+	setDefault(&Cfg.NamespaceUsageProperties, "NAMESPACE_USAGE_PROPERTIES", DEFAULT_NAMESPACE_USAGE_PROPERTIES)
+	setDefault(&Cfg.PlaceholderNodes, "PLACEHOLDER_NODES", DEFAULT_PLACEHOLDER_NODES)
+	setDefault(&Cfg.HashedProperties, "HASHED_PROPERTIES", "")
+	setDefault(&Cfg.RedactedProperties, "REDACTED_PROPERTIES", "")
+	setDefault(&Cfg.PropertyHashKey, "PROPERTY_HASH_KEY", "")
+	setDefault(&Cfg.PayloadMappings, "PAYLOAD_MAPPINGS", "")
+	setDefault(&Cfg.PropertyTransforms, "PROPERTY_TRANSFORMS", "")
+	setDefault(&Cfg.CompactionWindow, "COMPACTION_WINDOW", "")
+	setDefault(&Cfg.CollectorCAFiles, "COLLECTOR_CA_FILES", "")
+	setDefault(&Cfg.RequireClientCert, "REQUIRE_CLIENT_CERT", DEFAULT_REQUIRE_CLIENT_CERT)
+	setDefault(&Cfg.SyncLocks, "SYNC_LOCKS", DEFAULT_SYNC_LOCKS)
+	setDefault(&Cfg.SyncSchemaValidation, "SYNC_SCHEMA_VALIDATION", DEFAULT_SYNC_SCHEMA_VALIDATION)
+	setDefault(&Cfg.CollectorAddonName, "COLLECTOR_ADDON_NAME", DEFAULT_COLLECTOR_ADDON_NAME)
+	setDefault(&Cfg.RBACFilter, "RBAC_FILTER", DEFAULT_RBAC_FILTER)
+	setDefault(&Cfg.RetentionPolicies, "RETENTION_POLICIES", "")
+	setDefault(&Cfg.UIDCollisionPolicy, "UID_COLLISION_POLICY", DEFAULT_UID_COLLISION_POLICY)
+	setDefault(&Cfg.UncappedProperties, "UNCAPPED_PROPERTIES", "")
 
+	setDefaultInt(&Cfg.AggregatorStatusRateMS, "AGGREGATOR_STATUS_RATE_MS", DEFAULT_AGGREGATOR_STATUS_RATE_MS)
+	setDefaultInt(&Cfg.BlobMinBytes, "BLOB_MIN_BYTES", DEFAULT_BLOB_MIN_BYTES)
+	setDefaultInt(&Cfg.ChunkParallelism, "CHUNK_PARALLELISM", DEFAULT_CHUNK_PARALLELISM)
+	setDefaultInt(&Cfg.ChunkSize, "CHUNK_SIZE", DEFAULT_CHUNK_SIZE)
+	setDefaultInt(&Cfg.ClockSkewThresholdMS, "CLOCK_SKEW_THRESHOLD_MS", DEFAULT_CLOCK_SKEW_THRESHOLD_MS)
+	setDefaultInt(&Cfg.ClusterOfflineAfterMS, "CLUSTER_OFFLINE_AFTER_MS", DEFAULT_CLUSTER_OFFLINE_AFTER_MS)
+	setDefaultInt(&Cfg.ClusterStaleAfterMS, "CLUSTER_STALE_AFTER_MS", DEFAULT_CLUSTER_STALE_AFTER_MS)
+	setDefaultInt(&Cfg.ClusterlessNodesRateMS, "CLUSTERLESS_NODES_RATE_MS", DEFAULT_CLUSTERLESS_NODES_RATE_MS)
+	setDefaultInt(&Cfg.ClusterSetReconcileRateMS, "CLUSTERSET_RECONCILE_RATE_MS", DEFAULT_CLUSTERSET_RECONCILE_RATE_MS)
+	setDefaultInt(&Cfg.CollectorPingRateMS, "COLLECTOR_PING_RATE_MS", DEFAULT_COLLECTOR_PING_RATE_MS)
+	setDefaultInt(&Cfg.CollectorPingTimeoutMS, "COLLECTOR_PING_TIMEOUT_MS", DEFAULT_COLLECTOR_PING_TIMEOUT_MS)
+	setDefaultInt(&Cfg.CollisionRetentionHours, "COLLISION_RETENTION_HOURS", DEFAULT_COLLISION_RETENTION_HOURS)
+	setDefaultInt(&Cfg.CompactionMinDeletes, "COMPACTION_MIN_DELETES", DEFAULT_COMPACTION_MIN_DELETES)
+	setDefaultInt(&Cfg.DeltaReservedConnections, "DELTA_RESERVED_CONNECTIONS", DEFAULT_DELTA_RESERVED_CONNECTIONS)
+	setDefaultInt(&Cfg.DuplicateSyncLimit, "DUPLICATE_SYNC_LIMIT", DEFAULT_DUPLICATE_SYNC_LIMIT)
 	setDefaultInt(&Cfg.EdgeBuildRateMS, "EDGE_BUILD_RATE_MS", DEFAULT_EDGE_BUILD_RATE_MS)
+	setDefaultInt(&Cfg.EdgeBuildIdleRateMS, "EDGE_BUILD_IDLE_RATE_MS", DEFAULT_EDGE_BUILD_IDLE_RATE_MS)
+	setDefaultInt(&Cfg.EdgeBuildMaxDeferMS, "EDGE_BUILD_MAX_DEFER_MS", DEFAULT_EDGE_BUILD_MAX_DEFER_MS)
+	setDefaultInt(&Cfg.EdgeBuildMaxLatencyMS, "EDGE_BUILD_MAX_LATENCY_MS", DEFAULT_EDGE_BUILD_MAX_LATENCY_MS)
+	setDefaultInt(&Cfg.EdgeBuildMaxWriteQPS, "EDGE_BUILD_MAX_WRITE_QPS", DEFAULT_EDGE_BUILD_MAX_WRITE_QPS)
+	setDefaultInt(&Cfg.EventSinkBatchSize, "EVENT_SINK_BATCH_SIZE", DEFAULT_EVENT_SINK_BATCH_SIZE)
+	setDefaultInt(&Cfg.EventSinkFlushMS, "EVENT_SINK_FLUSH_MS", DEFAULT_EVENT_SINK_FLUSH_MS)
+	setDefaultInt(&Cfg.EventSinkQueueSize, "EVENT_SINK_QUEUE_SIZE", DEFAULT_EVENT_SINK_QUEUE_SIZE)
+	setDefaultInt(&Cfg.GraphLimitRateMS, "GRAPH_LIMIT_RATE_MS", DEFAULT_GRAPH_LIMIT_RATE_MS)
+	setDefaultInt(&Cfg.GraphLimitWarnPercent, "GRAPH_LIMIT_WARN_PERCENT", DEFAULT_GRAPH_LIMIT_WARN_PERCENT)
+	setDefaultInt(&Cfg.GraphMaxEdges, "GRAPH_MAX_EDGES", DEFAULT_GRAPH_MAX_EDGES)
+	setDefaultInt(&Cfg.GraphMaxNodes, "GRAPH_MAX_NODES", DEFAULT_GRAPH_MAX_NODES)
 	setDefaultInt(&Cfg.HTTPTimeout, "HTTP_TIMEOUT", DEFAULT_HTTP_TIMEOUT)
+	setDefaultInt(&Cfg.IndexAdvisorMinSearches, "INDEX_ADVISOR_MIN_SEARCHES", DEFAULT_INDEX_ADVISOR_MIN_SEARCHES)
+	setDefaultInt(&Cfg.IndexAdvisorRateMS, "INDEX_ADVISOR_RATE_MS", DEFAULT_INDEX_ADVISOR_RATE_MS)
+	setDefaultInt(&Cfg.LazyDeleteRate, "LAZY_DELETE_RATE", DEFAULT_LAZY_DELETE_RATE)
+	setDefaultInt(&Cfg.LazyDeleteThreshold, "LAZY_DELETE_THRESHOLD", DEFAULT_LAZY_DELETE_THRESHOLD)
+	setDefaultInt(&Cfg.MetricsClusterLabelLimit, "METRICS_CLUSTER_LABEL_LIMIT", DEFAULT_METRICS_CLUSTER_LABEL_LIMIT)
+	setDefaultInt(&Cfg.MetricsClusterRankMS, "METRICS_CLUSTER_RANK_MS", DEFAULT_METRICS_CLUSTER_RANK_MS)
+	setDefaultInt(&Cfg.PoolIdleTimeoutMS, "POOL_IDLE_TIMEOUT_MS", DEFAULT_POOL_IDLE_TIMEOUT_MS)
+	setDefaultInt(&Cfg.PoolMaxActive, "POOL_MAX_ACTIVE", DEFAULT_POOL_MAX_ACTIVE)
+	setDefaultInt(&Cfg.PoolMaxIdle, "POOL_MAX_IDLE", DEFAULT_POOL_MAX_IDLE)
+	setDefaultInt(&Cfg.PoolMaxLifetimeMS, "POOL_MAX_LIFETIME_MS", DEFAULT_POOL_MAX_LIFETIME_MS)
+	setDefaultInt(&Cfg.PoolPingIdleMS, "POOL_PING_IDLE_MS", DEFAULT_POOL_PING_IDLE_MS)
+	setDefaultInt(&Cfg.PropertyCardinalityLimit, "PROPERTY_CARDINALITY_LIMIT", DEFAULT_PROPERTY_CARDINALITY_LIMIT)
+	setDefaultInt(&Cfg.QueryTimeoutMS, "QUERY_TIMEOUT_MS", DEFAULT_QUERY_TIMEOUT_MS)
+	setDefaultInt(&Cfg.RBACCacheTTLMS, "RBAC_CACHE_TTL_MS", DEFAULT_RBAC_CACHE_TTL_MS)
+	setDefaultInt(&Cfg.ReadOnlyCheckRateMS, "READ_ONLY_CHECK_RATE_MS", DEFAULT_READ_ONLY_CHECK_RATE_MS)
+	setDefaultInt(&Cfg.ReadOnlyMemoryPercent, "READ_ONLY_MEMORY_PERCENT", DEFAULT_READ_ONLY_MEMORY_PERCENT)
+	setDefaultInt(&Cfg.RetentionReapRateMS, "RETENTION_REAP_RATE_MS", DEFAULT_RETENTION_REAP_RATE_MS)
 	setDefaultInt(&Cfg.RequestLimit, "REQUEST_LIMIT", DEFAULT_REQUEST_LIMIT)
+	setDefaultInt(&Cfg.ResourceRetryAttempts, "RESOURCE_RETRY_ATTEMPTS", DEFAULT_RESOURCE_RETRY_ATTEMPTS)
+	setDefaultInt(&Cfg.ResourceRetryBackoffMS, "RESOURCE_RETRY_BACKOFF_MS", DEFAULT_RESOURCE_RETRY_BACKOFF_MS)
+	setDefaultInt(&Cfg.ResourceRetryQueueSize, "RESOURCE_RETRY_QUEUE_SIZE", DEFAULT_RESOURCE_RETRY_QUEUE_SIZE)
+	setDefaultInt(&Cfg.ResyncCheckpointMaxAgeMS, "RESYNC_CHECKPOINT_MAX_AGE_MS", DEFAULT_RESYNC_CHECKPOINT_MAX_AGE_MS)
+	setDefaultInt(&Cfg.ResyncDiffPageSize, "RESYNC_DIFF_PAGE_SIZE", DEFAULT_RESYNC_DIFF_PAGE_SIZE)
+	setDefaultInt(&Cfg.ResyncPagedDiffNodes, "RESYNC_PAGED_DIFF_NODES", DEFAULT_RESYNC_PAGED_DIFF_NODES)
+	setDefaultInt(&Cfg.ResyncTimeBudgetMS, "RESYNC_TIME_BUDGET_MS", 0)
 	setDefaultInt(&Cfg.RedisWatchRate, "REDIS_WATCH_RATE_MS", DEFAULT_REDIS_WATCH_INTERVAL)
 	setDefaultInt(&Cfg.RediscoverRateMS, "REDISCOVER_RATE_MS", DEFAULT_REDISCOVER_RATE_MS)
+	setDefaultInt(&Cfg.RelabelBatchSize, "RELABEL_BATCH_SIZE", DEFAULT_RELABEL_BATCH_SIZE)
+	setDefaultInt(&Cfg.RelabelRateMS, "RELABEL_RATE_MS", DEFAULT_RELABEL_RATE_MS)
+	setDefaultInt(&Cfg.SearchMaxHops, "SEARCH_MAX_HOPS", DEFAULT_SEARCH_MAX_HOPS)
+	setDefaultInt(&Cfg.SearchResultLimit, "SEARCH_RESULT_LIMIT", DEFAULT_SEARCH_RESULT_LIMIT)
+	setDefaultInt(&Cfg.SearchTimeoutMS, "SEARCH_TIMEOUT_MS", DEFAULT_SEARCH_TIMEOUT_MS)
+	setDefaultInt(&Cfg.SessionPingIntervalMS, "SESSION_PING_INTERVAL_MS", DEFAULT_SESSION_PING_INTERVAL_MS)
+	requirePositive(&Cfg.SessionPingIntervalMS, "SESSION_PING_INTERVAL_MS", DEFAULT_SESSION_PING_INTERVAL_MS)
+	setDefaultInt(&Cfg.SyncCaptureCount, "SYNC_CAPTURE_COUNT", DEFAULT_SYNC_CAPTURE_COUNT)
+	setDefaultInt(&Cfg.SyncCaptureMaxBytes, "SYNC_CAPTURE_MAX_BYTES", DEFAULT_SYNC_CAPTURE_MAX_BYTES)
+	setDefaultInt(&Cfg.SyncHistoryRetentionHours, "SYNC_HISTORY_RETENTION_HOURS", DEFAULT_SYNC_HISTORY_RETENTION_HOURS)
+	setDefaultInt(&Cfg.SyncLockTTLMS, "SYNC_LOCK_TTL_MS", DEFAULT_SYNC_LOCK_TTL_MS)
+	setDefaultInt(&Cfg.SyncPayloadHint, "SYNC_PAYLOAD_HINT", DEFAULT_SYNC_PAYLOAD_HINT)
+	setDefaultInt(&Cfg.TLSReloadRateMS, "TLS_RELOAD_RATE_MS", DEFAULT_TLS_RELOAD_RATE_MS)
+	setDefaultInt(&Cfg.TombstoneRetentionHours, "TOMBSTONE_RETENTION_HOURS", DEFAULT_TOMBSTONE_RETENTION_HOURS)
+	setDefaultInt(&Cfg.TopologyRetentionHours, "TOPOLOGY_RETENTION_HOURS", DEFAULT_TOPOLOGY_RETENTION_HOURS)
+	setDefaultInt(&Cfg.TopologySnapshotRateMS, "TOPOLOGY_SNAPSHOT_RATE_MS", DEFAULT_TOPOLOGY_SNAPSHOT_RATE_MS)
+	setDefaultInt(&Cfg.WarmUpTimeoutMS, "WARM_UP_TIMEOUT_MS", DEFAULT_WARM_UP_TIMEOUT_MS)
+	setDefaultInt(&Cfg.WriteBatchMaxResources, "WRITE_BATCH_MAX_RESOURCES", DEFAULT_WRITE_BATCH_MAX_RESOURCES)
+	setDefaultInt(&Cfg.WriteBatchWindowMS, "WRITE_BATCH_WINDOW_MS", DEFAULT_WRITE_BATCH_WINDOW_MS)
+	setDefaultInt(&Cfg.WriteBudgetBytes, "WRITE_BUDGET_BYTES", DEFAULT_WRITE_BUDGET_BYTES)
+	setDefaultInt(&Cfg.WriteBudgetIntervalMS, "WRITE_BUDGET_INTERVAL_MS", DEFAULT_WRITE_BUDGET_INTERVAL_MS)
+	setDefaultInt(&Cfg.WriteBudgetMaxDelayMS, "WRITE_BUDGET_MAX_DELAY_MS", DEFAULT_WRITE_BUDGET_MAX_DELAY_MS)
 
 	defaultKubePath := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	if _, err := os.Stat(defaultKubePath); os.IsNotExist(err) {
@@ -73,20 +425,39 @@ func init() {
 		defaultKubePath = ""
 	}
 	setDefault(&Cfg.KubeConfig, "KUBECONFIG", defaultKubePath)
+
+	envCfg = Cfg
+}
+
+// Splits a comma separated list of addresses, e.g. "0.0.0.0:3010,[::1]:3010"
+func ParseAddresses(value string) []string {
+	return ParseList(value)
+}
+
+// Splits a comma separated list, skipping the empty items.
+func ParseList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func setDefault(field *string, env, defaultVal string) {
 	if val := os.Getenv(env); val != "" {
-		if env == "REDIS_PASSWORD" {
-			glog.Infof("Using %s from environment", env)
+		if env == "REDIS_PASSWORD" || env == "SECONDARY_REDIS_PASSWORD" || env == "PROPERTY_HASH_KEY" ||
+			env == "ADMIN_TOKEN" || env == "EVENT_SINK_PASSWORD" {
+			logger.Infof("Using %s from environment", env)
 		} else {
-			glog.Infof("Using %s from environment: %s", env, val)
+			logger.Infof("Using %s from environment: %s", env, val)
 		}
 		*field = val
 	} else if *field == "" && defaultVal != "" {
 		// Skip logging when running tests to reduce confusing output.
 		if !strings.HasSuffix(os.Args[0], ".test") {
-			glog.Infof("%s not set, using default value: %s", env, defaultVal)
+			logger.Infof("%s not set, using default value: %s", env, defaultVal)
 		}
 		*field = defaultVal
 	}
@@ -94,17 +465,25 @@ func setDefault(field *string, env, defaultVal string) {
 
 func setDefaultInt(field *int, env string, defaultVal int) {
 	if val := os.Getenv(env); val != "" {
-		glog.Infof("Using %s from environment: %s", env, val)
+		logger.Infof("Using %s from environment: %s", env, val)
 		var err error
 		*field, err = strconv.Atoi(val)
 		if err != nil {
-			glog.Error("Error parsing env [", env, "].  Expected an integer.  Original error: ", err)
+			logger.Error("Error parsing env [", env, "].  Expected an integer.  Original error: ", err)
 		}
 	} else if *field == 0 && defaultVal != 0 {
 		// Skip logging when running tests to reduce confusing output.
 		if !strings.HasSuffix(os.Args[0], ".test") {
-			glog.Infof("No %s from file or environment, using default value: %d", env, defaultVal)
+			logger.Infof("No %s from file or environment, using default value: %d", env, defaultVal)
 		}
 		*field = defaultVal
 	}
 }
+
+// Resets the setting to its default when it isn't positive, e.g. the interval of a ticker.
+func requirePositive(field *int, env string, defaultVal int) {
+	if *field <= 0 {
+		logger.Errorf("%s must be positive, got %d. Using the default value: %d", env, *field, defaultVal)
+		*field = defaultVal
+	}
+}
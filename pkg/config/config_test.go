@@ -52,3 +52,32 @@ func Test_SetDefaultInt_02(t *testing.T) {
 		t.Errorf("Failed testing setDefault()  Expected: %d  Got: %d", 9999, property)
 	}
 }
+
+func Test_ParseAddresses(t *testing.T) {
+	addresses := ParseAddresses(" 0.0.0.0:3010, [::]:3010,,")
+
+	if len(addresses) != 2 || addresses[0] != "0.0.0.0:3010" || addresses[1] != "[::]:3010" {
+		t.Errorf("Failed testing ParseAddresses()  Expected: %v  Got: %v", []string{"0.0.0.0:3010", "[::]:3010"}, addresses)
+	}
+}
+
+func Test_Snapshot(t *testing.T) {
+	restore := Snapshot()
+	prevLimit := Cfg.SearchResultLimit
+	Cfg.SearchResultLimit, Cfg.ExcludedKinds = prevLimit+1, "Event"
+	restore()
+
+	if Cfg.SearchResultLimit != prevLimit || Cfg.ExcludedKinds == "Event" {
+		t.Errorf("Failed testing Snapshot()  Expected: %d  Got: %d", prevLimit, Cfg.SearchResultLimit)
+	}
+}
+
+func Test_requirePositive(t *testing.T) {
+	for value, expected := range map[int]int{0: 30000, -1: 30000, 1000: 1000} {
+		property := value
+		requirePositive(&property, "SESSION_PING_INTERVAL_MS", 30000)
+		if property != expected {
+			t.Errorf("Failed testing requirePositive()  Expected: %d  Got: %d", expected, property)
+		}
+	}
+}
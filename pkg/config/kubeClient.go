@@ -12,8 +12,6 @@ Copyright (c) 2020 Red Hat, Inc.
 package config
 
 import (
-	"github.com/golang/glog"
-
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	kubeClientset "k8s.io/client-go/kubernetes"
@@ -25,7 +23,7 @@ import (
 func GetKubeClient() *kubeClientset.Clientset {
 	kubeClient, err := kubeClientset.NewForConfig(getClientConfig())
 	if kubeClient == nil || err != nil {
-		glog.Error("Error getting the kube clientset. ", err)
+		logger.Error("Error getting the kube clientset. ", err)
 	}
 	return kubeClient
 }
@@ -34,7 +32,7 @@ func GetKubeClient() *kubeClientset.Clientset {
 func GetDiscoveryClient() *discovery.DiscoveryClient {
 	discoveryClient, err := discovery.NewDiscoveryClientForConfig(getClientConfig())
 	if err != nil {
-		glog.Warning("Error getting the discovery client. ", err)
+		logger.Warning("Error getting the discovery client. ", err)
 	}
 	return discoveryClient
 }
@@ -43,7 +41,7 @@ func GetDiscoveryClient() *discovery.DiscoveryClient {
 func GetDynamicClient() dynamic.Interface {
 	dynamicClientset, err := dynamic.NewForConfig(getClientConfig())
 	if err != nil {
-		glog.Warning("Error getting the dynamic client. ", err)
+		logger.Warning("Error getting the dynamic client. ", err)
 	}
 	return dynamicClientset
 }
@@ -52,13 +50,13 @@ func getClientConfig() *rest.Config {
 	var clientConfig *rest.Config
 	var err error
 	if Cfg.KubeConfig != "" {
-		glog.V(1).Infof("Creating k8s client using path: %s", Cfg.KubeConfig)
+		logger.V(1).Infof("Creating k8s client using path: %s", Cfg.KubeConfig)
 		clientConfig, err = clientcmd.BuildConfigFromFlags("", Cfg.KubeConfig)
 	} else {
 		clientConfig, err = rest.InClusterConfig()
 	}
 	if err != nil {
-		glog.Warning("Error getting the kube client config. ", err)
+		logger.Warning("Error getting the kube client config. ", err)
 		return &rest.Config{}
 	}
 	return clientConfig
@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"time"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// UID of the Aggregator node. The replicas share the graph, so they update the same node.
+const aggregatorStatusUID = "aggregator__search-aggregator"
+
+// Health of the search index as seen by the aggregator, stored as an Aggregator node so the console can show it
+// with the search API, e.g. kind:aggregator.
+type AggregatorStatus struct {
+	Instance                  string // Hostname of the aggregator that updated the node last.
+	Version                   string
+	Commit                    string // Git commit of the build, empty when unknown.
+	Started                   time.Time
+	LastInterClusterEdgeBuild time.Time // Zero when the intercluster edges weren't built since the aggregator started.
+	Clusters                  int
+	TotalResources            int // Sum of the totalResources of the ClusterSummary nodes.
+	TotalEdges                int
+}
+
+// Counts the clusters, resources and edges of the graph into the status.
+func CountAggregatorStatus(ctx context.Context, status *AggregatorStatus) error {
+	var err error
+	status.Clusters, err = queryCount(ctx, "MATCH (c:Cluster) RETURN count(c)")
+	if err != nil {
+		return err
+	}
+	// The summaries are already counted, counting the resources here would scan every node.
+	status.TotalResources, err = queryCount(ctx, "MATCH (s:ClusterSummary) RETURN toInteger(sum(s.totalResources))")
+	if err != nil {
+		return err
+	}
+	status.TotalEdges, err = queryCount(ctx, "MATCH ()-[e]->() RETURN count(e)")
+	return err
+}
+
+// Returns the number of nodes and edges of the graph, every node including the ones without a cluster.
+func CountGraphObjects(ctx context.Context) (int, int, error) {
+	nodes, err := queryCount(ctx, "MATCH (n) RETURN count(n)")
+	if err != nil {
+		return 0, 0, err
+	}
+	edges, err := queryCount(ctx, "MATCH ()-[e]->() RETURN count(e)")
+	return nodes, edges, err
+}
+
+// Returns the query creating or replacing the Aggregator node.
+func saveAggregatorStatusQuery(status AggregatorStatus, updated time.Time) string {
+	// Visible to the users who can see the SearchAggregator resource.
+	resource := Resource{
+		Properties:     map[string]interface{}{"apigroup": "search.open-cluster-management.io"},
+		ResourceString: "searchaggregators",
+	}
+	resource.addRbacProperty()
+
+	query := SanitizeQuery("MERGE (a:Aggregator {_uid:'%s'}) SET a.kind = 'aggregator', a.name = '%s', "+
+		"a.version = '%s', a.commit = '%s', a._rbac = '%s', a.started = '%s', a.uptimeSeconds = %d, "+
+		"a.clusters = %d, a.totalResources = %d, a.totalEdges = %d, a.redisGraphVersion = '%s', a.updated = '%s'",
+		aggregatorStatusUID, status.Instance, status.Version, status.Commit, resource.Properties["_rbac"],
+		status.Started.UTC().Format(time.RFC3339), int(updated.Sub(status.Started).Seconds()), status.Clusters,
+		status.TotalResources, status.TotalEdges, FormatGraphVersion(CurrentGraphFeatures().Version),
+		updated.UTC().Format(time.RFC3339))
+	if !status.LastInterClusterEdgeBuild.IsZero() {
+		query += SanitizeQuery(", a.lastInterClusterEdgeBuild = '%s'",
+			status.LastInterClusterEdgeBuild.UTC().Format(time.RFC3339))
+	}
+	return query
+}
+
+// Creates or replaces the Aggregator node. It doesn't have the cluster property, so it isn't counted or resynced
+// with the cluster resources.
+func SaveAggregatorStatus(ctx context.Context, status AggregatorStatus) (*rg2.QueryResult, error) {
+	return Store.Query(WithWrite(ctx), saveAggregatorStatusQuery(status, time.Now()))
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregatorStatus(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (c:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Pod {_uid:'c1/p1', kind:'pod', cluster:'c1'})-[:inCluster]->(c), "+
+		"(:ClusterSummary {name:'c1', totalResources:7}), (:ClusterSummary {name:'c2', totalResources:5})")
+	assert.NoError(t, err)
+
+	started := time.Now().Add(-time.Hour)
+	status := AggregatorStatus{Instance: "aggregator-0", Version: "2.2.0", Started: started}
+	assert.NoError(t, CountAggregatorStatus(ctx, &status))
+	assert.Equal(t, 1, status.Clusters)
+	assert.Equal(t, 12, status.TotalResources, "Counted from the cluster summaries")
+	assert.Equal(t, 1, status.TotalEdges)
+
+	assert.NotContains(t, saveAggregatorStatusQuery(status, time.Now()), "lastInterClusterEdgeBuild")
+	status.LastInterClusterEdgeBuild = time.Now()
+	_, err = SaveAggregatorStatus(ctx, status)
+	assert.NoError(t, err)
+	_, err = SaveAggregatorStatus(ctx, status)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queryRows(t, "MATCH (a:Aggregator {kind:'aggregator', name:'aggregator-0'}) "+
+		"WHERE a.uptimeSeconds >= 3600 AND a.totalResources = 12 AND a.lastInterClusterEdgeBuild IS NOT NULL "+
+		"AND a._rbac = 'null_search.open-cluster-management.io_searchaggregators' RETURN a"),
+		"The node is replaced on each update")
+}
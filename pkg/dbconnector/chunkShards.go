@@ -0,0 +1,125 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Number of shards the chunked operations write at the same time, at least 1.
+func chunkParallelism() int {
+	if config.Cfg.ChunkParallelism < 1 {
+		return 1
+	}
+	return config.Cfg.ChunkParallelism
+}
+
+// Returns the shard of the key, out of the given number.
+func shardOf(key string, shards int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// Splits the resources in shards by their CHUNK_SHARD_KEY, keeping their order in each shard. Resources with the
+// same key are in the same shard, so their writes stay ordered when the shards are written at the same time.
+// Returns the shards and their sizes.
+func resourceShards(resources []*Resource) ([][]*Resource, []int) {
+	shards := chunkParallelism()
+	if shards == 1 || len(resources) <= ChunkSize() {
+		return [][]*Resource{resources}, []int{len(resources)}
+	}
+	sizes := make([]int, shards)
+	sharded := make([][]*Resource, shards)
+	for _, resource := range resources {
+		key := resource.UID
+		if config.Cfg.ChunkShardKey != "uid" {
+			key, _ = resource.Properties["namespace"].(string) // Cluster-scoped resources share a shard.
+		}
+		shard := shardOf(key, shards)
+		sharded[shard] = append(sharded[shard], resource)
+		sizes[shard]++
+	}
+	return sharded, sizes
+}
+
+// Splits the UIDs in shards by their hash, keeping their order in each shard. Returns the shards and their sizes.
+func uidShards(uids []string) ([][]string, []int) {
+	shards := chunkParallelism()
+	if shards == 1 || len(uids) <= ChunkSize() {
+		return [][]string{uids}, []int{len(uids)}
+	}
+	sizes := make([]int, shards)
+	sharded := make([][]string, shards)
+	for _, uid := range uids {
+		shard := shardOf(uid, shards)
+		sharded[shard] = append(sharded[shard], uid)
+		sizes[shard]++
+	}
+	return sharded, sizes
+}
+
+// Runs the chunks of each shard in order, and the shards at the same time. runChunk writes the items [start, end)
+// of the shard. All the shards stop at the first connection error.
+func runChunkShards(ctx context.Context, op string, shardSizes []int,
+	runChunk func(shard, start, end int) ChunkedOperationResult) ChunkedOperationResult {
+	chunkSize := ChunkSize()
+	total, chunks := 0, 0
+	for _, size := range shardSizes {
+		total += size
+		chunks += (size + chunkSize - 1) / chunkSize
+	}
+	tracker := newChunkTracker(ctx, op, total, chunkSize)
+	tracker.progress.Chunks = chunks
+
+	var result ChunkedOperationResult
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for shard, size := range shardSizes {
+		if size == 0 {
+			continue
+		}
+		wg.Add(1)
+		runShard := func(shard, size int) {
+			defer wg.Done()
+			for i := 0; i < size; i += chunkSize {
+				mutex.Lock()
+				failed := result.ConnectionError != nil
+				mutex.Unlock()
+				if failed {
+					return
+				}
+				var chunkResult ChunkedOperationResult
+				if ctx.Err() != nil {
+					chunkResult = ChunkedOperationResult{ConnectionError: batchError(ctx, op, ctx.Err())}
+				} else {
+					chunkResult = runChunk(shard, i, min(i+chunkSize, size))
+				}
+				mutex.Lock()
+				if chunkResult.ConnectionError != nil && result.ConnectionError == nil {
+					result.ConnectionError = chunkResult.ConnectionError
+				}
+				result.ResourceErrors = mergeErrorMaps(result.ResourceErrors, chunkResult.ResourceErrors)
+				result.SuccessfulResources += chunkResult.SuccessfulResources
+				mutex.Unlock()
+				if chunkResult.ConnectionError != nil {
+					return
+				}
+				tracker.chunkDone(min(i+chunkSize, size)-i, chunkResult.SuccessfulResources,
+					len(chunkResult.ResourceErrors))
+			}
+		}
+		if len(shardSizes) == 1 {
+			runShard(shard, size) // No need for a goroutine without chunk parallelism.
+		} else {
+			go runShard(shard, size)
+		}
+	}
+	wg.Wait()
+	return result
+}
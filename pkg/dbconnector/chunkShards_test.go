@@ -0,0 +1,115 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceShards(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.ChunkSize, config.Cfg.ChunkParallelism = 2, 4
+
+	resources := []*Resource{}
+	for i := 0; i < 12; i++ {
+		resources = append(resources, &Resource{UID: fmt.Sprintf("c1/%d", i),
+			Properties: map[string]interface{}{"namespace": fmt.Sprintf("ns%d", i%3)}})
+	}
+	shards, sizes := resourceShards(resources)
+	assert.Equal(t, 4, len(shards))
+	total := 0
+	for i, shard := range shards {
+		assert.Equal(t, len(shard), sizes[i])
+		total += len(shard)
+		for j := 1; j < len(shard); j++ {
+			assert.Less(t, resourceIndex(shard[j-1]), resourceIndex(shard[j]), "Resources keep their order.")
+		}
+		for _, resource := range shard {
+			assert.Equal(t, shardOf(resource.Properties["namespace"].(string), 4), i,
+				"Resources of a namespace are in the same shard.")
+		}
+	}
+	assert.Equal(t, 12, total)
+
+	config.Cfg.ChunkShardKey = "uid"
+	shards, _ = resourceShards(resources)
+	assert.Equal(t, shardOf("c1/5", 4), shardOfResource(shards, "c1/5"))
+
+	// Without parallelism, or with a single chunk, there's a single shard.
+	config.Cfg.ChunkParallelism = 1
+	shards, sizes = resourceShards(resources)
+	assert.Equal(t, [][]*Resource{resources}, shards)
+	assert.Equal(t, []int{12}, sizes)
+	config.Cfg.ChunkParallelism = 4
+	uids, sizes := uidShards([]string{"a", "b"})
+	assert.Equal(t, [][]string{{"a", "b"}}, uids)
+	assert.Equal(t, []int{2}, sizes)
+}
+
+func resourceIndex(resource *Resource) int {
+	var i int
+	_, _ = fmt.Sscanf(resource.UID, "c1/%d", &i)
+	return i
+}
+
+func shardOfResource(shards [][]*Resource, uid string) int {
+	for i, shard := range shards {
+		for _, resource := range shard {
+			if resource.UID == uid {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func TestChunkedOperationsParallel(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	prevDeletes := atomic.LoadInt64(&deletesSinceCompaction)
+	useTestDatastore(t)
+	config.Cfg.ChunkSize, config.Cfg.ChunkParallelism = 2, 3
+	defer func() {
+		atomic.StoreInt64(&deletesSinceCompaction, prevDeletes)
+	}()
+	_, err := Store.Query(context.Background(), "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'})")
+	assert.NoError(t, err)
+
+	resources := []*Resource{}
+	uids := []string{}
+	for i := 0; i < 20; i++ {
+		uid := fmt.Sprintf("c1/pod%d", i)
+		uids = append(uids, uid)
+		resources = append(resources, &Resource{Kind: "Pod", UID: uid, Properties: map[string]interface{}{
+			"kind": "Pod", "name": uid, "namespace": fmt.Sprintf("ns%d", i%5)}})
+	}
+	var reports []ChunkProgress
+	ctx := WithProgress(context.Background(), func(p ChunkProgress) { reports = append(reports, p) })
+	result := ChunkedInsert(ctx, resources, "c1")
+	assert.NoError(t, result.Err())
+	assert.Equal(t, 20, result.SuccessfulResources)
+	assert.Equal(t, 20, queryRows(t, "MATCH (n:Pod) RETURN n"))
+	last := reports[len(reports)-1]
+	assert.Equal(t, last.Chunks, last.Chunk)
+	assert.Equal(t, 20, last.Done)
+
+	// The updates of a resource are written in order, they're in the same shard.
+	updates := []*Resource{}
+	for i := 0; i < 20; i++ {
+		updates = append(updates, &Resource{Kind: "Pod", UID: "c1/pod3", Properties: map[string]interface{}{
+			"kind": "Pod", "name": "c1/pod3", "namespace": "ns3", "step": int64(i)}}, resources[i])
+	}
+	assert.NoError(t, ChunkedUpdate(context.Background(), updates).Err())
+	assert.Equal(t, 1, queryRows(t, "MATCH (n:Pod {_uid:'c1/pod3'}) WHERE n.step = 19 RETURN n"))
+
+	result = ChunkedDelete(context.Background(), uids)
+	assert.NoError(t, result.Err())
+	assert.Equal(t, 20, result.SuccessfulResources)
+	assert.Equal(t, 0, queryRows(t, "MATCH (n:Pod) RETURN n"))
+}
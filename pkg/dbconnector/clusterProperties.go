@@ -0,0 +1,134 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Properties that identify the resources, the cluster properties can't replace them.
+var reservedClusterProperties = []string{"apigroup", "cluster", CLUSTERSET_PROPERTY, "kind", "name", "namespace"}
+
+// Properties parsed from CLUSTER_PROPERTIES by cluster name, parsed again when the config changes.
+var (
+	clusterPropertiesConfig string
+	clusterProperties       map[string]map[string]string
+	clusterPropertiesMutex  = sync.Mutex{}
+)
+
+// Parses the JSON object of CLUSTER_PROPERTIES, the properties the hub sets on the nodes of each cluster, e.g.
+// {"cluster1": {"environment": "prod", "region": "eu"}}
+// Invalid clusters and properties are logged and skipped.
+func parseClusterProperties(value string) map[string]map[string]string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var parsed map[string]map[string]string
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		logger.Error("Error parsing CLUSTER_PROPERTIES, no cluster properties are set: ", err)
+		return nil
+	}
+	valid := make(map[string]map[string]string, len(parsed))
+	for clusterName, properties := range parsed {
+		if err := ValidateClusterName(clusterName); err != nil {
+			logger.Errorf("Skipping cluster %q from CLUSTER_PROPERTIES: %s", clusterName, err)
+			continue
+		}
+		kept := make(map[string]string, len(properties))
+		for property, v := range properties {
+			if !searchPropertyRegex.MatchString(property) || contains(reservedClusterProperties, property) ||
+				strings.HasPrefix(property, "_") {
+				logger.Errorf("Skipping property %q of cluster %s from CLUSTER_PROPERTIES", property, clusterName)
+				continue
+			}
+			kept[property] = v
+		}
+		if len(kept) > 0 {
+			valid[clusterName] = kept
+		}
+	}
+	return valid
+}
+
+func currentClusterProperties() map[string]map[string]string {
+	clusterPropertiesMutex.Lock()
+	defer clusterPropertiesMutex.Unlock()
+	if current := config.ClusterProperties(); clusterPropertiesConfig != current {
+		clusterPropertiesConfig = current
+		clusterProperties = parseClusterProperties(clusterPropertiesConfig)
+	}
+	return clusterProperties
+}
+
+// Returns the properties from CLUSTER_PROPERTIES set on the nodes of the cluster, nil when it has none.
+func ClusterPropertiesOf(clusterName string) map[string]string {
+	return currentClusterProperties()[clusterName]
+}
+
+// Returns the clusters with properties in CLUSTER_PROPERTIES, sorted.
+func ClusterPropertiesClusters() []string {
+	properties := currentClusterProperties()
+	clusters := make([]string, 0, len(properties))
+	for clusterName := range properties {
+		clusters = append(clusters, clusterName)
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+// Sets the cluster properties on the resource, over the values sent by the collector.
+func (r *Resource) AddClusterProperties(clusterName string) {
+	properties := ClusterPropertiesOf(clusterName)
+	if len(properties) == 0 {
+		return
+	}
+	if r.Properties == nil { // init props if it was nil
+		r.Properties = make(map[string]interface{})
+	}
+	for property, value := range properties {
+		r.Properties[property] = value
+	}
+}
+
+// Sets the properties on the Cluster node and all resources of the cluster, and removes the unset ones. Only nodes
+// with a stale value are written.
+func RetagClusterProperties(ctx context.Context, clusterName string, properties map[string]string,
+	unset []string) error {
+	if err := ValidateClusterName(clusterName); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(properties))
+	for property := range properties {
+		names = append(names, property)
+	}
+	sort.Strings(names) // Sorting to make the queries predictable
+	conditions, sets := []string{}, []string{}
+	for _, property := range names {
+		conditions = append(conditions, SanitizeQuery("n.%s IS NULL OR n.%s <> '%s'", property, property,
+			properties[property]))
+		sets = append(sets, SanitizeQuery("n.%s = '%s'", property, properties[property]))
+	}
+	for _, property := range unset {
+		if _, ok := properties[property]; !ok && searchPropertyRegex.MatchString(property) {
+			conditions = append(conditions, "n."+property+" IS NOT NULL")
+			sets = append(sets, "n."+property+" = NULL")
+		}
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	where := " WHERE " + strings.Join(conditions, " OR ") + " SET " + strings.Join(sets, ", ")
+	for _, match := range []string{"MATCH (n:Cluster {name:'%s'})", "MATCH (n {cluster:'%s'})"} {
+		if _, err := Store.Query(WithWrite(ctx), SanitizeQuery(match, clusterName)+where); err != nil {
+			return err
+		}
+	}
+	return nil
+}
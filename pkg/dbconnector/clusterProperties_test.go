@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseClusterProperties(t *testing.T) {
+	parsed := parseClusterProperties(`{"c1": {"environment": "prod", "name": "x", "_rbac": "y", "bad-name": "z"},
+		"c/2": {"region": "eu"}, "c3": {"kind": "pod"}}`)
+	assert.Equal(t, map[string]map[string]string{"c1": {"environment": "prod"}}, parsed,
+		"Invalid clusters and properties are skipped, the reserved properties can't be replaced.")
+	assert.Nil(t, parseClusterProperties(`["c1"]`))
+	assert.Nil(t, parseClusterProperties(""))
+}
+
+func Test_AddClusterProperties(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.ClusterProperties = `{"c1": {"environment": "prod", "region": "eu"}}`
+
+	resource := &Resource{UID: "c1/a", Properties: map[string]interface{}{"kind": "pod", "region": "us"}}
+	resource.AddClusterProperties("c1")
+	assert.Equal(t, map[string]interface{}{"kind": "pod", "environment": "prod", "region": "eu"}, resource.Properties,
+		"The properties of the hub replace the ones sent by the collector.")
+	other := &Resource{UID: "c2/a", Properties: map[string]interface{}{"kind": "pod"}}
+	other.AddClusterProperties("c2")
+	assert.Equal(t, map[string]interface{}{"kind": "pod"}, other.Properties)
+	assert.Equal(t, []string{"c1"}, ClusterPropertiesClusters())
+}
+
+func Test_RetagClusterProperties(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Pod {_uid:'c1/a', cluster:'c1', region:'us', tier:'gold'}), (:Pod {_uid:'c1/b', cluster:'c1'}), "+
+		"(:Pod {_uid:'c2/a', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	assert.NoError(t, RetagClusterProperties(ctx, "c1", map[string]string{"environment": "prod", "region": "eu"},
+		[]string{"tier"}))
+	result, err := Store.Query(ctx, "MATCH (n) WHERE n.environment = 'prod' AND n.region = 'eu' AND "+
+		"n.tier IS NULL RETURN count(n)")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, 3, result.Record().GetByIndex(0), "The Cluster node and the resources of the cluster are tagged.")
+
+	assert.NoError(t, RetagClusterProperties(ctx, "c1", nil, nil))
+	assert.Error(t, RetagClusterProperties(ctx, "c'1", map[string]string{"region": "eu"}, nil))
+}
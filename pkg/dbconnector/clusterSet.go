@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sync"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Label on the ManagedCluster that identifies the ManagedClusterSet it belongs to.
+const CLUSTERSET_LABEL = "cluster.open-cluster-management.io/clusterset"
+
+// Node property used to filter search results by ManagedClusterSet.
+const CLUSTERSET_PROPERTY = "clusterset"
+
+// Cache of cluster name -> ManagedClusterSet name. Kept up to date by the cluster watch.
+var clusterSetMap = make(map[string]string)
+var clusterSetMapMutex = sync.RWMutex{}
+
+// Records the ManagedClusterSet for a cluster. Returns true if the membership changed.
+func SetClusterSet(clusterName, clusterSet string) bool {
+	clusterSetMapMutex.Lock()
+	defer clusterSetMapMutex.Unlock()
+	prev, ok := clusterSetMap[clusterName]
+	clusterSetMap[clusterName] = clusterSet
+	return !ok || prev != clusterSet
+}
+
+// Returns the ManagedClusterSet for a cluster, or empty string if the cluster isn't in a set.
+func GetClusterSet(clusterName string) string {
+	clusterSetMapMutex.RLock()
+	defer clusterSetMapMutex.RUnlock()
+	return clusterSetMap[clusterName]
+}
+
+// Returns a copy of the cluster name -> ManagedClusterSet cache.
+func ClusterSets() map[string]string {
+	clusterSetMapMutex.RLock()
+	defer clusterSetMapMutex.RUnlock()
+	sets := make(map[string]string, len(clusterSetMap))
+	for cluster, set := range clusterSetMap {
+		sets[cluster] = set
+	}
+	return sets
+}
+
+// Removes a cluster from the ManagedClusterSet cache.
+func DeleteClusterSet(clusterName string) {
+	clusterSetMapMutex.Lock()
+	defer clusterSetMapMutex.Unlock()
+	delete(clusterSetMap, clusterName)
+}
+
+// Tags the resource with the ManagedClusterSet of the cluster it came from.
+func (r *Resource) addClusterSetProperty(clusterName string) {
+	if clusterName == "" {
+		return
+	}
+	if clusterSet := GetClusterSet(clusterName); clusterSet != "" {
+		if r.Properties == nil { // init props if it was nil
+			r.Properties = make(map[string]interface{})
+		}
+		r.Properties[CLUSTERSET_PROPERTY] = clusterSet
+	}
+}
+
+// Sets the clusterset property on the Cluster node and all resources of the cluster.
+// Only nodes with a stale value are written. An empty clusterSet removes the property.
+func RetagClusterSet(ctx context.Context, clusterName, clusterSet string) (*rg2.QueryResult, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return &rg2.QueryResult{}, err
+	}
+	var resourceQuery, clusterQuery string
+	if clusterSet == "" {
+		resourceQuery = SanitizeQuery(
+			"MATCH (n {cluster:'%s'}) WHERE n.clusterset IS NOT NULL SET n.clusterset = NULL", clusterName)
+		clusterQuery = SanitizeQuery(
+			"MATCH (c:Cluster {name:'%s'}) WHERE c.clusterset IS NOT NULL SET c.clusterset = NULL", clusterName)
+	} else {
+		resourceQuery = SanitizeQuery(
+			"MATCH (n {cluster:'%s'}) WHERE n.clusterset IS NULL OR n.clusterset <> '%s' SET n.clusterset = '%s'",
+			clusterName, clusterSet, clusterSet)
+		clusterQuery = SanitizeQuery(
+			"MATCH (c:Cluster {name:'%s'}) WHERE c.clusterset IS NULL OR c.clusterset <> '%s' SET c.clusterset = '%s'",
+			clusterName, clusterSet, clusterSet)
+	}
+	if _, err := Store.Query(WithWrite(ctx), clusterQuery); err != nil {
+		return &rg2.QueryResult{}, err
+	}
+	return Store.Query(WithWrite(ctx), resourceQuery)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetClusterSet(t *testing.T) {
+	defer DeleteClusterSet("set-cluster")
+
+	assert.True(t, SetClusterSet("set-cluster", "set-a"), "First membership should be reported as a change.")
+	assert.False(t, SetClusterSet("set-cluster", "set-a"), "Same membership should not be reported as a change.")
+	assert.True(t, SetClusterSet("set-cluster", "set-b"), "Moving sets should be reported as a change.")
+	assert.Equal(t, "set-b", GetClusterSet("set-cluster"))
+	assert.Equal(t, "set-b", ClusterSets()["set-cluster"])
+
+	DeleteClusterSet("set-cluster")
+	assert.Equal(t, "", GetClusterSet("set-cluster"))
+}
+
+func TestInsertQueryAddsClusterSet(t *testing.T) {
+	SetClusterSet("tagged-cluster", "set-a")
+	defer DeleteClusterSet("tagged-cluster")
+
+	resource := &Resource{
+		Kind:           "Pod",
+		UID:            "tagged-cluster/abc-123",
+		ResourceString: "pods",
+		Properties:     map[string]interface{}{"kind": "Pod", "name": "pod1", "cluster": "tagged-cluster"},
+	}
+	query, _ := insertQuery([]*Resource{resource}, "tagged-cluster")
+	assert.True(t, strings.Contains(query, "clusterset:'set-a'"), "Expected clusterset property in query: "+query)
+
+	untagged := &Resource{
+		Kind:           "Pod",
+		UID:            "other-cluster/abc-123",
+		ResourceString: "pods",
+		Properties:     map[string]interface{}{"kind": "Pod", "name": "pod1", "cluster": "other-cluster"},
+	}
+	query, _ = insertQuery([]*Resource{untagged}, "other-cluster")
+	assert.False(t, strings.Contains(query, "clusterset"), "Unexpected clusterset property in query: "+query)
+}
+
+func TestRetagClusterSetBadClusterName(t *testing.T) {
+	_, err := RetagClusterSet(context.Background(), "bad-cluster=name", "set-a")
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Summary of the resources in a cluster, stored as a ClusterSummary node so the overview
+// doesn't have to aggregate all the resource nodes at read time.
+type ClusterSummary struct {
+	Cluster          string
+	KindCounts       map[string]int
+	TotalResources   int
+	FailingPods      int
+	PolicyViolations int
+}
+
+// Pod status values that are not considered failing.
+var healthyPodStatus = []string{"Running", "Completed", "Succeeded"}
+
+// Computes the summary of the resources in a cluster.
+func ComputeClusterSummary(ctx context.Context, clusterName string) (ClusterSummary, error) {
+	summary := ClusterSummary{Cluster: clusterName, KindCounts: make(map[string]int)}
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return summary, err
+	}
+
+	result, err := Store.Query(ctx, SanitizeQuery("MATCH (n {cluster:'%s'}) RETURN n.kind, count(n)", clusterName))
+	if err != nil {
+		return summary, err
+	}
+	for result.Next() {
+		record := result.Record()
+		if count, ok := record.GetByIndex(1).(int); ok {
+			summary.KindCounts[recordString(record.GetByIndex(0))] = count
+			summary.TotalResources += count
+		}
+	}
+
+	healthy := make([]string, 0, len(healthyPodStatus))
+	for _, status := range healthyPodStatus {
+		healthy = append(healthy, fmt.Sprintf("n.status <> '%s'", status))
+	}
+	summary.FailingPods, err = queryCount(ctx, SanitizeQuery("MATCH (n:Pod {cluster:'%s'}) WHERE ", clusterName)+
+		strings.Join(healthy, " AND ")+" RETURN count(n)")
+	if err != nil {
+		return summary, err
+	}
+	summary.PolicyViolations, err = queryCount(ctx, SanitizeQuery(
+		"MATCH (n:Policy {cluster:'%s'}) WHERE n.compliant = 'NonCompliant' RETURN count(n)", clusterName))
+	return summary, err
+}
+
+// Creates or replaces the ClusterSummary node for a cluster.
+// The summary node doesn't have the cluster property, so it isn't counted or resynced with the cluster resources.
+func SaveClusterSummary(ctx context.Context, summary ClusterSummary) (*rg2.QueryResult, error) {
+	err := ValidateClusterName(summary.Cluster)
+	if err != nil {
+		return &rg2.QueryResult{}, err
+	}
+	kindCounts := make([]string, 0, len(summary.KindCounts))
+	for kind, count := range summary.KindCounts {
+		kindCounts = append(kindCounts, fmt.Sprintf("'%s=%d'", sanitizeValue(kind), count))
+	}
+	sort.Strings(kindCounts) // Sorting to make comparisons more predictable
+
+	resource := Resource{
+		Properties: map[string]interface{}{
+			"_clusterNamespace": summary.Cluster,
+			"apigroup":          "internal.open-cluster-management.io",
+		},
+		ResourceString: "managedclusterinfos", // Maps rbac to ManagedClusterInfo, same as the Cluster node.
+	}
+	resource.addRbacProperty()
+
+	query := SanitizeQuery("MERGE (s:ClusterSummary {name:'%s'}) SET s.kind = 'clustersummary', s._uid = '%s', "+
+		"s._rbac = '%s', s.totalResources = %d, s.failingPods = %d, s.policyViolations = %d, s.updated = '%s', ",
+		summary.Cluster, "cluster-summary__"+summary.Cluster, resource.Properties["_rbac"], summary.TotalResources,
+		summary.FailingPods, summary.PolicyViolations, time.Now().UTC().Format(time.RFC3339)) +
+		"s.kindCounts = [" + strings.Join(kindCounts, ", ") + "]"
+	return Store.Query(WithWrite(ctx), query)
+}
+
+// Deletes the ClusterSummary node for a cluster.
+func DeleteClusterSummary(ctx context.Context, clusterName string) (*rg2.QueryResult, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return &rg2.QueryResult{}, err
+	}
+	return Store.Query(WithWrite(ctx), SanitizeQuery("MATCH (s:ClusterSummary {name:'%s'}) DELETE s", clusterName))
+}
+
+// Runs a query that returns a single count.
+func queryCount(ctx context.Context, query string) (int, error) {
+	result, err := Store.Query(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	if result.Next() {
+		count, _ := result.Record().GetByIndex(0).(int)
+		return count, nil
+	}
+	return 0, nil
+}
+
+// Returns the names of the clusters with a ClusterSummary node.
+func ClusterSummaryNames(ctx context.Context) (map[string]bool, error) {
+	result, err := Store.Query(ctx, "MATCH (s:ClusterSummary) RETURN s.name")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for result.Next() {
+		names[recordString(result.Record().GetByIndex(0))] = true
+	}
+	return names, nil
+}
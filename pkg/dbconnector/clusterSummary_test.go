@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the queries sent to the datastore.
+type recordingStore struct {
+	queries *[]string
+}
+
+func (s recordingStore) Query(ctx context.Context, q string) (*rg2.QueryResult, error) {
+	*s.queries = append(*s.queries, q)
+	return &rg2.QueryResult{}, nil
+}
+
+func TestSaveClusterSummary(t *testing.T) {
+	queries := []string{}
+	prevStore := Store
+	Store = recordingStore{&queries}
+	defer func() { Store = prevStore }()
+
+	summary := ClusterSummary{
+		Cluster:          "summary-cluster",
+		KindCounts:       map[string]int{"pod": 10, "deployment": 2},
+		TotalResources:   12,
+		FailingPods:      1,
+		PolicyViolations: 3,
+	}
+	_, err := SaveClusterSummary(context.Background(), summary)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(queries))
+	query := queries[0]
+	assert.True(t, strings.HasPrefix(query, "MERGE (s:ClusterSummary {name:'summary-cluster'})"), query)
+	assert.Contains(t, query, "s._rbac = 'summary-cluster_internal.open-cluster-management.io_managedclusterinfos'")
+	assert.Contains(t, query, "s.totalResources = 12, s.failingPods = 1, s.policyViolations = 3")
+	assert.True(t, strings.HasSuffix(query, "s.kindCounts = ['deployment=2', 'pod=10']"), query)
+}
+
+func TestComputeClusterSummaryEmpty(t *testing.T) {
+	queries := []string{}
+	prevStore := Store
+	Store = recordingStore{&queries}
+	defer func() { Store = prevStore }()
+
+	summary, err := ComputeClusterSummary(context.Background(), "summary-cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, ClusterSummary{Cluster: "summary-cluster", KindCounts: map[string]int{}}, summary)
+	assert.Equal(t, 3, len(queries))
+	assert.Equal(t, "MATCH (n:Pod {cluster:'summary-cluster'}) WHERE n.status <> 'Running' AND "+
+		"n.status <> 'Completed' AND n.status <> 'Succeeded' RETURN count(n)", queries[1])
+}
+
+func TestClusterSummaryBadClusterName(t *testing.T) {
+	_, err := ComputeClusterSummary(context.Background(), "bad-cluster=name")
+	assert.Error(t, err)
+	_, err = DeleteClusterSummary(context.Background(), "bad-cluster=name")
+	assert.Error(t, err)
+}
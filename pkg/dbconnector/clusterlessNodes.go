@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Actions taken on a node without the cluster property. Also used as metric labels.
+const (
+	CLUSTERLESS_REPAIRED     = "repaired"     // The cluster of the UID prefix is set on the node.
+	CLUSTERLESS_DELETED      = "deleted"      // The cluster is gone, or the node duplicates a resource of the cluster.
+	CLUSTERLESS_UNATTRIBUTED = "unattributed" // The UID has no cluster prefix, the node is left as is.
+)
+
+// A node stored without the cluster property, e.g. by a bugged write. The resyncs of its cluster don't see it, so
+// it's never updated nor deleted.
+type ClusterlessNode struct {
+	UID     string `json:"uid"`
+	Label   string `json:"label,omitempty"`
+	Cluster string `json:"cluster,omitempty"` // From the UID prefix, empty when the UID doesn't have one.
+	Action  string `json:"action,omitempty"`
+}
+
+// Returns the cluster of a resource from the prefix of its UID, e.g. cluster1 for cluster1/abc. Empty for the UIDs
+// without a prefix and for the nodes of the aggregator, e.g. namespace-usage__cluster1/default.
+func UIDCluster(uid string) string {
+	i := strings.Index(uid, "/")
+	if i <= 0 || strings.Contains(uid[:i], "__") || ValidateClusterName(uid[:i]) != nil {
+		return ""
+	}
+	return uid[:i]
+}
+
+// Returns the nodes with a UID and without the cluster property, sorted by UID. The Cluster nodes and the nodes of
+// the aggregator don't have a cluster property, they're left out.
+func ClusterlessNodes(ctx context.Context) ([]ClusterlessNode, error) {
+	result, err := Store.Query(ctx, "MATCH (n) WHERE n.cluster IS NULL AND n._uid IS NOT NULL "+
+		"RETURN n._uid, labels(n)")
+	if err != nil {
+		return nil, err
+	}
+	nodes := []ClusterlessNode{}
+	for result.Next() {
+		record := result.Record()
+		uid, label := recordString(record.GetByIndex(0)), nodeLabel(record.GetByIndex(1))
+		if i := strings.Index(uid, "__"); i >= 0 && !strings.Contains(uid[:i], "/") {
+			continue // e.g. cluster__cluster1 or aggregator__search-aggregator
+		}
+		nodes = append(nodes, ClusterlessNode{UID: uid, Label: label, Cluster: UIDCluster(uid)})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].UID < nodes[j].UID })
+	return nodes, nil
+}
+
+// Repairs the nodes without the cluster property attributed to the cluster. When the cluster has a Cluster node its
+// cluster property is set, so the next resync updates or deletes them, unless the cluster already has a node with
+// the UID, then the copy without the cluster is deleted. The nodes of a cluster that's gone are deleted.
+func RepairClusterlessNodes(ctx context.Context, clusterName string, nodes []ClusterlessNode) ([]ClusterlessNode,
+	error) {
+	repaired := make([]ClusterlessNode, 0, len(nodes))
+	uids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if n.Cluster == clusterName {
+			uids = append(uids, n.UID)
+		}
+	}
+	if len(uids) == 0 {
+		return repaired, nil
+	}
+	check, err := CheckClusterResource(ctx, clusterName)
+	if err != nil {
+		return repaired, err
+	}
+	known := false
+	if check.Next() {
+		count, _ := check.Record().GetByIndex(0).(int)
+		known = count > 0
+	}
+
+	duplicated := make(map[string]bool)
+	if known {
+		result, err := Store.Query(ctx, SanitizeQuery("MATCH (n {cluster:'%s'}) WHERE n._uid IN ", clusterName)+
+			quotedList(uids)+" RETURN n._uid")
+		if err != nil {
+			return repaired, err
+		}
+		for result.Next() {
+			duplicated[recordString(result.Record().GetByIndex(0))] = true
+		}
+	}
+	toSet, toDelete := []string{}, []string{}
+	for _, n := range nodes {
+		if n.Cluster != clusterName {
+			continue
+		}
+		if known && !duplicated[n.UID] {
+			n.Action = CLUSTERLESS_REPAIRED
+			toSet = append(toSet, n.UID)
+		} else {
+			n.Action = CLUSTERLESS_DELETED
+			toDelete = append(toDelete, n.UID)
+		}
+		repaired = append(repaired, n)
+	}
+	if len(toSet) > 0 {
+		if _, err := Store.Query(WithWrite(ctx), "MATCH (n) WHERE n.cluster IS NULL AND n._uid IN "+quotedList(toSet)+
+			SanitizeQuery(" SET n.cluster = '%s'", clusterName)); err != nil {
+			return nil, err
+		}
+	}
+	if len(toDelete) > 0 {
+		if _, err := Store.Query(WithWrite(ctx), "MATCH (n) WHERE n.cluster IS NULL AND n._uid IN "+
+			quotedList(toDelete)+" DELETE n"); err != nil {
+			return nil, err
+		}
+	}
+	return repaired, nil
+}
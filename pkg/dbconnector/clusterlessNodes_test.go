@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UIDCluster(t *testing.T) {
+	assert.Equal(t, "cluster1", UIDCluster("cluster1/abc"))
+	assert.Equal(t, "", UIDCluster("abc"))
+	assert.Equal(t, "", UIDCluster("/abc"))
+	assert.Equal(t, "", UIDCluster("namespace-usage__cluster1/default"), "Nodes of the aggregator aren't attributed.")
+}
+
+func Test_RepairClusterlessNodes(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Aggregator {_uid:'aggregator__search-aggregator'}), (:NamespaceUsage {_uid:'namespace-usage__c1/default'}), "+
+		"(:Pod {_uid:'c1/a', kind:'pod'}), (:Pod {_uid:'c1/b', kind:'pod', cluster:'c1'}), (:Pod {_uid:'c1/b'}), "+
+		"(:Pod {_uid:'gone/x', kind:'pod'}), (:Pod {_uid:'orphan', kind:'pod'}), (:Pod {_uid:'c1/ok', cluster:'c1'})")
+	assert.NoError(t, err)
+
+	nodes, err := ClusterlessNodes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []ClusterlessNode{{UID: "c1/a", Label: "Pod", Cluster: "c1"}, {UID: "c1/b", Label: "Pod", Cluster: "c1"},
+		{UID: "gone/x", Label: "Pod", Cluster: "gone"}, {UID: "orphan", Label: "Pod"}}, nodes)
+
+	repaired, err := RepairClusterlessNodes(ctx, "c1", nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, []ClusterlessNode{{UID: "c1/a", Label: "Pod", Cluster: "c1", Action: CLUSTERLESS_REPAIRED},
+		{UID: "c1/b", Label: "Pod", Cluster: "c1", Action: CLUSTERLESS_DELETED}}, repaired,
+		"The copy of a resource the cluster already has is deleted.")
+	repaired, err = RepairClusterlessNodes(ctx, "gone", nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, []ClusterlessNode{{UID: "gone/x", Label: "Pod", Cluster: "gone", Action: CLUSTERLESS_DELETED}},
+		repaired, "The nodes of a cluster that's gone are deleted.")
+
+	nodes, err = ClusterlessNodes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []ClusterlessNode{{UID: "orphan", Label: "Pod"}}, nodes)
+	result, err := Store.Query(ctx, "MATCH (n {cluster:'c1'}) RETURN count(n)")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, 3, result.Record().GetByIndex(0))
+}
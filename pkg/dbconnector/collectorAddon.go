@@ -0,0 +1,44 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"sync"
+	"time"
+)
+
+// Status of the collector addon of a cluster, from the Available condition of its ManagedClusterAddOn.
+type CollectorAddon struct {
+	Available bool      `json:"available"`
+	Reason    string    `json:"reason,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Since     time.Time `json:"since"` // Last transition of the condition.
+}
+
+// Cache of cluster name -> collector addon status. Kept up to date by the cluster watch.
+var collectorAddons = make(map[string]CollectorAddon)
+var collectorAddonsMutex = sync.RWMutex{}
+
+// Records the status of the collector addon of a cluster.
+func SetCollectorAddon(clusterName string, addon CollectorAddon) {
+	collectorAddonsMutex.Lock()
+	defer collectorAddonsMutex.Unlock()
+	collectorAddons[clusterName] = addon
+}
+
+// Returns the status of the collector addon of a cluster, false when the cluster has none or it has no
+// Available condition yet.
+func GetCollectorAddon(clusterName string) (CollectorAddon, bool) {
+	collectorAddonsMutex.RLock()
+	defer collectorAddonsMutex.RUnlock()
+	addon, ok := collectorAddons[clusterName]
+	return addon, ok
+}
+
+// Removes a cluster from the collector addon cache.
+func DeleteCollectorAddon(clusterName string) {
+	collectorAddonsMutex.Lock()
+	defer collectorAddonsMutex.Unlock()
+	delete(collectorAddons, clusterName)
+}
@@ -0,0 +1,422 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Suffix of the graph the nodes and edges are copied to while compacting.
+const COMPACTION_GRAPH_SUFFIX = "-compact"
+
+// Temporary property holding the id of the node in the graph being compacted, to connect the copied edges.
+const compactIdProperty = "_compactId"
+
+// Node ids read in each query while copying the graph.
+const compactionReadSpan = 1000
+
+var ErrCompactionRunning = errors.New("A compaction of the graph is already running")
+
+// Stats of a compaction.
+type CompactionStats struct {
+	Nodes      int       `json:"nodes"`
+	Edges      int       `json:"edges"`
+	Deletes    int64     `json:"deletesSinceLastCompaction"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMS int64     `json:"durationMS"`
+}
+
+var (
+	compacting             int32 // 1 while a compaction runs.
+	deletesSinceCompaction int64 // Nodes deleted since the aggregator started or the last compaction.
+)
+
+// Pauses the writes to the graph while it's copied, so the copy doesn't miss any change.
+var writeBarrier = struct {
+	sync.Mutex
+	paused   chan struct{} // Closed when the writes resume, nil when they aren't paused.
+	inFlight sync.WaitGroup
+}{}
+
+// Waits until writes to the graph aren't paused. Call release when the write is done.
+func acquireWrite(ctx context.Context) (release func(), err error) {
+	for {
+		writeBarrier.Lock()
+		paused := writeBarrier.paused
+		if paused == nil {
+			writeBarrier.inFlight.Add(1)
+			writeBarrier.Unlock()
+			return writeBarrier.inFlight.Done, nil
+		}
+		writeBarrier.Unlock()
+		select {
+		case <-paused:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Pauses new writes and waits for the writes in flight to finish. Call resume to let the writes through again.
+func pauseWrites() (resume func()) {
+	writeBarrier.Lock()
+	writeBarrier.paused = make(chan struct{})
+	writeBarrier.Unlock()
+	writeBarrier.inFlight.Wait()
+	return func() {
+		writeBarrier.Lock()
+		close(writeBarrier.paused)
+		writeBarrier.paused = nil
+		writeBarrier.Unlock()
+	}
+}
+
+// Counts the deleted nodes towards COMPACTION_MIN_DELETES.
+func recordDeletes(count int) {
+	atomic.AddInt64(&deletesSinceCompaction, int64(count))
+}
+
+// Copies the nodes and edges to a new graph and swaps it with the RedisGraph graph, to reclaim the memory RedisGraph
+// keeps for deleted nodes and edges. Writes wait while the graph is copied, reads keep using the graph.
+// The graph is left unchanged if the copy fails.
+func CompactGraph(ctx context.Context) (CompactionStats, error) {
+	if !atomic.CompareAndSwapInt32(&compacting, 0, 1) {
+		return CompactionStats{}, ErrCompactionRunning
+	}
+	defer atomic.StoreInt32(&compacting, 0)
+	ctx = WithLane(ctx, BulkLane)
+	stats := CompactionStats{StartedAt: time.Now(), Deletes: atomic.LoadInt64(&deletesSinceCompaction)}
+	logger.Info("Compacting the graph. Nodes deleted since the last compaction: ", stats.Deletes)
+
+	resume := pauseWrites()
+	err := copyAndSwapGraph(ctx, &stats)
+	resume()
+	stats.DurationMS = time.Since(stats.StartedAt).Milliseconds()
+	metrics.CompactionSeconds.Observe(time.Since(stats.StartedAt).Seconds())
+	if err != nil {
+		metrics.Compactions.WithLabelValues("failure").Inc()
+		return stats, err
+	}
+	atomic.AddInt64(&deletesSinceCompaction, -stats.Deletes)
+	metrics.Compactions.WithLabelValues("success").Inc()
+	logger.Infof("Compacted the graph in %d ms. Nodes: %d Edges: %d", stats.DurationMS, stats.Nodes, stats.Edges)
+	return stats, nil
+}
+
+func copyAndSwapGraph(ctx context.Context, stats *CompactionStats) error {
+	target := RedisGraphStoreV2{graph: GRAPH_NAME + COMPACTION_GRAPH_SUFFIX}
+	_ = deleteGraph(ctx, target.graph) // Left over by a compaction that didn't complete.
+
+	labels, err := graphLabels(ctx)
+	if err != nil {
+		return err
+	}
+	for _, label := range labels {
+		for _, property := range []string{"_uid", compactIdProperty} {
+			if _, err = target.Query(WithWrite(ctx), SanitizeQuery("CREATE INDEX ON :%s(%s)", label, property)); err != nil {
+				return abortCompaction(ctx, target, err)
+			}
+		}
+	}
+	nodeLabels := make(map[int]string)
+	if stats.Nodes, err = copyNodes(ctx, target, nodeLabels); err != nil {
+		return abortCompaction(ctx, target, err)
+	}
+	if stats.Edges, err = copyEdges(ctx, target, nodeLabels); err != nil {
+		return abortCompaction(ctx, target, err)
+	}
+	for _, label := range labels {
+		query := SanitizeQuery("MATCH (n:%s) SET n.%s = NULL", label, compactIdProperty)
+		if _, err = target.Query(WithWrite(ctx), query); err != nil {
+			return abortCompaction(ctx, target, err)
+		}
+		query = SanitizeQuery("DROP INDEX ON :%s(%s)", label, compactIdProperty)
+		if _, err = target.Query(WithWrite(ctx), query); err != nil {
+			logger.Warning("Error dropping the compaction index of ", label, ": ", err)
+		}
+	}
+
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return abortCompaction(ctx, target, err)
+	}
+	defer conn.Close()
+	if _, err = conn.Do("RENAME", target.graph, GRAPH_NAME); err != nil {
+		return abortCompaction(ctx, target, err)
+	}
+	return nil
+}
+
+// Deletes the partial copy of the graph and returns the error that stopped the compaction.
+func abortCompaction(ctx context.Context, target RedisGraphStoreV2, err error) error {
+	logger.Error("Error compacting the graph, the graph is unchanged: ", err)
+	if deleteErr := deleteGraph(ctx, target.graph); deleteErr != nil {
+		logger.Warning("Error deleting the partial copy of the graph ", target.graph, ": ", deleteErr)
+	}
+	return err
+}
+
+func deleteGraph(ctx context.Context, graph string) error {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("GRAPH.DELETE", graph)
+	return err
+}
+
+// Returns the labels of the nodes in the graph, sorted.
+func graphLabels(ctx context.Context) ([]string, error) {
+	result, err := RedisGraphStoreV2{}.Query(ctx, "MATCH (n) RETURN distinct labels(n)")
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for result.Next() {
+		switch value := result.Record().GetByIndex(0).(type) {
+		case string: // RedisGraph before 2.8 returns the single label of the node.
+			found[value] = true
+		case []interface{}:
+			for _, label := range value {
+				if label, ok := label.(string); ok {
+					found[label] = true
+				}
+			}
+		}
+	}
+	labels := make([]string, 0, len(found))
+	for label := range found {
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+// Returns the highest id of the nodes or edges matched by the pattern, -1 when there are none.
+func maxId(ctx context.Context, pattern, variable string) (int, error) {
+	/* #nosec G201 - The pattern and variable are constants. */
+	result, err := RedisGraphStoreV2{}.Query(ctx, fmt.Sprintf("MATCH %s RETURN max(id(%s))", pattern, variable))
+	if err != nil {
+		return -1, err
+	}
+	if !result.Next() {
+		return -1, nil
+	}
+	if id, ok := result.Record().GetByIndex(0).(int); ok {
+		return id, nil
+	}
+	return -1, nil
+}
+
+// Copies the nodes to the target graph, each with the id of the original node in the _compactId property.
+// Fills nodeLabels with the label of each node by its original id.
+func copyNodes(ctx context.Context, target RedisGraphStoreV2, nodeLabels map[int]string) (int, error) {
+	last, err := maxId(ctx, "(n)", "n")
+	if err != nil {
+		return 0, err
+	}
+	copied := 0
+	for start := 0; start <= last; start += compactionReadSpan {
+		query := fmt.Sprintf("MATCH (n) WHERE id(n) >= %d AND id(n) < %d RETURN n", start, start+compactionReadSpan)
+		result, err := RedisGraphStoreV2{}.Query(ctx, query)
+		if err != nil {
+			return copied, err
+		}
+		nodes := []string{}
+		for result.Next() {
+			node, ok := result.Record().GetByIndex(0).(*rg2.Node)
+			if !ok {
+				continue
+			}
+			label := ""
+			if node.Label != "" {
+				label = ":" + node.Label
+			}
+			properties, err := propertiesLiteral(node.Properties, fmt.Sprintf("%s: %d", compactIdProperty, node.ID))
+			if err != nil {
+				return copied, fmt.Errorf("Error copying node %d: %s", node.ID, err)
+			}
+			nodeLabels[int(node.ID)] = label
+			nodes = append(nodes, fmt.Sprintf("(%s %s)", label, properties))
+		}
+		for i := 0; i < len(nodes); i += ChunkSize() {
+			chunk := nodes[i:min(i+ChunkSize(), len(nodes))]
+			if _, err = target.Query(WithWrite(ctx), "CREATE "+strings.Join(chunk, ", ")); err != nil {
+				return copied, err
+			}
+			copied += len(chunk)
+		}
+	}
+	return copied, nil
+}
+
+// Copies the edges to the target graph, connecting the copies of their nodes.
+func copyEdges(ctx context.Context, target RedisGraphStoreV2, nodeLabels map[int]string) (int, error) {
+	last, err := maxId(ctx, "()-[e]->()", "e")
+	if err != nil {
+		return 0, err
+	}
+	copied := 0
+	for start := 0; start <= last; start += compactionReadSpan {
+		query := fmt.Sprintf("MATCH ()-[e]->() WHERE id(e) >= %d AND id(e) < %d RETURN e", start, start+compactionReadSpan)
+		result, err := RedisGraphStoreV2{}.Query(ctx, query)
+		if err != nil {
+			return copied, err
+		}
+		var matches, creates []string
+		flush := func() error {
+			if len(creates) == 0 {
+				return nil
+			}
+			_, err := target.Query(WithWrite(ctx), "MATCH "+strings.Join(matches, ", ")+" CREATE "+strings.Join(creates, ", "))
+			copied += len(creates)
+			matches, creates = nil, nil
+			return err
+		}
+		for result.Next() {
+			edge, ok := result.Record().GetByIndex(0).(*rg2.Edge)
+			if !ok {
+				continue
+			}
+			source, dest := int(edge.SourceNodeID()), int(edge.DestNodeID())
+			properties, err := propertiesLiteral(edge.Properties)
+			if err != nil {
+				return copied, fmt.Errorf("Error copying edge %d: %s", edge.ID, err)
+			}
+			i := len(creates)
+			matches = append(matches,
+				fmt.Sprintf("(s%d%s {%s: %d})", i, nodeLabels[source], compactIdProperty, source),
+				fmt.Sprintf("(d%d%s {%s: %d})", i, nodeLabels[dest], compactIdProperty, dest))
+			creates = append(creates, fmt.Sprintf("(s%d)-[:%s %s]->(d%d)", i, edge.Relation, properties, i))
+			if len(creates) == ChunkSize() {
+				if err = flush(); err != nil {
+					return copied, err
+				}
+			}
+		}
+		if err = flush(); err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// Encodes the properties as an openCypher map, e.g. {kind: 'pod', container: ['a', 'b']}
+func propertiesLiteral(properties map[string]interface{}, extra ...string) (string, error) {
+	entries := append([]string{}, extra...)
+	for key, value := range properties {
+		if value == nil {
+			continue
+		}
+		literal, err := propertyLiteral(value)
+		if err != nil {
+			return "", fmt.Errorf("property %s: %s", key, err)
+		}
+		entries = append(entries, key+": "+literal)
+	}
+	sort.Strings(entries) // Sorting to make the queries predictable.
+	return "{" + strings.Join(entries, ", ") + "}", nil
+}
+
+func propertyLiteral(value interface{}) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return "'" + sanitizeValue(typed) + "'", nil
+	case int:
+		return strconv.Itoa(typed), nil
+	case int64:
+		return strconv.FormatInt(typed, 10), nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case []interface{}:
+		elements := make([]string, len(typed))
+		for i, element := range typed {
+			literal, err := propertyLiteral(element)
+			if err != nil {
+				return "", err
+			}
+			elements[i] = literal
+		}
+		return "[" + strings.Join(elements, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported type %T", value)
+}
+
+// Parses COMPACTION_WINDOW, e.g. 02:00-04:00 UTC. The window can wrap midnight, e.g. 23:00-01:00.
+// Returns the start of the window now is in, and false when it isn't in the window.
+func compactionWindowStart(window string, now time.Time) (time.Time, bool, error) {
+	bounds := strings.Split(window, "-")
+	if len(bounds) != 2 {
+		return time.Time{}, false, fmt.Errorf("Invalid COMPACTION_WINDOW %q, expected HH:MM-HH:MM", window)
+	}
+	var minutes [2]int
+	for i, bound := range bounds {
+		parsed, err := time.Parse("15:04", strings.TrimSpace(bound))
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("Invalid COMPACTION_WINDOW %q, expected HH:MM-HH:MM", window)
+		}
+		minutes[i] = parsed.Hour()*60 + parsed.Minute()
+	}
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	minute := now.Hour()*60 + now.Minute()
+	start, end := minutes[0], minutes[1]
+	switch {
+	case start <= end && minute >= start && minute < end, start > end && minute >= start:
+		return day.Add(time.Duration(start) * time.Minute), true, nil
+	case start > end && minute < end:
+		return day.AddDate(0, 0, -1).Add(time.Duration(start) * time.Minute), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// Compacts the graph once in each COMPACTION_WINDOW, when at least COMPACTION_MIN_DELETES nodes were deleted
+// since the last compaction.
+func CompactionJob() {
+	var lastWindow time.Time
+	invalidWindow := ""
+	for {
+		time.Sleep(time.Minute)
+		if config.Cfg.CompactionWindow == "" {
+			continue
+		}
+		start, inWindow, err := compactionWindowStart(config.Cfg.CompactionWindow, time.Now())
+		if err != nil {
+			if invalidWindow != config.Cfg.CompactionWindow { // Logged once per value.
+				logger.Error(err)
+				invalidWindow = config.Cfg.CompactionWindow
+			}
+			continue
+		}
+		if !inWindow || start.Equal(lastWindow) {
+			continue
+		}
+		deletes := atomic.LoadInt64(&deletesSinceCompaction)
+		if deletes < int64(config.Cfg.CompactionMinDeletes) {
+			logger.V(3).Infof("Skipping compaction, %d nodes deleted since the last compaction.", deletes)
+			continue
+		}
+		lastWindow = start // A failed compaction is retried in the next window.
+		if _, err := CompactGraph(context.Background()); err != nil {
+			logger.Error("Compaction job failed: ", err)
+		}
+	}
+}
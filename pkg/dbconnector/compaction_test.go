@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func queryRows(t *testing.T, query string) int {
+	result, err := Store.Query(context.Background(), query)
+	assert.NoError(t, err)
+	return countRows(result)
+}
+
+func TestCompactGraph(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (c:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(p1:Pod {_uid:'c1/p1', kind:'pod', name:'a\\\\\\'b', restarts:3, label:['app=a'], ready:'true'})-[:inCluster {_interCluster:true}]->(c), "+
+		"(p2:Pod {_uid:'c1/p2', kind:'pod', name:'it\\'s'})-[:inCluster]->(c), "+
+		"(r:ReplicaSet {_uid:'c1/r', kind:'replicaset'})-[:inCluster]->(c), (p1)-[:ownedBy]->(r), (p2)-[:ownedBy]->(r)")
+	assert.NoError(t, err)
+	ChunkedDelete(ctx, []string{"c1/p2"})
+
+	stats, err := CompactGraph(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Nodes)
+	assert.Equal(t, 3, stats.Edges)
+	assert.Equal(t, int64(1), stats.Deletes)
+
+	// The nodes, edges and properties are the same, without the deleted pod.
+	result, err := Store.Query(ctx, "MATCH (p:Pod)-[e:inCluster]->(c:Cluster) RETURN p._uid, p.name, p.restarts, p.label, "+
+		"e._interCluster, c.name, p._compactId")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{"c1/p1", `a\'b`, 3, []interface{}{"app=a"}, true, "c1", nil}, result.Record().Values())
+	assert.False(t, result.Next())
+	assert.Equal(t, 1, queryRows(t, "MATCH (:Pod)-[:ownedBy]->(:ReplicaSet) RETURN 1"))
+	assert.Equal(t, 0, queryRows(t, "MATCH (n {_uid:'c1/p2'}) RETURN n"))
+
+	// The graph keeps taking writes after the compaction.
+	_, err = Store.Query(ctx, "CREATE (:Pod {_uid:'c1/p3', kind:'pod'})")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, queryRows(t, "MATCH (n:Pod) RETURN n"))
+}
+
+func TestWriteBarrier(t *testing.T) {
+	resume := pauseWrites()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := acquireWrite(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err) // Waits while the writes are paused.
+
+	resume()
+	release, err := acquireWrite(context.Background())
+	assert.NoError(t, err)
+	paused := make(chan struct{})
+	go func() {
+		pauseWrites()()
+		close(paused)
+	}()
+	select {
+	case <-paused:
+		t.Fatal("Writes were paused before the write in flight completed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	<-paused
+}
+
+func TestCompactionWindowStart(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2021, 6, 2, hour, minute, 0, 0, time.UTC) }
+
+	start, inWindow, err := compactionWindowStart("02:00-04:00", at(3, 30))
+	assert.NoError(t, err)
+	assert.True(t, inWindow)
+	assert.Equal(t, at(2, 0), start)
+
+	_, inWindow, _ = compactionWindowStart("02:00-04:00", at(4, 0))
+	assert.False(t, inWindow)
+
+	// The window wraps midnight.
+	start, inWindow, _ = compactionWindowStart("23:00-01:00", at(0, 30))
+	assert.True(t, inWindow)
+	assert.Equal(t, at(23, 0).AddDate(0, 0, -1), start)
+	start, inWindow, _ = compactionWindowStart("23:00-01:00", at(23, 10))
+	assert.True(t, inWindow)
+	assert.Equal(t, at(23, 0), start)
+
+	for _, invalid := range []string{"02:00", "2am-4am", "02:00-25:00"} {
+		_, _, err = compactionWindowStart(invalid, at(3, 0))
+		assert.Error(t, err, invalid)
+	}
+}
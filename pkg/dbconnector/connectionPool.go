@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Builds a connection pool sized from the config. Connections are closed after their max lifetime and after
+// being idle for the idle timeout, and are checked with PING before they are reused.
+// This way stale sockets, e.g. after a Redis failover, are discarded by the pool instead of failing queries.
+// The name identifies the pool in logs and metrics.
+func newPool(name string, dial func() (redis.Conn, error)) *redis.Pool {
+	pool := &redis.Pool{
+		MaxIdle:         config.Cfg.PoolMaxIdle,   // Idle connections are connections that have been returned to the pool.
+		MaxActive:       config.Cfg.PoolMaxActive, // Active connections = connections in-use + idle connections
+		MaxConnLifetime: time.Duration(config.Cfg.PoolMaxLifetimeMS) * time.Millisecond,
+		IdleTimeout:     time.Duration(config.Cfg.PoolIdleTimeoutMS) * time.Millisecond,
+		Dial:            dial,
+		TestOnBorrow:    connectionHealthCheck(name, time.Duration(config.Cfg.PoolPingIdleMS)*time.Millisecond),
+		Wait:            true,
+	}
+	if pool.IdleTimeout > 0 {
+		go reapIdleConnections(name, pool, pool.IdleTimeout/2)
+	}
+	return pool
+}
+
+// Returns the function used by the pool to test connections before reusing them. Connections idle for less
+// than pingAfter are assumed to be okay, the others are checked with PING. A pingAfter of 0 checks them all.
+func connectionHealthCheck(name string, pingAfter time.Duration) func(c redis.Conn, t time.Time) error {
+	return func(c redis.Conn, t time.Time) error {
+		if pingAfter > 0 && time.Since(t) < pingAfter {
+			return nil
+		}
+		_, err := c.Do("PING")
+		if err != nil {
+			logger.V(2).Infof("Discarding unhealthy connection from the %s pool: %s", name, err)
+			metrics.PoolHealthCheckFailures.WithLabelValues(name).Inc()
+		}
+		return err
+	}
+}
+
+// The pool only closes idle connections when a connection is requested, so a quiet pool would keep them open.
+// Borrowing a connection periodically closes the ones idle for longer than the idle timeout.
+func reapIdleConnections(name string, pool *redis.Pool, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if pool.IdleCount() == 0 {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		conn, err := pool.GetContext(ctx)
+		cancel()
+		if err != nil {
+			logger.V(2).Infof("Error reaping idle connections of the %s pool: %s", name, err)
+			continue
+		}
+		if err := conn.Close(); err != nil {
+			logger.Warning("Failed to close redis connection. Original error: ", err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/memgraph"
+	assert "github.com/stretchr/testify/assert"
+)
+
+// Connection that counts the commands sent and fails them when broken.
+type pingConn struct {
+	redis.Conn
+	broken bool
+	pings  *int
+}
+
+func (c pingConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	*c.pings++
+	if c.broken {
+		return nil, errors.New("connection reset by peer")
+	}
+	return "PONG", nil
+}
+
+func Test_connectionHealthCheck(t *testing.T) {
+	pings := 0
+	check := connectionHealthCheck("test", time.Minute)
+	assert.Nil(t, check(pingConn{broken: true, pings: &pings}, time.Now()), "Recently used connections aren't checked")
+	assert.Equal(t, 0, pings)
+
+	assert.Nil(t, check(pingConn{pings: &pings}, time.Now().Add(-2*time.Minute)))
+	assert.NotNil(t, check(pingConn{broken: true, pings: &pings}, time.Now().Add(-2*time.Minute)))
+	assert.Equal(t, 2, pings)
+
+	// Checks all the connections when pingAfter is 0.
+	assert.NotNil(t, connectionHealthCheck("test", 0)(pingConn{broken: true, pings: &pings}, time.Now()))
+}
+
+func Test_newPool(t *testing.T) {
+	pool := newPool("test", memgraph.NewServer().Dial)
+	defer pool.Close()
+
+	assert.Equal(t, config.Cfg.PoolMaxActive, pool.MaxActive)
+	assert.Equal(t, config.Cfg.PoolMaxIdle, pool.MaxIdle)
+	assert.Equal(t, time.Duration(config.Cfg.PoolIdleTimeoutMS)*time.Millisecond, pool.IdleTimeout)
+
+	conn := pool.Get()
+	_, err := conn.Do("PING")
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Close())
+	assert.Equal(t, 1, pool.IdleCount())
+
+	// The idle connection is reused instead of opening a new one.
+	conn = pool.Get()
+	_, err = conn.Do("PING")
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Close())
+	assert.Equal(t, 1, pool.Stats().ActiveCount)
+}
@@ -11,6 +11,7 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -19,29 +20,30 @@ import (
 
 // Recursive helper for ChunkedDelete. Takes a single chunk, and recursively attempts to insert that chunk,
 // then the first and second halves of that chunk independently, and so on.
-func chunkedDeleteHelper(uids []string) ChunkedOperationResult {
+func chunkedDeleteHelper(ctx context.Context, uids []string) ChunkedOperationResult {
 	if len(uids) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
-	_, err := Delete(uids)
-	if IsBadConnection(err) { // this is false if err is nil
+	_, err := Delete(ctx, uids)
+	if isFatalError(ctx, err) { // this is false if err is nil
 		return ChunkedOperationResult{
-			ConnectionError: err,
+			ConnectionError: batchError(ctx, "delete", err),
 		}
 	}
 	if err != nil {
 		if len(uids) == 1 { // If this was a single resource
 			return ChunkedOperationResult{
-				ResourceErrors: map[string]error{uids[0]: err},
+				ResourceErrors: map[string]error{uids[0]: resourceError("delete", uids[0], err)},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedDeleteHelper(uids[0 : len(uids)/2])
-			secondHalf := chunkedDeleteHelper(uids[len(uids)/2:])
-			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
-				// Again, if either one has a redis conn issue we just instantly bail
-				return ChunkedOperationResult{
-					ConnectionError: err,
-				}
+			firstHalf := chunkedDeleteHelper(ctx, uids[0:len(uids)/2])
+			secondHalf := chunkedDeleteHelper(ctx, uids[len(uids)/2:])
+			// Again, if either one has a redis conn issue we just instantly bail
+			if firstHalf.ConnectionError != nil {
+				return firstHalf
+			}
+			if secondHalf.ConnectionError != nil {
+				return secondHalf
 			}
 			return ChunkedOperationResult{
 				ResourceErrors: mergeErrorMaps(firstHalf.ResourceErrors, secondHalf.ResourceErrors),
@@ -57,31 +59,21 @@ func chunkedDeleteHelper(uids []string) ChunkedOperationResult {
 }
 
 // Delete the given resources from the graph, does chunking for you and returns errors related to individual resources.
-func ChunkedDelete(resources []string) ChunkedOperationResult {
-	var resourceErrors map[string]error
-	totalSuccessful := 0
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedDeleteHelper(resources[i:endIndex])
-		if chunkResult.ConnectionError != nil {
-			return chunkResult
-		} else if chunkResult.ResourceErrors != nil {
-			resourceErrors = mergeErrorMaps(resourceErrors, chunkResult.ResourceErrors) // if both are nil, this is nil
-		}
-		totalSuccessful += chunkResult.SuccessfulResources
-	}
-	return ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalSuccessful,
-	}
+func ChunkedDelete(ctx context.Context, resources []string) ChunkedOperationResult {
+	shards, shardSizes := uidShards(resources)
+	return runChunkShards(ctx, "delete", shardSizes, func(shard, start, end int) ChunkedOperationResult {
+		chunkResult := chunkedDeleteHelper(ctx, shards[shard][start:end])
+		recordDeletes(chunkResult.SuccessfulResources)
+		return chunkResult
+	})
 }
 
 // Deletes resources with the given UIDs, transparently builds query for you and returns the reponse
 // and errors given by redisgraph.
 // No encoding errors possible with this operation.
-func Delete(uids []string) (*rg2.QueryResult, error) {
+func Delete(ctx context.Context, uids []string) (*rg2.QueryResult, error) {
 	query := deleteQuery(uids)
-	resp, err := Store.Query(query)
+	resp, err := Store.Query(WithWrite(ctx), query)
 	return resp, err
 }
 
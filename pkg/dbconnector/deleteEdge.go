@@ -11,42 +11,41 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"sort"
 
-	"github.com/golang/glog"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
-var deletedEdgeCount int
-
 // Recursive helper for DeleteEdge. Takes a single chunk, and recursively attempts to delete that chunk, then the first
 // and second halves of that chunk independently, and so on.
-func chunkedDeleteEdgeHelper(resources []Edge) ChunkedOperationResult {
+func chunkedDeleteEdgeHelper(ctx context.Context, resources []Edge) ChunkedOperationResult {
 	if len(resources) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
 	// We currently ignore encoding errors as they are always recoverable, may change in the future.
-	resp, err := DeleteEdge(resources)
-	if IsBadConnection(err) { // this is false if err is nil
+	resp, err := DeleteEdge(ctx, resources)
+	if isFatalError(ctx, err) { // this is false if err is nil
 		return ChunkedOperationResult{
-			ConnectionError: err,
+			ConnectionError: batchError(ctx, "delete edge", err),
 		}
 	}
 	if err != nil {
 		if len(resources) == 1 { // If this was a single resource
 			uid := fmt.Sprintf("(%s)-[:%s]->(%s)", resources[0].SourceUID, resources[0].EdgeType, resources[0].DestUID)
 			return ChunkedOperationResult{
-				ResourceErrors: map[string]error{uid: err},
+				ResourceErrors: map[string]error{uid: resourceError("delete edge", uid, err)},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedDeleteEdgeHelper(resources[0 : len(resources)/2])
-			secondHalf := chunkedDeleteEdgeHelper(resources[len(resources)/2:])
-			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
-				// Again, if either one has a redis conn issue we just instantly bail
-				return ChunkedOperationResult{
-					ConnectionError: err,
-				}
+			firstHalf := chunkedDeleteEdgeHelper(ctx, resources[0:len(resources)/2])
+			secondHalf := chunkedDeleteEdgeHelper(ctx, resources[len(resources)/2:])
+			// Again, if either one has a redis conn issue we just instantly bail
+			if firstHalf.ConnectionError != nil {
+				return firstHalf
+			}
+			if secondHalf.ConnectionError != nil {
+				return secondHalf
 			}
 			return ChunkedOperationResult{
 				ResourceErrors: mergeErrorMaps(firstHalf.ResourceErrors, secondHalf.ResourceErrors),
@@ -64,14 +63,20 @@ func chunkedDeleteEdgeHelper(resources []Edge) ChunkedOperationResult {
 }
 
 // Updates the given resources in the graph, does chunking for you and returns errors related to individual edges.
-func ChunkedDeleteEdge(resources []Edge, clusterName string) ChunkedOperationResult {
-	glog.V(4).Info("For cluster ", clusterName, ": Number of edges received in ChunkedDeleteEdge: ", len(resources))
-	deletedEdgeCount = 0
+func ChunkedDeleteEdge(ctx context.Context, resources []Edge, clusterName string) ChunkedOperationResult {
+	logger.V(4).Info("For cluster ", clusterName, ": Number of edges received in ChunkedDeleteEdge: ", len(resources))
+	deletedEdgeCount := 0
 	var resourceErrors map[string]error
 	totalSuccessful := 0
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedDeleteEdgeHelper(resources[i:endIndex])
+	chunkSize := ChunkSize()
+	tracker := newChunkTracker(ctx, "delete edge", len(resources), chunkSize)
+	for i := 0; i < len(resources); i += chunkSize {
+		if ctx.Err() != nil {
+			return ChunkedOperationResult{ConnectionError: batchError(ctx, "delete edge", ctx.Err()),
+				SuccessfulResources: totalSuccessful, EdgesDeleted: deletedEdgeCount}
+		}
+		endIndex := min(i+chunkSize, len(resources))
+		chunkResult := chunkedDeleteEdgeHelper(ctx, resources[i:endIndex])
 		if chunkResult.ConnectionError != nil {
 			return chunkResult
 		} else if chunkResult.ResourceErrors != nil {
@@ -80,8 +85,9 @@ func ChunkedDeleteEdge(resources []Edge, clusterName string) ChunkedOperationRes
 		}
 		totalSuccessful += chunkResult.SuccessfulResources
 		deletedEdgeCount += chunkResult.EdgesDeleted
+		tracker.chunkDone(endIndex-i, chunkResult.SuccessfulResources, len(chunkResult.ResourceErrors))
 	}
-	glog.V(4).Info("ChunkedDeleteEdge: For cluster, ", clusterName, ": Number of edges deleted: ", deletedEdgeCount)
+	logger.V(4).Info("ChunkedDeleteEdge: For cluster, ", clusterName, ": Number of edges deleted: ", deletedEdgeCount)
 	return ChunkedOperationResult{
 		ResourceErrors:      resourceErrors,
 		SuccessfulResources: totalSuccessful,
@@ -90,44 +96,79 @@ func ChunkedDeleteEdge(resources []Edge, clusterName string) ChunkedOperationRes
 }
 
 // Returns the result, any errors when encoding, and any error from the query itself.
-func DeleteEdge(edges []Edge) (*rg2.QueryResult, error) {
+func DeleteEdge(ctx context.Context, edges []Edge) (*rg2.QueryResult, error) {
 	query := deleteEdgeQuery(edges) // Encoding errors are recoverable, but we still report them
-	resp, err := Store.Query(query)
+	resp, err := Store.Query(WithWrite(ctx), query)
 	if err == nil {
-		if len(edges) != resp.RelationshipsDeleted() {
-			glog.V(4).Info("Number of edges received in DeleteEdge ",
-				len(edges), " didn't match RelationshipsDeleted: ", resp.RelationshipsDeleted())
-			glog.V(4).Info("Delete query: ", query)
+		// Fewer are deleted when some edges are already gone. More means the graph has duplicate edges.
+		if deleted := resp.RelationshipsDeleted(); deleted > len(edges) {
+			logger.Warningf("DeleteEdge deleted %d relationships for %d edges, the graph has duplicate edges",
+				deleted, len(edges))
+		} else if deleted < len(edges) {
+			logger.V(4).Infof("DeleteEdge deleted %d relationships for %d edges, the others were already deleted",
+				deleted, len(edges))
+			logger.V(4).Info("Delete query: ", query)
 		}
 	}
 	return resp, err
 }
 
-// Returns a query used to delete an edge between 2 existing nodes.
-// e.g. MATCH (s {_uid: 'abc'})-[e:Type]->(d {_uid: 'def'}) DELETE e
+// Returns the header setting the parameters of a query, e.g. CYPHER uids=["a","b"]. Sorted by name, unlike
+// rg2.BuildParamsHeader, so the same parameters always give the same query.
+func paramsHeader(params map[string]interface{}) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	header := "CYPHER"
+	for _, name := range names {
+		header += fmt.Sprintf(" %s=%s", name, rg2.ToString(params[name]))
+	}
+	return header + " "
+}
+
+// Returns a parameterized query deleting a chunk of edges between existing nodes. The edges are grouped by type
+// and kinds, which can't be parameters, and the UIDs of each group are unwound from a parameter so the query text
+// doesn't grow with every edge. Each group is counted with WITH so the next one runs even when nothing matched.
+// e.g. CYPHER edges0=[["abc","def"]] UNWIND $edges0 AS edge0
+// MATCH (s0:Pod {_uid: edge0[0]})-[e0:ownedBy]->(d0:ReplicaSet {_uid: edge0[1]}) DELETE e0
 func deleteEdgeQuery(edges []Edge) string {
 	if len(edges) == 0 {
 		return ""
 	}
 
-	matchStrings := []string{}  // Build the MATCH portion
-	deleteStrings := []string{} // Build the DELETE portion. Declared at the same time so that we do this in one pass.
-	for i, edge := range edges {
-		// e.g. MATCH (s {_uid: 'abc'})-[e:Type]->(d {_uid: 'def'})
+	type edgeGroup struct{ sourceKind, edgeType, destKind string }
+	groups := []edgeGroup{} // In the order first seen, to keep the query predictable.
+	uids := make(map[edgeGroup][]interface{})
+	for _, edge := range edges {
+		group := edgeGroup{edgeType: edge.EdgeType}
 		if edge.SourceKind != "" && edge.DestKind != "" {
-			matchStrings = append(matchStrings,
-				SanitizeQuery("(s%d:%[5]s {_uid: '%[2]s'})-[e%[1]d:%[3]s]->(d%[1]d:%[6]s {_uid: '%[4]s'})",
-					i, edge.SourceUID, edge.EdgeType, edge.DestUID, edge.SourceKind, edge.DestKind))
-		} else {
-			matchStrings = append(matchStrings,
-				SanitizeQuery("(s%d {_uid: '%[2]s'})-[e%[1]d:%[3]s]->(d%[1]d {_uid: '%[4]s'})",
-					i, edge.SourceUID, edge.EdgeType, edge.DestUID))
+			group.sourceKind, group.destKind = edge.SourceKind, edge.DestKind
+		}
+		if _, ok := uids[group]; !ok {
+			groups = append(groups, group)
 		}
-		deleteStrings = append(deleteStrings, fmt.Sprintf("e%d", i)) // e.g. e0
+		uids[group] = append(uids[group], []interface{}{edge.SourceUID, edge.DestUID})
 	}
 
-	/* #nosec G201 - Input is sanitized above. */
-	queryString := fmt.Sprintf("MATCH %s DELETE %s", strings.Join(matchStrings, ", "), strings.Join(deleteStrings, ", "))
-
-	return queryString
+	params := make(map[string]interface{}, len(groups))
+	segments := make([]string, 0, len(groups))
+	for i, group := range groups {
+		params[fmt.Sprintf("edges%d", i)] = uids[group]
+		source, dest := fmt.Sprintf("s%d", i), fmt.Sprintf("d%d", i)
+		if group.sourceKind != "" {
+			source = SanitizeQuery("s%d:%s", i, group.sourceKind)
+			dest = SanitizeQuery("d%d:%s", i, group.destKind)
+		}
+		/* #nosec G201 - Input is sanitized above. */
+		segments = append(segments, fmt.Sprintf(
+			"UNWIND $edges%[1]d AS edge%[1]d MATCH (%[2]s {_uid: edge%[1]d[0]})-[e%[1]d:%[3]s]->(%[4]s {_uid: edge%[1]d[1]}) "+
+				"DELETE e%[1]d", i, source, sanitizeValue(group.edgeType), dest))
+	}
+	query := segments[0]
+	for i, segment := range segments[1:] {
+		query += fmt.Sprintf(" WITH count(*) AS deleted%d %s", i, segment)
+	}
+	return paramsHeader(params) + query
 }
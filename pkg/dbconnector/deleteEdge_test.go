@@ -3,6 +3,9 @@
 package dbconnector
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"testing"
 
 	assert "github.com/stretchr/testify/assert"
@@ -11,9 +14,14 @@ import (
 var clusterName string = "testCluster"
 
 func deleteQueryCheck(q string) bool {
-	delMultipleQuery := "MATCH (s0 {_uid: 'srcUID1'})-[e0:edgeType1]->(d0 {_uid: 'destUID1'}), (s1:srcKind1 {_uid: 'srcUID1'})-[e1:edgeType1]->(d1:destKind2 {_uid: 'destUID2'}), (s2:srcKind1 {_uid: 'srcUID1'})-[e2:edgeType2]->(d2:destKind3 {_uid: 'destUID3'}) DELETE e0, e1, e2"
-	delSingleQuery := "MATCH (s0:srcKind1 {_uid: 'srcUID1'})-[e0:edgeType1]->(d0:destKind1 {_uid: 'destUID1'}) DELETE e0"
-	delChunkedInCaseOfErrorQuery := "MATCH (s0:srcKind1 {_uid: 'srcUID1'})-[e0:edgeType1]->(d0:destKind2 {_uid: 'destUID2'}) DELETE e0"
+	delMultipleQuery := `CYPHER edges0=[["srcUID1","destUID1"]] edges1=[["srcUID1","destUID2"]] edges2=[["srcUID1","destUID3"]] ` +
+		"UNWIND $edges0 AS edge0 MATCH (s0 {_uid: edge0[0]})-[e0:edgeType1]->(d0 {_uid: edge0[1]}) DELETE e0 " +
+		"WITH count(*) AS deleted0 UNWIND $edges1 AS edge1 MATCH (s1:srcKind1 {_uid: edge1[0]})-[e1:edgeType1]->(d1:destKind2 {_uid: edge1[1]}) DELETE e1 " +
+		"WITH count(*) AS deleted1 UNWIND $edges2 AS edge2 MATCH (s2:srcKind1 {_uid: edge2[0]})-[e2:edgeType2]->(d2:destKind3 {_uid: edge2[1]}) DELETE e2"
+	delSingleQuery := `CYPHER edges0=[["srcUID1","destUID1"]] ` +
+		"UNWIND $edges0 AS edge0 MATCH (s0:srcKind1 {_uid: edge0[0]})-[e0:edgeType1]->(d0:destKind1 {_uid: edge0[1]}) DELETE e0"
+	delChunkedInCaseOfErrorQuery := `CYPHER edges0=[["srcUID1","destUID2"]] ` +
+		"UNWIND $edges0 AS edge0 MATCH (s0:srcKind1 {_uid: edge0[0]})-[e0:edgeType1]->(d0:destKind2 {_uid: edge0[1]}) DELETE e0"
 
 	if q == delMultipleQuery || q == delSingleQuery || q == delChunkedInCaseOfErrorQuery {
 		return true
@@ -21,29 +29,86 @@ func deleteQueryCheck(q string) bool {
 	return false
 }
 func TestChunkedDeleteEdge(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestEdges(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 0, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 3, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedDeleteSingleEdge(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestSingleEdge(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestSingleEdge(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 0, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 1, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedDeleteSingleErrorEdge(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestSingleErrorEdge(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestSingleErrorEdge(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 0, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedDeleteErrorEdges(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestErrorEdges(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestErrorEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 2, chunkedOpRes.SuccessfulResources)
 }
+
+func TestDeleteEdgeBatch(t *testing.T) {
+	useTestDatastore(t)
+	_, err := Store.Query(context.Background(), "CREATE (p1:Pod {_uid:'c1/pod1'}), (p2:Pod {_uid:'c1/pod2'}), "+
+		"(r:ReplicaSet {_uid:'c1/rs'}), (n:Node {_uid:'c1/node'}), (p1)-[:ownedBy]->(r), (p2)-[:ownedBy]->(r), "+
+		"(p1)-[:runsOn]->(n), (p2)-[:runsOn]->(n)")
+	assert.NoError(t, err)
+
+	// The groups run in turn even when one matches nothing.
+	edges := []Edge{
+		{SourceUID: "c1/pod1", DestUID: "c1/missing", EdgeType: "runsOn", SourceKind: "Pod", DestKind: "Node"},
+		{SourceUID: "c1/pod1", DestUID: "c1/rs", EdgeType: "ownedBy", SourceKind: "Pod", DestKind: "ReplicaSet"},
+		{SourceUID: "c1/pod2", DestUID: "c1/rs", EdgeType: "ownedBy", SourceKind: "Pod", DestKind: "ReplicaSet"},
+		{SourceUID: "c1/pod2", DestUID: "c1/node", EdgeType: "runsOn"},
+	}
+	result := ChunkedDeleteEdge(context.Background(), edges, "c1")
+	assert.NoError(t, result.Err())
+	assert.Equal(t, 4, result.SuccessfulResources)
+	assert.Equal(t, 3, result.EdgesDeleted)
+	assert.Equal(t, 1, queryRows(t, "MATCH (:Pod {_uid:'c1/pod1'})-[r:runsOn]->() RETURN r"))
+	assert.Equal(t, 0, queryRows(t, "MATCH ()-[r:ownedBy]->() RETURN r"))
+}
+
+// The count of deleted edges is kept per call, the syncs of the clusters delete their edges at the same time.
+func TestChunkedDeleteEdgeConcurrent(t *testing.T) {
+	useTestDatastore(t)
+	clusters := []string{"c1", "c2", "c3", "c4"}
+	for i, cluster := range clusters {
+		query := ""
+		for j := 0; j <= i; j++ {
+			query += fmt.Sprintf("CREATE (:Pod {_uid:'%[1]s/pod%[2]d'})-[:ownedBy]->(:ReplicaSet {_uid:'%[1]s/rs%[2]d'}) ",
+				cluster, j)
+		}
+		_, err := Store.Query(context.Background(), query)
+		assert.NoError(t, err)
+	}
+
+	results := make([]ChunkedOperationResult, len(clusters))
+	var wg sync.WaitGroup
+	for i, cluster := range clusters {
+		edges := []Edge{}
+		for j := 0; j <= i; j++ {
+			edges = append(edges, Edge{SourceUID: fmt.Sprintf("%s/pod%d", cluster, j), EdgeType: "ownedBy",
+				DestUID: fmt.Sprintf("%s/rs%d", cluster, j), SourceKind: "Pod", DestKind: "ReplicaSet"})
+		}
+		wg.Add(1)
+		go func(i int, cluster string) {
+			defer wg.Done()
+			results[i] = ChunkedDeleteEdge(context.Background(), edges, cluster)
+		}(i, cluster)
+	}
+	wg.Wait()
+	for i, result := range results {
+		assert.NoError(t, result.Err())
+		assert.Equal(t, i+1, result.EdgesDeleted, clusters[i])
+	}
+}
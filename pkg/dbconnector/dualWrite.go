@@ -0,0 +1,155 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// DualWriteStore sends every write to both datastores and reads only from the primary.
+// Used while migrating from one datastore to another, so both can be compared before switching.
+type DualWriteStore struct {
+	Primary   DBStore
+	Secondary DBStore
+}
+
+// Builds the DualWriteStore from the config. The secondary datastore gets its own connection pool.
+func newDualWriteStore() DualWriteStore {
+	secondary := RedisGraphStoreV2{gated: true, pool: newPool("secondary", func() (redis.Conn, error) {
+		return dialRedis(config.Cfg.SecondaryRedisHost, config.Cfg.SecondaryRedisPort,
+			config.Cfg.SecondaryRedisSSL == "true", config.Cfg.SecondaryRedisPassword)
+	})}
+	logger.Infof("Dual write enabled. Secondary datastore: %s:%s, reading from: %s",
+		config.Cfg.SecondaryRedisHost, config.Cfg.SecondaryRedisPort, config.Cfg.DualWritePrimary)
+
+	if config.Cfg.DualWritePrimary == "secondary" {
+		return DualWriteStore{Primary: secondary, Secondary: RedisGraphStoreV2{gated: true}}
+	}
+	return DualWriteStore{Primary: RedisGraphStoreV2{gated: true}, Secondary: secondary}
+}
+
+// Runs reads against the primary only. Writes, marked with WithWrite, run against both datastores, errors from the
+// secondary are logged but don't fail the write because the primary is the source of truth. A write the primary failed
+// isn't sent to the secondary, so the datastores don't diverge.
+// The read-only mode, write budget, compaction and lane gates apply once to both datastores, whichever is primary.
+func (s DualWriteStore) Query(ctx context.Context, q string) (*rg2.QueryResult, error) {
+	graph := GRAPH_NAME
+	if ctxGraph := graphFromContext(ctx); ctxGraph != "" {
+		graph = ctxGraph
+	}
+	releaseWrite, err := acquireWriteGates(ctx, q, graph)
+	if err != nil {
+		return &rg2.QueryResult{}, err
+	}
+	defer releaseWrite()
+	releaseLane, err := acquireLane(ctx)
+	if err != nil {
+		logger.Warning("Query canceled while waiting for a connection in the ", LaneFromContext(ctx), " lane: ", err)
+		return &rg2.QueryResult{}, err
+	}
+	defer releaseLane()
+
+	result, err := s.Primary.Query(ctx, q)
+	if err != nil && isWriteContext(ctx) {
+		logger.Warning("Skipped the dual write to the secondary datastore, the primary write failed: ", err)
+	} else if isWriteContext(ctx) {
+		if _, secondaryErr := s.Secondary.Query(ctx, q); secondaryErr != nil {
+			logger.Warning("Dual write to the secondary datastore failed: ", secondaryErr)
+			logger.V(4).Info("Failed secondary query: ", q)
+		}
+	}
+	return result, err
+}
+
+// StoreDifference is a count that doesn't match between the primary and secondary datastores.
+type StoreDifference struct {
+	Cluster        string
+	Kind           string // Node kind, or edge type for edge differences.
+	PrimaryCount   int
+	SecondaryCount int
+}
+
+// StoreComparison is the report of comparing the primary and secondary datastores.
+type StoreComparison struct {
+	InSync          bool
+	NodeDifferences []StoreDifference
+	EdgeDifferences []StoreDifference
+}
+
+// Compares the node counts by cluster and kind, and edge counts by cluster and type in both datastores.
+func CompareDualWriteStores(ctx context.Context) (StoreComparison, error) {
+	dualStore, ok := Store.(DualWriteStore)
+	if !ok {
+		return StoreComparison{}, errors.New("dual write is not enabled")
+	}
+	report := StoreComparison{}
+	queries := []struct {
+		query       string
+		differences *[]StoreDifference
+	}{
+		{"MATCH (n) RETURN n.cluster, n.kind, count(n)", &report.NodeDifferences},
+		{"MATCH (s)-[e]->() RETURN s.cluster, type(e), count(e)", &report.EdgeDifferences},
+	}
+	for _, q := range queries {
+		primaryCounts, err := countsByClusterAndKind(ctx, dualStore.Primary, q.query)
+		if err != nil {
+			return report, err
+		}
+		secondaryCounts, err := countsByClusterAndKind(ctx, dualStore.Secondary, q.query)
+		if err != nil {
+			return report, err
+		}
+		*q.differences = diffCounts(primaryCounts, secondaryCounts)
+	}
+	report.InSync = len(report.NodeDifferences) == 0 && len(report.EdgeDifferences) == 0
+	return report, nil
+}
+
+type clusterKind struct {
+	cluster, kind string
+}
+
+// Runs a query returning (cluster, kind, count) and loads the results into a map.
+func countsByClusterAndKind(ctx context.Context, store DBStore, query string) (map[clusterKind]int, error) {
+	result, err := store.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[clusterKind]int)
+	for result.Next() {
+		record := result.Record()
+		key := clusterKind{cluster: recordString(record.GetByIndex(0)), kind: recordString(record.GetByIndex(1))}
+		if count, ok := record.GetByIndex(2).(int); ok {
+			counts[key] = count
+		}
+	}
+	return counts, nil
+}
+
+func diffCounts(primary, secondary map[clusterKind]int) []StoreDifference {
+	differences := []StoreDifference{}
+	for key, count := range primary {
+		if secondary[key] != count {
+			differences = append(differences, StoreDifference{key.cluster, key.kind, count, secondary[key]})
+		}
+	}
+	for key, count := range secondary {
+		if _, exists := primary[key]; !exists {
+			differences = append(differences, StoreDifference{key.cluster, key.kind, 0, count})
+		}
+	}
+	sort.Slice(differences, func(i, j int) bool {
+		if differences[i].Cluster != differences[j].Cluster {
+			return differences[i].Cluster < differences[j].Cluster
+		}
+		return differences[i].Kind < differences[j].Kind
+	})
+	return differences
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestDualWriteStore_Query(t *testing.T) {
+	primaryQueries, secondaryQueries := []string{}, []string{}
+	store := DualWriteStore{Primary: recordingStore{&primaryQueries}, Secondary: recordingStore{&secondaryQueries}}
+	ctx := context.Background()
+	_, err := store.Query(ctx, "MATCH (n {name:'set-pod'}) RETURN n")
+	assert.NoError(t, err)
+	_, err = store.Query(WithWrite(ctx), "MATCH (n {name:'pod'}) SET n.restarts = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(primaryQueries))
+	assert.Equal(t, []string{"MATCH (n {name:'pod'}) SET n.restarts = 1"}, secondaryQueries, "Only the write")
+
+	// A write that failed on the primary isn't sent to the secondary.
+	failing := DualWriteStore{Primary: failingStore{}, Secondary: recordingStore{&secondaryQueries}}
+	_, err = failing.Query(WithWrite(ctx), "MATCH (n {name:'bad'}) SET n.restarts = 2")
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(secondaryQueries))
+
+	// The gates apply to both datastores.
+	SetReadOnly(true, "", time.Now())
+	defer SetReadOnly(false, "", time.Now())
+	_, err = store.Query(WithWrite(ctx), "MATCH (n {name:'pod'}) DELETE n")
+	assert.Equal(t, ErrReadOnly, err)
+	_, err = store.Query(ctx, "MATCH (n {name:'pod'}) RETURN n")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(primaryQueries))
+	assert.Equal(t, 1, len(secondaryQueries))
+}
+
+func Test_diffCounts(t *testing.T) {
+	primary := map[clusterKind]int{{"c1", "pod"}: 10, {"c1", "node"}: 2}
+	secondary := map[clusterKind]int{{"c1", "pod"}: 8, {"c1", "node"}: 2, {"c2", "pod"}: 1}
+
+	result := diffCounts(primary, secondary)
+	assert.Equal(t, []StoreDifference{{"c1", "pod", 10, 8}, {"c2", "pod", 0, 1}}, result)
+}
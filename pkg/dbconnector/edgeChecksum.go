@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Returns the edge without its kinds, to compare the edges sent by a collector with the stored ones.
+func EdgeKey(e Edge) Edge {
+	return Edge{SourceUID: e.SourceUID, EdgeType: e.EdgeType, DestUID: e.DestUID}
+}
+
+// Returns the checksum of the edges of a cluster, the SHA-256 of one "sourceUID edgeType destUID" line per edge,
+// sorted, hex encoded. The duplicated edges count once and the kinds aren't included, so a collector can compute it
+// for its own edges.
+func EdgeChecksum(edges []Edge) string {
+	lines := make([]string, 0, len(edges))
+	seen := make(map[Edge]bool, len(edges))
+	for _, e := range edges {
+		if key := EdgeKey(e); !seen[key] {
+			seen[key] = true
+			lines = append(lines, fmt.Sprintf("%s %s %s\n", e.SourceUID, e.EdgeType, e.DestUID))
+		}
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the stored edges of the cluster a resync replaces, the ones between resources of the cluster without the
+// intercluster edges, without duplicates. The edges of the resources waiting for the lazy deleter aren't included,
+// they're gone once it deletes them. The ownedBy edges the aggregator built from the owner chain of their source
+// are also returned in owned.
+func ClusterEdges(ctx context.Context, clusterName string) (edges []Edge, owned map[Edge]bool, err error) {
+	if err := ValidateClusterName(clusterName); err != nil {
+		return nil, nil, err
+	}
+	result, err := Store.Query(ctx, SanitizeQuery("MATCH (s {cluster:'%[1]s'})-[r]->(d {cluster:'%[1]s'}) "+
+		"WHERE (r._interCluster <> true) OR (r._interCluster IS NULL) RETURN s._uid, type(r), d._uid, s.%[2]s",
+		clusterName, OWNER_DEPTH_PROPERTY))
+	if err != nil {
+		return nil, nil, err
+	}
+	pending := pendingDeletesOf(clusterName)
+	seen := make(map[Edge]bool)
+	owned = make(map[Edge]bool)
+	for result.Next() {
+		record := result.Record()
+		e := Edge{SourceUID: recordString(record.GetByIndex(0)), EdgeType: recordString(record.GetByIndex(1)),
+			DestUID: recordString(record.GetByIndex(2))}
+		_, sourcePending := pending[e.SourceUID]
+		_, destPending := pending[e.DestUID]
+		if seen[e] || sourcePending || destPending {
+			continue
+		}
+		seen[e] = true
+		edges = append(edges, e)
+		if e.EdgeType == OWNED_BY_EDGE && record.GetByIndex(3) != nil {
+			owned[e] = true
+		}
+	}
+	return edges, owned, nil
+}
+
+// Returns the checksum of the stored edges of the cluster, see ClusterEdges and EdgeChecksum.
+func ClusterEdgeChecksum(ctx context.Context, clusterName string) (string, int, error) {
+	edges, _, err := ClusterEdges(ctx, clusterName)
+	if err != nil {
+		return "", 0, err
+	}
+	return EdgeChecksum(edges), len(edges), nil
+}
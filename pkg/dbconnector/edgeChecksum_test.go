@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EdgeChecksum(t *testing.T) {
+	edges := []Edge{
+		{SourceUID: "c1/p", EdgeType: "ownedBy", DestUID: "c1/r", SourceKind: "Pod", DestKind: "ReplicaSet"},
+		{SourceUID: "c1/p", EdgeType: "usedBy", DestUID: "c1/s"},
+	}
+	checksum := EdgeChecksum(edges)
+	assert.Len(t, checksum, 64)
+	reordered := []Edge{{SourceUID: "c1/p", EdgeType: "usedBy", DestUID: "c1/s"},
+		{SourceUID: "c1/p", EdgeType: "ownedBy", DestUID: "c1/r"}, {SourceUID: "c1/p", EdgeType: "usedBy", DestUID: "c1/s"}}
+	assert.Equal(t, checksum, EdgeChecksum(reordered), "The order, duplicates and kinds don't change the checksum.")
+	assert.NotEqual(t, checksum, EdgeChecksum(edges[:1]))
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", EdgeChecksum(nil),
+		"The checksum of no edges is the SHA-256 of nothing.")
+}
+
+func Test_ClusterEdges(t *testing.T) {
+	useTestDatastore(t)
+	_, err := Store.Query(context.Background(), "CREATE (r:ReplicaSet {_uid:'c1/r', cluster:'c1'}), "+
+		"(p:Pod {_uid:'c1/p', cluster:'c1', _ownerDepth:1})-[:ownedBy]->(r), (p)-[:usedBy]->(r), (p)-[:usedBy]->(r), "+
+		"(q:Pod {_uid:'c1/q', cluster:'c1'})-[:ownedBy]->(r), (g:Pod {_uid:'c1/g', cluster:'c1'})-[:usedBy]->(r), "+
+		"(p)-[:deployedBy {_interCluster:true}]->(r), (p)-[:usedBy]->(:Node {_uid:'c2/n', cluster:'c2'})")
+	assert.NoError(t, err)
+	QueueDeletes("c1", []string{"c1/g"})
+	defer DropPendingDeletes("c1")
+
+	edges, owned, err := ClusterEdges(context.Background(), "c1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Edge{{SourceUID: "c1/p", EdgeType: "ownedBy", DestUID: "c1/r"},
+		{SourceUID: "c1/p", EdgeType: "usedBy", DestUID: "c1/r"}, {SourceUID: "c1/q", EdgeType: "ownedBy", DestUID: "c1/r"}},
+		edges, "Without duplicates, intercluster edges, edges to other clusters and edges of pending deletes.")
+	assert.Equal(t, map[Edge]bool{{SourceUID: "c1/p", EdgeType: "ownedBy", DestUID: "c1/r"}: true}, owned,
+		"Only the ownedBy edges of a resource sent with an owner chain are built by the aggregator.")
+
+	checksum, count, err := ClusterEdgeChecksum(context.Background(), "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, EdgeChecksum(edges), checksum)
+
+	_, _, err = ClusterEdges(context.Background(), "c1'")
+	assert.Error(t, err)
+}
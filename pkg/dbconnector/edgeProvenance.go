@@ -0,0 +1,50 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"fmt"
+	"os"
+)
+
+// Rule that matched the resources of each type of intercluster edge, stored in the _rule property of the edge.
+var interClusterEdgeRules = map[string]string{
+	"hostedSub":          "hosting-subscription", // _hostingSubscription of the remote subscription.
+	PolicyPropagatedEdge: "replica-name",         // <root namespace>.<root name> of the replicas.
+	PolicyViolatedEdge:   "replica-compliance",   // NonCompliant replicas.
+	PolicyReplicaEdge:    "replica-name",
+	BindingPolicyEdge:    "binding-subjects",
+	BindingPlacementEdge: "binding-placement-ref",
+	PlacementClusterEdge: "placement-decisions",
+}
+
+// Aggregator replica building the intercluster edges, stored in the _createdBy property of the edges.
+var edgeBuilder = func() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "search-aggregator"
+	}
+	return hostname
+}()
+
+// Where an intercluster edge comes from, to trace a wrong edge back to the rule that created it.
+type EdgeProvenance struct {
+	CreatedBy string `json:"createdBy,omitempty"` // Aggregator replica that built the edge.
+	Rule      string `json:"rule,omitempty"`      // Rule that matched the source and the destination.
+	SourceHub string `json:"sourceHub,omitempty"` // Hub cluster of the resource the rule matched on the hub.
+}
+
+// Returns the properties of an intercluster edge of the type built by the instance, for a CREATE.
+// e.g. {_interCluster: true, app_instance: 2, _createdBy: 'search-aggregator-1', _rule: 'hosting-subscription',
+// _sourceHub: 'local-cluster', _weight: 0.9}
+// The _weight is only set when EDGE_WEIGHTS has one for the rule.
+func InterClusterEdgeProperties(edgeType string, instance int) string {
+	rule := interClusterEdgeRules[edgeType]
+	weight := ""
+	if w, ok := EdgeWeight(rule); ok {
+		weight = fmt.Sprintf(", _weight: %g", w)
+	}
+	return SanitizeQuery("{_interCluster: true, app_instance: %d, _createdBy: '%s', _rule: '%s', _sourceHub: '%s'",
+		instance, edgeBuilder, rule, hubClusterName) + weight + "}"
+}
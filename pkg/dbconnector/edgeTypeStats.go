@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Edges deleted by each query of PruneEdges.
+const pruneEdgesBatchSize = 1000
+
+// Returned when the edges of the inCluster type are pruned, every resource must keep its edge to its Cluster node.
+var ErrPruneInCluster = fmt.Errorf("the %s edges link the resources to their cluster and can't be pruned",
+	IN_CLUSTER_EDGE)
+
+// Edges of a type from the resources of a cluster.
+type EdgeTypeCount struct {
+	Type    string `json:"type"`
+	Cluster string `json:"cluster"` // Cluster of the source, empty for the nodes without one, e.g. the Cluster nodes.
+	Count   int    `json:"count"`
+}
+
+// Returns the condition on the edges from the source s or to the destination d of the edge type and cluster.
+func pruneEdgesCondition(edgeType, clusterName string) string {
+	condition := SanitizeQuery("type(e) = '%s'", edgeType)
+	if clusterName != "" {
+		condition += SanitizeQuery(" AND (s.cluster = '%[1]s' OR d.cluster = '%[1]s')", clusterName)
+	}
+	return condition
+}
+
+// Returns the count of the edges of each type by the cluster of their source, for the cluster only when it's set.
+// Sorted by type, then cluster.
+func EdgeTypeStats(ctx context.Context, clusterName string) ([]EdgeTypeCount, error) {
+	query := "MATCH (s)-[e]->(d) RETURN type(e), s.cluster, count(e)"
+	if clusterName != "" {
+		if err := ValidateClusterName(clusterName); err != nil {
+			return nil, err
+		}
+		query = SanitizeQuery("MATCH (s)-[e]->(d) WHERE s.cluster = '%s' RETURN type(e), s.cluster, count(e)",
+			clusterName)
+	}
+	result, err := Store.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	counts := []EdgeTypeCount{}
+	for result.Next() {
+		record := result.Record()
+		count, _ := record.GetByIndex(2).(int)
+		counts = append(counts, EdgeTypeCount{Type: recordString(record.GetByIndex(0)),
+			Cluster: recordString(record.GetByIndex(1)), Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Type != counts[j].Type {
+			return counts[i].Type < counts[j].Type
+		}
+		return counts[i].Cluster < counts[j].Cluster
+	})
+	return counts, nil
+}
+
+// Returns the count of the edges PruneEdges would delete.
+func CountPrunedEdges(ctx context.Context, edgeType, clusterName string) (int, error) {
+	if edgeType == IN_CLUSTER_EDGE {
+		return 0, ErrPruneInCluster
+	}
+	return queryCount(ctx, "MATCH (s)-[e]->(d) WHERE "+pruneEdgesCondition(edgeType, clusterName)+" RETURN count(e)")
+}
+
+// Deletes the edges of the type from or to the resources of the cluster, of every cluster when it's empty, in
+// batches of pruneEdgesBatchSize. The nodes are kept. Returns the edges deleted, also when a batch fails.
+func PruneEdges(ctx context.Context, edgeType, clusterName string) (int, error) {
+	if edgeType == IN_CLUSTER_EDGE {
+		return 0, ErrPruneInCluster
+	}
+	if clusterName != "" {
+		if err := ValidateClusterName(clusterName); err != nil {
+			return 0, err
+		}
+	}
+	query := fmt.Sprintf("MATCH (s)-[e]->(d) WHERE %s WITH e LIMIT %d DELETE e",
+		pruneEdgesCondition(edgeType, clusterName), pruneEdgesBatchSize)
+	deleted := 0
+	for {
+		result, err := Store.Query(WithWrite(ctx), query)
+		if err != nil {
+			return deleted, err
+		}
+		batch := result.RelationshipsDeleted()
+		deleted += batch
+		if batch < pruneEdgesBatchSize {
+			if deleted > 0 && clusterName == "" {
+				logger.Infof("Pruned %d %s edges of every cluster.", deleted, edgeType)
+			} else if deleted > 0 {
+				logger.Infof("Pruned %d %s edges of cluster %s.", deleted, edgeType, clusterName)
+			}
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgeTypeStats(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (c:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(r:ReplicaSet {_uid:'c1/r', kind:'replicaset', cluster:'c1'})-[:inCluster]->(c), "+
+		"(p:Pod {_uid:'c1/p', kind:'pod', cluster:'c1'})-[:inCluster]->(c), "+
+		"(q:Pod {_uid:'c1/q', kind:'pod', cluster:'c1'})-[:inCluster]->(c), "+
+		"(p)-[:ownedBy]->(r), (q)-[:ownedBy]->(r), (p)-[:runsOn]->(r), "+
+		"(:Pod {_uid:'c2/p', kind:'pod', cluster:'c2'})-[:runsOn]->(:Node {_uid:'c2/n', kind:'node', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	stats, err := EdgeTypeStats(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []EdgeTypeCount{{Type: "inCluster", Cluster: "c1", Count: 3}, {Type: "ownedBy", Cluster: "c1",
+		Count: 2}, {Type: "runsOn", Cluster: "c1", Count: 1}, {Type: "runsOn", Cluster: "c2", Count: 1}}, stats)
+	stats, err = EdgeTypeStats(ctx, "c2")
+	assert.NoError(t, err)
+	assert.Equal(t, []EdgeTypeCount{{Type: "runsOn", Cluster: "c2", Count: 1}}, stats)
+
+	count, err := CountPrunedEdges(ctx, "runsOn", "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	deleted, err := PruneEdges(ctx, "runsOn", "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	count, err = CountPrunedEdges(ctx, "runsOn", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "The edges of the other clusters are kept.")
+	deleted, err = PruneEdges(ctx, "runsOn", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	nodes, err := queryCount(ctx, "MATCH (n) RETURN count(n)")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, nodes, "The nodes are kept.")
+
+	_, err = PruneEdges(ctx, IN_CLUSTER_EDGE, "")
+	assert.Equal(t, ErrPruneInCluster, err)
+	_, err = PruneEdges(ctx, "ownedBy", "invalid/cluster")
+	assert.Error(t, err)
+}
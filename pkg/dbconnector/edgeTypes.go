@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"fmt"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Directions an edge is followed in from a resource.
+const (
+	EDGE_OUTGOING = "outgoing" // The edge points from the resource to the related one.
+	EDGE_INCOMING = "incoming" // The edge points from the related resource to the resource.
+	EDGE_BOTH     = "both"     // A bidirectional edge, stored in one direction.
+)
+
+// Tells whether the edge type is logically bidirectional, e.g. attachedTo, from BIDIRECTIONAL_EDGE_TYPES.
+// Edges are stored in the direction the collector sent them, so queries on a bidirectional type must match both.
+func IsBidirectional(edgeType string) bool {
+	for _, bidirectional := range config.ParseList(config.Cfg.BidirectionalEdgeTypes) {
+		if bidirectional == edgeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the edge types of the list to follow against the stored direction. Every type is followed both ways
+// when the list is empty, so only the bidirectional ones are kept.
+func bidirectionalEdgeTypes(edgeTypes []string) []string {
+	if len(edgeTypes) == 0 {
+		edgeTypes = config.ParseList(config.Cfg.BidirectionalEdgeTypes)
+	}
+	bidirectional := []string{}
+	for _, edgeType := range edgeTypes {
+		if IsBidirectional(edgeType) {
+			bidirectional = append(bidirectional, edgeType)
+		}
+	}
+	return bidirectional
+}
+
+// Returns the pattern of an edge from one node to another in the direction, e.g. (n)-[e]->(m) for outgoing.
+func EdgePattern(from, edge, to, direction string) string {
+	if direction == EDGE_INCOMING {
+		return fmt.Sprintf("(%s)<-[%s]-(%s)", from, edge, to)
+	}
+	return fmt.Sprintf("(%s)-[%s]->(%s)", from, edge, to)
+}
+
+// Returns the condition on the type of the edge matched in the direction, for a query following the edge types
+// in the followed direction, or EDGE_BOTH. Every type but inCluster is followed when edgeTypes is empty.
+// Against the followed direction only the bidirectional types are matched, false when there are none.
+func EdgeTypeCondition(edge string, edgeTypes []string, direction, followed string) (string, bool) {
+	if followed != EDGE_BOTH && followed != direction {
+		edgeTypes = bidirectionalEdgeTypes(edgeTypes)
+		if len(edgeTypes) == 0 {
+			return "", false
+		}
+	}
+	if len(edgeTypes) == 0 {
+		return fmt.Sprintf("type(%s) <> '%s'", edge, IN_CLUSTER_EDGE), true
+	}
+	return fmt.Sprintf("type(%s) IN %s", edge, quotedList(edgeTypes)), true
+}
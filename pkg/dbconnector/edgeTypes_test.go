@@ -0,0 +1,33 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgeTypeCondition(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.BidirectionalEdgeTypes = "attachedTo,usedBy"
+
+	condition, ok := EdgeTypeCondition("e", nil, EDGE_INCOMING, EDGE_BOTH)
+	assert.True(t, ok)
+	assert.Equal(t, "type(e) <> 'inCluster'", condition)
+
+	condition, ok = EdgeTypeCondition("e", nil, EDGE_INCOMING, EDGE_OUTGOING)
+	assert.True(t, ok)
+	assert.Equal(t, "type(e) IN ['attachedTo', 'usedBy']", condition)
+
+	condition, ok = EdgeTypeCondition("e", []string{"ownedBy", "usedBy"}, EDGE_INCOMING, EDGE_OUTGOING)
+	assert.True(t, ok)
+	assert.Equal(t, "type(e) IN ['usedBy']", condition)
+
+	_, ok = EdgeTypeCondition("e", []string{"ownedBy"}, EDGE_INCOMING, EDGE_OUTGOING)
+	assert.False(t, ok, "No edge type is followed against the direction.")
+
+	assert.Equal(t, "(n)<-[e]-(m)", EdgePattern("n", "e", "m", EDGE_INCOMING))
+}
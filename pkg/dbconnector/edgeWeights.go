@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+var (
+	edgeWeightsConfig string
+	edgeWeights       map[string]float64
+	edgeWeightsMutex  = sync.Mutex{}
+)
+
+// Parses the JSON object of EDGE_WEIGHTS, from the rule of the intercluster edges to their weight between 0 and 1,
+// e.g. {"replica-name": 0.8, "hosting-subscription": 0.9}
+// Invalid weights and unknown rules are logged and skipped.
+func parseEdgeWeights(value string) map[string]float64 {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var parsed map[string]float64
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		logger.Error("Error parsing EDGE_WEIGHTS, the edges are stored without a weight: ", err)
+		return nil
+	}
+	rules := map[string]bool{}
+	for _, rule := range interClusterEdgeRules {
+		rules[rule] = true
+	}
+	valid := make(map[string]float64, len(parsed))
+	for rule, weight := range parsed {
+		if !rules[rule] {
+			logger.Errorf("Skipping the weight of unknown rule %s from EDGE_WEIGHTS", rule)
+			continue
+		}
+		if weight < 0 || weight > 1 {
+			logger.Errorf("Skipping the weight %g of rule %s from EDGE_WEIGHTS, it must be between 0 and 1.",
+				weight, rule)
+			continue
+		}
+		valid[rule] = weight
+	}
+	return valid
+}
+
+// Returns the weight of the intercluster edges built by the rule, false when EDGE_WEIGHTS has none for it.
+func EdgeWeight(rule string) (float64, bool) {
+	edgeWeightsMutex.Lock()
+	defer edgeWeightsMutex.Unlock()
+	if edgeWeightsConfig != config.Cfg.EdgeWeights {
+		edgeWeightsConfig = config.Cfg.EdgeWeights
+		edgeWeights = parseEdgeWeights(edgeWeightsConfig)
+	}
+	weight, ok := edgeWeights[rule]
+	return weight, ok
+}
+
+// Returns the condition on the edge variable matching the edges weighted at least minWeight, e.g.
+// (e._weight IS NULL OR e._weight >= 0.5)
+// The edges without a weight are certain, they always match.
+func edgeWeightCondition(variable string, minWeight float64) string {
+	return fmt.Sprintf("(%[1]s._weight IS NULL OR %[1]s._weight >= %[2]g)", variable, minWeight)
+}
+
+// Returns the weight of an edge read from a query, nil when it has none.
+func recordWeight(value interface{}) *float64 {
+	switch v := value.(type) {
+	case float64:
+		return &v
+	case int64:
+		weight := float64(v)
+		return &weight
+	case int:
+		weight := float64(v)
+		return &weight
+	}
+	return nil
+}
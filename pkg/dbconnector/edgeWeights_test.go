@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseEdgeWeights(t *testing.T) {
+	weights := parseEdgeWeights(`{"replica-name": 0.8, "placement-decisions": 1, "unknown-rule": 0.5,
+		"hosting-subscription": 1.5}`)
+	assert.Equal(t, map[string]float64{"replica-name": 0.8, "placement-decisions": 1}, weights)
+	assert.Nil(t, parseEdgeWeights("not json"))
+	assert.Nil(t, parseEdgeWeights(""))
+}
+
+func TestInterClusterEdgeProperties_weight(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.EdgeWeights = `{"replica-name": 0.8}`
+
+	assert.Contains(t, InterClusterEdgeProperties(PolicyReplicaEdge, 1), "_rule: 'replica-name'")
+	assert.Contains(t, InterClusterEdgeProperties(PolicyReplicaEdge, 1), ", _weight: 0.8}")
+	assert.NotContains(t, InterClusterEdgeProperties("hostedSub", 1), "_weight")
+}
+
+func TestEdgeWeights(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	// A root policy with a certain replica, and one matched only by its name.
+	_, err := Store.Query(ctx, "CREATE (p:Policy {_uid:'local-cluster/p', kind:'policy', name:'p', "+
+		"cluster:'local-cluster'}), "+
+		"(p)-[:replicatedAs {_interCluster:true, _rule:'replica-name', _weight:0.6}]->"+
+		"(:Policy {_uid:'c1/p', kind:'policy', name:'ns.p', cluster:'c1'}), "+
+		"(p)-[:replicatedAs {_interCluster:true, _rule:'replica-name'}]->"+
+		"(:Policy {_uid:'c2/p', kind:'policy', name:'ns.p', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	result, err := Edges(ctx, EdgeOptions{})
+	assert.NoError(t, err)
+	weights := map[string]*float64{}
+	for _, edge := range result.Items {
+		weights[edge.Dest.UID] = edge.Weight
+	}
+	if assert.NotNil(t, weights["c1/p"]) {
+		assert.Equal(t, 0.6, *weights["c1/p"])
+	}
+	assert.Nil(t, weights["c2/p"])
+
+	result, err = Edges(ctx, EdgeOptions{MinWeight: 0.9})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Items, 1, "The edges without a weight are certain.") {
+		assert.Equal(t, "c2/p", result.Items[0].Dest.UID)
+	}
+
+	related, err := RelatedResources(ctx, "local-cluster/p", RelatedOptions{Depth: 1})
+	assert.NoError(t, err)
+	assert.Len(t, related.Items, 2)
+	for _, item := range related.Items {
+		if item.UID == "c1/p" && assert.NotNil(t, item.Weight) {
+			assert.Equal(t, 0.6, *item.Weight)
+		}
+	}
+	related, err = RelatedResources(ctx, "local-cluster/p", RelatedOptions{Depth: 1, MinWeight: 0.5})
+	assert.NoError(t, err)
+	assert.Len(t, related.Items, 2)
+	related, err = RelatedResources(ctx, "local-cluster/p", RelatedOptions{Depth: 1, MinWeight: 0.7})
+	assert.NoError(t, err)
+	if assert.Len(t, related.Items, 1) {
+		assert.Equal(t, "c2/p", related.Items[0].UID)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Filters the edges returned by Edges.
+type EdgeOptions struct {
+	Cluster   string   // Edges from or to a resource of the cluster, all clusters when empty.
+	EdgeTypes []string // Edge types returned, every type but inCluster when empty.
+	// Only the intercluster edges when true, only the edges within a cluster when false, both when nil.
+	InterCluster *bool
+	// Min weight of the edges returned, from 0 to 1. The edges without a weight are always returned.
+	MinWeight float64
+	Limit     int // Max number of edges returned, no limit when 0.
+	// Resources the user can see, nil for every resource. Edges are returned when the user can see both ends.
+	Access *ResourceAccess
+}
+
+// Summary of a node at one end of an edge.
+type EdgeEndpoint struct {
+	UID       string `json:"uid"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Cluster   string `json:"cluster,omitempty"` // Empty for the Cluster nodes.
+}
+
+// An edge of the graph, as stored, from the source to the destination.
+type GraphEdge struct {
+	Type         string       `json:"type"`
+	InterCluster bool         `json:"interCluster"`
+	Source       EdgeEndpoint `json:"source"`
+	Dest         EdgeEndpoint `json:"dest"`
+	// Only for the intercluster edges built with their provenance.
+	Provenance *EdgeProvenance `json:"provenance,omitempty"`
+	// Confidence in the edge from 0 to 1, only for the intercluster edges of a rule with a weight in EDGE_WEIGHTS.
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// Edges matching the options, and whether there were more than the limit.
+type EdgesResult struct {
+	Items     []GraphEdge `json:"items"`
+	Truncated bool        `json:"truncated"`
+}
+
+// Returns the query for Edges, e.g. MATCH (s)-[e]->(d) WHERE (s.cluster = 'c1' OR d.cluster = 'c1') AND
+// type(e) IN ['ownedBy'] RETURN s._uid, s.kind, s.name, s.namespace, s.cluster, type(e), e._interCluster, d._uid, ...
+// e._createdBy, e._rule, e._sourceHub, e._weight
+func edgesQuery(opts EdgeOptions) string {
+	condition, _ := EdgeTypeCondition("e", opts.EdgeTypes, EDGE_OUTGOING, EDGE_OUTGOING)
+	conditions := []string{condition}
+	if opts.Cluster != "" {
+		// The Cluster node doesn't have the cluster property, its inCluster edges are matched by name.
+		conditions = append(conditions, SanitizeQuery("(s.cluster = '%[1]s' OR d.cluster = '%[1]s' OR "+
+			"(d.kind = 'cluster' AND d.name = '%[1]s'))", opts.Cluster))
+	}
+	if opts.InterCluster != nil {
+		if *opts.InterCluster {
+			conditions = append(conditions, "e._interCluster = true")
+		} else {
+			conditions = append(conditions, "(e._interCluster IS NULL OR e._interCluster <> true)")
+		}
+	}
+	if opts.MinWeight > 0 {
+		conditions = append(conditions, edgeWeightCondition("e", opts.MinWeight))
+	}
+	if opts.Access != nil {
+		for _, variable := range []string{"s", "d"} {
+			if condition := opts.Access.Condition(variable); condition != "" {
+				conditions = append(conditions, condition)
+			}
+		}
+	}
+	return fmt.Sprintf("MATCH (s)-[e]->(d) WHERE %s RETURN s._uid, s.kind, s.name, s.namespace, s.cluster, "+
+		"type(e), e._interCluster, d._uid, d.kind, d.name, d.namespace, d.cluster, e._createdBy, e._rule, "+
+		"e._sourceHub, e._weight", strings.Join(conditions, " AND "))
+}
+
+// Returns the edges matching the options, with a summary of the nodes they connect.
+func Edges(ctx context.Context, opts EdgeOptions) (EdgesResult, error) {
+	result := EdgesResult{Items: []GraphEdge{}}
+	if opts.Cluster != "" {
+		if err := ValidateClusterName(opts.Cluster); err != nil {
+			return result, err
+		}
+	}
+	for _, edgeType := range opts.EdgeTypes {
+		if !searchPropertyRegex.MatchString(edgeType) {
+			return result, fmt.Errorf("%w: %s", ErrInvalidEdgeType, edgeType)
+		}
+	}
+	limit := 0
+	if opts.Limit > 0 {
+		limit = opts.Limit + 1 // One more to know if the result was truncated.
+	}
+	found, err := SearchQuery(ctx, edgesQuery(opts), limit)
+	if err != nil {
+		return result, err
+	}
+	endpoint := func(values []interface{}) EdgeEndpoint {
+		return EdgeEndpoint{UID: recordString(values[0]), Kind: recordString(values[1]),
+			Name: recordString(values[2]), Namespace: recordString(values[3]), Cluster: recordString(values[4])}
+	}
+	for found.Next() {
+		if opts.Limit > 0 && len(result.Items) == opts.Limit {
+			result.Truncated = true
+			break
+		}
+		values := found.Record().Values()
+		interCluster, _ := values[6].(bool)
+		edge := GraphEdge{
+			Type:         recordString(values[5]),
+			InterCluster: interCluster,
+			Source:       endpoint(values[0:5]),
+			Dest:         endpoint(values[7:12]),
+			Weight:       recordWeight(values[15]),
+		}
+		provenance := EdgeProvenance{CreatedBy: recordString(values[12]), Rule: recordString(values[13]),
+			SourceHub: recordString(values[14])}
+		if provenance != (EdgeProvenance{}) {
+			edge.Provenance = &provenance
+		}
+		result.Items = append(result.Items, edge)
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdges(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	// A pod owned by a replicaset in c1, and a subscription of c2 hosted by one on the hub.
+	_, err := Store.Query(ctx, "CREATE (c:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(r:ReplicaSet {_uid:'c1/r', kind:'replicaset', name:'web', namespace:'app', cluster:'c1'})-[:inCluster]->(c), "+
+		"(p:Pod {_uid:'c1/p', kind:'pod', name:'web-1', namespace:'app', cluster:'c1'})-[:inCluster]->(c), "+
+		"(p)-[:ownedBy]->(r), "+
+		"(:Subscription {_uid:'c2/s', kind:'subscription', name:'s', cluster:'c2'})-[:hostedSub {_interCluster:true, "+
+		"_createdBy:'aggregator-0', _rule:'hosting-subscription', _sourceHub:'local-cluster'}]->"+
+		"(:Subscription {_uid:'local-cluster/s', kind:'subscription', name:'s', cluster:'local-cluster'})")
+	assert.NoError(t, err)
+
+	result, err := Edges(ctx, EdgeOptions{Cluster: "c1"})
+	assert.NoError(t, err)
+	assert.Equal(t, EdgesResult{Items: []GraphEdge{{
+		Type:   "ownedBy",
+		Source: EdgeEndpoint{UID: "c1/p", Kind: "pod", Name: "web-1", Namespace: "app", Cluster: "c1"},
+		Dest:   EdgeEndpoint{UID: "c1/r", Kind: "replicaset", Name: "web", Namespace: "app", Cluster: "c1"},
+	}}}, result, "inCluster edges aren't returned by default")
+
+	result, err = Edges(ctx, EdgeOptions{Cluster: "c1", EdgeTypes: []string{"inCluster"}, Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Items))
+	assert.True(t, result.Truncated)
+	assert.Equal(t, "cluster__c1", result.Items[0].Dest.UID)
+
+	interCluster := true
+	result, err = Edges(ctx, EdgeOptions{InterCluster: &interCluster})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(result.Items)) {
+		assert.Equal(t, "hostedSub", result.Items[0].Type)
+		assert.True(t, result.Items[0].InterCluster)
+		assert.Equal(t, &EdgeProvenance{CreatedBy: "aggregator-0", Rule: "hosting-subscription",
+			SourceHub: "local-cluster"}, result.Items[0].Provenance)
+	}
+	interCluster = false
+	result, err = Edges(ctx, EdgeOptions{InterCluster: &interCluster})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Items))
+
+	// Only the edges with both ends visible to the user.
+	result, err = Edges(ctx, EdgeOptions{Access: &ResourceAccess{Clusters: []string{"c2"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(result.Items))
+
+	_, err = Edges(ctx, EdgeOptions{EdgeTypes: []string{"owned By"}})
+	assert.ErrorIs(t, err, ErrInvalidEdgeType)
+}
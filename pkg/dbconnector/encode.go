@@ -39,7 +39,7 @@ func (r Resource) EncodeProperties() (map[string]interface{}, error) {
 		// Get all the rg props for this property.
 		partial, err := encodeProperty(k, v)
 		if err != nil { // if anything went wrong just log a warning and skip it
-			// glog.Warning("Skipping property ", k, " on resource ", r.UID, ": ", err)
+			// logger.Warning("Skipping property ", k, " on resource ", r.UID, ": ", err)
 			continue
 		}
 
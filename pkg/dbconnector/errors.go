@@ -0,0 +1,127 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Classes of the errors of graph operations, test them with errors.Is.
+var (
+	// The operation may succeed if it's retried later, e.g. the redis connection died or the request timed out.
+	ErrRetryable = errors.New("retryable")
+	// Retrying the operation gives the same error, e.g. the query for a resource is invalid.
+	ErrPermanent = errors.New("permanent")
+)
+
+// Error of a whole batch of a chunked operation, e.g. the redis connection died. The results of the items in the
+// batch are unknown.
+type BatchError struct {
+	Op        string // insert, update, delete, insert edge or delete edge
+	Err       error
+	Retryable bool
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Op, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BatchError) Is(target error) bool {
+	return (target == ErrRetryable && e.Retryable) || (target == ErrPermanent && !e.Retryable)
+}
+
+// Error of a single resource, or edge, of a chunked operation. The other items of the batch aren't affected.
+// The message is the one of the underlying error, as it's reported to the collector for the resource.
+type ResourceError struct {
+	Op        string
+	UID       string
+	Err       error
+	Retryable bool
+}
+
+func (e *ResourceError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ResourceError) Is(target error) bool {
+	return (target == ErrRetryable && e.Retryable) || (target == ErrPermanent && !e.Retryable)
+}
+
+// Error of the items of a chunked operation that failed, returned by ChunkedOperationResult.Err when the batch
+// itself succeeded. It's retryable when any of the items is retryable.
+type PartialError struct {
+	Op     string
+	Errors map[string]error // *ResourceError keyed by UID
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%s failed for %d resources", e.Op, len(e.Errors))
+}
+
+func (e *PartialError) Is(target error) bool {
+	retryable := false
+	for _, err := range e.Errors {
+		retryable = retryable || IsRetryable(err)
+	}
+	return (target == ErrRetryable && retryable) || (target == ErrPermanent && !retryable)
+}
+
+// Returns the error of the result: the BatchError, a PartialError when some items failed, or nil.
+func (r ChunkedOperationResult) Err() error {
+	if r.ConnectionError != nil {
+		return r.ConnectionError
+	}
+	if len(r.ResourceErrors) == 0 {
+		return nil
+	}
+	op := ""
+	for _, err := range r.ResourceErrors {
+		var resourceErr *ResourceError
+		if errors.As(err, &resourceErr) {
+			op = resourceErr.Op
+		}
+		break
+	}
+	return &PartialError{Op: op, Errors: r.ResourceErrors}
+}
+
+// Tells whether the operation that returned the error may succeed if it's retried.
+// Errors that aren't classified are retryable when redis is unreachable, or the request is canceled or timed out.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrRetryable) {
+		return true
+	}
+	if errors.Is(err, ErrPermanent) {
+		return false
+	}
+	var netErr net.Error
+	return IsBadConnection(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, redis.ErrPoolExhausted) || errors.As(err, &netErr)
+}
+
+// Wraps the error of a batch, it's retryable when the request context is done even if the query error isn't.
+func batchError(ctx context.Context, op string, err error) *BatchError {
+	return &BatchError{Op: op, Err: err, Retryable: ctx.Err() != nil || IsRetryable(err)}
+}
+
+// Wraps the error of an item of a batch.
+func resourceError(op string, uid string, err error) *ResourceError {
+	return &ResourceError{Op: op, UID: uid, Err: err, Retryable: IsRetryable(err)}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fails the queries with the resources named bad, and every query once the connection is down.
+type failingStore struct {
+	down bool
+}
+
+func (s failingStore) Query(ctx context.Context, q string) (*rg2.QueryResult, error) {
+	if s.down {
+		return nil, errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+	}
+	if strings.Contains(q, "bad") {
+		return nil, errors.New("Invalid query")
+	}
+	return &rg2.QueryResult{}, nil
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, IsRetryable(nil))
+	assert.True(t, IsRetryable(errors.New("connection refused")))
+	assert.True(t, IsRetryable(fmt.Errorf("query: %w", context.DeadlineExceeded)))
+	assert.False(t, IsRetryable(errors.New("Invalid query")))
+	assert.True(t, IsRetryable(&BatchError{Op: "insert", Err: errors.New("EOF"), Retryable: true}))
+	assert.False(t, IsRetryable(&ResourceError{Op: "insert", UID: "a", Err: errors.New("EOF")}))
+}
+
+func TestChunkedOperationErrors(t *testing.T) {
+	prevStore := Store
+	defer func() { Store = prevStore }()
+	resources := []*Resource{
+		{Kind: "Pod", UID: "good", Properties: map[string]interface{}{"kind": "Pod", "name": "good"}},
+		{Kind: "Pod", UID: "bad", Properties: map[string]interface{}{"kind": "Pod", "name": "bad"}},
+	}
+
+	Store = failingStore{}
+	result := ChunkedUpdate(context.Background(), resources)
+	assert.Equal(t, 1, result.SuccessfulResources)
+	err := result.Err()
+	var partial *PartialError
+	assert.True(t, errors.As(err, &partial))
+	assert.Equal(t, "update", partial.Op)
+	assert.True(t, errors.Is(err, ErrPermanent))
+	var resourceErr *ResourceError
+	assert.True(t, errors.As(result.ResourceErrors["bad"], &resourceErr))
+	assert.Equal(t, "bad", resourceErr.UID)
+	assert.Equal(t, "Invalid query", resourceErr.Error())
+
+	Store = failingStore{down: true}
+	result = ChunkedUpdate(context.Background(), resources)
+	var batchErr *BatchError
+	assert.True(t, errors.As(result.Err(), &batchErr))
+	assert.True(t, IsRetryable(result.Err()))
+	assert.Equal(t, 0, len(result.ResourceErrors))
+
+	result = ChunkedInsertEdge(context.Background(), []Edge{{SourceUID: "a", DestUID: "b", EdgeType: "to"}}, "c1")
+	assert.True(t, errors.As(result.Err(), &batchErr))
+	assert.Equal(t, "insert edge", batchErr.Op)
+
+	assert.Nil(t, ChunkedOperationResult{SuccessfulResources: 1}.Err())
+}
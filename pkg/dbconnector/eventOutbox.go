@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Redis key of the sorted set holding the events waiting to be published to the event sink, scored by sequence.
+const EVENT_OUTBOX_KEY = "search-aggregator:event-outbox"
+
+// Adds the encoded events to the outbox, so they're published after a restart if they weren't before.
+func AddToEventOutbox(ctx context.Context, sequences []int64, entries [][]byte) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	args := redis.Args{EVENT_OUTBOX_KEY}
+	for i, entry := range entries {
+		args = args.Add(strconv.FormatInt(sequences[i], 10), entry)
+	}
+	_, err = conn.Do("ZADD", args...)
+	return err
+}
+
+// Returns the encoded events of the outbox, by sequence.
+func EventOutbox(ctx context.Context) ([][]byte, error) {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return redis.ByteSlices(conn.Do("ZRANGEBYSCORE", EVENT_OUTBOX_KEY, "-inf", "+inf"))
+}
+
+// Removes the events up to the sequence from the outbox, once the event sink acknowledged them.
+func DropFromEventOutbox(ctx context.Context, sequence int64) error {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("ZREMRANGEBYSCORE", EVENT_OUTBOX_KEY, "-inf", strconv.FormatInt(sequence, 10))
+	return err
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// An edge read for an export, with the cluster and kind of the nodes it connects.
+type ExportEdge struct {
+	SourceUID     string
+	SourceKind    string
+	SourceCluster string
+	EdgeType      string
+	DestUID       string
+	DestKind      string
+	DestCluster   string
+}
+
+// Calls visit with the properties of each node, of the cluster or of every cluster when clusterName is empty.
+// The nodes are read in id ranges, so the export doesn't hold the whole graph in memory.
+func ExportNodes(ctx context.Context, clusterName string, visit func(properties map[string]interface{}) error) (
+	int, error) {
+	condition, err := exportCondition(clusterName, "n.cluster = '%s'")
+	if err != nil {
+		return 0, err
+	}
+	last, err := maxId(ctx, "(n)", "n")
+	if err != nil {
+		return 0, err
+	}
+	exported := 0
+	for start := 0; start <= last; start += compactionReadSpan {
+		query := fmt.Sprintf("MATCH (n) WHERE id(n) >= %d AND id(n) < %d%s RETURN n",
+			start, start+compactionReadSpan, condition)
+		result, err := Store.Query(ctx, query)
+		if err != nil {
+			return exported, err
+		}
+		for result.Next() {
+			node, ok := result.Record().GetByIndex(0).(*rg2.Node)
+			if !ok {
+				continue
+			}
+			if err = visit(node.Properties); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+	}
+	return exported, nil
+}
+
+// Calls visit with each edge, from or to a node of the cluster, or every edge when clusterName is empty.
+func ExportEdges(ctx context.Context, clusterName string, visit func(edge ExportEdge) error) (int, error) {
+	condition, err := exportCondition(clusterName, "(s.cluster = '%[1]s' OR d.cluster = '%[1]s')")
+	if err != nil {
+		return 0, err
+	}
+	last, err := maxId(ctx, "()-[e]->()", "e")
+	if err != nil {
+		return 0, err
+	}
+	exported := 0
+	for start := 0; start <= last; start += compactionReadSpan {
+		query := fmt.Sprintf("MATCH (s)-[e]->(d) WHERE id(e) >= %d AND id(e) < %d%s "+
+			"RETURN s._uid, s.kind, s.cluster, type(e), d._uid, d.kind, d.cluster",
+			start, start+compactionReadSpan, condition)
+		result, err := Store.Query(ctx, query)
+		if err != nil {
+			return exported, err
+		}
+		for result.Next() {
+			record := result.Record()
+			edge := ExportEdge{
+				SourceUID:     recordString(record.GetByIndex(0)),
+				SourceKind:    recordString(record.GetByIndex(1)),
+				SourceCluster: recordString(record.GetByIndex(2)),
+				EdgeType:      recordString(record.GetByIndex(3)),
+				DestUID:       recordString(record.GetByIndex(4)),
+				DestKind:      recordString(record.GetByIndex(5)),
+				DestCluster:   recordString(record.GetByIndex(6)),
+			}
+			if err = visit(edge); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+	}
+	return exported, nil
+}
+
+// Returns the condition limiting an export to a cluster, empty for every cluster.
+func exportCondition(clusterName string, template string) (string, error) {
+	if clusterName == "" {
+		return "", nil
+	}
+	if err := ValidateClusterName(clusterName); err != nil {
+		return "", err
+	}
+	return " AND " + SanitizeQuery(template, clusterName), nil
+}
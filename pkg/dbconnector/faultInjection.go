@@ -0,0 +1,133 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Returned by the queries dropped by the fault injection. Retryable, like a lost connection.
+var ErrInjectedFault = fmt.Errorf("%w: query dropped by the fault injection", ErrRetryable)
+
+// Returned by SetFaultInjection when FAULT_INJECTION_ENABLED isn't true.
+var ErrFaultInjectionDisabled = errors.New("Fault injection is not enabled, set FAULT_INJECTION_ENABLED=true")
+
+// Queries the faults are injected into.
+const (
+	FAULT_TARGET_ALL    = "all"
+	FAULT_TARGET_READS  = "reads"
+	FAULT_TARGET_WRITES = "writes"
+)
+
+// Faults injected into the queries to the datastore, to test the resilience of the handlers and the retries of the
+// collectors in staging. The zero value injects nothing.
+type FaultInjection struct {
+	DropPercent    float64 `json:"dropPercent"`    // Queries failed with ErrInjectedFault without running them.
+	LatencyMS      int     `json:"latencyMS"`      // Added before each query.
+	PartialPercent float64 `json:"partialPercent"` // Reads returning only some of their records.
+	Target         string  `json:"target"`         // all, reads or writes. Defaults to all.
+}
+
+var (
+	faults      FaultInjection
+	faultsMutex = sync.RWMutex{}
+	faultRandom = rand.Float64 // #nosec G404 - Only picks the queries to fail, replaced in tests.
+)
+
+// Returns the faults injected into the queries.
+func CurrentFaultInjection() FaultInjection {
+	faultsMutex.RLock()
+	defer faultsMutex.RUnlock()
+	return faults
+}
+
+// Replaces the faults injected into the queries. Fails when FAULT_INJECTION_ENABLED isn't true or the faults
+// aren't valid.
+func SetFaultInjection(f FaultInjection) error {
+	if config.Cfg.FaultInjectionEnabled != "true" {
+		return ErrFaultInjectionDisabled
+	}
+	if f.DropPercent < 0 || f.DropPercent > 100 || f.PartialPercent < 0 || f.PartialPercent > 100 {
+		return errors.New("dropPercent and partialPercent must be between 0 and 100")
+	}
+	if f.LatencyMS < 0 {
+		return errors.New("latencyMS can't be negative")
+	}
+	switch f.Target {
+	case "":
+		f.Target = FAULT_TARGET_ALL
+	case FAULT_TARGET_ALL, FAULT_TARGET_READS, FAULT_TARGET_WRITES:
+	default:
+		return fmt.Errorf("Unknown fault target %q, expected all, reads or writes", f.Target)
+	}
+	faultsMutex.Lock()
+	faults = f
+	faultsMutex.Unlock()
+	logger.Warningf("Injecting faults into the datastore queries: %+v", f)
+	return nil
+}
+
+func (f FaultInjection) applies(query string, write bool) bool {
+	if f.DropPercent == 0 && f.LatencyMS == 0 && f.PartialPercent == 0 {
+		return false
+	}
+	// The procedures are called by the client to resolve labels and properties, a partial reply would break it.
+	if strings.HasPrefix(strings.TrimSpace(query), "CALL db.") {
+		return false
+	}
+	switch f.Target {
+	case FAULT_TARGET_READS:
+		return !write
+	case FAULT_TARGET_WRITES:
+		return write
+	}
+	return true
+}
+
+// Wraps a redis connection to inject the faults into the graph queries, when FAULT_INJECTION_ENABLED is true.
+type faultConn struct {
+	redis.Conn
+	write bool // The queries are marked with WithWrite.
+}
+
+func (c faultConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if commandName != "GRAPH.QUERY" || len(args) < 2 {
+		return c.Conn.Do(commandName, args...)
+	}
+	query, _ := args[1].(string)
+	f := CurrentFaultInjection()
+	if !f.applies(query, c.write) {
+		return c.Conn.Do(commandName, args...)
+	}
+	if f.LatencyMS > 0 {
+		metrics.InjectedFaults.WithLabelValues("latency").Inc()
+		time.Sleep(time.Duration(f.LatencyMS) * time.Millisecond)
+	}
+	if f.DropPercent > 0 && faultRandom()*100 < f.DropPercent {
+		metrics.InjectedFaults.WithLabelValues("drop").Inc()
+		logger.V(4).Info("Dropped query by the fault injection: ", query)
+		return nil, ErrInjectedFault
+	}
+	reply, err := c.Conn.Do(commandName, args...)
+	if err != nil || f.PartialPercent == 0 || c.write || faultRandom()*100 >= f.PartialPercent {
+		return reply, err
+	}
+	// A reply with records is [header, records, statistics], keep the first part of the records.
+	if values, ok := reply.([]interface{}); ok && len(values) == 3 {
+		if records, ok := values[1].([]interface{}); ok && len(records) > 0 {
+			metrics.InjectedFaults.WithLabelValues("partial").Inc()
+			values[1] = records[:int(faultRandom()*float64(len(records)))]
+		}
+	}
+	return reply, err
+}
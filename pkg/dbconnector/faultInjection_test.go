@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjection(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	prevRandom := faultRandom
+	useTestDatastore(t)
+	defer func() {
+		faultRandom = prevRandom
+		faults = FaultInjection{}
+	}()
+	ctx := context.Background()
+
+	config.Cfg.FaultInjectionEnabled = "false"
+	assert.Equal(t, ErrFaultInjectionDisabled, SetFaultInjection(FaultInjection{DropPercent: 50}))
+	config.Cfg.FaultInjectionEnabled = "true"
+	assert.Error(t, SetFaultInjection(FaultInjection{DropPercent: 150}))
+	assert.Error(t, SetFaultInjection(FaultInjection{Target: "deletes"}))
+
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a'}), (:Pod {_uid:'c1/b'}), (:Pod {_uid:'c1/c'}), (:Pod {_uid:'c1/d'})")
+	assert.NoError(t, err)
+
+	// Only the writes are dropped.
+	faultRandom = func() float64 { return 0.3 }
+	assert.NoError(t, SetFaultInjection(FaultInjection{DropPercent: 50, Target: FAULT_TARGET_WRITES}))
+	_, err = Store.Query(WithWrite(ctx), "CREATE (:Pod {_uid:'c1/e'})")
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	assert.True(t, IsRetryable(err))
+	count, err := queryCount(ctx, "MATCH (n:Pod) RETURN count(n)")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count, "The dropped query doesn't run")
+
+	// The reads return 30% of their records.
+	assert.NoError(t, SetFaultInjection(FaultInjection{PartialPercent: 50}))
+	result, err := Store.Query(ctx, "MATCH (n:Pod) RETURN n._uid")
+	assert.NoError(t, err)
+	records := 0
+	for result.Next() {
+		records++
+	}
+	assert.Equal(t, 1, records)
+
+	assert.NoError(t, SetFaultInjection(FaultInjection{}))
+	assert.Equal(t, FAULT_TARGET_ALL, CurrentFaultInjection().Target)
+	result, err = Store.Query(ctx, "MATCH (n:Pod) RETURN n._uid")
+	assert.NoError(t, err)
+	records = 0
+	for result.Next() {
+		records++
+	}
+	assert.Equal(t, 4, records)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Oldest RedisGraph version supported, its features are used when the version can't be detected.
+const minGraphVersion = 20000 // 2.0.0
+
+// RedisGraph version where each feature was added, encoded like the module version, e.g. 20200 for 2.2.0.
+const (
+	listSlicingVersion  = 20200
+	queryTimeoutVersion = 20400
+)
+
+// Cypher features that differ across the supported RedisGraph versions. Queries using them are generated
+// with a fallback for the older versions, so one aggregator build works with all of them.
+type GraphFeatures struct {
+	Version      int  // Module version, e.g. 20412 for 2.4.12.
+	Detected     bool // False when the version couldn't be read and the oldest supported version is assumed.
+	ListSlicing  bool // Slices of lists, e.g. edges[1..].
+	QueryTimeout bool // TIMEOUT argument of GRAPH.QUERY, aborting the query on the server.
+	RegexMatch   bool // Regular expressions, e.g. n.name =~ 'nginx-.*'. Probed, no RedisGraph version has them.
+}
+
+var (
+	graphFeatures      = featuresForVersion(minGraphVersion, false)
+	graphFeaturesMutex = sync.RWMutex{}
+)
+
+func featuresForVersion(version int, detected bool) GraphFeatures {
+	return GraphFeatures{
+		Version:      version,
+		Detected:     detected,
+		ListSlicing:  version >= listSlicingVersion,
+		QueryTimeout: version >= queryTimeoutVersion,
+	}
+}
+
+// Returns the features of the RedisGraph version in use.
+func CurrentGraphFeatures() GraphFeatures {
+	graphFeaturesMutex.RLock()
+	defer graphFeaturesMutex.RUnlock()
+	return graphFeatures
+}
+
+// Formats a module version, e.g. 2.4.12 for 20412.
+func FormatGraphVersion(version int) string {
+	return fmt.Sprintf("%d.%d.%d", version/10000, version/100%100, version%100)
+}
+
+// Parses a version like 2.4.12 into the module version encoding.
+func parseGraphVersion(version string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, fmt.Errorf("Invalid RedisGraph version %q, expected major.minor.patch", version)
+	}
+	encoded := 0
+	for i := 0; i < 3; i++ {
+		number := 0
+		if i < len(parts) {
+			var err error
+			number, err = strconv.Atoi(parts[i])
+			if err != nil || number < 0 || number > 99 {
+				return 0, fmt.Errorf("Invalid RedisGraph version %q, expected major.minor.patch", version)
+			}
+		}
+		encoded = encoded*100 + number
+	}
+	return encoded, nil
+}
+
+// Reads the version of the graph module from the MODULE LIST reply,
+// e.g. [[name graph ver 20412]] for RedisGraph 2.4.12.
+func graphModuleVersion(reply interface{}, err error) (int, error) {
+	modules, err := redis.Values(reply, err)
+	if err != nil {
+		return 0, err
+	}
+	for _, module := range modules {
+		fields, err := redis.Values(module, nil)
+		if err != nil {
+			return 0, err
+		}
+		name, version := "", -1
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := redis.String(fields[i], nil)
+			switch key {
+			case "name":
+				name, _ = redis.String(fields[i+1], nil)
+			case "ver":
+				version, _ = redis.Int(fields[i+1], nil)
+			}
+		}
+		if name == "graph" && version >= 0 {
+			return version, nil
+		}
+	}
+	return 0, errors.New("The graph module isn't loaded")
+}
+
+// Probes the datastore for the =~ operator. RedisGraph rejects it, the datastores speaking its protocol may not.
+func regexMatchSupported(conn redis.Conn) bool {
+	if _, err := conn.Do("GRAPH.QUERY", GRAPH_NAME, "RETURN 'a' =~ 'a'", "--compact"); err != nil {
+		logger.V(2).Info("The datastore doesn't support regular expressions, they're rejected in searches. ", err)
+		return false
+	}
+	return true
+}
+
+// Detects the RedisGraph version and the features it supports. REDISGRAPH_VERSION sets the version when
+// MODULE LIST isn't allowed, e.g. in managed Redis services. Assumes the oldest supported version when
+// it can't be detected. The features no version has are probed with a query.
+func DetectGraphFeatures() GraphFeatures {
+	version, detected := minGraphVersion, false
+	if config.Cfg.RedisGraphVersion != "" {
+		configured, err := parseGraphVersion(config.Cfg.RedisGraphVersion)
+		if err != nil {
+			logger.Error("Ignoring REDISGRAPH_VERSION. ", err)
+		} else {
+			version, detected = configured, true
+		}
+	}
+	conn := Pool.Get()
+	if !detected {
+		module, err := graphModuleVersion(conn.Do("MODULE", "LIST"))
+		if err != nil {
+			logger.Warningf("Couldn't detect the RedisGraph version, using the features of %s. %s",
+				FormatGraphVersion(minGraphVersion), err)
+		} else {
+			version, detected = module, true
+		}
+	}
+	features := featuresForVersion(version, detected)
+	features.RegexMatch = regexMatchSupported(conn)
+	if err := conn.Close(); err != nil {
+		logger.Warning("Failed to close redis connection. Original error: ", err)
+	}
+	graphFeaturesMutex.Lock()
+	graphFeatures = features
+	graphFeaturesMutex.Unlock()
+	logger.Infof("Using RedisGraph %s features: %+v", FormatGraphVersion(version), features)
+	return features
+}
+
+// Returns the query deleting the duplicate edges between the resources of a cluster, keeping one of each.
+func deleteDuplicateEdgesQuery(clusterName string, features GraphFeatures) string {
+	query := SanitizeQuery("MATCH (s {cluster:'%s'})-[r]->(d {cluster:'%s'}) WHERE (r._interCluster <> true) OR "+
+		"(r._interCluster IS NULL) WITH s as source, d as dest, TYPE(r) as edge, COLLECT (r) AS edges "+
+		"WHERE size(edges) >1 ", clusterName, clusterName)
+	if features.ListSlicing {
+		return query + "UNWIND edges[1..] AS dupedges DELETE dupedges"
+	}
+	return query + "UNWIND range(1, size(edges) - 1) AS i WITH edges[i] AS dupedges DELETE dupedges"
+}
+
+// Deletes the duplicate edges between the resources of a cluster. RedisGraph 2.0 allows duplicate edges,
+// so they're removed on resync.
+func DeleteDuplicateEdges(ctx context.Context, clusterName string) (*rg2.QueryResult, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return &rg2.QueryResult{}, err
+	}
+	return Store.Query(WithWrite(ctx), deleteDuplicateEdgesQuery(clusterName, CurrentGraphFeatures()))
+}
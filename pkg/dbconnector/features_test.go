@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs the test with the regular expressions of the searches supported, as on the in-memory datastore.
+func useRegexMatch(t testing.TB) {
+	graphFeaturesMutex.Lock()
+	prevFeatures := graphFeatures
+	graphFeatures.RegexMatch = true
+	graphFeaturesMutex.Unlock()
+	t.Cleanup(func() {
+		graphFeaturesMutex.Lock()
+		graphFeatures = prevFeatures
+		graphFeaturesMutex.Unlock()
+	})
+}
+
+func Test_parseGraphVersion(t *testing.T) {
+	version, err := parseGraphVersion("2.4.12")
+	assert.NoError(t, err)
+	assert.Equal(t, 20412, version)
+	version, err = parseGraphVersion("v2.2")
+	assert.NoError(t, err)
+	assert.Equal(t, "2.2.0", FormatGraphVersion(version))
+	_, err = parseGraphVersion("2.x")
+	assert.Error(t, err)
+	_, err = parseGraphVersion("2.4.100")
+	assert.Error(t, err)
+}
+
+func Test_graphModuleVersion(t *testing.T) {
+	version, err := graphModuleVersion([]interface{}{
+		[]interface{}{[]byte("name"), []byte("search"), []byte("ver"), int64(20000)},
+		[]interface{}{[]byte("name"), []byte("graph"), []byte("ver"), int64(20020)},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 20020, version)
+	_, err = graphModuleVersion([]interface{}{}, nil)
+	assert.Error(t, err, "The graph module isn't loaded")
+}
+
+func TestDetectGraphFeatures(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	prevFeatures := graphFeatures
+	useMemgraph(t)
+	defer func() {
+		graphFeatures = prevFeatures
+	}()
+	ctx := context.Background()
+
+	features := DetectGraphFeatures()
+	assert.True(t, features.Detected)
+	assert.True(t, features.ListSlicing)
+	assert.True(t, features.RegexMatch, "The in-memory datastore matches regular expressions")
+
+	config.Cfg.RedisGraphVersion = "2.0.20"
+	features = DetectGraphFeatures()
+	assert.Equal(t, GraphFeatures{Version: 20020, Detected: true, RegexMatch: true}, features)
+	assert.Equal(t, features, CurrentGraphFeatures())
+
+	// Both versions of the duplicate edges query keep one edge of each.
+	for _, listSlicing := range []bool{false, true} {
+		_, err := Store.Query(ctx, "CREATE (s:Pod {_uid:'c1/s', cluster:'c1'}), (d:Node {_uid:'c1/d', cluster:'c1'}), "+
+			"(s)-[:runsOn]->(d), (s)-[:runsOn]->(d), (s)-[:runsOn]->(d), (s)-[:ownedBy]->(d)")
+		assert.NoError(t, err)
+		result, err := Store.Query(ctx, deleteDuplicateEdgesQuery("c1", GraphFeatures{ListSlicing: listSlicing}))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.RelationshipsDeleted())
+		assert.Equal(t, 2, queryRows(t, "MATCH (s {_uid:'c1/s'})-[r]->(d) RETURN r"))
+		_, err = Store.Query(ctx, "MATCH (n) DELETE n")
+		assert.NoError(t, err)
+	}
+}
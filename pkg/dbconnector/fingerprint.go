@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Returns the fingerprint of the properties of the resource as they're stored, so a collector can compare it with
+// the fingerprint of its own encoding. It's the SHA-256 of the encoded properties, one name=value line each sorted
+// by name, with the lists joined by ", ". The internal properties, starting with _, and the hashed or redacted ones
+// aren't included.
+func (r Resource) Fingerprint() (string, error) {
+	p := currentProtectedProperties()
+	kind, _ := r.Properties["kind"].(string)
+	properties := make(map[string]interface{}, len(r.Properties))
+	for property, value := range r.Properties {
+		if strings.HasPrefix(property, "_") || p.matches(p.hashed, kind, property) ||
+			p.matches(p.redacted, kind, property) {
+			continue
+		}
+		properties[property] = value
+	}
+	encoded, err := Resource{UID: r.UID, Properties: properties}.EncodeProperties()
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, 0, len(encoded))
+	for property, value := range encoded {
+		if list, ok := value.([]interface{}); ok {
+			elements := make([]string, 0, len(list))
+			for _, element := range list {
+				elements = append(elements, fmt.Sprintf("%v", element))
+			}
+			value = strings.Join(elements, ", ")
+		}
+		lines = append(lines, fmt.Sprintf("%s=%v\n", property, value))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "")))
+	return hex.EncodeToString(sum[:]), nil
+}
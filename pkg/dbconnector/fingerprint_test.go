@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	setProtectedProperties(t, "secret.name", "", "test-key")
+	pod := Resource{Kind: "Pod", UID: "c1/p", Properties: map[string]interface{}{"kind": "Pod", "name": "web",
+		"restarts": float64(2), "container": []interface{}{"b", "a"}, "_hash": "abc", "_rbac": "default_null_pods"}}
+	fingerprint, err := pod.Fingerprint()
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte("container='a', 'b'\nkind=pod\nname=web\nrestarts=2\n"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), fingerprint)
+
+	// The numbers sent as floats or ints are stored the same, the internal properties aren't included.
+	pod.Properties["restarts"] = int64(2)
+	delete(pod.Properties, "_hash")
+	same, _ := pod.Fingerprint()
+	assert.Equal(t, fingerprint, same)
+	pod.Properties["name"] = "api"
+	changed, _ := pod.Fingerprint()
+	assert.NotEqual(t, fingerprint, changed)
+
+	// The hashed properties aren't included, their stored value isn't the one the collector has.
+	secret := Resource{Kind: "Secret", UID: "c1/s", Properties: map[string]interface{}{"kind": "Secret",
+		"name": "db-password", "namespace": "default"}}
+	before, _ := secret.Fingerprint()
+	secret.protectProperties()
+	after, err := secret.Fingerprint()
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	_, err = Resource{UID: "c1/empty", Properties: map[string]interface{}{"_hash": "abc"}}.Fingerprint()
+	assert.Error(t, err)
+}
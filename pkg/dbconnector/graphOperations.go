@@ -11,19 +11,31 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package dbconnector
 
 import (
-	"github.com/golang/glog"
+	"context"
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
-const CHUNK_SIZE = 40 // Used for the chunked operations in other files.
+// Number of resources or edges in each query of the chunked operations in other files.
+func ChunkSize() int {
+	chunkSize := config.ChunkSize()
+	if chunkSize < 1 {
+		return config.DEFAULT_CHUNK_SIZE
+	}
+	return chunkSize
+}
 
 // Resource - Describes a resource (node)
 type Resource struct {
 	Kind           string `json:"kind,omitempty"`
 	UID            string `json:"uid,omitempty"`
 	ResourceString string `json:"resourceString,omitempty"`
-	Properties     map[string]interface{}
+	Hash           string `json:"hash,omitempty"` // Optional, hash of the resource computed by the collector.
+	Rev            int64  `json:"rev,omitempty"`  // Optional on updates, revision of the node the update is based on.
+	// Optional, owners of the resource from its direct owner to the root one, e.g. replicaset and deployment of a pod.
+	OwnerChain []OwnerReference `json:"ownerChain,omitempty"`
+	Properties map[string]interface{}
+	protected  bool // The properties are already hashed or redacted, e.g. in a bisected or retried chunk.
 }
 
 // Describes a relationship between resources
@@ -35,51 +47,55 @@ type Edge struct {
 
 // Represents the results of a chunked db operation
 type ChunkedOperationResult struct {
-	ResourceErrors      map[string]error // errors keyed by UID
-	ConnectionError     error            // For when db conn is down. Supersedes ResourceErrors and SuccessfulResources
+	ResourceErrors      map[string]error // *ResourceError keyed by UID
+	ConnectionError     error            // *BatchError, e.g. the db conn is down. Supersedes ResourceErrors
 	SuccessfulResources int              // Number that were successfully completed
 	EdgesAdded          int
 	EdgesDeleted        int
 }
 
 // Deletes all resources for given cluster
-func DeleteCluster(clusterName string) (*rg2.QueryResult, error) {
+func DeleteCluster(ctx context.Context, clusterName string) (*rg2.QueryResult, error) {
 	err := ValidateClusterName(clusterName)
 	if err != nil {
 		return &rg2.QueryResult{}, err
 	}
 	query := SanitizeQuery("MATCH (n {cluster:'%s'}) DELETE n", clusterName)
-	return Store.Query(query)
+	resp, err := Store.Query(WithWrite(ctx), query)
+	if err == nil {
+		recordDeletes(resp.NodesDeleted())
+	}
+	return resp, err
 }
 
-func TotalNodes(clusterName string) (*rg2.QueryResult, error) {
+func TotalNodes(ctx context.Context, clusterName string) (*rg2.QueryResult, error) {
 	err := ValidateClusterName(clusterName)
 	if err != nil {
 		return &rg2.QueryResult{}, err
 	}
 	query := SanitizeQuery("MATCH (n {cluster:'%s'}) RETURN count(n)", clusterName)
-	return Store.Query(query)
+	return Store.Query(ctx, query)
 }
 
 // Returns a result set with all INTRA edges within the clusterName
-func TotalIntraEdges(clusterName string) (*rg2.QueryResult, error) {
+func TotalIntraEdges(ctx context.Context, clusterName string) (*rg2.QueryResult, error) {
 	err := ValidateClusterName(clusterName)
 	if err != nil {
 		return &rg2.QueryResult{}, err
 	}
 	query := SanitizeQuery("MATCH (s {cluster:'%s'})-[e]->(d {cluster:'%s'}) WHERE (e._interCluster <> true) OR (e._interCluster IS NULL) RETURN count(e)", clusterName, clusterName)
-	resp, err := Store.Query(query)
+	resp, err := Store.Query(ctx, query)
 	return resp, err
 }
 
-func MergeDummyCluster(name string) (*rg2.QueryResult, error) {
+func MergeDummyCluster(ctx context.Context, name string) (*rg2.QueryResult, error) {
 	kubeVersion := ""
 	discoveryClient := config.GetDiscoveryClient()
 
 	if discoveryClient != nil {
 		clusterClientServerVersion, err := discoveryClient.ServerVersion()
 		if err != nil {
-			glog.Error("Error getting hub kubernetes version. clusterClientServerVersion was not found.")
+			logger.Error("Error getting hub kubernetes version. clusterClientServerVersion was not found.")
 		} else {
 			kubeVersion = clusterClientServerVersion.String()
 		}
@@ -88,15 +104,30 @@ func MergeDummyCluster(name string) (*rg2.QueryResult, error) {
 	query := SanitizeQuery(
 		"MERGE (c:Cluster {name: '%s', kind: 'cluster'}) SET c.status = 'OK', c.kubernetesVersion = '%s'",
 		name, kubeVersion)
-	return Store.Query(query)
+	return Store.Query(WithWrite(ctx), query)
 }
 
-func CheckClusterResource(clusterName string) (*rg2.QueryResult, error) {
+func CheckClusterResource(ctx context.Context, clusterName string) (*rg2.QueryResult, error) {
 	err := ValidateClusterName(clusterName)
 	if err != nil {
-		glog.Warning("Error validating cluster:", clusterName)
+		logger.Warning("Error validating cluster:", clusterName)
 		return &rg2.QueryResult{}, err
 	}
 	query := SanitizeQuery("MATCH (c:Cluster {name: '%s'}) RETURN count(c)", clusterName)
-	return Store.Query(query)
+	return Store.Query(ctx, query)
+}
+
+// Returns the names of the clusters with a Cluster node, sorted.
+func ClusterNames(ctx context.Context) ([]string, error) {
+	resp, err := Store.Query(ctx, "MATCH (c:Cluster) RETURN c.name ORDER BY c.name")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for resp.Next() {
+		if name, ok := resp.Record().GetByIndex(0).(string); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
 }
@@ -9,6 +9,7 @@ The source code for this program is not published or otherwise divested of its t
 package dbconnector
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -22,7 +23,7 @@ type MockCache struct {
 func init() {
 	Store = MockCache{}
 }
-func (mc MockCache) Query(q string) (*rg2.QueryResult, error) {
+func (mc MockCache) Query(ctx context.Context, q string) (*rg2.QueryResult, error) {
 	if q == "MATCH (n {cluster:'good-cluster-name'}) DELETE n" || insertQueryCheck(q) || deleteQueryCheck(q) {
 		return &rg2.QueryResult{}, nil
 	}
@@ -30,16 +31,16 @@ func (mc MockCache) Query(q string) (*rg2.QueryResult, error) {
 }
 
 func TestDeleteCluster(t *testing.T) {
-	_, err := DeleteCluster("good-cluster-name")
+	_, err := DeleteCluster(context.Background(), "good-cluster-name")
 	assert.NoError(t, err)
 
 }
 func TestBadDeleteCluster(t *testing.T) {
-	_, err := DeleteCluster("bad-cluster=name")
+	_, err := DeleteCluster(context.Background(), "bad-cluster=name")
 	assert.Error(t, err)
 }
 
 func TestMergeDummyCluster(t *testing.T) {
-	_, err := MergeDummyCluster("fake-cluster")
+	_, err := MergeDummyCluster(context.Background(), "fake-cluster")
 	assert.Error(t, err)
 }
@@ -10,6 +10,7 @@ The source code for this program is not published or otherwise divested of its t
 package dbconnector
 
 import (
+	"context"
 	"strings"
 
 	rg2 "github.com/redislabs/redisgraph-go"
@@ -48,6 +49,11 @@ func IsBadConnection(e error) bool {
 	return strings.HasSuffix(e.Error(), "connection refused") || strings.HasSuffix(e.Error(), "EOF")
 }
 
+// Tells whether processing should stop, because the redis connection died or the request context is done.
+func isFatalError(ctx context.Context, err error) bool {
+	return IsRetryable(err) || (err != nil && ctx.Err() != nil)
+}
+
 // Test for specific redis graph update error
 func IsGraphMissing(err error) bool {
 	if err == nil {
@@ -59,3 +65,11 @@ func IsGraphMissing(err error) bool {
 func IsPropertySet(res *rg2.QueryResult) bool {
 	return res.PropertiesSet() > 0
 }
+
+// Returns the string value of a field in a query result record, or empty string for nil or non-string values.
+func recordString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
@@ -10,43 +10,43 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
 	"strings"
-	"sync"
 
-	"github.com/golang/glog"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
 // Recursive helper for ChunkedInsert. Takes a single chunk, and recursively attempts to insert that chunk,
 // then the first and second halves of that chunk independently, and so on.
-func chunkedInsertHelper(resources []*Resource, clusterName string) ChunkedOperationResult {
+func chunkedInsertHelper(ctx context.Context, resources []*Resource, clusterName string) ChunkedOperationResult {
 
 	if len(resources) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
 
-	_, _, err := Insert(resources, clusterName) // We ignore encoding errors as they are always recoverable.
-	if IsBadConnection(err) {                   // this is false if err is nil
+	_, _, err := Insert(ctx, resources, clusterName) // We ignore encoding errors as they are always recoverable.
+	if isFatalError(ctx, err) {                      // this is false if err is nil
 		return ChunkedOperationResult{
-			ConnectionError: err,
+			ConnectionError: batchError(ctx, "insert", err),
 		}
 	}
 
 	if err != nil {
 		if len(resources) == 1 { // If this was a single resource
-			glog.Warningf("Rejecting Resource %s: %s", resources[0].UID, err)
+			logger.Warningf("Rejecting Resource %s: %s", resources[0].UID, err)
 			return ChunkedOperationResult{
-				ResourceErrors: map[string]error{resources[0].UID: err},
+				ResourceErrors: map[string]error{resources[0].UID: resourceError("insert", resources[0].UID, err)},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedInsertHelper(resources[0:len(resources)/2], clusterName)
-			secondHalf := chunkedInsertHelper(resources[len(resources)/2:], clusterName)
-			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
-				// Again, if either one has a redis conn issue we just instantly bail
-				return ChunkedOperationResult{
-					ConnectionError: err,
-				}
+			firstHalf := chunkedInsertHelper(ctx, resources[0:len(resources)/2], clusterName)
+			secondHalf := chunkedInsertHelper(ctx, resources[len(resources)/2:], clusterName)
+			// Again, if either one has a redis conn issue we just instantly bail
+			if firstHalf.ConnectionError != nil {
+				return firstHalf
+			}
+			if secondHalf.ConnectionError != nil {
+				return secondHalf
 			}
 			return ChunkedOperationResult{
 				ResourceErrors: mergeErrorMaps(firstHalf.ResourceErrors, secondHalf.ResourceErrors),
@@ -62,36 +62,42 @@ func chunkedInsertHelper(resources []*Resource, clusterName string) ChunkedOpera
 }
 
 // Insert the given resources into the graph, does chunking for you and returns errors related to individual resources.
-func ChunkedInsert(resources []*Resource, clusterName string) ChunkedOperationResult {
-	var resourceErrors map[string]error
-	totalSuccessful := 0
-	var ExistingIndexMapMutex = sync.RWMutex{}
-
+func ChunkedInsert(ctx context.Context, resources []*Resource, clusterName string) ChunkedOperationResult {
 	kindMap := make(map[string]struct{})
 	for _, res := range resources {
 		kindMap[res.Properties["kind"].(string)] = struct{}{}
 	}
 
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedInsertHelper(resources[i:endIndex], clusterName)
-		if chunkResult.ConnectionError != nil {
-			return chunkResult
-		} else if chunkResult.ResourceErrors != nil {
-			resourceErrors = mergeErrorMaps(resourceErrors, chunkResult.ResourceErrors) // if both are nil, this is nil
+	// The resources replace their placeholders, the edges to the placeholders are inserted again once they're in.
+	var placeholderEdges []Edge
+	if PlaceholdersEnabled() && len(resources) > 0 {
+		var err error
+		placeholderEdges, err = takeOverPlaceholders(ctx, resources)
+		if isFatalError(ctx, err) {
+			return ChunkedOperationResult{ConnectionError: batchError(ctx, "replace placeholder", err)}
+		} else if err != nil {
+			logger.Warning("Error replacing placeholder nodes for cluster ", clusterName, ": ", err)
 		}
-		totalSuccessful += chunkResult.SuccessfulResources
 	}
-	ret := ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalSuccessful,
+
+	shards, shardSizes := resourceShards(resources)
+	ret := runChunkShards(ctx, "insert", shardSizes, func(shard, start, end int) ChunkedOperationResult {
+		return chunkedInsertHelper(ctx, shards[shard][start:end], clusterName)
+	})
+	if ret.ConnectionError != nil {
+		return ret
+	}
+	if len(placeholderEdges) > 0 {
+		if err := ChunkedInsertEdge(ctx, placeholderEdges, clusterName).Err(); err != nil {
+			logger.Warning("Error moving the edges of placeholder nodes for cluster ", clusterName, ": ", err)
+		}
 	}
 	for kind := range kindMap {
 		ExistingIndexMapMutex.RLock()
 		exists := ExistingIndexMap[kind]
 		ExistingIndexMapMutex.RUnlock()
 		if !exists {
-			insertErr := insertIndex(kind, "_uid")
+			insertErr := insertIndex(ctx, kind, "_uid")
 			if insertErr == nil {
 				ExistingIndexMapMutex.Lock() // Lock map before writing
 				ExistingIndexMap[kind] = true
@@ -105,9 +111,9 @@ func ChunkedInsert(resources []*Resource, clusterName string) ChunkedOperationRe
 // Inserts given resources into graph, transparently builds query for you and
 // returns the response and errors given by redisgraph.
 // Returns the result, any errors when encoding, and any error from the query itself.
-func Insert(resources []*Resource, clusterName string) (*rg2.QueryResult, map[string]error, error) {
+func Insert(ctx context.Context, resources []*Resource, clusterName string) (*rg2.QueryResult, map[string]error, error) {
 	query, encodingErrors := insertQuery(resources, clusterName) // Encoding errors are recoverable, but we report them
-	resp, err := Store.Query(query)
+	resp, err := Store.Query(WithWrite(ctx), query)
 	return resp, encodingErrors, err
 }
 
@@ -123,12 +129,18 @@ func insertQuery(resources []*Resource, clusterName string) (string, map[string]
 	resourceStrings := []string{} // Build the query string piece by piece.
 	for _, resource := range resources {
 		resource.addRbacProperty()
+		resource.addClusterSetProperty(clusterName)
+		resource.protectProperties()
+		resource.addHashProperty()
+		resource.addLocalUIDProperty()
 		encodedProps, err := resource.EncodeProperties()
 		if err != nil {
-			glog.Error("Cannot encode resource ", resource.UID, ", excluding it from insertion: ", err)
+			logger.Error("Cannot encode resource ", resource.UID, ", excluding it from insertion: ", err)
 			encodingErrors[resource.UID] = err
 			continue
 		}
+		kind, _ := resource.Properties["kind"].(string)
+		observeSchema(kind, encodedProps)
 		propStrings := []string{}
 		for k, v := range encodedProps {
 			switch typed := v.(type) { // This is either string or int64 with base type string or []interface
@@ -141,6 +153,7 @@ func insertQuery(resources []*Resource, clusterName string) (string, map[string]
 				propStrings = append(propStrings, fmt.Sprintf("%s:'%s'", k, typed)) // e.g. <key>:'<value>'
 			}
 		}
+		propStrings = append(propStrings, REV_PROPERTY+":1")
 		// e.g. (:Pod {_uid: 'abc123', prop1:5, prop2:'cheese'})
 		resource := fmt.Sprintf("(:%s {_uid:'%s', %s})",
 			resource.Properties["kind"], resource.UID, strings.Join(propStrings, ", "))
@@ -148,6 +161,7 @@ func insertQuery(resources []*Resource, clusterName string) (string, map[string]
 		// if a clusterName was passed in then we should connect the resource to the cluster node
 		if clusterName != "" {
 			resource += "-[:inCluster {_interCluster: true}]->(c)"
+			ObserveEdgeType("inCluster")
 		}
 
 		resourceStrings = append(resourceStrings, resource)
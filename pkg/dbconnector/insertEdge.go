@@ -11,22 +11,36 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 
-	"github.com/golang/glog"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
 // Inserts the given edges grouped by source
-func ChunkedInsertEdge(resources []Edge, clusterName string) ChunkedOperationResult {
-	glog.V(4).Info("For cluster ", clusterName, ": Number of edges received in ChunkedInsertEdge: ", len(resources))
+func ChunkedInsertEdge(ctx context.Context, resources []Edge, clusterName string) ChunkedOperationResult {
+	logger.V(4).Info("For cluster ", clusterName, ": Number of edges received in ChunkedInsertEdge: ", len(resources))
 	var insertEdgeCount int
 	if len(resources) == 0 {
-		return ChunkedOperationResult{
-			ResourceErrors:      nil,
-			SuccessfulResources: 0,
+		return ChunkedOperationResult{}
+	}
+	if PlaceholdersEnabled() {
+		placeholders, err := insertPlaceholders(ctx, resources, clusterName)
+		if isFatalError(ctx, err) {
+			return ChunkedOperationResult{ConnectionError: batchError(ctx, "insert placeholder", err)}
+		} else if err != nil {
+			logger.Warning("Error creating placeholder nodes for cluster ", clusterName, ": ", err)
+		}
+		if len(placeholders) > 0 {
+			// The placeholders don't have the kind label of the destination.
+			resources = append([]Edge(nil), resources...)
+			for i := range resources {
+				if placeholders[resources[i].DestUID] {
+					resources[i].DestKind = ""
+				}
+			}
 		}
 	}
 
@@ -40,6 +54,8 @@ func ChunkedInsertEdge(resources []Edge, clusterName string) ChunkedOperationRes
 	resourceErrors := make(map[string]error)
 	totalAdded := 0
 	currentLength := 0
+	chunkSize := ChunkSize()
+	tracker := newChunkTracker(ctx, "insert edge", len(resources), 0) // Chunks follow the groups, not the chunk size.
 
 	newWhereClause := true
 	var whereClause strings.Builder
@@ -55,16 +71,25 @@ func ChunkedInsertEdge(resources []Edge, clusterName string) ChunkedOperationRes
 		currentLength++
 
 		//look ahead to see if we are in a differnet group or if at max chuck size
-		if currentLength == CHUNK_SIZE || (i < len(resources)-1 &&
+		if currentLength >= chunkSize || (i < len(resources)-1 &&
 			(resources[i+1].SourceUID != resources[i].SourceUID || resources[i+1].EdgeType != resources[i].EdgeType)) {
-			resp, err := insertEdge(resources[i], whereClause.String())
+			if ctx.Err() != nil {
+				return ChunkedOperationResult{ConnectionError: batchError(ctx, "insert edge", ctx.Err()),
+					SuccessfulResources: totalAdded}
+			}
+			resp, err := insertEdge(ctx, resources[i], whereClause.String())
 			newWhereClause = false
-			if err != nil {
+			if isFatalError(ctx, err) {
+				return ChunkedOperationResult{ConnectionError: batchError(ctx, "insert edge", err),
+					SuccessfulResources: totalAdded}
+			} else if err != nil {
 				// saving JUST the source as the key to the map
-				resourceErrors[resources[i].SourceUID] = err
+				resourceErrors[resources[i].SourceUID] = resourceError("insert edge", resources[i].SourceUID, err)
+				tracker.chunkDone(currentLength, 0, currentLength)
 			} else {
 				totalAdded += currentLength
 				insertEdgeCount += resp.RelationshipsCreated()
+				tracker.chunkDone(currentLength, currentLength, 0)
 			}
 			whereClause.Reset()
 			currentLength = 0
@@ -73,16 +98,26 @@ func ChunkedInsertEdge(resources []Edge, clusterName string) ChunkedOperationRes
 
 	if newWhereClause {
 		// commit the last edge string to the db
-		resp, err := insertEdge(resources[len(resources)-1], whereClause.String())
-		if err != nil {
+		if ctx.Err() != nil {
+			return ChunkedOperationResult{ConnectionError: batchError(ctx, "insert edge", ctx.Err()),
+				SuccessfulResources: totalAdded}
+		}
+		last := resources[len(resources)-1]
+		resp, err := insertEdge(ctx, last, whereClause.String())
+		if isFatalError(ctx, err) {
+			return ChunkedOperationResult{ConnectionError: batchError(ctx, "insert edge", err),
+				SuccessfulResources: totalAdded}
+		} else if err != nil {
 			// saving JUST the source as the key to the map
-			resourceErrors[resources[len(resources)-1].SourceUID] = err
+			resourceErrors[last.SourceUID] = resourceError("insert edge", last.SourceUID, err)
+			tracker.chunkDone(currentLength, 0, currentLength)
 		} else {
 			totalAdded += currentLength
 			insertEdgeCount += resp.RelationshipsCreated()
+			tracker.chunkDone(currentLength, currentLength, 0)
 		}
 	}
-	glog.V(4).Info("ChunkedInsertEdge: For cluster, ", clusterName, ": Number of edges inserted: ", insertEdgeCount)
+	logger.V(4).Info("ChunkedInsertEdge: For cluster, ", clusterName, ": Number of edges inserted: ", insertEdgeCount)
 
 	return ChunkedOperationResult{
 		ResourceErrors:      resourceErrors,
@@ -92,7 +127,8 @@ func ChunkedInsertEdge(resources []Edge, clusterName string) ChunkedOperationRes
 }
 
 // e.g. MATCH (s:{_uid:'abc'}), (d) WHERE d._uid='def' OR d._uid='ghi' CREATE (s)-[:Type]>(d)
-func insertEdge(edge Edge, whereClause string) (*rg2.QueryResult, error) {
+func insertEdge(ctx context.Context, edge Edge, whereClause string) (*rg2.QueryResult, error) {
+	ObserveEdgeType(edge.EdgeType)
 	//This is the basic insert query without using node labels
 	query := fmt.Sprintf("MATCH (s {_uid: '%s'}), (d) %s CREATE (s)-[:%s]->(d)",
 		edge.SourceUID, whereClause, edge.EdgeType)
@@ -110,10 +146,10 @@ func insertEdge(edge Edge, whereClause string) (*rg2.QueryResult, error) {
 				edge.SourceKind, edge.SourceUID, edge.DestKind, whereClause, edge.EdgeType)
 		}
 	}
-	glog.V(4).Info("Insert query: ", query)
-	resp, err := Store.Query(query)
+	logger.V(4).Info("Insert query: ", query)
+	resp, err := Store.Query(WithWrite(ctx), query)
 	if err == nil {
-		glog.V(4).Info("Relationships created: ", resp.RelationshipsCreated())
+		logger.V(4).Info("Relationships created: ", resp.RelationshipsCreated())
 	}
 	return resp, err
 }
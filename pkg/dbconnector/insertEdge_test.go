@@ -3,6 +3,7 @@
 package dbconnector
 
 import (
+	"context"
 	"testing"
 
 	assert "github.com/stretchr/testify/assert"
@@ -63,14 +64,14 @@ func insertQueryCheck(q string) bool {
 	return false
 }
 func TestChunkedInsertEdge(t *testing.T) {
-	chunkedOpRes := ChunkedInsertEdge(initTestEdges(), clusterName)
+	chunkedOpRes := ChunkedInsertEdge(context.Background(), initTestEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 0, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 3, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedInsertErrorEdges(t *testing.T) {
-	chunkedOpRes := ChunkedInsertEdge(initTestErrorEdges(), clusterName)
+	chunkedOpRes := ChunkedInsertEdge(context.Background(), initTestErrorEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 2, chunkedOpRes.SuccessfulResources)
@@ -4,20 +4,21 @@
 package dbconnector
 
 import (
+	"context"
 	"sync"
-
-	"github.com/golang/glog"
 )
 
 // ExistingIndexMap - map to hold all resource kinds that have index built in redisgraph
 var ExistingIndexMap = make(map[string]bool)
 
+// ExistingIndexMapMutex - guards ExistingIndexMap, the syncs of the clusters insert their indexes concurrently
+var ExistingIndexMapMutex = sync.RWMutex{}
+
 // GetIndexes - returns map to hold all resource kinds that have index built in redisgraph
 func GetIndexes() {
-	glog.V(4).Info("Fetching indexes")
-	resp, err := Store.Query("MATCH (n) RETURN distinct labels(n)")
+	logger.V(4).Info("Fetching indexes")
+	resp, err := Store.Query(context.Background(), "MATCH (n) RETURN distinct labels(n)")
 	if err == nil {
-		var ExistingIndexMapMutex = sync.RWMutex{}
 		if !resp.Empty() {
 			for resp.Next() {
 				record := resp.Record()
@@ -39,16 +40,16 @@ func GetIndexes() {
 			}
 		}
 	} else {
-		glog.Error("Error retrieving node labels from redisgraph while creating indices.")
+		logger.Error("Error retrieving node labels from redisgraph while creating indices.")
 	}
 
 }
 
 // Given a resource, inserts index on resource uid into redisgraph.
-func insertIndex(kind, property string) error {
-	glog.V(4).Info("Inserting index")
+func insertIndex(ctx context.Context, kind, property string) error {
+	logger.V(4).Info("Inserting index")
 	query := SanitizeQuery("CREATE INDEX ON :%s(%s)", kind, property) //CREATE INDEX ON :Pod(_uid)"
-	_, err := Store.Query(query)
-	glog.V(4).Info("Insert index query: ", query)
+	_, err := Store.Query(WithWrite(ctx), query)
+	logger.V(4).Info("Insert index query: ", query)
 	return err
 }
@@ -0,0 +1,40 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+)
+
+// Node property holding the hash of the resource sent by the collector.
+const HASH_PROPERTY = "_hash"
+
+// Stores the hash sent by the collector, so an inventory can tell which resources changed.
+func (r *Resource) addHashProperty() {
+	if r.Hash == "" {
+		return
+	}
+	if r.Properties == nil { // init props if it was nil
+		r.Properties = make(map[string]interface{})
+	}
+	r.Properties[HASH_PROPERTY] = r.Hash
+}
+
+// Returns the hash of each resource of the cluster by UID. The hash is empty for resources inserted without one.
+func ResourceHashes(ctx context.Context, clusterName string) (map[string]string, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	result, err := Store.Query(ctx, SanitizeQuery("MATCH (n {cluster:'%s'}) RETURN n._uid, n._hash", clusterName))
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	for result.Next() {
+		record := result.Record()
+		hashes[recordString(record.GetByIndex(0))] = recordString(record.GetByIndex(1))
+	}
+	return hashes, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Lane of the connection pool used by a query. Bulk queries share a limited number of connections,
+// so the rest of the pool stays available for delta syncs and they don't wait behind a large resync.
+type Lane int
+
+const (
+	DeltaLane Lane = iota // Default for queries without a lane.
+	BulkLane              // Resyncs and background jobs.
+)
+
+func (l Lane) String() string {
+	if l == BulkLane {
+		return "bulk"
+	}
+	return "delta"
+}
+
+type laneKey struct{}
+
+// Returns a context for queries in the given lane.
+func WithLane(ctx context.Context, lane Lane) context.Context {
+	return context.WithValue(ctx, laneKey{}, lane)
+}
+
+// Returns the lane of the context, DeltaLane if not set.
+func LaneFromContext(ctx context.Context) Lane {
+	lane, _ := ctx.Value(laneKey{}).(Lane)
+	return lane
+}
+
+// Connections the bulk lane can hold at the same time. Set in init, after the pool is created.
+var bulkSlots chan struct{}
+
+// Returns the number of connections of a pool of the given size the bulk lane can use.
+// At least one, so bulk queries always make progress.
+func bulkLaneSize(maxActive int) int {
+	size := maxActive - config.Cfg.DeltaReservedConnections
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+// Waits for a slot in the lane of the context. Call release when done with the connection.
+func acquireLane(ctx context.Context) (release func(), err error) {
+	slots := bulkSlots // Released to the channel the slot was taken from, even when bulkSlots is replaced.
+	if LaneFromContext(ctx) != BulkLane || slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
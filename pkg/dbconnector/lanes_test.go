@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/memgraph"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bulkLaneSize(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+
+	config.Cfg.DeltaReservedConnections = 5
+	assert.Equal(t, 15, bulkLaneSize(20))
+	config.Cfg.DeltaReservedConnections = 30
+	assert.Equal(t, 1, bulkLaneSize(20))
+}
+
+func Test_LaneFromContext(t *testing.T) {
+	assert.Equal(t, DeltaLane, LaneFromContext(context.Background()))
+	assert.Equal(t, BulkLane, LaneFromContext(WithLane(context.Background(), BulkLane)))
+}
+
+// Deltas get a connection while the bulk lane is full.
+func Test_bulkLaneFull(t *testing.T) {
+	prevPool, prevSlots := Pool, bulkSlots
+	Pool = &redis.Pool{Dial: memgraph.NewServer().Dial, MaxActive: 2, Wait: true}
+	bulkSlots = make(chan struct{}, 1)
+	defer func() { Pool, bulkSlots = prevPool, prevSlots }()
+	store := RedisGraphStoreV2{}
+
+	release, err := acquireLane(WithLane(context.Background(), BulkLane))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(WithLane(context.Background(), BulkLane), 50*time.Millisecond)
+	defer cancel()
+	_, err = store.Query(ctx, "MATCH (n) RETURN count(n)")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	result, err := store.Query(context.Background(), "MATCH (n) RETURN count(n)")
+	assert.Nil(t, err)
+	assert.True(t, result.Next())
+
+	release()
+	_, err = store.Query(WithLane(context.Background(), BulkLane), "MATCH (n) RETURN count(n)")
+	assert.Nil(t, err)
+}
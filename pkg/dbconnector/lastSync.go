@@ -0,0 +1,56 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Prefix of the redis keys holding the last successful sync of each cluster. A sorted set with a single entry, so
+// it's read and written like the timelines.
+const LAST_SYNC_KEY_PREFIX = "search-aggregator:last-sync:"
+
+// Replaces the last successful sync of the cluster. It's kept for the retention of the sync history.
+func RecordLastSync(ctx context.Context, clusterName string, received time.Time, entry []byte) error {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return err
+	}
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := LAST_SYNC_KEY_PREFIX + clusterName
+	retention := time.Duration(config.SyncHistoryRetentionHours()) * time.Hour
+	_ = conn.Send("MULTI")
+	_ = conn.Send("DEL", key)
+	_ = conn.Send("ZADD", key, timeScore(received), entry)
+	_ = conn.Send("EXPIRE", key, int64(retention.Seconds()))
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// Returns the last successful sync of the cluster, nil when there's none in the retention.
+func LastSync(ctx context.Context, clusterName string) ([]byte, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	entries, err := redis.ByteSlices(conn.Do("ZRANGEBYSCORE", LAST_SYNC_KEY_PREFIX+clusterName, "-inf", "+inf"))
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return entries[len(entries)-1], nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// How long the lazy deleter waits when there is nothing to delete.
+const lazyDeleteIdleWait = time.Second
+
+// Resources of each cluster waiting to be deleted by the lazy deleter, by UID. They stay in the graph until then.
+// Kept in memory only, the next resync of the cluster deletes them again after a restart.
+var (
+	pendingDeletes        = make(map[string]map[string]struct{})
+	pendingDeletesMutex   = sync.Mutex{}
+	lastLazyDeleteCluster string // Cluster of the last chunk, the clusters take turns.
+	// Held while a chunk is deleted, so a resource sent again can't be canceled while its delete is running.
+	lazyDeleteMutex = sync.Mutex{}
+)
+
+// Tells whether the deletes of a resync are queued for the lazy deleter instead of deleted right away.
+func ShouldDeleteLazily(count int) bool {
+	return config.Cfg.LazyDeleteThreshold > 0 && count > config.Cfg.LazyDeleteThreshold
+}
+
+func setPendingDeletesMetric() {
+	total := 0
+	for _, uids := range pendingDeletes {
+		total += len(uids)
+	}
+	metrics.PendingDeletes.Set(float64(total))
+}
+
+// Queues the resources of the cluster for the lazy deleter.
+func QueueDeletes(clusterName string, uids []string) {
+	pendingDeletesMutex.Lock()
+	defer pendingDeletesMutex.Unlock()
+	pending, ok := pendingDeletes[clusterName]
+	if !ok {
+		pending = make(map[string]struct{}, len(uids))
+		pendingDeletes[clusterName] = pending
+	}
+	for _, uid := range uids {
+		pending[uid] = struct{}{}
+	}
+	setPendingDeletesMetric()
+	logger.V(2).Infof("Queued %d deletes for cluster %s, %d pending.", len(uids), clusterName, len(pending))
+}
+
+// Removes the resources the cluster sent again from the lazy deleter, and returns the ones that were pending.
+// They are still in the graph. Waits for the chunk being deleted, if any, so the resources not returned are either
+// deleted or were never pending.
+func CancelPendingDeletes(clusterName string, uids []string) []string {
+	lazyDeleteMutex.Lock()
+	defer lazyDeleteMutex.Unlock()
+	pendingDeletesMutex.Lock()
+	defer pendingDeletesMutex.Unlock()
+	pending, ok := pendingDeletes[clusterName]
+	if !ok {
+		return nil
+	}
+	canceled := []string{}
+	for _, uid := range uids {
+		if _, ok := pending[uid]; ok {
+			delete(pending, uid)
+			canceled = append(canceled, uid)
+		}
+	}
+	if len(pending) == 0 {
+		delete(pendingDeletes, clusterName)
+	}
+	setPendingDeletesMetric()
+	return canceled
+}
+
+// Forgets the pending deletes of a cluster, e.g. when all its resources are deleted.
+func DropPendingDeletes(clusterName string) {
+	pendingDeletesMutex.Lock()
+	defer pendingDeletesMutex.Unlock()
+	delete(pendingDeletes, clusterName)
+	setPendingDeletesMetric()
+}
+
+// Returns the number of resources waiting for the lazy deleter, by cluster.
+func PendingDeletes() map[string]int {
+	pendingDeletesMutex.Lock()
+	defer pendingDeletesMutex.Unlock()
+	counts := make(map[string]int, len(pendingDeletes))
+	for clusterName, uids := range pendingDeletes {
+		counts[clusterName] = len(uids)
+	}
+	return counts
+}
+
+// Returns the resources of the cluster waiting for the lazy deleter.
+func pendingDeletesOf(clusterName string) map[string]struct{} {
+	pendingDeletesMutex.Lock()
+	defer pendingDeletesMutex.Unlock()
+	pending := make(map[string]struct{}, len(pendingDeletes[clusterName]))
+	for uid := range pendingDeletes[clusterName] {
+		pending[uid] = struct{}{}
+	}
+	return pending
+}
+
+// Takes up to size pending deletes of the cluster after the one of the last chunk, so a large backlog of a cluster
+// doesn't hold up the others.
+func takePendingDeletes(size int) (string, []string) {
+	pendingDeletesMutex.Lock()
+	defer pendingDeletesMutex.Unlock()
+	if len(pendingDeletes) == 0 {
+		return "", nil
+	}
+	clusters := make([]string, 0, len(pendingDeletes))
+	for clusterName := range pendingDeletes {
+		clusters = append(clusters, clusterName)
+	}
+	sort.Strings(clusters)
+	clusterName := clusters[0]
+	for _, c := range clusters {
+		if c > lastLazyDeleteCluster {
+			clusterName = c
+			break
+		}
+	}
+	lastLazyDeleteCluster = clusterName
+
+	pending := pendingDeletes[clusterName]
+	uids := make([]string, 0, size)
+	for uid := range pending {
+		if len(uids) == size {
+			break
+		}
+		uids = append(uids, uid)
+		delete(pending, uid)
+	}
+	if len(pending) == 0 {
+		delete(pendingDeletes, clusterName)
+	}
+	setPendingDeletesMetric()
+	return clusterName, uids
+}
+
+// Deletes the next chunk of pending deletes. Returns the resources it tried to delete, 0 when there are none.
+// The chunk is queued again when the datastore can't be reached.
+func deleteNextPendingChunk(ctx context.Context) int {
+	lazyDeleteMutex.Lock()
+	defer lazyDeleteMutex.Unlock()
+	clusterName, uids := takePendingDeletes(ChunkSize())
+	if len(uids) == 0 {
+		return 0
+	}
+	result := ChunkedDelete(ctx, uids)
+	if result.ConnectionError != nil {
+		logger.Warning("Error in the lazy delete for cluster ", clusterName, ", retrying. ", result.ConnectionError)
+		QueueDeletes(clusterName, uids)
+		return len(uids)
+	}
+	if len(result.ResourceErrors) > 0 {
+		logger.Warningf("Lazy delete failed for %d resources of cluster %s, they are deleted by its next resync.",
+			len(result.ResourceErrors), clusterName)
+	}
+	logger.V(4).Infof("Lazy delete removed %d resources of cluster %s.", result.SuccessfulResources, clusterName)
+	return len(uids)
+}
+
+// Deletes the resources queued by the resyncs at LAZY_DELETE_RATE resources per second, one chunk at a time, so
+// mass deletions don't block the other queries. A rate of 0 deletes the chunks back to back.
+func LazyDeleteJob() {
+	for {
+		ctx := WithLane(context.Background(), BulkLane)
+		deleted := deleteNextPendingChunk(ctx)
+		if deleted == 0 {
+			time.Sleep(lazyDeleteIdleWait)
+		} else if config.Cfg.LazyDeleteRate > 0 {
+			time.Sleep(time.Duration(deleted) * time.Second / time.Duration(config.Cfg.LazyDeleteRate))
+		}
+	}
+}
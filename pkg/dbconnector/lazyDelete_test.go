@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetPendingDeletes() {
+	pendingDeletes = make(map[string]map[string]struct{})
+	lastLazyDeleteCluster = ""
+}
+
+func TestShouldDeleteLazily(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+
+	config.Cfg.LazyDeleteThreshold = 10
+	assert.False(t, ShouldDeleteLazily(10))
+	assert.True(t, ShouldDeleteLazily(11))
+	config.Cfg.LazyDeleteThreshold = 0
+	assert.False(t, ShouldDeleteLazily(100000))
+}
+
+func TestCancelPendingDeletes(t *testing.T) {
+	resetPendingDeletes()
+	defer resetPendingDeletes()
+
+	QueueDeletes("c1", []string{"c1/a", "c1/b", "c1/c"})
+	QueueDeletes("c2", []string{"c2/a"})
+	assert.Equal(t, map[string]int{"c1": 3, "c2": 1}, PendingDeletes())
+
+	canceled := CancelPendingDeletes("c1", []string{"c1/a", "c1/x", "c2/a"})
+	assert.Equal(t, []string{"c1/a"}, canceled)
+	assert.Empty(t, CancelPendingDeletes("c3", []string{"c3/a"}))
+	CancelPendingDeletes("c2", []string{"c2/a"})
+	assert.Equal(t, map[string]int{"c1": 2}, PendingDeletes())
+
+	DropPendingDeletes("c1")
+	assert.Empty(t, PendingDeletes())
+}
+
+func TestTakePendingDeletes(t *testing.T) {
+	resetPendingDeletes()
+	defer resetPendingDeletes()
+
+	QueueDeletes("c1", []string{"c1/a", "c1/b", "c1/c"})
+	QueueDeletes("c2", []string{"c2/a"})
+
+	// The clusters take turns.
+	clusterName, uids := takePendingDeletes(2)
+	assert.Equal(t, "c1", clusterName)
+	assert.Equal(t, 2, len(uids))
+	clusterName, uids = takePendingDeletes(2)
+	assert.Equal(t, "c2", clusterName)
+	assert.Equal(t, []string{"c2/a"}, uids)
+	clusterName, uids = takePendingDeletes(2)
+	assert.Equal(t, "c1", clusterName)
+	assert.Equal(t, 1, len(uids))
+	_, uids = takePendingDeletes(2)
+	assert.Empty(t, uids)
+}
+
+func TestDeleteNextPendingChunk(t *testing.T) {
+	useTestDatastore(t)
+	resetPendingDeletes()
+	defer resetPendingDeletes()
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a', kind:'pod', cluster:'c1'}), "+
+		"(:Pod {_uid:'c1/b', kind:'pod', cluster:'c1'}), (:Pod {_uid:'c1/c', kind:'pod', cluster:'c1'})")
+	assert.NoError(t, err)
+	QueueDeletes("c1", []string{"c1/a", "c1/b"})
+
+	assert.Equal(t, 2, deleteNextPendingChunk(ctx))
+	assert.Equal(t, 0, deleteNextPendingChunk(ctx))
+	result, err := Store.Query(ctx, "MATCH (n:Pod) RETURN n._uid")
+	assert.NoError(t, err)
+	uids := []string{}
+	for result.Next() {
+		uids = append(uids, result.Record().GetByIndex(0).(string))
+	}
+	sort.Strings(uids)
+	assert.Equal(t, []string{"c1/c"}, uids)
+	assert.Empty(t, PendingDeletes())
+}
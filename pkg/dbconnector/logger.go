@@ -0,0 +1,9 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import "github.com/open-cluster-management/search-aggregator/pkg/logging"
+
+// Logs of the datastore operations. The verbosity is set with the logging admin API.
+var logger = logging.Module("dbconnector")
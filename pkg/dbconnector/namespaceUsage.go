@@ -0,0 +1,193 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Resources of a namespace in a cluster and the sums of the requests and limits of its pods, stored as a
+// NamespaceUsage node so quota and utilization searches don't have to fetch every pod.
+type NamespaceUsage struct {
+	Cluster        string
+	Namespace      string
+	KindCounts     map[string]int
+	TotalResources int
+	Sums           map[string]float64 // Sums of the NAMESPACE_USAGE_PROPERTIES of the pods.
+}
+
+// Returns the pod properties summed for each namespace. Names that aren't valid properties are ignored.
+func namespaceUsageProperties() []string {
+	properties := []string{}
+	for _, property := range config.ParseList(config.Cfg.NamespaceUsageProperties) {
+		if !searchPropertyRegex.MatchString(property) {
+			logger.Warningf("Ignoring invalid property %q in NAMESPACE_USAGE_PROPERTIES", property)
+			continue
+		}
+		properties = append(properties, property)
+	}
+	return properties
+}
+
+// Reads a pod property as a number. Strings are Kubernetes quantities, e.g. 500m cpu is 0.5 and 1Ki memory is 1024.
+func usageValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		quantity, err := resource.ParseQuantity(v)
+		if err != nil {
+			return 0, false
+		}
+		return float64(quantity.MilliValue()) / 1000, true
+	}
+	return 0, false
+}
+
+// Computes the usage of each namespace with resources in a cluster, sorted by namespace.
+func ComputeNamespaceUsage(ctx context.Context, clusterName string) ([]NamespaceUsage, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	usages := make(map[string]*NamespaceUsage)
+	usage := func(namespace string) *NamespaceUsage {
+		u, ok := usages[namespace]
+		if !ok {
+			u = &NamespaceUsage{Cluster: clusterName, Namespace: namespace, KindCounts: make(map[string]int),
+				Sums: make(map[string]float64)}
+			usages[namespace] = u
+		}
+		return u
+	}
+
+	result, err := Store.Query(ctx, SanitizeQuery(
+		"MATCH (n {cluster:'%s'}) WHERE n.namespace IS NOT NULL RETURN n.namespace, n.kind, count(n)", clusterName))
+	if err != nil {
+		return nil, err
+	}
+	for result.Next() {
+		record := result.Record()
+		namespace := recordString(record.GetByIndex(0))
+		if count, ok := record.GetByIndex(2).(int); ok && namespace != "" {
+			u := usage(namespace)
+			u.KindCounts[recordString(record.GetByIndex(1))] += count
+			u.TotalResources += count
+		}
+	}
+
+	// The values are summed here, the collectors send the requests and limits as quantities.
+	properties := namespaceUsageProperties()
+	if len(properties) > 0 {
+		columns := make([]string, 0, len(properties))
+		for _, property := range properties {
+			columns = append(columns, "n."+property)
+		}
+		result, err = Store.Query(ctx, SanitizeQuery(
+			"MATCH (n:Pod {cluster:'%s'}) WHERE n.namespace IS NOT NULL RETURN n.namespace, ", clusterName)+
+			strings.Join(columns, ", "))
+		if err != nil {
+			return nil, err
+		}
+		for result.Next() {
+			record := result.Record()
+			namespace := recordString(record.GetByIndex(0))
+			if namespace == "" {
+				continue
+			}
+			u := usage(namespace)
+			for i, property := range properties {
+				if value, ok := usageValue(record.GetByIndex(i + 1)); ok {
+					u.Sums[property] += value
+				}
+			}
+		}
+	}
+
+	ret := make([]NamespaceUsage, 0, len(usages))
+	for _, u := range usages {
+		ret = append(ret, *u)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Namespace < ret[j].Namespace })
+	return ret, nil
+}
+
+// Returns the query creating or replacing the NamespaceUsage node of a namespace.
+func saveNamespaceUsageQuery(usage NamespaceUsage, updated time.Time) string {
+	kindCounts := make([]string, 0, len(usage.KindCounts))
+	for kind, count := range usage.KindCounts {
+		kindCounts = append(kindCounts, fmt.Sprintf("'%s=%d'", sanitizeValue(kind), count))
+	}
+	sort.Strings(kindCounts) // Sorting to make comparisons more predictable
+
+	// Visible to the users who can see the pods of the namespace.
+	rbacResource := Resource{
+		Properties: map[string]interface{}{
+			"cluster":           usage.Cluster,
+			"namespace":         usage.Namespace,
+			"_clusterNamespace": usage.Cluster,
+		},
+		ResourceString: "pods",
+	}
+	rbacResource.addRbacProperty()
+
+	sums := make([]string, 0, len(usage.Sums))
+	for property, sum := range usage.Sums {
+		sums = append(sums, fmt.Sprintf("u.%s = %s", property, strconv.FormatFloat(sum, 'f', -1, 64)))
+	}
+	sort.Strings(sums)
+
+	query := SanitizeQuery("MERGE (u:NamespaceUsage {_uid:'%s'}) SET u.kind = 'namespaceusage', u.name = '%s', "+
+		"u.namespace = '%s', u.managedCluster = '%s', u._rbac = '%s', u.totalResources = %d, u.updated = '%s', ",
+		"namespace-usage__"+usage.Cluster+"/"+usage.Namespace, usage.Namespace, usage.Namespace, usage.Cluster,
+		rbacResource.Properties["_rbac"], usage.TotalResources, updated.UTC().Format(time.RFC3339))
+	for _, sum := range sums {
+		query += sum + ", "
+	}
+	return query + "u.kindCounts = [" + strings.Join(kindCounts, ", ") + "]"
+}
+
+// Creates or replaces the NamespaceUsage nodes of a cluster, and deletes the ones of namespaces without resources.
+// The usage nodes don't have the cluster property, so they aren't counted or resynced with the cluster resources.
+func SaveNamespaceUsage(ctx context.Context, clusterName string, usages []NamespaceUsage) error {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	namespaces := make([]string, 0, len(usages))
+	for _, usage := range usages {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err = Store.Query(WithWrite(ctx), saveNamespaceUsageQuery(usage, now)); err != nil {
+			return err
+		}
+		namespaces = append(namespaces, fmt.Sprintf("'%s'", sanitizeValue(usage.Namespace)))
+	}
+	_, err = Store.Query(WithWrite(ctx), SanitizeQuery("MATCH (u:NamespaceUsage {managedCluster:'%s'}) ", clusterName)+
+		"WHERE NOT u.name IN ["+strings.Join(namespaces, ", ")+"] DELETE u")
+	return err
+}
+
+// Deletes the NamespaceUsage nodes of a cluster.
+func DeleteNamespaceUsage(ctx context.Context, clusterName string) error {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return err
+	}
+	_, err = Store.Query(WithWrite(ctx),
+		SanitizeQuery("MATCH (u:NamespaceUsage {managedCluster:'%s'}) DELETE u", clusterName))
+	return err
+}
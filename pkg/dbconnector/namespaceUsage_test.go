@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_usageValue(t *testing.T) {
+	for value, expected := range map[interface{}]float64{2: 2, 0.5: 0.5, "500m": 0.5, "1Ki": 1024, "2": 2} {
+		actual, ok := usageValue(value)
+		assert.True(t, ok, value)
+		assert.Equal(t, expected, actual, value)
+	}
+	_, ok := usageValue("lots")
+	assert.False(t, ok)
+	_, ok = usageValue(nil)
+	assert.False(t, ok)
+}
+
+func TestNamespaceUsage(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/p1', kind:'pod', cluster:'c1', namespace:'web', "+
+		"cpuRequest:'250m', memoryRequest:'64Mi'}), "+
+		"(:Pod {_uid:'c1/p2', kind:'pod', cluster:'c1', namespace:'web', cpuRequest:'1', cpuLimit:2}), "+
+		"(:Service {_uid:'c1/s1', kind:'service', cluster:'c1', namespace:'web'}), "+
+		"(:Pod {_uid:'c1/p3', kind:'pod', cluster:'c1', namespace:'db'}), "+
+		"(:Node {_uid:'c1/n1', kind:'node', cluster:'c1'}), "+
+		"(:NamespaceUsage {_uid:'namespace-usage__c1/old', name:'old', managedCluster:'c1'})")
+	assert.NoError(t, err)
+
+	usages, err := ComputeNamespaceUsage(ctx, "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(usages), "Cluster scoped resources aren't in a namespace")
+	assert.Equal(t, NamespaceUsage{Cluster: "c1", Namespace: "web", KindCounts: map[string]int{"pod": 2, "service": 1},
+		TotalResources: 3, Sums: map[string]float64{"cpuRequest": 1.25, "cpuLimit": 2, "memoryRequest": 67108864}},
+		usages[1])
+
+	assert.NoError(t, SaveNamespaceUsage(ctx, "c1", usages))
+	assert.Equal(t, 2, queryRows(t, "MATCH (u:NamespaceUsage {managedCluster:'c1'}) RETURN u"),
+		"The usage of namespaces without resources is deleted")
+	assert.Equal(t, 1, queryRows(t, "MATCH (u:NamespaceUsage) WHERE u.cpuRequest > 1 AND u.kind = 'namespaceusage' "+
+		"AND u._rbac = 'c1_null_pods' RETURN u"))
+
+	assert.NoError(t, DeleteNamespaceUsage(ctx, "c1"))
+	assert.Equal(t, 0, queryRows(t, "MATCH (u:NamespaceUsage) RETURN u"))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+const (
+	OWNED_BY_EDGE        = "ownedBy"     // From a resource to its direct owner.
+	OWNER_DEPTH_PROPERTY = "_ownerDepth" // Owners above the resource, only for the resources sent with an owner chain.
+)
+
+// An owner in the owner chain of a resource, from its ownerReferences.
+type OwnerReference struct {
+	UID  string `json:"uid"`
+	Kind string `json:"kind,omitempty"`
+}
+
+// Returns the ownedBy edge from the resource to its direct owner, false when it has no owner chain. Each owner
+// has its own edge to its owner, so the edges of the resources make up the ownership tree.
+func (r *Resource) OwnerEdge() (Edge, bool) {
+	if len(r.OwnerChain) == 0 {
+		return Edge{}, false
+	}
+	owner := r.OwnerChain[0]
+	return Edge{SourceUID: r.UID, SourceKind: r.Kind, DestUID: owner.UID, DestKind: owner.Kind,
+		EdgeType: OWNED_BY_EDGE}, true
+}
+
+// A resource owned directly or indirectly by the root of an ownership tree.
+type OwnedResource struct {
+	UID        string                 `json:"uid"`
+	Depth      int                    `json:"depth"` // Owners between the root and the resource, plus one.
+	Properties map[string]interface{} `json:"properties"`
+	Children   []*OwnedResource       `json:"children,omitempty"` // Resources it owns directly.
+}
+
+// Resources owned by a resource, e.g. the replicasets and pods of a deployment.
+type OwnershipTree struct {
+	UID       string           `json:"uid"`
+	Children  []*OwnedResource `json:"children"`
+	Count     int              `json:"count"`     // Owned resources in the tree.
+	Truncated bool             `json:"truncated"` // A level had more resources than the limit.
+}
+
+// Returns the resources owned by the resource with the UID, down to SEARCH_MAX_HOPS levels of owners. limit
+// bounds the resources returned at each level, no limit when 0. Only the resources the user can see are returned
+// with a non nil access.
+func OwnershipTreeOf(ctx context.Context, uid string, limit int, access *ResourceAccess) (OwnershipTree, error) {
+	tree := OwnershipTree{UID: uid, Children: []*OwnedResource{}}
+	related, err := RelatedResources(ctx, uid, RelatedOptions{
+		Depth:     config.Cfg.SearchMaxHops,
+		EdgeTypes: []string{OWNED_BY_EDGE},
+		Direction: EDGE_INCOMING,
+		HopLimit:  limit,
+		Access:    access,
+	})
+	if err != nil {
+		return tree, err
+	}
+	// The resources of a level are reached from the previous one, so their owner is already in the tree.
+	owned := make(map[string]*OwnedResource, len(related.Items))
+	for _, item := range related.Items {
+		resource := &OwnedResource{UID: item.UID, Depth: item.Hop, Properties: item.Properties}
+		owned[item.UID] = resource
+		if owner, ok := owned[item.FromUID]; ok {
+			owner.Children = append(owner.Children, resource)
+		} else {
+			tree.Children = append(tree.Children, resource)
+		}
+	}
+	tree.Count = len(related.Items)
+	tree.Truncated = related.Truncated
+	return tree, nil
+}
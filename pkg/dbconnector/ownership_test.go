@@ -0,0 +1,60 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnerEdge(t *testing.T) {
+	_, ok := (&Resource{UID: "c1/d", Kind: "Deployment"}).OwnerEdge()
+	assert.False(t, ok, "A resource without owner chain has no edge")
+
+	pod := &Resource{UID: "c1/p", Kind: "Pod",
+		OwnerChain: []OwnerReference{{UID: "c1/r", Kind: "ReplicaSet"}, {UID: "c1/d", Kind: "Deployment"}}}
+	edge, ok := pod.OwnerEdge()
+	assert.True(t, ok)
+	assert.Equal(t, Edge{SourceUID: "c1/p", SourceKind: "Pod", DestUID: "c1/r", DestKind: "ReplicaSet",
+		EdgeType: "ownedBy"}, edge)
+}
+
+func TestOwnershipTreeOf(t *testing.T) {
+	useTestDatastore(t)
+
+	// Two pods owned by a replicaset owned by a deployment, and a service related to the deployment.
+	_, err := Store.Query(context.Background(), "CREATE (d:Deployment {_uid:'c1/d', kind:'deployment'}), "+
+		"(r:ReplicaSet {_uid:'c1/r', kind:'replicaset', _ownerDepth:1}), "+
+		"(p1:Pod {_uid:'c1/p1', kind:'pod', _ownerDepth:2}), (p2:Pod {_uid:'c1/p2', kind:'pod', _ownerDepth:2}), "+
+		"(s:Service {_uid:'c1/s', kind:'service'}), "+
+		"(r)-[:ownedBy]->(d), (p1)-[:ownedBy]->(r), (p2)-[:ownedBy]->(r), (s)-[:usedBy]->(d)")
+	assert.NoError(t, err)
+
+	tree, err := OwnershipTreeOf(context.Background(), "c1/d", 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "c1/d", tree.UID)
+	assert.Equal(t, 3, tree.Count)
+	assert.False(t, tree.Truncated)
+	if assert.Len(t, tree.Children, 1) {
+		replicaSet := tree.Children[0]
+		assert.Equal(t, "c1/r", replicaSet.UID)
+		assert.Equal(t, 1, replicaSet.Depth)
+		assert.Len(t, replicaSet.Children, 2)
+		for _, pod := range replicaSet.Children {
+			assert.Equal(t, 2, pod.Depth)
+			assert.Equal(t, "pod", pod.Properties["kind"])
+		}
+	}
+
+	tree, err = OwnershipTreeOf(context.Background(), "c1/p1", 0, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, tree.Children, "A pod doesn't own anything")
+
+	tree, err = OwnershipTreeOf(context.Background(), "c1/d", 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tree.Count)
+	assert.True(t, tree.Truncated)
+}
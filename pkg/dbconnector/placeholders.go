@@ -0,0 +1,151 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+const (
+	PLACEHOLDER_KIND     = "Unknown"      // Kind and label of the placeholder nodes.
+	PLACEHOLDER_PROPERTY = "_placeholder" // true on the nodes standing in for resources that aren't synced yet.
+)
+
+// Tells whether the edges to resources that aren't in the graph go to placeholder nodes.
+func PlaceholdersEnabled() bool {
+	return config.Cfg.PlaceholderNodes == "true"
+}
+
+// Returns whether the node is a placeholder standing in for a resource that isn't synced yet.
+func IsPlaceholder(properties map[string]interface{}) bool {
+	placeholder, _ := properties[PLACEHOLDER_PROPERTY].(bool)
+	return placeholder
+}
+
+// Creates a placeholder node for each destination of the edges that isn't in the graph.
+// Returns the destinations that are placeholders, the new ones and the ones from previous syncs.
+func insertPlaceholders(ctx context.Context, edges []Edge, clusterName string) (map[string]bool, error) {
+	destUIDs := make([]string, 0, len(edges))
+	seen := make(map[string]bool, len(edges))
+	for _, edge := range edges {
+		if !seen[edge.DestUID] {
+			seen[edge.DestUID] = true
+			destUIDs = append(destUIDs, edge.DestUID)
+		}
+	}
+	placeholders := make(map[string]bool)
+	chunkSize := ChunkSize()
+	for i := 0; i < len(destUIDs); i += chunkSize {
+		chunk := destUIDs[i:min(i+chunkSize, len(destUIDs))]
+		result, err := Store.Query(ctx, fmt.Sprintf("MATCH (d) WHERE d._uid IN %s RETURN d._uid, d.%s",
+			quotedList(chunk), PLACEHOLDER_PROPERTY))
+		if err != nil {
+			return placeholders, err
+		}
+		existing := make(map[string]bool, len(chunk))
+		for result.Next() {
+			record := result.Record()
+			uid := recordString(record.GetByIndex(0))
+			existing[uid] = true
+			if placeholder, _ := record.GetByIndex(1).(bool); placeholder {
+				placeholders[uid] = true
+			}
+		}
+		nodes := []string{}
+		for _, uid := range chunk {
+			if !existing[uid] {
+				nodes = append(nodes, SanitizeQuery("(:%s {_uid:'%s', kind:'%s', cluster:'%s', %s:true})",
+					PLACEHOLDER_KIND, uid, PLACEHOLDER_KIND, clusterName, PLACEHOLDER_PROPERTY))
+			}
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+		if _, err = Store.Query(WithWrite(ctx), "CREATE "+strings.Join(nodes, ", ")); err != nil {
+			return placeholders, err
+		}
+		logger.V(3).Infof("Created %d placeholder nodes for cluster %s.", len(nodes), clusterName)
+		for _, uid := range chunk {
+			if !existing[uid] {
+				placeholders[uid] = true
+			}
+		}
+	}
+	return placeholders, nil
+}
+
+// Deletes the placeholders of the resources and returns their edges, to insert them again once the resources are
+// in the graph.
+func takeOverPlaceholders(ctx context.Context, resources []*Resource) ([]Edge, error) {
+	uids := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		uids = append(uids, resource.UID)
+	}
+	edges := []Edge{}
+	chunkSize := ChunkSize()
+	for i := 0; i < len(uids); i += chunkSize {
+		match := fmt.Sprintf("MATCH (p:%s) WHERE p.%s = true AND p._uid IN %s", PLACEHOLDER_KIND,
+			PLACEHOLDER_PROPERTY, quotedList(uids[i:min(i+chunkSize, len(uids))]))
+		result, err := Store.Query(ctx, strings.Replace(match, "(p:", "(s)-[e]->(p:", 1)+
+			" RETURN s._uid, type(e), p._uid")
+		if err != nil {
+			return edges, err
+		}
+		chunkEdges := 0
+		for result.Next() {
+			record := result.Record()
+			// The kind property of a node doesn't always match its label, so the edges are matched by UID only.
+			edges = append(edges, Edge{SourceUID: recordString(record.GetByIndex(0)),
+				EdgeType: recordString(record.GetByIndex(1)), DestUID: recordString(record.GetByIndex(2))})
+			chunkEdges++
+		}
+		deleted, err := Store.Query(WithWrite(ctx), match+" DELETE p")
+		if err != nil {
+			return edges, err
+		}
+		if deleted.NodesDeleted() > 0 {
+			logger.V(3).Infof("Replacing %d placeholder nodes with their resources, moving %d edges.",
+				deleted.NodesDeleted(), chunkEdges)
+		}
+	}
+	return edges, nil
+}
+
+// Deletes the placeholders of the cluster without edges, once the resources pointing to them are gone.
+// Returns the number of placeholders deleted.
+func DeleteOrphanPlaceholders(ctx context.Context, clusterName string) (int, error) {
+	if !PlaceholdersEnabled() {
+		return 0, nil
+	}
+	match := SanitizeQuery("MATCH (p:%s {cluster:'%s'}) WHERE p.%s = true", PLACEHOLDER_KIND, clusterName,
+		PLACEHOLDER_PROPERTY)
+	all, err := Store.Query(ctx, match+" RETURN p._uid")
+	if err != nil {
+		return 0, err
+	}
+	orphans := make(map[string]bool)
+	for all.Next() {
+		orphans[recordString(all.Record().GetByIndex(0))] = true
+	}
+	if len(orphans) == 0 {
+		return 0, nil
+	}
+	referenced, err := Store.Query(ctx, strings.Replace(match, "(p:", "(s)-[e]->(p:", 1)+" RETURN p._uid")
+	if err != nil {
+		return 0, err
+	}
+	for referenced.Next() {
+		delete(orphans, recordString(referenced.Record().GetByIndex(0)))
+	}
+	uids := make([]string, 0, len(orphans))
+	for uid := range orphans {
+		uids = append(uids, uid)
+	}
+	result := ChunkedDelete(ctx, uids)
+	return result.SuccessfulResources, result.Err()
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaceholders(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "MERGE (c:Cluster {name: 'c1', kind: 'cluster'})")
+	assert.NoError(t, err)
+	resource := func(kind, name string) *Resource {
+		return &Resource{Kind: kind, UID: "c1/" + name, Properties: map[string]interface{}{
+			"kind": kind, "name": name, "namespace": "default", "cluster": "c1"}}
+	}
+	assert.Equal(t, 1, ChunkedInsert(ctx, []*Resource{resource("Pod", "p")}, "c1").SuccessfulResources)
+	toConfigMap := Edge{SourceUID: "c1/p", SourceKind: "Pod", EdgeType: "usedBy", DestUID: "c1/cm",
+		DestKind: "ConfigMap"}
+
+	config.Cfg.PlaceholderNodes = "false"
+	assert.Equal(t, 0, ChunkedInsertEdge(ctx, []Edge{toConfigMap}, "c1").EdgesAdded, "Dropped without placeholders")
+	assert.Equal(t, 0, queryRows(t, "MATCH (n:Unknown) RETURN n"))
+
+	config.Cfg.PlaceholderNodes = "true"
+	toSecret := Edge{SourceUID: "c1/p", SourceKind: "Pod", EdgeType: "usedBy", DestUID: "c1/s", DestKind: "Secret"}
+	result := ChunkedInsertEdge(ctx, []Edge{toConfigMap, toSecret}, "c1")
+	assert.NoError(t, result.Err())
+	assert.Equal(t, 2, result.EdgesAdded)
+	assert.Equal(t, 2, queryRows(t, "MATCH (:Pod)-[:usedBy]->(n:Unknown {cluster:'c1', kind:'Unknown'}) "+
+		"WHERE n._placeholder = true RETURN n"))
+
+	// The configmap arrives and takes over the edge of its placeholder.
+	assert.Equal(t, 1, ChunkedInsert(ctx, []*Resource{resource("ConfigMap", "cm")}, "c1").SuccessfulResources)
+	assert.Equal(t, 1, queryRows(t, "MATCH (:Pod {_uid:'c1/p'})-[:usedBy]->(n:ConfigMap {_uid:'c1/cm'}) RETURN n"))
+	assert.Equal(t, 1, queryRows(t, "MATCH (n {_uid:'c1/cm'}) RETURN n"), "The placeholder is gone")
+	assert.Equal(t, 1, queryRows(t, "MATCH (n:Unknown) RETURN n"))
+
+	deleted, err := DeleteOrphanPlaceholders(ctx, "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted, "The secret placeholder still has its edge")
+
+	// Once the pod is gone, so is the secret placeholder.
+	assert.NoError(t, ChunkedDelete(ctx, []string{"c1/p"}).Err())
+	deleted, err = DeleteOrphanPlaceholders(ctx, "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, 0, queryRows(t, "MATCH (n:Unknown) RETURN n"))
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const hubClusterName = "local-cluster" // Cluster of the root policies, their bindings and their placement rules.
+
+// Edges of the policy enrichment, from the policies and placements on the hub to the clusters and resources they
+// target. Compliance searches, e.g. the clusters violating a policy, are one hop from the root policy.
+const (
+	PolicyPropagatedEdge = "propagatedTo"  // Root policy to the clusters it's propagated to.
+	PolicyViolatedEdge   = "violatedBy"    // Root policy to the clusters that aren't compliant with it.
+	PolicyReplicaEdge    = "replicatedAs"  // Root policy to its replicas in the managed clusters.
+	BindingPolicyEdge    = "binds"         // PlacementBinding to the policies in its subjects.
+	BindingPlacementEdge = "usesPlacement" // PlacementBinding to its PlacementRule.
+	PlacementClusterEdge = "placesOn"      // PlacementRule to the clusters in its decisions.
+)
+
+// Types of the policy edges, in the order they're written.
+var PolicyEdgeTypes = []string{PolicyPropagatedEdge, PolicyViolatedEdge, PolicyReplicaEdge, BindingPolicyEdge,
+	BindingPlacementEdge, PlacementClusterEdge}
+
+// Reads a list property, the graph returns lists and older collectors send comma separated strings.
+func listProperty(value interface{}) []string {
+	items := []string{}
+	switch typed := value.(type) {
+	case []interface{}:
+		for _, item := range typed {
+			if s, ok := item.(string); ok && s != "" {
+				items = append(items, s)
+			}
+		}
+	case string:
+		for _, item := range strings.Split(typed, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// Splits the name of a replicated policy, <root namespace>.<root name>, into the namespace/name of its root.
+// Namespaces can't have dots, so the root namespace ends at the first one.
+func rootPolicyKey(replicaName string) (string, bool) {
+	i := strings.Index(replicaName, ".")
+	if i <= 0 || i == len(replicaName)-1 {
+		return "", false
+	}
+	return replicaName[:i] + "/" + replicaName[i+1:], true
+}
+
+// Computes the policy edges from the graph, sorted by type and UIDs.
+//   - The replicas of a root policy in the cluster namespaces of the hub are its status: the root policy is
+//     propagatedTo each of those clusters, and violatedBy the ones where its replica is NonCompliant.
+//   - The root policy is replicatedAs the policy with the replica name in each managed cluster. A cluster without
+//     a replica on the hub gets its edges from that policy instead.
+//   - A PlacementBinding binds the policies of its subjects and usesPlacement its placementRef, and a
+//     PlacementRule placesOn the clusters of its decisions, all in the namespace of the binding or the rule.
+func PolicyEdges(ctx context.Context) ([]Edge, error) {
+	clusterNames, err := ClusterNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make(map[string]bool, len(clusterNames))
+	for _, name := range clusterNames {
+		clusters[name] = true
+	}
+
+	hubPolicies, err := Store.Query(ctx, SanitizeQuery(
+		"MATCH (n:Policy {cluster:'%s'}) RETURN n._uid, n.namespace, n.name, n.compliant", hubClusterName))
+	if err != nil {
+		return nil, err
+	}
+	type replica struct{ uid, namespace, name, compliant string }
+	roots := make(map[string]string) // namespace/name -> UID
+	replicas := []replica{}
+	for hubPolicies.Next() {
+		record := hubPolicies.Record()
+		p := replica{recordString(record.GetByIndex(0)), recordString(record.GetByIndex(1)),
+			recordString(record.GetByIndex(2)), recordString(record.GetByIndex(3))}
+		roots[p.namespace+"/"+p.name] = p.uid
+		if clusters[p.namespace] {
+			replicas = append(replicas, p)
+		}
+	}
+
+	edges := []Edge{}
+	propagated := make(map[string]bool) // root UID/cluster with compliance from the hub.
+	addPropagated := func(rootUID, clusterName, compliant string) {
+		if propagated[rootUID+"/"+clusterName] {
+			return
+		}
+		propagated[rootUID+"/"+clusterName] = true
+		edges = append(edges, Edge{SourceUID: rootUID, SourceKind: "Policy", EdgeType: PolicyPropagatedEdge,
+			DestUID: "cluster__" + clusterName, DestKind: "Cluster"})
+		if compliant == "NonCompliant" {
+			edges = append(edges, Edge{SourceUID: rootUID, SourceKind: "Policy", EdgeType: PolicyViolatedEdge,
+				DestUID: "cluster__" + clusterName, DestKind: "Cluster"})
+		}
+	}
+	for _, p := range replicas {
+		key, ok := rootPolicyKey(p.name)
+		if rootUID, found := roots[key]; ok && found && rootUID != p.uid {
+			addPropagated(rootUID, p.namespace, p.compliant)
+		}
+	}
+
+	managedPolicies, err := Store.Query(ctx, SanitizeQuery(
+		"MATCH (n:Policy) WHERE n.cluster <> '%s' RETURN n._uid, n.cluster, n.name, n.compliant", hubClusterName))
+	if err != nil {
+		return nil, err
+	}
+	for managedPolicies.Next() {
+		record := managedPolicies.Record()
+		key, ok := rootPolicyKey(recordString(record.GetByIndex(2)))
+		rootUID, found := roots[key]
+		if !ok || !found {
+			continue
+		}
+		edges = append(edges, Edge{SourceUID: rootUID, SourceKind: "Policy", EdgeType: PolicyReplicaEdge,
+			DestUID: recordString(record.GetByIndex(0)), DestKind: "Policy"})
+		if clusterName := recordString(record.GetByIndex(1)); clusters[clusterName] {
+			addPropagated(rootUID, clusterName, recordString(record.GetByIndex(3)))
+		}
+	}
+
+	rules, err := Store.Query(ctx, SanitizeQuery(
+		"MATCH (n:PlacementRule {cluster:'%s'}) RETURN n._uid, n.namespace, n.name, n.decisions", hubClusterName))
+	if err != nil {
+		return nil, err
+	}
+	placementRules := make(map[string]string) // namespace/name -> UID
+	for rules.Next() {
+		record := rules.Record()
+		uid := recordString(record.GetByIndex(0))
+		placementRules[recordString(record.GetByIndex(1))+"/"+recordString(record.GetByIndex(2))] = uid
+		for _, clusterName := range listProperty(record.GetByIndex(3)) {
+			if clusters[clusterName] {
+				edges = append(edges, Edge{SourceUID: uid, SourceKind: "PlacementRule", EdgeType: PlacementClusterEdge,
+					DestUID: "cluster__" + clusterName, DestKind: "Cluster"})
+			}
+		}
+	}
+
+	bindings, err := Store.Query(ctx, SanitizeQuery(
+		"MATCH (n:PlacementBinding {cluster:'%s'}) RETURN n._uid, n.namespace, n.placementRef, n.subjects",
+		hubClusterName))
+	if err != nil {
+		return nil, err
+	}
+	for bindings.Next() {
+		record := bindings.Record()
+		uid, namespace := recordString(record.GetByIndex(0)), recordString(record.GetByIndex(1))
+		if ruleUID, ok := placementRules[namespace+"/"+recordString(record.GetByIndex(2))]; ok {
+			edges = append(edges, Edge{SourceUID: uid, SourceKind: "PlacementBinding", EdgeType: BindingPlacementEdge,
+				DestUID: ruleUID, DestKind: "PlacementRule"})
+		}
+		for _, policy := range listProperty(record.GetByIndex(3)) {
+			if policyUID, ok := roots[namespace+"/"+policy]; ok {
+				edges = append(edges, Edge{SourceUID: uid, SourceKind: "PlacementBinding", EdgeType: BindingPolicyEdge,
+					DestUID: policyUID, DestKind: "Policy"})
+			}
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].EdgeType != edges[j].EdgeType {
+			return edges[i].EdgeType < edges[j].EdgeType
+		}
+		if edges[i].SourceUID != edges[j].SourceUID {
+			return edges[i].SourceUID < edges[j].SourceUID
+		}
+		return edges[i].DestUID < edges[j].DestUID
+	})
+	return edges, nil
+}
+
+// Writes the policy edges of the graph with the instance, then deletes the ones of the other instances. Each chunk
+// of edges of a type is unwound from a parameter, like the edge deletes. Returns the number of edges created.
+// e.g. CYPHER edges=[["local-cluster/p","cluster__c1"]] UNWIND $edges AS edge
+// MATCH (s:Policy {_uid: edge[0]}), (d:Cluster {_uid: edge[1]}) CREATE (s)-[:propagatedTo {...}]->(d)
+func BuildPolicyEdges(ctx context.Context, instance int) (int, error) {
+	edges, err := PolicyEdges(ctx)
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+	chunkSize := ChunkSize()
+	for start := 0; start < len(edges); {
+		end := start
+		for end < len(edges) && end-start < chunkSize && edges[end].EdgeType == edges[start].EdgeType &&
+			edges[end].SourceKind == edges[start].SourceKind && edges[end].DestKind == edges[start].DestKind {
+			end++
+		}
+		chunk := edges[start:end]
+		uids := make([]interface{}, 0, len(chunk))
+		for _, edge := range chunk {
+			uids = append(uids, []interface{}{edge.SourceUID, edge.DestUID})
+		}
+		/* #nosec G201 - Input is sanitized. */
+		query := paramsHeader(map[string]interface{}{"edges": uids}) + SanitizeQuery(
+			"UNWIND $edges AS edge MATCH (s:%s {_uid: edge[0]}), (d:%s {_uid: edge[1]}) CREATE (s)-[:%s ",
+			chunk[0].SourceKind, chunk[0].DestKind, chunk[0].EdgeType) +
+			InterClusterEdgeProperties(chunk[0].EdgeType, instance) + "]->(d)"
+		result, err := Store.Query(WithWrite(ctx), query)
+		if err != nil {
+			return created, err
+		}
+		created += result.RelationshipsCreated()
+		ObserveEdgeType(chunk[0].EdgeType)
+		start = end
+	}
+	for _, edgeType := range PolicyEdgeTypes {
+		_, err = Store.Query(WithWrite(ctx), SanitizeQuery(
+			"MATCH ()-[e:%s {_interCluster:true}]->() WHERE e.app_instance<>%d DELETE e", edgeType, instance))
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// Tells whether a change to a resource of the kind can change the policy edges.
+func IsPolicyKind(kind interface{}) bool {
+	switch fmt.Sprint(kind) {
+	case "Policy", "PlacementBinding", "PlacementRule":
+		return true
+	}
+	return false
+}
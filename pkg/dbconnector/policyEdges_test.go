@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rootPolicyKey(t *testing.T) {
+	key, ok := rootPolicyKey("policies.require-labels.v2")
+	assert.True(t, ok)
+	assert.Equal(t, "policies/require-labels.v2", key)
+	for _, name := range []string{"require-labels", ".p", "policies."} {
+		_, ok = rootPolicyKey(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestBuildPolicyEdges(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE "+
+		"(:Cluster {_uid:'cluster__local-cluster', kind:'cluster', name:'local-cluster'}), "+
+		"(:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Cluster {_uid:'cluster__c2', kind:'cluster', name:'c2'}), "+
+		"(:Policy {_uid:'local-cluster/root', cluster:'local-cluster', namespace:'policies', name:'p'}), "+
+		"(:Policy {_uid:'local-cluster/r1', cluster:'local-cluster', namespace:'c1', name:'policies.p', "+
+		"compliant:'NonCompliant'}), "+
+		"(:Policy {_uid:'local-cluster/r2', cluster:'local-cluster', namespace:'c2', name:'policies.p', "+
+		"compliant:'Compliant'}), "+
+		"(:Policy {_uid:'c1/p', cluster:'c1', namespace:'c1', name:'policies.p', compliant:'NonCompliant'}), "+
+		"(:Policy {_uid:'c2/other', cluster:'c2', namespace:'c2', name:'policies.other'}), "+
+		"(:PlacementRule {_uid:'local-cluster/rule', cluster:'local-cluster', namespace:'policies', name:'rule', "+
+		"decisions:['c1', 'c2', 'gone']}), "+
+		"(:PlacementBinding {_uid:'local-cluster/binding', cluster:'local-cluster', namespace:'policies', "+
+		"placementRef:'rule', subjects:['p', 'missing']})")
+	assert.NoError(t, err)
+
+	edges, err := PolicyEdges(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Edge{
+		{SourceUID: "local-cluster/binding", SourceKind: "PlacementBinding", EdgeType: BindingPolicyEdge,
+			DestUID: "local-cluster/root", DestKind: "Policy"},
+		{SourceUID: "local-cluster/rule", SourceKind: "PlacementRule", EdgeType: PlacementClusterEdge,
+			DestUID: "cluster__c1", DestKind: "Cluster"},
+		{SourceUID: "local-cluster/rule", SourceKind: "PlacementRule", EdgeType: PlacementClusterEdge,
+			DestUID: "cluster__c2", DestKind: "Cluster"},
+		{SourceUID: "local-cluster/root", SourceKind: "Policy", EdgeType: PolicyPropagatedEdge,
+			DestUID: "cluster__c1", DestKind: "Cluster"},
+		{SourceUID: "local-cluster/root", SourceKind: "Policy", EdgeType: PolicyPropagatedEdge,
+			DestUID: "cluster__c2", DestKind: "Cluster"},
+		{SourceUID: "local-cluster/root", SourceKind: "Policy", EdgeType: PolicyReplicaEdge,
+			DestUID: "c1/p", DestKind: "Policy"},
+		{SourceUID: "local-cluster/binding", SourceKind: "PlacementBinding", EdgeType: BindingPlacementEdge,
+			DestUID: "local-cluster/rule", DestKind: "PlacementRule"},
+		{SourceUID: "local-cluster/root", SourceKind: "Policy", EdgeType: PolicyViolatedEdge,
+			DestUID: "cluster__c1", DestKind: "Cluster"},
+	}, edges)
+
+	created, err := BuildPolicyEdges(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, len(edges), created)
+	assert.Equal(t, 1, queryRows(t,
+		"MATCH (p:Policy {name:'p'})-[:violatedBy]->(c:Cluster) WHERE c.name = 'c1' RETURN c"))
+
+	// The next build replaces the edges of the previous one.
+	_, err = Store.Query(ctx, "MATCH (n:Policy {_uid:'local-cluster/r1'}) SET n.compliant = 'Compliant'")
+	assert.NoError(t, err)
+	created, err = BuildPolicyEdges(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, len(edges)-1, created)
+	assert.Equal(t, 0, queryRows(t, "MATCH (p:Policy)-[:violatedBy]->(c:Cluster) RETURN c"))
+	assert.Equal(t, 2, queryRows(t, "MATCH (p:Policy)-[e:propagatedTo {_interCluster:true}]->(c:Cluster) RETURN e"))
+	assert.Equal(t, 2, queryRows(t, "MATCH (r:PlacementRule)-[e:placesOn {_rule:'placement-decisions', "+
+		"_sourceHub:'local-cluster'}]->(c:Cluster) RETURN e"), "The edges have the rule that created them.")
+}
@@ -16,33 +16,81 @@ import (
 	"crypto/x509"
 	"io/ioutil"
 	"net"
-	"time"
+	"os"
 
-	"github.com/golang/glog"
 	"github.com/gomodule/redigo/redis"
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/memgraph"
 )
 
 // A global redis pool for other parts of this package to use
 var Pool *redis.Pool
 
 const (
-	IDLE_TIMEOUT = 60 // ReadinessProbe runs every 30 seconds, this keeps the connection alive between probe intervals.
-	GRAPH_NAME   = "search-db"
+	GRAPH_NAME = "search-db"
 )
 
 // Initializes the pool using functions in this file.
 // Also initializes the Store interface.
 func init() {
-	Pool = &redis.Pool{
-		MaxIdle:      10, // Idle connections are connections that have been returned to the pool.
-		MaxActive:    20, // Active connections = connections in-use + idle connections
-		Dial:         getRedisConnection,
-		TestOnBorrow: validateRedisConnection,
-		Wait:         true,
+	Pool = newPool("primary", getRedisConnection)
+	bulkSlots = make(chan struct{}, bulkLaneSize(Pool.MaxActive))
+	Store = RedisGraphStoreV2{}
+
+	if config.Cfg.Datastore == "memory" {
+		logger.Warning("Using the in-memory datastore. Data is lost when the aggregator restarts.")
+		Pool.Dial = memgraph.NewServer().Dial
+	}
+
+	if config.Cfg.DualWriteEnabled == "true" {
+		Store = newDualWriteStore()
+	}
+}
+
+// Replaces the datastore with a new in-memory graph, as DATASTORE=memory does, returns the function restoring the
+// previous one. Used by the tests of the behavior only the in-memory datastore has, e.g. the regular expressions.
+func UseMemgraph() (restore func()) {
+	return useDatastore(memgraph.NewServer().Dial)
+}
+
+// Replaces the datastore for the tests of the packages writing to it, returns the function restoring the previous
+// one. The datastore is a new in-memory graph, or the RedisGraph at REDISGRAPH_TEST_ADDRESS, e.g. localhost:6379,
+// flushed first, so the same tests prove the queries against RedisGraph in CI. The packages share the RedisGraph,
+// `make test-redisgraph` runs them one at a time.
+func UseTestDatastore() (restore func()) {
+	address := os.Getenv("REDISGRAPH_TEST_ADDRESS")
+	if address == "" {
+		return UseMemgraph()
 	}
+	dial := func() (redis.Conn, error) { return redis.Dial("tcp", address) }
+	if err := flushTestDatastore(dial); err != nil {
+		logger.Errorf("Error flushing the RedisGraph at REDISGRAPH_TEST_ADDRESS %s: %s", address, err)
+	}
+	return useDatastore(dial)
+}
+
+func useDatastore(dial func() (redis.Conn, error)) (restore func()) {
+	prevPool, prevStore := Pool, Store
+	Pool = &redis.Pool{Dial: dial}
 	Store = RedisGraphStoreV2{}
+	resetKindLabels()
+	return func() {
+		if err := Pool.Close(); err != nil {
+			logger.Warning("Error closing the pool of the test datastore: ", err)
+		}
+		Pool, Store = prevPool, prevStore
+		resetKindLabels()
+	}
+}
 
+func flushTestDatastore(dial func() (redis.Conn, error)) error {
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("FLUSHDB")
+	return err
 }
 
 func getRedisConnection() (redis.Conn, error) {
@@ -57,8 +105,12 @@ func getRedisConnection() (redis.Conn, error) {
 		port = config.Cfg.RedisPort
 		sslEnabled = false
 	}
+	return dialRedis(host, port, sslEnabled, config.Cfg.RedisPassword)
+}
 
-	glog.V(2).Infof("Initializing Redis client with Host: %s, Port: %s, using SSL: %t", host, port, sslEnabled)
+// Opens a new connection to the redis at host:port and authenticates it if a password is given.
+func dialRedis(host, port string, sslEnabled bool, password string) (redis.Conn, error) {
+	logger.V(2).Infof("Initializing Redis client with Host: %s, Port: %s, using SSL: %t", host, port, sslEnabled)
 
 	tlsconf := &tls.Config{
 		MinVersion:               tls.VersionTLS12,
@@ -75,11 +127,11 @@ func getRedisConnection() (redis.Conn, error) {
 	if certErr != nil {
 		if sslEnabled {
 			// If REDIS_SSL_PORT was provided we assume that SSL is required.
-			glog.Error("REDIS_SSH_PORT is configured, but can't load cert. ", certErr)
+			logger.Error("REDIS_SSH_PORT is configured, but can't load cert. ", certErr)
 			return nil, certErr
 		} else {
-			glog.Warning("Using insecure Redis connection.")
-			glog.Warning("To enable SSL provide REDIS_SSL_PORT and ./rediscert/redis.crt")
+			logger.Warning("Using insecure Redis connection.")
+			logger.Warning("To enable SSL provide REDIS_SSL_PORT and ./rediscert/redis.crt")
 		}
 	} else {
 		caCertPool := x509.NewCertPool()
@@ -92,34 +144,24 @@ func getRedisConnection() (redis.Conn, error) {
 		redis.DialTLSConfig(tlsconf),
 		redis.DialUseTLS(sslEnabled))
 	if err != nil {
-		glog.Error("Error connecting redis. Original error: ", err)
+		logger.Error("Error connecting redis. Original error: ", err)
 		return nil, err
 	}
 
 	// If a password is provided, then use it to authenticate the Redis connection.
-	if config.Cfg.RedisPassword != "" {
-		glog.V(2).Info("Authenticating Redis client using password from REDIS_PASSWORD.")
-		if _, err := redisConn.Do("AUTH", config.Cfg.RedisPassword); err != nil {
-			glog.Error("Error authenticating Redis client. Original error: ", err)
+	if password != "" {
+		logger.V(2).Info("Authenticating Redis client using the configured password.")
+		if _, err := redisConn.Do("AUTH", password); err != nil {
+			logger.Error("Error authenticating Redis client. Original error: ", err)
 			connError := redisConn.Close()
 			if connError != nil {
-				glog.Warning("Failed to close redis connection. Original error: ", connError)
+				logger.Warning("Failed to close redis connection. Original error: ", connError)
 			}
 			return nil, err
 		}
 	} else {
-		glog.Warning("REDIS_PASSWORD wasn't provided. Attempting to communicate without authentication.")
+		logger.Warning("Redis password wasn't provided. Attempting to communicate without authentication.")
 	}
 
 	return redisConn, nil
 }
-
-// Used by the pool to test if redis connections are still okay. If they have been idle for less than a minute,
-// just assumes they are okay. If not, calls PING.
-func validateRedisConnection(c redis.Conn, t time.Time) error {
-	if time.Since(t) < IDLE_TIMEOUT*time.Second {
-		return nil
-	}
-	_, err := c.Do("PING")
-	return err
-}
@@ -3,11 +3,48 @@
 package dbconnector
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/gomodule/redigo/redis"
 	assert "github.com/stretchr/testify/assert"
 )
 
+// Runs the test against a new in-memory datastore, or the RedisGraph at REDISGRAPH_TEST_ADDRESS when it's set.
+func useTestDatastore(t testing.TB) {
+	t.Cleanup(UseTestDatastore())
+}
+
+// Runs the test against a new in-memory datastore, for the behavior RedisGraph doesn't have.
+func useMemgraph(t testing.TB) {
+	t.Cleanup(UseMemgraph())
+}
+
+// Runs the test against a new graph of the RedisGraph at REDISGRAPH_TEST_ADDRESS, e.g. localhost:6379, for the
+// behavior the in-memory datastore can't prove. Skips the test when it isn't set. The graph is deleted afterwards.
+func useRedisGraph(t *testing.T) {
+	address := os.Getenv("REDISGRAPH_TEST_ADDRESS")
+	if address == "" {
+		t.Skip("REDISGRAPH_TEST_ADDRESS isn't set")
+	}
+	pool := &redis.Pool{Dial: func() (redis.Conn, error) { return redis.Dial("tcp", address) }}
+	graph := fmt.Sprintf("search-db-test-%d", time.Now().UnixNano())
+	prevStore := Store
+	Store = RedisGraphStoreV2{pool: pool, graph: graph}
+	t.Cleanup(func() {
+		Store = prevStore
+		conn := pool.Get()
+		defer conn.Close()
+		if _, err := conn.Do("GRAPH.DELETE", graph); err != nil {
+			t.Log("Error deleting the test graph ", graph, ": ", err)
+		}
+		pool.Close()
+	})
+}
+
 // NOTE: These tests assume that RedisGraph is not running locally.
 // We need a way to mock RedisGraph.
 
@@ -17,3 +54,44 @@ func Test_getRedisConnection(t *testing.T) {
 	assert.Nil(t, conn, "Redis Connection")
 	assert.NotNil(t, err, "Redis Conn Error")
 }
+
+// Runs the store functions against the in-memory datastore.
+func Test_memoryDatastore(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "MERGE (c:Cluster {name: 'memory-cluster', kind: 'cluster'}) SET c.status = 'OK'")
+	assert.Nil(t, err)
+	resources := []*Resource{
+		{Kind: "pod", UID: "memory-cluster/pod1", Properties: map[string]interface{}{
+			"kind": "pod", "name": "pod1", "namespace": "default", "cluster": "memory-cluster"}},
+		{Kind: "pod", UID: "memory-cluster/pod2", Properties: map[string]interface{}{
+			"kind": "pod", "name": "pod2", "namespace": "default", "cluster": "memory-cluster"}},
+	}
+	insertResult := ChunkedInsert(ctx, resources, "memory-cluster")
+	assert.Nil(t, insertResult.ConnectionError)
+	assert.Equal(t, 2, insertResult.SuccessfulResources)
+
+	edgeResult := ChunkedInsertEdge(ctx, []Edge{{SourceUID: "memory-cluster/pod1", DestUID: "memory-cluster/pod2",
+		EdgeType: "ownedBy", SourceKind: "pod", DestKind: "pod"}}, "memory-cluster")
+	assert.Equal(t, 1, edgeResult.EdgesAdded)
+
+	total, err := TotalNodes(ctx, "memory-cluster")
+	assert.Nil(t, err)
+	assert.True(t, total.Next())
+	assert.Equal(t, 2, total.Record().GetByIndex(0))
+
+	deleteResult := ChunkedDelete(ctx, []string{"memory-cluster/pod1"})
+	assert.Equal(t, 1, deleteResult.SuccessfulResources)
+	edges, err := TotalIntraEdges(ctx, "memory-cluster")
+	assert.Nil(t, err)
+	assert.True(t, edges.Next())
+	assert.Equal(t, 0, edges.Record().GetByIndex(0))
+
+	now := time.Now()
+	assert.Nil(t, RecordSyncStats(ctx, "memory-cluster", SyncStats{Timestamp: now, Added: 2}))
+	history, err := SyncHistory(ctx, "memory-cluster", now.Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, 2, history[0].Added)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Progress of a chunked operation, reported after each chunk.
+type ChunkProgress struct {
+	Op         string        // insert, update, delete, insert edge or delete edge.
+	Chunk      int           // Chunks done so far, starting at 1.
+	Chunks     int           // Chunks of the operation, 0 when not known up front (edges are grouped by source).
+	Done       int           // Resources in the chunks done so far.
+	Total      int           // Resources of the operation.
+	Successful int           // Resources written so far.
+	Errors     int           // Resources rejected so far.
+	Elapsed    time.Duration // Since the operation started.
+}
+
+// Called with the progress of the chunked operations using the context. Runs in the goroutine of the operation,
+// or of one of its shards with CHUNK_PARALLELISM, one call at a time. It must return quickly.
+type ProgressFunc func(ChunkProgress)
+
+type progressKey struct{}
+
+// Returns a context reporting the progress of the chunked operations to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// Tracks the progress of one chunked operation.
+type chunkTracker struct {
+	mutex    sync.Mutex // The shards of an operation report their chunks at the same time.
+	ctx      context.Context
+	progress ChunkProgress
+	start    time.Time
+}
+
+func newChunkTracker(ctx context.Context, op string, total, chunkSize int) *chunkTracker {
+	chunks := 0
+	if chunkSize > 0 {
+		chunks = (total + chunkSize - 1) / chunkSize
+	}
+	return &chunkTracker{ctx: ctx, progress: ChunkProgress{Op: op, Chunks: chunks, Total: total}, start: time.Now()}
+}
+
+// Records a chunk of the given number of resources and reports it to the ProgressFunc of the context, if any.
+func (t *chunkTracker) chunkDone(resources, successful, errors int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.progress.Chunk++
+	t.progress.Done += resources
+	t.progress.Successful += successful
+	t.progress.Errors += errors
+	t.progress.Elapsed = time.Since(t.start)
+	metrics.ChunkedOperationChunks.WithLabelValues(t.progress.Op).Inc()
+	if fn, ok := t.ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(t.progress)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedOperationProgress(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.ChunkSize = 2
+	_, err := Store.Query(context.Background(), "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'})")
+	assert.NoError(t, err)
+
+	resources := make([]*Resource, 0, 5)
+	for i := 0; i < 5; i++ {
+		uid := fmt.Sprintf("c1/pod%d", i)
+		resources = append(resources, &Resource{Kind: "Pod", UID: uid,
+			Properties: map[string]interface{}{"kind": "Pod", "name": uid}})
+	}
+	var reports []ChunkProgress
+	ctx := WithProgress(context.Background(), func(p ChunkProgress) { reports = append(reports, p) })
+	result := ChunkedInsert(ctx, resources, "c1")
+	assert.NoError(t, result.Err())
+	assert.Equal(t, 3, len(reports))
+	last := reports[2]
+	assert.Equal(t, ChunkProgress{Op: "insert", Chunk: 3, Chunks: 3, Done: 5, Total: 5, Successful: 5,
+		Elapsed: last.Elapsed}, last)
+
+	// Canceling the context stops the operation before the next chunk.
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reports = nil
+	ctx = WithProgress(cancelCtx, func(p ChunkProgress) {
+		reports = append(reports, p)
+		cancel()
+	})
+	uids := []string{"c1/pod0", "c1/pod1", "c1/pod2", "c1/pod3", "c1/pod4"}
+	result = ChunkedDelete(ctx, uids)
+	assert.Error(t, result.ConnectionError)
+	assert.Equal(t, 2, result.SuccessfulResources)
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, 3, queryRows(t, "MATCH (n:Pod) RETURN n"))
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+)
+
+// Returns the indexed properties by node label.
+func PropertyIndexes(ctx context.Context) (map[string][]string, error) {
+	result, err := Store.Query(ctx, "CALL db.indexes() YIELD label, properties")
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[string][]string)
+	for result.Next() {
+		record := result.Record()
+		label, _ := record.GetByIndex(0).(string)
+		properties, _ := record.GetByIndex(1).([]interface{})
+		for _, property := range properties {
+			if name, ok := property.(string); ok {
+				indexes[label] = append(indexes[label], name)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// Creates an index on the property of the nodes with the label, nothing happens when it exists.
+func CreatePropertyIndex(ctx context.Context, label, property string) error {
+	return insertIndex(ctx, label, property)
+}
+
+// Returns the number of nodes with the label.
+func LabelNodeCount(ctx context.Context, label string) (int, error) {
+	return queryCount(ctx, SanitizeQuery("MATCH (n:%s) RETURN count(n)", label))
+}
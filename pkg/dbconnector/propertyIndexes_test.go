@@ -0,0 +1,29 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropertyIndexes(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a', kind:'pod'}), (:Pod {_uid:'c1/b', kind:'pod'})")
+	assert.NoError(t, err)
+
+	assert.NoError(t, CreatePropertyIndex(ctx, "Pod", "status"))
+	assert.NoError(t, CreatePropertyIndex(ctx, "Pod", "status"))
+	assert.NoError(t, CreatePropertyIndex(ctx, "Node", "name"))
+	indexes, err := PropertyIndexes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"Pod": {"status"}, "Node": {"name"}}, indexes)
+
+	count, err := LabelNodeCount(ctx, "Pod")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
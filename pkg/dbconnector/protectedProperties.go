@@ -0,0 +1,150 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+const (
+	HASH_PREFIX    = "hmac-sha256:" // Prefix of the hashed property values.
+	REDACTED_VALUE = "REDACTED"     // Value stored for the redacted properties.
+)
+
+// Properties hashed or redacted at ingest, from HASHED_PROPERTIES and REDACTED_PROPERTIES.
+// Each entry is a property name, applied to all kinds, or kind.property, e.g. secret.name
+type protectedProperties struct {
+	hashedConfig, redactedConfig string          // Config the sets were parsed from.
+	hashed, redacted             map[string]bool // Keyed by property and kind.property, lowercased.
+}
+
+var (
+	protected      protectedProperties
+	protectedMutex = sync.Mutex{}
+)
+
+func parseProtectedProperties(value string) map[string]bool {
+	properties := make(map[string]bool)
+	for _, property := range config.ParseList(value) {
+		properties[strings.ToLower(property)] = true
+	}
+	return properties
+}
+
+// Returns the protected properties for the current config, parsing it again when it changed.
+func currentProtectedProperties() protectedProperties {
+	protectedMutex.Lock()
+	defer protectedMutex.Unlock()
+	if protected.hashed == nil || protected.hashedConfig != config.Cfg.HashedProperties ||
+		protected.redactedConfig != config.Cfg.RedactedProperties {
+		protected = protectedProperties{
+			hashedConfig:   config.Cfg.HashedProperties,
+			redactedConfig: config.Cfg.RedactedProperties,
+			hashed:         parseProtectedProperties(config.Cfg.HashedProperties),
+			redacted:       parseProtectedProperties(config.Cfg.RedactedProperties),
+		}
+		if len(protected.hashed) > 0 && config.Cfg.PropertyHashKey == "" {
+			logger.Warning("PROPERTY_HASH_KEY is not set, the properties in HASHED_PROPERTIES are redacted instead.")
+		}
+	}
+	return protected
+}
+
+func (p protectedProperties) matches(set map[string]bool, kind, property string) bool {
+	property = strings.ToLower(property)
+	return set[property] || set[strings.ToLower(kind)+"."+property]
+}
+
+// Returns the keyed hash of the value, so it can be matched exactly by search without being readable.
+func HashValue(value string) string {
+	mac := hmac.New(sha256.New, []byte(config.Cfg.PropertyHashKey))
+	mac.Write([]byte(value)) // #nosec G104 - Write on a hash never returns an error.
+	return HASH_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Tells whether the property is hashed for all kinds, or for one of the kinds a search is restricted to. Used to hash
+// the values searched. kinds are lowercased, nil when the search matches every kind, so secret.name doesn't change
+// the searches of the names of the other kinds.
+func isHashedProperty(kinds []string, property string) bool {
+	if config.Cfg.PropertyHashKey == "" {
+		return false
+	}
+	p := currentProtectedProperties()
+	property = strings.ToLower(property)
+	if p.hashed[property] {
+		return true
+	}
+	for _, kind := range kinds {
+		if p.hashed[kind+"."+property] {
+			return true
+		}
+	}
+	return false
+}
+
+// Hashes or redacts the configured properties of the resource. Lists and maps, e.g. labels,
+// have each value hashed and keep their keys. The resources are protected once, their chunk is bisected or retried
+// with the values already hashed, and the searches only match the hash of the original value.
+func (r *Resource) protectProperties() {
+	p := currentProtectedProperties()
+	if r.protected || len(p.hashed) == 0 && len(p.redacted) == 0 {
+		return
+	}
+	r.protected = true
+	kind, _ := r.Properties["kind"].(string)
+	for property, value := range r.Properties {
+		if property == "kind" || property == "cluster" || strings.HasPrefix(property, "_") {
+			continue // Needed to build the graph and for RBAC.
+		}
+		if p.matches(p.redacted, kind, property) {
+			r.Properties[property] = protectValue(value, func(string) string { return REDACTED_VALUE })
+		} else if p.matches(p.hashed, kind, property) {
+			if config.Cfg.PropertyHashKey == "" {
+				r.Properties[property] = protectValue(value, func(string) string { return REDACTED_VALUE })
+			} else {
+				r.Properties[property] = protectValue(value, HashValue)
+			}
+		}
+	}
+}
+
+// Returns a copy of the resource with the configured properties hashed or redacted, as they're stored. Used to
+// compare the resource with its node without changing the properties that are written.
+func (r *Resource) Protected() *Resource {
+	protectedResource := *r
+	protectedResource.Properties = make(map[string]interface{}, len(r.Properties))
+	for property, value := range r.Properties {
+		protectedResource.Properties[property] = value
+	}
+	protectedResource.protectProperties()
+	return &protectedResource
+}
+
+func protectValue(value interface{}, protect func(string) string) interface{} {
+	switch typed := value.(type) {
+	case string:
+		return protect(typed)
+	case []interface{}:
+		protectedList := make([]interface{}, len(typed))
+		for i, e := range typed {
+			protectedList[i] = protectValue(e, protect)
+		}
+		return protectedList
+	case map[string]interface{}:
+		protectedMap := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			protectedMap[k] = protectValue(v, protect)
+		}
+		return protectedMap
+	default: // Numbers and booleans are hashed as their string value.
+		return protect(fmt.Sprintf("%v", value))
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func setProtectedProperties(t *testing.T, hashed, redacted, key string) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.HashedProperties, config.Cfg.RedactedProperties, config.Cfg.PropertyHashKey = hashed, redacted, key
+}
+
+func Test_protectProperties(t *testing.T) {
+	setProtectedProperties(t, "secret.name, label", "email", "test-key")
+
+	secret := Resource{Kind: "Secret", UID: "c1/s", Properties: map[string]interface{}{
+		"kind": "Secret", "name": "db-password", "namespace": "default", "email": "user@example.com",
+		"label": map[string]interface{}{"owner": "user"}, "_rbac": "default_null_secrets"}}
+	secret.protectProperties()
+	assert.Equal(t, HashValue("db-password"), secret.Properties["name"])
+	assert.True(t, strings.HasPrefix(secret.Properties["name"].(string), HASH_PREFIX))
+	assert.Equal(t, "default", secret.Properties["namespace"])
+	assert.Equal(t, REDACTED_VALUE, secret.Properties["email"])
+	assert.Equal(t, map[string]interface{}{"owner": HashValue("user")}, secret.Properties["label"])
+	assert.Equal(t, "default_null_secrets", secret.Properties["_rbac"])
+
+	pod := Resource{Kind: "Pod", UID: "c1/p", Properties: map[string]interface{}{"kind": "Pod", "name": "web"}}
+	pod.protectProperties()
+	assert.Equal(t, "web", pod.Properties["name"], "Only the name of secrets is hashed")
+}
+
+func Test_protectProperties_bisectedChunk(t *testing.T) {
+	setProtectedProperties(t, "name", "", "test-key")
+	prevStore := Store
+	defer func() { Store = prevStore }()
+	Store = failingStore{}
+	resources := []*Resource{
+		{Kind: "Pod", UID: "good", Properties: map[string]interface{}{"kind": "Pod", "name": "web"}},
+		{Kind: "Pod", UID: "bad", Properties: map[string]interface{}{"kind": "Pod", "name": "db"}},
+	}
+
+	// The chunk fails and each half is inserted again, then the failed resource is retried.
+	result := ChunkedInsert(context.Background(), resources, "c1")
+	assert.Equal(t, 1, result.SuccessfulResources)
+	ChunkedInsert(context.Background(), resources[1:], "c1")
+	assert.Equal(t, HashValue("web"), resources[0].Properties["name"], "The hash isn't hashed again")
+	assert.Equal(t, HashValue("db"), resources[1].Properties["name"])
+
+	// A value sent with the prefix of the hashes is hashed like any other.
+	spoofed := Resource{Kind: "Pod", UID: "c1/p", Properties: map[string]interface{}{"kind": "Pod",
+		"name": HASH_PREFIX + "web"}}
+	spoofed.protectProperties()
+	assert.Equal(t, HashValue(HASH_PREFIX+"web"), spoofed.Properties["name"])
+}
+
+func Test_protectProperties_withoutKey(t *testing.T) {
+	setProtectedProperties(t, "name", "", "")
+
+	pod := Resource{Kind: "Pod", UID: "c1/p", Properties: map[string]interface{}{"kind": "Pod", "name": "web"}}
+	pod.protectProperties()
+	assert.Equal(t, REDACTED_VALUE, pod.Properties["name"])
+	assert.False(t, isHashedProperty(nil, "name"), "Searches can't match redacted values")
+}
+
+func Test_HashValue(t *testing.T) {
+	setProtectedProperties(t, "", "", "key1")
+	hashed := HashValue("value")
+	assert.Equal(t, hashed, HashValue("value"))
+	config.Cfg.PropertyHashKey = "key2"
+	assert.NotEqual(t, hashed, HashValue("value"))
+}
+
+func TestCompileSearchHashedProperties(t *testing.T) {
+	useRegexMatch(t)
+	setProtectedProperties(t, "secret.name,label", "", "test-key")
+
+	compiled, err := CompileSearch("kind:secret name:db-password label:owner=user status:Running")
+	assert.NoError(t, err)
+	expected := "MATCH (n) WHERE (n.kind = 'secret')" +
+		" AND ((n.name = 'db-password' OR n.name = '" + HashValue("db-password") + "'))" +
+		" AND (('owner=user' IN n.label OR 'owner=" + HashValue("user") + "' IN n.label))" +
+		" AND (n.status = 'Running') RETURN n"
+	assert.Equal(t, expected, compiled.Query)
+
+	compiled, err = CompileSearch("kind:secret,configmap name:!db-password")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.kind IN ['secret', 'configmap']) AND "+
+		"((n.name <> 'db-password' AND n.name <> '"+HashValue("db-password")+"')) RETURN n", compiled.Query)
+	_, err = CompileSearch("kind:secret name:~db-.*")
+	assert.Error(t, err)
+
+	// secret.name only applies to the searches restricted to secrets.
+	for _, search := range []string{"name:db-password", "kind:pod name:db-password", "kind:!pod name:db-password"} {
+		compiled, err = CompileSearch(search)
+		assert.NoError(t, err)
+		assert.NotContains(t, compiled.Query, HashValue("db-password"), search)
+	}
+	compiled, err = CompileSearch("kind:pod name:~db-.*")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.kind = 'pod') AND (n.name =~ 'db-.*') RETURN n", compiled.Query)
+	compiled, err = CompileSearch("namespace:a,b")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.namespace IN ['a', 'b']) RETURN n", compiled.Query)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Redis key of the sorted set holding the quarantined clusters, as a single entry, so they're kept across restarts.
+const QUARANTINE_KEY = "search-aggregator:quarantined-clusters"
+
+// A cluster whose syncs are rejected until an operator lifts the quarantine. Its resources stay searchable.
+type ClusterQuarantine struct {
+	Cluster string    `json:"cluster"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// Stores the quarantined clusters, replacing the previous ones.
+func SaveQuarantines(ctx context.Context, quarantines []ClusterQuarantine) error {
+	entry, err := json.Marshal(quarantines)
+	if err != nil {
+		return err
+	}
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.Send("MULTI")
+	_ = conn.Send("DEL", QUARANTINE_KEY)
+	if len(quarantines) > 0 {
+		_ = conn.Send("ZADD", QUARANTINE_KEY, timeScore(time.Now()), entry)
+	}
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// Returns the quarantined clusters.
+func Quarantines(ctx context.Context) ([]ClusterQuarantine, error) {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	entries, err := redis.ByteSlices(conn.Do("ZRANGEBYSCORE", QUARANTINE_KEY, "-inf", "+inf"))
+	quarantines := []ClusterQuarantine{}
+	if err != nil || len(entries) == 0 {
+		return quarantines, err
+	}
+	err = json.Unmarshal(entries[len(entries)-1], &quarantines)
+	return quarantines, err
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Max queries kept by a trace, so a large resync doesn't hold all its queries in memory.
+const maxTracedQueries = 1000
+
+// A query run with a traced context, as sent to the datastore.
+type TracedQuery struct {
+	Query      string  `json:"query"`
+	DurationMS float64 `json:"durationMS"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Collects the queries run with a context, to debug a single sync or search.
+type QueryTrace struct {
+	mutex   sync.Mutex
+	queries []TracedQuery
+	dropped int
+}
+
+type queryTraceKey struct{}
+
+// Returns a context recording the queries run with it in the returned trace.
+func WithQueryTrace(ctx context.Context) (context.Context, *QueryTrace) {
+	trace := &QueryTrace{}
+	return context.WithValue(ctx, queryTraceKey{}, trace), trace
+}
+
+// Returns the queries recorded so far, in the order they completed.
+func (t *QueryTrace) Queries() []TracedQuery {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.dropped > 0 {
+		logger.Warningf("Query trace dropped %d queries after the first %d", t.dropped, maxTracedQueries)
+	}
+	return append([]TracedQuery{}, t.queries...)
+}
+
+// Records a query completed with the context, if it's traced.
+func traceQuery(ctx context.Context, query string, start time.Time, err error) {
+	trace, ok := ctx.Value(queryTraceKey{}).(*QueryTrace)
+	if !ok {
+		return
+	}
+	traced := TracedQuery{Query: query, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		traced.Error = err.Error()
+	}
+	trace.mutex.Lock()
+	defer trace.mutex.Unlock()
+	if len(trace.queries) >= maxTracedQueries {
+		trace.dropped++
+		return
+	}
+	trace.queries = append(trace.queries, traced)
+}
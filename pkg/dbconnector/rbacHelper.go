@@ -11,8 +11,6 @@ package dbconnector
 
 import (
 	"strings"
-
-	"github.com/golang/glog"
 )
 
 // The rbac string is defined as "namespace_apigroup_kind".  For non-namespaced resources
@@ -36,7 +34,7 @@ func (r *Resource) addRbacProperty() {
 		default:
 			// rbac[0] is already initialized to the string "null".
 			if t != nil {
-				glog.Warning("Property 'namespace' must be a string or nil.  Got invalid value from resource: ", r)
+				logger.Warning("Property 'namespace' must be a string or nil.  Got invalid value from resource: ", r)
 			}
 		}
 	} else {
@@ -48,7 +46,7 @@ func (r *Resource) addRbacProperty() {
 		default:
 			// rbac[0] is already initialized to the string "null".
 			if t != nil {
-				glog.Warning("Property '_clusterNamespace' must be a string or nil.  Got invalid value from resource: ", r)
+				logger.Warning("Property '_clusterNamespace' must be a string or nil.  Got invalid value from resource: ", r)
 			}
 		}
 	}
@@ -62,13 +60,13 @@ func (r *Resource) addRbacProperty() {
 	default:
 		// rbac[1] is already initialized to the string "null".
 		if t != nil {
-			glog.Warning("Property 'apigroup' must be a string or nil. Got invalid value from resource: ", r)
+			logger.Warning("Property 'apigroup' must be a string or nil. Got invalid value from resource: ", r)
 		}
 	}
 
 	// Get the kind.
 	if r.ResourceString == "" {
-		glog.Warning("Received a resource with an empty ResourceString.  Resource: ", r)
+		logger.Warning("Received a resource with an empty ResourceString.  Resource: ", r)
 	}
 	rbac[2] = r.ResourceString
 
@@ -0,0 +1,160 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Returned by the writes to the graph while the aggregator is read-only. Retryable, the writes go through once the
+// read-only mode ends.
+var ErrReadOnly = fmt.Errorf("%w: the aggregator is read-only, writes to the graph are rejected", ErrRetryable)
+
+// Points below READ_ONLY_MEMORY_PERCENT the memory of Redis must go before the automatic read-only mode ends, so it
+// doesn't flap around the threshold.
+const readOnlyMemoryHysteresis = 5
+
+// Read-only mode of the aggregator. The writes to the graph are rejected with ErrReadOnly, the reads and searches
+// are served from the existing data.
+type ReadOnlyMode struct {
+	Enabled bool      `json:"enabled"`
+	Manual  bool      `json:"manual"`           // Enabled with the admin API, until it's disabled with it.
+	Reason  string    `json:"reason,omitempty"` // Why it's enabled.
+	Since   time.Time `json:"since,omitempty"`
+	// Used memory of Redis from its last check, and the fraction of maxmemory used. 0 when it wasn't checked.
+	MemoryUsed        int64   `json:"memoryUsed,omitempty"`
+	MemoryMax         int64   `json:"memoryMax,omitempty"`
+	MemoryUtilization float64 `json:"memoryUtilization,omitempty"`
+}
+
+var (
+	readOnlyManual  ReadOnlyMode // Set by the admin API.
+	readOnlyMemory  ReadOnlyMode // Set by the memory checks.
+	readOnlyMutex   = sync.RWMutex{}
+	readOnlyEnabled bool // True while either mode is enabled.
+)
+
+// Returns the read-only mode, the manual one when both are enabled.
+func CurrentReadOnlyMode() ReadOnlyMode {
+	readOnlyMutex.RLock()
+	defer readOnlyMutex.RUnlock()
+	mode := readOnlyMemory
+	if readOnlyManual.Enabled {
+		mode.Enabled, mode.Manual, mode.Reason, mode.Since = true, true, readOnlyManual.Reason, readOnlyManual.Since
+	}
+	return mode
+}
+
+// Returns true while the writes to the graph are rejected.
+func IsReadOnly() bool {
+	readOnlyMutex.RLock()
+	defer readOnlyMutex.RUnlock()
+	return readOnlyEnabled
+}
+
+// Enables or disables the manual read-only mode. The automatic one stays enabled while the memory of Redis is above
+// READ_ONLY_MEMORY_PERCENT.
+func SetReadOnly(enabled bool, reason string, now time.Time) ReadOnlyMode {
+	readOnlyMutex.Lock()
+	if enabled && reason == "" {
+		reason = "Enabled by an admin."
+	}
+	if enabled != readOnlyManual.Enabled {
+		readOnlyManual = ReadOnlyMode{Enabled: enabled, Manual: true, Since: now}
+		if enabled {
+			logger.Warning("The aggregator is read-only, enabled by an admin: ", reason)
+		} else {
+			logger.Info("Disabled the manual read-only mode.")
+		}
+	}
+	if enabled {
+		readOnlyManual.Reason = reason
+	}
+	updateReadOnly()
+	readOnlyMutex.Unlock()
+	return CurrentReadOnlyMode()
+}
+
+// Updates the automatic read-only mode with the memory used by Redis, enabled above READ_ONLY_MEMORY_PERCENT of
+// maxmemory and disabled once it's readOnlyMemoryHysteresis points below. Unchanged when maxmemory isn't set.
+func RecordRedisMemory(used, max int64, now time.Time) ReadOnlyMode {
+	readOnlyMutex.Lock()
+	readOnlyMemory.MemoryUsed, readOnlyMemory.MemoryMax = used, max
+	threshold := float64(config.Cfg.ReadOnlyMemoryPercent)
+	if max > 0 {
+		readOnlyMemory.MemoryUtilization = float64(used) / float64(max)
+		metrics.RedisMemoryUtilization.Set(readOnlyMemory.MemoryUtilization)
+		percent := readOnlyMemory.MemoryUtilization * 100
+		switch {
+		case threshold > 0 && !readOnlyMemory.Enabled && percent >= threshold:
+			readOnlyMemory.Enabled, readOnlyMemory.Since = true, now
+			readOnlyMemory.Reason = fmt.Sprintf("Redis uses %.0f%% of its maxmemory, READ_ONLY_MEMORY_PERCENT is %d.",
+				percent, config.Cfg.ReadOnlyMemoryPercent)
+			logger.Warning("The aggregator is read-only: ", readOnlyMemory.Reason)
+		case readOnlyMemory.Enabled && (threshold <= 0 || percent < threshold-readOnlyMemoryHysteresis):
+			readOnlyMemory.Enabled, readOnlyMemory.Since, readOnlyMemory.Reason = false, now, ""
+			logger.Infof("Disabled the read-only mode, Redis uses %.0f%% of its maxmemory.", percent)
+		}
+	}
+	updateReadOnly()
+	readOnlyMutex.Unlock()
+	return CurrentReadOnlyMode()
+}
+
+// The caller holds the write lock.
+func updateReadOnly() {
+	readOnlyEnabled = readOnlyManual.Enabled || readOnlyMemory.Enabled
+	if readOnlyEnabled {
+		metrics.ReadOnly.Set(1)
+	} else {
+		metrics.ReadOnly.Set(0)
+	}
+}
+
+// Returns the used_memory and maxmemory of Redis, from INFO memory. maxmemory is 0 when it isn't set.
+func RedisMemory(ctx context.Context) (int64, int64, error) {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	info, err := redis.String(conn.Do("INFO", "memory"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseMemoryInfo(info)
+}
+
+func parseMemoryInfo(info string) (int64, int64, error) {
+	var used, max int64
+	found := false
+	for _, line := range strings.Split(info, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 || (parts[0] != "used_memory" && parts[0] != "maxmemory") {
+			continue
+		}
+		value, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s in the memory info of redis: %s", parts[0], parts[1])
+		}
+		if parts[0] == "used_memory" {
+			used, found = value, true
+		} else {
+			max = value
+		}
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("no used_memory in the memory info of redis")
+	}
+	return used, max, nil
+}
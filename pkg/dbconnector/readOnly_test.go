@@ -0,0 +1,68 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	defer func() {
+		SetReadOnly(false, "", time.Now())
+		RecordRedisMemory(0, 0, time.Now())
+		readOnlyMemory = ReadOnlyMode{}
+		updateReadOnly()
+	}()
+	ctx := context.Background()
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a', kind:'pod'})")
+	assert.NoError(t, err)
+
+	mode := SetReadOnly(true, "", time.Now())
+	assert.True(t, mode.Enabled)
+	assert.True(t, mode.Manual)
+	assert.Equal(t, "Enabled by an admin.", mode.Reason)
+	_, err = Store.Query(WithWrite(ctx), "CREATE (:Pod {_uid:'c1/b', kind:'pod'})")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.True(t, IsRetryable(err), "The collectors retry the syncs later.")
+	count, err := queryCount(ctx, "MATCH (n:Pod) RETURN count(n)")
+	assert.NoError(t, err, "The reads are still served.")
+	assert.Equal(t, 1, count)
+	assert.False(t, SetReadOnly(false, "", time.Now()).Enabled)
+	_, err = Store.Query(WithWrite(ctx), "CREATE (:Pod {_uid:'c1/b', kind:'pod'})")
+	assert.NoError(t, err)
+
+	// The memory of Redis enables it from READ_ONLY_MEMORY_PERCENT, until it's 5 points below.
+	config.Cfg.ReadOnlyMemoryPercent = 90
+	assert.False(t, RecordRedisMemory(80, 100, time.Now()).Enabled)
+	mode = RecordRedisMemory(92, 100, time.Now())
+	assert.True(t, mode.Enabled)
+	assert.False(t, mode.Manual)
+	assert.Equal(t, 0.92, mode.MemoryUtilization)
+	assert.True(t, RecordRedisMemory(86, 100, time.Now()).Enabled)
+	assert.True(t, SetReadOnly(false, "", time.Now()).Enabled, "The manual mode doesn't disable the automatic one.")
+	assert.False(t, RecordRedisMemory(84, 100, time.Now()).Enabled)
+	assert.False(t, RecordRedisMemory(100, 0, time.Now()).Enabled, "Ignored without maxmemory.")
+
+	config.Cfg.ReadOnlyMemoryPercent = 0
+	assert.False(t, RecordRedisMemory(100, 100, time.Now()).Enabled, "Disabled without READ_ONLY_MEMORY_PERCENT.")
+}
+
+func Test_parseMemoryInfo(t *testing.T) {
+	used, max, err := parseMemoryInfo("# Memory\r\nused_memory:1024\r\nused_memory_human:1.00K\r\nmaxmemory:4096\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), used)
+	assert.Equal(t, int64(4096), max)
+
+	_, _, err = parseMemoryInfo("# Memory\r\nmaxmemory:4096\r\n")
+	assert.Error(t, err)
+	_, _, err = parseMemoryInfo("used_memory:many\r\n")
+	assert.Error(t, err)
+}
@@ -11,15 +11,23 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
-	"github.com/golang/glog"
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
 var Store DBStore
 
+// Shortest timeout of a query, so a context about to expire still bounds the wait for the reply.
+const minQueryTimeout = 10 * time.Millisecond
+
 // Interface for the DB dependency. Used for mocking rg.
 type DBStore interface {
-	Query(q string) (*rg2.QueryResult, error)
+	Query(ctx context.Context, q string) (*rg2.QueryResult, error)
 }
 
 type QueryResult struct {
@@ -29,24 +37,180 @@ type QueryResult struct {
 
 //type QueryResult rg2.QueryResult
 
-type RedisGraphStoreV2 struct{}
+type RedisGraphStoreV2 struct {
+	pool  *redis.Pool // Uses the global Pool when nil.
+	graph string      // Uses GRAPH_NAME when empty.
+	gated bool        // The caller applies the write gates and the lane, e.g. DualWriteStore.
+}
 
 // Executes the given query against redisgraph.
 // Called by the other functions in this file
-// Not fully implemented
-func (RedisGraphStoreV2) Query(q string) (*rg2.QueryResult, error) {
+// Returns early with the context error if the context is done before the query completes. The connection, lane slot
+// and write gates are released when the query finishes, bounded by the query timeout, which RedisGraph also applies
+// when it supports it so a canceled query doesn't keep running on the server.
+// Queries run with a context from WithQueryTrace are recorded in the trace, including the wait for a connection.
+// Queries run with a context from WithGraph use its graph, unless the store has one.
+// Queries on the primary graph are measured for CurrentWriteLoad.
+// Queries run with a context from withReadQuery are sent as GRAPH.RO_QUERY, those from WithWrite pass the write gates.
+func (s RedisGraphStoreV2) Query(ctx context.Context, q string) (result *rg2.QueryResult, err error) {
+	start := time.Now()
+	defer func() { traceQuery(ctx, q, start, err) }()
+	p := Pool
+	if s.pool != nil {
+		p = s.pool
+	}
+	graph := GRAPH_NAME
+	if s.graph != "" {
+		graph = s.graph
+	} else if ctxGraph := graphFromContext(ctx); ctxGraph != "" {
+		graph = ctxGraph
+	}
+	if s.pool == nil && graph == GRAPH_NAME {
+		defer observeWriteLoad(ctx, start)
+	}
+	releaseWrite := func() {}
+	if s.pool == nil && !s.gated {
+		var err error
+		if releaseWrite, err = acquireWriteGates(ctx, q, graph); err != nil {
+			return &rg2.QueryResult{}, err
+		}
+	}
+	// Bulk queries wait for a slot of their lane first, so they can't take the connections reserved for deltas.
+	lane := LaneFromContext(ctx)
+	waitStart := time.Now()
+	releaseLane := func() {}
+	if s.pool == nil && !s.gated {
+		var err error
+		if releaseLane, err = acquireLane(ctx); err != nil {
+			releaseWrite()
+			logger.Warning("Query canceled while waiting for a connection in the ", lane, " lane: ", err)
+			return &rg2.QueryResult{}, err
+		}
+	}
+	release := func() {
+		releaseLane()
+		releaseWrite()
+	}
 	// Get connection from the pool
-	conn := Pool.Get() // This will block if there aren't any valid connections that are available.
-	defer conn.Close()
-	g := rg2.Graph{
-		Conn: conn,
-		Id:   GRAPH_NAME,
+	// This will block until a connection is available or the context is done.
+	conn, err := p.GetContext(ctx)
+	metrics.ConnectionWaitSeconds.WithLabelValues(lane.String()).Observe(time.Since(waitStart).Seconds())
+	if err != nil {
+		release()
+		logger.Error("Error getting a connection to RedisGraph V2 : ", err)
+		return &rg2.QueryResult{}, err
+	}
+	// The pool can return a connection after the context is done.
+	if err := ctx.Err(); err != nil {
+		if closeErr := conn.Close(); closeErr != nil {
+			logger.Warning("Failed to close redis connection. Original error: ", closeErr)
+		}
+		release()
+		logger.Warning("Query canceled while waiting for a connection: ", err)
+		return &rg2.QueryResult{}, err
+	}
+	timeout := queryTimeout(ctx)
+	serverTimeout := time.Duration(0)
+	if CurrentGraphFeatures().QueryTimeout {
+		serverTimeout = timeout
+	}
+
+	type queryResponse struct {
+		result *rg2.QueryResult
+		err    error
+	}
+	done := make(chan queryResponse, 1)
+	go func() {
+		defer release()
+		defer conn.Close()
+		var graphConn redis.Conn = timeoutConn{Conn: conn, timeout: timeout}
+		if config.Cfg.FaultInjectionEnabled == "true" {
+			graphConn = faultConn{Conn: graphConn, write: isWriteContext(ctx)}
+		}
+		g := rg2.Graph{
+			Conn: graphConn,
+			Id:   graph,
+		}
+		command := "GRAPH.QUERY"
+		if isReadQueryContext(ctx) {
+			command = "GRAPH.RO_QUERY"
+		}
+		result, err := graphQuery(&g, command, q, serverTimeout)
+		done <- queryResponse{result, err}
+	}()
+
+	select {
+	case resp := <-done:
+		if resp.err != nil {
+			logger.Error("Error fetching results from RedisGraph V2 : ", resp.err)
+			logger.V(4).Info("Failed query: ", q)
+		}
+		return resp.result, resp.err
+	case <-ctx.Done():
+		logger.Warning("Query canceled before completion: ", ctx.Err())
+		logger.V(4).Info("Canceled query: ", q)
+		return &rg2.QueryResult{}, ctx.Err()
 	}
-	result, err := g.Query(q)
+}
+
+// Returns the timeout of a query, QUERY_TIMEOUT_MS or the time left before the deadline of the context when it's
+// sooner. Never less than minQueryTimeout, a timeout of 0 would wait for the reply forever.
+func queryTimeout(ctx context.Context) time.Duration {
+	timeout := time.Duration(config.QueryTimeoutMS()) * time.Millisecond
+	if deadline, ok := ctx.Deadline(); ok && (timeout == 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+		if timeout < minQueryTimeout {
+			timeout = minQueryTimeout
+		}
+	}
+	return timeout
+}
+
+type writeQueryKey struct{}
+
+// Returns a context marking its queries as writes, the callers mark every query that modifies the graph. The writes
+// are sent to both datastores in dual write mode, rejected while the aggregator is read-only, and wait for the write
+// budget and a running compaction.
+func WithWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writeQueryKey{}, true)
+}
+
+func isWriteContext(ctx context.Context) bool {
+	write, _ := ctx.Value(writeQueryKey{}).(bool)
+	return write
+}
+
+// Applies the gates of the writes to the primary graph before they hold a connection. They are rejected while the
+// aggregator is read-only, wait while the write budget is exceeded, then wait while a compaction copies the graph.
+// Returns the release of the compaction gate.
+func acquireWriteGates(ctx context.Context, q string, graph string) (func(), error) {
+	if graph != GRAPH_NAME || !isWriteContext(ctx) {
+		return func() {}, nil
+	}
+	if IsReadOnly() {
+		return nil, ErrReadOnly
+	}
+	if err := acquireWriteBudget(ctx, q); err != nil {
+		logger.Warning("Query canceled while waiting for the write budget: ", err)
+		return nil, err
+	}
+	releaseWrite, err := acquireWrite(ctx)
 	if err != nil {
-		glog.Error("Error fetching results from RedisGraph V2 : ", err)
-		glog.V(4).Info("Failed query: ", q)
+		logger.Warning("Query canceled while waiting for the compaction to complete: ", err)
+		return nil, err
 	}
-	return result, err
+	return releaseWrite, nil
+}
+
+// Wraps a redis connection to apply a read timeout to every command.
+type timeoutConn struct {
+	redis.Conn
+	timeout time.Duration
+}
 
+func (c timeoutConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if c.timeout <= 0 {
+		return c.Conn.Do(commandName, args...)
+	}
+	return redis.DoWithTimeout(c.Conn, c.timeout, commandName, args...)
 }
@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// Connection recording the arguments of the commands sent.
+type argsConn struct {
+	redis.Conn
+	args *[]interface{}
+}
+
+func (c argsConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	*c.args = append([]interface{}{commandName}, args...)
+	return nil, errors.New("recorded")
+}
+
+func Test_queryTimeout(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.QueryTimeoutMS = 60000
+
+	assert.Equal(t, time.Minute, queryTimeout(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.InDelta(t, time.Second, queryTimeout(ctx), float64(100*time.Millisecond))
+
+	// A deadline already passed still bounds the query.
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	assert.Equal(t, minQueryTimeout, queryTimeout(expired))
+	config.Cfg.QueryTimeoutMS = 0
+	assert.Equal(t, minQueryTimeout, queryTimeout(expired))
+}
+
+func Test_graphQuery(t *testing.T) {
+	args := []interface{}{}
+	g := rg2.Graph{Conn: argsConn{args: &args}, Id: "search-db"}
+
+	_, _ = graphQuery(&g, "GRAPH.RO_QUERY", "MATCH (n) RETURN n", 1500*time.Millisecond)
+	assert.Equal(t, []interface{}{"GRAPH.RO_QUERY", "search-db", "MATCH (n) RETURN n", "--compact", "TIMEOUT",
+		int64(1500)}, args)
+	_, _ = graphQuery(&g, "GRAPH.QUERY", "MATCH (n) RETURN n", 0)
+	assert.Equal(t, []interface{}{"GRAPH.QUERY", "search-db", "MATCH (n) RETURN n", "--compact"}, args)
+}
+
+func TestQuery_canceledContext(t *testing.T) {
+	useTestDatastore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Store.Query(ctx, "MATCH (n) RETURN n")
+	assert.True(t, errors.Is(err, context.Canceled), err)
+}
@@ -12,7 +12,6 @@ package dbconnector
 import (
 	"time"
 
-	"github.com/golang/glog"
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
 )
 
@@ -25,11 +24,11 @@ func RedisWatcher() {
 	for {
 		_, err := conn.Do("PING")
 		if err != nil {
-			glog.Warningf("Failed to PING redis - clear in memory data ")
+			logger.Warningf("Failed to PING redis - clear in memory data ")
 			clearClusterCache()
 			connError := conn.Close()
 			if connError != nil {
-				glog.Warning("Failed to close redis connection. Original error: ", connError)
+				logger.Warning("Failed to close redis connection. Original error: ", connError)
 			}
 			break
 		}
@@ -40,12 +39,15 @@ func RedisWatcher() {
 
 func clearClusterCache() {
 	existingClustersMap = nil
+	ExistingIndexMapMutex.Lock()
 	ExistingIndexMap = make(map[string]bool)
+	ExistingIndexMapMutex.Unlock()
+	resetKindLabels()
 }
 
 func createClustersCache(key string, val map[string]interface{}) {
 	if existingClustersMap != nil { // this should not happen
-		glog.Error("Trying to start duplicate RedisWatcher")
+		logger.Error("Trying to start duplicate RedisWatcher")
 		return
 	} else {
 		existingClustersMap = make(map[string]map[string]interface{})
@@ -55,7 +57,7 @@ func createClustersCache(key string, val map[string]interface{}) {
 		_, err := conn.Do("PING")
 		connError := conn.Close()
 		if connError != nil {
-			glog.Warning("Failed to close redis connection. Original error: ", connError)
+			logger.Warning("Failed to close redis connection. Original error: ", connError)
 		}
 		if err != nil {
 			clearClusterCache()
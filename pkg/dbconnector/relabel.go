@@ -0,0 +1,313 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// A kind and API group of the resources, as sent by the collectors, e.g. PlacementRule in
+// apps.open-cluster-management.io
+type KindRef struct {
+	Kind     string `json:"kind"`               // Also the label of the nodes, the kind property is lowercased.
+	Apigroup string `json:"apigroup,omitempty"` // In from, any API group when empty. In to, unchanged when empty.
+	// Only in to, the resource of the kind, e.g. placements, for the RBAC of the nodes. Unchanged when empty.
+	Resource string `json:"resource,omitempty"`
+}
+
+// Replaces the kind and API group of the stored resources, e.g. once an API graduated.
+type KindMapping struct {
+	From KindRef `json:"from"`
+	To   KindRef `json:"to"` // The kind defaults to the kind in from.
+}
+
+// Outcome of applying a kind mapping to the nodes of a cluster.
+type RelabelStats struct {
+	Nodes int `json:"nodes"` // Nodes with the new kind and API group.
+	Edges int `json:"edges"` // Edges recreated for the nodes with a new label.
+}
+
+var (
+	kindMappingsConfig string
+	kindMappings       []KindMapping
+	kindMappingsMutex  = sync.Mutex{}
+)
+
+// Parses the JSON list of KIND_MAPPINGS, e.g.
+// [{"from": {"kind": "PlacementRule", "apigroup": "apps.open-cluster-management.io"}, "to": {"kind": "Placement",
+// "apigroup": "cluster.open-cluster-management.io", "resource": "placements"}}]
+// Invalid mappings are logged and skipped.
+func parseKindMappings(value string) []KindMapping {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var parsed []KindMapping
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		logger.Error("Error parsing KIND_MAPPINGS, no kind mappings are applied: ", err)
+		return nil
+	}
+	valid := make([]KindMapping, 0, len(parsed))
+	for i, m := range parsed {
+		if m.To.Kind == "" {
+			m.To.Kind = m.From.Kind
+		}
+		var err error
+		switch {
+		case !searchPropertyRegex.MatchString(m.From.Kind):
+			err = fmt.Errorf("invalid kind %q", m.From.Kind)
+		case !searchPropertyRegex.MatchString(m.To.Kind):
+			err = fmt.Errorf("invalid kind %q", m.To.Kind)
+		case m.From.Kind == m.To.Kind && (m.To.Apigroup == "" || m.To.Apigroup == m.From.Apigroup):
+			err = fmt.Errorf("the kind or the API group must change")
+		}
+		if err != nil {
+			logger.Errorf("Skipping kind mapping %d from KIND_MAPPINGS: %s", i, err)
+			continue
+		}
+		valid = append(valid, m)
+	}
+	return valid
+}
+
+// Returns the mappings from KIND_MAPPINGS.
+func KindMappings() []KindMapping {
+	kindMappingsMutex.Lock()
+	defer kindMappingsMutex.Unlock()
+	if kindMappingsConfig != config.Cfg.KindMappings {
+		kindMappingsConfig = config.Cfg.KindMappings
+		kindMappings = parseKindMappings(kindMappingsConfig)
+	}
+	return kindMappings
+}
+
+// Returns the condition on n matching the nodes of the old kind and API group, in the cluster when it isn't empty.
+func (m KindMapping) condition(clusterName string) string {
+	condition := SanitizeQuery("n.kind = '%s'", strings.ToLower(m.From.Kind))
+	if m.From.Apigroup != "" {
+		condition += SanitizeQuery(" AND n.apigroup = '%s'", m.From.Apigroup)
+	}
+	if clusterName != "" {
+		condition += SanitizeQuery(" AND n.cluster = '%s'", clusterName)
+	}
+	return condition
+}
+
+// Returns the properties of the node with the new kind and API group, and the RBAC string updated with them.
+func (m KindMapping) properties(properties map[string]interface{}) map[string]interface{} {
+	mapped := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		mapped[key] = value
+	}
+	mapped["kind"] = strings.ToLower(m.To.Kind)
+	if m.To.Apigroup != "" {
+		mapped["apigroup"] = m.To.Apigroup
+	}
+	// The RBAC string is namespace_apigroup_resource, none of them can have an underscore.
+	if rbac, ok := mapped["_rbac"].(string); ok {
+		if parts := strings.Split(rbac, "_"); len(parts) == 3 {
+			if m.To.Apigroup != "" {
+				parts[1] = m.To.Apigroup
+			}
+			if m.To.Resource != "" {
+				parts[2] = m.To.Resource
+			}
+			mapped["_rbac"] = strings.Join(parts, "_")
+		}
+	}
+	return mapped
+}
+
+// Returns the clusters with nodes of the old kind and API group of the mapping.
+func KindMappingClusters(ctx context.Context, m KindMapping) ([]string, error) {
+	result, err := Store.Query(ctx, SanitizeQuery("MATCH (n:%s) WHERE ", m.From.Kind)+m.condition("")+
+		" RETURN DISTINCT n.cluster")
+	if err != nil {
+		return nil, err
+	}
+	clusters := []string{}
+	for result.Next() {
+		if clusterName := recordString(result.Record().GetByIndex(0)); clusterName != "" {
+			clusters = append(clusters, clusterName)
+		}
+	}
+	return clusters, nil
+}
+
+// Applies the mapping to up to batchSize nodes of the cluster, 0 nodes when none is left. The UIDs and the other
+// properties are kept. Nodes can't be relabeled, so with a new kind each node is created again with the new label
+// and its edges, and the old node is deleted, all in a single query so a failed batch leaves the nodes unchanged.
+// Syncs of the cluster must wait for the batch, the edges read for it could change otherwise.
+func RelabelBatch(ctx context.Context, m KindMapping, clusterName string, batchSize int) (RelabelStats, error) {
+	query := SanitizeQuery("MATCH (n:%s) WHERE ", m.From.Kind) + m.condition(clusterName) +
+		fmt.Sprintf(" RETURN n LIMIT %d", batchSize)
+	result, err := Store.Query(ctx, query)
+	if err != nil {
+		return RelabelStats{}, err
+	}
+	nodes := []*rg2.Node{}
+	uids := []string{}
+	for result.Next() {
+		if node, ok := result.Record().GetByIndex(0).(*rg2.Node); ok {
+			if uid, ok := node.Properties["_uid"].(string); ok {
+				nodes = append(nodes, node)
+				uids = append(uids, "'"+sanitizeValue(uid)+"'")
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return RelabelStats{}, nil
+	}
+	if m.From.Kind == m.To.Kind {
+		// Same label, only the properties are set.
+		matches, sets := []string{}, []string{}
+		for i, node := range nodes {
+			mapped := m.properties(node.Properties)
+			matches = append(matches, SanitizeQuery("(o%d:%s {_uid:'%s'})", i, m.From.Kind, node.Properties["_uid"]))
+			for _, key := range []string{"kind", "apigroup", "_rbac"} {
+				if value, ok := mapped[key].(string); ok {
+					sets = append(sets, SanitizeQuery("o%d.%s = '%s'", i, key, value))
+				}
+			}
+		}
+		_, err = Store.Query(WithWrite(ctx), "MATCH "+strings.Join(matches, ", ")+" SET "+strings.Join(sets, ", "))
+		return RelabelStats{Nodes: len(nodes)}, err
+	}
+
+	edges, err := relabeledEdges(ctx, m.From.Kind, uids)
+	if err != nil {
+		return RelabelStats{}, err
+	}
+	if query, err = relabelQuery(m, nodes, edges); err != nil {
+		return RelabelStats{}, err
+	}
+	if _, err = Store.Query(WithWrite(ctx), query); err != nil {
+		return RelabelStats{}, err
+	}
+	if err = insertIndex(ctx, m.To.Kind, "_uid"); err != nil {
+		logger.Warning("Error creating the _uid index of ", m.To.Kind, ": ", err)
+	}
+	return RelabelStats{Nodes: len(nodes), Edges: len(edges)}, nil
+}
+
+// An edge from or to a node being relabeled, with the other node.
+type relabeledEdge struct {
+	edge        *rg2.Edge
+	sourceUID   string
+	destUID     string
+	otherID     int    // Id of the node that isn't relabeled, matched by id when it has no UID.
+	otherLabel  string // Label of the node that isn't relabeled.
+	otherIsDest bool
+}
+
+// Returns the edges from and to the nodes with the label and UIDs, once each.
+func relabeledEdges(ctx context.Context, label string, uids []string) ([]relabeledEdge, error) {
+	in := "[" + strings.Join(uids, ", ") + "]"
+	queries := []string{
+		SanitizeQuery("MATCH (n:%s)-[e]->(o) WHERE n._uid IN ", label) + in +
+			" RETURN e, n._uid, o._uid, id(o), labels(o)",
+		SanitizeQuery("MATCH (o)-[e]->(n:%s) WHERE n._uid IN ", label) + in +
+			" RETURN e, o._uid, n._uid, id(o), labels(o)",
+	}
+	edges := []relabeledEdge{}
+	seen := make(map[uint64]bool)
+	for i, query := range queries {
+		result, err := Store.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for result.Next() {
+			record := result.Record()
+			edge, ok := record.GetByIndex(0).(*rg2.Edge)
+			if !ok || seen[edge.ID] {
+				continue
+			}
+			seen[edge.ID] = true
+			otherID, _ := record.GetByIndex(3).(int)
+			edges = append(edges, relabeledEdge{edge: edge, sourceUID: recordString(record.GetByIndex(1)),
+				destUID: recordString(record.GetByIndex(2)), otherID: otherID,
+				otherLabel: nodeLabel(record.GetByIndex(4)), otherIsDest: i == 0})
+		}
+	}
+	return edges, nil
+}
+
+// Returns the label of a node from labels(n), a string before RedisGraph 2.8.
+func nodeLabel(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case []interface{}:
+		if len(typed) > 0 {
+			return recordString(typed[0])
+		}
+	}
+	return ""
+}
+
+// Builds the query creating the nodes with the new label and their edges, and deleting the old nodes.
+func relabelQuery(m KindMapping, nodes []*rg2.Node, edges []relabeledEdge) (string, error) {
+	matches, creates, deletes := []string{}, []string{}, []string{}
+	byUID := make(map[string]string) // Variable of the new node by UID.
+	for i, node := range nodes {
+		uid, _ := node.Properties["_uid"].(string)
+		properties, err := propertiesLiteral(m.properties(node.Properties))
+		if err != nil {
+			return "", fmt.Errorf("Error relabeling node %s: %s", uid, err)
+		}
+		matches = append(matches, SanitizeQuery("(o%d:%s {_uid:'%s'})", i, m.From.Kind, uid))
+		creates = append(creates, SanitizeQuery("(n%d:%s ", i, m.To.Kind)+properties+")")
+		deletes = append(deletes, fmt.Sprintf("o%d", i))
+		byUID[uid] = fmt.Sprintf("n%d", i)
+	}
+
+	byIDMatches := []string{}
+	others := make(map[string]string) // Variable of the node that isn't relabeled, by UID or id.
+	for _, e := range edges {
+		source, dest := byUID[e.sourceUID], byUID[e.destUID]
+		otherUID := e.sourceUID
+		if e.otherIsDest {
+			otherUID = e.destUID
+		}
+		if (e.otherIsDest && dest == "") || (!e.otherIsDest && source == "") {
+			key := "uid:" + otherUID
+			if otherUID == "" {
+				key = fmt.Sprintf("id:%d", e.otherID)
+			}
+			other, ok := others[key]
+			if !ok {
+				other = fmt.Sprintf("x%d", len(others))
+				others[key] = other
+				label := ""
+				if e.otherLabel != "" {
+					label = ":" + e.otherLabel
+				}
+				if otherUID == "" {
+					byIDMatches = append(byIDMatches, fmt.Sprintf(" MATCH (%s) WHERE id(%s) = %d", other, other,
+						e.otherID))
+				} else {
+					matches = append(matches, SanitizeQuery("(%s%s {_uid:'%s'})", other, label, otherUID))
+				}
+			}
+			if e.otherIsDest {
+				dest = other
+			} else {
+				source = other
+			}
+		}
+		properties, err := propertiesLiteral(e.edge.Properties)
+		if err != nil {
+			return "", fmt.Errorf("Error relabeling edge %d: %s", e.edge.ID, err)
+		}
+		creates = append(creates, fmt.Sprintf("(%s)-[:%s %s]->(%s)", source, e.edge.Relation, properties, dest))
+	}
+	return "MATCH " + strings.Join(matches, ", ") + strings.Join(byIDMatches, "") + " CREATE " +
+		strings.Join(creates, ", ") + " DELETE " + strings.Join(deletes, ", "), nil
+}
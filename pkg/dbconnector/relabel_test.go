@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPlacementRuleGroup = "apps.open-cluster-management.io"
+
+func Test_parseKindMappings(t *testing.T) {
+	mappings := parseKindMappings(`[
+		{"from": {"kind": "PlacementRule", "apigroup": "apps.open-cluster-management.io"},
+			"to": {"kind": "Placement", "apigroup": "cluster.open-cluster-management.io", "resource": "placements"}},
+		{"from": {"kind": "Pod) DETACH DELETE (n"}, "to": {"kind": "Pod"}},
+		{"from": {"kind": "Job", "apigroup": "batch"}, "to": {"apigroup": "batch"}},
+		{"from": {"kind": "HorizontalPodAutoscaler"}, "to": {"apigroup": "autoscaling.k8s.io"}}
+	]`)
+	assert.Equal(t, []KindMapping{
+		{From: KindRef{Kind: "PlacementRule", Apigroup: testPlacementRuleGroup},
+			To: KindRef{Kind: "Placement", Apigroup: "cluster.open-cluster-management.io", Resource: "placements"}},
+		{From: KindRef{Kind: "HorizontalPodAutoscaler"},
+			To: KindRef{Kind: "HorizontalPodAutoscaler", Apigroup: "autoscaling.k8s.io"}},
+	}, mappings)
+	assert.Nil(t, parseKindMappings("not json"))
+}
+
+func TestRelabelBatch(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := Store.Query(ctx, "CREATE (c:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(p1:PlacementRule {_uid:'c1/p1', kind:'placementrule', apigroup:'"+testPlacementRuleGroup+"', cluster:'c1', "+
+		"name:'p1', _rbac:'ns1_"+testPlacementRuleGroup+"_placementrules'}), "+
+		"(p2:PlacementRule {_uid:'c1/p2', kind:'placementrule', apigroup:'"+testPlacementRuleGroup+"', cluster:'c1', "+
+		"name:'p2'}), "+
+		"(p3:PlacementRule {_uid:'c1/p3', kind:'placementrule', apigroup:'"+testPlacementRuleGroup+"', cluster:'c1', "+
+		"name:'p3'}), "+
+		"(:PlacementRule {_uid:'c2/p1', kind:'placementrule', apigroup:'"+testPlacementRuleGroup+"', cluster:'c2'}), "+
+		"(:PlacementRule {_uid:'c1/other', kind:'placementrule', apigroup:'example.com', cluster:'c1'}), "+
+		"(s:Subscription {_uid:'c1/s1', kind:'subscription', cluster:'c1'}), (a:Aggregator {name:'watcher'}), "+
+		"(p1)-[:inCluster]->(c), (s)-[:usesPlacement {_interCluster:false}]->(p1), (p1)-[:ownedBy]->(p2), "+
+		"(a)-[:watches]->(p3)")
+	assert.NoError(t, err)
+	m := KindMapping{From: KindRef{Kind: "PlacementRule", Apigroup: testPlacementRuleGroup},
+		To: KindRef{Kind: "Placement", Apigroup: "cluster.open-cluster-management.io", Resource: "placements"}}
+
+	clusters, err := KindMappingClusters(ctx, m)
+	assert.NoError(t, err)
+	sort.Strings(clusters)
+	assert.Equal(t, []string{"c1", "c2"}, clusters)
+
+	total := RelabelStats{}
+	for {
+		stats, err := RelabelBatch(ctx, m, "c1", 2)
+		assert.NoError(t, err)
+		if err != nil || stats.Nodes == 0 {
+			break
+		}
+		total.Nodes += stats.Nodes
+		total.Edges += stats.Edges
+	}
+	assert.Equal(t, RelabelStats{Nodes: 3, Edges: 4}, total)
+
+	count := func(query string) int {
+		n, err := queryCount(ctx, query)
+		assert.NoError(t, err)
+		return n
+	}
+	assert.Equal(t, 2, count("MATCH (n:PlacementRule) RETURN count(n)"), "Other clusters and API groups are kept.")
+	assert.Equal(t, 3, count("MATCH (n:Placement {kind:'placement', apigroup:'cluster.open-cluster-management.io', "+
+		"cluster:'c1'}) RETURN count(n)"))
+	assert.Equal(t, 1, count("MATCH (n:Placement {_uid:'c1/p1', name:'p1', "+
+		"_rbac:'ns1_cluster.open-cluster-management.io_placements'}) RETURN count(n)"))
+	assert.Equal(t, 1, count("MATCH (:Placement {_uid:'c1/p1'})-[:inCluster]->(:Cluster {_uid:'cluster__c1'}) "+
+		"RETURN count(*)"))
+	assert.Equal(t, 1, count("MATCH (:Subscription {_uid:'c1/s1'})-[e:usesPlacement]->(:Placement {_uid:'c1/p1'}) "+
+		"WHERE e._interCluster = false RETURN count(e)"))
+	assert.Equal(t, 1, count("MATCH (:Placement {_uid:'c1/p1'})-[:ownedBy]->(:Placement {_uid:'c1/p2'}) "+
+		"RETURN count(*)"))
+	assert.Equal(t, 1, count("MATCH (:Aggregator {name:'watcher'})-[:watches]->(:Placement {_uid:'c1/p3'}) "+
+		"RETURN count(*)"))
+	assert.Equal(t, 4, count("MATCH ()-[e]->() RETURN count(e)"), "The edges are recreated once.")
+
+	groupOnly := KindMapping{From: KindRef{Kind: "PlacementRule", Apigroup: "example.com"},
+		To: KindRef{Kind: "PlacementRule", Apigroup: "example.org"}}
+	stats, err := RelabelBatch(ctx, groupOnly, "c1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, RelabelStats{Nodes: 1}, stats)
+	assert.Equal(t, 1, count("MATCH (n:PlacementRule {_uid:'c1/other', apigroup:'example.org'}) RETURN count(n)"))
+	stats, err = RelabelBatch(ctx, groupOnly, "c1", 2)
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Nodes)
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Edges followed by default are all but inCluster, which connects every resource of a cluster to the cluster node.
+const IN_CLUSTER_EDGE = "inCluster"
+
+// Returned by RelatedResources for an edge type that isn't a valid identifier.
+var ErrInvalidEdgeType = errors.New("Invalid edge type")
+
+// Returned by RelatedResources for a direction other than outgoing, incoming or both.
+var ErrInvalidDirection = errors.New("Invalid edge direction")
+
+// Bounds a related resources traversal.
+type RelatedOptions struct {
+	Depth     int      // Number of hops from the resource, between 1 and SEARCH_MAX_HOPS.
+	EdgeTypes []string // Edge types to follow, every type but inCluster when empty.
+	Kinds     []string // Kinds of the related resources returned, all when empty. Other kinds are still traversed.
+	HopLimit  int      // Max number of resources reached at each hop, no limit when 0.
+	// Direction to follow the edges in, outgoing, incoming, or both when empty. Edges of a bidirectional type are
+	// always followed both ways.
+	Direction string
+	// Min weight of the edges followed, from 0 to 1. The edges without a weight are always followed.
+	MinWeight float64
+	// Resources the user can see, nil for every resource. Resources the user can't see aren't traversed.
+	Access *ResourceAccess
+}
+
+// A resource reached from the resource of a related resources traversal.
+type RelatedResource struct {
+	UID        string                 `json:"uid"`
+	Hop        int                    `json:"hop"`       // Number of edges from the resource.
+	EdgeType   string                 `json:"edgeType"`  // Type of the edge the resource was reached through.
+	Direction  string                 `json:"direction"` // outgoing when the edge points to this resource, both for a bidirectional type.
+	FromUID    string                 `json:"fromUID"`   // Resource of the previous hop.
+	Properties map[string]interface{} `json:"properties"`
+	// Weight of the edge the resource was reached through, only for the intercluster edges weighted by EDGE_WEIGHTS.
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// Related resources of a resource, and whether a hop reached more resources than the hop limit.
+type RelatedResult struct {
+	Items     []RelatedResource `json:"items"`
+	Truncated bool              `json:"truncated"`
+}
+
+// Returns the resources related to the resource with the UID, hop by hop up to opts.Depth.
+// Each hop only expands the resources not reached by a previous one, so cycles aren't followed.
+func RelatedResources(ctx context.Context, uid string, opts RelatedOptions) (RelatedResult, error) {
+	result := RelatedResult{Items: []RelatedResource{}}
+	if opts.Depth < 1 || opts.Depth > config.Cfg.SearchMaxHops {
+		return result, QueryCostError{fmt.Sprintf("Depth must be between 1 and %d.", config.Cfg.SearchMaxHops)}
+	}
+	for _, edgeType := range opts.EdgeTypes {
+		if !searchPropertyRegex.MatchString(edgeType) {
+			return result, fmt.Errorf("%w: %s", ErrInvalidEdgeType, edgeType)
+		}
+	}
+	switch opts.Direction {
+	case "":
+		opts.Direction = EDGE_BOTH
+	case EDGE_OUTGOING, EDGE_INCOMING, EDGE_BOTH:
+	default:
+		return result, fmt.Errorf("%w: %s", ErrInvalidDirection, opts.Direction)
+	}
+	kinds := make(map[string]bool, len(opts.Kinds))
+	for _, kind := range opts.Kinds {
+		kinds[strings.ToLower(kind)] = true
+	}
+
+	visited := map[string]bool{uid: true}
+	frontier := []string{uid}
+	for hop := 1; hop <= opts.Depth && len(frontier) > 0; hop++ {
+		var next []string
+		for _, direction := range []string{EDGE_OUTGOING, EDGE_INCOMING} {
+			query, ok := relatedQuery(frontier, visited, opts, direction)
+			if !ok {
+				continue
+			}
+			limit := 0
+			if opts.HopLimit > 0 {
+				limit = opts.HopLimit - len(next) + 1 // One more to know if the hop was truncated.
+			}
+			found, err := SearchQuery(ctx, query, limit)
+			if err != nil {
+				return result, err
+			}
+			for found.Next() {
+				record := found.Record()
+				node, ok := record.GetByIndex(3).(*rg2.Node)
+				if !ok {
+					continue
+				}
+				related := RelatedResource{
+					UID:        recordString(node.Properties["_uid"]),
+					Hop:        hop,
+					EdgeType:   recordString(record.GetByIndex(1)),
+					Direction:  direction,
+					FromUID:    recordString(record.GetByIndex(0)),
+					Properties: node.Properties,
+					Weight:     recordWeight(record.GetByIndex(2)),
+				}
+				if IsBidirectional(related.EdgeType) {
+					related.Direction = EDGE_BOTH
+				}
+				if visited[related.UID] { // Reached twice in the same hop.
+					continue
+				}
+				if opts.HopLimit > 0 && len(next) == opts.HopLimit {
+					result.Truncated = true
+					break
+				}
+				visited[related.UID] = true
+				next = append(next, related.UID)
+				if len(kinds) == 0 || kinds[recordString(node.Properties["kind"])] {
+					result.Items = append(result.Items, related)
+				}
+			}
+		}
+		frontier = next
+	}
+	return result, nil
+}
+
+// Builds the query for a single hop of RelatedResources in one direction,
+// e.g. MATCH (n)-[e]->(m) WHERE n._uid IN ['a'] AND type(e) <> 'inCluster' AND NOT m._uid IN ['a']
+// RETURN n._uid, type(e), e._weight, m
+// Returns false when no edge is followed in the direction.
+func relatedQuery(frontier []string, visited map[string]bool, opts RelatedOptions, direction string) (string, bool) {
+	edgeCondition, ok := EdgeTypeCondition("e", opts.EdgeTypes, direction, opts.Direction)
+	if !ok {
+		return "", false
+	}
+	visitedUIDs := make([]string, 0, len(visited))
+	for uid := range visited {
+		visitedUIDs = append(visitedUIDs, uid)
+	}
+	conditions := []string{"n._uid IN " + quotedList(frontier), edgeCondition}
+	conditions = append(conditions, "NOT m._uid IN "+quotedList(visitedUIDs))
+	if opts.MinWeight > 0 {
+		conditions = append(conditions, edgeWeightCondition("e", opts.MinWeight))
+	}
+	if opts.Access != nil {
+		for _, variable := range []string{"n", "m"} {
+			if condition := opts.Access.Condition(variable); condition != "" {
+				conditions = append(conditions, condition)
+			}
+		}
+	}
+	return fmt.Sprintf("MATCH %s WHERE %s RETURN n._uid, type(e), e._weight, m", EdgePattern("n", "e", "m", direction), strings.Join(conditions, " AND ")), true
+}
+
+// Returns a sanitized list literal of the values, e.g. ['a', 'b']
+func quotedList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, SanitizeQuery("'%s'", value))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
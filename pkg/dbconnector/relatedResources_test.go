@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func relatedUIDs(result RelatedResult) map[string]int {
+	uids := map[string]int{}
+	for _, item := range result.Items {
+		uids[item.UID] = item.Hop
+	}
+	return uids
+}
+
+func TestRelatedResources(t *testing.T) {
+	useTestDatastore(t)
+
+	// Two pods owned by a replicaset owned by a deployment, all in the cluster.
+	_, err := Store.Query(context.Background(), "CREATE (c:Cluster {_uid:'cluster__c1', kind:'cluster'}), "+
+		"(d:Deployment {_uid:'c1/d', kind:'deployment'})-[:inCluster]->(c), "+
+		"(r:ReplicaSet {_uid:'c1/r', kind:'replicaset'})-[:inCluster]->(c), "+
+		"(p1:Pod {_uid:'c1/p1', kind:'pod'})-[:inCluster]->(c), (p2:Pod {_uid:'c1/p2', kind:'pod'})-[:inCluster]->(c), "+
+		"(r)-[:ownedBy]->(d), (p1)-[:ownedBy]->(r), (p2)-[:ownedBy]->(r)")
+	assert.NoError(t, err)
+
+	result, err := RelatedResources(context.Background(), "c1/d", RelatedOptions{Depth: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"c1/r": 1}, relatedUIDs(result))
+	assert.Equal(t, "ownedBy", result.Items[0].EdgeType)
+	assert.Equal(t, "incoming", result.Items[0].Direction)
+
+	result, err = RelatedResources(context.Background(), "c1/d", RelatedOptions{Depth: 2, Kinds: []string{"Pod"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"c1/p1": 2, "c1/p2": 2}, relatedUIDs(result))
+	assert.False(t, result.Truncated)
+
+	result, err = RelatedResources(context.Background(), "c1/d", RelatedOptions{Depth: 2, HopLimit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 2)
+	assert.True(t, result.Truncated)
+
+	result, err = RelatedResources(context.Background(), "c1/p1", RelatedOptions{Depth: 1, EdgeTypes: []string{"inCluster"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"cluster__c1": 1}, relatedUIDs(result))
+}
+
+func TestRelatedResourcesDirection(t *testing.T) {
+	useTestDatastore(t)
+
+	// A pod owned by a replicaset, with a volume attached to it.
+	_, err := Store.Query(context.Background(), "CREATE (r:ReplicaSet {_uid:'c1/r', kind:'replicaset'}), "+
+		"(p:Pod {_uid:'c1/p', kind:'pod'})-[:ownedBy]->(r), (v:PersistentVolume {_uid:'c1/v', kind:'pv'})-[:attachedTo]->(p)")
+	assert.NoError(t, err)
+
+	result, err := RelatedResources(context.Background(), "c1/p", RelatedOptions{Depth: 1, Direction: EDGE_OUTGOING})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"c1/r": 1, "c1/v": 1}, relatedUIDs(result), "attachedTo is followed both ways")
+	for _, item := range result.Items {
+		if item.UID == "c1/v" {
+			assert.Equal(t, EDGE_BOTH, item.Direction)
+		}
+	}
+
+	result, err = RelatedResources(context.Background(), "c1/r", RelatedOptions{Depth: 1, Direction: EDGE_OUTGOING})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Items)
+}
+
+func TestRelatedResourcesErrors(t *testing.T) {
+	_, err := RelatedResources(context.Background(), "c1/d", RelatedOptions{Depth: 100})
+	assert.IsType(t, QueryCostError{}, err)
+	_, err = RelatedResources(context.Background(), "c1/d", RelatedOptions{Depth: 1, EdgeTypes: []string{"a]-(x"}})
+	assert.ErrorIs(t, err, ErrInvalidEdgeType)
+	_, err = RelatedResources(context.Background(), "c1/d", RelatedOptions{Depth: 1, Direction: "up"})
+	assert.ErrorIs(t, err, ErrInvalidDirection)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrRemapConflict = errors.New("the new cluster already has resources")
+
+// Outcome of moving the resources of a cluster to a new name.
+type ClusterRemap struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Resources   int    `json:"resources"`   // Resources moved to the new name, with their edges.
+	ClusterNode string `json:"clusterNode"` // renamed, replaced by the Cluster node of the new name, or none.
+	SyncHistory int    `json:"syncHistory"` // Entries of the sync history moved.
+	Tombstones  int    `json:"tombstones"`  // Tombstones moved.
+	DurationMS  int64  `json:"durationMS"`
+}
+
+// Moves the resources of a cluster that was detached and imported again under a new name, so they aren't orphaned
+// under the old name. The resources get the new cluster name and UID prefix in a single query, keeping their edges,
+// including the intercluster ones, then the RBAC of the ones in the cluster namespace, the Cluster node, the sync
+// history and the tombstones follow. Each step only matches what wasn't moved yet, so a remap that fails can be run
+// again. Fails with ErrRemapConflict when both clusters have resources, their UIDs could collide.
+func RemapCluster(ctx context.Context, from, to string) (ClusterRemap, error) {
+	start := time.Now()
+	remap := ClusterRemap{From: from, To: to, ClusterNode: "none"}
+	for _, clusterName := range []string{from, to} {
+		if err := ValidateClusterName(clusterName); err != nil {
+			return remap, err
+		}
+		if clusterName == hubClusterName {
+			return remap, errors.New("the resources of " + hubClusterName + " can't be remapped")
+		}
+	}
+	if from == to {
+		return remap, errors.New("the new cluster name is the same as the old one")
+	}
+
+	var err error
+	match := SanitizeQuery("MATCH (n {cluster:'%s'}) WHERE n._uid STARTS WITH '%s/'", from, from)
+	if remap.Resources, err = queryCount(ctx, match+" RETURN count(n)"); err != nil {
+		return remap, err
+	}
+	if remap.Resources > 0 {
+		var existing int
+		if existing, err = queryCount(ctx, SanitizeQuery("MATCH (n {cluster:'%s'}) RETURN count(n)", to)); err != nil {
+			return remap, err
+		}
+		if existing > 0 {
+			return remap, ErrRemapConflict
+		}
+		_, err = Store.Query(WithWrite(ctx), match+SanitizeQuery(
+			" SET n.cluster = '%s', n._uid = '%s' + substring(n._uid, %d)", to, to, len(from)))
+		if err != nil {
+			return remap, err
+		}
+	}
+	// The resources of a managed cluster are visible with the namespace of the cluster on the hub.
+	_, err = Store.Query(WithWrite(ctx), SanitizeQuery("MATCH (n {cluster:'%s', _clusterNamespace:'%s'}) "+
+		"WHERE n._rbac STARTS WITH '%s_' SET n._clusterNamespace = '%s', n._rbac = '%s' + substring(n._rbac, %d)",
+		to, from, from, to, to, len(from)))
+	if err != nil {
+		return remap, err
+	}
+
+	if remap.ClusterNode, err = remapClusterNode(ctx, from, to); err != nil {
+		return remap, err
+	}
+	if _, err = DeleteClusterSummary(ctx, from); err != nil {
+		return remap, err
+	}
+	if err = DeleteNamespaceUsage(ctx, from); err != nil {
+		return remap, err
+	}
+	if err = remapTimelines(ctx, &remap); err != nil {
+		return remap, err
+	}
+	DropPendingDeletes(from)
+	DropRetries(from)
+	DeleteClusterSet(from)
+	DeleteClustersCache("cluster__" + from)
+	remap.DurationMS = time.Since(start).Milliseconds()
+	return remap, nil
+}
+
+// Renames the Cluster node of the old name, or deletes it when the new name already has one. The intercluster edges
+// to the Cluster node are rebuilt by the edge builder.
+func remapClusterNode(ctx context.Context, from, to string) (string, error) {
+	existing, err := queryCount(ctx, SanitizeQuery("MATCH (c:Cluster {name:'%s'}) RETURN count(c)", from))
+	if err != nil || existing == 0 {
+		return "none", err
+	}
+	replacement, err := queryCount(ctx, SanitizeQuery("MATCH (c:Cluster {name:'%s'}) RETURN count(c)", to))
+	if err != nil {
+		return "", err
+	}
+	if replacement > 0 {
+		_, err = Store.Query(WithWrite(ctx), SanitizeQuery("MATCH (c:Cluster {name:'%s'}) DELETE c", from))
+		return "replaced", err
+	}
+	_, err = Store.Query(WithWrite(ctx), SanitizeQuery("MATCH (c:Cluster {name:'%s'}) "+
+		"SET c.name = '%s', c._uid = 'cluster__%s', c._clusterNamespace = '%s'", from, to, to, to))
+	if err != nil {
+		return "", err
+	}
+	_, err = Store.Query(WithWrite(ctx), SanitizeQuery("MATCH (c:Cluster {name:'%s'}) "+
+		"WHERE c._rbac STARTS WITH '%s_' SET c._rbac = '%s' + substring(c._rbac, %d)", to, from, to, len(from)))
+	return "renamed", err
+}
+
+// Moves the sync history and the tombstones of the old name to the new one, with the UIDs of the tombstones renamed
+// like the resources. The entries the new name already has are kept.
+func remapTimelines(ctx context.Context, remap *ClusterRemap) error {
+	history, err := SyncHistory(ctx, remap.From, time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, stats := range history {
+		if err = RecordSyncStats(ctx, remap.To, stats); err != nil {
+			return err
+		}
+	}
+	remap.SyncHistory = len(history)
+
+	tombstones, err := Tombstones(ctx, remap.From, time.Time{}, "")
+	if err != nil {
+		return err
+	}
+	for i := range tombstones {
+		if strings.HasPrefix(tombstones[i].UID, remap.From+"/") {
+			tombstones[i].UID = remap.To + tombstones[i].UID[len(remap.From):]
+		}
+	}
+	if err = RecordTombstones(ctx, remap.To, tombstones); err != nil {
+		return err
+	}
+	remap.Tombstones = len(tombstones)
+
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("DEL", SYNC_HISTORY_KEY_PREFIX+remap.From, TOMBSTONE_KEY_PREFIX+remap.From)
+	return err
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemapCluster(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__old', kind:'cluster', name:'old', "+
+		"_clusterNamespace:'old', _rbac:'old_internal.open-cluster-management.io_managedclusterinfos'}), "+
+		"(:Cluster {_uid:'cluster__c2', kind:'cluster', name:'c2'}), "+
+		"(:Pod {_uid:'old/a', kind:'pod', cluster:'old', namespace:'default', _clusterNamespace:'old', "+
+		"_rbac:'old_null_pods'})-[:ownedBy]->(:ReplicaSet {_uid:'old/b', kind:'replicaset', cluster:'old', "+
+		"_clusterNamespace:'old', _rbac:'old_apps_replicasets'}), "+
+		"(:Deployment {_uid:'c2/d', kind:'deployment', cluster:'c2'})")
+	assert.NoError(t, err)
+	_, err = Store.Query(ctx, "MATCH (a {_uid:'old/a'}), (d {_uid:'c2/d'}) CREATE (a)-[:deployedBy {_interCluster:true}]->(d)")
+	assert.NoError(t, err)
+	assert.NoError(t, RecordSyncStats(ctx, "old", SyncStats{Timestamp: time.Now(), RequestId: 1}))
+	assert.NoError(t, RecordTombstones(ctx, "old", []Tombstone{{UID: "old/gone", DeletedAt: time.Now()}}))
+
+	remap, err := RemapCluster(ctx, "old", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, remap.Resources)
+	assert.Equal(t, "renamed", remap.ClusterNode)
+	assert.Equal(t, 1, remap.SyncHistory)
+	assert.Equal(t, 1, remap.Tombstones)
+
+	count := func(query string) int {
+		n, err := queryCount(ctx, query)
+		assert.NoError(t, err)
+		return n
+	}
+	assert.Equal(t, 0, count("MATCH (n {cluster:'old'}) RETURN count(n)"))
+	assert.Equal(t, 1, count("MATCH (n {_uid:'new/a', cluster:'new', _clusterNamespace:'new', _rbac:'new_null_pods'}) "+
+		"RETURN count(n)"))
+	assert.Equal(t, 1, count("MATCH ({_uid:'new/a'})-[:ownedBy]->({_uid:'new/b'}) RETURN count(*)"))
+	assert.Equal(t, 1, count("MATCH ({_uid:'new/a'})-[:deployedBy]->({_uid:'c2/d'}) RETURN count(*)"))
+	assert.Equal(t, 1, count("MATCH (c:Cluster {_uid:'cluster__new', name:'new', "+
+		"_rbac:'new_internal.open-cluster-management.io_managedclusterinfos'}) RETURN count(c)"))
+
+	history, err := SyncHistory(ctx, "new", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(history))
+	tombstones, err := Tombstones(ctx, "new", time.Time{}, "new/gone")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tombstones))
+	history, err = SyncHistory(ctx, "old", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(history))
+
+	// Nothing is left to move when it's run again.
+	remap, err = RemapCluster(ctx, "old", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, remap.Resources)
+	assert.Equal(t, "none", remap.ClusterNode)
+
+	_, err = RemapCluster(ctx, "new", "c2")
+	assert.Equal(t, ErrRemapConflict, err)
+	_, err = RemapCluster(ctx, "new", "local-cluster")
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Suffix of the default graph the captured syncs are replayed into.
+const REPLAY_GRAPH_SUFFIX = "-replay"
+
+// Matches the names of the graphs a sync can be replayed into.
+var replayGraphRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type graphKey struct{}
+
+// Returns a context running its queries against the graph instead of GRAPH_NAME, e.g. to replay a sync into a test
+// graph. The queries don't wait for a compaction, it only copies GRAPH_NAME.
+func WithGraph(ctx context.Context, graph string) context.Context {
+	return context.WithValue(ctx, graphKey{}, graph)
+}
+
+// Returns the graph of the context, empty when the queries run against GRAPH_NAME.
+func graphFromContext(ctx context.Context) string {
+	graph, _ := ctx.Value(graphKey{}).(string)
+	return graph
+}
+
+// Returns the graph to replay syncs into, GRAPH_NAME with REPLAY_GRAPH_SUFFIX when empty. Fails for the graph of the
+// search index, and the one used while compacting it.
+func ReplayGraph(graph string) (string, error) {
+	if graph == "" {
+		return GRAPH_NAME + REPLAY_GRAPH_SUFFIX, nil
+	}
+	if !replayGraphRegex.MatchString(graph) {
+		return "", fmt.Errorf("Invalid graph name %s", graph)
+	}
+	if graph == GRAPH_NAME || strings.HasSuffix(graph, COMPACTION_GRAPH_SUFFIX) {
+		return "", fmt.Errorf("Syncs can't be replayed into graph %s", graph)
+	}
+	return graph, nil
+}
+
+// Deletes the graph a sync is replayed into, so the replay starts from an empty graph. The graph doesn't exist
+// before the first replay.
+func ResetReplayGraph(ctx context.Context, graph string) error {
+	if _, err := ReplayGraph(graph); err != nil {
+		return err
+	}
+	if err := deleteGraph(ctx, graph); err != nil && !strings.Contains(err.Error(), "empty key") {
+		return err
+	}
+	return nil
+}
+
+// Creates the Cluster node of the replayed sync in the replay graph of the context when it's missing, the inserted
+// resources are connected to it. With clearAll, the resources of the cluster are deleted first, as a resync does.
+func PrepareReplayCluster(ctx context.Context, clusterName string, clearAll bool) error {
+	if graphFromContext(ctx) == "" {
+		return fmt.Errorf("Syncs can only be replayed into a replay graph")
+	}
+	if clearAll {
+		if _, err := DeleteCluster(ctx, clusterName); err != nil {
+			return err
+		}
+	}
+	_, err := Store.Query(WithWrite(ctx), SanitizeQuery("MERGE (c:Cluster {name: '%s', kind: 'cluster'})", clusterName))
+	return err
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayGraph(t *testing.T) {
+	graph, err := ReplayGraph("")
+	assert.NoError(t, err)
+	assert.Equal(t, "search-db-replay", graph)
+	graph, err = ReplayGraph("bug-1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "bug-1234", graph)
+
+	for _, invalid := range []string{"search-db", "search-db-compact", "bad graph", "a'b"} {
+		_, err = ReplayGraph(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestWithGraph(t *testing.T) {
+	useTestDatastore(t)
+	ctx := WithGraph(context.Background(), "search-db-replay")
+
+	assert.Error(t, PrepareReplayCluster(context.Background(), "c1", false), "Only into a replay graph")
+	assert.NoError(t, PrepareReplayCluster(ctx, "c1", false))
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/p', kind:'pod', cluster:'c1'})")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queryRows(t, "MATCH (n) RETURN n"), "The primary graph isn't changed")
+	result, err := Store.Query(ctx, "MATCH (n) RETURN n")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countRows(result))
+
+	// A resync replaces the resources of the cluster, the Cluster node is kept.
+	assert.NoError(t, PrepareReplayCluster(ctx, "c1", true))
+	result, err = Store.Query(ctx, "MATCH (n) RETURN n.kind")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countRows(result))
+
+	assert.NoError(t, ResetReplayGraph(ctx, "search-db-replay"))
+	assert.NoError(t, ResetReplayGraph(ctx, "search-db-replay"), "A missing graph is already reset")
+	assert.Error(t, ResetReplayGraph(ctx, "search-db"))
+}
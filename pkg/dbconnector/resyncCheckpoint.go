@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Prefix of the Redis key holding the checkpoint of the resync of a cluster.
+const RESYNC_CHECKPOINT_KEY_PREFIX = "search-aggregator:resync-checkpoint:"
+
+// Phases of a resync, in order.
+const (
+	ResyncNodesPhase = "nodes" // Comparing the resources and writing the changed ones, by UID.
+	ResyncEdgesPhase = "edges" // The resources are reconciled and the rest deleted, the edges are left.
+)
+
+// Progress of a resync that was interrupted, so the collector sending the same resync again resumes it.
+type ResyncCheckpoint struct {
+	Hash      string    `json:"hash"` // Hash of the resync payload, a resync with another payload starts over.
+	Phase     string    `json:"phase"`
+	Watermark string    `json:"watermark,omitempty"` // In the nodes phase, the resources up to this UID are reconciled.
+	Resources int       `json:"resources"`           // Resources reconciled.
+	Started   time.Time `json:"started"`             // When the first attempt of the resync started.
+	SavedAt   time.Time `json:"savedAt"`
+}
+
+// Stores the checkpoint of the cluster, replacing the previous one. It's dropped after the max age.
+func SaveResyncCheckpoint(ctx context.Context, clusterName string, checkpoint ResyncCheckpoint,
+	maxAge time.Duration) error {
+	entry, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err = DeleteResyncCheckpoint(ctx, clusterName); err != nil {
+		return err
+	}
+	return addToTimeline(ctx, RESYNC_CHECKPOINT_KEY_PREFIX+clusterName, maxAge, []time.Time{checkpoint.SavedAt},
+		[][]byte{entry})
+}
+
+// Returns the checkpoint of the cluster saved within the max age, false when there's none.
+func ResyncCheckpointOf(ctx context.Context, clusterName string, maxAge time.Duration) (ResyncCheckpoint, bool,
+	error) {
+	checkpoint := ResyncCheckpoint{}
+	entries, err := readTimeline(ctx, RESYNC_CHECKPOINT_KEY_PREFIX+clusterName, time.Now().Add(-maxAge))
+	if err != nil || len(entries) == 0 {
+		return checkpoint, false, err
+	}
+	err = json.Unmarshal(entries[len(entries)-1], &checkpoint)
+	return checkpoint, err == nil, err
+}
+
+// Deletes the checkpoint of the cluster, once its resync completed.
+func DeleteResyncCheckpoint(ctx context.Context, clusterName string) error {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("DEL", RESYNC_CHECKPOINT_KEY_PREFIX+clusterName)
+	return err
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// A policy from RETENTION_POLICIES, limits how long or how many resources of an ephemeral kind are kept.
+// e.g. {"kind": "Pod", "match": {"status": ["Completed", "Error"]}, "maxAgeMinutes": 60}
+type RetentionPolicy struct {
+	Kind          string              `json:"kind"`                    // Kind of the resources, as in the node label.
+	Match         map[string][]string `json:"match,omitempty"`         // Only resources with one of the string values.
+	MaxAgeMinutes int                 `json:"maxAgeMinutes,omitempty"` // Drop resources created longer ago.
+	KeepPerOwner  int                 `json:"keepPerOwner,omitempty"`  // Keep only the newest resources of each owner.
+}
+
+// Policies parsed from RETENTION_POLICIES, parsed again when the config changes.
+var (
+	retentionConfig   string
+	retentionPolicies []RetentionPolicy
+	retentionMutex    = sync.Mutex{}
+)
+
+// Kinds and properties are written in the queries as is, they can't be quoted.
+var retentionNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parses the policies. Invalid policies are logged and skipped.
+func parseRetentionPolicies(value string) []RetentionPolicy {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var parsed []RetentionPolicy
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		logger.Error("Error parsing RETENTION_POLICIES, no retention policies are enforced: ", err)
+		return nil
+	}
+	valid := make([]RetentionPolicy, 0, len(parsed))
+	for i, p := range parsed {
+		var err error
+		switch {
+		case !retentionNameRegex.MatchString(p.Kind):
+			err = fmt.Errorf("invalid kind %q", p.Kind)
+		case p.MaxAgeMinutes < 0 || p.KeepPerOwner < 0:
+			err = fmt.Errorf("maxAgeMinutes and keepPerOwner can't be negative")
+		case p.MaxAgeMinutes == 0 && p.KeepPerOwner == 0:
+			err = fmt.Errorf("maxAgeMinutes or keepPerOwner is required")
+		}
+		for property := range p.Match {
+			if err == nil && !retentionNameRegex.MatchString(property) {
+				err = fmt.Errorf("invalid match property %q", property)
+			}
+		}
+		if err != nil {
+			logger.Errorf("Skipping retention policy %d from RETENTION_POLICIES: %s", i, err)
+			continue
+		}
+		valid = append(valid, p)
+	}
+	return valid
+}
+
+// Returns the policies from RETENTION_POLICIES.
+func RetentionPolicies() []RetentionPolicy {
+	retentionMutex.Lock()
+	defer retentionMutex.Unlock()
+	if retentionConfig != config.Cfg.RetentionPolicies {
+		retentionConfig = config.Cfg.RetentionPolicies
+		retentionPolicies = parseRetentionPolicies(retentionConfig)
+	}
+	return retentionPolicies
+}
+
+// Tells whether the policy applies to a resource with the properties.
+func (p RetentionPolicy) Matches(properties map[string]interface{}) bool {
+	if kind, _ := properties["kind"].(string); kind != p.Kind {
+		return false
+	}
+	for property, values := range p.Match {
+		value, ok := properties[property].(string)
+		if !ok || !contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tells whether a resource with the properties is older than the max age of the policy at the time.
+// Resources without a created time don't expire.
+func (p RetentionPolicy) Expired(properties map[string]interface{}, now time.Time) bool {
+	if p.MaxAgeMinutes == 0 {
+		return false
+	}
+	created, ok := properties["created"].(string)
+	if !ok {
+		return false
+	}
+	createdAt, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return false
+	}
+	return now.Sub(createdAt) > time.Duration(p.MaxAgeMinutes)*time.Minute
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the WHERE clause matching the nodes of the policy, the created time is compared by its RFC3339 string.
+func (p RetentionPolicy) condition(variable string, cutoff string) string {
+	conditions := []string{}
+	properties := make([]string, 0, len(p.Match))
+	for property := range p.Match {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties) // Sorting to make the queries predictable
+	for _, property := range properties {
+		conditions = append(conditions, variable+"."+property+" IN "+quotedList(p.Match[property]))
+	}
+	if cutoff != "" {
+		conditions = append(conditions, SanitizeQuery(variable+".created < '%s'", cutoff))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// Returns the UIDs of the nodes the policy drops at the time: the expired nodes, and the oldest nodes of each owner
+// beyond keepPerOwner. Nodes without an owner are only dropped when they expire.
+func (p RetentionPolicy) reapUIDs(ctx context.Context, now time.Time) ([]string, error) {
+	uids := []string{}
+	if p.MaxAgeMinutes > 0 {
+		cutoff := now.Add(-time.Duration(p.MaxAgeMinutes) * time.Minute).UTC().Format(time.RFC3339)
+		result, err := Store.Query(ctx, "MATCH (n:"+p.Kind+")"+p.condition("n", cutoff)+" RETURN n._uid")
+		if err != nil {
+			return nil, err
+		}
+		for result.Next() {
+			uids = append(uids, recordString(result.Record().GetByIndex(0)))
+		}
+	}
+	if p.KeepPerOwner > 0 {
+		result, err := Store.Query(ctx,
+			"MATCH (n:"+p.Kind+")-[:ownedBy]->(o)"+p.condition("n", "")+" RETURN o._uid, n._uid, n.created")
+		if err != nil {
+			return nil, err
+		}
+		type owned struct{ uid, created string }
+		byOwner := make(map[string][]owned)
+		for result.Next() {
+			record := result.Record()
+			owner := recordString(record.GetByIndex(0))
+			byOwner[owner] = append(byOwner[owner],
+				owned{uid: recordString(record.GetByIndex(1)), created: recordString(record.GetByIndex(2))})
+		}
+		for _, resources := range byOwner {
+			sort.Slice(resources, func(i, j int) bool { // Newest first, RFC3339 times sort as strings.
+				if resources[i].created != resources[j].created {
+					return resources[i].created > resources[j].created
+				}
+				return resources[i].uid < resources[j].uid
+			})
+			for i := p.KeepPerOwner; i < len(resources); i++ {
+				uids = append(uids, resources[i].uid)
+			}
+		}
+	}
+	return uids, nil
+}
+
+// Deletes the nodes dropped by the retention policies at the time, and returns how many were deleted.
+func ReapRetention(ctx context.Context, now time.Time) (int, error) {
+	ctx = WithLane(ctx, BulkLane)
+	deleted := 0
+	for _, p := range RetentionPolicies() {
+		uids, err := p.reapUIDs(ctx, now)
+		if err != nil {
+			return deleted, err
+		}
+		if len(uids) == 0 {
+			continue
+		}
+		result := ChunkedDelete(ctx, uniqueStrings(uids)) // A node can be both expired and beyond keepPerOwner.
+		deleted += result.SuccessfulResources
+		metrics.RetentionDeletes.WithLabelValues(p.Kind).Add(float64(result.SuccessfulResources))
+		if err := result.Err(); IsRetryable(err) {
+			return deleted, err
+		}
+		for uid, err := range result.ResourceErrors {
+			logger.Warningf("Error deleting resource %s for the retention policy of %s: %s", uid, p.Kind, err)
+		}
+	}
+	return deleted, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// Enforces the RETENTION_POLICIES on the graph every RETENTION_REAP_RATE_MS.
+func RetentionJob() {
+	for {
+		time.Sleep(time.Duration(config.Cfg.RetentionReapRateMS) * time.Millisecond)
+		if len(RetentionPolicies()) == 0 {
+			continue
+		}
+		deleted, err := ReapRetention(context.Background(), time.Now())
+		if err != nil {
+			logger.Error("Error enforcing the retention policies: ", err)
+		}
+		logger.V(2).Infof("Retention policies deleted %d resources.", deleted)
+	}
+}
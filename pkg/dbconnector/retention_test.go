@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseRetentionPolicies(t *testing.T) {
+	policies := parseRetentionPolicies(`[
+		{"kind": "Event", "maxAgeMinutes": 60},
+		{"kind": "Pod) DETACH DELETE (n", "maxAgeMinutes": 60},
+		{"kind": "Pod", "match": {"status) OR true": ["x"]}, "maxAgeMinutes": 60},
+		{"kind": "Job"},
+		{"kind": "Job", "keepPerOwner": 2, "match": {"status": ["Complete"]}}
+	]`)
+	assert.Equal(t, []RetentionPolicy{
+		{Kind: "Event", MaxAgeMinutes: 60},
+		{Kind: "Job", KeepPerOwner: 2, Match: map[string][]string{"status": {"Complete"}}},
+	}, policies)
+	assert.Nil(t, parseRetentionPolicies("not json"))
+}
+
+func TestRetentionPolicy_Expired(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	p := RetentionPolicy{Kind: "Pod", Match: map[string][]string{"status": {"Completed"}}, MaxAgeMinutes: 60}
+
+	old := map[string]interface{}{"kind": "Pod", "status": "Completed", "created": "2021-06-01T10:00:00Z"}
+	assert.True(t, p.Matches(old))
+	assert.True(t, p.Expired(old, now))
+	assert.False(t, p.Expired(map[string]interface{}{"created": "2021-06-01T11:30:00Z"}, now))
+	assert.False(t, p.Expired(map[string]interface{}{}, now), "Resources without a created time don't expire")
+	assert.False(t, p.Matches(map[string]interface{}{"kind": "Pod", "status": "Running"}))
+	assert.False(t, p.Matches(map[string]interface{}{"kind": "Job", "status": "Completed"}))
+}
+
+func TestReapRetention(t *testing.T) {
+	useTestDatastore(t)
+	t.Cleanup(config.Snapshot())
+	config.Cfg.RetentionPolicies = `[{"kind": "Event", "maxAgeMinutes": 60},
+		{"kind": "Job", "match": {"status": ["Complete"]}, "keepPerOwner": 1}]`
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (:Event {_uid:'c1/e1', kind:'Event', created:'2021-06-01T10:00:00Z'}), "+
+		"(:Event {_uid:'c1/e2', kind:'Event', created:'2021-06-01T11:30:00Z'}), "+
+		"(c:CronJob {_uid:'c1/cj', kind:'CronJob'}), "+
+		"(:Job {_uid:'c1/j1', kind:'Job', status:'Complete', created:'2021-06-01T09:00:00Z'})-[:ownedBy]->(c), "+
+		"(:Job {_uid:'c1/j2', kind:'Job', status:'Complete', created:'2021-06-01T10:00:00Z'})-[:ownedBy]->(c), "+
+		"(:Job {_uid:'c1/j3', kind:'Job', status:'Running', created:'2021-06-01T08:00:00Z'})-[:ownedBy]->(c), "+
+		"(:Job {_uid:'c1/j4', kind:'Job', status:'Complete', created:'2021-06-01T08:00:00Z'})")
+	assert.NoError(t, err)
+
+	deleted, err := ReapRetention(ctx, time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, 0, queryRows(t, "MATCH (n {_uid:'c1/e1'}) RETURN n"), "Expired event is deleted")
+	assert.Equal(t, 0, queryRows(t, "MATCH (n {_uid:'c1/j1'}) RETURN n"), "Oldest complete job is deleted")
+	assert.Equal(t, 5, queryRows(t, "MATCH (n) RETURN n"))
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Writes of the resources in the retry queue.
+const (
+	RETRY_INSERT = "insert"
+	RETRY_UPDATE = "update"
+)
+
+// Outcomes of the resources in the retry queue. Also used as metric labels.
+const (
+	RETRY_QUEUED     = "queued"
+	RETRY_SUCCEEDED  = "succeeded"
+	RETRY_FAILED     = "failed"     // The retry failed, the resource is retried again after a longer backoff.
+	RETRY_DROPPED    = "dropped"    // The resource failed RESOURCE_RETRY_ATTEMPTS retries and is forgotten.
+	RETRY_OVERFLOW   = "overflow"   // Not queued because the queue of the cluster is full.
+	RETRY_SUPERSEDED = "superseded" // A newer sync sent the resource, or the cluster was resynced or deleted.
+)
+
+// Longest backoff between the retries of a resource, in multiples of RESOURCE_RETRY_BACKOFF_MS.
+const maxRetryBackoffFactor = 64
+
+// A resource that failed to be inserted or updated with an error of its own, waiting to be written again.
+type RetryEntry struct {
+	Resource  *Resource
+	Op        string    // insert or update
+	Attempts  int       // Retries that failed.
+	Next      time.Time // The resource isn't retried before.
+	LastError string
+}
+
+// Resources of each cluster waiting to be written again, by UID. Kept in memory only, the next resync of the
+// cluster writes them again after a restart.
+var (
+	retryQueues      = make(map[string]map[string]*RetryEntry)
+	retryQueuesMutex = sync.Mutex{}
+)
+
+// Returns how long a resource waits before its next retry, doubled by each failed retry.
+func retryBackoff(attempts int) time.Duration {
+	factor := 1
+	for i := 0; i < attempts && factor < maxRetryBackoffFactor; i++ {
+		factor *= 2
+	}
+	return time.Duration(config.Cfg.ResourceRetryBackoffMS*factor) * time.Millisecond
+}
+
+func setRetryQueueMetric() {
+	total := 0
+	for _, entries := range retryQueues {
+		total += len(entries)
+	}
+	metrics.ResourceRetryQueue.Set(float64(total))
+}
+
+// Queues the resources that failed with an error of their own, e.g. the ResourceErrors of a chunked insert, and
+// returns their UIDs, sorted. Nothing is queued when RESOURCE_RETRY_ATTEMPTS is 0, and the resources over
+// RESOURCE_RETRY_QUEUE_SIZE for the cluster are left out.
+func QueueRetries(clusterName string, op string, resources []*Resource, errs map[string]error,
+	now time.Time) []string {
+	if config.Cfg.ResourceRetryAttempts <= 0 || len(errs) == 0 {
+		return nil
+	}
+	retryQueuesMutex.Lock()
+	defer retryQueuesMutex.Unlock()
+	queue, ok := retryQueues[clusterName]
+	if !ok {
+		queue = make(map[string]*RetryEntry, len(errs))
+		retryQueues[clusterName] = queue
+	}
+	queued := []string{}
+	for _, resource := range resources {
+		err, failed := errs[resource.UID]
+		if !failed {
+			continue
+		}
+		if _, exists := queue[resource.UID]; !exists && config.Cfg.ResourceRetryQueueSize > 0 &&
+			len(queue) >= config.Cfg.ResourceRetryQueueSize {
+			metrics.ResourceRetries.WithLabelValues(RETRY_OVERFLOW).Inc()
+			continue
+		}
+		queue[resource.UID] = &RetryEntry{Resource: resource, Op: op, Next: now.Add(retryBackoff(0)),
+			LastError: err.Error()}
+		metrics.ResourceRetries.WithLabelValues(RETRY_QUEUED).Inc()
+		queued = append(queued, resource.UID)
+	}
+	if len(queue) == 0 {
+		delete(retryQueues, clusterName)
+	}
+	setRetryQueueMetric()
+	if len(queued) < len(errs) {
+		logger.Warningf("Retry queue of cluster %s is full, %d failed resources won't be retried.", clusterName,
+			len(errs)-len(queued))
+	}
+	sort.Strings(queued)
+	return queued
+}
+
+// Removes the resources a newer sync of the cluster sent from the retry queue, its write wins.
+func CancelRetries(clusterName string, uids []string) {
+	retryQueuesMutex.Lock()
+	defer retryQueuesMutex.Unlock()
+	queue, ok := retryQueues[clusterName]
+	if !ok {
+		return
+	}
+	for _, uid := range uids {
+		if _, ok := queue[uid]; ok {
+			delete(queue, uid)
+			metrics.ResourceRetries.WithLabelValues(RETRY_SUPERSEDED).Inc()
+		}
+	}
+	if len(queue) == 0 {
+		delete(retryQueues, clusterName)
+	}
+	setRetryQueueMetric()
+}
+
+// Forgets the resources of a cluster waiting to be retried, e.g. when it's resynced or deleted.
+func DropRetries(clusterName string) {
+	retryQueuesMutex.Lock()
+	defer retryQueuesMutex.Unlock()
+	if queue, ok := retryQueues[clusterName]; ok {
+		metrics.ResourceRetries.WithLabelValues(RETRY_SUPERSEDED).Add(float64(len(queue)))
+		delete(retryQueues, clusterName)
+	}
+	setRetryQueueMetric()
+}
+
+// Returns the number of resources waiting to be retried, by cluster.
+func PendingRetries() map[string]int {
+	retryQueuesMutex.Lock()
+	defer retryQueuesMutex.Unlock()
+	counts := make(map[string]int, len(retryQueues))
+	for clusterName, queue := range retryQueues {
+		counts[clusterName] = len(queue)
+	}
+	return counts
+}
+
+// Returns the clusters with resources due for a retry, sorted.
+func DueRetryClusters(now time.Time) []string {
+	retryQueuesMutex.Lock()
+	defer retryQueuesMutex.Unlock()
+	clusters := []string{}
+	for clusterName, queue := range retryQueues {
+		for _, entry := range queue {
+			if !entry.Next.After(now) {
+				clusters = append(clusters, clusterName)
+				break
+			}
+		}
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+// Removes the resources of the cluster due for a retry from the queue and returns them, sorted by UID. The caller
+// holds the sync lock of the cluster, so a newer sync can't send them meanwhile, and completes them with
+// CompleteRetries.
+func TakeDueRetries(clusterName string, now time.Time) []*RetryEntry {
+	retryQueuesMutex.Lock()
+	defer retryQueuesMutex.Unlock()
+	queue := retryQueues[clusterName]
+	due := []*RetryEntry{}
+	for uid, entry := range queue {
+		if !entry.Next.After(now) {
+			due = append(due, entry)
+			delete(queue, uid)
+		}
+	}
+	if len(queue) == 0 {
+		delete(retryQueues, clusterName)
+	}
+	setRetryQueueMetric()
+	sort.Slice(due, func(i, j int) bool { return due[i].Resource.UID < due[j].Resource.UID })
+	return due
+}
+
+// Completes the retries written with the result. The resources that failed again are queued after a longer
+// backoff, or dropped once they failed RESOURCE_RETRY_ATTEMPTS retries. Returns the number that succeeded.
+func CompleteRetries(clusterName string, entries []*RetryEntry, result ChunkedOperationResult, now time.Time) int {
+	retryQueuesMutex.Lock()
+	defer retryQueuesMutex.Unlock()
+	succeeded := 0
+	for _, entry := range entries {
+		err := result.ConnectionError
+		if err == nil {
+			err = result.ResourceErrors[entry.Resource.UID]
+		}
+		if err == nil {
+			succeeded++
+			metrics.ResourceRetries.WithLabelValues(RETRY_SUCCEEDED).Inc()
+			continue
+		}
+		entry.Attempts++
+		entry.LastError = err.Error()
+		if entry.Attempts >= config.Cfg.ResourceRetryAttempts {
+			logger.Warningf("Dropping resource %s of cluster %s after %d failed retries to %s it: %s",
+				entry.Resource.UID, clusterName, entry.Attempts, entry.Op, entry.LastError)
+			metrics.ResourceRetries.WithLabelValues(RETRY_DROPPED).Inc()
+			continue
+		}
+		queue, ok := retryQueues[clusterName]
+		if !ok {
+			queue = make(map[string]*RetryEntry)
+			retryQueues[clusterName] = queue
+		}
+		if _, newer := queue[entry.Resource.UID]; !newer {
+			entry.Next = now.Add(retryBackoff(entry.Attempts))
+			queue[entry.Resource.UID] = entry
+			metrics.ResourceRetries.WithLabelValues(RETRY_FAILED).Inc()
+		}
+	}
+	setRetryQueueMetric()
+	return succeeded
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetRetryQueues() {
+	retryQueues = make(map[string]map[string]*RetryEntry)
+}
+
+func setRetryConfig(t *testing.T, attempts, backoffMS, size int) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.ResourceRetryAttempts, config.Cfg.ResourceRetryBackoffMS = attempts, backoffMS
+	config.Cfg.ResourceRetryQueueSize = size
+}
+
+func retryResources(uids ...string) []*Resource {
+	resources := make([]*Resource, len(uids))
+	for i, uid := range uids {
+		resources[i] = &Resource{UID: uid, Properties: map[string]interface{}{"kind": "pod"}}
+	}
+	return resources
+}
+
+func TestQueueRetries(t *testing.T) {
+	resetRetryQueues()
+	defer resetRetryQueues()
+	setRetryConfig(t, 3, 1000, 2)
+	now := time.Now()
+	failed := map[string]error{"c1/b": errors.New("boom"), "c1/c": errors.New("boom"), "c1/d": errors.New("boom")}
+
+	queued := QueueRetries("c1", RETRY_INSERT, retryResources("c1/a", "c1/b", "c1/c", "c1/d"), failed, now)
+	assert.Len(t, queued, 2, "The queue of the cluster is full")
+	assert.Equal(t, map[string]int{"c1": 2}, PendingRetries())
+	assert.Empty(t, DueRetryClusters(now), "Waiting for the backoff")
+	assert.Equal(t, []string{"c1"}, DueRetryClusters(now.Add(time.Second)))
+
+	CancelRetries("c1", []string{queued[0], "c1/x"})
+	assert.Equal(t, map[string]int{"c1": 1}, PendingRetries())
+	DropRetries("c1")
+	assert.Empty(t, PendingRetries())
+
+	config.Cfg.ResourceRetryAttempts = 0
+	assert.Empty(t, QueueRetries("c1", RETRY_INSERT, retryResources("c1/b"), failed, now), "Disabled")
+}
+
+func TestCompleteRetries(t *testing.T) {
+	resetRetryQueues()
+	defer resetRetryQueues()
+	setRetryConfig(t, 2, 1000, 0)
+	now := time.Now()
+	failed := map[string]error{"c1/a": errors.New("boom"), "c1/b": errors.New("boom")}
+	QueueRetries("c1", RETRY_UPDATE, retryResources("c1/a", "c1/b"), failed, now)
+
+	entries := TakeDueRetries("c1", now.Add(time.Second))
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "c1/a", entries[0].Resource.UID)
+		assert.Equal(t, RETRY_UPDATE, entries[0].Op)
+	}
+	assert.Empty(t, PendingRetries())
+
+	result := ChunkedOperationResult{ResourceErrors: map[string]error{"c1/b": errors.New("again")},
+		SuccessfulResources: 1}
+	assert.Equal(t, 1, CompleteRetries("c1", entries, result, now))
+	assert.Equal(t, map[string]int{"c1": 1}, PendingRetries(), "The failed resource is queued again")
+	assert.Empty(t, DueRetryClusters(now.Add(time.Second)), "The backoff doubled")
+
+	entries = TakeDueRetries("c1", now.Add(2*time.Second))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, 1, entries[0].Attempts)
+		assert.Equal(t, "again", entries[0].LastError)
+	}
+	result = ChunkedOperationResult{ConnectionError: errors.New("down")}
+	assert.Equal(t, 0, CompleteRetries("c1", entries, result, now))
+	assert.Empty(t, PendingRetries(), "Dropped after RESOURCE_RETRY_ATTEMPTS retries")
+}
+
+func Test_retryBackoff(t *testing.T) {
+	setRetryConfig(t, 5, 100, 0)
+	assert.Equal(t, 100*time.Millisecond, retryBackoff(0))
+	assert.Equal(t, 400*time.Millisecond, retryBackoff(2))
+	assert.Equal(t, time.Duration(maxRetryBackoffFactor)*100*time.Millisecond, retryBackoff(100))
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+)
+
+// Node property counting the writes of the node. It's 1 when inserted, and incremented by every update.
+const REV_PROPERTY = "_rev"
+
+// A resource of a delta sync sent with a revision that isn't the one of its node.
+type RevisionConflict struct {
+	UID         string
+	ExpectedRev int64
+	CurrentRev  int64 // 0 when the node doesn't exist, or was inserted before revisions.
+}
+
+// Returns the revision of the nodes with the UIDs. Nodes that don't exist are left out, nodes inserted
+// before revisions have revision 0.
+func ResourceRevisions(ctx context.Context, uids []string) (map[string]int64, error) {
+	revisions := make(map[string]int64, len(uids))
+	chunkSize := ChunkSize()
+	for i := 0; i < len(uids); i += chunkSize {
+		query := fmt.Sprintf("MATCH (n) WHERE n._uid IN %s RETURN n._uid, n.%s",
+			quotedList(uids[i:min(i+chunkSize, len(uids))]), REV_PROPERTY)
+		result, err := Store.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for result.Next() {
+			record := result.Record()
+			rev, _ := record.GetByIndex(1).(int)
+			revisions[recordString(record.GetByIndex(0))] = int64(rev)
+		}
+	}
+	return revisions, nil
+}
+
+// Splits the updates of a delta sync, the ones sent with a revision are only applied when it's the current
+// revision of the node. This keeps a delta applied out of order from overwriting a newer write.
+// Updates without a revision are always applied. Returns the updates to apply and the conflicts.
+// The check isn't atomic with the update, it relies on the syncs of a cluster being processed one at a time.
+func CheckRevisions(ctx context.Context, resources []*Resource) ([]*Resource, []RevisionConflict, error) {
+	uids := []string{}
+	for _, resource := range resources {
+		if resource.Rev > 0 {
+			uids = append(uids, resource.UID)
+		}
+	}
+	if len(uids) == 0 {
+		return resources, nil, nil
+	}
+	revisions, err := ResourceRevisions(ctx, uids)
+	if err != nil {
+		return nil, nil, err
+	}
+	accepted := make([]*Resource, 0, len(resources))
+	var conflicts []RevisionConflict
+	for _, resource := range resources {
+		if current := revisions[resource.UID]; resource.Rev > 0 && current != resource.Rev {
+			conflicts = append(conflicts, RevisionConflict{UID: resource.UID, ExpectedRev: resource.Rev,
+				CurrentRev: current})
+			continue
+		}
+		accepted = append(accepted, resource)
+	}
+	return accepted, conflicts, nil
+}
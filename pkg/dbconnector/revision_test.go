@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRevisions(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	pod := func(name string, rev int64) *Resource {
+		return &Resource{Kind: "Pod", UID: "c1/" + name, Rev: rev,
+			Properties: map[string]interface{}{"kind": "Pod", "name": name}}
+	}
+	assert.Equal(t, 2, ChunkedInsert(ctx, []*Resource{pod("a", 0), pod("b", 0)}, "").SuccessfulResources)
+	assert.Equal(t, 1, ChunkedUpdate(ctx, []*Resource{pod("a", 0)}).SuccessfulResources)
+
+	revisions, err := ResourceRevisions(ctx, []string{"c1/a", "c1/b", "c1/missing"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"c1/a": 2, "c1/b": 1}, revisions)
+
+	// a was updated since revision 1, the update without a revision is always applied.
+	accepted, conflicts, err := CheckRevisions(ctx, []*Resource{pod("a", 1), pod("b", 1), pod("missing", 3),
+		pod("c", 0)})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Resource{pod("b", 1), pod("c", 0)}, accepted)
+	assert.Equal(t, []RevisionConflict{
+		{UID: "c1/a", ExpectedRev: 1, CurrentRev: 2},
+		{UID: "c1/missing", ExpectedRev: 3, CurrentRev: 0},
+	}, conflicts)
+}
@@ -8,10 +8,12 @@ import (
 	"strings"
 )
 
-// Escape any characters that could break the openCypher query.
+// Escape any characters that could break the openCypher query. Backslashes are escaped first, a value ending with
+// one would otherwise escape the closing quote of its string, e.g. a\'OR(1=1)//
 func sanitizeValue(value string) string {
-	res1 := strings.Replace(value, "\"", "\\\"", -1) // Escape all double quotes.
-	res2 := strings.Replace(res1, "'", "\\'", -1)    // Escape all single quotes.
+	res0 := strings.Replace(value, `\`, `\\`, -1)   // Escape all backslashes.
+	res1 := strings.Replace(res0, "\"", "\\\"", -1) // Escape all double quotes.
+	res2 := strings.Replace(res1, "'", "\\'", -1)   // Escape all single quotes.
 	return res2
 }
 
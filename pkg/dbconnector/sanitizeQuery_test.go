@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeQuery(t *testing.T) {
+	assert.Equal(t, `n.name = 'a\\\'OR(1=1)//'`, SanitizeQuery("n.name = '%s'", `a\'OR(1=1)//`))
+	assert.Equal(t, `n.name = '\"x\" \\\\'`, SanitizeQuery("n.name = '%s'", `"x" \\`))
+	assert.Equal(t, "n.restarts = 3", SanitizeQuery("n.restarts = %d", 3))
+}
+
+// The stored strings read back unchanged from RedisGraph, including their backslashes and quotes.
+func TestSanitizeQuery_redisGraph(t *testing.T) {
+	useRedisGraph(t)
+	ctx := context.Background()
+
+	values := []string{`\`, `\\`, `a\b`, `C:\path\`, `a\'OR(1=1)//`, `it's`, `"quoted"`, `\"`, `\n`}
+	for i, value := range values {
+		_, err := Store.Query(ctx, SanitizeQuery("CREATE (:Pod {_uid:'c1/p%d', name:'%s'})", i, value))
+		assert.NoError(t, err)
+	}
+	for i, value := range values {
+		result, err := Store.Query(ctx, SanitizeQuery("MATCH (n:Pod {name:'%s'}) RETURN n._uid, n.name", value))
+		assert.NoError(t, err)
+		if assert.True(t, result.Next(), value) {
+			assert.Equal(t, []interface{}{fmt.Sprintf("c1/p%d", i), value}, result.Record().Values())
+		}
+		assert.False(t, result.Next(), value)
+	}
+}
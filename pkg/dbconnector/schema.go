@@ -0,0 +1,148 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Types of the stored properties, as in the schema API. Booleans are stored as strings.
+const (
+	SCHEMA_STRING = "string"
+	SCHEMA_NUMBER = "number"
+	SCHEMA_LIST   = "list" // Lists and labels.
+)
+
+// A property of a kind and the types it was written with. A property has more than one type when resources of the
+// kind disagree, e.g. a number sent as a string by some collectors.
+type SchemaProperty struct {
+	Name  string   `json:"name"`
+	Types []string `json:"types"`
+}
+
+// A kind and its properties, without the internal ones, e.g. _uid.
+type SchemaKind struct {
+	Kind       string           `json:"kind"`
+	Properties []SchemaProperty `json:"properties"`
+}
+
+// Kinds, properties and edge types written to the graph, sorted by name.
+type Schema struct {
+	Kinds     []SchemaKind `json:"kinds"`
+	EdgeTypes []string     `json:"edgeTypes"`
+}
+
+// Kinds and edge types written since the aggregator started, kept up to date as the resources are written so the
+// schema API doesn't have to scan the graph.
+var (
+	schemaKinds     = make(map[string]map[string]map[string]struct{}) // kind -> property -> types
+	schemaEdgeTypes = make(map[string]struct{})
+	schemaMutex     = sync.RWMutex{}
+)
+
+// Node labels by lowercased kind, e.g. "pod" -> "Pod". Loaded from the graph on first use and kept up to date as the
+// resources are written, so the searches with KIND_LABELS don't list the labels of the graph every time.
+var (
+	schemaLabels       = make(map[string]map[string]struct{}) // lowercased kind -> labels
+	schemaLabelsLoaded = false
+)
+
+// Returns the schema type of an encoded property.
+func schemaType(value interface{}) string {
+	switch value.(type) {
+	case int64:
+		return SCHEMA_NUMBER
+	case []interface{}, map[string]interface{}:
+		return SCHEMA_LIST
+	default:
+		return SCHEMA_STRING
+	}
+}
+
+// Adds the kind and the properties of an encoded resource to the schema. The kind is the label of the node.
+func observeSchema(kind string, encodedProps map[string]interface{}) {
+	schemaMutex.Lock()
+	defer schemaMutex.Unlock()
+	observeLabel(kind)
+	kind = strings.ToLower(kind)
+	properties, ok := schemaKinds[kind]
+	if !ok {
+		properties = make(map[string]map[string]struct{}, len(encodedProps))
+		schemaKinds[kind] = properties
+	}
+	for property, value := range encodedProps {
+		if strings.HasPrefix(property, "_") {
+			continue
+		}
+		types, ok := properties[property]
+		if !ok {
+			types = make(map[string]struct{}, 1)
+			properties[property] = types
+		}
+		types[schemaType(value)] = struct{}{}
+	}
+}
+
+// Adds a node label to the labels of its kind. Must hold schemaMutex.
+func observeLabel(label string) {
+	kind := strings.ToLower(label)
+	labels, ok := schemaLabels[kind]
+	if !ok {
+		labels = make(map[string]struct{}, 1)
+		schemaLabels[kind] = labels
+	}
+	labels[label] = struct{}{}
+}
+
+// Forgets the node labels, they're loaded again from the graph on the next search. Used when the datastore changes.
+func resetKindLabels() {
+	schemaMutex.Lock()
+	defer schemaMutex.Unlock()
+	schemaLabels = make(map[string]map[string]struct{})
+	schemaLabelsLoaded = false
+}
+
+// Adds an edge type to the schema.
+func ObserveEdgeType(edgeType string) {
+	schemaMutex.RLock()
+	_, ok := schemaEdgeTypes[edgeType]
+	schemaMutex.RUnlock()
+	if ok {
+		return
+	}
+	schemaMutex.Lock()
+	defer schemaMutex.Unlock()
+	schemaEdgeTypes[edgeType] = struct{}{}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the kinds, properties and edge types written since the aggregator started. They're kept when the
+// resources are deleted.
+func CurrentSchema() Schema {
+	schemaMutex.RLock()
+	defer schemaMutex.RUnlock()
+	schema := Schema{Kinds: make([]SchemaKind, 0, len(schemaKinds)), EdgeTypes: sortedKeys(schemaEdgeTypes)}
+	for kind, properties := range schemaKinds {
+		schemaKind := SchemaKind{Kind: kind, Properties: make([]SchemaProperty, 0, len(properties))}
+		for property, types := range properties {
+			schemaKind.Properties = append(schemaKind.Properties, SchemaProperty{Name: property, Types: sortedKeys(types)})
+		}
+		sort.Slice(schemaKind.Properties, func(i, j int) bool {
+			return schemaKind.Properties[i].Name < schemaKind.Properties[j].Name
+		})
+		schema.Kinds = append(schema.Kinds, schemaKind)
+	}
+	sort.Slice(schema.Kinds, func(i, j int) bool { return schema.Kinds[i].Kind < schema.Kinds[j].Kind })
+	return schema
+}
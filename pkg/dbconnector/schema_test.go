@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetSchema() {
+	schemaKinds = make(map[string]map[string]map[string]struct{})
+	schemaEdgeTypes = make(map[string]struct{})
+}
+
+func TestCurrentSchema(t *testing.T) {
+	resetSchema()
+	defer resetSchema()
+
+	// The schema is kept as the queries are built.
+	pod := &Resource{Kind: "Pod", UID: "c1/p1", Properties: map[string]interface{}{"kind": "Pod", "name": "p1",
+		"restarts": int64(2), "label": map[string]interface{}{"app": "a"}, "ready": true}}
+	insertQuery([]*Resource{pod}, "c1")
+	updated := &Resource{Kind: "Pod", UID: "c1/p1", Properties: map[string]interface{}{"kind": "Pod", "name": "p1",
+		"restarts": "many"}}
+	updateQuery([]*Resource{updated})
+	ObserveEdgeType("ownedBy")
+	ObserveEdgeType("ownedBy")
+
+	schema := CurrentSchema()
+	assert.Equal(t, []string{"inCluster", "ownedBy"}, schema.EdgeTypes)
+	if assert.Equal(t, 1, len(schema.Kinds)) {
+		assert.Equal(t, "pod", schema.Kinds[0].Kind)
+		assert.Equal(t, []SchemaProperty{
+			{Name: "kind", Types: []string{SCHEMA_STRING}},
+			{Name: "label", Types: []string{SCHEMA_LIST}},
+			{Name: "name", Types: []string{SCHEMA_STRING}},
+			{Name: "ready", Types: []string{SCHEMA_STRING}},
+			{Name: "restarts", Types: []string{SCHEMA_NUMBER, SCHEMA_STRING}},
+		}, schema.Kinds[0].Properties)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"strings"
+)
+
+// Resources a user of the search API can see, from the RBAC of the hub.
+type ResourceAccess struct {
+	All         bool     `json:"all"`         // Every resource, e.g. bound to cluster-admin.
+	AllClusters bool     `json:"allClusters"` // Every resource of the managed clusters.
+	Clusters    []string `json:"clusters"`    // Managed clusters the user can see every resource of.
+	// Namespaces of local-cluster the user can see the resources of. Resources of the managed clusters are matched
+	// by the namespace of their cluster on the hub, same as the _rbac property.
+	Namespaces []string `json:"namespaces"`
+}
+
+// Returns the condition matching the nodes the user can see, e.g.
+// (n.cluster IN ['c1'] OR n._clusterNamespace IN ['ns1'] OR (n.cluster = 'local-cluster' AND n.namespace IN ['ns1']))
+// Empty when the user can see every resource.
+func (a ResourceAccess) Condition(variable string) string {
+	if a.All {
+		return ""
+	}
+	conditions := []string{}
+	if a.AllClusters {
+		conditions = append(conditions, variable+".cluster <> 'local-cluster'")
+	} else if len(a.Clusters) > 0 {
+		conditions = append(conditions, variable+".cluster IN "+quotedList(a.Clusters))
+	}
+	if len(a.Namespaces) > 0 {
+		namespaces := quotedList(a.Namespaces)
+		conditions = append(conditions, variable+"._clusterNamespace IN "+namespaces,
+			"("+variable+".cluster = 'local-cluster' AND "+variable+".namespace IN "+namespaces+")")
+	}
+	if len(conditions) == 0 {
+		return "false"
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// Tells whether the user can see the resources of the namespace in the cluster, same as Condition. Resources of the
+// managed clusters are visible with their cluster namespace on the hub, which has the name of the cluster.
+func (a ResourceAccess) Allows(clusterName, namespace string) bool {
+	if a.All {
+		return true
+	}
+	if clusterName != "local-cluster" {
+		return a.AllClusters || contains(a.Clusters, clusterName) || contains(a.Namespaces, clusterName)
+	}
+	return namespace != "" && contains(a.Namespaces, namespace)
+}
+
+// Returns the compiled search matching only the resources the user can see.
+func (c CompiledSearch) WithAccess(access ResourceAccess) CompiledSearch {
+	condition := access.Condition("n")
+	if condition == "" {
+		return c
+	}
+	c.match += " AND " + condition
+	c.Query = c.match + " RETURN n"
+	c.CountQuery = c.match + " RETURN count(n)"
+	return c
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceAccessCondition(t *testing.T) {
+	assert.Equal(t, "", ResourceAccess{All: true}.Condition("n"))
+	assert.Equal(t, "false", ResourceAccess{}.Condition("n"))
+	assert.Equal(t, "(n.cluster <> 'local-cluster')", ResourceAccess{AllClusters: true, Clusters: []string{"c1"}}.Condition("n"))
+	assert.Equal(t, "(m.cluster IN ['c1'] OR m._clusterNamespace IN ['ns\\'1'] OR "+
+		"(m.cluster = 'local-cluster' AND m.namespace IN ['ns\\'1']))",
+		ResourceAccess{Clusters: []string{"c1"}, Namespaces: []string{"ns'1"}}.Condition("m"))
+}
+
+func TestResourceAccessAllows(t *testing.T) {
+	assert.True(t, ResourceAccess{All: true}.Allows("local-cluster", ""))
+	assert.True(t, ResourceAccess{AllClusters: true}.Allows("c1", "default"))
+	assert.False(t, ResourceAccess{AllClusters: true}.Allows("local-cluster", "default"))
+	assert.True(t, ResourceAccess{Clusters: []string{"c1"}}.Allows("c1", ""))
+	assert.True(t, ResourceAccess{Namespaces: []string{"c2"}}.Allows("c2", "default"))
+	assert.True(t, ResourceAccess{Namespaces: []string{"ns1"}}.Allows("local-cluster", "ns1"))
+	assert.False(t, ResourceAccess{Namespaces: []string{"ns1"}}.Allows("local-cluster", ""))
+	assert.False(t, ResourceAccess{}.Allows("c1", "default"))
+}
+
+func TestCompiledSearchWithAccess(t *testing.T) {
+	useTestDatastore(t)
+	_, err := Store.Query(context.Background(), "CREATE (:Pod {kind:'pod', cluster:'local-cluster', namespace:'ns1'}), "+
+		"(:Pod {kind:'pod', cluster:'local-cluster', namespace:'ns2'}), "+
+		"(:Pod {kind:'pod', cluster:'c1', namespace:'default', _clusterNamespace:'c1'}), "+
+		"(:Pod {kind:'pod', cluster:'c2', namespace:'default', _clusterNamespace:'c2'})")
+	assert.NoError(t, err)
+
+	compiled, err := CompileSearch("kind:pod")
+	assert.NoError(t, err)
+	for access, expected := range map[*ResourceAccess]int{
+		{All: true}:                   4,
+		{}:                            0,
+		{Namespaces: []string{"ns1"}}: 1,
+		{Namespaces: []string{"c2"}}:  1, // The namespace of the cluster on the hub.
+		{AllClusters: true}:           2,
+		{Clusters: []string{"c1"}, Namespaces: []string{"ns2"}}: 2,
+	} {
+		result, err := Store.Query(context.Background(), compiled.WithAccess(*access).Query)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, countRows(result), *access)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Max properties a search can be grouped by, each one multiplies the groups.
+const maxAggregateGroupBy = 3
+
+// Returned by SearchAggregate for a group by property that isn't a valid property name, or too many of them.
+var ErrInvalidGroupBy = errors.New("Invalid group by")
+
+// Number of resources matching a search with the same values of the group by properties.
+type AggregateGroup struct {
+	Values map[string]interface{} `json:"values"` // By group by property, null for the resources without it.
+	Count  int                    `json:"count"`
+}
+
+// Result of SearchAggregate.
+type AggregateResult struct {
+	Total     int              `json:"total"`            // Resources matching the search.
+	Groups    []AggregateGroup `json:"groups,omitempty"` // Largest first, only with group by properties.
+	Truncated bool             `json:"truncated"`        // There were more groups than the limit.
+}
+
+// Returns the query counting the resources of the compiled search by the properties, largest group first, e.g.
+// MATCH (n) WHERE (n.kind = 'pod') RETURN n.status AS g0, n.cluster AS g1, count(n) AS count ORDER BY count DESC, g0, g1
+func aggregateQuery(compiled CompiledSearch, groupBy []string) string {
+	returns := make([]string, 0, len(groupBy)+1)
+	aliases := make([]string, 0, len(groupBy))
+	for i, property := range groupBy {
+		alias := fmt.Sprintf("g%d", i)
+		returns = append(returns, fmt.Sprintf("n.%s AS %s", property, alias))
+		aliases = append(aliases, alias)
+	}
+	returns = append(returns, "count(n) AS count")
+	return fmt.Sprintf("%s RETURN %s ORDER BY %s", compiled.match, strings.Join(returns, ", "),
+		strings.Join(append([]string{"count DESC"}, aliases...), ", "))
+}
+
+// Counts the resources matching the compiled search, and by the values of the group by properties when there are
+// some, e.g. pods by status and cluster, in the datastore instead of returning the resources. At most limit groups
+// are returned when limit is greater than 0.
+func SearchAggregate(ctx context.Context, compiled CompiledSearch, groupBy []string,
+	limit int) (AggregateResult, error) {
+	result := AggregateResult{}
+	if len(groupBy) > maxAggregateGroupBy {
+		return result, fmt.Errorf("%w: at most %d properties", ErrInvalidGroupBy, maxAggregateGroupBy)
+	}
+	seen := make(map[string]bool, len(groupBy))
+	for _, property := range groupBy {
+		if !searchPropertyRegex.MatchString(property) || seen[property] {
+			return result, fmt.Errorf("%w: %s", ErrInvalidGroupBy, property)
+		}
+		seen[property] = true
+	}
+
+	total, err := SearchQuery(ctx, compiled.CountQuery, 0)
+	if err != nil {
+		return result, err
+	}
+	if total.Next() {
+		result.Total, _ = total.Record().GetByIndex(0).(int)
+	}
+	if len(groupBy) == 0 {
+		return result, nil
+	}
+
+	queryLimit := 0
+	if limit > 0 {
+		queryLimit = limit + 1 // One more to know if the groups were truncated.
+	}
+	found, err := SearchQuery(ctx, aggregateQuery(compiled, groupBy), queryLimit)
+	if err != nil {
+		return result, err
+	}
+	result.Groups = []AggregateGroup{}
+	for found.Next() {
+		if limit > 0 && len(result.Groups) == limit {
+			result.Truncated = true
+			break
+		}
+		values := found.Record().Values()
+		group := AggregateGroup{Values: make(map[string]interface{}, len(groupBy))}
+		for i, property := range groupBy {
+			group.Values[property] = values[i]
+		}
+		group.Count, _ = values[len(groupBy)].(int)
+		result.Groups = append(result.Groups, group)
+	}
+	return result, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchAggregate(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE "+
+		"(:Pod {kind:'pod', cluster:'c1', status:'Running'}), (:Pod {kind:'pod', cluster:'c1', status:'Running'}), "+
+		"(:Pod {kind:'pod', cluster:'c2', status:'Running'}), (:Pod {kind:'pod', cluster:'c2'}), "+
+		"(:Node {kind:'node', cluster:'c2'})")
+	assert.NoError(t, err)
+	compiled, err := CompileSearch("kind:pod")
+	assert.NoError(t, err)
+
+	result, err := SearchAggregate(ctx, compiled, nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, AggregateResult{Total: 4}, result)
+
+	result, err = SearchAggregate(ctx, compiled, []string{"status", "cluster"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.Total)
+	assert.Equal(t, []AggregateGroup{
+		{Values: map[string]interface{}{"status": "Running", "cluster": "c1"}, Count: 2},
+		{Values: map[string]interface{}{"status": "Running", "cluster": "c2"}, Count: 1},
+		{Values: map[string]interface{}{"status": nil, "cluster": "c2"}, Count: 1},
+	}, result.Groups)
+	assert.False(t, result.Truncated)
+
+	result, err = SearchAggregate(ctx, compiled, []string{"cluster"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Groups))
+	assert.True(t, result.Truncated)
+
+	for _, groupBy := range [][]string{{"n) DELETE (n"}, {"cluster", "cluster"}, {"a", "b", "c", "d"}} {
+		_, err = SearchAggregate(ctx, compiled, groupBy, 0)
+		assert.ErrorIs(t, err, ErrInvalidGroupBy, groupBy)
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Property names allowed in a search filter. Anything else could break out of the query.
+var searchPropertyRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Operators supported as a prefix of a filter value, longest first so ">=" is matched before ">".
+// ~ matches a regular expression, ! and != exclude a value and !~ a regular expression.
+var searchOperators = []string{">=", "<=", "!=", "!~", ">", "<", "=", "~", "!"}
+
+// A single property filter from a saved search, e.g. status:Running,Pending
+type SearchFilter struct {
+	Property string   `json:"property"`
+	Values   []string `json:"values"`
+}
+
+// Result of compiling a saved search into a graph query.
+type CompiledSearch struct {
+	Filters    []SearchFilter `json:"filters"`
+	Keywords   []string       `json:"keywords"`
+	Query      string         `json:"query"`      // Returns the matching nodes.
+	CountQuery string         `json:"countQuery"` // Returns the number of matching nodes.
+	match      string         // MATCH and WHERE clauses shared by the queries.
+	label      string         // Node label matched, from a kind filter, "" when every node is scanned.
+}
+
+// Returns the node label the search matches, e.g. "Pod", "" when it scans every node.
+func (c CompiledSearch) Label() string {
+	return c.label
+}
+
+// Parses the console saved search syntax into filters and keywords.
+// Tokens are separated by spaces. A token with a colon is a filter (property:value1,value2), anything else
+// is a keyword. e.g. "kind:pod namespace:default,kube-system cpu:>2 nginx"
+func ParseSearch(search string) ([]SearchFilter, []string, error) {
+	var filters []SearchFilter
+	var keywords []string
+	for _, token := range strings.Fields(search) {
+		i := strings.Index(token, ":")
+		if i < 0 {
+			keywords = append(keywords, token)
+			continue
+		}
+		property, values := token[:i], token[i+1:]
+		if !searchPropertyRegex.MatchString(property) {
+			return nil, nil, fmt.Errorf("Invalid property name in search filter: %s", property)
+		}
+		filter := SearchFilter{Property: property}
+		for _, value := range strings.Split(values, ",") {
+			if value != "" {
+				filter.Values = append(filter.Values, value)
+			}
+		}
+		if len(filter.Values) == 0 {
+			return nil, nil, fmt.Errorf("Search filter %s must have at least one value", property)
+		}
+		filters = append(filters, filter)
+	}
+	if len(filters) == 0 && len(keywords) == 0 {
+		return nil, nil, errors.New("Search must contain at least one filter or keyword")
+	}
+	return filters, keywords, nil
+}
+
+// Compiles the console saved search syntax into a sanitized openCypher query.
+// Values within a filter are OR'd together, except the excluded ones which are AND'd, so namespace:!a,!b matches the
+// resources in neither namespace. Filters and keywords are AND'd. Keywords match the resource name.
+func CompileSearch(search string) (CompiledSearch, error) {
+	return CompileSearchWithKindLabels(search, nil)
+}
+
+// Same as CompileSearch, but a kind filter with a single value also matches the node label of the kind,
+// so RedisGraph only scans the nodes with that label. kindLabels comes from KindLabels.
+func CompileSearchWithKindLabels(search string, kindLabels map[string]string) (CompiledSearch, error) {
+	filters, keywords, err := ParseSearch(search)
+	if err != nil {
+		return CompiledSearch{}, err
+	}
+
+	conditions := []string{}
+	kinds := searchKinds(filters)
+	for _, filter := range filters {
+		condition, err := filterValuesCondition(filter, kinds)
+		if err != nil {
+			return CompiledSearch{}, err
+		}
+		conditions = append(conditions, condition)
+	}
+	for _, keyword := range keywords {
+		conditions = append(conditions,
+			SanitizeQuery("(toLower(n.name) CONTAINS '%s')", strings.ToLower(keyword)))
+	}
+
+	label := kindLabel(filters, kindLabels)
+	where := "MATCH (n" + label + ") WHERE " + strings.Join(conditions, " AND ")
+	return CompiledSearch{
+		Filters:    filters,
+		Keywords:   keywords,
+		Query:      where + " RETURN n",
+		CountQuery: where + " RETURN count(n)",
+		match:      where,
+		label:      strings.TrimPrefix(label, ":"),
+	}, nil
+}
+
+// Returns the label to match, e.g. ":Pod", for a search with a kind filter with a single value, otherwise "".
+// The kind condition is kept in the query, the label only narrows the nodes scanned.
+func kindLabel(filters []SearchFilter, kindLabels map[string]string) string {
+	for _, filter := range filters {
+		if filter.Property != "kind" || len(filter.Values) != 1 {
+			continue
+		}
+		label, ok := kindLabels[strings.ToLower(filter.Values[0])]
+		if ok && searchPropertyRegex.MatchString(label) {
+			return ":" + label
+		}
+	}
+	return ""
+}
+
+// Returns the node labels by lowercased kind, e.g. "pod" -> "Pod". Nodes are labeled with the kind sent by the
+// collector, while the kind property is lowercased. Kinds with more than one label aren't included.
+// The labels of the graph are only listed on the first call, then kept up to date as the resources are written.
+func KindLabels(ctx context.Context) (map[string]string, error) {
+	schemaMutex.RLock()
+	loaded := schemaLabelsLoaded
+	schemaMutex.RUnlock()
+	if !loaded {
+		result, err := Store.Query(ctx, "CALL db.labels()")
+		if err != nil {
+			return nil, err
+		}
+		labels := []string{}
+		for result.Next() {
+			labels = append(labels, recordString(result.Record().GetByIndex(0)))
+		}
+		schemaMutex.Lock()
+		for _, label := range labels {
+			observeLabel(label)
+		}
+		schemaLabelsLoaded = true
+		schemaMutex.Unlock()
+	}
+
+	schemaMutex.RLock()
+	defer schemaMutex.RUnlock()
+	kindLabels := make(map[string]string, len(schemaLabels))
+	for kind, labels := range schemaLabels {
+		if len(labels) != 1 {
+			continue
+		}
+		for label := range labels {
+			kindLabels[kind] = label
+		}
+	}
+	return kindLabels, nil
+}
+
+// Returns the kinds a search is restricted to by a kind filter of exact values, lowercased. nil when the search
+// matches every kind.
+func searchKinds(filters []SearchFilter) []string {
+	for _, filter := range filters {
+		if filter.Property != "kind" {
+			continue
+		}
+		kinds := make([]string, 0, len(filter.Values))
+		for _, value := range filter.Values {
+			operator, kind, err := splitFilterValue(filter.Property, value)
+			if err != nil || operator != "=" {
+				return nil
+			}
+			kinds = append(kinds, kind)
+		}
+		return kinds
+	}
+	return nil
+}
+
+// Builds the condition for the values of a filter. The values matched are OR'd and the excluded ones are AND'd.
+// Several values compared for equality are matched as a set, e.g. n.namespace IN ['default', 'kube-system'].
+// kinds are the kinds the search is restricted to, from searchKinds.
+func filterValuesCondition(filter SearchFilter, kinds []string) (string, error) {
+	operators, operands := make([]string, len(filter.Values)), make([]string, len(filter.Values))
+	setValues := map[bool]int{} // Values that could be matched as a set, by whether they're excluded.
+	for i, value := range filter.Values {
+		var err error
+		if operators[i], operands[i], err = splitFilterValue(filter.Property, value); err != nil {
+			return "", err
+		}
+		if setMember(kinds, filter.Property, operators[i]) {
+			setValues[operators[i] == "<>"]++
+		}
+	}
+
+	var matched, excluded []string
+	sets := map[bool][]string{} // Literals of the sets, by whether they're excluded.
+	setAt := map[bool]int{}     // Position of each set condition, at its first value.
+	for i, value := range filter.Values {
+		negated := operators[i] == "<>" || operators[i] == "!~"
+		conditions := &matched
+		if negated {
+			conditions = &excluded
+		}
+		if setMember(kinds, filter.Property, operators[i]) && setValues[negated] > 1 {
+			if len(sets[negated]) == 0 {
+				setAt[negated] = len(*conditions)
+				*conditions = append(*conditions, "")
+			}
+			sets[negated] = append(sets[negated], setLiterals(operands[i])...)
+			continue
+		}
+		condition, err := filterCondition(kinds, filter.Property, value)
+		if err != nil {
+			return "", err
+		}
+		*conditions = append(*conditions, condition)
+	}
+	if literals := sets[false]; len(literals) > 0 {
+		matched[setAt[false]] = fmt.Sprintf("n.%s IN [%s]", filter.Property, strings.Join(literals, ", "))
+	}
+	if literals := sets[true]; len(literals) > 0 {
+		excluded[setAt[true]] = fmt.Sprintf("NOT n.%s IN [%s]", filter.Property, strings.Join(literals, ", "))
+	}
+
+	conditions := []string{}
+	if len(matched) > 0 {
+		conditions = append(conditions, "("+strings.Join(matched, " OR ")+")")
+	}
+	if len(excluded) > 0 {
+		conditions = append(conditions, "("+strings.Join(excluded, " AND ")+")")
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// Returns true for a value compared for equality that can be matched in a set with the other values of the filter.
+// Labels and hashed properties need their own conditions.
+func setMember(kinds []string, property, operator string) bool {
+	return (operator == "=" || operator == "<>") && property != "label" && !isHashedProperty(kinds, property)
+}
+
+// Returns the literals matching the value in a set, e.g. 'default', or both 3 and '3' for a number, which could be
+// stored either way.
+func setLiterals(value string) []string {
+	literal := SanitizeQuery("'%s'", value)
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return []string{strconv.FormatInt(number, 10), literal}
+	}
+	return []string{literal}
+}
+
+// Splits the operator from a filter value, returns the operator of the condition, e.g. <> for !, and the operand.
+func splitFilterValue(property, value string) (string, string, error) {
+	operator := "="
+	for _, op := range searchOperators {
+		if strings.HasPrefix(value, op) {
+			operator = op
+			value = value[len(op):]
+			break
+		}
+	}
+	if operator == "!" || operator == "!=" {
+		operator = "<>"
+	}
+	if value == "" {
+		return "", "", fmt.Errorf("Search filter %s is missing a value", property)
+	}
+	if property == "kind" && operator != "~" && operator != "!~" { // kind is stored lowercased.
+		value = strings.ToLower(value)
+	}
+	return operator, value, nil
+}
+
+// Builds the condition for a single filter value, e.g. n.cpu > 2
+func filterCondition(kinds []string, property, value string) (string, error) {
+	operator, value, err := splitFilterValue(property, value)
+	if err != nil {
+		return "", err
+	}
+
+	hashedProperty := isHashedProperty(kinds, property)
+	if (operator == "~" || operator == "!~") && hashedProperty {
+		return "", fmt.Errorf("Operator %s is not supported for the hashed property %s", operator, property)
+	}
+	if (operator == "=" || operator == "<>") && hashedProperty {
+		// Matches the value whether it was stored before or after the property was hashed.
+		hashed := HashValue(value)
+		if i := strings.Index(value, "="); property == "label" && i >= 0 { // Only the label value is hashed.
+			hashed = value[:i+1] + HashValue(value[i+1:])
+		}
+		plainCondition, err := valueCondition(property, operator, value)
+		if err != nil {
+			return "", err
+		}
+		hashedCondition, _ := valueCondition(property, operator, hashed)
+		join := " OR "
+		if operator == "<>" {
+			join = " AND "
+		}
+		return "(" + plainCondition + join + hashedCondition + ")", nil
+	}
+	return valueCondition(property, operator, value)
+}
+
+// Builds the condition for the property and a value without operator prefix.
+func valueCondition(property, operator, value string) (string, error) {
+	if property == "label" { // Labels are stored as a list of key=value strings.
+		condition := SanitizeQuery("'%s' IN n.label", value)
+		if operator == "<>" {
+			return "NOT " + condition, nil
+		} else if operator != "=" {
+			return "", fmt.Errorf("Operator %s is not supported for the label filter", operator)
+		}
+		return condition, nil
+	}
+	if operator == "~" || operator == "!~" {
+		return regexCondition(property, operator, value)
+	}
+	number, numberErr := strconv.ParseInt(value, 10, 64)
+	switch operator {
+	case "=", "<>":
+		if numberErr == nil { // Numbers could be stored as either int64 or string.
+			join := " OR "
+			if operator == "<>" {
+				join = " AND "
+			}
+			return SanitizeQuery("(n.%s %s %d%sn.%s %s '%s')",
+				property, operator, number, join, property, operator, value), nil
+		}
+		return SanitizeQuery("n.%s %s '%s'", property, operator, value), nil
+	default:
+		if numberErr != nil {
+			return "", fmt.Errorf("Operator %s on filter %s requires a number, got %s", operator, property, value)
+		}
+		return SanitizeQuery("n.%s %s %d", property, operator, number), nil
+	}
+}
+
+// Builds the condition matching the property, or excluding it with !~, against a regular expression. Only string
+// properties match, the condition is false for the numbers and lists. Rejected when the datastore doesn't support
+// regular expressions.
+func regexCondition(property, operator, pattern string) (string, error) {
+	if !CurrentGraphFeatures().RegexMatch {
+		return "", fmt.Errorf("Operator %s on filter %s is not supported, the datastore doesn't match "+
+			"regular expressions", operator, property)
+	}
+	pattern, err := validateSearchRegex(property, pattern)
+	if err != nil {
+		return "", err
+	}
+	condition := SanitizeQuery("n.%s =~ '%s'", property, pattern)
+	if operator == "!~" {
+		return "NOT " + condition, nil
+	}
+	return condition, nil
+}
+
+// Returns the filter properties that are not in the graph schema.
+func UnknownSearchProperties(ctx context.Context, filters []SearchFilter) ([]string, error) {
+	result, err := Store.Query(ctx, "CALL db.propertyKeys()")
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]struct{}{}
+	for result.Next() {
+		record := result.Record()
+		known[recordString(record.GetByIndex(0))] = struct{}{}
+	}
+	unknown := []string{}
+	for _, filter := range filters {
+		if _, ok := known[filter.Property]; !ok {
+			unknown = append(unknown, filter.Property)
+			known[filter.Property] = struct{}{} // Report each property once.
+		}
+	}
+	sort.Strings(unknown)
+	logger.V(4).Info("Unknown search properties: ", unknown)
+	return unknown, nil
+}
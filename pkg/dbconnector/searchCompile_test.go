@@ -0,0 +1,190 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearch(t *testing.T) {
+	filters, keywords, err := ParseSearch("kind:pod namespace:default,kube-system nginx")
+	assert.NoError(t, err)
+	assert.Equal(t, []SearchFilter{
+		{Property: "kind", Values: []string{"pod"}},
+		{Property: "namespace", Values: []string{"default", "kube-system"}},
+	}, filters)
+	assert.Equal(t, []string{"nginx"}, keywords)
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	_, _, err := ParseSearch("   ")
+	assert.Error(t, err, "Expected error for empty search.")
+	_, _, err = ParseSearch("name}:foo")
+	assert.Error(t, err, "Expected error for invalid property name.")
+	_, _, err = ParseSearch("kind:")
+	assert.Error(t, err, "Expected error for filter without values.")
+}
+
+func TestCompileSearch(t *testing.T) {
+	compiled, err := CompileSearch("kind:Pod namespace:default,kube-system cpu:>=2 status:!Running label:app=web Nginx")
+	assert.NoError(t, err)
+	expected := "MATCH (n) WHERE (n.kind = 'pod') AND (n.namespace IN ['default', 'kube-system'])" +
+		" AND (n.cpu >= 2) AND (n.status <> 'Running') AND ('app=web' IN n.label)" +
+		" AND (toLower(n.name) CONTAINS 'nginx')"
+	assert.Equal(t, expected+" RETURN n", compiled.Query)
+	assert.Equal(t, expected+" RETURN count(n)", compiled.CountQuery)
+}
+
+func TestCompileSearchNegation(t *testing.T) {
+	useRegexMatch(t)
+	compiled, err := CompileSearch("kind:pod namespace:!default,!kube-system status:!=Failed")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.kind = 'pod') AND (NOT n.namespace IN ['default', 'kube-system'])"+
+		" AND (n.status <> 'Failed') RETURN n", compiled.Query)
+
+	// The values matched are OR'd, the excluded ones are AND'd with them.
+	compiled, err = CompileSearch("name:a,b,!c,~d.*,!~e.* nodes:1,2")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.name IN ['a', 'b'] OR n.name =~ 'd.*') AND (n.name <> 'c' AND "+
+		"NOT n.name =~ 'e.*') AND (n.nodes IN [1, '1', 2, '2']) RETURN n", compiled.Query)
+}
+
+func TestCompileSearchRegex(t *testing.T) {
+	// RedisGraph doesn't support regular expressions.
+	_, err := CompileSearch("name:~nginx-.*")
+	assert.Error(t, err)
+	_, err = CompileSearch("name:!~nginx-.*")
+	assert.Error(t, err)
+
+	useRegexMatch(t)
+	compiled, err := CompileSearch(`name:~^nginx-\d+$ kind:~Pod|Deployment`)
+	assert.NoError(t, err)
+	assert.Equal(t, `MATCH (n) WHERE (n.name =~ 'nginx-\\d+') AND (n.kind =~ 'Pod|Deployment') RETURN n`,
+		compiled.Query)
+	compiled, err = CompileSearch("name:~a'b")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.name =~ 'a\\'b') RETURN n", compiled.Query)
+
+	for _, search := range []string{"name:~(a+)+", "name:~(a*b?)*c", "name:~a{500}", "name:~a^b", "name:~(",
+		"name:~" + strings.Repeat("a*", 11), "name:~" + strings.Repeat("a", 300), "name:~^$", "label:~app=.*"} {
+		_, err = CompileSearch(search)
+		assert.Error(t, err, search)
+	}
+}
+
+func TestSearchRegex(t *testing.T) {
+	useMemgraph(t)
+	useRegexMatch(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (:Pod {kind:'pod', name:'nginx-1', namespace:'default'}), "+
+		"(:Pod {kind:'pod', name:'nginx-a', namespace:'apps'}), "+
+		"(:Pod {kind:'pod', name:'etcd-1', namespace:'kube-system'})")
+	assert.NoError(t, err)
+	names := func(search string) []string {
+		compiled, err := CompileSearch(search)
+		assert.NoError(t, err)
+		result, err := Store.Query(ctx, strings.TrimSuffix(compiled.Query, "RETURN n")+"RETURN n.name ORDER BY n.name")
+		assert.NoError(t, err)
+		names := []string{}
+		for result.Next() {
+			names = append(names, recordString(result.Record().GetByIndex(0)))
+		}
+		return names
+	}
+	assert.Equal(t, []string{"etcd-1", "nginx-1"}, names(`name:~.*-\d`))
+	assert.Equal(t, []string{"nginx-a"}, names(`kind:pod namespace:!default,!kube-system`))
+	assert.Equal(t, []string{"etcd-1", "nginx-a"}, names(`name:!~nginx-\d`))
+}
+
+func TestCompileSearchNumberEquality(t *testing.T) {
+	compiled, err := CompileSearch("nodes:3")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE ((n.nodes = 3 OR n.nodes = '3')) RETURN n", compiled.Query)
+}
+
+func TestCompileSearchSanitizesValues(t *testing.T) {
+	compiled, err := CompileSearch("name:a'b")
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.name = 'a\\'b') RETURN n", compiled.Query)
+}
+
+// A backslash before a quote can't escape the closing quote of the value and inject openCypher.
+func TestCompileSearchSanitizesBackslashes(t *testing.T) {
+	compiled, err := CompileSearch(`name:a\'OR(1=1)//`)
+	assert.NoError(t, err)
+	assert.Equal(t, `MATCH (n) WHERE (n.name = 'a\\\'OR(1=1)//') RETURN n`, compiled.Query)
+
+	useMemgraph(t)
+	useRegexMatch(t)
+	ctx := context.Background()
+	_, err = Store.Query(ctx, `CREATE (:Pod {kind:'pod', name:'a\\', label:['app=a\\']}), `+
+		`(:Pod {kind:'pod', name:'b', label:['app=b']})`)
+	assert.NoError(t, err)
+	for search, expected := range map[string]int{
+		`name:a\'OR(1=1)//`:          0,
+		`name:a\`:                    1,
+		`name:a\,b\'OR(1=1)//`:       1,
+		`label:app=a\'OR(1=1)//`:     0,
+		`kind:pod a\'OR(1=1)//`:      0,
+		`name:~a\\'OR(1=1)//`:        0,
+		`name:!a\'OR(1=1)//`:         2,
+		`namespace:\' OR 1=1 WITH n`: 0,
+	} {
+		compiled, err := CompileSearch(search)
+		assert.NoError(t, err, search)
+		result, err := SearchQuery(ctx, compiled.Query, 0)
+		assert.NoError(t, err, search)
+		assert.Equal(t, expected, countRows(result), search)
+	}
+}
+
+func TestCompileSearchErrors(t *testing.T) {
+	_, err := CompileSearch("cpu:>two")
+	assert.Error(t, err, "Expected error for comparison with a non-number.")
+	_, err = CompileSearch("label:>app")
+	assert.Error(t, err, "Expected error for comparison on labels.")
+	_, err = CompileSearch("status:!")
+	assert.Error(t, err, "Expected error for operator without value.")
+}
+
+func TestCompileSearchWithKindLabels(t *testing.T) {
+	kindLabels := map[string]string{"pod": "Pod", "weird": "Bad-Label"}
+	compiled, err := CompileSearchWithKindLabels("kind:pod status:Running", kindLabels)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n:Pod) WHERE (n.kind = 'pod') AND (n.status = 'Running') RETURN n", compiled.Query)
+	assert.Equal(t, "Pod", compiled.Label())
+
+	// The label is only used with a single kind known to the graph.
+	for _, search := range []string{"kind:pod,deployment", "kind:deployment", "kind:weird", "status:Running"} {
+		compiled, err = CompileSearchWithKindLabels(search, kindLabels)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(compiled.Query, "MATCH (n) WHERE"), search)
+		assert.Empty(t, compiled.Label(), search)
+	}
+}
+
+func TestKindLabels(t *testing.T) {
+	useTestDatastore(t)
+
+	_, err := Store.Query(context.Background(),
+		"CREATE (:Pod {kind:'pod'}), (:ReplicaSet {kind:'replicaset'}), (:Thing {kind:'thing'}), (:thing {kind:'thing'})")
+	assert.NoError(t, err)
+	kindLabels, err := KindLabels(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pod": "Pod", "replicaset": "ReplicaSet"}, kindLabels)
+
+	// The labels are listed once, then the written resources add theirs.
+	_, err = Store.Query(context.Background(), "CREATE (:Deployment {kind:'deployment'})")
+	assert.NoError(t, err)
+	assert.NoError(t, ChunkedInsert(context.Background(), []*Resource{{Kind: "Node", UID: "c1/n",
+		Properties: map[string]interface{}{"kind": "Node", "name": "n"}}}, "c1").Err())
+	kindLabels, err = KindLabels(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"pod": "Pod", "replicaset": "ReplicaSet", "node": "Node"}, kindLabels)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+)
+
+// Returned for a cursor that can't be decoded, or that came from another search or sort property.
+var ErrInvalidCursor = errors.New("Invalid search cursor")
+
+// Position in the results of a search, after the last resource of a page. Pages are sorted by a property and then
+// by UID, so a cursor stays valid while resources are added or deleted, unlike an offset.
+type SearchCursor struct {
+	Search string      `json:"h"` // Hash of the search and sort property the cursor is valid for.
+	Value  interface{} `json:"v"` // Sort property of the last resource, nil when it didn't have one.
+	UID    string      `json:"u"` // UID of the last resource.
+}
+
+// Returns the hash of the search and sort property, to tell whether a cursor came from them.
+func searchCursorHash(search, sortBy string) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(sortBy + "\n" + search))
+	return strconv.FormatUint(hash.Sum64(), 36)
+}
+
+// Returns the cursor after the resource with the properties, in the search sorted by sortBy.
+func NewSearchCursor(search, sortBy string, properties map[string]interface{}) SearchCursor {
+	uid, _ := properties["_uid"].(string)
+	cursor := SearchCursor{Search: searchCursorHash(search, sortBy), UID: uid}
+	if sortBy != "" && sortBy != "_uid" {
+		cursor.Value = properties[sortBy]
+	}
+	return cursor
+}
+
+// Encodes the cursor as an opaque string for the nextCursor of the search API.
+func (c SearchCursor) Encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// Decodes the cursor of the search and sort property, it returns ErrInvalidCursor for a cursor from another one.
+func DecodeSearchCursor(encoded, search, sortBy string) (SearchCursor, error) {
+	var cursor SearchCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.UseNumber() // Integer properties are compared as integers.
+	if err = decoder.Decode(&cursor); err != nil || cursor.UID == "" {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Search != searchCursorHash(search, sortBy) {
+		return cursor, fmt.Errorf("%w, it's from another search or sort property", ErrInvalidCursor)
+	}
+	if number, ok := cursor.Value.(json.Number); ok {
+		if cursor.Value, err = number.Int64(); err != nil {
+			cursor.Value, _ = number.Float64()
+		}
+	}
+	return cursor, nil
+}
+
+// Returns the query for a page of the search sorted by sortBy, then by UID, starting after the cursor. The first
+// page has a nil cursor. The resources without the sort property come last, like in ORDER BY.
+// e.g. MATCH (n) WHERE (n.kind = 'pod') AND (n.name > 'a' OR (n.name = 'a' AND n._uid > 'c1/a') OR n.name IS NULL)
+// RETURN n ORDER BY n.name, n._uid
+func (c CompiledSearch) PageQuery(sortBy string, cursor *SearchCursor) (string, error) {
+	if sortBy == "" || sortBy == "_uid" {
+		query := c.match
+		if cursor != nil {
+			query += SanitizeQuery(" AND n._uid > '%s'", cursor.UID)
+		}
+		return query + " RETURN n ORDER BY n._uid", nil
+	}
+	if !searchPropertyRegex.MatchString(sortBy) {
+		return "", fmt.Errorf("%w, invalid sort property %s", ErrInvalidCursor, sortBy)
+	}
+	property := "n." + sortBy
+	query := c.match
+	if cursor != nil && cursor.Value == nil {
+		query += SanitizeQuery(" AND ("+property+" IS NULL AND n._uid > '%s')", cursor.UID)
+	} else if cursor != nil {
+		var value string
+		switch typed := cursor.Value.(type) {
+		case string:
+			value = SanitizeQuery("'%s'", typed)
+		case int64, float64, bool:
+			value = fmt.Sprint(typed)
+		default:
+			return "", fmt.Errorf("%w, the sort property can't be a list or map", ErrInvalidCursor)
+		}
+		query += fmt.Sprintf(" AND (%s > %s OR (%s = %s AND n._uid > %s) OR %s IS NULL)", property, value,
+			property, value, SanitizeQuery("'%s'", cursor.UID), property)
+	}
+	return query + " RETURN n ORDER BY " + property + ", n._uid", nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchCursor(t *testing.T) {
+	properties := map[string]interface{}{"_uid": "c1/p1", "name": "web", "restarts": int64(3)}
+	for sortBy, value := range map[string]interface{}{"": nil, "name": "web", "restarts": int64(3), "ready": nil} {
+		encoded := NewSearchCursor("kind:pod", sortBy, properties).Encode()
+		cursor, err := DecodeSearchCursor(encoded, "kind:pod", sortBy)
+		assert.NoError(t, err, sortBy)
+		assert.Equal(t, "c1/p1", cursor.UID)
+		assert.Equal(t, value, cursor.Value, sortBy)
+	}
+
+	encoded := NewSearchCursor("kind:pod", "name", properties).Encode()
+	_, err := DecodeSearchCursor(encoded, "kind:service", "name")
+	assert.True(t, errors.Is(err, ErrInvalidCursor), "From another search")
+	_, err = DecodeSearchCursor(encoded, "kind:pod", "namespace")
+	assert.True(t, errors.Is(err, ErrInvalidCursor), "From another sort property")
+	_, err = DecodeSearchCursor("not-a-cursor!", "kind:pod", "name")
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
+
+func TestPageQuery(t *testing.T) {
+	compiled, err := CompileSearch("kind:pod")
+	assert.NoError(t, err)
+
+	query, err := compiled.PageQuery("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.kind = 'pod') RETURN n ORDER BY n._uid", query)
+
+	query, err = compiled.PageQuery("name", &SearchCursor{Value: "it's", UID: "c1/p1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.kind = 'pod') AND (n.name > 'it\\'s' OR (n.name = 'it\\'s' AND "+
+		"n._uid > 'c1/p1') OR n.name IS NULL) RETURN n ORDER BY n.name, n._uid", query)
+
+	query, err = compiled.PageQuery("name", &SearchCursor{UID: "c1/p1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "MATCH (n) WHERE (n.kind = 'pod') AND (n.name IS NULL AND n._uid > 'c1/p1') "+
+		"RETURN n ORDER BY n.name, n._uid", query)
+
+	_, err = compiled.PageQuery("name) RETURN n //", nil)
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
+
+// Walks the pages of a search sorted by a property some resources don't have.
+func TestPageQueryPages(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/e', kind:'pod', restarts:1}), "+
+		"(:Pod {_uid:'c1/a', kind:'pod', restarts:2}), (:Pod {_uid:'c1/d', kind:'pod', restarts:1}), "+
+		"(:Pod {_uid:'c1/c', kind:'pod'}), (:Pod {_uid:'c1/b', kind:'pod'})")
+	assert.NoError(t, err)
+	compiled, err := CompileSearch("kind:pod")
+	assert.NoError(t, err)
+
+	uids := []string{}
+	var cursor *SearchCursor
+	for page := 0; page < 5; page++ {
+		query, err := compiled.PageQuery("restarts", cursor)
+		assert.NoError(t, err)
+		result, err := SearchQuery(ctx, query, 2)
+		assert.NoError(t, err)
+		var last map[string]interface{}
+		for result.Next() {
+			last = result.Record().GetByIndex(0).(*rg2.Node).Properties
+			uids = append(uids, last["_uid"].(string))
+		}
+		if last == nil {
+			break
+		}
+		encoded := NewSearchCursor("kind:pod", "restarts", last).Encode()
+		decoded, err := DecodeSearchCursor(encoded, "kind:pod", "restarts")
+		assert.NoError(t, err)
+		cursor = &decoded
+	}
+	assert.Equal(t, []string{"c1/d", "c1/e", "c1/a", "c1/b", "c1/c"}, uids)
+}
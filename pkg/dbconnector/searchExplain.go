@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Stats of an operation in the reply to GRAPH.PROFILE, e.g. Records produced: 3, Execution time: 0.012 ms
+var profileStatsRegex = regexp.MustCompile(`Records produced: (\d+), Execution time: ([\d.]+) ms`)
+
+// An operation of the execution plan of a query, e.g. Node By Label Scan | (n:Pod). The plan is listed from the
+// root, the operations run by an operation follow it one level deeper.
+type PlanOperation struct {
+	Operation string `json:"operation"`
+	Details   string `json:"details,omitempty"` // e.g. the pattern or the filter of the operation.
+	Depth     int    `json:"depth"`
+	// Rows and time of the operation, only when profiled.
+	Records *int     `json:"records,omitempty"`
+	TimeMS  *float64 `json:"timeMs,omitempty"`
+}
+
+// Parses a line of the reply to GRAPH.EXPLAIN or GRAPH.PROFILE. Operations are indented 4 spaces per level.
+func parsePlanOperation(line string) PlanOperation {
+	trimmed := strings.TrimLeft(line, " ")
+	operation := PlanOperation{Depth: (len(line) - len(trimmed)) / 4}
+	parts := strings.Split(trimmed, " | ")
+	operation.Operation = strings.TrimSpace(parts[0])
+	details := []string{}
+	for _, part := range parts[1:] {
+		if match := profileStatsRegex.FindStringSubmatch(part); match != nil {
+			records, _ := strconv.Atoi(match[1])
+			timeMS, _ := strconv.ParseFloat(match[2], 64)
+			operation.Records, operation.TimeMS = &records, &timeMS
+			continue
+		}
+		details = append(details, strings.TrimSpace(part))
+	}
+	operation.Details = strings.Join(details, " | ")
+	return operation
+}
+
+// Returns the lines of the reply to GRAPH.EXPLAIN or GRAPH.PROFILE, an array of lines or older versions' single
+// string.
+func planLines(reply interface{}) ([]string, error) {
+	switch value := reply.(type) {
+	case []byte, string:
+		text, _ := redis.String(value, nil)
+		return strings.Split(strings.TrimRight(text, "\n"), "\n"), nil
+	case []interface{}:
+		return redis.Strings(value, nil)
+	}
+	return nil, fmt.Errorf("Unexpected reply to the execution plan of a query: %T", reply)
+}
+
+// Returns the execution plan of a read query from the search API, checked and bounded like SearchQuery. With
+// profile the query runs with GRAPH.PROFILE and each operation has its rows and time.
+func ExplainSearch(ctx context.Context, query string, limit int, profile bool) ([]PlanOperation, error) {
+	if err := CheckQueryCost(query); err != nil {
+		return nil, err
+	}
+	if limit > 0 && !limitRegex.MatchString(query) {
+		query = fmt.Sprintf("%s LIMIT %d", query, limit)
+	}
+	var timeout time.Duration
+	if config.Cfg.SearchTimeoutMS > 0 {
+		timeout = time.Duration(config.Cfg.SearchTimeoutMS) * time.Millisecond
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	command := "GRAPH.EXPLAIN"
+	if profile {
+		command = "GRAPH.PROFILE"
+	}
+	start := time.Now()
+	reply, err := timeoutConn{Conn: conn, timeout: timeout}.Do(command, GRAPH_NAME, query)
+	traceQuery(ctx, command+" "+query, start, err)
+	var netErr net.Error
+	if err != nil && (ctx.Err() == context.DeadlineExceeded || (errors.As(err, &netErr) && netErr.Timeout())) {
+		return nil, ErrSearchTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines, err := planLines(reply)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]PlanOperation, 0, len(lines))
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			plan = append(plan, parsePlanOperation(line))
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parsePlanOperation(t *testing.T) {
+	operation := parsePlanOperation("        Node By Label Scan | (n:Pod) | Records produced: 12, Execution time: 0.25 ms")
+	assert.Equal(t, "Node By Label Scan", operation.Operation)
+	assert.Equal(t, "(n:Pod)", operation.Details)
+	assert.Equal(t, 2, operation.Depth)
+	if assert.NotNil(t, operation.Records) && assert.NotNil(t, operation.TimeMS) {
+		assert.Equal(t, 12, *operation.Records)
+		assert.Equal(t, 0.25, *operation.TimeMS)
+	}
+
+	operation = parsePlanOperation("    Filter")
+	assert.Equal(t, PlanOperation{Operation: "Filter", Depth: 1}, operation, "Explained, without stats")
+}
+
+func Test_planLines(t *testing.T) {
+	lines, err := planLines([]interface{}{[]byte("Results"), []byte("    Project")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Results", "    Project"}, lines)
+
+	lines, err = planLines([]byte("Results\n    Project\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Results", "    Project"}, lines, "RedisGraph before 2.4 replies with a string")
+
+	_, err = planLines(int64(1))
+	assert.Error(t, err)
+}
+
+func TestExplainSearch(t *testing.T) {
+	useTestDatastore(t)
+	_, err := Store.Query(context.Background(), "CREATE (:Pod {_uid:'c1/a', kind:'pod'}), (:Pod {_uid:'c1/b', kind:'pod'})")
+	assert.NoError(t, err)
+
+	plan, err := ExplainSearch(context.Background(), "MATCH (n) WHERE n.kind = 'pod' RETURN n", 1, true)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, plan) {
+		assert.Equal(t, 0, plan[0].Depth)
+		if assert.NotNil(t, plan[0].Records) {
+			assert.Equal(t, 1, *plan[0].Records, "The limit is applied")
+		}
+	}
+
+	plan, err = ExplainSearch(context.Background(), "MATCH (n) WHERE n.kind = 'pod' RETURN n", 0, false)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, plan) {
+		assert.Nil(t, plan[0].Records, "Only profiled plans have stats")
+	}
+
+	_, err = ExplainSearch(context.Background(), "MATCH (n)-[*]->(m) RETURN m", 0, true)
+	assert.IsType(t, QueryCostError{}, err)
+}
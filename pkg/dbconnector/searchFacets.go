@@ -0,0 +1,74 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Returned by SearchFacets for a facet that isn't a valid property name.
+var ErrInvalidFacet = errors.New("Invalid facet property")
+
+// Number of resources matching a search with a value of a facet property.
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Counts the resources matching the compiled search by value of each facet property, e.g. kind, cluster,
+// namespace or label. Values are sorted by count, highest first, and at most limit are kept when limit is
+// greater than 0. Resources without the property aren't counted.
+func SearchFacets(ctx context.Context, compiled CompiledSearch, facets []string,
+	limit int) (map[string][]FacetValue, error) {
+	result := make(map[string][]FacetValue, len(facets))
+	for _, facet := range facets {
+		if !searchPropertyRegex.MatchString(facet) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFacet, facet)
+		}
+		if _, ok := result[facet]; ok {
+			continue
+		}
+		// e.g. MATCH (n) WHERE (n.kind = 'pod') RETURN n.namespace, count(n)
+		found, err := SearchQuery(ctx, fmt.Sprintf("%s RETURN n.%s, count(n)", compiled.match, facet), 0)
+		if err != nil {
+			return nil, err
+		}
+		counts := map[string]int{}
+		for found.Next() {
+			record := found.Record()
+			count, _ := record.GetByIndex(1).(int)
+			switch value := record.GetByIndex(0).(type) {
+			case nil:
+			case []interface{}: // Labels are a list of key=value, counted once per label.
+				for _, item := range value {
+					counts[fmt.Sprint(item)] += count
+				}
+			default:
+				counts[fmt.Sprint(value)] += count
+			}
+		}
+		result[facet] = sortedFacetValues(counts, limit)
+	}
+	return result, nil
+}
+
+func sortedFacetValues(counts map[string]int, limit int) []FacetValue {
+	values := make([]FacetValue, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, FacetValue{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	if limit > 0 && len(values) > limit {
+		values = values[:limit]
+	}
+	return values
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchFacets(t *testing.T) {
+	useTestDatastore(t)
+
+	_, err := Store.Query(context.Background(), "CREATE "+
+		"(:Pod {kind:'pod', cluster:'c1', namespace:'default', label:['app=a', 'tier=web']}), "+
+		"(:Pod {kind:'pod', cluster:'c1', namespace:'kube-system', label:['app=a']}), "+
+		"(:Pod {kind:'pod', cluster:'c2', namespace:'default'}), "+
+		"(:Node {kind:'node', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	compiled, err := CompileSearch("kind:pod,node")
+	assert.NoError(t, err)
+	facets, err := SearchFacets(context.Background(), compiled, []string{"kind", "cluster", "namespace", "label"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []FacetValue{{"pod", 3}, {"node", 1}}, facets["kind"])
+	assert.Equal(t, []FacetValue{{"c1", 2}, {"c2", 2}}, facets["cluster"])
+	assert.Equal(t, []FacetValue{{"default", 2}, {"kube-system", 1}}, facets["namespace"])
+	assert.Equal(t, []FacetValue{{"app=a", 2}, {"tier=web", 1}}, facets["label"])
+
+	facets, err = SearchFacets(context.Background(), compiled, []string{"kind"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []FacetValue{{"pod", 3}}, facets["kind"])
+
+	_, err = SearchFacets(context.Background(), compiled, []string{"n) DELETE (n"}, 0)
+	assert.ErrorIs(t, err, ErrInvalidFacet)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+var (
+	// String literals, removed before checking the query so values can't look like clauses.
+	literalRegex = regexp.MustCompile(`'(?:[^'\\]|\\.)*'`)
+	// Variable length relationship, e.g. [*], [e:ownedBy*1..3] or [*2..]
+	variableLengthRegex = regexp.MustCompile(`\[[^\]]*\*\s*(\d*)\s*(\.\.)?\s*(\d*)\s*\]`)
+	// Nodes without label or properties matched together, e.g. MATCH (a), (b)
+	cartesianProductRegex = regexp.MustCompile(`\(\s*\w*\s*\)\s*,\s*\(\s*\w*\s*\)`)
+	limitRegex            = regexp.MustCompile(`(?i)\bLIMIT\s+\d+\s*$`)
+	// The openCypher clauses that modify the graph, not the properties or variables named like them.
+	writeClauseRegex = regexp.MustCompile(`(?i)(^|[^\w.$])(CREATE|MERGE|SET|DELETE|REMOVE)\b`)
+	// String literals and escaped names, their content can't be a clause.
+	queryLiteralRegex = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|` + "`[^`]*`")
+)
+
+// Returned by SearchQuery when the query runs longer than SEARCH_TIMEOUT_MS.
+var ErrSearchTimeout = errors.New("Search timed out, add filters to narrow it down or lower the limit")
+
+// Error for a query rejected because it could be too expensive for the shared datastore.
+type QueryCostError struct {
+	Reason string
+}
+
+func (e QueryCostError) Error() string {
+	return "Query rejected because it could be too expensive: " + e.Reason
+}
+
+type readQueryKey struct{}
+
+// Returns a context running its queries with GRAPH.RO_QUERY, RedisGraph rejects the ones that modify the graph.
+func withReadQuery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readQueryKey{}, true)
+}
+
+func isReadQueryContext(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readQueryKey{}).(bool)
+	return readOnly
+}
+
+// Returns whether a query from the search API looks like it modifies the graph. Only used to reject those queries
+// early, they're sent as GRAPH.RO_QUERY anyway. The writes of the aggregator are marked with WithWrite instead.
+func isWriteQuery(q string) bool {
+	return writeClauseRegex.MatchString(queryLiteralRegex.ReplaceAllString(q, "''"))
+}
+
+// Runs the query with the command, GRAPH.QUERY or GRAPH.RO_QUERY, like Graph.Query does. With a timeout, RedisGraph
+// aborts the query once it runs for longer, instead of only the client giving up on the reply.
+func graphQuery(g *rg2.Graph, command, q string, timeout time.Duration) (*rg2.QueryResult, error) {
+	args := []interface{}{g.Id, q, "--compact"}
+	if timeout > 0 {
+		args = append(args, "TIMEOUT", timeout.Milliseconds())
+	}
+	r, err := g.Conn.Do(command, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rg2.QueryResultNew(g, r)
+}
+
+// Estimates the cost of a read query from the search API and returns a QueryCostError when it could run over
+// the whole graph: writes, variable length paths without a bound or longer than SEARCH_MAX_HOPS, and
+// cartesian products of unfiltered nodes.
+func CheckQueryCost(query string) error {
+	query = literalRegex.ReplaceAllString(query, "''")
+	if isWriteQuery(query) {
+		return QueryCostError{"The search API only runs read queries."}
+	}
+	for _, match := range variableLengthRegex.FindAllStringSubmatch(query, -1) {
+		hops := match[1] // e.g. [*3]
+		if match[2] != "" {
+			hops = match[3] // e.g. [*1..3]
+		}
+		if hops == "" {
+			return QueryCostError{fmt.Sprintf("Variable length path %s has no maximum length, "+
+				"use a bound like [*1..%d].", match[0], config.Cfg.SearchMaxHops)}
+		}
+		if n, _ := strconv.Atoi(hops); n > config.Cfg.SearchMaxHops {
+			return QueryCostError{fmt.Sprintf("Variable length path %s is longer than the maximum of %d hops.",
+				match[0], config.Cfg.SearchMaxHops)}
+		}
+	}
+	if cartesianProductRegex.MatchString(query) {
+		return QueryCostError{"Matching unfiltered nodes together visits every pair of nodes, " +
+			"add a label or properties to the patterns or connect them with a relationship."}
+	}
+	return nil
+}
+
+// Runs a read query from the search API with GRAPH.RO_QUERY. Rejects expensive queries with a QueryCostError, bounds
+// the query by SEARCH_TIMEOUT_MS and, when limit is greater than 0, returns at most limit rows.
+func SearchQuery(ctx context.Context, query string, limit int) (*rg2.QueryResult, error) {
+	if err := CheckQueryCost(query); err != nil {
+		return &rg2.QueryResult{}, err
+	}
+	if limit > 0 && !limitRegex.MatchString(query) {
+		query = fmt.Sprintf("%s LIMIT %d", query, limit)
+	}
+	if config.Cfg.SearchTimeoutMS > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.Cfg.SearchTimeoutMS)*time.Millisecond)
+		defer cancel()
+	}
+	result, err := Store.Query(withReadQuery(ctx), query)
+	var netErr net.Error
+	if err != nil && (ctx.Err() == context.DeadlineExceeded || (errors.As(err, &netErr) && netErr.Timeout())) {
+		return result, ErrSearchTimeout
+	}
+	return result, err
+}
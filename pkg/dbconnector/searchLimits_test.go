@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isWriteQuery(t *testing.T) {
+	assert.True(t, isWriteQuery("MATCH (n) WHERE (n._uid='uid1') DELETE n"))
+	assert.True(t, isWriteQuery("MERGE (c:Cluster {name: 'c1'}) SET c.status = 'OK'"))
+	assert.True(t, isWriteQuery("CREATE INDEX ON :Pod(_uid)"))
+	assert.False(t, isWriteQuery("MATCH (n {cluster:'c1'}) RETURN count(n)"))
+	assert.False(t, isWriteQuery("MATCH (n {name:'created-pod'}) RETURN n"))
+	assert.False(t, isWriteQuery("MATCH (n {name:'set-pod'}) WHERE n.label = 'delete' RETURN n"))
+	assert.False(t, isWriteQuery(`MATCH (n {name:"a\" SET n.x=1"}) RETURN n.set, n.remove`))
+	assert.True(t, isWriteQuery("MATCH (n {name:'a\\'}) SET n.name = 'set'"))
+}
+
+func TestCheckQueryCost(t *testing.T) {
+	allowed := []string{
+		"MATCH (n:Pod) WHERE n.namespace = 'default' RETURN n",
+		"MATCH (n {_uid: 'abc'})-[*1..3]->(m) RETURN m",
+		"MATCH (n {_uid: 'abc'})-[e:ownedBy*2]->(m) RETURN m",
+		"MATCH (n) WHERE (toLower(n.name) CONTAINS 'set') AND (n.name = '[*]') RETURN n", // Within literals.
+	}
+	for _, query := range allowed {
+		assert.NoError(t, CheckQueryCost(query), query)
+	}
+	rejected := []string{
+		"MATCH (n)-[*]->(m) RETURN m",
+		"MATCH (n)-[e:ownedBy*2..]->(m) RETURN m",
+		"MATCH (n)-[*1..10]->(m) RETURN m",
+		"MATCH (n)-[*10]->(m) RETURN m",
+		"MATCH (a), (b) RETURN a, b",
+		"MATCH (n) SET n.name = 'x'",
+		"MATCH (n) DELETE n",
+	}
+	for _, query := range rejected {
+		err := CheckQueryCost(query)
+		assert.IsType(t, QueryCostError{}, err, query)
+	}
+}
+
+func countRows(result *rg2.QueryResult) int {
+	rows := 0
+	for result.Next() {
+		rows++
+	}
+	return rows
+}
+
+func TestSearchQuery(t *testing.T) {
+	useTestDatastore(t)
+
+	_, err := Store.Query(context.Background(), "CREATE (:Pod {kind:'pod'}), (:Pod {kind:'pod'}), (:Pod {kind:'pod'})")
+	assert.NoError(t, err)
+
+	result, err := SearchQuery(context.Background(), "MATCH (n:Pod) RETURN n", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countRows(result))
+
+	result, err = SearchQuery(context.Background(), "MATCH (n:Pod) RETURN n", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, countRows(result))
+
+	_, err = SearchQuery(context.Background(), "MATCH (n)-[*]->(m) RETURN m", 2)
+	assert.IsType(t, QueryCostError{}, err)
+
+	// The searches run read-only, a write getting through the checks is rejected by the datastore.
+	_, err = Store.Query(withReadQuery(context.Background()), "MATCH (n:Pod) DELETE n")
+	assert.Error(t, err)
+	result, err = SearchQuery(context.Background(), "MATCH (n:Pod) RETURN n", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, countRows(result))
+}
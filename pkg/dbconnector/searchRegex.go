@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// Limits of the regular expressions in search filters, so a pattern like (a+)+ can't run for minutes on a long value.
+const (
+	searchRegexMaxLength  = 256 // Characters of a pattern.
+	searchRegexMaxRepeats = 10  // Quantifiers in a pattern, e.g. *, + or {2,5}.
+	searchRegexMaxCount   = 100 // Max of a bounded quantifier, e.g. {1,100}.
+)
+
+// Validates a regular expression from a search filter, it matches the whole value. Returns the pattern without the
+// leading ^ and trailing $, which are implied. Patterns that could backtrack catastrophically are rejected: nested
+// quantifiers, more than searchRegexMaxRepeats quantifiers, large bounded quantifiers, and the anchors and boundaries
+// inside the pattern since it always matches the whole value.
+func validateSearchRegex(property, pattern string) (string, error) {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+	if pattern == "" {
+		return "", fmt.Errorf("Search filter %s is missing a regular expression", property)
+	}
+	if len(pattern) > searchRegexMaxLength {
+		return "", fmt.Errorf("Regular expression of search filter %s is longer than %d characters",
+			property, searchRegexMaxLength)
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("Invalid regular expression in search filter %s: %s", property, err)
+	}
+	repeats := 0
+	if err = checkSearchRegex(re, false, &repeats); err != nil {
+		return "", fmt.Errorf("Regular expression of search filter %s is not allowed: %s", property, err)
+	}
+	return pattern, nil
+}
+
+// Walks the parsed pattern, repeated is true inside a quantifier other than ?.
+func checkSearchRegex(re *syntax.Regexp, repeated bool, repeats *int) error {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if repeated && re.Op != syntax.OpQuest {
+			return fmt.Errorf("nested quantifiers, e.g. (a+)+, can take exponential time")
+		}
+		if re.Op == syntax.OpRepeat && (re.Max > searchRegexMaxCount || re.Min > searchRegexMaxCount) {
+			return fmt.Errorf("quantifiers can't repeat more than %d times", searchRegexMaxCount)
+		}
+		if *repeats++; *repeats > searchRegexMaxRepeats {
+			return fmt.Errorf("more than %d quantifiers", searchRegexMaxRepeats)
+		}
+		repeated = repeated || re.Op != syntax.OpQuest
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText, syntax.OpWordBoundary,
+		syntax.OpNoWordBoundary:
+		return fmt.Errorf("anchors and boundaries inside the pattern aren't supported, it matches the whole value")
+	}
+	for _, sub := range re.Sub {
+		if err := checkSearchRegex(sub, repeated, repeats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
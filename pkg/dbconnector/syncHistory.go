@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Prefix of the redis keys holding the sync history. One sorted set per cluster, scored by timestamp.
+const SYNC_HISTORY_KEY_PREFIX = "search-aggregator:sync-history:"
+
+// Stats of a single sync request from a cluster.
+type SyncStats struct {
+	Timestamp      time.Time `json:"timestamp"`
+	RequestId      int       `json:"requestId"`
+	ClearAll       bool      `json:"clearAll"`
+	Status         int       `json:"status"` // HTTP status sent to the collector.
+	Added          int       `json:"added"`
+	Updated        int       `json:"updated"`
+	Deleted        int       `json:"deleted"`
+	EdgesAdded     int       `json:"edgesAdded"`
+	EdgesDeleted   int       `json:"edgesDeleted"`
+	Errors         int       `json:"errors"`
+	DurationMS     int64     `json:"durationMS"`
+	TotalResources int       `json:"totalResources"`
+}
+
+// Appends the stats to the sync history of the cluster and drops the entries older than the retention.
+func RecordSyncStats(ctx context.Context, clusterName string, stats SyncStats) error {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return err
+	}
+	entry, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	retention := time.Duration(config.SyncHistoryRetentionHours()) * time.Hour
+	return addToTimeline(ctx, SYNC_HISTORY_KEY_PREFIX+clusterName, retention, []time.Time{stats.Timestamp}, [][]byte{entry})
+}
+
+// Returns the sync history of the cluster since the given time, oldest first.
+func SyncHistory(ctx context.Context, clusterName string, since time.Time) ([]SyncStats, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readTimeline(ctx, SYNC_HISTORY_KEY_PREFIX+clusterName, since)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]SyncStats, 0, len(entries))
+	for _, entry := range entries {
+		var stats SyncStats
+		if err := json.Unmarshal(entry, &stats); err != nil {
+			return nil, err
+		}
+		history = append(history, stats)
+	}
+	return history, nil
+}
+
+// Adds the entries to the sorted set at key, scored by their time, and drops the entries older than the retention.
+func addToTimeline(ctx context.Context, key string, retention time.Duration, times []time.Time, entries [][]byte) error {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := redis.Args{key}
+	for i, entry := range entries {
+		args = args.Add(timeScore(times[i]), entry)
+	}
+	oldest := time.Now().Add(-retention)
+	_ = conn.Send("MULTI")
+	_ = conn.Send("ZADD", args...)
+	_ = conn.Send("ZREMRANGEBYSCORE", key, "-inf", "("+timeScore(oldest))
+	_ = conn.Send("EXPIRE", key, int64(retention.Seconds())) // Timelines of deleted clusters age out.
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// Returns the entries of the sorted set at key since the given time, oldest first.
+func readTimeline(ctx context.Context, key string, since time.Time) ([][]byte, error) {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return redis.ByteSlices(conn.Do("ZRANGEBYSCORE", key, timeScore(since), "+inf"))
+}
+
+// Score of a time in the sorted sets, in milliseconds.
+func timeScore(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Prefixes of the redis keys locking the syncs of each cluster across the replicas of the aggregator.
+const (
+	SYNC_LOCK_KEY_PREFIX   = "search-aggregator:sync-lock:"   // Owner of the lock, expires unless it's extended.
+	SYNC_FENCE_KEY_PREFIX  = "search-aggregator:sync-fence:"  // Fencing token of the last owner, incremented by each.
+	SYNC_EPOCH_KEY_PREFIX  = "search-aggregator:sync-epoch:"  // Epoch of the last resync of the cluster.
+	SYNC_RESYNC_KEY_PREFIX = "search-aggregator:sync-resync:" // Set when a resync was requested from the collector.
+)
+
+// How often a sync lock held by another replica is tried again.
+const syncLockPollInterval = 50 * time.Millisecond
+
+// Returned when the sync lock expired, or another replica holds it since, so the writes it guards must stop.
+var ErrSyncLockLost = errors.New("the sync lock of the cluster expired or is held by another replica")
+
+var (
+	syncLockOwner = hostname()
+	syncLockCount int64
+)
+
+// A sync lock of a cluster held by this replica. The fencing token guards the epoch and the lock itself, not the graph
+// writes: RedisGraph can't make a query conditional on a key, so a replica that lost the lock in the middle of a write
+// can still apply it. Losing the lock cancels the context of the writes and the token is checked again before the sync
+// responds, so such a sync fails and its cluster resyncs, but the fencing of the graph is best-effort.
+type SyncLock struct {
+	Cluster string
+	Token   int64  // Fencing token, higher than the tokens of the previous owners.
+	value   string // Identifies this owner, the lock key holds it while the lock is held.
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "aggregator"
+	}
+	return name
+}
+
+// Waits until the sync lock of the cluster is free and takes it for the ttl, or the context is done. The lock must be
+// extended before the ttl elapses, and released after the sync.
+func AcquireSyncLock(ctx context.Context, clusterName string, ttl time.Duration) (*SyncLock, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	lock := &SyncLock{Cluster: clusterName,
+		value: fmt.Sprintf("%s/%d/%d", syncLockOwner, time.Now().UnixNano(), atomic.AddInt64(&syncLockCount, 1))}
+	for {
+		acquired, err := lock.tryAcquire(ctx, ttl)
+		if err != nil || acquired {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(syncLockPollInterval):
+		}
+	}
+}
+
+// Takes the lock when it's free, and the next fencing token with it.
+func (l *SyncLock) tryAcquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	lockKey := SYNC_LOCK_KEY_PREFIX + l.Cluster
+	if _, err = conn.Do("WATCH", lockKey); err != nil {
+		return false, err
+	}
+	owner, err := conn.Do("GET", lockKey)
+	if err != nil || owner != nil {
+		_, _ = conn.Do("UNWATCH")
+		return false, err
+	}
+	_ = conn.Send("MULTI")
+	_ = conn.Send("SET", lockKey, l.value, "PX", ttl.Milliseconds())
+	_ = conn.Send("INCR", SYNC_FENCE_KEY_PREFIX+l.Cluster)
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err == redis.ErrNil {
+		return false, nil // Taken by another replica in the meantime.
+	}
+	if err != nil {
+		return false, err
+	}
+	l.Token, err = redis.Int64(replies[1], nil)
+	return err == nil, err
+}
+
+// Runs the queued commands in a transaction, only while this replica holds the lock with its fencing token.
+func (l *SyncLock) transaction(ctx context.Context, queue func(conn redis.Conn)) error {
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	lockKey, fenceKey := SYNC_LOCK_KEY_PREFIX+l.Cluster, SYNC_FENCE_KEY_PREFIX+l.Cluster
+	if _, err = conn.Do("WATCH", lockKey, fenceKey); err != nil {
+		return err
+	}
+	owner, err := redis.String(conn.Do("GET", lockKey))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+	token, err := redis.Int64(conn.Do("GET", fenceKey))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+	if owner != l.value || token != l.Token {
+		_, _ = conn.Do("UNWATCH")
+		return ErrSyncLockLost
+	}
+	_ = conn.Send("MULTI")
+	queue(conn)
+	_, err = redis.Values(conn.Do("EXEC"))
+	if err == redis.ErrNil {
+		return ErrSyncLockLost
+	}
+	return err
+}
+
+// Resets the expiry of the lock to the ttl.
+func (l *SyncLock) Extend(ctx context.Context, ttl time.Duration) error {
+	return l.transaction(ctx, func(conn redis.Conn) {
+		_ = conn.Send("PEXPIRE", SYNC_LOCK_KEY_PREFIX+l.Cluster, ttl.Milliseconds())
+	})
+}
+
+// Fails with ErrSyncLockLost when another replica took the lock, or the lock expired.
+func (l *SyncLock) Check(ctx context.Context) error {
+	return l.transaction(ctx, func(conn redis.Conn) {})
+}
+
+// Frees the lock for the next sync of the cluster, on any replica.
+func (l *SyncLock) Release(ctx context.Context) error {
+	return l.transaction(ctx, func(conn redis.Conn) {
+		_ = conn.Send("DEL", SYNC_LOCK_KEY_PREFIX+l.Cluster)
+	})
+}
+
+// Saves the epoch of a resync of the cluster, and clears the resync requested from its collector. Fails with
+// ErrSyncLockLost when another replica took the lock, so a stale owner can't replace the epoch of a newer resync.
+func (l *SyncLock) SetEpoch(ctx context.Context, epoch int64) error {
+	return l.transaction(ctx, func(conn redis.Conn) {
+		_ = conn.Send("SET", SYNC_EPOCH_KEY_PREFIX+l.Cluster, epoch)
+		_ = conn.Send("DEL", SYNC_RESYNC_KEY_PREFIX+l.Cluster)
+	})
+}
+
+// Returns the epoch of the last resync of the cluster, 0 when there's none, and whether a resync was requested from
+// its collector.
+func SyncEpoch(ctx context.Context, clusterName string) (int64, bool, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return 0, false, err
+	}
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	value, err := redis.String(conn.Do("GET", SYNC_EPOCH_KEY_PREFIX+clusterName))
+	if err != nil && err != redis.ErrNil {
+		return 0, false, err
+	}
+	epoch := int64(0)
+	if value != "" {
+		if epoch, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, false, err
+		}
+	}
+	requested, err := conn.Do("GET", SYNC_RESYNC_KEY_PREFIX+clusterName)
+	return epoch, requested != nil, err
+}
+
+// Asks for a resync of the cluster, its next delta is rejected by any replica.
+func RequestSyncResync(ctx context.Context, clusterName string) error {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return err
+	}
+	conn, err := Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("SET", SYNC_RESYNC_KEY_PREFIX+clusterName, "1")
+	return err
+}
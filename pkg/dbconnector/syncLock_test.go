@@ -0,0 +1,111 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireSyncLock(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	// Concurrent syncs of the cluster hold the lock one at a time.
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	holders, maxHolders := 0, 0
+	tokens := map[int64]bool{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := AcquireSyncLock(ctx, "locked-cluster", time.Minute)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mutex.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			tokens[lock.Token] = true
+			mutex.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mutex.Lock()
+			holders--
+			mutex.Unlock()
+			assert.NoError(t, lock.Release(ctx))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, maxHolders)
+	assert.Equal(t, map[int64]bool{1: true, 2: true, 3: true, 4: true, 5: true}, tokens,
+		"Each owner gets the next fencing token.")
+
+	lock, err := AcquireSyncLock(ctx, "locked-cluster", time.Minute)
+	assert.NoError(t, err)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = AcquireSyncLock(timeout, "locked-cluster", time.Minute)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.NoError(t, lock.Check(ctx))
+	assert.NoError(t, lock.Extend(ctx, time.Minute))
+	assert.NoError(t, lock.Release(ctx))
+
+	_, err = AcquireSyncLock(ctx, "invalid/cluster", time.Minute)
+	assert.Error(t, err)
+}
+
+func TestSyncLock_expired(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	stale, err := AcquireSyncLock(ctx, "expired-cluster", 20*time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, stale.SetEpoch(ctx, 1))
+	time.Sleep(30 * time.Millisecond)
+
+	// The lock expired, another replica takes it and resyncs the cluster.
+	lock, err := AcquireSyncLock(ctx, "expired-cluster", time.Minute)
+	assert.NoError(t, err)
+	assert.Greater(t, lock.Token, stale.Token)
+	assert.NoError(t, lock.SetEpoch(ctx, 2))
+
+	assert.Equal(t, ErrSyncLockLost, stale.SetEpoch(ctx, 3), "The stale owner can't replace the epoch.")
+	assert.Equal(t, ErrSyncLockLost, stale.Extend(ctx, time.Minute))
+	assert.Equal(t, ErrSyncLockLost, stale.Check(ctx), "The stale owner can't commit its sync.")
+	assert.NoError(t, lock.Check(ctx))
+	assert.Equal(t, ErrSyncLockLost, stale.Release(ctx), "The stale owner can't release the lock of the new one.")
+	epoch, _, err := SyncEpoch(ctx, "expired-cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), epoch)
+	assert.NoError(t, lock.Release(ctx))
+}
+
+func TestSyncEpoch(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	epoch, requested, err := SyncEpoch(ctx, "new-cluster")
+	assert.NoError(t, err)
+	assert.Zero(t, epoch)
+	assert.False(t, requested)
+
+	assert.NoError(t, RequestSyncResync(ctx, "new-cluster"))
+	_, requested, _ = SyncEpoch(ctx, "new-cluster")
+	assert.True(t, requested)
+
+	lock, err := AcquireSyncLock(ctx, "new-cluster", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.SetEpoch(ctx, 7))
+	assert.NoError(t, lock.Release(ctx))
+	epoch, requested, _ = SyncEpoch(ctx, "new-cluster")
+	assert.Equal(t, int64(7), epoch)
+	assert.False(t, requested, "The resync clears the request.")
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Prefix of the redis keys holding the tombstones. One sorted set per cluster, scored by deletion time.
+const TOMBSTONE_KEY_PREFIX = "search-aggregator:tombstones:"
+
+// Reason recorded for the resources removed because they were missing from a resync.
+const RESYNC_DELETE_REASON = "Missing from resync"
+
+// Record of a resource deleted from the graph.
+type Tombstone struct {
+	UID        string    `json:"uid"`
+	Kind       string    `json:"kind,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	DeletedAt  time.Time `json:"deletedAt"` // From the collector, or when the delete was received if not sent.
+	Reason     string    `json:"reason,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+	RequestId  int       `json:"requestId,omitempty"` // Request id of the sync that deleted the resource.
+}
+
+// Adds the tombstones of the cluster and drops the ones older than the retention.
+func RecordTombstones(ctx context.Context, clusterName string, tombstones []Tombstone) error {
+	err := ValidateClusterName(clusterName)
+	if err != nil || len(tombstones) == 0 {
+		return err
+	}
+	times := make([]time.Time, len(tombstones))
+	entries := make([][]byte, len(tombstones))
+	for i, tombstone := range tombstones {
+		if entries[i], err = json.Marshal(tombstone); err != nil {
+			return err
+		}
+		times[i] = tombstone.DeletedAt
+	}
+	retention := time.Duration(config.TombstoneRetentionHours()) * time.Hour
+	return addToTimeline(ctx, TOMBSTONE_KEY_PREFIX+clusterName, retention, times, entries)
+}
+
+// Returns the tombstones of the cluster deleted since the given time, oldest first.
+// Returns only the tombstones of the resource when uid isn't empty.
+func Tombstones(ctx context.Context, clusterName string, since time.Time, uid string) ([]Tombstone, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readTimeline(ctx, TOMBSTONE_KEY_PREFIX+clusterName, since)
+	if err != nil {
+		return nil, err
+	}
+	tombstones := make([]Tombstone, 0, len(entries))
+	for _, entry := range entries {
+		var tombstone Tombstone
+		if err := json.Unmarshal(entry, &tombstone); err != nil {
+			return nil, err
+		}
+		if uid == "" || tombstone.UID == uid {
+			tombstones = append(tombstones, tombstone)
+		}
+	}
+	return tombstones, nil
+}
+
+// Fills the kind, name and namespace of the tombstones from their nodes, before the nodes are deleted. The
+// tombstones without a node are left as they are.
+func DescribeTombstones(ctx context.Context, tombstones []Tombstone) error {
+	chunkSize := ChunkSize()
+	for i := 0; i < len(tombstones); i += chunkSize {
+		chunk := tombstones[i:min(i+chunkSize, len(tombstones))]
+		uids := make([]string, 0, len(chunk))
+		for _, tombstone := range chunk {
+			uids = append(uids, tombstone.UID)
+		}
+		result, err := Store.Query(ctx, "MATCH (n) WHERE n._uid IN "+quotedList(uids)+
+			" RETURN n._uid, n.kind, n.name, n.namespace")
+		if err != nil {
+			return err
+		}
+		described := make(map[string][3]string, len(chunk))
+		for result.Next() {
+			record := result.Record()
+			described[recordString(record.GetByIndex(0))] = [3]string{recordString(record.GetByIndex(1)),
+				recordString(record.GetByIndex(2)), recordString(record.GetByIndex(3))}
+		}
+		for j := range chunk {
+			if node, ok := described[chunk[j].UID]; ok {
+				chunk[j].Kind, chunk[j].Name, chunk[j].Namespace = node[0], node[1], node[2]
+			}
+		}
+	}
+	return nil
+}
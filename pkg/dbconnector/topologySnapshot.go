@@ -0,0 +1,211 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Redis key of the sorted set holding the topology snapshots, scored by the time they were taken.
+const TOPOLOGY_SNAPSHOT_KEY = "search-aggregator:topology-snapshots"
+
+// Resources of a kind in a namespace of a cluster. Cluster scoped resources have no namespace.
+type TopologyCount struct {
+	Cluster   string `json:"cluster"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Count     int    `json:"count"`
+}
+
+// Counts of the resources of the graph at a point in time, to find where resources went missing by comparing it
+// with a later snapshot.
+type TopologySnapshot struct {
+	TakenAt  time.Time       `json:"takenAt"`
+	Clusters []string        `json:"clusters"` // Clusters with a Cluster node, a cluster without one was detached.
+	Total    int             `json:"total"`
+	Counts   []TopologyCount `json:"counts,omitempty"`
+}
+
+// Change of the count of a kind in a namespace of a cluster between two snapshots. The changes of whole clusters
+// have no kind.
+type TopologyChange struct {
+	Cluster   string `json:"cluster"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Before    int    `json:"before"`
+	After     int    `json:"after"`
+	Delta     int    `json:"delta"`
+	Drop      bool   `json:"drop,omitempty"`     // Unexpected drop, see DiffTopology.
+	Detached  bool   `json:"detached,omitempty"` // The cluster was removed, its resources were expected to go.
+}
+
+// Changes between two snapshots, the biggest drops first.
+type TopologyDiff struct {
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Before   int              `json:"before"`
+	After    int              `json:"after"`
+	Drops    int              `json:"drops"`    // Changes flagged as unexpected drops.
+	Clusters []TopologyChange `json:"clusters"` // Changes of the total of each cluster.
+	Changes  []TopologyChange `json:"changes"`  // Changes of each kind and namespace of the clusters.
+}
+
+// Counts the resources of each kind and namespace of each cluster, without the placeholders.
+func TakeTopologySnapshot(ctx context.Context, now time.Time) (TopologySnapshot, error) {
+	snapshot := TopologySnapshot{TakenAt: now, Counts: []TopologyCount{}}
+	var err error
+	if snapshot.Clusters, err = ClusterNames(ctx); err != nil {
+		return snapshot, err
+	}
+	result, err := Store.Query(ctx, SanitizeQuery("MATCH (n) WHERE n.cluster IS NOT NULL AND n.%s IS NULL "+
+		"RETURN n.cluster, n.kind, n.namespace, count(n)", PLACEHOLDER_PROPERTY))
+	if err != nil {
+		return snapshot, err
+	}
+	for result.Next() {
+		record := result.Record()
+		count, _ := record.GetByIndex(3).(int)
+		snapshot.Counts = append(snapshot.Counts, TopologyCount{Cluster: recordString(record.GetByIndex(0)),
+			Kind: recordString(record.GetByIndex(1)), Namespace: recordString(record.GetByIndex(2)), Count: count})
+		snapshot.Total += count
+	}
+	sort.Slice(snapshot.Counts, func(i, j int) bool {
+		a, b := snapshot.Counts[i], snapshot.Counts[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Namespace < b.Namespace
+	})
+	return snapshot, nil
+}
+
+// Stores the snapshot and drops the ones older than TOPOLOGY_RETENTION_HOURS.
+func SaveTopologySnapshot(ctx context.Context, snapshot TopologySnapshot) error {
+	entry, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	retention := time.Duration(config.Cfg.TopologyRetentionHours) * time.Hour
+	return addToTimeline(ctx, TOPOLOGY_SNAPSHOT_KEY, retention, []time.Time{snapshot.TakenAt}, [][]byte{entry})
+}
+
+// Returns the stored snapshots, oldest first.
+func TopologySnapshots(ctx context.Context) ([]TopologySnapshot, error) {
+	retention := time.Duration(config.Cfg.TopologyRetentionHours) * time.Hour
+	entries, err := readTimeline(ctx, TOPOLOGY_SNAPSHOT_KEY, time.Now().Add(-retention))
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]TopologySnapshot, 0, len(entries))
+	for _, entry := range entries {
+		var snapshot TopologySnapshot
+		if err := json.Unmarshal(entry, &snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// Returns the last stored snapshot taken at or before the time, false when there's none.
+func TopologySnapshotAt(ctx context.Context, at time.Time) (TopologySnapshot, bool, error) {
+	snapshots, err := TopologySnapshots(ctx)
+	if err != nil {
+		return TopologySnapshot{}, false, err
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].TakenAt.After(at) {
+			return snapshots[i], true, nil
+		}
+	}
+	return TopologySnapshot{}, false, nil
+}
+
+// Compares two snapshots. A count is an unexpected drop when it lost at least minDrop resources and dropPercent of
+// its resources, and its cluster wasn't detached in between. Only the counts that changed are returned.
+func DiffTopology(from, to TopologySnapshot, dropPercent, minDrop int) TopologyDiff {
+	diff := TopologyDiff{From: from.TakenAt, To: to.TakenAt, Before: from.Total, After: to.Total,
+		Clusters: []TopologyChange{}, Changes: []TopologyChange{}}
+	attached := make(map[string]bool, len(to.Clusters))
+	for _, clusterName := range to.Clusters {
+		attached[clusterName] = true
+	}
+
+	type key struct{ cluster, kind, namespace string }
+	counts := make(map[key]*TopologyChange)
+	clusters := make(map[string]*TopologyChange)
+	change := func(c TopologyCount) (*TopologyChange, *TopologyChange) {
+		k := key{c.Cluster, c.Kind, c.Namespace}
+		if _, ok := counts[k]; !ok {
+			counts[k] = &TopologyChange{Cluster: c.Cluster, Kind: c.Kind, Namespace: c.Namespace}
+		}
+		if _, ok := clusters[c.Cluster]; !ok {
+			clusters[c.Cluster] = &TopologyChange{Cluster: c.Cluster}
+		}
+		return counts[k], clusters[c.Cluster]
+	}
+	for _, c := range from.Counts {
+		count, cluster := change(c)
+		count.Before += c.Count
+		cluster.Before += c.Count
+	}
+	for _, c := range to.Counts {
+		count, cluster := change(c)
+		count.After += c.Count
+		cluster.After += c.Count
+	}
+
+	classify := func(c *TopologyChange) {
+		c.Delta = c.After - c.Before
+		c.Detached = !attached[c.Cluster] && c.After == 0
+		c.Drop = c.Delta < 0 && !c.Detached && -c.Delta >= minDrop && -c.Delta*100 >= dropPercent*c.Before
+	}
+	for _, c := range counts {
+		classify(c)
+		if c.Delta == 0 {
+			continue
+		}
+		if c.Drop {
+			diff.Drops++
+		}
+		diff.Changes = append(diff.Changes, *c)
+	}
+	for _, c := range clusters {
+		classify(c)
+		if c.Delta != 0 {
+			diff.Clusters = append(diff.Clusters, *c)
+		}
+	}
+	sortTopologyChanges(diff.Clusters)
+	sortTopologyChanges(diff.Changes)
+	return diff
+}
+
+// Sorts the changes by how much they dropped, then by cluster, kind and namespace.
+func sortTopologyChanges(changes []TopologyChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Drop != b.Drop {
+			return a.Drop
+		}
+		if a.Delta != b.Delta {
+			return a.Delta < b.Delta
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Namespace < b.Namespace
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopologySnapshots(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.TopologyRetentionHours = 48
+	ctx := context.Background()
+	_, err := Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Pod {_uid:'c1/a', kind:'pod', cluster:'c1', namespace:'default'}), "+
+		"(:Pod {_uid:'c1/b', kind:'pod', cluster:'c1', namespace:'default'}), "+
+		"(:Node {_uid:'c1/n', kind:'node', cluster:'c1'}), "+
+		"(:Pod {_uid:'c1/p', kind:'pod', cluster:'c1', namespace:'default', _placeholder:true})")
+	assert.NoError(t, err)
+
+	now := time.Now().Truncate(time.Millisecond)
+	snapshot, err := TakeTopologySnapshot(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1"}, snapshot.Clusters)
+	assert.Equal(t, 3, snapshot.Total)
+	assert.Equal(t, []TopologyCount{{Cluster: "c1", Kind: "node", Count: 1},
+		{Cluster: "c1", Kind: "pod", Namespace: "default", Count: 2}}, snapshot.Counts)
+
+	assert.NoError(t, SaveTopologySnapshot(ctx, snapshot))
+	_, found, err := TopologySnapshotAt(ctx, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, found)
+	stored, found, err := TopologySnapshotAt(ctx, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, snapshot.Total, stored.Total)
+	assert.True(t, snapshot.TakenAt.Equal(stored.TakenAt))
+}
+
+func TestDiffTopology(t *testing.T) {
+	from := TopologySnapshot{Clusters: []string{"c1", "c2", "c3"}, Total: 185, Counts: []TopologyCount{
+		{Cluster: "c1", Kind: "pod", Namespace: "default", Count: 100},
+		{Cluster: "c1", Kind: "pod", Namespace: "small", Count: 5},
+		{Cluster: "c1", Kind: "node", Count: 30},
+		{Cluster: "c2", Kind: "pod", Namespace: "default", Count: 40},
+		{Cluster: "c3", Kind: "pod", Namespace: "default", Count: 10},
+	}}
+	to := TopologySnapshot{Clusters: []string{"c1", "c2"}, Total: 172, Counts: []TopologyCount{
+		{Cluster: "c1", Kind: "pod", Namespace: "default", Count: 50}, // Unexpected drop.
+		{Cluster: "c1", Kind: "node", Count: 28},                      // Below the percent.
+		{Cluster: "c2", Kind: "pod", Namespace: "default", Count: 40}, // Unchanged.
+		{Cluster: "c2", Kind: "pod", Namespace: "new", Count: 54},     // Added.
+	}}
+
+	diff := DiffTopology(from, to, 20, 10)
+	assert.Equal(t, 185, diff.Before)
+	assert.Equal(t, 172, diff.After)
+	assert.Equal(t, 1, diff.Drops)
+	assert.Equal(t, []TopologyChange{
+		{Cluster: "c1", Kind: "pod", Namespace: "default", Before: 100, After: 50, Delta: -50, Drop: true},
+		{Cluster: "c3", Kind: "pod", Namespace: "default", Before: 10, After: 0, Delta: -10, Detached: true},
+		{Cluster: "c1", Kind: "pod", Namespace: "small", Before: 5, After: 0, Delta: -5},
+		{Cluster: "c1", Kind: "node", Before: 30, After: 28, Delta: -2},
+		{Cluster: "c2", Kind: "pod", Namespace: "new", Before: 0, After: 54, Delta: 54},
+	}, diff.Changes)
+	assert.Equal(t, []TopologyChange{
+		{Cluster: "c1", Before: 135, After: 78, Delta: -57, Drop: true},
+		{Cluster: "c3", Before: 10, After: 0, Delta: -10, Detached: true},
+		{Cluster: "c2", Before: 40, After: 94, Delta: 54},
+	}, diff.Clusters)
+}
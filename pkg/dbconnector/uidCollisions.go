@@ -0,0 +1,133 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Node property holding the UID without the cluster prefix. A restored or cloned cluster reports the resources
+// of the original cluster with the same UIDs under its own cluster name.
+const LOCAL_UID_PROPERTY = "_localUid"
+
+// Key of the redis sorted set holding the UID collisions detected across clusters, scored by detection time.
+const UID_COLLISIONS_KEY = "search-aggregator:uid-collisions"
+
+// A node of another cluster with the same local UID as an incoming resource.
+type CollidingNode struct {
+	UID     string
+	Cluster string
+	Created string // RFC3339, empty when the resource doesn't have a creation time.
+}
+
+// Record of a resource sent with the UID of a resource in another cluster.
+type UIDCollision struct {
+	UID             string    `json:"uid"`
+	Cluster         string    `json:"cluster"`
+	Kind            string    `json:"kind,omitempty"`
+	Name            string    `json:"name,omitempty"`
+	ExistingUID     string    `json:"existingUid"`
+	ExistingCluster string    `json:"existingCluster"`
+	Policy          string    `json:"policy"`
+	Action          string    `json:"action"` // kept, rejected or replaced
+	DetectedAt      time.Time `json:"detectedAt"`
+}
+
+// Returns the UID without the cluster prefix, or empty for UIDs without a prefix, e.g. the cluster nodes.
+func LocalUID(uid string) string {
+	if i := strings.Index(uid, "/"); i >= 0 {
+		return uid[i+1:]
+	}
+	return ""
+}
+
+func (r *Resource) addLocalUIDProperty() {
+	localUID := LocalUID(r.UID)
+	if localUID == "" {
+		return
+	}
+	if r.Properties == nil { // init props if it was nil
+		r.Properties = make(map[string]interface{})
+	}
+	r.Properties[LOCAL_UID_PROPERTY] = localUID
+}
+
+// Returns the nodes of the other clusters with the same local UID as the resources, keyed by resource UID.
+// Only finds the nodes inserted or updated since the local UID is stored.
+func FindUIDCollisions(ctx context.Context, clusterName string, uids []string) (map[string][]CollidingNode, error) {
+	err := ValidateClusterName(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	byLocalUID := make(map[string]string, len(uids))
+	localUIDs := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		if localUID := LocalUID(uid); localUID != "" {
+			byLocalUID[localUID] = uid
+			localUIDs = append(localUIDs, localUID)
+		}
+	}
+	collisions := make(map[string][]CollidingNode)
+	chunkSize := ChunkSize()
+	for i := 0; i < len(localUIDs); i += chunkSize {
+		query := fmt.Sprintf("MATCH (n) WHERE n.%[1]s IN %[2]s AND n.cluster <> '%[3]s' "+
+			"RETURN n.%[1]s, n._uid, n.cluster, n.created",
+			LOCAL_UID_PROPERTY, quotedList(localUIDs[i:min(i+chunkSize, len(localUIDs))]), clusterName)
+		result, err := Store.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for result.Next() {
+			record := result.Record()
+			uid := byLocalUID[recordString(record.GetByIndex(0))]
+			collisions[uid] = append(collisions[uid], CollidingNode{
+				UID:     recordString(record.GetByIndex(1)),
+				Cluster: recordString(record.GetByIndex(2)),
+				Created: recordString(record.GetByIndex(3)),
+			})
+		}
+	}
+	return collisions, nil
+}
+
+// Adds the collisions to the report and drops the ones older than the retention.
+func RecordUIDCollisions(ctx context.Context, collisions []UIDCollision) error {
+	if len(collisions) == 0 {
+		return nil
+	}
+	times := make([]time.Time, len(collisions))
+	entries := make([][]byte, len(collisions))
+	for i, collision := range collisions {
+		var err error
+		if entries[i], err = json.Marshal(collision); err != nil {
+			return err
+		}
+		times[i] = collision.DetectedAt
+	}
+	retention := time.Duration(config.Cfg.CollisionRetentionHours) * time.Hour
+	return addToTimeline(ctx, UID_COLLISIONS_KEY, retention, times, entries)
+}
+
+// Returns the collisions detected since the given time, oldest first.
+func UIDCollisions(ctx context.Context, since time.Time) ([]UIDCollision, error) {
+	entries, err := readTimeline(ctx, UID_COLLISIONS_KEY, since)
+	if err != nil {
+		return nil, err
+	}
+	collisions := make([]UIDCollision, 0, len(entries))
+	for _, entry := range entries {
+		var collision UIDCollision
+		if err := json.Unmarshal(entry, &collision); err != nil {
+			return nil, err
+		}
+		collisions = append(collisions, collision)
+	}
+	return collisions, nil
+}
@@ -10,39 +10,40 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
 
-	"github.com/golang/glog"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
 // Recursive helper for ChunkedUpdate. Takes a single chunk, and recursively attempts to insert that chunk,
 // then the first and second halves of that chunk independently, and so on.
-func chunkedUpdateHelper(resources []*Resource) ChunkedOperationResult {
+func chunkedUpdateHelper(ctx context.Context, resources []*Resource) ChunkedOperationResult {
 	if len(resources) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
-	_, _, err := Update(resources) // We ignore encoding errors as they are always recoverable.
-	if IsBadConnection(err) {      // this is false if err is nil
+	_, _, err := Update(ctx, resources) // We ignore encoding errors as they are always recoverable.
+	if isFatalError(ctx, err) {         // this is false if err is nil
 		return ChunkedOperationResult{
-			ConnectionError: err,
+			ConnectionError: batchError(ctx, "update", err),
 		}
 	}
 	if err != nil {
 		if len(resources) == 1 { // If this was a single resource
 			return ChunkedOperationResult{
-				ResourceErrors: map[string]error{resources[0].UID: err},
+				ResourceErrors: map[string]error{resources[0].UID: resourceError("update", resources[0].UID, err)},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedUpdateHelper(resources[0 : len(resources)/2])
-			secondHalf := chunkedUpdateHelper(resources[len(resources)/2:])
-			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
-				// Again, if either one has a redis conn issue we just instantly bail
-				return ChunkedOperationResult{
-					ConnectionError: err,
-				}
+			firstHalf := chunkedUpdateHelper(ctx, resources[0:len(resources)/2])
+			secondHalf := chunkedUpdateHelper(ctx, resources[len(resources)/2:])
+			// Again, if either one has a redis conn issue we just instantly bail
+			if firstHalf.ConnectionError != nil {
+				return firstHalf
+			}
+			if secondHalf.ConnectionError != nil {
+				return secondHalf
 			}
 			return ChunkedOperationResult{
 				ResourceErrors: mergeErrorMaps(firstHalf.ResourceErrors, secondHalf.ResourceErrors),
@@ -58,31 +59,19 @@ func chunkedUpdateHelper(resources []*Resource) ChunkedOperationResult {
 }
 
 // Updates the given resources in the graph, does chunking for you and returns errors related to individual resources.
-func ChunkedUpdate(resources []*Resource) ChunkedOperationResult {
-	var resourceErrors map[string]error
-	totalSuccessful := 0
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedUpdateHelper(resources[i:endIndex])
-		if chunkResult.ConnectionError != nil {
-			return chunkResult
-		} else if chunkResult.ResourceErrors != nil {
-			resourceErrors = mergeErrorMaps(resourceErrors, chunkResult.ResourceErrors) // if both are nil, this is nil
-		}
-		totalSuccessful += chunkResult.SuccessfulResources
-	}
-	return ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalSuccessful,
-	}
+func ChunkedUpdate(ctx context.Context, resources []*Resource) ChunkedOperationResult {
+	shards, shardSizes := resourceShards(resources)
+	return runChunkShards(ctx, "update", shardSizes, func(shard, start, end int) ChunkedOperationResult {
+		return chunkedUpdateHelper(ctx, shards[shard][start:end])
+	})
 }
 
 // Updates given resources into graph, transparently builds query for you and
 // returns the reponse and errors given by redisgraph.
 // Returns the result, any errors when encoding, and any error from the query itself.
-func Update(resources []*Resource) (*rg2.QueryResult, map[string]error, error) {
+func Update(ctx context.Context, resources []*Resource) (*rg2.QueryResult, map[string]error, error) {
 	query, encodingErrors := updateQuery(resources) // Encoding errors are recoverable, but we still report them
-	resp, err := Store.Query(query)
+	resp, err := Store.Query(WithWrite(ctx), query)
 	return resp, encodingErrors, err
 }
 
@@ -102,15 +91,21 @@ func updateQuery(resources []*Resource) (string, map[string]error) {
 	setStrings := []string{}   // Build the SET portion. Declare this here so that we can do this in one pass.
 	for i, resource := range resources {
 		resource.addRbacProperty()
+		resource.protectProperties()
+		resource.addHashProperty()
+		resource.addLocalUIDProperty()
 		// e.g. (n0:Pod {_uid: 'abc123'})
 		matchStrings = append(matchStrings, fmt.Sprintf("(n%d:%s {_uid: '%s'})",
 			i, resource.Properties["kind"], resource.UID))
 		encodedProps, err := resource.EncodeProperties()
 		if err != nil {
-			glog.Error("Cannot encode resource ", resource.UID, ", excluding it from update: ", err)
+			logger.Error("Cannot encode resource ", resource.UID, ", excluding it from update: ", err)
 			encodingErrors[resource.UID] = err
 			continue
 		}
+		kind, _ := resource.Properties["kind"].(string)
+		observeSchema(kind, encodedProps)
+		setStrings = append(setStrings, fmt.Sprintf("n%d.%s=coalesce(n%d.%s, 0)+1", i, REV_PROPERTY, i, REV_PROPERTY))
 		for k, v := range encodedProps {
 			switch typed := v.(type) { // This is either string or int64 with base type string or []interface
 			// Need to wrap in quotes if it's string
@@ -130,11 +125,11 @@ func updateQuery(resources []*Resource) (string, map[string]error) {
 	return queryString, encodingErrors
 }
 
-func UpdateByName(resource Resource) (*rg2.QueryResult, error, bool) {
+func UpdateByName(ctx context.Context, resource Resource) (*rg2.QueryResult, error, bool) {
 	resource.addRbacProperty()
 	encodedProps, err := resource.EncodeProperties()
 	if err != nil {
-		glog.Error("Cannot encode resource ", resource.UID, ", excluding it from update: ", err)
+		logger.Error("Cannot encode resource ", resource.UID, ", excluding it from update: ", err)
 		return &rg2.QueryResult{}, err, false
 	}
 
@@ -148,7 +143,7 @@ func UpdateByName(resource Resource) (*rg2.QueryResult, error, bool) {
 	if isKeyClustersCache(resource.UID) {
 		mapInRG := getClustersCache(resource.UID)
 		if reflect.DeepEqual(mapInRG, encodedProps) {
-			glog.V(3).Infof("No updates performed as the Object values have not changed")
+			logger.V(3).Infof("No updates performed as the Object values have not changed")
 			return &rg2.QueryResult{}, err, true
 		}
 
@@ -165,15 +160,15 @@ func UpdateByName(resource Resource) (*rg2.QueryResult, error, bool) {
 		}
 	}
 
-	glog.V(2).Infof("Updating properties for cluster %s on db.", resource.Properties["name"])
+	logger.V(2).Infof("Updating properties for cluster %s on db.", resource.Properties["name"])
 	// e.g. "MATCH (n:Cluster {name: 'abc123'}) SET n.foo=4"
 	queryString := fmt.Sprintf("MATCH (n:%s {name: '%s'}) SET %s",
 		resource.Properties["kind"], resource.Properties["name"], strings.Join(setStrings, ", "))
-	resp, err := Store.Query(queryString)
+	resp, err := Store.Query(WithWrite(ctx), queryString)
 	//if there is no error store the Map in Global encodedPropsMap
 	if err == nil {
 		if isClustersCacheNil() {
-			glog.V(3).Infof("Creating new cluster cache.")
+			logger.V(3).Infof("Creating new cluster cache.")
 			createClustersCache(resource.UID, encodedProps)
 		} else {
 			setClustersCache(resource.UID, encodedProps)
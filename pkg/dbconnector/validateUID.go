@@ -0,0 +1,68 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Matches the UID assigned by kubernetes, e.g. 3f1b6a2e-9c1d-4f5e-8a7b-1c2d3e4f5a6b
+var kubeUIDRegex = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Reasons used when a UID is normalized or rejected. Also used as metric labels.
+const (
+	UID_REASON_EMPTY            = "empty"
+	UID_REASON_ILLEGAL_CHARS    = "illegal_characters"
+	UID_REASON_MALFORMED        = "malformed"
+	UID_REASON_CLUSTER_MISMATCH = "cluster_mismatch"
+	UID_REASON_MISSING_PREFIX   = "missing_cluster_prefix"
+	UID_REASON_WHITESPACE       = "whitespace"
+	UID_REASON_UPPERCASE        = "uppercase"
+)
+
+// NormalizeUID validates a UID received from a collector and returns it in the canonical
+// form <clusterName>/<uid>.
+// Recoverable problems are fixed: surrounding whitespace is trimmed, a bare kubernetes UID gets
+// the cluster prefix and the kubernetes UID is lowercased. In that case reason is set and err is nil.
+// UIDs that can't be fixed are rejected with an error, because they create nodes that never get cleaned up.
+func NormalizeUID(uid, clusterName string) (normalized string, reason string, err error) {
+	normalized = strings.TrimSpace(uid)
+	if normalized == "" {
+		return "", UID_REASON_EMPTY, errors.New("UID must not be empty")
+	}
+	if normalized != uid {
+		reason = UID_REASON_WHITESPACE
+	}
+	if strings.ContainsAny(normalized, "'\" \t\n") {
+		return "", UID_REASON_ILLEGAL_CHARS, errors.New("UID contains illegal characters: quotes or whitespace")
+	}
+
+	sep := strings.Index(normalized, "/")
+	if sep == -1 {
+		if !kubeUIDRegex.MatchString(normalized) {
+			return "", UID_REASON_MALFORMED, errors.New("UID must use the format <cluster>/<uid>")
+		}
+		normalized = clusterName + "/" + normalized
+		sep = len(clusterName)
+		reason = UID_REASON_MISSING_PREFIX
+	}
+
+	prefix, id := normalized[:sep], normalized[sep+1:]
+	if id == "" {
+		return "", UID_REASON_MALFORMED, errors.New("UID must use the format <cluster>/<uid>")
+	}
+	if prefix != clusterName {
+		return "", UID_REASON_CLUSTER_MISMATCH, errors.New("UID prefix doesn't match the cluster name")
+	}
+	if kubeUIDRegex.MatchString(id) && strings.ToLower(id) != id {
+		normalized = prefix + "/" + strings.ToLower(id)
+		if reason == "" {
+			reason = UID_REASON_UPPERCASE
+		}
+	}
+	return normalized, reason, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+package dbconnector
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_NormalizeUID(t *testing.T) {
+	uid, reason, err := NormalizeUID("cluster1/3f1b6a2e-9c1d-4f5e-8a7b-1c2d3e4f5a6b", "cluster1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", reason)
+	assert.Equal(t, "cluster1/3f1b6a2e-9c1d-4f5e-8a7b-1c2d3e4f5a6b", uid)
+
+	uid, reason, err = NormalizeUID(" 3F1B6A2E-9C1D-4F5E-8A7B-1C2D3E4F5A6B", "cluster1")
+	assert.Nil(t, err)
+	assert.Equal(t, UID_REASON_MISSING_PREFIX, reason)
+	assert.Equal(t, "cluster1/3f1b6a2e-9c1d-4f5e-8a7b-1c2d3e4f5a6b", uid)
+
+	uid, reason, err = NormalizeUID("cluster1/helm-release/my-release", "cluster1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", reason)
+	assert.Equal(t, "cluster1/helm-release/my-release", uid)
+
+	_, reason, err = NormalizeUID("cluster2/3f1b6a2e-9c1d-4f5e-8a7b-1c2d3e4f5a6b", "cluster1")
+	assert.NotNil(t, err)
+	assert.Equal(t, UID_REASON_CLUSTER_MISMATCH, reason)
+
+	_, reason, err = NormalizeUID("not-a-uid", "cluster1")
+	assert.NotNil(t, err)
+	assert.Equal(t, UID_REASON_MALFORMED, reason)
+
+	_, reason, err = NormalizeUID("cluster1/", "cluster1")
+	assert.NotNil(t, err)
+	assert.Equal(t, UID_REASON_MALFORMED, reason)
+
+	_, reason, err = NormalizeUID("cluster1/ab'c", "cluster1")
+	assert.NotNil(t, err)
+	assert.Equal(t, UID_REASON_ILLEGAL_CHARS, reason)
+
+	_, reason, err = NormalizeUID("  ", "cluster1")
+	assert.NotNil(t, err)
+	assert.Equal(t, UID_REASON_EMPTY, reason)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+const warmUpSampleSize = 100 // Nodes of each kind read to preload the schema.
+
+// Pings the datastore with a connection outside of the pool, like the readiness probe.
+func PingDatastore() error {
+	conn, err := Pool.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("PING")
+	return err
+}
+
+// Looks up a UID in the index of each kind in the graph, so the first syncs and searches don't wait for the index
+// to be read, and records the kinds with an index. Returns the kinds.
+func WarmUpUIDIndexes(ctx context.Context) ([]string, error) {
+	labels, err := graphLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		if _, err = Store.Query(ctx, SanitizeQuery("MATCH (n:%s {_uid:''}) RETURN count(n)", label)); err != nil {
+			return labels, err
+		}
+	}
+	GetIndexes()
+	return labels, nil
+}
+
+// Preloads the schema with the properties of a sample of the nodes of each kind and the edge types in the graph,
+// so the schema API has the resources stored before the aggregator started. Returns the number of edge types.
+func WarmUpSchema(ctx context.Context, kinds []string) (int, error) {
+	for _, kind := range kinds {
+		result, err := Store.Query(ctx, SanitizeQuery("MATCH (n:%s) RETURN n LIMIT %d", kind, warmUpSampleSize))
+		if err != nil {
+			return 0, err
+		}
+		for result.Next() {
+			node, ok := result.Record().GetByIndex(0).(*rg2.Node)
+			if !ok || IsPlaceholder(node.Properties) {
+				continue
+			}
+			if _, resource := node.Properties["cluster"]; !resource {
+				continue // The Cluster, summary and status nodes aren't resources.
+			}
+			properties := make(map[string]interface{}, len(node.Properties))
+			for property, value := range node.Properties {
+				if number, ok := value.(int); ok {
+					value = int64(number) // The graph returns ints, the schema has the encoded int64.
+				}
+				properties[property] = value
+			}
+			nodeKind, _ := node.Properties["kind"].(string)
+			if nodeKind == "" {
+				nodeKind = kind
+			}
+			observeSchema(nodeKind, properties)
+		}
+	}
+	result, err := Store.Query(ctx, "MATCH ()-[e]->() RETURN distinct type(e)")
+	if err != nil {
+		return 0, err
+	}
+	edgeTypes := 0
+	for result.Next() {
+		if edgeType := recordString(result.Record().GetByIndex(0)); edgeType != "" {
+			ObserveEdgeType(edgeType)
+			edgeTypes++
+		}
+	}
+	return edgeTypes, nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmUpSchema(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE "+
+		"(c:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:WarmUpKind {_uid:'c1/a', kind:'WarmUpKind', cluster:'c1', name:'a', replicas:3})-[:inCluster]->(c), "+
+		"(:Unknown {_uid:'c1/p', kind:'Unknown', cluster:'c1', _placeholder:true})")
+	assert.NoError(t, err)
+	assert.NoError(t, PingDatastore())
+
+	kinds, err := WarmUpUIDIndexes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Cluster", "Unknown", "WarmUpKind"}, kinds)
+
+	edgeTypes, err := WarmUpSchema(ctx, kinds)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, edgeTypes)
+	var warmUpKind *SchemaKind
+	for _, kind := range CurrentSchema().Kinds {
+		assert.NotEqual(t, "unknown", kind.Kind, "Placeholders aren't in the schema")
+		if kind.Kind == "warmupkind" {
+			warmUpKind = &kind
+		}
+	}
+	if assert.NotNil(t, warmUpKind) {
+		assert.Contains(t, warmUpKind.Properties, SchemaProperty{Name: "replicas", Types: []string{SCHEMA_NUMBER}})
+	}
+	assert.Contains(t, CurrentSchema().EdgeTypes, "inCluster")
+}
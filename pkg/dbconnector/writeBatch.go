@@ -0,0 +1,175 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// A small write of a delta sync, waiting to share a query with the writes of other clusters.
+type batchedWrite struct {
+	clusterName string
+	uids        []string // Nodes to delete.
+	edges       []Edge   // Edges to delete.
+	done        chan ChunkedOperationResult
+}
+
+func (w *batchedWrite) size() int {
+	return len(w.uids) + len(w.edges)
+}
+
+// Groups the writes of an operation from different clusters for WRITE_BATCH_WINDOW_MS, so many small deltas share
+// a query instead of paying the query overhead each.
+type writeBatcher struct {
+	op string
+	// Runs the shared query for the writes, the same one ChunkedDelete or ChunkedDeleteEdge would run for a chunk.
+	run func(ctx context.Context, writes []*batchedWrite) (ChunkedOperationResult, error)
+	// Writes a single write on its own, so its errors are attributed to its cluster when the shared query fails.
+	single func(ctx context.Context, w *batchedWrite) ChunkedOperationResult
+
+	mutex   sync.Mutex
+	pending []*batchedWrite
+	size    int  // Resources in the pending writes.
+	waiting bool // A flush is scheduled for the pending writes.
+}
+
+var deleteBatcher = &writeBatcher{
+	op: "delete",
+	run: func(ctx context.Context, writes []*batchedWrite) (ChunkedOperationResult, error) {
+		uids := []string{}
+		for _, w := range writes {
+			uids = append(uids, w.uids...)
+		}
+		if _, err := Delete(ctx, uids); err != nil {
+			return ChunkedOperationResult{}, err
+		}
+		recordDeletes(len(uids))
+		return ChunkedOperationResult{SuccessfulResources: len(uids)}, nil
+	},
+	single: func(ctx context.Context, w *batchedWrite) ChunkedOperationResult {
+		return ChunkedDelete(ctx, w.uids)
+	},
+}
+
+var deleteEdgeBatcher = &writeBatcher{
+	op: "delete edge",
+	run: func(ctx context.Context, writes []*batchedWrite) (ChunkedOperationResult, error) {
+		edges := []Edge{}
+		for _, w := range writes {
+			edges = append(edges, w.edges...)
+		}
+		resp, err := DeleteEdge(ctx, edges)
+		if err != nil {
+			return ChunkedOperationResult{}, err
+		}
+		return ChunkedOperationResult{SuccessfulResources: len(edges), EdgesDeleted: resp.RelationshipsDeleted()}, nil
+	},
+	single: func(ctx context.Context, w *batchedWrite) ChunkedOperationResult {
+		return ChunkedDeleteEdge(ctx, w.edges, w.clusterName)
+	},
+}
+
+// Tells whether a write of the given number of resources is batched with the writes of other clusters.
+func shouldBatchWrite(count int) bool {
+	return config.Cfg.WriteBatchWindowMS > 0 && count > 0 && count <= config.Cfg.WriteBatchMaxResources
+}
+
+// Adds the write to the batch and waits for its result. The batch is flushed after WRITE_BATCH_WINDOW_MS, or right
+// away once it has a chunk of resources.
+func (b *writeBatcher) write(ctx context.Context, w *batchedWrite) ChunkedOperationResult {
+	w.done = make(chan ChunkedOperationResult, 1)
+	b.mutex.Lock()
+	b.pending = append(b.pending, w)
+	b.size += w.size()
+	if b.size >= ChunkSize() {
+		writes := b.take()
+		b.mutex.Unlock()
+		go b.flush(writes)
+	} else {
+		if !b.waiting {
+			b.waiting = true
+			time.AfterFunc(time.Duration(config.Cfg.WriteBatchWindowMS)*time.Millisecond, func() {
+				b.mutex.Lock()
+				writes := b.take()
+				b.mutex.Unlock()
+				b.flush(writes)
+			})
+		}
+		b.mutex.Unlock()
+	}
+
+	select {
+	case result := <-w.done:
+		return result
+	case <-ctx.Done():
+		// The write may still be done with the batch, the collector retries it.
+		return ChunkedOperationResult{ConnectionError: batchError(ctx, b.op, ctx.Err())}
+	}
+}
+
+// Takes the pending writes. Must hold the mutex.
+func (b *writeBatcher) take() []*batchedWrite {
+	writes := b.pending
+	b.pending, b.size, b.waiting = nil, 0, false
+	return writes
+}
+
+// Runs the writes with a shared query. When it fails for a resource, each write runs again on its own so the
+// error goes to the cluster it belongs to.
+func (b *writeBatcher) flush(writes []*batchedWrite) {
+	if len(writes) == 0 {
+		return
+	}
+	metrics.WriteBatchSize.WithLabelValues(b.op).Observe(float64(len(writes)))
+	ctx := context.Background()
+	if len(writes) == 1 {
+		writes[0].done <- b.single(ctx, writes[0])
+		return
+	}
+
+	result, err := b.run(ctx, writes)
+	switch {
+	case err == nil:
+		for _, w := range writes {
+			// Only the batch knows how many edges matched, each write gets its share when they all did.
+			wResult := ChunkedOperationResult{SuccessfulResources: w.size()}
+			if result.EdgesDeleted == result.SuccessfulResources {
+				wResult.EdgesDeleted = len(w.edges)
+			}
+			w.done <- wResult
+		}
+	case isFatalError(ctx, err):
+		for _, w := range writes {
+			w.done <- ChunkedOperationResult{ConnectionError: batchError(ctx, b.op, err)}
+		}
+	default:
+		logger.V(3).Infof("Batched %s of %d writes failed, writing them one at a time. %s", b.op, len(writes), err)
+		for _, w := range writes {
+			w.done <- b.single(ctx, w)
+		}
+	}
+}
+
+// Deletes the resources of a delta sync like ChunkedDelete, batched with the small deletes of other clusters when
+// WRITE_BATCH_WINDOW_MS is set.
+func BatchedDelete(ctx context.Context, clusterName string, uids []string) ChunkedOperationResult {
+	if !shouldBatchWrite(len(uids)) {
+		return ChunkedDelete(ctx, uids)
+	}
+	return deleteBatcher.write(ctx, &batchedWrite{clusterName: clusterName, uids: uids})
+}
+
+// Deletes the edges of a delta sync like ChunkedDeleteEdge, batched with the small edge deletes of other clusters
+// when WRITE_BATCH_WINDOW_MS is set.
+func BatchedDeleteEdge(ctx context.Context, clusterName string, edges []Edge) ChunkedOperationResult {
+	if !shouldBatchWrite(len(edges)) {
+		return ChunkedDeleteEdge(ctx, edges, clusterName)
+	}
+	return deleteEdgeBatcher.write(ctx, &batchedWrite{clusterName: clusterName, edges: edges})
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchedDelete(t *testing.T) {
+	useTestDatastore(t)
+	t.Cleanup(config.Snapshot())
+	config.Cfg.WriteBatchWindowMS = 20
+	ctx := context.Background()
+
+	_, err := Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a', cluster:'c1'})-[:ownedBy]->(:ReplicaSet {_uid:'c1/r', cluster:'c1'}), "+
+		"(:Pod {_uid:'c2/a', cluster:'c2'}), (:Pod {_uid:'c2/b', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	results := make([]ChunkedOperationResult, 3)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); results[0] = BatchedDelete(ctx, "c2", []string{"c2/a"}) }()
+	go func() { defer wg.Done(); results[1] = BatchedDelete(ctx, "c2", []string{"c2/b"}) }()
+	go func() {
+		defer wg.Done()
+		results[2] = BatchedDeleteEdge(ctx, "c1", []Edge{{SourceUID: "c1/a", EdgeType: "ownedBy", DestUID: "c1/r"}})
+	}()
+	wg.Wait()
+
+	for _, result := range results {
+		assert.NoError(t, result.Err())
+		assert.Equal(t, 1, result.SuccessfulResources)
+	}
+	assert.Equal(t, 1, results[2].EdgesDeleted)
+	assert.Equal(t, 2, queryRows(t, "MATCH (n) RETURN n"))
+	assert.Equal(t, 0, queryRows(t, "MATCH ()-[e]->() RETURN e"))
+}
+
+func TestWriteBatcherFallback(t *testing.T) {
+	single := map[string]int{}
+	batcher := &writeBatcher{
+		op: "delete",
+		run: func(ctx context.Context, writes []*batchedWrite) (ChunkedOperationResult, error) {
+			return ChunkedOperationResult{}, errors.New("Invalid query")
+		},
+		single: func(ctx context.Context, w *batchedWrite) ChunkedOperationResult {
+			single[w.clusterName]++
+			if w.clusterName == "c2" {
+				return ChunkedOperationResult{ResourceErrors: map[string]error{"c2/a": errors.New("Invalid query")}}
+			}
+			return ChunkedOperationResult{SuccessfulResources: len(w.uids)}
+		},
+	}
+	c1 := &batchedWrite{clusterName: "c1", uids: []string{"c1/a"}, done: make(chan ChunkedOperationResult, 1)}
+	c2 := &batchedWrite{clusterName: "c2", uids: []string{"c2/a"}, done: make(chan ChunkedOperationResult, 1)}
+
+	// The failed batch runs each write on its own, so only c2 gets the error.
+	batcher.flush([]*batchedWrite{c1, c2})
+	assert.Equal(t, map[string]int{"c1": 1, "c2": 1}, single)
+	assert.Equal(t, 1, (<-c1.done).SuccessfulResources)
+	assert.Contains(t, (<-c2.done).ResourceErrors, "c2/a")
+}
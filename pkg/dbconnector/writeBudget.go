@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Bytes written to the primary graph in the current interval of the write budget.
+var writeBudget = struct {
+	sync.Mutex
+	start time.Time // Start of the current interval.
+	used  int64
+}{}
+
+func writeBudgetInterval() time.Duration {
+	if config.Cfg.WriteBudgetIntervalMS <= 0 {
+		return time.Duration(config.DEFAULT_WRITE_BUDGET_INTERVAL_MS) * time.Millisecond
+	}
+	return time.Duration(config.Cfg.WriteBudgetIntervalMS) * time.Millisecond
+}
+
+// Starts a new interval once the current one is over, and reports the utilization of the one that ended.
+// Must be called while holding the lock.
+func rollWriteBudget(now time.Time) {
+	interval := writeBudgetInterval()
+	if now.Sub(writeBudget.start) < interval {
+		return
+	}
+	if budget := config.Cfg.WriteBudgetBytes; budget > 0 {
+		utilization := float64(writeBudget.used) / float64(budget)
+		if now.Sub(writeBudget.start) >= 2*interval {
+			utilization = 0 // No write in the last interval.
+		}
+		metrics.WriteBudgetUtilization.Set(utilization)
+	}
+	writeBudget.start = now.Truncate(interval)
+	writeBudget.used = 0
+}
+
+// Counts the estimated bytes of a write query, the size of the query with the properties it writes, against the
+// WRITE_BUDGET_BYTES of the interval. Bulk writes, the resyncs and the derived edges, wait for the next interval
+// while the budget is exceeded, up to WRITE_BUDGET_MAX_DELAY_MS. The deltas are never delayed, but count against
+// the budget. A bulk write still runs in an interval without any other write when it's larger than the budget.
+func acquireWriteBudget(ctx context.Context, q string) error {
+	lane := LaneFromContext(ctx)
+	bytes := int64(len(q))
+	metrics.WriteBudgetBytes.WithLabelValues(lane.String()).Add(float64(bytes))
+	budget := int64(config.Cfg.WriteBudgetBytes)
+	if budget <= 0 {
+		return nil
+	}
+
+	waitStart := time.Now()
+	maxDelay := time.Duration(config.Cfg.WriteBudgetMaxDelayMS) * time.Millisecond
+	for {
+		now := time.Now()
+		writeBudget.Lock()
+		rollWriteBudget(now)
+		if lane != BulkLane || writeBudget.used == 0 || writeBudget.used+bytes <= budget ||
+			now.Sub(waitStart) >= maxDelay {
+			writeBudget.used += bytes
+			writeBudget.Unlock()
+			break
+		}
+		wait := writeBudget.start.Add(writeBudgetInterval()).Sub(now)
+		writeBudget.Unlock()
+		if remaining := maxDelay - now.Sub(waitStart); wait > remaining {
+			wait = remaining
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if waited := time.Since(waitStart); waited > time.Millisecond {
+		metrics.WriteBudgetDelaySeconds.Observe(waited.Seconds())
+		logger.V(4).Infof("Bulk write of %d bytes waited %d ms for the write budget.", bytes, waited.Milliseconds())
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_acquireWriteBudget(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.WriteBudgetBytes, config.Cfg.WriteBudgetIntervalMS, config.Cfg.WriteBudgetMaxDelayMS = 100, 200, 5000
+	writeBudget.Lock()
+	writeBudget.start, writeBudget.used = time.Time{}, 0
+	writeBudget.Unlock()
+	bulk := WithLane(context.Background(), BulkLane)
+	bulkBytes := metrics.WriteBudgetBytes.WithLabelValues("bulk")
+	before := testutil.ToFloat64(bulkBytes)
+
+	// Starts in an interval with room for the writes.
+	for time.Now().Sub(time.Now().Truncate(200*time.Millisecond)) > 50*time.Millisecond {
+		time.Sleep(5 * time.Millisecond)
+	}
+	start := time.Now()
+	assert.NoError(t, acquireWriteBudget(bulk, strings.Repeat("a", 150)), "Larger than the budget, but alone.")
+	assert.NoError(t, acquireWriteBudget(context.Background(), strings.Repeat("a", 50)), "Deltas aren't delayed.")
+	assert.Less(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	assert.Equal(t, before+150, testutil.ToFloat64(bulkBytes))
+
+	assert.NoError(t, acquireWriteBudget(bulk, strings.Repeat("a", 10)))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond), "Waits for the next interval.")
+	assert.GreaterOrEqual(t, testutil.ToFloat64(metrics.WriteBudgetUtilization), 2.0, "The deltas exceeded it.")
+
+	config.Cfg.WriteBudgetIntervalMS, config.Cfg.WriteBudgetMaxDelayMS = 60000, 50
+	writeBudget.Lock()
+	writeBudget.start, writeBudget.used = time.Now(), 100
+	writeBudget.Unlock()
+	start = time.Now()
+	assert.NoError(t, acquireWriteBudget(bulk, "a"))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "Runs anyway after WRITE_BUDGET_MAX_DELAY_MS.")
+
+	ctx, cancel := context.WithCancel(bulk)
+	cancel()
+	assert.Error(t, acquireWriteBudget(ctx, "a"))
+}
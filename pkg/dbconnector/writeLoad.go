@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const writeLoadWindow = 10 // Seconds of queries the write load is measured over.
+
+// Load of the primary graph over the last seconds, for the background jobs to yield to the syncs.
+type WriteLoad struct {
+	WriteQPS  float64 `json:"writeQPS"`  // Write queries per second.
+	LatencyMS float64 `json:"latencyMS"` // Mean duration of the queries, reads and writes.
+	Queries   int     `json:"queries"`   // Queries measured, the latency is 0 without any.
+}
+
+// Queries of a second of the window.
+type loadBucket struct {
+	second   int64
+	queries  int
+	writes   int
+	duration time.Duration
+}
+
+var (
+	loadBuckets [writeLoadWindow]loadBucket
+	loadMutex   = sync.Mutex{}
+)
+
+type untrackedLoadKey struct{}
+
+// Returns a context for queries left out of the write load, e.g. the ones of the job checking it.
+func WithoutWriteLoad(ctx context.Context) context.Context {
+	return context.WithValue(ctx, untrackedLoadKey{}, true)
+}
+
+// Adds a query on the primary graph to the write load.
+func observeWriteLoad(ctx context.Context, start time.Time) {
+	if untracked, _ := ctx.Value(untrackedLoadKey{}).(bool); untracked {
+		return
+	}
+	now := time.Now()
+	loadMutex.Lock()
+	defer loadMutex.Unlock()
+	bucket := &loadBuckets[now.Unix()%writeLoadWindow]
+	if bucket.second != now.Unix() {
+		*bucket = loadBucket{second: now.Unix()}
+	}
+	bucket.queries++
+	bucket.duration += now.Sub(start)
+	if isWriteContext(ctx) {
+		bucket.writes++
+	}
+}
+
+// Returns the load of the primary graph over the last writeLoadWindow seconds.
+func CurrentWriteLoad() WriteLoad {
+	now := time.Now().Unix()
+	loadMutex.Lock()
+	defer loadMutex.Unlock()
+	load := WriteLoad{}
+	writes, duration := 0, time.Duration(0)
+	for _, bucket := range loadBuckets {
+		if now-bucket.second >= writeLoadWindow {
+			continue // Stale, no query in that second.
+		}
+		load.Queries += bucket.queries
+		writes += bucket.writes
+		duration += bucket.duration
+	}
+	load.WriteQPS = float64(writes) / writeLoadWindow
+	if load.Queries > 0 {
+		load.LatencyMS = float64(duration/time.Microsecond) / float64(load.Queries) / 1000
+	}
+	return load
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrentWriteLoad(t *testing.T) {
+	loadMutex.Lock()
+	prevBuckets := loadBuckets
+	loadBuckets = [writeLoadWindow]loadBucket{}
+	loadMutex.Unlock()
+	defer func() {
+		loadMutex.Lock()
+		loadBuckets = prevBuckets
+		loadMutex.Unlock()
+	}()
+	ctx := context.Background()
+
+	assert.Equal(t, WriteLoad{}, CurrentWriteLoad())
+
+	start := time.Now().Add(-20 * time.Millisecond)
+	observeWriteLoad(WithWrite(ctx), start)
+	observeWriteLoad(WithWrite(ctx), start)
+	observeWriteLoad(ctx, start)
+	observeWriteLoad(WithoutWriteLoad(WithWrite(ctx)), start.Add(-time.Second))
+
+	load := CurrentWriteLoad()
+	assert.Equal(t, 3, load.Queries)
+	assert.InDelta(t, 2.0/writeLoadWindow, load.WriteQPS, 0.001)
+	assert.GreaterOrEqual(t, load.LatencyMS, 20.0)
+	assert.Less(t, load.LatencyMS, 1000.0, "The untracked query is left out")
+
+	// The queries older than the window are gone.
+	loadMutex.Lock()
+	for i := range loadBuckets {
+		loadBuckets[i].second -= writeLoadWindow
+	}
+	loadMutex.Unlock()
+	assert.Equal(t, WriteLoad{}, CurrentWriteLoad())
+}
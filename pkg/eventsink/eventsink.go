@@ -0,0 +1,261 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package eventsink publishes the changes applied to the graph to a message broker, so other systems can build their
+// own view of the resources without polling the graph. Events are JSON, one message each.
+package eventsink
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/nats-io/nats.go"
+)
+
+// Operations of the events.
+const (
+	NodeAdded   = "nodeAdded"
+	NodeUpdated = "nodeUpdated"
+	NodeDeleted = "nodeDeleted"
+	EdgeAdded   = "edgeAdded"
+	EdgeDeleted = "edgeDeleted"
+)
+
+const defaultTimeout = 10 * time.Second // Timeout of a publish when the context has no deadline.
+
+// A change applied to the graph. Node events have the UID, edge events the source, type and destination.
+type Event struct {
+	Sequence   int64                  `json:"sequence"` // Increases with each event, a gap means events were dropped.
+	Op         string                 `json:"op"`
+	Cluster    string                 `json:"cluster"`
+	RequestId  int                    `json:"requestId,omitempty"` // Request id of the sync that made the change.
+	Time       time.Time              `json:"time"`
+	UID        string                 `json:"uid,omitempty"`
+	Kind       string                 `json:"kind,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"` // All the properties of added and updated nodes.
+	SourceUID  string                 `json:"sourceUID,omitempty"`
+	EdgeType   string                 `json:"edgeType,omitempty"`
+	DestUID    string                 `json:"destUID,omitempty"`
+}
+
+// Key of the event, the UID of the node or the source of the edge, so the events of a resource keep their order.
+func (e Event) Key() string {
+	if e.UID != "" {
+		return e.UID
+	}
+	return e.SourceUID
+}
+
+// Where the events are published. Publish returns once the broker acknowledged all the events, or an error when
+// some of them may not have been received and the batch has to be published again.
+type Sink interface {
+	Publish(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// How to connect to the brokers of a sink. TLS is used when it's set or with a CA or client certificate.
+type Options struct {
+	TLS       bool
+	CAFile    string // PEM bundle verifying the certificate of the brokers, the system roots when empty.
+	CertFile  string // PEM client certificate, with KeyFile.
+	KeyFile   string
+	User      string // SASL/PLAIN with Kafka.
+	Password  string
+	CredsFile string // NATS credentials file, with the JWT and NKey seed of the user.
+}
+
+// Returns the TLS configuration of the options, nil without TLS.
+func (o Options) tlsConfig() (*tls.Config, error) {
+	if !o.TLS && o.CAFile == "" && o.CertFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.CAFile != "" {
+		bundle, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("No certificate found in the event sink CA file %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Returns the sink at the location: kafka://broker1:9092,broker2:9092/topic or nats://host:4222/subject.
+func New(location string, options Options) (Sink, error) {
+	scheme, address, target := parseLocation(location)
+	if address == "" || target == "" {
+		return nil, fmt.Errorf("Expected kafka://brokers/topic or nats://host:port/subject, got %q", location)
+	}
+	tlsConfig, err := options.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	switch scheme {
+	case "kafka":
+		if options.CredsFile != "" {
+			return nil, errors.New("A NATS credentials file can't be used with Kafka, set the user and password")
+		}
+		producerConfig := sarama.NewConfig()
+		producerConfig.ClientID = "search-aggregator"
+		producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+		producerConfig.Producer.Return.Successes = true
+		if tlsConfig != nil {
+			producerConfig.Net.TLS.Enable, producerConfig.Net.TLS.Config = true, tlsConfig
+		}
+		if options.User != "" {
+			producerConfig.Net.SASL.Enable = true
+			producerConfig.Net.SASL.User, producerConfig.Net.SASL.Password = options.User, options.Password
+		}
+		producer, err := sarama.NewSyncProducer(strings.Split(address, ","), producerConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &kafkaSink{producer: producer, topic: target}, nil
+	case "nats":
+		natsOptions := []nats.Option{nats.Name("search-aggregator")}
+		if tlsConfig != nil {
+			natsOptions = append(natsOptions, nats.Secure(tlsConfig))
+		}
+		if options.User != "" {
+			natsOptions = append(natsOptions, nats.UserInfo(options.User, options.Password))
+		}
+		if options.CredsFile != "" {
+			natsOptions = append(natsOptions, nats.UserCredentials(options.CredsFile))
+		}
+		return &natsSink{address: address, subject: target, options: natsOptions}, nil
+	}
+	return nil, fmt.Errorf("Unsupported event sink %q, expected kafka:// or nats://", location)
+}
+
+// Splits scheme://address/target.
+func parseLocation(location string) (string, string, string) {
+	parts := strings.SplitN(location, "://", 2)
+	if len(parts) != 2 {
+		return "", "", ""
+	}
+	address, target := parts[1], ""
+	if i := strings.Index(address, "/"); i >= 0 {
+		address, target = address[:i], strings.Trim(address[i+1:], "/")
+	}
+	return parts[0], address, target
+}
+
+// Publishes each event as a message keyed by the resource, acknowledged by all the in-sync replicas.
+type kafkaSink struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func (k *kafkaSink) Publish(ctx context.Context, events []Event) error {
+	messages := make([]*sarama.ProducerMessage, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, &sarama.ProducerMessage{Topic: k.topic, Key: sarama.StringEncoder(event.Key()),
+			Value: sarama.ByteEncoder(value)})
+	}
+	return k.producer.SendMessages(messages)
+}
+
+func (k *kafkaSink) Close() error {
+	return k.producer.Close()
+}
+
+// Publishes each event to a JetStream stream, then waits for the publish acks: the stream stored the events once they
+// all came back. The subject has to be bound to a stream. The sequence of each event is its message id, so the stream
+// drops the events of a batch published again within its duplicate window.
+type natsSink struct {
+	address string
+	subject string
+	options []nats.Option
+	mutex   sync.Mutex
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+}
+
+func (n *natsSink) Publish(ctx context.Context, events []Event) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
+	if n.conn == nil || n.conn.IsClosed() {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	acks := make([]nats.PubAckFuture, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msg := nats.NewMsg(n.subject)
+		msg.Data = value
+		ack, err := n.js.PublishMsgAsync(msg, nats.MsgId(strconv.FormatInt(event.Sequence, 10)))
+		if err != nil {
+			return err
+		}
+		acks = append(acks, ack)
+	}
+	for _, ack := range acks {
+		select {
+		case <-ack.Ok():
+		case err := <-ack.Err():
+			return fmt.Errorf("NATS server %s: %w", n.address, err)
+		case <-ctx.Done():
+			return fmt.Errorf("Timed out waiting for the acks of NATS server %s: %w", n.address, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Connects to the server, the client reconnects by itself after that.
+func (n *natsSink) connect(ctx context.Context) error {
+	deadline, _ := ctx.Deadline()
+	conn, err := nats.Connect("nats://"+n.address, append(n.options, nats.Timeout(time.Until(deadline)))...)
+	if err != nil {
+		return err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn, n.js = conn, js
+	return nil
+}
+
+func (n *natsSink) Close() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.js = nil, nil
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	for _, location := range []string{"", "kafka://", "kafka://localhost:9092", "nats://localhost:4222/",
+		"amqp://localhost/queue"} {
+		_, err := New(location, Options{})
+		assert.Error(t, err, location)
+	}
+	_, err := New("nats://localhost:4222/search.changes", Options{CAFile: "missing.pem"})
+	assert.Error(t, err)
+	_, err = New("kafka://localhost:9092/search-changes", Options{CredsFile: "user.creds"})
+	assert.Error(t, err)
+	sink, err := New("nats://localhost:4222/search.changes", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:4222", sink.(*natsSink).address)
+	assert.Equal(t, "search.changes", sink.(*natsSink).subject)
+
+	scheme, address, target := parseLocation("kafka://broker1:9092,broker2:9092/search-changes/")
+	assert.Equal(t, []string{"kafka", "broker1:9092,broker2:9092", "search-changes"}, []string{scheme, address, target})
+}
+
+func TestEventKey(t *testing.T) {
+	assert.Equal(t, "local-cluster/pod-1", Event{Op: NodeAdded, UID: "local-cluster/pod-1"}.Key())
+	assert.Equal(t, "local-cluster/rs-1", Event{Op: EdgeAdded, SourceUID: "local-cluster/rs-1",
+		EdgeType: "ownedBy", DestUID: "local-cluster/deploy-1"}.Key())
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	sink := &kafkaSink{producer: producer, topic: "search-changes"}
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		var event Event
+		if err := json.Unmarshal(value, &event); err != nil || event.UID != "c1/pod-1" {
+			return errors.New("unexpected event " + string(value))
+		}
+		return nil
+	})
+	producer.ExpectSendMessageAndSucceed()
+	assert.NoError(t, sink.Publish(context.Background(), []Event{
+		{Sequence: 1, Op: NodeAdded, Cluster: "c1", UID: "c1/pod-1", Kind: "Pod"},
+		{Sequence: 2, Op: EdgeAdded, Cluster: "c1", SourceUID: "c1/pod-1", EdgeType: "runsOn", DestUID: "c1/node-1"},
+	}))
+
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	assert.Error(t, sink.Publish(context.Background(), []Event{{Sequence: 3, Op: NodeDeleted, UID: "c1/pod-1"}}))
+	assert.NoError(t, sink.Close())
+}
+
+// Runs a NATS server with JetStream, requiring the user and password, and a stream on the search.> subjects.
+func natsServer(t *testing.T) (string, nats.JetStreamContext) {
+	options := natsserver.DefaultTestOptions
+	options.Port, options.JetStream, options.StoreDir = -1, true, t.TempDir()
+	options.Username, options.Password = "search", "secret"
+	server := natsserver.RunServer(&options)
+	t.Cleanup(server.Shutdown)
+
+	conn, err := nats.Connect(server.ClientURL(), nats.UserInfo("search", "secret"))
+	assert.NoError(t, err)
+	t.Cleanup(conn.Close)
+	js, err := conn.JetStream()
+	assert.NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "SEARCH", Subjects: []string{"search.>"}})
+	assert.NoError(t, err)
+	return server.Addr().String(), js
+}
+
+func TestNATSSink(t *testing.T) {
+	address, js := natsServer(t)
+	sink, err := New("nats://"+address+"/search.changes", Options{User: "search", Password: "secret"})
+	assert.NoError(t, err)
+	defer sink.Close()
+
+	events := []Event{{Sequence: 1, Op: NodeAdded, Cluster: "c1", UID: "c1/pod-1"},
+		{Sequence: 2, Op: NodeDeleted, Cluster: "c1", UID: "c1/pod-2"}}
+	assert.NoError(t, sink.Publish(context.Background(), events))
+	stream, err := js.StreamInfo("SEARCH")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), stream.State.Msgs, "The stream stored the events before the acks.")
+	msg, err := js.GetMsg("SEARCH", 1)
+	assert.NoError(t, err)
+	var event Event
+	assert.NoError(t, json.Unmarshal(msg.Data, &event))
+	assert.Equal(t, "c1/pod-1", event.UID)
+
+	// The batch published again after an error is dropped by the stream.
+	assert.NoError(t, sink.Publish(context.Background(), events))
+	stream, err = js.StreamInfo("SEARCH")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), stream.State.Msgs)
+
+	// The connection is opened again after it's closed.
+	sink.(*natsSink).conn.Close()
+	assert.NoError(t, sink.Publish(context.Background(), []Event{{Sequence: 3, Op: NodeDeleted, UID: "c1/pod-1"}}))
+
+	// Subjects without a stream aren't acknowledged, and the user is authenticated.
+	unbound, err := New("nats://"+address+"/other.changes", Options{User: "search", Password: "secret"})
+	assert.NoError(t, err)
+	defer unbound.Close()
+	assert.Error(t, unbound.Publish(context.Background(), events))
+	unauthorized, err := New("nats://"+address+"/search.changes", Options{User: "search", Password: "wrong"})
+	assert.NoError(t, err)
+	defer unauthorized.Close()
+	assert.Error(t, unauthorized.Publish(context.Background(), events))
+}
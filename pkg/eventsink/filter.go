@@ -0,0 +1,212 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package eventsink
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Property names allowed in a filter.
+var filterPropertyRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Operators supported as a prefix of a filter value, as in the searches, longest first so ">=" is matched before ">".
+// ~ matches a regular expression, ! and != exclude a value and !~ a regular expression.
+var filterOperators = []string{">=", "<=", "!=", "!~", ">", "<", "=", "~", "!"}
+
+// Property filters the events are matched against before they're published, in the syntax of the searches, e.g.
+// "kind:pod status:Failed,Pending". The filters are AND'd. The values of a filter are OR'd, except the excluded ones
+// which are AND'd. An empty Filter matches every event.
+type Filter []propertyFilter
+
+type propertyFilter struct {
+	property string
+	values   []filterValue
+}
+
+type filterValue struct {
+	operator string // One of =, !=, ~, !~, >, >=, < and <=.
+	value    string
+	number   float64        // Operand of the comparisons.
+	regex    *regexp.Regexp // Operand of ~ and !~.
+}
+
+// Parses the filters, e.g. "kind:pod namespace:!kube-system". Returns an empty Filter for an empty string.
+func ParseFilter(filter string) (Filter, error) {
+	parsed := Filter{}
+	for _, token := range strings.Fields(filter) {
+		i := strings.Index(token, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("Expected property:value in the event filter, got %q", token)
+		}
+		property := token[:i]
+		if !filterPropertyRegex.MatchString(property) {
+			return nil, fmt.Errorf("Invalid property name in the event filter: %s", property)
+		}
+		f := propertyFilter{property: property}
+		for _, value := range strings.Split(token[i+1:], ",") {
+			if value == "" {
+				continue
+			}
+			v, err := parseFilterValue(property, value)
+			if err != nil {
+				return nil, err
+			}
+			f.values = append(f.values, v)
+		}
+		if len(f.values) == 0 {
+			return nil, fmt.Errorf("Event filter %s must have at least one value", property)
+		}
+		parsed = append(parsed, f)
+	}
+	return parsed, nil
+}
+
+func parseFilterValue(property, value string) (filterValue, error) {
+	v := filterValue{operator: "="}
+	for _, op := range filterOperators {
+		if strings.HasPrefix(value, op) {
+			v.operator, value = op, value[len(op):]
+			break
+		}
+	}
+	if v.operator == "!" {
+		v.operator = "!="
+	}
+	if value == "" {
+		return v, fmt.Errorf("Event filter %s is missing a value", property)
+	}
+	v.value = value
+	var err error
+	switch v.operator {
+	case "~", "!~":
+		if v.regex, err = regexp.Compile(value); err != nil {
+			return v, fmt.Errorf("Invalid regular expression in event filter %s: %s", property, err)
+		}
+	case ">", ">=", "<", "<=":
+		if v.number, err = strconv.ParseFloat(value, 64); err != nil {
+			return v, fmt.Errorf("Event filter %s compares with %s, expected a number", property, value)
+		}
+	}
+	return v, nil
+}
+
+// Returns true when the event matches all the filters. An event without a property doesn't match its filter, even
+// with excluded values.
+func (f Filter) Match(event Event) bool {
+	for _, filter := range f {
+		value, ok := event.property(filter.property)
+		if !ok || !filter.match(value, filter.property == "kind") {
+			return false
+		}
+	}
+	return true
+}
+
+func (f propertyFilter) match(value interface{}, ignoreCase bool) bool {
+	matched, included := false, false
+	for _, v := range f.values {
+		switch v.operator {
+		case "!=":
+			if v.equal(value, ignoreCase) {
+				return false
+			}
+		case "!~":
+			if v.matchRegex(value) {
+				return false
+			}
+		default:
+			included = true
+			matched = matched || v.match(value, ignoreCase)
+		}
+	}
+	return matched || !included
+}
+
+func (v filterValue) match(value interface{}, ignoreCase bool) bool {
+	switch v.operator {
+	case "=":
+		return v.equal(value, ignoreCase)
+	case "~":
+		return v.matchRegex(value)
+	}
+	number, ok := filterNumber(value)
+	if !ok {
+		return false
+	}
+	switch v.operator {
+	case ">":
+		return number > v.number
+	case ">=":
+		return number >= v.number
+	case "<":
+		return number < v.number
+	}
+	return number <= v.number
+}
+
+// Returns true when the value, one of the values of a list, or a key=value of a map like the labels, is the operand.
+func (v filterValue) equal(value interface{}, ignoreCase bool) bool {
+	for _, s := range filterStrings(value) {
+		if s == v.value || (ignoreCase && strings.EqualFold(s, v.value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Only the strings match a regular expression, as in the searches.
+func (v filterValue) matchRegex(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && v.regex.MatchString(s)
+}
+
+func filterStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case map[string]interface{}:
+		values := make([]string, 0, len(v))
+		for key, item := range v {
+			values = append(values, key+"="+fmt.Sprint(item))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+func filterNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// Returns the value of a property of the event for the filters: op, cluster, kind, uid, edgeType, sourceUID and
+// destUID, then the properties of added and updated nodes.
+func (e Event) property(name string) (interface{}, bool) {
+	field := map[string]string{"op": e.Op, "cluster": e.Cluster, "kind": e.Kind, "uid": e.UID, "edgeType": e.EdgeType,
+		"sourceUID": e.SourceUID, "destUID": e.DestUID}[name]
+	if field != "" {
+		return field, true
+	}
+	value, ok := e.Properties[name]
+	return value, ok && value != nil
+}
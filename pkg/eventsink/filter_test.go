@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package eventsink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("")
+	assert.NoError(t, err)
+	assert.Empty(t, filter)
+	filter, err = ParseFilter("kind:pod namespace:!kube-system,!openshift restarts:>=3,")
+	assert.NoError(t, err)
+	assert.Len(t, filter, 3)
+	assert.Equal(t, []filterValue{{operator: "!=", value: "kube-system"}, {operator: "!=", value: "openshift"}},
+		filter[1].values)
+	assert.Equal(t, filterValue{operator: ">=", value: "3", number: 3}, filter[2].values[0])
+
+	for _, invalid := range []string{"nginx", "kind:", "n.kind:pod", "name:~[", "restarts:>many", "name:!"} {
+		_, err = ParseFilter(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	pod := Event{Op: NodeUpdated, Cluster: "c1", UID: "c1/pod-1", Kind: "Pod", Properties: map[string]interface{}{
+		"kind": "Pod", "name": "web-1", "namespace": "default", "restarts": int64(4), "label": map[string]interface{}{
+			"app": "web"}, "container": []interface{}{"nginx", "sidecar"}}}
+	deleted := Event{Op: NodeDeleted, Cluster: "c1", UID: "c1/pod-2", Kind: "Pod"}
+	edge := Event{Op: EdgeAdded, Cluster: "c2", SourceUID: "c2/pod-1", EdgeType: "runsOn", DestUID: "c2/node-1"}
+
+	tests := []struct {
+		filter  string
+		matched []bool // pod, deleted, edge
+	}{
+		{"", []bool{true, true, true}},
+		{"kind:pod", []bool{true, true, false}},
+		{"kind:pod op:nodeUpdated", []bool{true, false, false}},
+		{"cluster:c1,c3", []bool{true, true, false}},
+		{"cluster:!c1", []bool{false, false, true}},
+		{"namespace:!kube-system", []bool{true, false, false}}, // Without the property, the event doesn't match.
+		{"name:~^web-", []bool{true, false, false}},
+		{"name:!~^web-", []bool{false, false, false}},
+		{"restarts:>3", []bool{true, false, false}},
+		{"restarts:<=3", []bool{false, false, false}},
+		{"label:app=web", []bool{true, false, false}},
+		{"container:nginx", []bool{true, false, false}},
+		{"edgeType:runsOn", []bool{false, false, true}},
+		{"namespace:default,!default", []bool{false, false, false}},
+	}
+	for _, test := range tests {
+		filter, err := ParseFilter(test.filter)
+		assert.NoError(t, err, test.filter)
+		matched := []bool{filter.Match(pod), filter.Match(deleted), filter.Match(edge)}
+		assert.Equal(t, test.matched, matched, test.filter)
+	}
+}
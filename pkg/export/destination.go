@@ -0,0 +1,99 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Where the exported files are written.
+type Destination interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
+// Returns the destination for the output: a directory, e.g. a mounted volume, or s3://bucket/prefix.
+// S3 credentials and region are read from the AWS environment variables, the endpoint is for S3 compatible stores.
+func NewDestination(output string, s3Endpoint string) (Destination, error) {
+	if output == "" {
+		return nil, fmt.Errorf("An output directory or s3://bucket/prefix is required")
+	}
+	if !strings.HasPrefix(output, "s3://") {
+		return directory(output), nil
+	}
+	bucket := strings.TrimPrefix(output, "s3://")
+	prefix := ""
+	if i := strings.Index(bucket, "/"); i >= 0 {
+		bucket, prefix = bucket[:i], strings.Trim(bucket[i+1:], "/")
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("Missing bucket in %s", output)
+	}
+	awsConfig := aws.NewConfig()
+	if s3Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(s3Endpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Bucket{uploader: s3manager.NewUploader(sess), bucket: bucket, prefix: prefix}, nil
+}
+
+type directory string
+
+func (d directory) Create(name string) (io.WriteCloser, error) {
+	file := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Clean(file))
+}
+
+type s3Bucket struct {
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+// Streams the file to S3 while it's written, the upload completes on Close.
+func (b *s3Bucket) Create(name string) (io.WriteCloser, error) {
+	reader, writer := io.Pipe()
+	upload := &s3Upload{writer: writer, done: make(chan error, 1)}
+	go func() {
+		_, err := b.uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(path.Join(b.prefix, name)),
+			Body:   reader,
+		})
+		_ = reader.CloseWithError(err) // Unblocks the writes when the upload fails.
+		upload.done <- err
+	}()
+	return upload, nil
+}
+
+type s3Upload struct {
+	writer *io.PipeWriter
+	done   chan error
+}
+
+func (u *s3Upload) Write(p []byte) (int, error) {
+	return u.writer.Write(p)
+}
+
+func (u *s3Upload) Close() error {
+	_ = u.writer.Close()
+	return <-u.done
+}
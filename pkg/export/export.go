@@ -0,0 +1,200 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package export dumps the nodes and edges of the graph to CSV or Parquet files, in a directory or S3 bucket,
+// for offline analytics. Used by the export subcommand.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Columns of the exported tables.
+var (
+	NodeColumns = []string{"cluster", "kind", "uid", "name", "namespace", "created", "properties"}
+	EdgeColumns = []string{"sourceUid", "sourceKind", "sourceCluster", "type", "destUid", "destKind", "destCluster"}
+)
+
+// Properties written in their own column, the others are in the properties column as a JSON object.
+var nodeColumnProperties = map[string]bool{
+	"cluster": true, "kind": true, "_uid": true, "name": true, "namespace": true, "created": true,
+}
+
+// Settings of an export.
+type Options struct {
+	Format      string // csv or parquet
+	Cluster     string // Only the resources of the cluster, every cluster when empty.
+	Destination Destination
+}
+
+// Stats of an export.
+type Stats struct {
+	Nodes int
+	Edges int
+	Files []string
+}
+
+// Writes the rows of a table in a format. The nil values are the properties that aren't set, null in Parquet and
+// empty in CSV.
+type tableWriter interface {
+	WriteRow(values []*string) error
+	Close() error
+}
+
+func newTableWriter(format string, out io.Writer, columns []string) (tableWriter, error) {
+	switch format {
+	case "csv":
+		return newCSVWriter(out, columns)
+	case "parquet":
+		return newParquetWriter(out, columns)
+	}
+	return nil, fmt.Errorf("Unknown export format %q, expected csv or parquet", format)
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVWriter(out io.Writer, columns []string) (*csvWriter, error) {
+	w := &csvWriter{writer: csv.NewWriter(out)}
+	return w, w.writer.Write(columns)
+}
+
+func (w *csvWriter) WriteRow(values []*string) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		if value != nil {
+			record[i] = *value
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// Exports the nodes and edges to the nodes and edges files, e.g. <scope>-20210601T100000Z/nodes.parquet
+// The scope is the cluster name, or fleet for every cluster.
+func Run(ctx context.Context, options Options, now time.Time) (Stats, error) {
+	stats := Stats{}
+	if options.Format != "csv" && options.Format != "parquet" {
+		return stats, fmt.Errorf("Unknown export format %q, expected csv or parquet", options.Format)
+	}
+	scope := options.Cluster
+	if scope == "" {
+		scope = "fleet"
+	}
+	prefix := scope + "-" + now.UTC().Format("20060102T150405Z") + "/"
+
+	nodesFile := prefix + "nodes." + options.Format
+	err := exportTable(options, nodesFile, NodeColumns, func(table tableWriter) (err error) {
+		stats.Nodes, err = db.ExportNodes(ctx, options.Cluster, func(properties map[string]interface{}) error {
+			return table.WriteRow(nodeRow(properties))
+		})
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+	stats.Files = append(stats.Files, nodesFile)
+
+	edgesFile := prefix + "edges." + options.Format
+	err = exportTable(options, edgesFile, EdgeColumns, func(table tableWriter) (err error) {
+		stats.Edges, err = db.ExportEdges(ctx, options.Cluster, func(e db.ExportEdge) error {
+			// The UIDs, kinds and types are never empty, an empty cluster is the Cluster node without one.
+			return table.WriteRow([]*string{&e.SourceUID, &e.SourceKind, optionalValue(e.SourceCluster), &e.EdgeType,
+				&e.DestUID, &e.DestKind, optionalValue(e.DestCluster)})
+		})
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+	stats.Files = append(stats.Files, edgesFile)
+	return stats, nil
+}
+
+// Creates the file in the destination and writes the table with the rows written by write.
+func exportTable(options Options, name string, columns []string, write func(table tableWriter) error) error {
+	file, err := options.Destination.Create(name)
+	if err != nil {
+		return err
+	}
+	table, err := newTableWriter(options.Format, file, columns)
+	if err == nil {
+		err = write(table)
+	}
+	if err == nil {
+		err = table.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Error exporting %s: %w", name, err)
+	}
+	return nil
+}
+
+// Returns the values of the node columns for the properties of a node, nil for the properties that aren't set.
+func nodeRow(properties map[string]interface{}) []*string {
+	rest := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		if !nodeColumnProperties[key] && !strings.HasPrefix(key, "_") { // Internal properties aren't exported.
+			rest[key] = value
+		}
+	}
+	var extra *string
+	if len(rest) > 0 {
+		encoded, err := json.Marshal(rest) // Keys are sorted.
+		if err == nil {
+			extra = optionalValue(string(encoded))
+		}
+	}
+	row := make([]*string, 0, len(NodeColumns))
+	for _, property := range []string{"cluster", "kind", "_uid", "name", "namespace", "created"} {
+		var value *string
+		if properties[property] != nil { // A property set to "" stays empty.
+			s := valueString(properties[property])
+			value = &s
+		}
+		row = append(row, value)
+	}
+	return append(row, extra)
+}
+
+// Returns the value, nil when it's empty.
+func optionalValue(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, valueString(item))
+		}
+		sort.Strings(values)
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func useExportGraph(t *testing.T) {
+	t.Cleanup(db.UseTestDatastore())
+
+	_, err := db.Store.Query(context.Background(), "CREATE (c:Cluster {_uid:'cluster__c1', name:'c1', kind:'cluster'}), "+
+		"(:Pod {_uid:'c1/a', cluster:'c1', kind:'pod', name:'a', namespace:'default', restarts:2, _rbac:'x'})"+
+		"-[:inCluster]->(c), (:Pod {_uid:'c2/a', cluster:'c2', kind:'pod', name:'a'})")
+	assert.Nil(t, err)
+}
+
+func TestRun_csv(t *testing.T) {
+	useExportGraph(t)
+	dir := t.TempDir()
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	stats, err := Run(context.Background(), Options{Format: "csv", Cluster: "c1", Destination: directory(dir)}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Nodes: 1, Edges: 1, Files: []string{"c1-20210601T100000Z/nodes.csv",
+		"c1-20210601T100000Z/edges.csv"}}, stats)
+
+	nodes, err := ioutil.ReadFile(filepath.Join(dir, "c1-20210601T100000Z", "nodes.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster,kind,uid,name,namespace,created,properties\n"+
+		"c1,pod,c1/a,a,default,,\"{\"\"restarts\"\":2}\"\n", string(nodes))
+	edges, err := ioutil.ReadFile(filepath.Join(dir, "c1-20210601T100000Z", "edges.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sourceUid,sourceKind,sourceCluster,type,destUid,destKind,destCluster\n"+
+		"c1/a,pod,c1,inCluster,cluster__c1,cluster,\n", string(edges))
+
+	_, err = Run(context.Background(), Options{Format: "xml", Destination: directory(dir)}, now)
+	assert.Error(t, err)
+}
+
+func TestNodeRow(t *testing.T) {
+	row := nodeRow(map[string]interface{}{"kind": "pod", "_uid": "c1/a", "name": "a", "namespace": "", "_rbac": "x"})
+	assert.Equal(t, 7, len(row))
+	assert.Nil(t, row[0], "cluster")
+	assert.Equal(t, "pod", *row[1])
+	assert.Equal(t, "", *row[4], "namespace")
+	assert.Nil(t, row[5], "created")
+	assert.Nil(t, row[6], "properties")
+}
+
+func TestParquetWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := newParquetWriter(&out, []string{"name", "kind"})
+	assert.NoError(t, err)
+	name, pod, empty := "a", "pod", ""
+	assert.NoError(t, w.WriteRow([]*string{&name, &pod}))
+	assert.NoError(t, w.WriteRow([]*string{nil, &pod}))
+	assert.NoError(t, w.WriteRow([]*string{&empty, nil}))
+	assert.NoError(t, w.Close())
+
+	file, err := buffer.NewBufferFile(out.Bytes())
+	assert.NoError(t, err)
+	r, err := reader.NewParquetColumnReader(file, 1)
+	assert.NoError(t, err)
+	defer r.ReadStop()
+	assert.Equal(t, int64(3), r.GetNumRows())
+	assert.Equal(t, 3, len(r.Footer.Schema))
+	assert.Equal(t, "name", r.SchemaHandler.GetExName(1)) // The reader renames the columns in the footer.
+	assert.Equal(t, "kind", r.SchemaHandler.GetExName(2))
+
+	names, _, _, err := r.ReadColumnByIndex(0, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", nil, ""}, names)
+	kinds, _, _, err := r.ReadColumnByIndex(1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"pod", "pod", nil}, kinds)
+}
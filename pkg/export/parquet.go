@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package export
+
+import (
+	"io"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Bytes of rows buffered in memory for each row group of a Parquet file.
+const parquetRowGroupBytes = 64 * 1024 * 1024
+
+// Writes the rows as a Parquet file with an optional UTF8 column for each of the columns, the nil values are null.
+// The pages are compressed with Snappy.
+type parquetWriter struct {
+	writer *writer.CSVWriter
+}
+
+func newParquetWriter(out io.Writer, columns []string) (*parquetWriter, error) {
+	schema := make([]string, len(columns))
+	for i, column := range columns {
+		schema[i] = "name=" + column + ", type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"
+	}
+	w, err := writer.NewCSVWriterFromWriter(schema, out, 1)
+	if err != nil {
+		return nil, err
+	}
+	w.RowGroupSize = parquetRowGroupBytes
+	w.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &parquetWriter{writer: w}, nil
+}
+
+func (w *parquetWriter) WriteRow(values []*string) error {
+	return w.writer.WriteString(values)
+}
+
+// Writes the remaining rows and the footer with the schema and the row groups.
+func (w *parquetWriter) Close() error {
+	return w.writer.WriteStop()
+}
@@ -0,0 +1,321 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package generator produces synthetic clusters and their sync payloads at scale, for the load tests of the sync
+// handlers. The same options and seed always produce the same clusters.
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Share of each kind in the resources of a cluster when Options.Kinds is empty, close to a cluster running apps.
+var DefaultKinds = map[string]int{
+	"ConfigMap":  10,
+	"Deployment": 8,
+	"Namespace":  2,
+	"Node":       2,
+	"Pod":        50,
+	"ReplicaSet": 15,
+	"Secret":     5,
+	"Service":    8,
+}
+
+var kindRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// Types of the generated edges, with the kinds of their source and destination.
+var edgeRules = []struct {
+	edgeType, source, dest string
+}{
+	{"ownedBy", "Pod", "ReplicaSet"},
+	{"ownedBy", "ReplicaSet", "Deployment"},
+	{"attachedTo", "Pod", "ConfigMap"},
+	{"attachedTo", "Pod", "Secret"},
+	{"usedBy", "Service", "Pod"},
+	{"runsOn", "Pod", "Node"},
+}
+
+// Shape of the generated clusters.
+type Options struct {
+	Clusters int            // Number of clusters, 1 when 0.
+	Prefix   string         // Prefix of the cluster names, e.g. loadtest-1, loadtest-2. loadtest when empty.
+	Nodes    int            // Resources of each cluster.
+	Edges    int            // Edges of each cluster, fewer when there aren't enough resources of the kinds to link.
+	Kinds    map[string]int // Share of each kind in the resources, DefaultKinds when empty.
+	Seed     int64
+}
+
+// A synthetic cluster, kept up to date by the payloads generated for it.
+type Cluster struct {
+	Name      string
+	Resources []*db.Resource
+	Edges     []db.Edge
+	rand      *rand.Rand
+	kinds     []string // Kind of each new resource is picked from the kinds, repeated by their share.
+	next      int      // Number of the next resource, for its UID and name.
+	requestID int
+}
+
+// Body of a sync request, with the fields of the sync event of the aggregator.
+type Payload struct {
+	ClearAll        bool `json:"clearAll,omitempty"`
+	AddResources    []*db.Resource
+	UpdateResources []*db.Resource
+	DeleteResources []DeleteResource
+	AddEdges        []db.Edge
+	DeleteEdges     []db.Edge
+	RequestId       int
+	Epoch           int64
+}
+
+// A resource deleted by a payload.
+type DeleteResource struct {
+	UID string `json:"uid,omitempty"`
+}
+
+// Parses a kinds distribution, e.g. Pod=50,Deployment=10
+func ParseKinds(value string) (map[string]int, error) {
+	kinds := map[string]int{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		share, err := 1, error(nil)
+		if len(parts) == 2 {
+			share, err = strconv.Atoi(parts[1])
+		}
+		if err != nil || share <= 0 {
+			return nil, fmt.Errorf("invalid share of kind %s, it must be a positive number", parts[0])
+		}
+		if !kindRegex.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid kind %s", parts[0])
+		}
+		kinds[parts[0]] = share
+	}
+	return kinds, nil
+}
+
+// Returns the clusters of the options, with their resources and edges.
+func Generate(opts Options) []*Cluster {
+	count := opts.Clusters
+	if count <= 0 {
+		count = 1
+	}
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = "loadtest"
+	}
+	kinds := opts.Kinds
+	if len(kinds) == 0 {
+		kinds = DefaultKinds
+	}
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names) // The same seed picks the same kinds.
+	var weighted []string
+	for _, kind := range names {
+		for i := 0; i < kinds[kind]; i++ {
+			weighted = append(weighted, kind)
+		}
+	}
+
+	clusters := make([]*Cluster, 0, count)
+	for i := 1; i <= count; i++ {
+		c := &Cluster{Name: fmt.Sprintf("%s-%d", prefix, i), rand: rand.New(rand.NewSource(opts.Seed + int64(i))),
+			kinds: weighted}
+		for j := 0; j < opts.Nodes; j++ {
+			c.Resources = append(c.Resources, c.newResource())
+		}
+		c.Edges = c.newEdges(opts.Edges)
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
+
+// Returns a new resource of a kind picked by its share, with the properties the collector sends for the kind.
+func (c *Cluster) newResource() *db.Resource {
+	kind := c.kinds[c.rand.Intn(len(c.kinds))]
+	c.next++
+	name := fmt.Sprintf("%s-%d", strings.ToLower(kind), c.next)
+	created := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(c.next) * time.Second)
+	props := map[string]interface{}{
+		"kind":    kind,
+		"name":    name,
+		"created": created.Format(time.RFC3339),
+		"label":   []interface{}{"app=app-" + strconv.Itoa(c.rand.Intn(20))},
+	}
+	if kind != "Namespace" && kind != "Node" {
+		props["namespace"] = "ns-" + strconv.Itoa(c.rand.Intn(10))
+	}
+	switch kind {
+	case "Pod":
+		props["status"] = "Running"
+		props["restarts"] = int64(0)
+		props["container"] = []interface{}{"app", "sidecar"}
+	case "Deployment", "ReplicaSet":
+		props["desired"] = int64(1 + c.rand.Intn(5))
+		props["current"] = props["desired"]
+		props["apigroup"] = "apps"
+	case "Node":
+		props["cpu"] = int64(8)
+		props["role"] = []interface{}{"worker"}
+	}
+	return &db.Resource{Kind: kind, UID: fmt.Sprintf("%s/%08d", c.Name, c.next), Properties: props}
+}
+
+// Returns up to count new edges between the resources, each linking kinds of one of the edge rules.
+func (c *Cluster) newEdges(count int) []db.Edge {
+	byKind := c.resourcesByKind()
+	var rules []int // Rules with resources at both ends.
+	for i, rule := range edgeRules {
+		if len(byKind[rule.source]) > 0 && len(byKind[rule.dest]) > 0 {
+			rules = append(rules, i)
+		}
+	}
+	edges := []db.Edge{}
+	if len(rules) == 0 {
+		return edges
+	}
+	seen := c.edgeKeys()
+	for attempts := 0; len(edges) < count && attempts < 10*count; attempts++ {
+		rule := edgeRules[rules[c.rand.Intn(len(rules))]]
+		sources, dests := byKind[rule.source], byKind[rule.dest]
+		edge := db.Edge{SourceUID: sources[c.rand.Intn(len(sources))].UID,
+			DestUID: dests[c.rand.Intn(len(dests))].UID, EdgeType: rule.edgeType, SourceKind: rule.source,
+			DestKind: rule.dest}
+		if key := edgeKey(edge); !seen[key] {
+			seen[key] = true
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// Returns an edge from or to the resource, linking it to another resource by one of the edge rules, false when no
+// rule links its kind to the resources of the cluster.
+func (c *Cluster) linkResource(r *db.Resource, byKind map[string][]*db.Resource, seen map[string]bool) (db.Edge,
+	bool) {
+	for _, i := range c.rand.Perm(len(edgeRules)) {
+		rule := edgeRules[i]
+		var edge db.Edge
+		switch {
+		case rule.source == r.Kind && len(byKind[rule.dest]) > 0:
+			dests := byKind[rule.dest]
+			edge = db.Edge{SourceUID: r.UID, DestUID: dests[c.rand.Intn(len(dests))].UID}
+		case rule.dest == r.Kind && len(byKind[rule.source]) > 0:
+			sources := byKind[rule.source]
+			edge = db.Edge{SourceUID: sources[c.rand.Intn(len(sources))].UID, DestUID: r.UID}
+		default:
+			continue
+		}
+		edge.EdgeType, edge.SourceKind, edge.DestKind = rule.edgeType, rule.source, rule.dest
+		if key := edgeKey(edge); !seen[key] {
+			seen[key] = true
+			return edge, true
+		}
+	}
+	return db.Edge{}, false
+}
+
+func (c *Cluster) resourcesByKind() map[string][]*db.Resource {
+	byKind := map[string][]*db.Resource{}
+	for _, r := range c.Resources {
+		byKind[r.Kind] = append(byKind[r.Kind], r)
+	}
+	return byKind
+}
+
+func (c *Cluster) edgeKeys() map[string]bool {
+	seen := make(map[string]bool, len(c.Edges))
+	for _, e := range c.Edges {
+		seen[edgeKey(e)] = true
+	}
+	return seen
+}
+
+func edgeKey(e db.Edge) string {
+	return e.SourceUID + "-" + e.EdgeType + "->" + e.DestUID
+}
+
+// Returns the payload of a resync with every resource and edge of the cluster.
+func (c *Cluster) Resync() Payload {
+	c.requestID++
+	// Copies, the deltas change the resources and edges of the cluster.
+	resources := append([]*db.Resource{}, c.Resources...)
+	edges := append([]db.Edge{}, c.Edges...)
+	return Payload{ClearAll: true, AddResources: resources, AddEdges: edges, RequestId: c.requestID}
+}
+
+// Returns the payload of a delta changing the percent of the resources: most are updated, a tenth are deleted and
+// replaced by new ones with their edges. The cluster is updated with the changes.
+func (c *Cluster) Delta(percent int) Payload {
+	c.requestID++
+	payload := Payload{RequestId: c.requestID}
+	changed := len(c.Resources) * percent / 100
+	if changed == 0 && percent > 0 && len(c.Resources) > 0 {
+		changed = 1
+	}
+	deleted := changed / 10
+	order := c.rand.Perm(len(c.Resources))
+
+	removed := map[string]bool{}
+	for _, i := range order[:deleted] {
+		removed[c.Resources[i].UID] = true
+		payload.DeleteResources = append(payload.DeleteResources, DeleteResource{UID: c.Resources[i].UID})
+	}
+	for _, i := range order[deleted:changed] {
+		r := c.Resources[i]
+		updated := &db.Resource{Kind: r.Kind, UID: r.UID, Properties: make(map[string]interface{}, len(r.Properties))}
+		for k, v := range r.Properties {
+			updated.Properties[k] = v
+		}
+		updated.Properties["label"] = []interface{}{"app=app-" + strconv.Itoa(c.rand.Intn(20)),
+			"revision=" + strconv.Itoa(c.requestID)}
+		if restarts, ok := updated.Properties["restarts"].(int64); ok {
+			updated.Properties["restarts"] = restarts + 1
+		}
+		c.Resources[i] = updated
+		payload.UpdateResources = append(payload.UpdateResources, updated)
+	}
+
+	kept := make([]*db.Resource, 0, len(c.Resources))
+	for _, r := range c.Resources {
+		if !removed[r.UID] {
+			kept = append(kept, r)
+		}
+	}
+	edges := make([]db.Edge, 0, len(c.Edges))
+	for _, e := range c.Edges {
+		if !removed[e.SourceUID] && !removed[e.DestUID] {
+			edges = append(edges, e)
+		}
+	}
+	c.Resources, c.Edges = kept, edges
+
+	added := make([]*db.Resource, 0, deleted)
+	for i := 0; i < deleted; i++ {
+		added = append(added, c.newResource())
+	}
+	c.Resources = append(c.Resources, added...)
+	payload.AddResources = added
+	// Each new resource is linked to another one, like the resources it replaces.
+	byKind, seen := c.resourcesByKind(), c.edgeKeys()
+	for _, r := range added {
+		if edge, ok := c.linkResource(r, byKind, seen); ok {
+			payload.AddEdges = append(payload.AddEdges, edge)
+			c.Edges = append(c.Edges, edge)
+		}
+	}
+	return payload
+}
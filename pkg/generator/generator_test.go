@@ -0,0 +1,112 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKinds(t *testing.T) {
+	kinds, err := ParseKinds("Pod=50, Deployment=10,Node")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"Pod": 50, "Deployment": 10, "Node": 1}, kinds)
+
+	_, err = ParseKinds("Pod=0")
+	assert.Error(t, err)
+	_, err = ParseKinds("Pod) DELETE (n=1")
+	assert.Error(t, err)
+}
+
+func TestGenerate(t *testing.T) {
+	opts := Options{Clusters: 2, Nodes: 200, Edges: 300, Seed: 7}
+	clusters := Generate(opts)
+	if !assert.Len(t, clusters, 2) {
+		return
+	}
+	assert.Equal(t, "loadtest-1", clusters[0].Name)
+	assert.Equal(t, "loadtest-2", clusters[1].Name)
+	assert.Equal(t, Generate(opts)[0].Resources, clusters[0].Resources, "The same seed generates the same clusters.")
+
+	c := clusters[0]
+	assert.Len(t, c.Resources, 200)
+	assert.Len(t, c.Edges, 300)
+	kinds := map[string]int{}
+	uids := map[string]bool{}
+	for _, r := range c.Resources {
+		kinds[r.Kind]++
+		uids[r.UID] = true
+		assert.True(t, strings.HasPrefix(r.UID, "loadtest-1/"))
+		assert.Equal(t, r.Kind, r.Properties["kind"])
+	}
+	assert.Greater(t, kinds["Pod"], kinds["Deployment"], "Pods are the most common kind.")
+	edges := map[string]bool{}
+	for _, e := range c.Edges {
+		assert.True(t, uids[e.SourceUID] && uids[e.DestUID], "The edges link resources of the cluster.")
+		edges[edgeKey(e)] = true
+	}
+	assert.Len(t, edges, 300, "The edges are distinct.")
+
+	only := Generate(Options{Nodes: 10, Edges: 10, Kinds: map[string]int{"Namespace": 1}})[0]
+	assert.Len(t, only.Resources, 10)
+	assert.Empty(t, only.Edges, "No rule links namespaces.")
+}
+
+func TestCluster_Delta(t *testing.T) {
+	c := Generate(Options{Nodes: 1000, Edges: 1500, Seed: 3})[0]
+	resync := c.Resync()
+	assert.True(t, resync.ClearAll)
+	assert.Len(t, resync.AddResources, 1000)
+
+	delta := c.Delta(10)
+	assert.False(t, delta.ClearAll)
+	assert.Len(t, delta.UpdateResources, 90)
+	assert.Len(t, delta.DeleteResources, 10)
+	assert.Len(t, delta.AddResources, 10)
+	assert.NotEmpty(t, delta.AddEdges)
+	assert.Len(t, c.Resources, 1000, "The deleted resources are replaced.")
+	assert.Len(t, resync.AddResources, 1000, "The resync payload isn't changed by the delta.")
+
+	uids := map[string]bool{}
+	for _, r := range c.Resources {
+		uids[r.UID] = true
+	}
+	for _, d := range delta.DeleteResources {
+		assert.False(t, uids[d.UID])
+	}
+	for _, e := range c.Edges {
+		assert.True(t, uids[e.SourceUID] && uids[e.DestUID], "The edges of the deleted resources are dropped.")
+	}
+}
+
+func TestLoadTest(t *testing.T) {
+	requests := map[string]int{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		if !payload.ClearAll && payload.Epoch != 42 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		requests[r.URL.Path]++
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]int64{"Epoch": 42}))
+	})
+
+	report, err := LoadTest(context.Background(), handler, LoadOptions{Options: Options{Clusters: 2, Nodes: 100,
+		Edges: 100}, Deltas: 3, ChurnPercent: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"loadtest-1", "loadtest-2"}, report.Clusters)
+	assert.Equal(t, map[string]int{"/aggregator/clusters/loadtest-1/sync": 4,
+		"/aggregator/clusters/loadtest-2/sync": 4}, requests)
+	assert.Equal(t, 2, report.Resyncs.Count)
+	assert.Equal(t, 6, report.Deltas.Count)
+	assert.Zero(t, report.Deltas.Failed, "The deltas carry the epoch of the resync.")
+	assert.Equal(t, 2*100+6*(10+1), report.Resources)
+	assert.LessOrEqual(t, report.Deltas.P50, report.Deltas.Max)
+}
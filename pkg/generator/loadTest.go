@@ -0,0 +1,162 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Options of a load test, the shape of the clusters and the syncs they send.
+type LoadOptions struct {
+	Options
+	Deltas       int // Deltas sent by each cluster after its resync.
+	ChurnPercent int // Resources changed by each delta, 1 when 0.
+	Concurrency  int // Clusters syncing at the same time, 1 when 0.
+}
+
+// Latencies of the syncs of one type.
+type Latencies struct {
+	Count  int           `json:"count"`
+	Failed int           `json:"failed"` // Responded with another status than 200.
+	Mean   time.Duration `json:"mean"`
+	P50    time.Duration `json:"p50"`
+	P95    time.Duration `json:"p95"`
+	Max    time.Duration `json:"max"`
+}
+
+// Outcome of a load test.
+type LoadReport struct {
+	Clusters  []string      `json:"clusters"` // Names of the synthetic clusters.
+	Resyncs   Latencies     `json:"resyncs"`
+	Deltas    Latencies     `json:"deltas"`
+	Resources int           `json:"resources"` // Resources added, updated and deleted by the syncs.
+	Edges     int           `json:"edges"`     // Edges added by the syncs.
+	Duration  time.Duration `json:"duration"`
+}
+
+// Runs a load test: each cluster posts its resync and then its deltas to the sync route of the handler, e.g. the
+// router of the aggregator. The requests are served in process, so the latencies are the ones of the sync handlers
+// and the datastore, without the network.
+func LoadTest(ctx context.Context, handler http.Handler, opts LoadOptions) (LoadReport, error) {
+	churn := opts.ChurnPercent
+	if churn <= 0 {
+		churn = 1
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	clusters := Generate(opts.Options)
+
+	var mutex sync.Mutex
+	var firstErr error
+	report := LoadReport{}
+	for _, c := range clusters {
+		report.Clusters = append(report.Clusters, c.Name)
+	}
+	resyncs, deltas := []time.Duration{}, []time.Duration{}
+	record := func(payload Payload, latency time.Duration, status int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		report.Resources += len(payload.AddResources) + len(payload.UpdateResources) + len(payload.DeleteResources)
+		report.Edges += len(payload.AddEdges)
+		if payload.ClearAll {
+			resyncs = append(resyncs, latency)
+			if status != http.StatusOK {
+				report.Resyncs.Failed++
+			}
+		} else {
+			deltas = append(deltas, latency)
+			if status != http.StatusOK {
+				report.Deltas.Failed++
+			}
+		}
+	}
+
+	start := time.Now()
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, c := range clusters {
+		wg.Add(1)
+		go func(c *Cluster) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			var epoch int64
+			for i := 0; i <= opts.Deltas && ctx.Err() == nil; i++ {
+				var payload Payload
+				if i == 0 {
+					payload = c.Resync()
+				} else {
+					payload = c.Delta(churn)
+					payload.Epoch = epoch
+				}
+				latency, status, err := postSync(ctx, handler, c.Name, payload, &epoch)
+				if err != nil {
+					mutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mutex.Unlock()
+					return
+				}
+				record(payload, latency, status)
+			}
+		}(c)
+	}
+	wg.Wait()
+	report.Duration = time.Since(start)
+	report.Resyncs = latencies(resyncs, report.Resyncs.Failed)
+	report.Deltas = latencies(deltas, report.Deltas.Failed)
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return report, firstErr
+}
+
+// Posts the payload to the sync route of the cluster, and reads the epoch to send with the next deltas.
+func postSync(ctx context.Context, handler http.Handler, clusterName string, payload Payload,
+	epoch *int64) (time.Duration, int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, 0, err
+	}
+	request := httptest.NewRequest("POST", "/aggregator/clusters/"+clusterName+"/sync", bytes.NewReader(body))
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(recorder, request)
+	latency := time.Since(start)
+
+	var response struct{ Epoch int64 }
+	if json.Unmarshal(recorder.Body.Bytes(), &response) == nil && response.Epoch != 0 {
+		*epoch = response.Epoch
+	}
+	return latency, recorder.Code, nil
+}
+
+func latencies(durations []time.Duration, failed int) Latencies {
+	result := Latencies{Count: len(durations), Failed: failed}
+	if len(durations) == 0 {
+		return result
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	result.Mean = total / time.Duration(len(durations))
+	result.P50 = durations[len(durations)*50/100]
+	result.P95 = durations[len(durations)*95/100]
+	result.Max = durations[len(durations)-1]
+	return result
+}
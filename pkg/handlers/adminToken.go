@@ -0,0 +1,31 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// RequireAdmin wraps an admin route so it rejects the requests without the bearer ADMIN_TOKEN, when it's set. Without
+// ADMIN_TOKEN, the admin routes are only served on the separate ADMIN_ADDRESS listeners, which can be firewalled. The
+// public and internal listeners serving them without ADMIN_ADDRESS respond with 403.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Cfg.AdminToken == "" && config.Cfg.AdminAddress == "" {
+			respondError(w, http.StatusForbidden, ERROR_FEATURE_DISABLED,
+				"The admin APIs are disabled, set ADMIN_TOKEN or ADMIN_ADDRESS to enable them",
+				map[string]string{"feature": "adminAPI"})
+			return
+		}
+		if config.Cfg.AdminToken != "" && !isAdminRequest(r) {
+			logger.Warning("Rejected request without the admin token for ", r.Method, " ", r.URL.Path)
+			respondError(w, http.StatusUnauthorized, ERROR_ADMIN_TOKEN_REQUIRED, "The admin APIs require the admin token",
+				nil)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RequireAdmin(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	handler := RequireAdmin(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	status := func(token string) int {
+		request := httptest.NewRequest("PUT", "/aggregator/admin/readonly", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		response := httptest.NewRecorder()
+		handler(response, request)
+		return response.Code
+	}
+
+	config.Cfg.AdminToken, config.Cfg.AdminAddress = "", ""
+	assert.Equal(t, http.StatusForbidden, status(""), "Served on the public listeners without a token.")
+
+	config.Cfg.AdminAddress = ":3011"
+	assert.Equal(t, http.StatusOK, status(""), "Only served on the admin listeners.")
+
+	config.Cfg.AdminToken = "secret"
+	assert.Equal(t, http.StatusUnauthorized, status(""))
+	assert.Equal(t, http.StatusUnauthorized, status("wrong"))
+	assert.Equal(t, http.StatusOK, status("secret"))
+
+	config.Cfg.AdminAddress = ""
+	assert.Equal(t, http.StatusUnauthorized, status(""))
+	assert.Equal(t, http.StatusOK, status("secret"))
+}
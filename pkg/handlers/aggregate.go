@@ -0,0 +1,74 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Request body for Aggregate.
+type AggregateRequest struct {
+	Search  string   `json:"search"`  // Saved search in the console syntax, e.g. "kind:pod"
+	GroupBy []string `json:"groupBy"` // Properties to count the resources by, e.g. status and cluster.
+	Limit   int      `json:"limit"`   // Max number of groups to return, capped by SEARCH_RESULT_LIMIT.
+}
+
+// Response body for Aggregate.
+type AggregateResponse struct {
+	db.AggregateResult
+	// Queries run for the aggregation, only with ?debugQueries=true and the admin token.
+	Queries []db.TracedQuery `json:"queries,omitempty"`
+}
+
+// Aggregate counts the resources matching a saved search, grouped by the values of some properties, in the
+// datastore, so consumers don't pull the resources to count them.
+func Aggregate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var request AggregateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Warning("Error decoding body of aggregate request: ", err)
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	access, status, err := searchAccess(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	ctx, trace, status, err := debugQueries(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	kindLabels, err := searchKindLabels(ctx)
+	if err != nil {
+		logger.Warning("Error reading node labels for aggregate request: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	compiled, err := db.CompileSearchWithKindLabels(request.Search, kindLabels)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_SEARCH, err.Error(), nil)
+		return
+	}
+	if access != nil {
+		compiled = compiled.WithAccess(*access)
+	}
+
+	start := time.Now()
+	result, err := db.SearchAggregate(ctx, compiled, request.GroupBy, searchLimit(request.Limit))
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	observeSearchFilters(compiled, time.Since(start))
+	response := AggregateResponse{AggregateResult: result, Queries: tracedQueries(trace)}
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to Aggregate: ", encodeError)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Aggregate(t *testing.T) {
+	useTestDatastore(t)
+
+	_, err := db.Store.Query(context.Background(), "CREATE (:Pod {kind:'pod', cluster:'c1', status:'Running'}), "+
+		"(:Pod {kind:'pod', cluster:'c2', status:'Running'})")
+	assert.NoError(t, err)
+
+	response := httptest.NewRecorder()
+	Aggregate(response, httptest.NewRequest("POST", "/aggregator/search/aggregate",
+		strings.NewReader(`{"search": "kind:pod", "groupBy": ["status"]}`)))
+	assert.Equal(t, http.StatusOK, response.Code)
+	var result AggregateResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+	assert.Equal(t, 2, result.Total)
+	if assert.Equal(t, 1, len(result.Groups)) {
+		assert.Equal(t, map[string]interface{}{"status": "Running"}, result.Groups[0].Values)
+		assert.Equal(t, 2, result.Groups[0].Count)
+	}
+
+	response = httptest.NewRecorder()
+	Aggregate(response, httptest.NewRequest("POST", "/aggregator/search/aggregate",
+		strings.NewReader(`{"search": "kind:pod", "groupBy": ["n) DELETE (n"]}`)))
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+var (
+	aggregatorStarted         = time.Now()
+	lastInterClusterEdgeBuild time.Time // Last successful pass of the intercluster edge builder.
+	aggregatorStatusMutex     = sync.Mutex{}
+)
+
+// Records a successful pass of the intercluster edge builder, for the Aggregator node.
+func recordInterClusterEdgeBuild(now time.Time) {
+	aggregatorStatusMutex.Lock()
+	defer aggregatorStatusMutex.Unlock()
+	lastInterClusterEdgeBuild = now
+}
+
+// Returns the status of this aggregator, without the graph counts.
+func currentAggregatorStatus() db.AggregatorStatus {
+	aggregatorStatusMutex.Lock()
+	defer aggregatorStatusMutex.Unlock()
+	instance, err := os.Hostname()
+	if err != nil {
+		logger.Warning("Error reading the hostname for the Aggregator node: ", err)
+	}
+	return db.AggregatorStatus{
+		Instance:                  instance,
+		Version:                   config.AGGREGATOR_API_VERSION,
+		Commit:                    os.Getenv("VCS_REF"),
+		Started:                   aggregatorStarted,
+		LastInterClusterEdgeBuild: lastInterClusterEdgeBuild,
+	}
+}
+
+// Counts the graph and updates the Aggregator node.
+func updateAggregatorStatus(ctx context.Context) error {
+	status := currentAggregatorStatus()
+	if err := db.CountAggregatorStatus(ctx, &status); err != nil {
+		return err
+	}
+	_, err := db.SaveAggregatorStatus(ctx, status)
+	return err
+}
+
+// Updates the Aggregator node with the health of the search index every AGGREGATOR_STATUS_RATE_MS.
+func AggregatorStatusJob() {
+	if config.Cfg.AggregatorStatusRateMS <= 0 {
+		logger.Info("Disabled the Aggregator node, AGGREGATOR_STATUS_RATE_MS is 0.")
+		return
+	}
+	for {
+		ctx := db.WithLane(context.Background(), db.BulkLane)
+		if err := updateAggregatorStatus(ctx); err != nil {
+			logger.Warning("Error updating the Aggregator node: ", err)
+		}
+		time.Sleep(time.Duration(config.Cfg.AggregatorStatusRateMS) * time.Millisecond)
+	}
+}
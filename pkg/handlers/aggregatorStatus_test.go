@@ -0,0 +1,32 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_updateAggregatorStatus(t *testing.T) {
+	prevBuild := lastInterClusterEdgeBuild
+	useTestDatastore(t)
+	defer func() { lastInterClusterEdgeBuild = prevBuild }()
+
+	built := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	recordInterClusterEdgeBuild(built)
+	assert.Equal(t, built, currentAggregatorStatus().LastInterClusterEdgeBuild)
+
+	assert.NoError(t, updateAggregatorStatus(context.Background()))
+	result, err := db.Store.Query(context.Background(),
+		"MATCH (a:Aggregator) RETURN a.version, a.lastInterClusterEdgeBuild, a.clusters")
+	if !assert.NoError(t, err) || !assert.True(t, result.Next()) {
+		t.FailNow()
+	}
+	assert.Equal(t, []interface{}{config.AGGREGATOR_API_VERSION, "2021-06-01T12:00:00Z", 0}, result.Record().Values())
+}
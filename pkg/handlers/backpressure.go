@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+// Returns the number of syncs in progress.
+func pendingRequestCount() int {
+	PendingRequestsMutex.RLock()
+	defer PendingRequestsMutex.RUnlock()
+	return len(PendingRequests)
+}
+
+// Sets the load of the aggregator in the response, so collectors can slow down before their syncs are rejected.
+// Below half of the REQUEST_LIMIT there's no delay. Above it the suggested delay grows up to the retry delay of a
+// rejected sync at the limit, and the payload hint is halved.
+func setBackpressure(response *SyncResponse, queueDepth int) {
+	limit := config.RequestLimit()
+	response.QueueDepth = queueDepth
+	response.RequestLimit = limit
+	response.SuggestedDelayMS = 0
+	response.MaxPayloadHint = config.Cfg.SyncPayloadHint
+	if limit <= 0 || 2*queueDepth < limit {
+		return
+	}
+	load := float64(2*queueDepth-limit) / float64(limit) // 0 at half the limit, 1 at the limit.
+	if load > 1 {
+		load = 1
+	}
+	response.SuggestedDelayMS = int(load * float64(throttleRetryAfter/time.Millisecond))
+	response.MaxPayloadHint /= 2
+}
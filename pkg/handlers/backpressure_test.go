@@ -0,0 +1,27 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_setBackpressure(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.RequestLimit, config.Cfg.SyncPayloadHint = 10, 1000
+
+	response := SyncResponse{}
+	setBackpressure(&response, 4)
+	assert.Equal(t, SyncResponse{QueueDepth: 4, RequestLimit: 10, MaxPayloadHint: 1000}, response)
+
+	setBackpressure(&response, 8)
+	assert.Equal(t, 3000, response.SuggestedDelayMS, "60% of the retry delay at 80% of the limit")
+	assert.Equal(t, 500, response.MaxPayloadHint)
+
+	setBackpressure(&response, 12)
+	assert.Equal(t, 5000, response.SuggestedDelayMS, "Capped at the retry delay over the limit")
+}
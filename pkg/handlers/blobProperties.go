@@ -0,0 +1,213 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/blobstore"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Prefix of the properties holding the key of an offloaded property in the blob store, followed by its name.
+const BLOB_PROPERTY_PREFIX = "_blob_"
+
+const knownBlobsLimit = 10000 // Keys of the blobs written recently, so they aren't written again every sync.
+
+// Blob store and properties for the current config, created again when it changes.
+type blobProperties struct {
+	storeConfig, propertiesConfig string
+	store                         blobstore.Store
+	properties                    map[string]bool // Keyed by property and kind.property, lowercased.
+}
+
+var (
+	blobs        blobProperties
+	knownBlobs   = make(map[string]bool)
+	blobsMutex   = sync.Mutex{}
+	newBlobStore = func(location, s3Endpoint string) (blobstore.Store, error) {
+		var client kubernetes.Interface
+		if strings.HasPrefix(location, "configmap://") {
+			if clientset := config.GetKubeClient(); clientset != nil {
+				client = clientset
+			}
+		}
+		return blobstore.New(location, s3Endpoint, client)
+	}
+)
+
+// Returns the blob store and properties, the store is nil when there are no BLOB_PROPERTIES or BLOB_STORE.
+func currentBlobProperties() blobProperties {
+	blobsMutex.Lock()
+	defer blobsMutex.Unlock()
+	if blobs.storeConfig == config.Cfg.BlobStore && blobs.propertiesConfig == config.Cfg.BlobProperties {
+		return blobs
+	}
+	blobs = blobProperties{storeConfig: config.Cfg.BlobStore, propertiesConfig: config.Cfg.BlobProperties,
+		properties: make(map[string]bool)}
+	for _, property := range config.ParseList(config.Cfg.BlobProperties) {
+		blobs.properties[strings.ToLower(property)] = true
+	}
+	knownBlobs = make(map[string]bool)
+	if len(blobs.properties) == 0 || config.Cfg.BlobStore == "" {
+		return blobs
+	}
+	store, err := newBlobStore(config.Cfg.BlobStore, config.Cfg.BlobS3Endpoint)
+	if err != nil {
+		logger.Error("Error opening BLOB_STORE, the BLOB_PROPERTIES are kept in the graph: ", err)
+		return blobs
+	}
+	blobs.store = store
+	return blobs
+}
+
+func (b blobProperties) offloaded(kind, property string) bool {
+	property = strings.ToLower(property)
+	return b.properties[property] || b.properties[strings.ToLower(kind)+"."+property]
+}
+
+// Writes the blob unless it was written recently.
+func putBlob(ctx context.Context, store blobstore.Store, key string, data []byte) error {
+	blobsMutex.Lock()
+	known := knownBlobs[key]
+	blobsMutex.Unlock()
+	if known {
+		return nil
+	}
+	if err := store.Put(ctx, key, data); err != nil {
+		return err
+	}
+	blobsMutex.Lock()
+	if len(knownBlobs) >= knownBlobsLimit {
+		knownBlobs = make(map[string]bool)
+	}
+	knownBlobs[key] = true
+	blobsMutex.Unlock()
+	return nil
+}
+
+// Moves the large values of the BLOB_PROPERTIES of the added and updated resources to the blob store, and keeps
+// their key in the graph. A value that can't be written stays in the graph.
+func offloadBlobProperties(ctx context.Context, clusterName string, syncEvent *SyncEvent) {
+	blobs := currentBlobProperties()
+	if blobs.store == nil {
+		return
+	}
+	offloaded := 0
+	// Updates don't remove properties from the node, so the value or the key it had before is cleared.
+	offload := func(resources []*db.Resource, update bool) {
+		for _, resource := range resources {
+			kind, _ := resource.Properties["kind"].(string)
+			properties := []string{}
+			for property := range resource.Properties {
+				if blobs.offloaded(kind, property) {
+					properties = append(properties, property)
+				}
+			}
+			for _, property := range properties {
+				data, err := json.Marshal(resource.Properties[property])
+				if err != nil || len(data) < config.Cfg.BlobMinBytes {
+					if update {
+						resource.Properties[BLOB_PROPERTY_PREFIX+property] = ""
+					}
+					continue
+				}
+				key := blobstore.Key(data)
+				if err = putBlob(ctx, blobs.store, key, data); err != nil {
+					logger.Warningf("Error writing the %s property of resource %s to the blob store: %s", property,
+						resource.UID, err)
+					continue
+				}
+				delete(resource.Properties, property)
+				if update {
+					resource.Properties[property] = ""
+				}
+				resource.Properties[BLOB_PROPERTY_PREFIX+property] = key
+				offloaded++
+			}
+		}
+	}
+	offload(syncEvent.AddResources, false)
+	offload(syncEvent.UpdateResources, true)
+	if offloaded > 0 {
+		logger.V(3).Infof("Offloaded %d properties of cluster %s to the blob store.", offloaded, clusterName)
+	}
+}
+
+// ResourceBlob responds with the full value of a property of a resource offloaded to the blob store.
+// Responds with 404 when the resource can't be seen or the property isn't offloaded.
+func ResourceBlob(w http.ResponseWriter, r *http.Request) {
+	clusterName, property := mux.Vars(r)["id"], mux.Vars(r)["property"]
+	uid, _, err := db.NormalizeUID(clusterName+"/"+mux.Vars(r)["uid"], clusterName)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_UID, "Invalid resource UID: "+err.Error(), nil)
+		return
+	}
+	if !targetPropertyRegex.MatchString(property) {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PROPERTY, "Invalid property "+property,
+			map[string]string{"property": property})
+		return
+	}
+	access, status, err := searchAccess(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	blobs := currentBlobProperties()
+	if blobs.store == nil {
+		respondError(w, http.StatusNotFound, ERROR_FEATURE_DISABLED, "No BLOB_STORE is configured",
+			map[string]string{"feature": "blobStore"})
+		return
+	}
+
+	query := db.SanitizeQuery("MATCH (n {_uid:'%s'})", uid)
+	if access != nil {
+		if condition := access.Condition("n"); condition != "" {
+			query += " WHERE " + condition
+		}
+	}
+	result, err := db.Store.Query(r.Context(), query+" RETURN n."+BLOB_PROPERTY_PREFIX+property)
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	key := ""
+	if result.Next() {
+		key, _ = result.Record().GetByIndex(0).(string)
+	}
+	if key == "" {
+		respondError(w, http.StatusNotFound, ERROR_BLOB_NOT_FOUND,
+			"Property "+property+" of resource "+uid+" isn't in the blob store",
+			map[string]string{"uid": uid, "property": property})
+		return
+	}
+	data, err := blobs.store.Get(r.Context(), key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		respondError(w, http.StatusNotFound, ERROR_BLOB_NOT_FOUND, "Blob "+key+" not found",
+			map[string]string{"uid": uid, "property": property, "key": key})
+		return
+	} else if err != nil {
+		logger.Warning("Error reading blob ", key, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	if blobstore.Key(data) != key { // Not the content the graph refers to.
+		logger.Warning("Blob ", key, " doesn't match its hash")
+		respondError(w, http.StatusBadGateway, ERROR_BLOB_CORRUPTED, "Blob "+key+" doesn't match its hash",
+			map[string]string{"key": key})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		logger.Error("Error responding to ResourceBlob: ", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/blobstore"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_offloadBlobProperties(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.BlobStore, config.Cfg.BlobProperties, config.Cfg.BlobMinBytes = t.TempDir(), "spec, configmap.data", 20
+
+	spec := map[string]interface{}{"replicas": int64(3), "template": "a long enough value"}
+	syncEvent := SyncEvent{
+		AddResources: []*db.Resource{{UID: "c1/a", Properties: map[string]interface{}{"kind": "Deployment",
+			"spec": spec, "data": strings.Repeat("x", 30)}}},
+		UpdateResources: []*db.Resource{
+			{UID: "c1/b", Properties: map[string]interface{}{"kind": "ConfigMap", "data": strings.Repeat("x", 30)}},
+			{UID: "c1/c", Properties: map[string]interface{}{"kind": "Deployment", "spec": "small"}},
+		},
+	}
+	offloadBlobProperties(context.Background(), "c1", &syncEvent)
+
+	added := syncEvent.AddResources[0].Properties
+	_, inGraph := added["spec"]
+	assert.False(t, inGraph)
+	assert.Len(t, added[BLOB_PROPERTY_PREFIX+"spec"], 64)
+	assert.Equal(t, strings.Repeat("x", 30), added["data"], "Only the data of configmaps is offloaded.")
+	stored, err := currentBlobProperties().store.Get(context.Background(), added[BLOB_PROPERTY_PREFIX+"spec"].(string))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"replicas":3,"template":"a long enough value"}`, string(stored))
+
+	// Updates clear the value or the key the node had before.
+	updated := syncEvent.UpdateResources[0].Properties
+	assert.Equal(t, "", updated["data"])
+	assert.Len(t, updated[BLOB_PROPERTY_PREFIX+"data"], 64)
+	assert.Equal(t, map[string]interface{}{"kind": "Deployment", "spec": "small", BLOB_PROPERTY_PREFIX + "spec": ""},
+		syncEvent.UpdateResources[1].Properties)
+}
+
+func Test_ResourceBlob(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.BlobStore, config.Cfg.BlobProperties = t.TempDir(), "spec"
+	data := []byte(`{"replicas":3}`)
+	key := blobstore.Key(data)
+	assert.NoError(t, currentBlobProperties().store.Put(context.Background(), key, data))
+	_, err := db.Store.Query(context.Background(), "CREATE (:Deployment {_uid:'c1/a', kind:'deployment', "+
+		"cluster:'c1', _blob_spec:'"+key+"'}), (:Deployment {_uid:'c1/b', kind:'deployment', cluster:'c1'})")
+	assert.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/resources/{uid}/blobs/{property}", ResourceBlob)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	w := get("/aggregator/clusters/c1/resources/a/blobs/spec")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, string(data), w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, get("/aggregator/clusters/c1/resources/b/blobs/spec").Code)
+	assert.Equal(t, http.StatusNotFound, get("/aggregator/clusters/c1/resources/none/blobs/spec").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/aggregator/clusters/c1/resources/a/blobs/sp'ec").Code)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Clock skew of a cluster, as in the status API. Measured from the sentAt of its last sync, so it includes the
+// time the sync took to arrive.
+type ClockSkewStatus struct {
+	SkewMS     int64     `json:"skewMS"`     // Collector clock minus the aggregator clock, positive when it's ahead.
+	Skewed     bool      `json:"skewed"`     // Beyond CLOCK_SKEW_THRESHOLD_MS.
+	MeasuredAt time.Time `json:"measuredAt"` // When the sync was received, by the aggregator clock.
+}
+
+var (
+	clockSkews      = make(map[string]ClockSkewStatus)
+	clockSkewsMutex = sync.Mutex{}
+)
+
+// Tells whether the skew is beyond CLOCK_SKEW_THRESHOLD_MS. Never when the threshold is 0.
+func isClockSkewed(skew time.Duration) bool {
+	threshold := time.Duration(config.Cfg.ClockSkewThresholdMS) * time.Millisecond
+	if threshold <= 0 {
+		return false
+	}
+	return skew > threshold || skew < -threshold
+}
+
+// Records the skew between the collector clock, from the time it sent the sync, and the time the sync was received.
+// Collectors that don't send sentAt keep their previous skew.
+func observeClockSkew(clusterName string, sentAt, received time.Time) {
+	if sentAt.IsZero() {
+		return
+	}
+	skew := sentAt.Sub(received)
+	status := ClockSkewStatus{SkewMS: skew.Milliseconds(), Skewed: isClockSkewed(skew), MeasuredAt: received}
+
+	clockSkewsMutex.Lock()
+	previous := clockSkews[clusterName]
+	clockSkews[clusterName] = status
+	clockSkewsMutex.Unlock()
+
+	metrics.SetClusterGauge(metrics.ClusterClockSkew, clusterName, skew.Seconds())
+	// Logged when the cluster crosses the threshold, not on every sync.
+	if status.Skewed && !previous.Skewed {
+		logger.Warningf("The clock of cluster %s is skewed by %s. Using the aggregator time for its timestamps.",
+			clusterName, skew.Round(time.Millisecond))
+	} else if !status.Skewed && previous.Skewed {
+		logger.Infof("The clock of cluster %s is no longer skewed, skew: %s", clusterName, skew.Round(time.Millisecond))
+	}
+}
+
+// Returns the last measured clock skew of the cluster, nil when its collector doesn't send sentAt.
+func getClockSkew(clusterName string) *ClockSkewStatus {
+	clockSkewsMutex.Lock()
+	defer clockSkewsMutex.Unlock()
+	status, ok := clockSkews[clusterName]
+	if !ok {
+		return nil
+	}
+	return &status
+}
+
+// Returns the correction for the timestamps sent by the collector of the cluster, the skew when it's beyond the
+// threshold, otherwise 0. Subtracting it gives the time by the aggregator clock.
+func clockSkewCorrection(clusterName string) time.Duration {
+	status := getClockSkew(clusterName)
+	if status == nil || !status.Skewed {
+		return 0
+	}
+	return time.Duration(status.SkewMS) * time.Millisecond
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_observeClockSkew(t *testing.T) {
+	cluster := "skewed-cluster"
+	t.Cleanup(config.Snapshot())
+	config.Cfg.ClockSkewThresholdMS = 60000
+	defer func() {
+		clockSkewsMutex.Lock()
+		delete(clockSkews, cluster)
+		clockSkewsMutex.Unlock()
+	}()
+	received := time.Now()
+
+	// Nothing is known until the collector sends sentAt.
+	observeClockSkew(cluster, time.Time{}, received)
+	assert.Nil(t, getClockSkew(cluster))
+	assert.Equal(t, time.Duration(0), clockSkewCorrection(cluster))
+
+	// Within the threshold the timestamps are trusted.
+	observeClockSkew(cluster, received.Add(-2*time.Second), received)
+	assert.Equal(t, &ClockSkewStatus{SkewMS: -2000, Skewed: false, MeasuredAt: received}, getClockSkew(cluster))
+	assert.Equal(t, time.Duration(0), clockSkewCorrection(cluster))
+
+	observeClockSkew(cluster, received.Add(5*time.Minute), received)
+	assert.True(t, getClockSkew(cluster).Skewed)
+	assert.Equal(t, 5*time.Minute, clockSkewCorrection(cluster))
+
+	// A sync without sentAt keeps the last skew.
+	observeClockSkew(cluster, time.Time{}, received)
+	assert.Equal(t, int64(300000), getClockSkew(cluster).SkewMS)
+
+	config.Cfg.ClockSkewThresholdMS = 0
+	assert.False(t, isClockSkewed(time.Hour), "A threshold of 0 never corrects the timestamps")
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Health states of a cluster.
+const (
+	HEALTH_HEALTHY  = "Healthy"  // Syncs are recent and succeed.
+	HEALTH_DEGRADED = "Degraded" // Syncs are recent but many of them fail.
+	HEALTH_STALE    = "Stale"    // No successful sync for CLUSTER_STALE_AFTER_MS.
+	HEALTH_OFFLINE  = "Offline"  // No successful sync for CLUSTER_OFFLINE_AFTER_MS.
+)
+
+var healthStates = []string{HEALTH_HEALTHY, HEALTH_DEGRADED, HEALTH_STALE, HEALTH_OFFLINE}
+
+const (
+	healthSyncWindow         = 20  // Recent syncs the error rate is computed from.
+	healthDegradedErrorRate  = 0.5 // Error rate at which a cluster becomes Degraded.
+	healthRecoveredErrorRate = 0.1 // Error rate below which a Degraded cluster recovers.
+	healthConfirmations      = 3   // Consecutive evaluations with a new state before the state changes.
+	healthEvaluationInterval = 30 * time.Second
+)
+
+// Health of a cluster, as in the status API.
+type ClusterHealthStatus struct {
+	State       string    `json:"state"`
+	Since       time.Time `json:"since"`       // When the cluster entered the state.
+	LastSuccess time.Time `json:"lastSuccess"` // Last successful sync, zero when none since the aggregator started.
+	ErrorRate   float64   `json:"errorRate"`   // Failed syncs in the recent syncs.
+}
+
+// Tracks the health of a cluster. The thresholds to become Degraded and recover are apart, and a new state must
+// hold for healthConfirmations evaluations, so a cluster close to a threshold doesn't flap between states.
+type clusterHealth struct {
+	status        ClusterHealthStatus
+	recent        []bool // Whether each of the recent syncs failed, oldest first.
+	candidate     string // State the cluster is moving to.
+	confirmations int
+}
+
+var (
+	clusterHealths      = make(map[string]*clusterHealth)
+	clusterHealthsMutex = sync.Mutex{}
+	healthTrackingStart = time.Now() // Clusters without a successful sync are as old as the aggregator.
+)
+
+// Tells whether a sync counts as failed for the error rate. Stale epochs and throttling aren't the cluster's fault.
+func syncFailed(status int) bool {
+	return status >= http.StatusBadRequest && status != http.StatusConflict && status != http.StatusTooManyRequests
+}
+
+// Records a sync from the cluster and evaluates its health.
+func observeClusterSync(clusterName string, status int, now time.Time) {
+	clusterHealthsMutex.Lock()
+	defer clusterHealthsMutex.Unlock()
+	h, ok := clusterHealths[clusterName]
+	if !ok {
+		h = &clusterHealth{}
+		clusterHealths[clusterName] = h
+	}
+	h.recent = append(h.recent, syncFailed(status))
+	if len(h.recent) > healthSyncWindow {
+		h.recent = h.recent[len(h.recent)-healthSyncWindow:]
+	}
+	if !syncFailed(status) {
+		h.status.LastSuccess = now
+	}
+	if !ok { // The first state doesn't need confirmations, there is nothing to flap from.
+		h.status.State, h.status.Since = h.target(now), now
+		setHealthMetric(clusterName, h.status.State)
+		return
+	}
+	h.evaluate(clusterName, now)
+}
+
+func (h *clusterHealth) errorRate() float64 {
+	if len(h.recent) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, f := range h.recent {
+		if f {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(h.recent))
+}
+
+// Returns the state for the syncs so far, without the confirmations.
+func (h *clusterHealth) target(now time.Time) string {
+	lastSuccess := h.status.LastSuccess
+	if lastSuccess.IsZero() {
+		lastSuccess = healthTrackingStart
+	}
+	age := now.Sub(lastSuccess)
+	switch {
+	case age >= time.Duration(config.Cfg.ClusterOfflineAfterMS)*time.Millisecond:
+		return HEALTH_OFFLINE
+	case age >= time.Duration(config.Cfg.ClusterStaleAfterMS)*time.Millisecond:
+		return HEALTH_STALE
+	}
+	rate := h.errorRate()
+	if rate >= healthDegradedErrorRate || (h.status.State == HEALTH_DEGRADED && rate > healthRecoveredErrorRate) {
+		return HEALTH_DEGRADED
+	}
+	return HEALTH_HEALTHY
+}
+
+// Moves to the target state once it held for healthConfirmations evaluations in a row.
+func (h *clusterHealth) evaluate(clusterName string, now time.Time) {
+	target := h.target(now)
+	if target == h.status.State {
+		h.candidate, h.confirmations = "", 0
+		return
+	}
+	if target != h.candidate {
+		h.candidate, h.confirmations = target, 0
+	}
+	h.confirmations++
+	if h.confirmations < healthConfirmations {
+		return
+	}
+	logger.Infof("Health of cluster %s changed from %s to %s", clusterName, h.status.State, target)
+	h.status.State, h.status.Since = target, now
+	h.candidate, h.confirmations = "", 0
+	setHealthMetric(clusterName, target)
+}
+
+func setHealthMetric(clusterName, state string) {
+	if metrics.ClusterLabel(clusterName) == metrics.OTHER_CLUSTERS {
+		return // Counted by setOtherHealthMetrics.
+	}
+	setHealthSeries(clusterName, state)
+}
+
+func setHealthSeries(clusterName, state string) {
+	for _, s := range healthStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		metrics.ClusterHealth.WithLabelValues(clusterName, s).Set(value)
+	}
+}
+
+// Returns the health of the cluster. Clusters without a sync since the aggregator started aren't tracked, their
+// state is computed from the time the aggregator started.
+func getClusterHealth(clusterName string, now time.Time) ClusterHealthStatus {
+	clusterHealthsMutex.Lock()
+	defer clusterHealthsMutex.Unlock()
+	h, ok := clusterHealths[clusterName]
+	if !ok {
+		untracked := &clusterHealth{}
+		return ClusterHealthStatus{State: untracked.target(now), Since: healthTrackingStart}
+	}
+	status := h.status
+	status.ErrorRate = h.errorRate()
+	return status
+}
+
+// Evaluates the health of the clusters, so the clusters that stopped syncing become Stale and then Offline.
+func ClusterHealthJob() {
+	for {
+		time.Sleep(healthEvaluationInterval)
+		now := time.Now()
+		clusterHealthsMutex.Lock()
+		for clusterName, h := range clusterHealths {
+			h.evaluate(clusterName, now)
+		}
+		setOtherHealthMetrics()
+		clusterHealthsMutex.Unlock()
+	}
+}
+
+// With METRICS_CLUSTER_LABEL_LIMIT, sets the health of the clusters counted under the other cluster label to the
+// number of them in each state and removes their own series. The series of the clusters given a label by the last
+// ranking are set again. The caller holds clusterHealthsMutex.
+func setOtherHealthMetrics() {
+	if config.Cfg.MetricsClusterLabelLimit <= 0 {
+		return
+	}
+	other := make(map[string]int, len(healthStates))
+	for clusterName, h := range clusterHealths {
+		if metrics.HasClusterLabel(clusterName) {
+			setHealthSeries(clusterName, h.status.State)
+			continue
+		}
+		other[h.status.State]++
+		for _, s := range healthStates {
+			metrics.ClusterHealth.DeleteLabelValues(clusterName, s)
+		}
+	}
+	for _, s := range healthStates {
+		metrics.ClusterHealth.WithLabelValues(metrics.OTHER_CLUSTERS, s).Set(float64(other[s]))
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_clusterHealth(t *testing.T) {
+	start := time.Now()
+	cluster := "health-cluster"
+	defer func() {
+		clusterHealthsMutex.Lock()
+		delete(clusterHealths, cluster)
+		clusterHealthsMutex.Unlock()
+	}()
+	state := func(now time.Time) string { return getClusterHealth(cluster, now).State }
+
+	observeClusterSync(cluster, http.StatusOK, start)
+	assert.Equal(t, HEALTH_HEALTHY, state(start))
+
+	// Most syncs fail, the change needs three evaluations in a row.
+	observeClusterSync(cluster, http.StatusServiceUnavailable, start)
+	observeClusterSync(cluster, http.StatusBadRequest, start)
+	assert.Equal(t, HEALTH_HEALTHY, state(start))
+	observeClusterSync(cluster, http.StatusBadRequest, start)
+	assert.Equal(t, HEALTH_DEGRADED, state(start))
+
+	// Recovering takes more than getting below the Degraded error rate. Stale deltas aren't failures.
+	observeClusterSync(cluster, http.StatusConflict, start)
+	for i := 0; i < 7; i++ {
+		observeClusterSync(cluster, http.StatusOK, start)
+	}
+	assert.Equal(t, HEALTH_DEGRADED, state(start))
+	assert.InDelta(t, 0.25, getClusterHealth(cluster, start).ErrorRate, 0.001)
+
+	// No successful sync for longer than CLUSTER_STALE_AFTER_MS.
+	clusterHealthsMutex.Lock()
+	h := clusterHealths[cluster]
+	later := start.Add(15 * time.Minute)
+	for i := 0; i < healthConfirmations; i++ {
+		h.evaluate(cluster, later)
+	}
+	clusterHealthsMutex.Unlock()
+	assert.Equal(t, HEALTH_STALE, state(later))
+	assert.Equal(t, later, getClusterHealth(cluster, later).Since)
+
+	// Clusters that never synced are as old as the aggregator.
+	assert.Equal(t, HEALTH_HEALTHY, getClusterHealth("other-cluster", healthTrackingStart).State)
+	assert.Equal(t, HEALTH_OFFLINE, getClusterHealth("other-cluster", healthTrackingStart.Add(time.Hour)).State)
+}
+
+func Test_setOtherHealthMetrics(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.MetricsClusterLabelLimit = 1
+	clusters := []string{"health-other-1", "health-other-2"}
+	defer func() {
+		clusterHealthsMutex.Lock()
+		for _, cluster := range clusters {
+			delete(clusterHealths, cluster)
+		}
+		clusterHealthsMutex.Unlock()
+	}()
+	for _, cluster := range clusters {
+		observeClusterSync(cluster, http.StatusOK, time.Now())
+	}
+
+	clusterHealthsMutex.Lock()
+	setOtherHealthMetrics()
+	other := 0
+	for cluster, h := range clusterHealths {
+		if !metrics.HasClusterLabel(cluster) && h.status.State == HEALTH_HEALTHY {
+			other++
+		}
+	}
+	clusterHealthsMutex.Unlock()
+
+	assert.False(t, metrics.HasClusterLabel(clusters[1]), "Only one cluster has a label")
+	assert.False(t, metrics.ClusterHealth.DeleteLabelValues(clusters[1], HEALTH_HEALTHY), "No series of its own")
+	assert.GreaterOrEqual(t, other, 1)
+	assert.Equal(t, float64(other),
+		testutil.ToFloat64(metrics.ClusterHealth.WithLabelValues(metrics.OTHER_CLUSTERS, HEALTH_HEALTHY)))
+}
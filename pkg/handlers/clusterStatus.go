@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Response body for ClusterStatus.
+type ClusterStatusResponse struct {
+	Cluster        string              `json:"cluster"`
+	Epoch          int64               `json:"epoch"` // Epoch of the last resync, 0 when the cluster didn't resync since the aggregator started.
+	TotalResources int                 `json:"totalResources"`
+	TotalEdges     int                 `json:"totalEdges"`
+	LastSync       *db.SyncStats       `json:"lastSync,omitempty"` // Stats of the last sync in the SYNC_HISTORY_RETENTION_HOURS.
+	Health         ClusterHealthStatus `json:"health"`
+	Collector      CollectorStatus     `json:"collector"`
+	ClockSkew      *ClockSkewStatus    `json:"clockSkew,omitempty"` // Only for collectors sending sentAt.
+	// Identical syncs in a row, only when the last sync of the cluster was the same as the previous one.
+	DuplicateSyncs *DuplicateSyncStatus `json:"duplicateSyncs,omitempty"`
+	// Mismatches found by the recent resyncs, only when the cluster resynced since the aggregator started.
+	Consistency *ClusterConsistencyStatus `json:"consistency,omitempty"`
+}
+
+// ClusterStatus responds with the resources and edges of a cluster in the graph, its sync epoch, its last sync, its
+// health, the state and skew of its collector, the identical syncs it sent in a row and the consistency of its
+// recent resyncs.
+// Collectors use it to decide whether to resync after they restart.
+func ClusterStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+
+	ctx := r.Context()
+	since := time.Now().Add(-time.Duration(config.SyncHistoryRetentionHours()) * time.Hour)
+	history, err := db.SyncHistory(ctx, clusterName, since)
+	if err != nil {
+		logger.Warning("Error reading sync history for cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	status := ClusterStatusResponse{
+		Cluster:        clusterName,
+		Epoch:          clusterEpoch(ctx, clusterName),
+		TotalResources: computeNodeCount(ctx, clusterName),
+		TotalEdges:     computeIntraEdges(ctx, clusterName),
+		Health:         getClusterHealth(clusterName, time.Now()),
+		Collector:      getCollectorStatus(clusterName),
+		ClockSkew:      getClockSkew(clusterName),
+		DuplicateSyncs: getDuplicateSyncs(clusterName),
+		Consistency:    getClusterConsistency(clusterName),
+	}
+	if len(history) > 0 {
+		status.LastSync = &history[len(history)-1]
+	}
+	if encodeError := json.NewEncoder(w).Encode(status); encodeError != nil {
+		logger.Error("Error responding to ClusterStatus: ", encodeError)
+	}
+}
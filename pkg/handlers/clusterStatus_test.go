@@ -0,0 +1,41 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClusterStatus_badRequest(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/status", ClusterStatus)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/aggregator/clusters/bad=cluster/status", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_SyncResources_invalidGzip(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", SyncResources)
+
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, _ = writer.Write([]byte("{}"))
+	_ = writer.Close()
+	truncated := body.Bytes()[:5]
+
+	req := httptest.NewRequest("POST", "/aggregator/clusters/cluster1/sync", bytes.NewReader(truncated))
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Tracks the clusters with a summary update in progress, and whether another update was requested meanwhile.
+// This coalesces the updates for clusters that sync often, so at most one runs per cluster.
+var (
+	summaryUpdates      = make(map[string]bool) // cluster name -> another update is pending
+	summaryUpdatesMutex = sync.Mutex{}
+)
+
+// Recomputes the ClusterSummary and NamespaceUsage nodes for the cluster in the background.
+func requestSummaryUpdate(clusterName string) {
+	summaryUpdatesMutex.Lock()
+	defer summaryUpdatesMutex.Unlock()
+	if _, running := summaryUpdates[clusterName]; running {
+		summaryUpdates[clusterName] = true
+		return
+	}
+	summaryUpdates[clusterName] = false
+	runInBackground(func() { updateClusterSummary(clusterName) })
+}
+
+func updateClusterSummary(clusterName string) {
+	ctx := db.WithLane(context.Background(), db.BulkLane)
+	for {
+		summary, err := db.ComputeClusterSummary(ctx, clusterName)
+		if err == nil {
+			_, err = db.SaveClusterSummary(ctx, summary)
+		}
+		if err != nil {
+			logger.Warning("Error updating summary for cluster ", clusterName, ": ", err)
+		}
+		usages, err := db.ComputeNamespaceUsage(ctx, clusterName)
+		if err == nil {
+			err = db.SaveNamespaceUsage(ctx, clusterName, usages)
+		}
+		if err != nil {
+			logger.Warning("Error updating namespace usage for cluster ", clusterName, ": ", err)
+		}
+
+		summaryUpdatesMutex.Lock()
+		if !summaryUpdates[clusterName] {
+			delete(summaryUpdates, clusterName)
+			summaryUpdatesMutex.Unlock()
+			return
+		}
+		summaryUpdates[clusterName] = false
+		summaryUpdatesMutex.Unlock()
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Max nodes listed in a clusterless nodes report, the counts include every node.
+const clusterlessReportNodes = 100
+
+var errClusterlessRunning = errors.New("The nodes without the cluster property are already being repaired")
+
+// Outcome of the last check for nodes without the cluster property.
+type ClusterlessNodesReport struct {
+	Checked      time.Time            `json:"checked"`
+	Found        int                  `json:"found"`
+	Repaired     int                  `json:"repaired"`
+	Deleted      int                  `json:"deleted"`
+	Unattributed int                  `json:"unattributed"`
+	Nodes        []db.ClusterlessNode `json:"nodes"` // The first nodes found by UID.
+}
+
+var (
+	clusterlessRunning bool
+	clusterlessReport  = ClusterlessNodesReport{Nodes: []db.ClusterlessNode{}}
+	clusterlessMutex   = sync.Mutex{}
+)
+
+// Finds the nodes without the cluster property and attributes them to the cluster of their UID prefix. The nodes of
+// each cluster are repaired or deleted while the syncs of the cluster wait, the ones without a prefix are reported.
+func repairClusterlessNodes(ctx context.Context) (ClusterlessNodesReport, error) {
+	clusterlessMutex.Lock()
+	if clusterlessRunning {
+		clusterlessMutex.Unlock()
+		return ClusterlessNodesReport{}, errClusterlessRunning
+	}
+	clusterlessRunning = true
+	clusterlessMutex.Unlock()
+	defer func() {
+		clusterlessMutex.Lock()
+		clusterlessRunning = false
+		clusterlessMutex.Unlock()
+	}()
+
+	report := ClusterlessNodesReport{Checked: time.Now(), Nodes: []db.ClusterlessNode{}}
+	nodes, err := db.ClusterlessNodes(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Found = len(nodes)
+	byCluster := make(map[string][]db.ClusterlessNode)
+	clusters := []string{}
+	for _, n := range nodes {
+		if n.Cluster == "" {
+			n.Action = db.CLUSTERLESS_UNATTRIBUTED
+			report.add(n)
+			continue
+		}
+		if _, ok := byCluster[n.Cluster]; !ok {
+			clusters = append(clusters, n.Cluster)
+		}
+		byCluster[n.Cluster] = append(byCluster[n.Cluster], n)
+	}
+	for _, clusterName := range clusters {
+		lockCtx, syncState, err := lockClusterSync(ctx, clusterName)
+		if err != nil {
+			return report, err
+		}
+		repaired, err := db.RepairClusterlessNodes(lockCtx, clusterName, byCluster[clusterName])
+		syncState.unlock()
+		if err != nil {
+			logger.Warningf("Error repairing the nodes of cluster %s without the cluster property: %s",
+				clusterName, err)
+			return report, err
+		}
+		for _, n := range repaired {
+			report.add(n)
+		}
+	}
+	if report.Found > 0 {
+		logger.Warningf("Found %d nodes without the cluster property: %d repaired, %d deleted and %d unattributed.",
+			report.Found, report.Repaired, report.Deleted, report.Unattributed)
+	}
+	return report, nil
+}
+
+// Counts the node in the report, and lists it while the report isn't full.
+func (report *ClusterlessNodesReport) add(n db.ClusterlessNode) {
+	switch n.Action {
+	case db.CLUSTERLESS_REPAIRED:
+		report.Repaired++
+	case db.CLUSTERLESS_DELETED:
+		report.Deleted++
+	case db.CLUSTERLESS_UNATTRIBUTED:
+		report.Unattributed++
+	}
+	metrics.ClusterlessNodes.WithLabelValues(n.Action).Inc()
+	if len(report.Nodes) < clusterlessReportNodes {
+		report.Nodes = append(report.Nodes, n)
+	}
+}
+
+// Checks the graph for nodes without the cluster property and keeps the report.
+func checkClusterlessNodes(ctx context.Context) (ClusterlessNodesReport, error) {
+	report, err := repairClusterlessNodes(ctx)
+	if err == errClusterlessRunning {
+		return report, err
+	}
+	clusterlessMutex.Lock()
+	clusterlessReport = report
+	clusterlessMutex.Unlock()
+	return report, err
+}
+
+// Repairs or deletes the nodes without the cluster property every CLUSTERLESS_NODES_RATE_MS. Such nodes are left
+// by bugged writes, the resyncs of their cluster can't see them.
+func ClusterlessNodesJob() {
+	if config.Cfg.ClusterlessNodesRateMS <= 0 {
+		logger.Info("Disabled the clusterless nodes job, CLUSTERLESS_NODES_RATE_MS is 0.")
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.Cfg.ClusterlessNodesRateMS) * time.Millisecond)
+		ctx := db.WithLane(context.Background(), db.BulkLane)
+		if _, err := checkClusterlessNodes(ctx); err != nil && err != errClusterlessRunning {
+			logger.Warning("Error checking the nodes without the cluster property: ", err)
+		}
+	}
+}
+
+// ClusterlessNodes responds with the report of the last check for nodes without the cluster property. POST checks
+// and repairs them now.
+func ClusterlessNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		if _, err := checkClusterlessNodes(r.Context()); err == errClusterlessRunning {
+			respondError(w, http.StatusConflict, ERROR_OPERATION_IN_PROGRESS, err.Error(),
+				map[string]string{"operation": "clusterless-nodes"})
+			return
+		} else if err != nil {
+			respondError(w, http.StatusInternalServerError, ERROR_INTERNAL,
+				"Error repairing the nodes without the cluster property: "+err.Error(), nil)
+			return
+		}
+	}
+	clusterlessMutex.Lock()
+	report := clusterlessReport
+	clusterlessMutex.Unlock()
+	if encodeError := json.NewEncoder(w).Encode(report); encodeError != nil {
+		logger.Error("Error responding to ClusterlessNodes: ", encodeError)
+	}
+}
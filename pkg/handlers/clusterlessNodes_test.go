@@ -0,0 +1,50 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterlessNodes(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Pod {_uid:'c1/a', kind:'pod'}), (:Pod {_uid:'c2/b', kind:'pod'}), (:Pod {_uid:'orphan', kind:'pod'})")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	ClusterlessNodes(w, httptest.NewRequest("POST", "/aggregator/admin/clusterless-nodes", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report ClusterlessNodesReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, 3, report.Found)
+	assert.Equal(t, []int{1, 1, 1}, []int{report.Repaired, report.Deleted, report.Unattributed})
+	assert.Len(t, report.Nodes, 3)
+	assert.Equal(t, 1, computeNodeCount(ctx, "c1"))
+
+	// GET responds with the last report, the unattributed node is still there.
+	w = httptest.NewRecorder()
+	ClusterlessNodes(w, httptest.NewRequest("GET", "/aggregator/admin/clusterless-nodes", nil))
+	report = ClusterlessNodesReport{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, 3, report.Found)
+
+	clusterlessMutex.Lock()
+	clusterlessRunning = true
+	clusterlessMutex.Unlock()
+	w = httptest.NewRecorder()
+	ClusterlessNodes(w, httptest.NewRequest("POST", "/aggregator/admin/clusterless-nodes", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	clusterlessMutex.Lock()
+	clusterlessRunning = false
+	clusterlessMutex.Unlock()
+}
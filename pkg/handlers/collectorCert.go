@@ -0,0 +1,39 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+)
+
+type internalListenerKey struct{}
+
+// Marks the context of the requests served by an INTERNAL_ADDRESS listener, they don't need a collector certificate.
+func WithInternalListener(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalListenerKey{}, true)
+}
+
+// Returns true when the request came through an INTERNAL_ADDRESS listener.
+func internalRequest(r *http.Request) bool {
+	internal, _ := r.Context().Value(internalListenerKey{}).(bool)
+	return internal
+}
+
+// RequireCollectorCert wraps a collector route so it rejects the requests without a client certificate verified
+// with COLLECTOR_CA_FILES, when it's set. The TLS handshake already rejected the certificates it can't verify. The
+// requests from the INTERNAL_ADDRESS listeners are let through.
+func RequireCollectorCert(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Cfg.CollectorCAFiles != "" && !internalRequest(r) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			logger.Warning("Rejected request without a collector client certificate for ", r.URL.Path)
+			respondError(w, http.StatusUnauthorized, ERROR_CLIENT_CERT_REQUIRED,
+				"A client certificate verified with COLLECTOR_CA_FILES is required.", nil)
+			return
+		}
+		next(w, r)
+	}
+}
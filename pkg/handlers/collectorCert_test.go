@@ -0,0 +1,41 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RequireCollectorCert(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	handler := RequireCollectorCert(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	config.Cfg.CollectorCAFiles = ""
+	response := httptest.NewRecorder()
+	handler(response, httptest.NewRequest("POST", "/aggregator/clusters/c1/sync", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	config.Cfg.CollectorCAFiles = "/certs/ca.crt"
+	response = httptest.NewRecorder()
+	handler(response, httptest.NewRequest("POST", "/aggregator/clusters/c1/sync", nil))
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+
+	request := httptest.NewRequest("POST", "/aggregator/clusters/c1/sync", nil)
+	request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{&x509.Certificate{}}}}
+	response = httptest.NewRecorder()
+	handler(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	request = httptest.NewRequest("POST", "/aggregator/clusters/c1/sync", nil)
+	response = httptest.NewRecorder()
+	handler(response, request.WithContext(WithInternalListener(request.Context())))
+	assert.Equal(t, http.StatusOK, response.Code, "The internal listeners don't need a certificate.")
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// States of the collector of a cluster.
+const (
+	COLLECTOR_UP      = "Up"      // It has a session, answered the last ping or its addon is available.
+	COLLECTOR_DOWN    = "Down"    // Its last pings failed or its addon isn't available.
+	COLLECTOR_UNKNOWN = "Unknown" // No session, health URL or addon status to tell.
+)
+
+const (
+	collectorPingFailures    = 2  // Failed pings in a row before the collector is Down.
+	collectorPingConcurrency = 10 // Collectors pinged at the same time.
+)
+
+// Status of the collector of a cluster, as in the status API. A cluster without resources is empty when its
+// collector is Up, and not reporting when it's Down.
+type CollectorStatus struct {
+	State         string             `json:"state"`
+	Source        string             `json:"source,omitempty"` // What the state comes from: session, ping or addon.
+	HealthURL     string             `json:"healthURL,omitempty"`
+	LastPing      *time.Time         `json:"lastPing,omitempty"`
+	LastPingError string             `json:"lastPingError,omitempty"`
+	Addon         *db.CollectorAddon `json:"addon,omitempty"` // Only with COLLECTOR_ADDON_NAME.
+}
+
+// Pings of the health URL sent by a collector.
+type collectorPing struct {
+	url       string
+	lastPing  time.Time // Zero until the first ping.
+	lastError string
+	failures  int // Failed pings in a row.
+}
+
+var (
+	collectorPings      = make(map[string]*collectorPing)
+	collectorPingsMutex = sync.Mutex{}
+	collectorPingClient = &http.Client{
+		// A collector answers its health URL itself, a redirect would send the ping somewhere else.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}
+)
+
+// Records the health URL sent by the collector of the cluster. URLs that aren't http or https are ignored.
+func recordCollectorHealthURL(clusterName, healthURL string) {
+	parsed, err := url.Parse(healthURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		logger.Warningf("Ignoring invalid health URL %q from the collector of cluster %s", healthURL, clusterName)
+		return
+	}
+	collectorPingsMutex.Lock()
+	defer collectorPingsMutex.Unlock()
+	if ping, ok := collectorPings[clusterName]; !ok || ping.url != healthURL {
+		collectorPings[clusterName] = &collectorPing{url: healthURL}
+	}
+}
+
+// Pings the health URL, an answer with a 2xx status means the collector is up.
+func pingCollector(ctx context.Context, healthURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Cfg.CollectorPingTimeoutMS)*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := collectorPingClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Health URL responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Pings the health URLs of all the collectors and records the results.
+func pingCollectors(ctx context.Context) {
+	collectorPingsMutex.Lock()
+	targets := make(map[string]string, len(collectorPings))
+	for clusterName, ping := range collectorPings {
+		targets[clusterName] = ping.url
+	}
+	collectorPingsMutex.Unlock()
+
+	slots := make(chan struct{}, collectorPingConcurrency)
+	wg := sync.WaitGroup{}
+	for clusterName, healthURL := range targets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(clusterName, healthURL string) {
+			defer func() { <-slots; wg.Done() }()
+			err := pingCollector(ctx, healthURL)
+			recordCollectorPing(clusterName, healthURL, err, time.Now())
+		}(clusterName, healthURL)
+	}
+	wg.Wait()
+}
+
+// Records the result of a ping, unless the collector sent another URL in the meantime.
+func recordCollectorPing(clusterName, healthURL string, err error, now time.Time) {
+	collectorPingsMutex.Lock()
+	defer collectorPingsMutex.Unlock()
+	ping, ok := collectorPings[clusterName]
+	if !ok || ping.url != healthURL {
+		return
+	}
+	ping.lastPing = now
+	if err == nil {
+		if ping.failures >= collectorPingFailures {
+			logger.Infof("Collector of cluster %s is up again", clusterName)
+		}
+		ping.failures, ping.lastError = 0, ""
+		metrics.SetClusterGauge(metrics.CollectorUp, clusterName, 1)
+		return
+	}
+	ping.failures++
+	ping.lastError = err.Error()
+	if ping.failures == collectorPingFailures {
+		logger.Warningf("Collector of cluster %s is down, %d pings failed: %s", clusterName, ping.failures, err)
+		metrics.SetClusterGauge(metrics.CollectorUp, clusterName, 0)
+	}
+}
+
+// Returns the status of the collector of the cluster. An open session is the strongest sign the collector is up,
+// then its pings and then the status of its addon.
+func getCollectorStatus(clusterName string) CollectorStatus {
+	status := CollectorStatus{State: COLLECTOR_UNKNOWN}
+	if addon, ok := db.GetCollectorAddon(clusterName); ok {
+		status.Addon = &addon
+		status.State, status.Source = COLLECTOR_DOWN, "addon"
+		if addon.Available {
+			status.State = COLLECTOR_UP
+		}
+	}
+	collectorPingsMutex.Lock()
+	if ping, ok := collectorPings[clusterName]; ok {
+		status.HealthURL = ping.url
+		if !ping.lastPing.IsZero() {
+			lastPing := ping.lastPing
+			status.LastPing, status.LastPingError = &lastPing, ping.lastError
+			if ping.failures == 0 {
+				status.State, status.Source = COLLECTOR_UP, "ping"
+			} else if ping.failures >= collectorPingFailures {
+				status.State, status.Source = COLLECTOR_DOWN, "ping"
+			}
+		}
+	}
+	collectorPingsMutex.Unlock()
+	collectorSessionsMutex.Lock()
+	_, hasSession := collectorSessions[clusterName]
+	collectorSessionsMutex.Unlock()
+	if hasSession {
+		status.State, status.Source = COLLECTOR_UP, "session"
+	}
+	return status
+}
+
+// Pings the health URLs of the collectors every COLLECTOR_PING_RATE_MS, when it's set.
+func CollectorPingJob() {
+	if config.Cfg.CollectorPingRateMS <= 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.Cfg.CollectorPingRateMS) * time.Millisecond)
+		pingCollectors(context.Background())
+	}
+}
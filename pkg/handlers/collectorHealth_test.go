@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func clearCollectorHealth(clusterName string) {
+	collectorPingsMutex.Lock()
+	delete(collectorPings, clusterName)
+	collectorPingsMutex.Unlock()
+	db.DeleteCollectorAddon(clusterName)
+}
+
+func Test_recordCollectorHealthURL(t *testing.T) {
+	defer clearCollectorHealth("health-url")
+	recordCollectorHealthURL("health-url", "file:///etc/passwd")
+	recordCollectorHealthURL("health-url", "http://")
+	assert.Equal(t, "", getCollectorStatus("health-url").HealthURL, "Only http and https URLs are pinged.")
+
+	recordCollectorHealthURL("health-url", "https://collector.c1:5010/healthz")
+	assert.Equal(t, "https://collector.c1:5010/healthz", getCollectorStatus("health-url").HealthURL)
+}
+
+func Test_pingCollectors(t *testing.T) {
+	up := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	defer clearCollectorHealth("ping")
+
+	recordCollectorHealthURL("ping", server.URL)
+	assert.Equal(t, COLLECTOR_UNKNOWN, getCollectorStatus("ping").State, "Not pinged yet.")
+
+	pingCollectors(context.Background())
+	status := getCollectorStatus("ping")
+	assert.Equal(t, COLLECTOR_UP, status.State)
+	assert.Equal(t, "ping", status.Source)
+	assert.NotNil(t, status.LastPing)
+
+	// A single failed ping doesn't make the collector down.
+	up = false
+	pingCollectors(context.Background())
+	status = getCollectorStatus("ping")
+	assert.Equal(t, COLLECTOR_UNKNOWN, status.State)
+	assert.Contains(t, status.LastPingError, "503")
+
+	pingCollectors(context.Background())
+	assert.Equal(t, COLLECTOR_DOWN, getCollectorStatus("ping").State)
+
+	up = true
+	pingCollectors(context.Background())
+	assert.Equal(t, COLLECTOR_UP, getCollectorStatus("ping").State)
+}
+
+func Test_pingCollector_redirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	assert.Error(t, pingCollector(context.Background(), server.URL), "Redirects aren't followed.")
+}
+
+func Test_getCollectorStatus_precedence(t *testing.T) {
+	defer clearCollectorHealth("precedence")
+	db.SetCollectorAddon("precedence", db.CollectorAddon{Available: false, Reason: "ProbeUnavailable"})
+	status := getCollectorStatus("precedence")
+	assert.Equal(t, COLLECTOR_DOWN, status.State)
+	assert.Equal(t, "addon", status.Source)
+	assert.Equal(t, "ProbeUnavailable", status.Addon.Reason)
+
+	// A successful ping wins over the addon.
+	recordCollectorHealthURL("precedence", "http://collector.precedence/healthz")
+	recordCollectorPing("precedence", "http://collector.precedence/healthz", nil, time.Now())
+	assert.Equal(t, COLLECTOR_UP, getCollectorStatus("precedence").State)
+
+	// An open session wins over failed pings.
+	recordCollectorPing("precedence", "http://collector.precedence/healthz", assert.AnError, time.Now())
+	recordCollectorPing("precedence", "http://collector.precedence/healthz", assert.AnError, time.Now())
+	assert.Equal(t, COLLECTOR_DOWN, getCollectorStatus("precedence").State)
+	session := openSession("precedence")
+	defer session.close()
+	status = getCollectorStatus("precedence")
+	assert.Equal(t, COLLECTOR_UP, status.State)
+	assert.Equal(t, "session", status.Source)
+
+	// A ping to a URL the collector no longer sends is ignored.
+	recordCollectorHealthURL("precedence", "http://collector.precedence:8080/healthz")
+	recordCollectorPing("precedence", "http://collector.precedence/healthz", nil, time.Now())
+	assert.Nil(t, getCollectorStatus("precedence").LastPing)
+}
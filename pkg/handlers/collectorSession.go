@@ -0,0 +1,322 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Types of the messages exchanged with a collector session.
+const (
+	SESSION_SYNC          = "sync"         // Collector -> aggregator, a SyncEvent.
+	SESSION_SYNC_RESPONSE = "syncResponse" // Aggregator -> collector, the SyncResponse to a sync message.
+	SESSION_DIRECTIVE     = "directive"    // Aggregator -> collector, a Directive.
+)
+
+// Actions of the directives pushed to collector sessions.
+const (
+	DIRECTIVE_RESYNC   = "resync"   // Send a resync (ClearAll) with every resource.
+	DIRECTIVE_THROTTLE = "throttle" // Wait RetryAfterMS before sending the next sync.
+	DIRECTIVE_CONFIG   = "config"   // The aggregator settings changed.
+)
+
+// How long a collector is asked to wait after its sync is rejected because of the request limit.
+var throttleRetryAfter = 5 * time.Second
+
+// Message exchanged with a collector session. Every message is a JSON text frame.
+type SessionMessage struct {
+	Type      string          `json:"type"`
+	RequestId int             `json:"requestId,omitempty"`
+	Sync      json.RawMessage `json:"sync,omitempty"`      // sync: the SyncEvent, same as the body of a sync request.
+	Status    int             `json:"status,omitempty"`    // syncResponse: the status code of a sync request.
+	Response  *SyncResponse   `json:"response,omitempty"`  // syncResponse
+	Directive *Directive      `json:"directive,omitempty"` // directive
+}
+
+// Directive pushed by the aggregator to a collector session.
+type Directive struct {
+	Action        string   `json:"action"`
+	Reason        string   `json:"reason,omitempty"`
+	RetryAfterMS  int      `json:"retryAfterMS,omitempty"`  // throttle
+	Changes       []string `json:"changes,omitempty"`       // config, e.g. "chunkSize: 40 -> 100"
+	ExcludedKinds []string `json:"excludedKinds,omitempty"` // config, kinds the collector doesn't need to send.
+}
+
+type collectorSession struct {
+	clusterName string
+	send        chan SessionMessage // Written to the connection by writeMessages.
+	done        chan struct{}       // Closed when the session ends.
+	closeOnce   sync.Once
+}
+
+// Open collector sessions, at most one per cluster.
+var (
+	collectorSessions      = make(map[string]*collectorSession)
+	collectorSessionsMutex = sync.Mutex{}
+	sessionUpgrader        = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+)
+
+// CollectorSession upgrades the request to a WebSocket session with the collector of the cluster.
+// The collector streams its sync events as messages instead of sync requests, and the aggregator answers each one
+// and pushes directives back on the same connection. A new session from the cluster replaces the previous one.
+func CollectorSession(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["id"]
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+	conn, err := sessionUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Warning("Error opening session for cluster ", clusterName, ": ", err) // Upgrade already responded.
+		return
+	}
+	session := openSession(clusterName)
+	defer session.close()
+	logger.Info("Opened collector session for cluster ", clusterName)
+
+	go session.writeMessages(conn)
+	session.readMessages(r, conn)
+	logger.Info("Closed collector session for cluster ", clusterName)
+}
+
+func openSession(clusterName string) *collectorSession {
+	session := &collectorSession{
+		clusterName: clusterName,
+		send:        make(chan SessionMessage, 16),
+		done:        make(chan struct{}),
+	}
+	collectorSessionsMutex.Lock()
+	previous := collectorSessions[clusterName]
+	collectorSessions[clusterName] = session
+	collectorSessionsMutex.Unlock()
+	if previous != nil {
+		logger.Info("Replacing the previous collector session for cluster ", clusterName)
+		previous.close()
+	}
+	metrics.CollectorSessions.Inc()
+	return session
+}
+
+func (s *collectorSession) close() {
+	s.closeOnce.Do(func() {
+		collectorSessionsMutex.Lock()
+		if collectorSessions[s.clusterName] == s {
+			delete(collectorSessions, s.clusterName)
+		}
+		collectorSessionsMutex.Unlock()
+		close(s.done)
+		metrics.CollectorSessions.Dec()
+	})
+}
+
+// Queues the directive for the collector without waiting, so it can be pushed while holding the sync lock of the
+// cluster. Returns false if the session has ended or its queue is full, the callers fall back, e.g. requestResync
+// rejects the next delta instead.
+func (s *collectorSession) pushDirective(directive Directive) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	select {
+	case s.send <- SessionMessage{Type: SESSION_DIRECTIVE, Directive: &directive}:
+	default:
+		logger.Warningf("Not pushing the %s directive to the collector session for cluster %s, %d messages are "+
+			"waiting to be sent.", directive.Action, s.clusterName, cap(s.send))
+		return false
+	}
+	metrics.SessionDirectives.WithLabelValues(directive.Action).Inc()
+	return true
+}
+
+// Queues the message for the collector, returns false if the session has ended.
+func (s *collectorSession) push(message SessionMessage) bool {
+	select {
+	case s.send <- message:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func pongWait() time.Duration {
+	return 2 * time.Duration(config.Cfg.SessionPingIntervalMS) * time.Millisecond
+}
+
+// Processes the messages from the collector, one at a time, until the connection is closed.
+func (s *collectorSession) readMessages(r *http.Request, conn *websocket.Conn) {
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait()))
+	})
+	for {
+		// Reset on every message, so a long sync doesn't count against the pong deadline.
+		if err := conn.SetReadDeadline(time.Now().Add(pongWait())); err != nil {
+			return
+		}
+		var message SessionMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Warning("Error reading from collector session for cluster ", s.clusterName, ": ", err)
+			}
+			return
+		}
+		if message.Type != SESSION_SYNC {
+			logger.Warningf("Ignoring message of type %q from collector session for cluster %s",
+				message.Type, s.clusterName)
+			continue
+		}
+		if !s.sync(r, message) {
+			return
+		}
+	}
+}
+
+// Processes a sync message like a sync request and pushes the response.
+// Also asks the collector to slow down when it's over the request limit, and to resync when its delta is stale.
+func (s *collectorSession) sync(r *http.Request, message SessionMessage) bool {
+	reply := SessionMessage{Type: SESSION_SYNC_RESPONSE, RequestId: message.RequestId}
+	if tooManyRequests(s.clusterName) {
+		reply.Status = http.StatusTooManyRequests
+		reply.Response = &SyncResponse{Version: config.AGGREGATOR_API_VERSION}
+		setBackpressure(reply.Response, pendingRequestCount())
+		if !s.push(reply) {
+			return false
+		}
+		// Not pushed when the queue is full, the reply has the 429 status.
+		s.pushDirective(Directive{
+			Action:       DIRECTIVE_THROTTLE,
+			Reason:       "Aggregator has many pending requests.",
+			RetryAfterMS: int(throttleRetryAfter / time.Millisecond),
+		})
+		return true
+	}
+
+	status, response := processSync(r.Context(), s.clusterName, bytes.NewReader(message.Sync))
+	reply.Status, reply.Response = status, &response
+	if !s.push(reply) {
+		return false
+	}
+	if status == http.StatusConflict {
+		// Not pushed when the queue is full, the reply has the 409 status.
+		s.pushDirective(Directive{
+			Action: DIRECTIVE_RESYNC,
+			Reason: "The delta was built against the state before the last resync.",
+		})
+	}
+	return true
+}
+
+// Writes the queued messages to the connection and pings the collector, until the session ends.
+// This is the only goroutine writing to the connection.
+func (s *collectorSession) writeMessages(conn *websocket.Conn) {
+	ticker := time.NewTicker(time.Duration(config.Cfg.SessionPingIntervalMS) * time.Millisecond)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	writeWait := pongWait()
+	for {
+		select {
+		case message := <-s.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(message); err != nil {
+				logger.Warning("Error writing to collector session for cluster ", s.clusterName, ": ", err)
+				s.close()
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				s.close()
+				return
+			}
+		case <-s.done:
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+			return
+		}
+	}
+}
+
+// Pushes the directive to the session of the cluster. Returns whether the cluster has a session, and whether the
+// directive was pushed, i.e. the session wasn't closing nor its messages backed up.
+func PushDirective(clusterName string, directive Directive) (hasSession, pushed bool) {
+	collectorSessionsMutex.Lock()
+	session := collectorSessions[clusterName]
+	collectorSessionsMutex.Unlock()
+	if session == nil {
+		return false, false
+	}
+	return true, session.pushDirective(directive)
+}
+
+// Pushes the directive to every session. Returns the number of sessions it was pushed to.
+func BroadcastDirective(directive Directive) int {
+	collectorSessionsMutex.Lock()
+	clusters := make([]string, 0, len(collectorSessions))
+	for clusterName := range collectorSessions {
+		clusters = append(clusters, clusterName)
+	}
+	collectorSessionsMutex.Unlock()
+	pushed := 0
+	for _, clusterName := range clusters {
+		if _, ok := PushDirective(clusterName, directive); ok {
+			pushed++
+		}
+	}
+	return pushed
+}
+
+// Tells the collector sessions that the settings were reconciled with the SearchAggregator resource.
+func PushConfigChanges(changes []string) {
+	if len(changes) == 0 {
+		return
+	}
+	pushed := BroadcastDirective(Directive{
+		Action:        DIRECTIVE_CONFIG,
+		Changes:       changes,
+		ExcludedKinds: config.ParseList(config.ExcludedKinds()),
+	})
+	logger.V(2).Infof("Pushed config changes to %d collector sessions.", pushed)
+}
+
+// SessionDirective pushes the directive in the body to the session of the cluster, e.g. to request a resync.
+func SessionDirective(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["id"]
+	var directive Directive
+	if err := json.NewDecoder(r.Body).Decode(&directive); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	switch directive.Action {
+	case DIRECTIVE_RESYNC, DIRECTIVE_THROTTLE, DIRECTIVE_CONFIG:
+	default:
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Unknown directive action: "+directive.Action,
+			map[string]string{"parameter": "action"})
+		return
+	}
+	hasSession, pushed := PushDirective(clusterName, directive)
+	if !hasSession {
+		respondError(w, http.StatusNotFound, ERROR_SESSION_NOT_FOUND,
+			"Cluster "+clusterName+" has no collector session.", map[string]string{"cluster": clusterName})
+		return
+	}
+	if !pushed {
+		respondError(w, http.StatusServiceUnavailable, ERROR_SESSION_BUSY,
+			"The collector session of cluster "+clusterName+" has too many messages waiting.",
+			map[string]string{"cluster": clusterName})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Opens a session for the cluster against a test server, and waits until the aggregator registered it.
+func dialSession(t *testing.T, server *httptest.Server, clusterName string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/aggregator/clusters/" + clusterName + "/session"
+	previous := currentSession(clusterName)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		session := currentSession(clusterName)
+		return session != nil && session != previous
+	}, time.Second, 10*time.Millisecond)
+	return conn
+}
+
+func currentSession(clusterName string) *collectorSession {
+	collectorSessionsMutex.Lock()
+	defer collectorSessionsMutex.Unlock()
+	return collectorSessions[clusterName]
+}
+
+func readSessionMessage(t *testing.T, conn *websocket.Conn) SessionMessage {
+	var message SessionMessage
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	assert.NoError(t, conn.ReadJSON(&message))
+	return message
+}
+
+func Test_CollectorSession(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.RequestLimit = 0 // Every sync is throttled, so the test doesn't need a datastore.
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/session", CollectorSession)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn := dialSession(t, server, "c1")
+	defer conn.Close()
+
+	// A throttled sync is answered with 429 and a throttle directive.
+	assert.NoError(t, conn.WriteJSON(SessionMessage{Type: SESSION_SYNC, RequestId: 7, Sync: []byte(`{}`)}))
+	reply := readSessionMessage(t, conn)
+	assert.Equal(t, SESSION_SYNC_RESPONSE, reply.Type)
+	assert.Equal(t, 7, reply.RequestId)
+	assert.Equal(t, http.StatusTooManyRequests, reply.Status)
+	assert.Equal(t, config.Cfg.SyncPayloadHint, reply.Response.MaxPayloadHint)
+	directive := readSessionMessage(t, conn)
+	assert.Equal(t, SESSION_DIRECTIVE, directive.Type)
+	assert.Equal(t, DIRECTIVE_THROTTLE, directive.Directive.Action)
+	assert.Equal(t, 5000, directive.Directive.RetryAfterMS)
+
+	// Directives are pushed to the session of the cluster only.
+	hasSession, pushed := PushDirective("c1", Directive{Action: DIRECTIVE_RESYNC})
+	assert.True(t, hasSession && pushed)
+	hasSession, _ = PushDirective("c2", Directive{Action: DIRECTIVE_RESYNC})
+	assert.False(t, hasSession)
+	assert.Equal(t, DIRECTIVE_RESYNC, readSessionMessage(t, conn).Directive.Action)
+
+	// A new session from the cluster closes the previous one.
+	replacement := dialSession(t, server, "c1")
+	defer replacement.Close()
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+	assert.Equal(t, 1, BroadcastDirective(Directive{Action: DIRECTIVE_CONFIG}))
+	assert.Equal(t, DIRECTIVE_CONFIG, readSessionMessage(t, replacement).Directive.Action)
+}
+
+func Test_SessionDirective(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/session/directives", SessionDirective)
+
+	for body, status := range map[string]int{
+		`{"action":"resync"}`:  http.StatusNotFound, // The cluster has no session.
+		`{"action":"restart"}`: http.StatusBadRequest,
+		`not json`:             http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/aggregator/clusters/none/session/directives", strings.NewReader(body))
+		router.ServeHTTP(w, r)
+		assert.Equal(t, status, w.Code, body)
+	}
+}
+
+// A session that isn't reading its messages doesn't block the syncs pushing directives to it.
+func Test_requestResync_fullSession(t *testing.T) {
+	session := openSession("full-session")
+	defer session.close()
+	for len(session.send) < cap(session.send) {
+		session.send <- SessionMessage{Type: SESSION_DIRECTIVE}
+	}
+
+	_, state, err := lockClusterSync(context.Background(), "full-session")
+	assert.NoError(t, err)
+	defer state.unlock()
+	requestResync("full-session", "test")
+	_, ok := state.checkEpoch("full-session", &SyncEvent{})
+	assert.False(t, ok, "The next delta is rejected when the directive couldn't be pushed.")
+
+	w := httptest.NewRecorder()
+	r := mux.SetURLVars(httptest.NewRequest("POST", "/aggregator/clusters/full-session/session/directives",
+		strings.NewReader(`{"action":"resync"}`)), map[string]string{"id": "full-session"})
+	SessionDirective(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), string(ERROR_SESSION_BUSY))
+}
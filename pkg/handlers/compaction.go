@@ -0,0 +1,30 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// CompactGraph compacts the graph now, outside of COMPACTION_WINDOW, and responds with the stats.
+// Writes from the collectors wait until it completes.
+func CompactGraph(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	stats, err := db.CompactGraph(r.Context())
+	if err == db.ErrCompactionRunning {
+		respondError(w, http.StatusConflict, ERROR_OPERATION_IN_PROGRESS, err.Error(),
+			map[string]string{"operation": "compaction"})
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, ERROR_INTERNAL, "Error compacting the graph: "+err.Error(), nil)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(stats); encodeError != nil {
+		logger.Error("Error responding to CompactGraph: ", encodeError)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Request body for CompileSearch.
+type CompileSearchRequest struct {
+	Search string `json:"search"` // Saved search in the console syntax, e.g. "kind:pod namespace:default"
+}
+
+// Response body for CompileSearch.
+type CompileSearchResponse struct {
+	db.CompiledSearch
+	EstimatedCount    int      `json:"estimatedCount"`    // Number of nodes currently matching the search.
+	UnknownProperties []string `json:"unknownProperties"` // Filter properties not found in the graph schema.
+}
+
+// Returns the node labels to match in compiled searches, nil when KIND_LABELS is disabled.
+func searchKindLabels(ctx context.Context) (map[string]string, error) {
+	if config.Cfg.KindLabels != "true" {
+		return nil, nil
+	}
+	return db.KindLabels(ctx)
+}
+
+// CompileSearch compiles a saved search into a graph query and validates it against the live graph. With
+// RBAC_FILTER, the query and the estimated count only match the resources the user can see.
+func CompileSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var request CompileSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Warning("Error decoding body of compile search request: ", err)
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	access, status, err := searchAccess(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+
+	ctx := r.Context()
+	kindLabels, err := searchKindLabels(ctx)
+	if err != nil {
+		logger.Warning("Error reading node labels for compile search request: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	compiled, err := db.CompileSearchWithKindLabels(request.Search, kindLabels)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_SEARCH, err.Error(), nil)
+		return
+	}
+	if access != nil {
+		compiled = compiled.WithAccess(*access)
+	}
+	response := CompileSearchResponse{CompiledSearch: compiled}
+
+	response.UnknownProperties, err = db.UnknownSearchProperties(ctx, compiled.Filters)
+	if err != nil {
+		logger.Warning("Error reading graph schema for compile search request: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	countResult, err := db.SearchQuery(ctx, compiled.CountQuery, 0)
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	if countResult.Next() {
+		response.EstimatedCount, _ = countResult.Record().GetByIndex(0).(int)
+	}
+
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to CompileSearch: ", encodeError)
+	}
+}
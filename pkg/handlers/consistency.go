@@ -0,0 +1,93 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+const consistencyResyncWindow = 10 // Recent resyncs the consistency score is computed from.
+
+// Mismatches found by a resync between the graph and what the collector sent.
+type resyncConsistency struct {
+	resources          int // Resources in the resync, sent or unchanged.
+	edges              int // Edges in the resync.
+	edgeMismatch       int // Difference between the edges expected after the resync and the ones sent.
+	duplicateResources int // Nodes deleted because their UID was in the graph more than once.
+	duplicateEdges     int
+	errors             int // Resources and edges the resync couldn't write, or unchanged resources not found.
+	received           time.Time
+}
+
+// Returns the score of the resync, from 1 when the graph matched what the collector sent to 0. Each kind of
+// mismatch costs its share of the resync, so a single off edge in a large cluster barely lowers the score.
+func (c resyncConsistency) score() float64 {
+	items := math.Max(float64(c.resources+c.edges), 1)
+	penalty := float64(c.edgeMismatch+c.duplicateResources+c.duplicateEdges+c.errors) / items
+	return math.Max(0, 1-penalty)
+}
+
+// Consistency of the graph of a cluster, as in the status API.
+type ClusterConsistencyStatus struct {
+	Score              float64   `json:"score"`   // Mean score of the recent resyncs, 1 when they all matched.
+	Resyncs            int       `json:"resyncs"` // Resyncs in the score.
+	EdgeMismatches     int       `json:"edgeMismatches"`
+	DuplicateResources int       `json:"duplicateResources"`
+	DuplicateEdges     int       `json:"duplicateEdges"`
+	ErrorRate          float64   `json:"errorRate"` // Resources and edges that failed in the recent resyncs.
+	LastResync         time.Time `json:"lastResync"`
+}
+
+var (
+	clusterConsistency      = make(map[string][]resyncConsistency) // Recent resyncs of each cluster, oldest first.
+	clusterConsistencyMutex = sync.Mutex{}
+)
+
+// Records the mismatches of a resync and updates the consistency score of the cluster.
+func observeResyncConsistency(clusterName string, c resyncConsistency) {
+	clusterConsistencyMutex.Lock()
+	recent := append(clusterConsistency[clusterName], c)
+	if len(recent) > consistencyResyncWindow {
+		recent = recent[len(recent)-consistencyResyncWindow:]
+	}
+	clusterConsistency[clusterName] = recent
+	status := consistencyStatus(recent)
+	clusterConsistencyMutex.Unlock()
+	metrics.SetClusterGauge(metrics.ClusterConsistencyScore, clusterName, status.Score)
+}
+
+func consistencyStatus(recent []resyncConsistency) ClusterConsistencyStatus {
+	status := ClusterConsistencyStatus{Resyncs: len(recent)}
+	items, errors := 0, 0
+	for _, c := range recent {
+		status.Score += c.score()
+		status.EdgeMismatches += c.edgeMismatch
+		status.DuplicateResources += c.duplicateResources
+		status.DuplicateEdges += c.duplicateEdges
+		items += c.resources + c.edges
+		errors += c.errors
+	}
+	status.Score /= float64(len(recent))
+	if items > 0 {
+		status.ErrorRate = float64(errors) / float64(items)
+	}
+	status.LastResync = recent[len(recent)-1].received
+	return status
+}
+
+// Returns the consistency of the cluster, nil when it didn't resync since the aggregator started.
+func getClusterConsistency(clusterName string) *ClusterConsistencyStatus {
+	clusterConsistencyMutex.Lock()
+	defer clusterConsistencyMutex.Unlock()
+	recent := clusterConsistency[clusterName]
+	if len(recent) == 0 {
+		return nil
+	}
+	status := consistencyStatus(recent)
+	return &status
+}
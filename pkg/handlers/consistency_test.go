@@ -0,0 +1,45 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resyncConsistency_score(t *testing.T) {
+	assert.Equal(t, 1.0, resyncConsistency{resources: 10, edges: 10}.score())
+	assert.Equal(t, 1.0, resyncConsistency{}.score(), "An empty resync matched")
+	assert.Equal(t, 0.75, resyncConsistency{resources: 10, edges: 10, edgeMismatch: 2, duplicateResources: 1,
+		duplicateEdges: 1, errors: 1}.score())
+	assert.Equal(t, 0.0, resyncConsistency{resources: 1, errors: 3}.score(), "The score isn't below 0")
+}
+
+func Test_observeResyncConsistency(t *testing.T) {
+	cluster := "inconsistent-cluster"
+	defer func() {
+		clusterConsistencyMutex.Lock()
+		delete(clusterConsistency, cluster)
+		clusterConsistencyMutex.Unlock()
+	}()
+	assert.Nil(t, getClusterConsistency(cluster), "Nothing is known before the first resync")
+
+	received := time.Now()
+	observeResyncConsistency(cluster, resyncConsistency{resources: 8, edges: 2, duplicateResources: 1, errors: 1,
+		received: received.Add(-time.Minute)})
+	observeResyncConsistency(cluster, resyncConsistency{resources: 8, edges: 2, edgeMismatch: 2, received: received})
+	assert.Equal(t, &ClusterConsistencyStatus{Score: 0.8, Resyncs: 2, EdgeMismatches: 2, DuplicateResources: 1,
+		ErrorRate: 0.05, LastResync: received}, getClusterConsistency(cluster))
+
+	// Only the recent resyncs are kept, the score goes back to 1 once they match.
+	for i := 0; i < consistencyResyncWindow; i++ {
+		observeResyncConsistency(cluster, resyncConsistency{resources: 8, edges: 2, received: received})
+	}
+	status := getClusterConsistency(cluster)
+	assert.Equal(t, 1.0, status.Score)
+	assert.Equal(t, consistencyResyncWindow, status.Resyncs)
+	assert.Equal(t, 0, status.EdgeMismatches)
+}
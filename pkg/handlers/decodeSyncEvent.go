@@ -0,0 +1,154 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Same fields as SyncEvent, the fields besides the arrays are decoded into it with json.Unmarshal. Keeps working if
+// SyncEvent gets its own UnmarshalJSON.
+type syncEventFields SyncEvent
+
+// Decodes the SyncEvent streaming the body. Resources and edges are decoded one element at a time,
+// so the decoder never needs to buffer the full body, which is large during a resync. The other fields are collected
+// and decoded with json.Unmarshal, so keys are matched the same way and new fields need no change here.
+// The legacy fields of older collectors are mapped with the PAYLOAD_MAPPINGS.
+func decodeSyncEvent(body io.Reader, syncEvent *SyncEvent) error {
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	mappings := currentPayloadMappings()
+	fields := bytes.NewBufferString("{")
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		// The value is decoded from d, the converted value of a mapped field or the body.
+		d := dec
+		if len(mappings[PAYLOAD_SYNC_EVENT]) > 0 {
+			mappedKey, converted, err := mapSyncEventKey(dec, mappings[PAYLOAD_SYNC_EVENT], key)
+			if err != nil {
+				return fmt.Errorf("error decoding %s: %w", key, err)
+			}
+			if converted != nil {
+				d = json.NewDecoder(bytes.NewReader(converted))
+			}
+			if converted != nil || !strings.EqualFold(mappedKey, key) {
+				key = mappedKey
+				syncEvent.mappedFields++
+			}
+		}
+		decodeResource := func(resources *[]*db.Resource) error {
+			return decodeArray(d, func() error {
+				resource := &db.Resource{}
+				*resources = append(*resources, resource)
+				mapped, err := decodeMapped(d, mappings[PAYLOAD_RESOURCE], resource)
+				syncEvent.mappedFields += mapped
+				return err
+			})
+		}
+		decodeEdge := func(edges *[]db.Edge) error {
+			return decodeArray(d, func() error {
+				var edge db.Edge
+				mapped, err := decodeMapped(d, mappings[PAYLOAD_EDGE], &edge)
+				syncEvent.mappedFields += mapped
+				*edges = append(*edges, edge)
+				return err
+			})
+		}
+		switch strings.ToLower(key) {
+		case "addresources":
+			err = decodeResource(&syncEvent.AddResources)
+		case "updateresources":
+			err = decodeResource(&syncEvent.UpdateResources)
+		case "deleteresources":
+			err = decodeArray(d, func() error {
+				var deleteEvent DeleteResourceEvent
+				mapped, err := decodeMapped(d, mappings[PAYLOAD_DELETE_RESOURCE], &deleteEvent)
+				syncEvent.mappedFields += mapped
+				syncEvent.DeleteResources = append(syncEvent.DeleteResources, deleteEvent)
+				return err
+			})
+		case "unchangedresources":
+			err = decodeArray(d, func() error {
+				var uid string
+				err := d.Decode(&uid)
+				syncEvent.UnchangedResources = append(syncEvent.UnchangedResources, uid)
+				return err
+			})
+		case "addedges":
+			err = decodeEdge(&syncEvent.AddEdges)
+		case "deleteedges":
+			err = decodeEdge(&syncEvent.DeleteEdges)
+		default:
+			err = appendField(d, fields, key)
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding %s: %w", key, err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+	fields.WriteByte('}')
+	return json.Unmarshal(fields.Bytes(), (*syncEventFields)(syncEvent))
+}
+
+// Appends the key and the next value of the decoder to the JSON object being built in fields.
+func appendField(dec *json.Decoder, fields *bytes.Buffer, key string) error {
+	var value json.RawMessage
+	if err := dec.Decode(&value); err != nil {
+		return err
+	}
+	encodedKey, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if fields.Len() > 1 {
+		fields.WriteByte(',')
+	}
+	fields.Write(encodedKey)
+	fields.WriteByte(':')
+	fields.Write(value)
+	return nil
+}
+
+// Calls decodeElement for each element of the array at the current position of the decoder.
+// A null value is accepted as an empty array.
+func decodeArray(dec *json.Decoder, decodeElement func() error) error {
+	token, err := dec.Token()
+	if err != nil || token == nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected an array, got %v", token)
+	}
+	for dec.More() {
+		if err := decodeElement(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, expected json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %s, got %v", expected, token)
+	}
+	return nil
+}
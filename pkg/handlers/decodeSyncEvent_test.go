@@ -0,0 +1,71 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSyncBody = `{
+	"clearAll": true,
+	"requestId": 42,
+	"healthURL": "https://collector.c1.svc:5010/healthz",
+	"fingerprints": true,
+	"edgeChecksum": true,
+	"addResources": [{"kind": "Pod", "uid": "c1/a", "resourceString": "pods", "properties": {"name": "a", "restarts": 3}}],
+	"updateResources": null,
+	"deleteResources": [{"uid": "c1/b"}, {"uid": "c1/d", "deletedAt": "2021-06-01T10:00:00Z", "reason": "Evicted"}],
+	"addEdges": [{"SourceUID": "c1/a", "DestUID": "c1/c", "EdgeType": "ownedBy"}],
+	"deleteEdges": [],
+	"unknownField": {"nested": [1, 2, 3]}
+}`
+
+// Should decode the same SyncEvent as json.Unmarshal.
+func Test_decodeSyncEvent(t *testing.T) {
+	var expected SyncEvent
+	err := json.Unmarshal([]byte(testSyncBody), &expected)
+	assert.Nil(t, err)
+
+	var result SyncEvent
+	err = decodeSyncEvent(strings.NewReader(testSyncBody), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, expected.ClearAll, result.ClearAll)
+	assert.Equal(t, expected.RequestId, result.RequestId)
+	assert.Equal(t, expected.HealthURL, result.HealthURL)
+	assert.True(t, result.Fingerprints)
+	assert.True(t, result.EdgeChecksum)
+	assert.Equal(t, expected.AddResources, result.AddResources)
+	assert.Equal(t, 0, len(result.UpdateResources))
+	assert.Equal(t, expected.DeleteResources, result.DeleteResources)
+	assert.Equal(t, expected.AddEdges, result.AddEdges)
+	assert.Equal(t, 0, len(result.DeleteEdges))
+}
+
+// Keys are matched case-insensitive, same as json.Unmarshal, for the streamed arrays and the other fields.
+func Test_decodeSyncEvent_keyCase(t *testing.T) {
+	body := `{"EPOCH": 3, "SentAt": "2021-06-01T10:00:00Z", "edgeresync": true, "UnchangedResources": ["c1/a"],
+		"ADDEDGES": [{"SourceUID": "c1/a", "DestUID": "c1/c", "EdgeType": "ownedBy"}]}`
+	var expected, result SyncEvent
+	assert.Nil(t, json.Unmarshal([]byte(body), &expected))
+	assert.Nil(t, decodeSyncEvent(strings.NewReader(body), &result))
+	assert.Equal(t, expected, result)
+	assert.Equal(t, int64(3), result.Epoch)
+	assert.Equal(t, []string{"c1/a"}, result.UnchangedResources)
+
+	err := decodeSyncEvent(strings.NewReader(`{"epoch": "3"}`), &result)
+	assert.NotNil(t, err)
+}
+
+func Test_decodeSyncEvent_invalid(t *testing.T) {
+	var result SyncEvent
+	err := decodeSyncEvent(strings.NewReader(`{"addResources": {"kind": "Pod"}}`), &result)
+	assert.NotNil(t, err)
+
+	err = decodeSyncEvent(strings.NewReader(`[]`), &result)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// CompareDatastores responds with the differences between the primary and secondary datastores
+// when dual write is enabled.
+func CompareDatastores(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	report, err := db.CompareDualWriteStores(r.Context())
+	if err != nil {
+		logger.Warning("Error comparing datastores: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(report); encodeError != nil {
+		logger.Error("Error responding to CompareDatastores: ", encodeError)
+	}
+}
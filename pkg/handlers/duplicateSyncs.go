@@ -0,0 +1,110 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Identical syncs a cluster sent in a row, in the status API. A collector stuck in a loop keeps sending the same
+// payload, after DUPLICATE_SYNC_LIMIT of them the next ones are skipped and get the response of the last one.
+type DuplicateSyncStatus struct {
+	Hash    string    `json:"hash"`    // Hash of the payload, without the request id and sentAt.
+	Repeats int       `json:"repeats"` // Times the payload was sent again after the first one.
+	Skipped int       `json:"skipped"` // Repeats that weren't processed.
+	Since   time.Time `json:"since"`   // When the payload was first received.
+}
+
+type duplicateSync struct {
+	DuplicateSyncStatus
+	status   int
+	response SyncResponse
+}
+
+// Last payload of each cluster, with the response it got.
+var (
+	duplicateSyncs      = make(map[string]*duplicateSync)
+	duplicateSyncsMutex = sync.Mutex{}
+)
+
+// Returns the hash of a sync, without the fields that change each time a collector sends the same payload. Returns
+// an empty hash when duplicates aren't detected.
+func syncEventHash(syncEvent SyncEvent) string {
+	if config.Cfg.DuplicateSyncLimit <= 0 {
+		return ""
+	}
+	return payloadHash(syncEvent)
+}
+
+// Returns the hash of the payload of a sync, without the request id and sentAt.
+func payloadHash(syncEvent SyncEvent) string {
+	syncEvent.RequestId, syncEvent.SentAt = 0, time.Time{}
+	encoded, err := json.Marshal(syncEvent)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns the response of the last sync when the sync has the same hash and it was already processed
+// DUPLICATE_SYNC_LIMIT times in a row, to skip it. Syncs that failed are always processed again, so the retries of
+// the collector go through, and so are resyncs, requested to repair the graph even when nothing changed.
+func checkDuplicateSync(clusterName, hash string, clearAll bool) (SyncResponse, bool) {
+	if hash == "" {
+		return SyncResponse{}, false
+	}
+	duplicateSyncsMutex.Lock()
+	defer duplicateSyncsMutex.Unlock()
+	previous, ok := duplicateSyncs[clusterName]
+	if !ok || previous.Hash != hash {
+		return SyncResponse{}, false
+	}
+	previous.Repeats++
+	if previous.Repeats < config.Cfg.DuplicateSyncLimit || previous.status != http.StatusOK || clearAll {
+		return SyncResponse{}, false
+	}
+	previous.Skipped++
+	metrics.DuplicateSyncs.WithLabelValues(metrics.ClusterLabel(clusterName)).Inc()
+	if previous.Skipped == 1 || previous.Skipped%100 == 0 {
+		logger.Warningf("Cluster %s sent the same sync %d times since %s, its collector may be stuck in a loop. "+
+			"Skipped %d of them.", clusterName, previous.Repeats+1, previous.Since.Format(time.RFC3339), previous.Skipped)
+	}
+	return previous.response, true
+}
+
+// Records the response of a processed sync, to compare the next sync of the cluster with it.
+func recordSyncHash(clusterName, hash string, status int, response SyncResponse, now time.Time) {
+	if hash == "" {
+		return
+	}
+	duplicateSyncsMutex.Lock()
+	defer duplicateSyncsMutex.Unlock()
+	previous, ok := duplicateSyncs[clusterName]
+	if !ok || previous.Hash != hash {
+		previous = &duplicateSync{DuplicateSyncStatus: DuplicateSyncStatus{Hash: hash, Since: now}}
+		duplicateSyncs[clusterName] = previous
+	}
+	previous.status, previous.response = status, response
+}
+
+// Returns the identical syncs the cluster sent in a row, nil when its last sync differs from the previous one.
+func getDuplicateSyncs(clusterName string) *DuplicateSyncStatus {
+	duplicateSyncsMutex.Lock()
+	defer duplicateSyncsMutex.Unlock()
+	previous, ok := duplicateSyncs[clusterName]
+	if !ok || previous.Repeats == 0 {
+		return nil
+	}
+	status := previous.DuplicateSyncStatus
+	return &status
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_syncEventHash(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.DuplicateSyncLimit = 3
+	event := SyncEvent{RequestId: 1, SentAt: time.Now(), AddResources: []*db.Resource{
+		{UID: "c1/a", Properties: map[string]interface{}{"kind": "Pod", "name": "a"}}}}
+	hash := syncEventHash(event)
+	assert.NotEmpty(t, hash)
+
+	resent := event
+	resent.RequestId, resent.SentAt = 2, time.Now().Add(time.Second)
+	assert.Equal(t, hash, syncEventHash(resent), "The request id and sentAt change with each send")
+	resent.ClearAll = true
+	assert.NotEqual(t, hash, syncEventHash(resent))
+
+	config.Cfg.DuplicateSyncLimit = 0
+	assert.Empty(t, syncEventHash(event))
+}
+
+func Test_checkDuplicateSync(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	defer func() {
+		duplicateSyncsMutex.Lock()
+		delete(duplicateSyncs, "duplicate-syncs")
+		duplicateSyncsMutex.Unlock()
+	}()
+	config.Cfg.DuplicateSyncLimit = 2
+	now := time.Now()
+	process := func(hash string, status int) bool {
+		if _, duplicate := checkDuplicateSync("duplicate-syncs", hash, false); duplicate {
+			return false
+		}
+		recordSyncHash("duplicate-syncs", hash, status, SyncResponse{TotalAdded: 5}, now)
+		return true
+	}
+
+	assert.True(t, process("a", http.StatusOK))
+	assert.Nil(t, getDuplicateSyncs("duplicate-syncs"))
+	assert.True(t, process("a", http.StatusOK), "Processed DUPLICATE_SYNC_LIMIT times")
+	_, duplicate := checkDuplicateSync("duplicate-syncs", "a", true)
+	assert.False(t, duplicate, "Resyncs are always processed")
+	response, duplicate := checkDuplicateSync("duplicate-syncs", "a", false)
+	assert.True(t, duplicate)
+	assert.Equal(t, 5, response.TotalAdded, "The response of the last sync")
+	assert.Equal(t, &DuplicateSyncStatus{Hash: "a", Repeats: 3, Skipped: 1, Since: now},
+		getDuplicateSyncs("duplicate-syncs"))
+
+	// Another payload starts over, and the failed syncs are retried.
+	assert.True(t, process("b", http.StatusServiceUnavailable))
+	assert.Nil(t, getDuplicateSyncs("duplicate-syncs"))
+	assert.True(t, process("b", http.StatusServiceUnavailable))
+	assert.True(t, process("b", http.StatusServiceUnavailable))
+	assert.Equal(t, 0, getDuplicateSyncs("duplicate-syncs").Skipped)
+}
+
+func Test_processSync_duplicates(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	cluster := "duplicate-sync-health"
+	defer func() {
+		duplicateSyncsMutex.Lock()
+		delete(duplicateSyncs, cluster)
+		duplicateSyncsMutex.Unlock()
+		clusterHealthsMutex.Lock()
+		delete(clusterHealths, cluster)
+		clusterHealthsMutex.Unlock()
+		lastSyncsMutex.Lock()
+		delete(lastSyncs, cluster)
+		lastSyncsMutex.Unlock()
+	}()
+	useTestDatastore(t)
+	config.Cfg.DuplicateSyncLimit, config.Cfg.SkipClusterValidation = 1, "true"
+	sync := func(body string) (int, SyncResponse) {
+		return processSync(context.Background(), cluster, strings.NewReader(body))
+	}
+
+	// An idle cluster keeps sending empty deltas, the skipped ones still count as successful syncs.
+	status, _ := sync(`{"requestId": 1}`)
+	assert.Equal(t, http.StatusOK, status)
+	before := getClusterHealth(cluster, time.Now()).LastSuccess
+	time.Sleep(time.Millisecond)
+	status, response := sync(`{"requestId": 2}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, response.RequestId)
+	assert.Equal(t, 1, getDuplicateSyncs(cluster).Skipped)
+	assert.True(t, getClusterHealth(cluster, time.Now()).LastSuccess.After(before))
+	lastSyncsMutex.Lock()
+	assert.Equal(t, 2, lastSyncs[cluster].Response.RequestId)
+	lastSyncsMutex.Unlock()
+
+	// A resync is processed even when it's the same as the last one.
+	resync := `{"clearAll": true, "addResources": [{"kind": "Pod", "uid": "` + cluster +
+		`/a", "properties": {"name": "a"}}]}`
+	status, response = sync(resync)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, response.TotalAdded)
+	status, response = sync(resync)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 0, getDuplicateSyncs(cluster).Skipped)
+	assert.Zero(t, response.TotalAdded, "The resource was already there, it isn't the response of the last resync.")
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Scheduling decisions of the intercluster edge builder, the labels of the schedule metric.
+const (
+	edgeBuildRun      = "run"      // Normal load, the pass runs at EDGE_BUILD_RATE_MS.
+	edgeBuildIdle     = "idle"     // The pass runs and the next one comes at EDGE_BUILD_IDLE_RATE_MS.
+	edgeBuildDeferred = "deferred" // Too much load, the pass waits for the next check.
+	edgeBuildForced   = "forced"   // Deferred for EDGE_BUILD_MAX_DEFER_MS, the pass runs anyway.
+)
+
+// Returns whether the edge builder runs under the write load, and when it checks again. deferredFor is how long
+// the passes have been deferred in a row.
+func edgeBuildSchedule(load db.WriteLoad, deferredFor time.Duration) (string, time.Duration) {
+	rate := time.Duration(config.EdgeBuildRateMS()) * time.Millisecond
+	maxQPS, maxLatency := float64(config.Cfg.EdgeBuildMaxWriteQPS), float64(config.Cfg.EdgeBuildMaxLatencyMS)
+	overloaded := (maxQPS > 0 && load.WriteQPS > maxQPS) || (maxLatency > 0 && load.LatencyMS > maxLatency)
+	if overloaded {
+		if deferredFor >= time.Duration(config.Cfg.EdgeBuildMaxDeferMS)*time.Millisecond {
+			return edgeBuildForced, rate
+		}
+		return edgeBuildDeferred, rate
+	}
+	idleRate := time.Duration(config.Cfg.EdgeBuildIdleRateMS) * time.Millisecond
+	idle := (maxQPS <= 0 || load.WriteQPS < maxQPS/10) && (maxLatency <= 0 || load.LatencyMS < maxLatency/2)
+	if idle && idleRate > 0 && idleRate < rate {
+		return edgeBuildIdle, idleRate
+	}
+	return edgeBuildRun, rate
+}
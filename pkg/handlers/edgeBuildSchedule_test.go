@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_edgeBuildSchedule(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.EdgeBuildRateMS = 15000
+	config.Cfg.EdgeBuildIdleRateMS = 3000
+	config.Cfg.EdgeBuildMaxDeferMS = 60000
+	config.Cfg.EdgeBuildMaxWriteQPS = 100
+	config.Cfg.EdgeBuildMaxLatencyMS = 500
+	rate, idleRate := 15*time.Second, 3*time.Second
+
+	tests := []struct {
+		name        string
+		load        db.WriteLoad
+		deferredFor time.Duration
+		decision    string
+		wait        time.Duration
+	}{
+		{"idle", db.WriteLoad{WriteQPS: 2, LatencyMS: 10}, 0, edgeBuildIdle, idleRate},
+		{"normal load", db.WriteLoad{WriteQPS: 40, LatencyMS: 10}, 0, edgeBuildRun, rate},
+		{"slow queries", db.WriteLoad{WriteQPS: 2, LatencyMS: 300}, 0, edgeBuildRun, rate},
+		{"too many writes", db.WriteLoad{WriteQPS: 150, LatencyMS: 10}, 0, edgeBuildDeferred, rate},
+		{"too slow", db.WriteLoad{WriteQPS: 2, LatencyMS: 800}, 30 * time.Second, edgeBuildDeferred, rate},
+		{"deferred too long", db.WriteLoad{WriteQPS: 150}, time.Minute, edgeBuildForced, rate},
+	}
+	for _, test := range tests {
+		decision, wait := edgeBuildSchedule(test.load, test.deferredFor)
+		assert.Equal(t, test.decision, decision, test.name)
+		assert.Equal(t, test.wait, wait, test.name)
+	}
+
+	config.Cfg.EdgeBuildMaxWriteQPS, config.Cfg.EdgeBuildMaxLatencyMS = 0, 0
+	decision, _ := edgeBuildSchedule(db.WriteLoad{WriteQPS: 1000, LatencyMS: 5000}, 0)
+	assert.Equal(t, edgeBuildIdle, decision, "Never deferred without limits")
+}
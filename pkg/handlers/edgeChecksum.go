@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Tells whether the response to the sync has the checksum of the stored edges.
+func wantsEdgeChecksum(syncEvent SyncEvent) bool {
+	return syncEvent.EdgeChecksum || syncEvent.EdgeResync || syncEvent.BaseEdgeChecksum != ""
+}
+
+// Prepares the edges of a differential edge sync before the delta is written. With a baseEdgeChecksum, the edges of
+// the delta are only applied when it matches the stored edges, otherwise they'd change an edge set the collector
+// doesn't have, and the response asks for an edge resync. With edgeResync, the edges of the delta become the edges
+// that differ between the full edge list of the collector and the stored edges.
+func prepareEdgeSync(ctx context.Context, clusterName string, syncEvent *SyncEvent, response *SyncResponse) error {
+	if syncEvent.ClearAll || (!syncEvent.EdgeResync && syncEvent.BaseEdgeChecksum == "") {
+		return nil
+	}
+	stored, owned, err := db.ClusterEdges(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+	if syncEvent.EdgeResync {
+		diffEdgeResync(clusterName, syncEvent, stored, owned)
+		return nil
+	}
+	checksum := db.EdgeChecksum(stored)
+	if strings.EqualFold(checksum, syncEvent.BaseEdgeChecksum) {
+		return nil
+	}
+	logger.Warningf("Base edge checksum of the delta from cluster %s doesn't match its %d stored edges, skipping "+
+		"%d added and %d deleted edges and asking for an edge resync.", clusterName, len(stored),
+		len(syncEvent.AddEdges), len(syncEvent.DeleteEdges))
+	metrics.EdgeChecksumMismatches.WithLabelValues(metrics.ClusterLabel(clusterName)).Inc()
+	response.EdgeResyncRequired = true
+
+	// The ownedBy edges built for the added resources are kept, the collector doesn't send them with its edges.
+	built := make(map[db.Edge]bool, len(syncEvent.AddResources))
+	for _, r := range syncEvent.AddResources {
+		if e, ok := r.OwnerEdge(); ok {
+			built[db.EdgeKey(e)] = true
+		}
+	}
+	kept := []db.Edge{}
+	for _, e := range syncEvent.AddEdges {
+		if built[db.EdgeKey(e)] {
+			kept = append(kept, e)
+		}
+	}
+	syncEvent.AddEdges, syncEvent.DeleteEdges = kept, nil
+	return nil
+}
+
+// Replaces the edges of an edge resync with the edges to add and delete so the stored edges match the full edge
+// list sent. The ownedBy edges built from the owner chains are kept, and the edges of the deleted resources go with
+// them.
+func diffEdgeResync(clusterName string, syncEvent *SyncEvent, stored []db.Edge, owned map[db.Edge]bool) {
+	existing := make(map[db.Edge]bool, len(stored))
+	for _, e := range stored {
+		existing[e] = true
+	}
+	sent := make(map[db.Edge]bool, len(syncEvent.AddEdges))
+	edgesToAdd := []db.Edge{}
+	for _, e := range syncEvent.AddEdges {
+		key := db.EdgeKey(e)
+		if sent[key] {
+			continue
+		}
+		sent[key] = true
+		if !existing[key] {
+			edgesToAdd = append(edgesToAdd, e)
+		}
+	}
+	deleted := make(map[string]bool, len(syncEvent.DeleteResources))
+	for _, d := range syncEvent.DeleteResources {
+		deleted[d.UID] = true
+	}
+	edgesToDelete := []db.Edge{}
+	for _, e := range stored {
+		if !sent[e] && !owned[e] && !deleted[e.SourceUID] && !deleted[e.DestUID] {
+			edgesToDelete = append(edgesToDelete, e)
+		}
+	}
+	logger.V(2).Infof("Edge resync of cluster %s: %d edges sent, %d stored, %d to add and %d to delete.",
+		clusterName, len(sent), len(stored), len(edgesToAdd), len(edgesToDelete))
+	syncEvent.AddEdges, syncEvent.DeleteEdges = edgesToAdd, edgesToDelete
+}
+
+// Returns the checksum of the stored edges of the cluster for the response, empty when they can't be read. The
+// collector then sends its next delta without a base checksum, or resyncs its edges.
+func storedEdgeChecksum(ctx context.Context, clusterName string) string {
+	checksum, _, err := db.ClusterEdgeChecksum(ctx, clusterName)
+	if err != nil {
+		logger.Warningf("Error computing the edge checksum of cluster %s: %s", clusterName, err)
+		return ""
+	}
+	return checksum
+}
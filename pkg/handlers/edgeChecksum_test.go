@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_prepareEdgeSync(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (r:ReplicaSet {_uid:'e1/r', cluster:'e1'}), "+
+		"(p:Pod {_uid:'e1/p', cluster:'e1', _ownerDepth:1})-[:ownedBy]->(r), (p)-[:usedBy]->(r), "+
+		"(s:Service {_uid:'e1/s', cluster:'e1'})-[:usedBy]->(r)")
+	assert.NoError(t, err)
+	base := storedEdgeChecksum(ctx, "e1")
+	assert.Len(t, base, 64)
+
+	// A delta based on the stored edges is applied as sent.
+	delta := SyncEvent{BaseEdgeChecksum: base, DeleteEdges: []db.Edge{{SourceUID: "e1/s", EdgeType: "usedBy",
+		DestUID: "e1/r"}}}
+	response := SyncResponse{}
+	assert.NoError(t, prepareEdgeSync(ctx, "e1", &delta, &response))
+	assert.False(t, response.EdgeResyncRequired)
+	assert.Len(t, delta.DeleteEdges, 1)
+	assert.True(t, wantsEdgeChecksum(delta))
+
+	// A delta based on other edges isn't applied, except the ownedBy edges built for the added resources.
+	added := &db.Resource{UID: "e1/q", Kind: "Pod", OwnerChain: []db.OwnerReference{{UID: "e1/r"}}}
+	owner, _ := added.OwnerEdge()
+	delta = SyncEvent{BaseEdgeChecksum: db.EdgeChecksum(nil), AddResources: []*db.Resource{added},
+		AddEdges:    []db.Edge{{SourceUID: "e1/q", EdgeType: "usedBy", DestUID: "e1/s"}, owner},
+		DeleteEdges: []db.Edge{{SourceUID: "e1/s", EdgeType: "usedBy", DestUID: "e1/r"}}}
+	response = SyncResponse{}
+	assert.NoError(t, prepareEdgeSync(ctx, "e1", &delta, &response))
+	assert.True(t, response.EdgeResyncRequired)
+	assert.Equal(t, []db.Edge{owner}, delta.AddEdges)
+	assert.Empty(t, delta.DeleteEdges)
+
+	// An edge resync only writes the edges that differ, and keeps the ownedBy edges built from the owner chains.
+	resync := SyncEvent{EdgeResync: true, AddEdges: []db.Edge{
+		{SourceUID: "e1/p", EdgeType: "usedBy", DestUID: "e1/r", SourceKind: "Pod", DestKind: "ReplicaSet"},
+		{SourceUID: "e1/p", EdgeType: "usedBy", DestUID: "e1/r"},
+		{SourceUID: "e1/p", EdgeType: "runsOn", DestUID: "e1/s"}}}
+	response = SyncResponse{}
+	assert.NoError(t, prepareEdgeSync(ctx, "e1", &resync, &response))
+	assert.False(t, response.EdgeResyncRequired)
+	assert.Equal(t, []db.Edge{{SourceUID: "e1/p", EdgeType: "runsOn", DestUID: "e1/s"}}, resync.AddEdges)
+	assert.Equal(t, []db.Edge{{SourceUID: "e1/s", EdgeType: "usedBy", DestUID: "e1/r"}}, resync.DeleteEdges)
+
+	// The edges of the resources deleted by the delta go with them.
+	resync = SyncEvent{EdgeResync: true, DeleteResources: []DeleteResourceEvent{{UID: "e1/s"}}}
+	assert.NoError(t, prepareEdgeSync(ctx, "e1", &resync, &response))
+	assert.Equal(t, []db.Edge{{SourceUID: "e1/p", EdgeType: "usedBy", DestUID: "e1/r"}}, resync.DeleteEdges)
+
+	// Resyncs and deltas without a checksum are left as they are.
+	resync = SyncEvent{ClearAll: true, EdgeResync: true, AddEdges: []db.Edge{owner}}
+	assert.NoError(t, prepareEdgeSync(ctx, "e1", &resync, &response))
+	assert.Equal(t, []db.Edge{owner}, resync.AddEdges)
+	assert.False(t, wantsEdgeChecksum(SyncEvent{ClearAll: true}))
+	assert.True(t, wantsEdgeChecksum(SyncEvent{ClearAll: true, EdgeChecksum: true}))
+}
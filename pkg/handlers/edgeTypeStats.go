@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Response body for EdgeTypeStats.
+type EdgeTypeStatsResponse struct {
+	Items []db.EdgeTypeCount `json:"items"`
+	Total int                `json:"total"` // Edges of every type.
+}
+
+// Response body for PruneEdges.
+type PruneEdgesResponse struct {
+	Type    string `json:"type"`
+	Cluster string `json:"cluster,omitempty"` // Empty when the edges of every cluster are pruned.
+	Deleted int    `json:"deleted"`           // Edges deleted, or that would be deleted with dryRun.
+	DryRun  bool   `json:"dryRun,omitempty"`
+}
+
+// Returns the cluster parameter, responds 400 when it's invalid.
+func edgeClusterParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	clusterName := r.URL.Query().Get("cluster")
+	if clusterName == "" {
+		return "", true
+	}
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return "", false
+	}
+	return clusterName, true
+}
+
+// EdgeTypeStats responds with the count of the edges of each type by cluster, for the cluster parameter only when
+// it's set.
+func EdgeTypeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName, ok := edgeClusterParam(w, r)
+	if !ok {
+		return
+	}
+	counts, err := db.EdgeTypeStats(r.Context(), clusterName)
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE,
+			"Error counting the edges: "+err.Error(), nil)
+		return
+	}
+	response := EdgeTypeStatsResponse{Items: counts}
+	for _, count := range counts {
+		response.Total += count.Count
+	}
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to EdgeTypeStats: ", encodeError)
+	}
+}
+
+// PruneEdges deletes the edges of the type parameter from or to the resources of the cluster parameter, or of every
+// cluster without it, e.g. to remove an edge type a collector or rule generated by mistake. With dryRun=true it
+// responds with the count of the edges it would delete.
+func PruneEdges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	response := PruneEdgesResponse{Type: r.URL.Query().Get("type")}
+	if response.Type == "" {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "The type parameter is required",
+			map[string]string{"parameter": "type"})
+		return
+	}
+	if response.Type == db.IN_CLUSTER_EDGE {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, db.ErrPruneInCluster.Error(),
+			map[string]string{"parameter": "type"})
+		return
+	}
+	var ok bool
+	if response.Cluster, ok = edgeClusterParam(w, r); !ok {
+		return
+	}
+	if param := r.URL.Query().Get("dryRun"); param != "" {
+		dryRun, err := strconv.ParseBool(param)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid dryRun parameter: "+err.Error(),
+				map[string]string{"parameter": "dryRun"})
+			return
+		}
+		response.DryRun = dryRun
+	}
+
+	ctx := db.WithLane(r.Context(), db.BulkLane)
+	var err error
+	if response.DryRun {
+		response.Deleted, err = db.CountPrunedEdges(ctx, response.Type, response.Cluster)
+	} else {
+		response.Deleted, err = db.PruneEdges(ctx, response.Type, response.Cluster)
+	}
+	if err != nil {
+		logger.Warningf("Error pruning the %s edges, %d deleted: %s", response.Type, response.Deleted, err)
+		respondStatusError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if !response.DryRun && response.Deleted > 0 && response.Cluster != "" {
+		requestSummaryUpdate(response.Cluster)
+	}
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to PruneEdges: ", encodeError)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneEdges(t *testing.T) {
+	useTestDatastore(t)
+	_, err := db.Store.Query(context.Background(), "CREATE (r:ReplicaSet {_uid:'c1/r', kind:'replicaset', "+
+		"cluster:'c1'}), (p:Pod {_uid:'c1/p', kind:'pod', cluster:'c1'})-[:ownedBy]->(r), (p)-[:usedBy]->(r), "+
+		"(:Pod {_uid:'c2/p', kind:'pod', cluster:'c2'})-[:usedBy]->(:Node {_uid:'c2/n', kind:'node', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	EdgeTypeStats(w, httptest.NewRequest("GET", "/aggregator/admin/edges/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats EdgeTypeStatsResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	assert.Equal(t, 3, stats.Total)
+	assert.Len(t, stats.Items, 3)
+
+	prune := func(params string) (int, PruneEdgesResponse) {
+		w := httptest.NewRecorder()
+		PruneEdges(w, httptest.NewRequest("DELETE", "/aggregator/edges?"+params, nil))
+		var response PruneEdgesResponse
+		_ = json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response
+	}
+	status, response := prune("type=usedBy&dryRun=true")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, PruneEdgesResponse{Type: "usedBy", Deleted: 2, DryRun: true}, response)
+	status, response = prune("type=usedBy&cluster=c2")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, PruneEdgesResponse{Type: "usedBy", Cluster: "c2", Deleted: 1}, response)
+	_, response = prune("type=usedBy")
+	assert.Equal(t, 1, response.Deleted, "The edges of every cluster.")
+
+	for _, params := range []string{"", "type=inCluster", "type=usedBy&cluster=invalid/cluster",
+		"type=usedBy&dryRun=maybe"} {
+		status, _ = prune(params)
+		assert.Equal(t, http.StatusBadRequest, status, params)
+	}
+}
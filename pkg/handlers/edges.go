@@ -0,0 +1,67 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Edges responds with the edges of the graph and a summary of the nodes they connect, without writing a query.
+// Use the cluster parameter for the edges from or to a cluster, type for some edge types, interCluster for the
+// intercluster edges only or without them, minWeight to skip the uncertain edges and limit to bound the edges returned.
+func Edges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	opts := db.EdgeOptions{
+		Cluster:   query.Get("cluster"),
+		EdgeTypes: config.ParseList(query.Get("type")),
+	}
+	if opts.Cluster != "" {
+		if err := db.ValidateClusterName(opts.Cluster); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+				map[string]string{"cluster": opts.Cluster})
+			return
+		}
+	}
+	if param := query.Get("interCluster"); param != "" {
+		interCluster, err := strconv.ParseBool(param)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+				"Invalid interCluster parameter: "+err.Error(), map[string]string{"parameter": "interCluster"})
+			return
+		}
+		opts.InterCluster = &interCluster
+	}
+	limit, err := intParam(r, "limit", 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid limit parameter: "+err.Error(),
+			map[string]string{"parameter": "limit"})
+		return
+	}
+	opts.Limit = searchLimit(limit)
+	if opts.MinWeight, err = weightParam(r); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid minWeight parameter: "+err.Error(),
+			map[string]string{"parameter": "minWeight"})
+		return
+	}
+	var status int
+	if opts.Access, status, err = searchAccess(r); err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+
+	edges, err := db.Edges(r.Context(), opts)
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(edges); encodeError != nil {
+		logger.Error("Error responding to Edges: ", encodeError)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Edges(t *testing.T) {
+	useTestDatastore(t)
+
+	_, err := db.Store.Query(context.Background(), "CREATE "+
+		"(:Pod {_uid:'c1/p', kind:'pod', cluster:'c1'})-[:ownedBy]->(:ReplicaSet {_uid:'c1/r', kind:'replicaset', cluster:'c1'})")
+	assert.NoError(t, err)
+
+	request := httptest.NewRequest("GET", "/aggregator/edges?cluster=c1&type=ownedBy&interCluster=false&limit=10", nil)
+	response := httptest.NewRecorder()
+	Edges(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	var result db.EdgesResult
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+	if assert.Equal(t, 1, len(result.Items)) {
+		assert.Equal(t, "c1/r", result.Items[0].Dest.UID)
+	}
+
+	for _, params := range []string{"interCluster=maybe", "limit=many", "type=owned%20By", "cluster=bad.name"} {
+		response = httptest.NewRecorder()
+		Edges(response, httptest.NewRequest("GET", "/aggregator/edges?"+params, nil))
+		assert.Equal(t, http.StatusBadRequest, response.Code, params)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Stable code of an error in the responses, documented by GET /errors/{code}. Clients localize and link the
+// remediation of an error with its code, the message is in English and can change.
+type ErrorCode string
+
+const (
+	ERROR_ADMIN_TOKEN_REQUIRED         ErrorCode = "ADMIN_TOKEN_REQUIRED"
+	ERROR_BLOB_CORRUPTED               ErrorCode = "BLOB_CORRUPTED"
+	ERROR_BLOB_NOT_FOUND               ErrorCode = "BLOB_NOT_FOUND"
+	ERROR_CAPTURE_NOT_FOUND            ErrorCode = "CAPTURE_NOT_FOUND"
+	ERROR_CLIENT_CERT_REQUIRED         ErrorCode = "CLIENT_CERT_REQUIRED"
+	ERROR_CLUSTER_NOT_JOINED           ErrorCode = "CLUSTER_NOT_JOINED"
+	ERROR_CLUSTER_QUARANTINED          ErrorCode = "CLUSTER_QUARANTINED"
+	ERROR_DATASTORE_UNAVAILABLE        ErrorCode = "DATASTORE_UNAVAILABLE"
+	ERROR_EPOCH_CONFLICT               ErrorCode = "EPOCH_CONFLICT"
+	ERROR_FEATURE_DISABLED             ErrorCode = "FEATURE_DISABLED"
+	ERROR_GRAPH_LIMIT_REACHED          ErrorCode = "GRAPH_LIMIT_REACHED"
+	ERROR_IMPERSONATION_REQUIRED       ErrorCode = "IMPERSONATION_REQUIRED"
+	ERROR_IMPERSONATION_UNTRUSTED      ErrorCode = "IMPERSONATION_UNTRUSTED"
+	ERROR_INTERNAL                     ErrorCode = "INTERNAL_ERROR"
+	ERROR_INVALID_BODY                 ErrorCode = "INVALID_BODY"
+	ERROR_INVALID_CLUSTER              ErrorCode = "INVALID_CLUSTER"
+	ERROR_INVALID_PARAMETER            ErrorCode = "INVALID_PARAMETER"
+	ERROR_INVALID_PROPERTY             ErrorCode = "INVALID_PROPERTY"
+	ERROR_INVALID_SEARCH               ErrorCode = "INVALID_SEARCH"
+	ERROR_INVALID_UID                  ErrorCode = "INVALID_UID"
+	ERROR_OPERATION_IN_PROGRESS        ErrorCode = "OPERATION_IN_PROGRESS"
+	ERROR_PROPERTY_HOOK_FAILED         ErrorCode = "PROPERTY_HOOK_FAILED"
+	ERROR_QUARANTINE_NOT_FOUND         ErrorCode = "QUARANTINE_NOT_FOUND"
+	ERROR_READ_ONLY                    ErrorCode = "READ_ONLY"
+	ERROR_REBUILD_NOT_FOUND            ErrorCode = "REBUILD_NOT_FOUND"
+	ERROR_REMAP_CONFLICT               ErrorCode = "REMAP_CONFLICT"
+	ERROR_SCHEMA_VIOLATION             ErrorCode = "SCHEMA_VIOLATION"
+	ERROR_SEARCH_TIMEOUT               ErrorCode = "SEARCH_TIMEOUT"
+	ERROR_SESSION_BUSY                 ErrorCode = "SESSION_BUSY"
+	ERROR_SESSION_NOT_FOUND            ErrorCode = "SESSION_NOT_FOUND"
+	ERROR_SNAPSHOT_NOT_FOUND           ErrorCode = "SNAPSHOT_NOT_FOUND"
+	ERROR_SYNC_NOT_FOUND               ErrorCode = "SYNC_NOT_FOUND"
+	ERROR_TOO_MANY_REQUESTS            ErrorCode = "TOO_MANY_REQUESTS"
+	ERROR_UID_COLLISION                ErrorCode = "UID_COLLISION"
+	ERROR_UNCHANGED_RESOURCE_NOT_FOUND ErrorCode = "UNCHANGED_RESOURCE_NOT_FOUND"
+	ERROR_WRITE_FAILED                 ErrorCode = "WRITE_FAILED"
+)
+
+// Documentation of an error code, for the console and CLI to localize the error and link its remediation.
+type ErrorDoc struct {
+	Code        ErrorCode `json:"code"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Remediation string    `json:"remediation"`
+	Params      []string  `json:"params,omitempty"` // Keys of the params of the responses with the code.
+}
+
+var errorDocs = []ErrorDoc{
+	{ERROR_ADMIN_TOKEN_REQUIRED, "Admin token required",
+		"The request asked for an admin feature, e.g. debugQueries or the sync captures, without the admin token.",
+		"Send the ADMIN_TOKEN of the aggregator in the Authorization header as a bearer token.", nil},
+	{ERROR_BLOB_CORRUPTED, "Blob corrupted",
+		"The blob of a property read from the BLOB_STORE doesn't match the hash stored in the graph.",
+		"Resync the cluster of the resource so its collector sends the property again.", []string{"key"}},
+	{ERROR_BLOB_NOT_FOUND, "Blob not found",
+		"The property of the resource isn't in the blob store, or its blob was deleted.",
+		"Check the property is in BLOB_PROPERTIES and larger than BLOB_MIN_BYTES, or resync the cluster.",
+		[]string{"uid", "property", "key"}},
+	{ERROR_CAPTURE_NOT_FOUND, "Sync capture not found",
+		"No sync capture of the cluster has the ID, it may have been replaced by newer captures.",
+		"List the captures of the cluster for their IDs, SYNC_CAPTURE_COUNT sets how many are kept.",
+		[]string{"cluster", "capture"}},
+	{ERROR_CLIENT_CERT_REQUIRED, "Client certificate required",
+		"The route requires a client certificate verified with COLLECTOR_CA_FILES.",
+		"Configure the collector with a client certificate signed by one of the COLLECTOR_CA_FILES.", nil},
+	{ERROR_CLUSTER_NOT_JOINED, "Cluster not joined",
+		"The sync came from a cluster without a Cluster node, a managed cluster that hasn't joined the hub.",
+		"Import the managed cluster in the hub, its sync is accepted once its Cluster node is synced.",
+		[]string{"cluster"}},
+	{ERROR_CLUSTER_QUARANTINED, "Cluster quarantined",
+		"The syncs of the cluster are rejected by an admin, or by the quarantine after repeated bad syncs.",
+		"Fix the collector of the cluster, then lift the quarantine with DELETE /aggregator/clusters/{id}/quarantine.",
+		[]string{"cluster"}},
+	{ERROR_DATASTORE_UNAVAILABLE, "Datastore unavailable",
+		"RedisGraph couldn't be reached, or a query failed or was canceled. The request can succeed if retried.",
+		"Retry the request later. Check the aggregator logs and the health of RedisGraph if it keeps failing.", nil},
+	{ERROR_EPOCH_CONFLICT, "Epoch conflict",
+		"The delta sync was based on an older resync of the cluster than the current epoch.",
+		"The collector sends a resync, with the Epoch of the response in the following deltas.",
+		[]string{"cluster"}},
+	{ERROR_FEATURE_DISABLED, "Feature disabled",
+		"The request needs a feature that isn't enabled in the configuration of the aggregator.",
+		"Enable the feature with its environment variable, see the README of the aggregator.",
+		[]string{"feature"}},
+	{ERROR_GRAPH_LIMIT_REACHED, "Graph limit reached",
+		"The graph is near GRAPH_MAX_NODES or GRAPH_MAX_EDGES, the syncs of new clusters are rejected.",
+		"Add memory to Redis and raise the caps, or exclude kinds with EXCLUDED_KINDS, see the graph limits metrics.",
+		[]string{"cluster"}},
+	{ERROR_IMPERSONATION_REQUIRED, "User required",
+		"RBAC_FILTER is enabled and the request doesn't have the Impersonate-User header.",
+		"Send the search requests through the search API, it sets the user and groups of the request.", nil},
+	{ERROR_IMPERSONATION_UNTRUSTED, "Impersonation not trusted",
+		"RBAC_FILTER is enabled and the Impersonate-User header came through AGGREGATOR_ADDRESS without the admin token.",
+		"Send the search requests through the search API, on INTERNAL_ADDRESS or with the admin token.", nil},
+	{ERROR_INTERNAL, "Internal error", "The request failed with an unexpected error.",
+		"Retry the request. Check the aggregator logs and report the error if it keeps failing.", nil},
+	{ERROR_INVALID_BODY, "Invalid request body", "The body of the request isn't valid JSON, or valid gzip.",
+		"Send a JSON body as documented for the route.", nil},
+	{ERROR_INVALID_CLUSTER, "Invalid cluster name", "The cluster name isn't a valid Kubernetes name.",
+		"Use the name of the ManagedCluster.", []string{"cluster"}},
+	{ERROR_INVALID_PARAMETER, "Invalid parameter", "A parameter of the request is missing or has an invalid value.",
+		"Send the parameter with a value as documented for the route, e.g. an RFC3339 time or a positive number.",
+		[]string{"parameter"}},
+	{ERROR_INVALID_PROPERTY, "Invalid property", "The property name isn't a valid name to search or store.",
+		"Use a property name with only letters, digits and underscores.", []string{"property"}},
+	{ERROR_INVALID_SEARCH, "Invalid search",
+		"The search can't be compiled, e.g. an invalid filter, edge type, facet or cursor, or it's too costly.",
+		"Fix the search as described in the message, or narrow it with more filters.", nil},
+	{ERROR_INVALID_UID, "Invalid UID",
+		"The resource UID is empty, too long, or doesn't belong to the cluster of the request.",
+		"Send the UID of the resource as cluster/uid, in the cluster of the request.", nil},
+	{ERROR_OPERATION_IN_PROGRESS, "Operation in progress",
+		"The same maintenance operation is already running, e.g. a compaction or the relabel job.",
+		"Wait for the running operation to complete before starting it again.", []string{"operation"}},
+	{ERROR_PROPERTY_HOOK_FAILED, "Property hook failed",
+		"A PROPERTY_TRANSFORMS transform or a property hook failed for the resource, it isn't stored.",
+		"Fix the transform or the resource properties it fails for, see the message.", nil},
+	{ERROR_QUARANTINE_NOT_FOUND, "Cluster not quarantined", "The cluster isn't quarantined.",
+		"List the quarantined clusters with GET /aggregator/admin/quarantines.", []string{"cluster"}},
+	{ERROR_READ_ONLY, "Read-only",
+		"The aggregator is read-only, enabled by an admin or because Redis is near its maxmemory. The writes to the " +
+			"graph are rejected, the searches are served from the existing data.",
+		"Retry later. See GET /aggregator/admin/readonly for the reason, add memory to Redis or disable it with a PUT.",
+		nil},
+	{ERROR_REBUILD_NOT_FOUND, "No rebuild", "No graph rebuild was started, or none is in progress.",
+		"Start a rebuild with POST /aggregator/admin/rebuild.", nil},
+	{ERROR_REMAP_CONFLICT, "Remap conflict",
+		"The cluster the resources are remapped to already has resources.",
+		"Prune the resources of the new cluster name first, or remap to another name.", []string{"cluster"}},
+	{ERROR_SCHEMA_VIOLATION, "Sync schema violation",
+		"SYNC_SCHEMA_VALIDATION is enforce and the sync payload doesn't match the sync schema.",
+		"Fix the fields in the SchemaErrors of the response, the schema is at GET /aggregator/sync/schema.", nil},
+	{ERROR_SEARCH_TIMEOUT, "Search timeout", "The search query ran for longer than SEARCH_TIMEOUT_MS.",
+		"Narrow the search with more filters, e.g. a kind or a cluster, or use the pagination.", nil},
+	{ERROR_SESSION_BUSY, "Collector session busy",
+		"The messages waiting to be sent to the collector session fill its buffer.",
+		"Retry later, the resyncs requested meanwhile are enforced by rejecting the next delta.", []string{"cluster"}},
+	{ERROR_SESSION_NOT_FOUND, "No collector session", "The cluster has no open collector session.",
+		"Wait for the collector of the cluster to open its session.", []string{"cluster"}},
+	{ERROR_SNAPSHOT_NOT_FOUND, "Topology snapshot not found", "No topology snapshot was taken at or before the time.",
+		"Use a later time, the snapshots are kept for TOPOLOGY_RETENTION_HOURS.", []string{"time"}},
+	{ERROR_SYNC_NOT_FOUND, "No sync", "The cluster has no successful sync, or no resync since the aggregator started.",
+		"Wait for the collector of the cluster to sync, or request a resync.", []string{"cluster"}},
+	{ERROR_TOO_MANY_REQUESTS, "Too many requests", "The aggregator is processing REQUEST_LIMIT syncs already.",
+		"Retry after the Retry-After header, the collectors back off automatically.", nil},
+	{ERROR_UID_COLLISION, "UID collision", "A resource with the same UID exists in another cluster.",
+		"Check the UID_COLLISION_POLICY, and the collectors sending the resource.", nil},
+	{ERROR_UNCHANGED_RESOURCE_NOT_FOUND, "Unchanged resource not found",
+		"A resync listed a resource as unchanged, but it isn't in the graph.",
+		"The collector sends the resource in full in its next sync.", nil},
+	{ERROR_WRITE_FAILED, "Write failed", "The resource or edge couldn't be written to the graph.",
+		"Check the message for the cause. The collector retries the resources of a sync that failed with 503.",
+		nil},
+}
+
+var errorDocsByCode = func() map[ErrorCode]ErrorDoc {
+	docs := make(map[ErrorCode]ErrorDoc, len(errorDocs))
+	for _, doc := range errorDocs {
+		docs[doc.Code] = doc
+	}
+	return docs
+}()
+
+// Body of the error responses.
+type ErrorResponse struct {
+	Code    ErrorCode         `json:"code"`
+	Message string            `json:"message"`          // In English, for the logs and the clients without the code.
+	Params  map[string]string `json:"params,omitempty"` // Values in the message, for the localized messages.
+	Docs    string            `json:"docs"`             // Path of the documentation of the code.
+}
+
+// An error with the code to respond with, for the helpers returning the status of their errors.
+type codedError struct {
+	code   ErrorCode
+	params map[string]string
+	err    error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// Returns the error with the code to respond with.
+func withErrorCode(err error, code ErrorCode, params map[string]string) error {
+	return &codedError{code: code, params: params, err: err}
+}
+
+// Returns the code of the errors responded with the status, without a more specific one.
+func statusErrorCode(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ERROR_INVALID_PARAMETER
+	case http.StatusUnauthorized:
+		return ERROR_ADMIN_TOKEN_REQUIRED
+	case http.StatusForbidden:
+		return ERROR_FEATURE_DISABLED
+	case http.StatusConflict:
+		return ERROR_OPERATION_IN_PROGRESS
+	case http.StatusLocked:
+		return ERROR_CLUSTER_QUARANTINED
+	case http.StatusTooManyRequests:
+		return ERROR_TOO_MANY_REQUESTS
+	case http.StatusServiceUnavailable:
+		return ERROR_DATASTORE_UNAVAILABLE
+	case http.StatusGatewayTimeout:
+		return ERROR_SEARCH_TIMEOUT
+	}
+	return ERROR_INTERNAL
+}
+
+// Responds with the error and its code, replacing http.Error for the errors of the API.
+func respondError(w http.ResponseWriter, status int, code ErrorCode, message string, params map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	response := ErrorResponse{Code: code, Message: message, Params: params, Docs: "/errors/" + string(code)}
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding with error ", code, ": ", encodeError)
+	}
+}
+
+// Responds with the error, with its code when it has one or the one of the status.
+func respondStatusError(w http.ResponseWriter, status int, err error) {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		respondError(w, status, coded.code, err.Error(), coded.params)
+		return
+	}
+	if errors.Is(err, db.ErrReadOnly) {
+		respondError(w, status, ERROR_READ_ONLY, err.Error(), nil)
+		return
+	}
+	respondError(w, status, statusErrorCode(status), err.Error(), nil)
+}
+
+// ErrorDocs responds with the documentation of the error code, or of every error code without one.
+func ErrorDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var response interface{} = errorDocs
+	if code, ok := mux.Vars(r)["code"]; ok {
+		doc, found := errorDocsByCode[ErrorCode(code)]
+		if !found {
+			respondError(w, http.StatusNotFound, ERROR_INVALID_PARAMETER, "Unknown error code "+code,
+				map[string]string{"parameter": "code"})
+			return
+		}
+		response = doc
+	}
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to ErrorDocs: ", encodeError)
+	}
+}
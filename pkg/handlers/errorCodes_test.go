@@ -0,0 +1,75 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_respondError(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondError(w, http.StatusLocked, ERROR_CLUSTER_QUARANTINED, "Cluster c1 is quarantined",
+		map[string]string{"cluster": "c1"})
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var response ErrorResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, ErrorResponse{Code: ERROR_CLUSTER_QUARANTINED, Message: "Cluster c1 is quarantined",
+		Params: map[string]string{"cluster": "c1"}, Docs: "/errors/CLUSTER_QUARANTINED"}, response)
+
+	w = httptest.NewRecorder()
+	err := fmt.Errorf("search: %w", withErrorCode(errors.New("no user"), ERROR_IMPERSONATION_REQUIRED, nil))
+	respondStatusError(w, http.StatusUnauthorized, err)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, ERROR_IMPERSONATION_REQUIRED, response.Code, "The code of the wrapped error.")
+	assert.Equal(t, "search: no user", response.Message)
+
+	w = httptest.NewRecorder()
+	respondStatusError(w, http.StatusServiceUnavailable, errors.New("connection refused"))
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, ERROR_DATASTORE_UNAVAILABLE, response.Code, "The code of the status.")
+}
+
+func TestErrorDocs(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/errors", ErrorDocs)
+	router.HandleFunc("/errors/{code}", ErrorDocs)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/errors", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var docs []ErrorDoc
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&docs))
+	assert.Len(t, docs, len(errorDocsByCode), "The codes are documented once.")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/errors/EPOCH_CONFLICT", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var doc ErrorDoc
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&doc))
+	assert.Equal(t, errorDocsByCode[ERROR_EPOCH_CONFLICT], doc)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/errors/NOT_A_CODE", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var response ErrorResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, ERROR_INVALID_PARAMETER, response.Code)
+
+	// The codes of the statuses and syncs are documented.
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden,
+		http.StatusConflict, http.StatusLocked, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		assert.Contains(t, errorDocsByCode, statusErrorCode(status))
+		assert.Contains(t, errorDocsByCode, syncErrorCode(status))
+	}
+}
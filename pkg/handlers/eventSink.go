@@ -0,0 +1,329 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/eventsink"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+const eventSinkMaxBackoff = time.Minute // Longest wait before publishing a batch the sink didn't acknowledge again.
+
+// Events of the applied changes waiting to be published, oldest first. A batch is only removed once the sink
+// acknowledged it, and the events are kept in the outbox until then, so they're published at least once.
+var (
+	eventQueue      []eventsink.Event
+	eventSequence   = time.Now().UnixNano() / int64(time.Microsecond) // Keeps increasing after a restart.
+	eventQueueMutex = sync.Mutex{}
+	eventQueueFull  = make(chan struct{}, 1)
+	eventSinkError  error // Last error publishing to the event sink, nil once a publish succeeds.
+	eventSinkMutex  = sync.Mutex{}
+	newEventSink    = eventsink.New
+
+	eventFilter       eventsink.Filter // Parsed from EVENT_SINK_FILTER, again when it changes.
+	eventFilterConfig string
+	eventFilterMutex  = sync.Mutex{}
+)
+
+// Returns whether the events of the applied changes are published to EVENT_SINK or streamed to the watch API.
+func eventsWanted() bool {
+	return config.Cfg.EventSink != "" || hasEventWatchers()
+}
+
+// Queues the events of the resources added or updated by a step of a sync, without the ones that failed. Nothing is
+// queued when the step lost the connection, the collector sends the sync again.
+func publishResources(ctx context.Context, clusterName string, requestID int, op string, resources []*db.Resource,
+	result db.ChunkedOperationResult) {
+	if !eventsWanted() || result.ConnectionError != nil {
+		return
+	}
+	events := make([]eventsink.Event, 0, len(resources))
+	for _, resource := range resources {
+		if _, failed := result.ResourceErrors[resource.UID]; failed {
+			continue
+		}
+		kind, _ := resource.Properties["kind"].(string)
+		events = append(events, eventsink.Event{Op: op, Cluster: clusterName, RequestId: requestID,
+			UID: resource.UID, Kind: kind, Properties: resource.Properties})
+	}
+	queueEvents(ctx, events)
+}
+
+// Queues the events of the resources deleted by a step of a sync, from their tombstones.
+func publishDeletes(ctx context.Context, clusterName string, requestID int, tombstones []db.Tombstone,
+	result db.ChunkedOperationResult) {
+	if !eventsWanted() || result.ConnectionError != nil {
+		return
+	}
+	events := make([]eventsink.Event, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		if _, failed := result.ResourceErrors[tombstone.UID]; failed {
+			continue
+		}
+		events = append(events, eventsink.Event{Op: eventsink.NodeDeleted, Cluster: clusterName,
+			RequestId: requestID, UID: tombstone.UID, Kind: tombstone.Kind})
+	}
+	queueEvents(ctx, events)
+}
+
+// Queues the events of the edges added or deleted by a step of a sync. The errors of the inserted edges are keyed by
+// their source, the ones of the deleted edges by the whole edge.
+func publishEdges(ctx context.Context, clusterName string, requestID int, op string, edges []db.Edge,
+	result db.ChunkedOperationResult) {
+	if !eventsWanted() || result.ConnectionError != nil {
+		return
+	}
+	events := make([]eventsink.Event, 0, len(edges))
+	for _, edge := range edges {
+		if _, failed := result.ResourceErrors[edge.SourceUID]; failed {
+			continue
+		}
+		if _, failed := result.ResourceErrors[fmt.Sprintf("(%s)-[:%s]->(%s)", edge.SourceUID, edge.EdgeType,
+			edge.DestUID)]; failed {
+			continue
+		}
+		events = append(events, eventsink.Event{Op: op, Cluster: clusterName, RequestId: requestID,
+			SourceUID: edge.SourceUID, EdgeType: edge.EdgeType, DestUID: edge.DestUID})
+	}
+	queueEvents(ctx, events)
+}
+
+// Returns the filter of the events from EVENT_SINK_FILTER. An invalid filter is ignored, every event is published.
+func eventSinkFilter() eventsink.Filter {
+	eventFilterMutex.Lock()
+	defer eventFilterMutex.Unlock()
+	if eventFilterConfig != config.Cfg.EventSinkFilter || eventFilter == nil {
+		eventFilterConfig = config.Cfg.EventSinkFilter
+		filter, err := eventsink.ParseFilter(eventFilterConfig)
+		if err != nil {
+			logger.Errorf("Ignoring the invalid EVENT_SINK_FILTER %q, every event is published: %s", eventFilterConfig,
+				err)
+			filter = eventsink.Filter{}
+		}
+		eventFilter = filter
+	}
+	return eventFilter
+}
+
+// Returns the events matching EVENT_SINK_FILTER, the others are counted as filtered.
+func filterEvents(events []eventsink.Event) []eventsink.Event {
+	filter := eventSinkFilter()
+	if len(filter) == 0 {
+		return events
+	}
+	matched := make([]eventsink.Event, 0, len(events))
+	for _, event := range events {
+		if filter.Match(event) {
+			matched = append(matched, event)
+		}
+	}
+	if filtered := len(events) - len(matched); filtered > 0 {
+		metrics.EventSinkEvents.WithLabelValues("filtered").Add(float64(filtered))
+	}
+	return matched
+}
+
+// Sends the events to the subscribers of the watch API. Then numbers the events matching EVENT_SINK_FILTER, adds them
+// to the queue and the outbox, and wakes up the job when a batch is ready. The events that don't fit in
+// EVENT_SINK_QUEUE_SIZE are dropped.
+func queueEvents(ctx context.Context, events []eventsink.Event) {
+	now := time.Now()
+	for i := range events {
+		events[i].Time = now
+	}
+	broadcastEvents(events)
+	if config.Cfg.EventSink == "" {
+		return
+	}
+	events = filterEvents(events) // Before they're numbered, a gap in the sequences still means events were dropped.
+	if len(events) == 0 {
+		return
+	}
+	eventQueueMutex.Lock()
+	dropped := len(eventQueue) + len(events) - config.Cfg.EventSinkQueueSize
+	if dropped > len(events) {
+		dropped = len(events)
+	}
+	if dropped > 0 {
+		events = events[:len(events)-dropped]
+	}
+	sequences := make([]int64, len(events))
+	entries := make([][]byte, 0, len(events))
+	for i := range events {
+		eventSequence++
+		events[i].Sequence = eventSequence
+		sequences[i] = eventSequence
+		if entry, err := json.Marshal(events[i]); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	eventQueue = append(eventQueue, events...)
+	queued := len(eventQueue)
+	eventQueueMutex.Unlock()
+
+	metrics.EventSinkQueue.Set(float64(queued))
+	if dropped > 0 {
+		metrics.EventSinkEvents.WithLabelValues("dropped").Add(float64(dropped))
+		logger.Warningf("Dropped %d events, the event sink queue is full with %d events. Is %s down?", dropped,
+			queued, config.Cfg.EventSink)
+	}
+	if len(entries) == len(sequences) {
+		if err := db.AddToEventOutbox(ctx, sequences, entries); err != nil {
+			logger.Warning("Error adding events to the outbox, they're lost if the aggregator restarts: ", err)
+		}
+	}
+	if queued >= config.Cfg.EventSinkBatchSize {
+		select {
+		case eventQueueFull <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Publishes the queued events in batches of EVENT_SINK_BATCH_SIZE until the queue is empty. Stops at the first
+// batch the sink didn't acknowledge, it stays at the front of the queue.
+func publishQueuedEvents(ctx context.Context, sink eventsink.Sink) error {
+	for {
+		eventQueueMutex.Lock()
+		size := len(eventQueue)
+		if size > config.Cfg.EventSinkBatchSize && config.Cfg.EventSinkBatchSize > 0 {
+			size = config.Cfg.EventSinkBatchSize
+		}
+		batch := append([]eventsink.Event{}, eventQueue[:size]...)
+		eventQueueMutex.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := sink.Publish(ctx, batch); err != nil {
+			return err
+		}
+
+		eventQueueMutex.Lock()
+		eventQueue = eventQueue[len(batch):]
+		if len(eventQueue) == 0 {
+			eventQueue = nil
+		}
+		queued := len(eventQueue)
+		eventQueueMutex.Unlock()
+		metrics.EventSinkQueue.Set(float64(queued))
+		metrics.EventSinkEvents.WithLabelValues("published").Add(float64(len(batch)))
+		if err := db.DropFromEventOutbox(ctx, batch[len(batch)-1].Sequence); err != nil {
+			logger.Warning("Error removing the published events from the outbox: ", err)
+		}
+	}
+}
+
+// Puts the events left in the outbox by the previous run at the front of the queue.
+func loadEventOutbox(ctx context.Context) error {
+	entries, err := db.EventOutbox(ctx)
+	if err != nil {
+		return err
+	}
+	eventQueueMutex.Lock()
+	defer eventQueueMutex.Unlock()
+	queued := make(map[int64]bool, len(eventQueue)) // Queued since the start, they're in the outbox too.
+	for _, event := range eventQueue {
+		queued[event.Sequence] = true
+	}
+	pending := make([]eventsink.Event, 0, len(entries))
+	for _, entry := range entries {
+		var event eventsink.Event
+		if err := json.Unmarshal(entry, &event); err != nil {
+			logger.Warning("Skipped an event of the outbox that can't be decoded: ", err)
+			continue
+		}
+		if !queued[event.Sequence] {
+			pending = append(pending, event)
+		}
+	}
+	if len(pending) > 0 && pending[len(pending)-1].Sequence > eventSequence {
+		eventSequence = pending[len(pending)-1].Sequence
+	}
+	eventQueue = append(pending, eventQueue...)
+	if len(pending) > 0 {
+		logger.Infof("Publishing %d events left in the outbox by the previous run.", len(pending))
+	}
+	return nil
+}
+
+// Publishes the events of the applied changes to EVENT_SINK, when a batch is ready or every EVENT_SINK_FLUSH_MS.
+// Batches the sink didn't acknowledge are published again, waiting longer after each error.
+func EventSinkJob() {
+	if config.Cfg.EventSink == "" {
+		logger.Info("Disabled the event sink, EVENT_SINK isn't set.")
+		return
+	}
+	ctx := context.Background()
+	backoff := time.Second
+	wait := func(err error) {
+		setEventSinkError(err)
+		logger.Warningf("Error publishing to the event sink, retrying in %s: %s", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > eventSinkMaxBackoff {
+			backoff = eventSinkMaxBackoff
+		}
+	}
+	sink, err := newEventSink(config.Cfg.EventSink, eventSinkOptions())
+	for ; err != nil; sink, err = newEventSink(config.Cfg.EventSink, eventSinkOptions()) {
+		wait(err)
+	}
+	defer sink.Close()
+	for err = loadEventOutbox(ctx); err != nil; err = loadEventOutbox(ctx) {
+		wait(err)
+	}
+	backoff = time.Second
+	logger.Info("Publishing the applied changes to ", config.Cfg.EventSink)
+
+	for {
+		select {
+		case <-eventQueueFull:
+		case <-time.After(time.Duration(config.Cfg.EventSinkFlushMS) * time.Millisecond):
+		}
+		for err = publishQueuedEvents(ctx, sink); err != nil; err = publishQueuedEvents(ctx, sink) {
+			wait(err)
+		}
+		setEventSinkError(nil)
+		backoff = time.Second
+	}
+}
+
+// Returns the TLS and authentication of the event sink from the config.
+func eventSinkOptions() eventsink.Options {
+	return eventsink.Options{
+		TLS:       config.Cfg.EventSinkTLS == "true",
+		CAFile:    config.Cfg.EventSinkCAFile,
+		CertFile:  config.Cfg.EventSinkCertFile,
+		KeyFile:   config.Cfg.EventSinkKeyFile,
+		User:      config.Cfg.EventSinkUser,
+		Password:  config.Cfg.EventSinkPassword,
+		CredsFile: config.Cfg.EventSinkCredsFile,
+	}
+}
+
+func setEventSinkError(err error) {
+	eventSinkMutex.Lock()
+	defer eventSinkMutex.Unlock()
+	eventSinkError = err
+}
+
+// Readiness check of the event sink, failing while the events can't be published.
+func eventSinkReady() error {
+	if config.Cfg.EventSink == "" {
+		return nil
+	}
+	eventSinkMutex.Lock()
+	defer eventSinkMutex.Unlock()
+	if eventSinkError != nil {
+		return fmt.Errorf("Unable to publish to the event sink: %v", eventSinkError)
+	}
+	return nil
+}
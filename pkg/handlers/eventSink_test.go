@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/eventsink"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the batches it publishes, fails while err is set.
+type fakeEventSink struct {
+	batches [][]eventsink.Event
+	err     error
+}
+
+func (f *fakeEventSink) Publish(ctx context.Context, events []eventsink.Event) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.batches = append(f.batches, events)
+	return nil
+}
+
+func (f *fakeEventSink) Close() error {
+	return nil
+}
+
+func setUpEventSink(t *testing.T, batchSize, queueSize int) {
+	t.Cleanup(config.Snapshot())
+	t.Cleanup(func() {
+		eventQueueMutex.Lock()
+		eventQueue = nil
+		eventQueueMutex.Unlock()
+	})
+	useTestDatastore(t)
+	config.Cfg.EventSink = "nats://localhost:4222/search.changes"
+	config.Cfg.EventSinkBatchSize, config.Cfg.EventSinkQueueSize = batchSize, queueSize
+}
+
+func queuedEvents() []eventsink.Event {
+	eventQueueMutex.Lock()
+	defer eventQueueMutex.Unlock()
+	return append([]eventsink.Event{}, eventQueue...)
+}
+
+func TestPublishAppliedChanges(t *testing.T) {
+	setUpEventSink(t, 2, 5)
+	ctx := context.Background()
+	resources := []*db.Resource{
+		{UID: "c1/pod-1", Properties: map[string]interface{}{"kind": "Pod", "name": "pod-1"}},
+		{UID: "c1/pod-2", Properties: map[string]interface{}{"kind": "Pod", "name": "pod-2"}},
+	}
+	publishResources(ctx, "c1", 7, eventsink.NodeAdded, resources,
+		db.ChunkedOperationResult{ResourceErrors: map[string]error{"c1/pod-2": errors.New("insert failed")}})
+	publishResources(ctx, "c1", 7, eventsink.NodeUpdated, resources,
+		db.ChunkedOperationResult{ConnectionError: errors.New("connection refused")})
+	publishDeletes(ctx, "c1", 7, []db.Tombstone{{UID: "c1/pod-3", Kind: "Pod"}}, db.ChunkedOperationResult{})
+	edges := []db.Edge{{SourceUID: "c1/pod-1", EdgeType: "runsOn", DestUID: "c1/node-1"},
+		{SourceUID: "c1/pod-4", EdgeType: "runsOn", DestUID: "c1/node-1"}}
+	publishEdges(ctx, "c1", 7, eventsink.EdgeDeleted, edges, db.ChunkedOperationResult{
+		ResourceErrors: map[string]error{"(c1/pod-4)-[:runsOn]->(c1/node-1)": errors.New("delete failed")}})
+
+	events := queuedEvents()
+	assert.Len(t, events, 3, "The failed resources and edges and the step that lost the connection aren't published.")
+	assert.Equal(t, eventsink.Event{Sequence: events[0].Sequence, Op: eventsink.NodeAdded, Cluster: "c1", RequestId: 7,
+		Time: events[0].Time, UID: "c1/pod-1", Kind: "Pod", Properties: resources[0].Properties}, events[0])
+	assert.Equal(t, eventsink.NodeDeleted, events[1].Op)
+	assert.Equal(t, "c1/pod-3", events[1].UID)
+	assert.Equal(t, eventsink.EdgeDeleted, events[2].Op)
+	assert.Equal(t, "c1/pod-1", events[2].SourceUID)
+	assert.Equal(t, events[0].Sequence+2, events[2].Sequence)
+
+	outbox, err := db.EventOutbox(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, outbox, 3)
+
+	// The queue holds 5 events, the next ones are dropped.
+	publishEdges(ctx, "c1", 8, eventsink.EdgeAdded, append(edges, edges...), db.ChunkedOperationResult{})
+	assert.Len(t, queuedEvents(), 5)
+
+	config.Cfg.EventSink = ""
+	publishDeletes(ctx, "c1", 9, []db.Tombstone{{UID: "c1/pod-1"}}, db.ChunkedOperationResult{})
+	assert.Len(t, queuedEvents(), 5, "Nothing is queued without EVENT_SINK.")
+}
+
+func TestPublishAppliedChanges_filter(t *testing.T) {
+	setUpEventSink(t, 10, 100)
+	config.Cfg.EventSinkFilter = "kind:pod status:Failed,Pending"
+	ctx := context.Background()
+	resources := []*db.Resource{
+		{UID: "c1/pod-1", Properties: map[string]interface{}{"kind": "pod", "status": "Failed"}},
+		{UID: "c1/pod-2", Properties: map[string]interface{}{"kind": "pod", "status": "Running"}},
+		{UID: "c1/deploy-1", Properties: map[string]interface{}{"kind": "deployment", "status": "Failed"}},
+		{UID: "c1/pod-3", Properties: map[string]interface{}{"kind": "pod", "status": "Pending"}},
+	}
+	publishResources(ctx, "c1", 1, eventsink.NodeUpdated, resources, db.ChunkedOperationResult{})
+	publishEdges(ctx, "c1", 1, eventsink.EdgeAdded, []db.Edge{{SourceUID: "c1/pod-1", EdgeType: "runsOn",
+		DestUID: "c1/node-1"}}, db.ChunkedOperationResult{})
+
+	events := queuedEvents()
+	if assert.Len(t, events, 2, "Only the failed and pending pods match the filter.") {
+		assert.Equal(t, "c1/pod-1", events[0].UID)
+		assert.Equal(t, "c1/pod-3", events[1].UID)
+		assert.Equal(t, events[0].Sequence+1, events[1].Sequence, "The filtered events aren't numbered.")
+	}
+
+	config.Cfg.EventSinkFilter = "status"
+	publishResources(ctx, "c1", 2, eventsink.NodeUpdated, resources[1:2], db.ChunkedOperationResult{})
+	assert.Len(t, queuedEvents(), 3, "An invalid filter is ignored.")
+}
+
+func TestPublishQueuedEvents(t *testing.T) {
+	setUpEventSink(t, 2, 100)
+	ctx := context.Background()
+	publishDeletes(ctx, "c1", 1, []db.Tombstone{{UID: "c1/a"}, {UID: "c1/b"}, {UID: "c1/c"}},
+		db.ChunkedOperationResult{})
+
+	sink := &fakeEventSink{err: errors.New("broker down")}
+	assert.Error(t, publishQueuedEvents(ctx, sink))
+	assert.Len(t, queuedEvents(), 3, "The batch stays queued until it's acknowledged.")
+
+	sink.err = nil
+	assert.NoError(t, publishQueuedEvents(ctx, sink))
+	assert.Len(t, sink.batches, 2, "Batches of EVENT_SINK_BATCH_SIZE.")
+	assert.Equal(t, "c1/a", sink.batches[0][0].UID)
+	assert.Equal(t, "c1/c", sink.batches[1][0].UID)
+	assert.Empty(t, queuedEvents())
+	outbox, err := db.EventOutbox(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, outbox, "The published events are removed from the outbox.")
+}
+
+func TestLoadEventOutbox(t *testing.T) {
+	setUpEventSink(t, 10, 100)
+	ctx := context.Background()
+	previous, _ := json.Marshal(eventsink.Event{Sequence: 5, Op: eventsink.NodeDeleted, Cluster: "c1", UID: "c1/old"})
+	assert.NoError(t, db.AddToEventOutbox(ctx, []int64{5}, [][]byte{previous}))
+	publishDeletes(ctx, "c1", 1, []db.Tombstone{{UID: "c1/new"}}, db.ChunkedOperationResult{})
+
+	assert.NoError(t, loadEventOutbox(ctx))
+	events := queuedEvents()
+	assert.Len(t, events, 2, "The events queued since the start are in the outbox too, they aren't queued again.")
+	assert.Equal(t, "c1/old", events[0].UID)
+	assert.Equal(t, "c1/new", events[1].UID)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"strings"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Removes the added and updated resources, and the added edges, of the kinds excluded by the config.
+// Excluded resources already in the graph are removed by the next resync of their cluster.
+func filterExcludedKinds(clusterName string, syncEvent *SyncEvent) {
+	excluded := make(map[string]bool)
+	for _, kind := range config.ParseList(config.ExcludedKinds()) {
+		excluded[strings.ToLower(kind)] = true
+	}
+	if len(excluded) == 0 {
+		return
+	}
+	isExcluded := func(kind string) bool {
+		return excluded[strings.ToLower(kind)]
+	}
+
+	filterResources := func(resources []*db.Resource) []*db.Resource {
+		kept := make([]*db.Resource, 0, len(resources))
+		for _, r := range resources {
+			if kind, _ := r.Properties["kind"].(string); !isExcluded(r.Kind) && !isExcluded(kind) {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	}
+	added, updated := len(syncEvent.AddResources), len(syncEvent.UpdateResources)
+	syncEvent.AddResources = filterResources(syncEvent.AddResources)
+	syncEvent.UpdateResources = filterResources(syncEvent.UpdateResources)
+
+	edges := make([]db.Edge, 0, len(syncEvent.AddEdges))
+	for _, e := range syncEvent.AddEdges {
+		if !isExcluded(e.SourceKind) && !isExcluded(e.DestKind) {
+			edges = append(edges, e)
+		}
+	}
+	skipped := added - len(syncEvent.AddResources) + updated - len(syncEvent.UpdateResources)
+	logger.V(3).Infof("Skipped %d resources and %d edges of excluded kinds from cluster %s",
+		skipped, len(syncEvent.AddEdges)-len(edges), clusterName)
+	syncEvent.AddEdges = edges
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_filterExcludedKinds(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.ExcludedKinds = "Event, replicaset"
+
+	syncEvent := SyncEvent{
+		AddResources: []*db.Resource{
+			{Kind: "Pod", UID: "c1/pod", Properties: map[string]interface{}{"kind": "Pod"}},
+			{Kind: "Event", UID: "c1/event", Properties: map[string]interface{}{"kind": "Event"}},
+		},
+		UpdateResources: []*db.Resource{
+			{UID: "c1/rs", Properties: map[string]interface{}{"kind": "ReplicaSet"}},
+		},
+		AddEdges: []db.Edge{
+			{SourceUID: "c1/pod", SourceKind: "Pod", DestUID: "c1/rs", DestKind: "ReplicaSet", EdgeType: "ownedBy"},
+		},
+		DeleteResources: []DeleteResourceEvent{{UID: "c1/event"}},
+	}
+	filterExcludedKinds("c1", &syncEvent)
+
+	assert.Equal(t, 1, len(syncEvent.AddResources))
+	assert.Equal(t, "c1/pod", syncEvent.AddResources[0].UID)
+	assert.Empty(t, syncEvent.UpdateResources)
+	assert.Empty(t, syncEvent.AddEdges)
+	assert.Equal(t, 1, len(syncEvent.DeleteResources), "Deletes are not filtered")
+}
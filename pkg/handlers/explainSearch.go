@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Request body for ExplainSearch.
+type ExplainSearchRequest struct {
+	Search string `json:"search"` // Saved search in the console syntax, e.g. "kind:pod namespace:default"
+	Limit  int    `json:"limit"`  // Limit of the search, capped by SEARCH_RESULT_LIMIT like Search.
+	// Runs the query to measure the rows and time of each operation, instead of only planning it.
+	Profile bool `json:"profile"`
+}
+
+// Response body for ExplainSearch.
+type ExplainSearchResponse struct {
+	Query   string             `json:"query"` // Query the search runs, with the access filter of the user.
+	Profile bool               `json:"profile"`
+	Plan    []db.PlanOperation `json:"plan"` // Operations of the execution plan from the root.
+	// Time to plan or profile the query, as measured by the aggregator.
+	TotalTimeMS float64 `json:"totalTimeMs"`
+	// Queries run for the search, only with ?debugQueries=true and the admin token.
+	Queries []db.TracedQuery `json:"queries,omitempty"`
+}
+
+// ExplainSearch returns the execution plan of the query a search runs, with GRAPH.EXPLAIN, or with GRAPH.PROFILE the
+// rows and time of each operation, to find out why a search is slow.
+func ExplainSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var request ExplainSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Warning("Error decoding body of explain search request: ", err)
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	access, status, err := searchAccess(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	ctx, trace, status, err := debugQueries(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	kindLabels, err := searchKindLabels(ctx)
+	if err != nil {
+		logger.Warning("Error reading node labels for explain search request: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	compiled, err := db.CompileSearchWithKindLabels(request.Search, kindLabels)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_SEARCH, err.Error(), nil)
+		return
+	}
+	if access != nil {
+		compiled = compiled.WithAccess(*access)
+	}
+
+	limit := searchLimit(request.Limit)
+	if limit > 0 {
+		limit++ // Same query as Search, one more to know if the results were truncated.
+	}
+	start := time.Now()
+	plan, err := db.ExplainSearch(ctx, compiled.Query, limit, request.Profile)
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	response := ExplainSearchResponse{Query: compiled.Query, Profile: request.Profile, Plan: plan,
+		TotalTimeMS: float64(time.Since(start)) / float64(time.Millisecond), Queries: tracedQueries(trace)}
+
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to ExplainSearch: ", encodeError)
+	}
+}
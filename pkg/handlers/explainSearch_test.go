@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainSearch(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.SearchResultLimit = 1
+	_, err := db.Store.Query(context.Background(), "CREATE (:Pod {_uid:'c1/p1', kind:'pod', name:'a'}), "+
+		"(:Pod {_uid:'c1/p2', kind:'pod', name:'b'}), (:Pod {_uid:'c1/p3', kind:'pod', name:'c'})")
+	assert.NoError(t, err)
+
+	explain := func(body string) (*httptest.ResponseRecorder, ExplainSearchResponse) {
+		w := httptest.NewRecorder()
+		ExplainSearch(w, httptest.NewRequest("POST", "/aggregator/search/explain", strings.NewReader(body)))
+		var response ExplainSearchResponse
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		}
+		return w, response
+	}
+
+	w, profiled := explain(`{"search": "kind:pod", "limit": 10, "profile": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, profiled.Profile)
+	assert.Contains(t, profiled.Query, "pod")
+	if assert.NotEmpty(t, profiled.Plan) && assert.NotNil(t, profiled.Plan[0].Records) {
+		assert.Equal(t, 2, *profiled.Plan[0].Records, "Same limit as Search, capped and one more")
+	}
+
+	w, explained := explain(`{"search": "kind:pod"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, explained.Profile)
+	if assert.NotEmpty(t, explained.Plan) {
+		assert.Nil(t, explained.Plan[0].Records)
+	}
+
+	w, _ = explain(`{"search": `)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
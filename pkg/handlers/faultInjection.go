@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// FaultInjection responds with the faults injected into the datastore queries. A PUT replaces them with the faults
+// in the body, an empty object stops the injection. Responds 404 when FAULT_INJECTION_ENABLED isn't true.
+func FaultInjection(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if config.Cfg.FaultInjectionEnabled != "true" {
+		respondError(w, http.StatusNotFound, ERROR_FEATURE_DISABLED, db.ErrFaultInjectionDisabled.Error(),
+			map[string]string{"feature": "faultInjection"})
+		return
+	}
+	if r.Method == http.MethodPut {
+		var faults db.FaultInjection
+		if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+			return
+		}
+		if err := db.SetFaultInjection(faults); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, err.Error(), nil)
+			return
+		}
+	}
+	if encodeError := json.NewEncoder(w).Encode(db.CurrentFaultInjection()); encodeError != nil {
+		logger.Error("Error responding to FaultInjection: ", encodeError)
+	}
+}
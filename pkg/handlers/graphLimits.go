@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Nodes and edges of the graph against GRAPH_MAX_NODES and GRAPH_MAX_EDGES, from the last count.
+type graphUsage struct {
+	Nodes       int
+	Edges       int
+	Utilization float64 // Highest fraction used of the caps that are set.
+	Counted     time.Time
+}
+
+var (
+	lastGraphUsage  graphUsage
+	graphUsageMutex = sync.Mutex{}
+)
+
+// Returns true when GRAPH_MAX_NODES or GRAPH_MAX_EDGES is set.
+func graphLimitsEnabled() bool {
+	return config.Cfg.GraphMaxNodes > 0 || config.Cfg.GraphMaxEdges > 0
+}
+
+// Returns the usage of the counts, updates the metrics and warns when the graph is near its caps.
+func recordGraphUsage(nodes, edges int, now time.Time) graphUsage {
+	usage := graphUsage{Nodes: nodes, Edges: edges, Counted: now}
+	metrics.GraphObjects.WithLabelValues("nodes").Set(float64(nodes))
+	metrics.GraphObjects.WithLabelValues("edges").Set(float64(edges))
+	if config.Cfg.GraphMaxNodes > 0 {
+		utilization := float64(nodes) / float64(config.Cfg.GraphMaxNodes)
+		metrics.GraphLimitUtilization.WithLabelValues("nodes").Set(utilization)
+		if utilization > usage.Utilization {
+			usage.Utilization = utilization
+		}
+	}
+	if config.Cfg.GraphMaxEdges > 0 {
+		utilization := float64(edges) / float64(config.Cfg.GraphMaxEdges)
+		metrics.GraphLimitUtilization.WithLabelValues("edges").Set(utilization)
+		if utilization > usage.Utilization {
+			usage.Utilization = utilization
+		}
+	}
+	if nearGraphLimits(usage) {
+		logger.Warningf("The graph is near its caps, %d nodes of GRAPH_MAX_NODES %d and %d edges of "+
+			"GRAPH_MAX_EDGES %d. Size Redis for the growth of the graph, or raise the caps.", nodes,
+			config.Cfg.GraphMaxNodes, edges, config.Cfg.GraphMaxEdges)
+	}
+
+	graphUsageMutex.Lock()
+	defer graphUsageMutex.Unlock()
+	lastGraphUsage = usage
+	return usage
+}
+
+// Returns true when the usage reached GRAPH_LIMIT_WARN_PERCENT of a cap.
+func nearGraphLimits(usage graphUsage) bool {
+	return graphLimitsEnabled() && usage.Utilization*100 >= float64(config.Cfg.GraphLimitWarnPercent)
+}
+
+func currentGraphUsage() graphUsage {
+	graphUsageMutex.Lock()
+	defer graphUsageMutex.Unlock()
+	return lastGraphUsage
+}
+
+// Counts the graph against its caps.
+func checkGraphLimits(ctx context.Context) error {
+	nodes, edges, err := db.CountGraphObjects(ctx)
+	if err != nil {
+		return err
+	}
+	recordGraphUsage(nodes, edges, time.Now())
+	return nil
+}
+
+// Returns true when the sync must be rejected: the graph is near its caps, GRAPH_LIMIT_REJECT_CLUSTERS is true and
+// the cluster is new, without a successful sync or resources in the graph. The syncs of the clusters already in the
+// graph are always accepted, so they stay up to date.
+func rejectedByGraphLimits(ctx context.Context, clusterName string) bool {
+	if config.Cfg.GraphLimitRejectClusters != "true" || !nearGraphLimits(currentGraphUsage()) {
+		return false
+	}
+	if lastSync, err := db.LastSync(ctx, clusterName); err != nil || lastSync != nil {
+		return false // Accepted when it can't be checked.
+	}
+	if computeNodeCount(ctx, clusterName) > 0 {
+		return false
+	}
+	logger.Warningf("Rejecting sync from new cluster %s, the graph is near GRAPH_MAX_NODES or GRAPH_MAX_EDGES.",
+		clusterName)
+	metrics.GraphLimitRejectedSyncs.Inc()
+	return true
+}
+
+// Counts the graph against GRAPH_MAX_NODES and GRAPH_MAX_EDGES every GRAPH_LIMIT_RATE_MS.
+func GraphLimitsJob() {
+	if !graphLimitsEnabled() {
+		logger.Info("Disabled the graph limits, GRAPH_MAX_NODES and GRAPH_MAX_EDGES aren't set.")
+		return
+	}
+	if config.Cfg.GraphLimitRateMS <= 0 {
+		logger.Info("Disabled the graph limits, GRAPH_LIMIT_RATE_MS is 0.")
+		return
+	}
+	for {
+		ctx := db.WithLane(context.Background(), db.BulkLane)
+		if err := checkGraphLimits(ctx); err != nil {
+			logger.Warning("Error counting the graph for the graph limits: ", err)
+		}
+		time.Sleep(time.Duration(config.Cfg.GraphLimitRateMS) * time.Millisecond)
+	}
+}
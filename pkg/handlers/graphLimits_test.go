@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func useGraphLimits(t *testing.T, maxNodes, maxEdges int) {
+	t.Cleanup(config.Snapshot())
+	prevUsage := currentGraphUsage()
+	t.Cleanup(func() {
+		recordGraphUsage(prevUsage.Nodes, prevUsage.Edges, prevUsage.Counted)
+	})
+	useTestDatastore(t)
+	config.Cfg.GraphMaxNodes, config.Cfg.GraphMaxEdges = maxNodes, maxEdges
+	config.Cfg.GraphLimitWarnPercent = 80
+	config.Cfg.GraphLimitRejectClusters = "true"
+	config.Cfg.SkipClusterValidation = "true"
+}
+
+func Test_recordGraphUsage(t *testing.T) {
+	useGraphLimits(t, 100, 1000)
+	usage := recordGraphUsage(50, 900, time.Now())
+	assert.Equal(t, 0.9, usage.Utilization, "The highest fraction of the caps.")
+	assert.True(t, nearGraphLimits(usage))
+	assert.False(t, nearGraphLimits(recordGraphUsage(50, 500, time.Now())))
+
+	config.Cfg.GraphMaxEdges = 0
+	assert.Equal(t, 0.5, recordGraphUsage(50, 900, time.Now()).Utilization, "Only the caps that are set count.")
+	config.Cfg.GraphMaxNodes = 0
+	assert.False(t, nearGraphLimits(recordGraphUsage(50, 900, time.Now())), "Disabled without caps.")
+}
+
+func TestSyncResources_graphLimits(t *testing.T) {
+	useGraphLimits(t, 4, 0)
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Pod {_uid:'known/pod1', cluster:'known', kind:'pod', name:'pod1'}), "+
+		"(:Pod {_uid:'known/pod2', cluster:'known', kind:'pod', name:'pod2'})")
+	assert.NoError(t, err)
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", SyncResources).Methods("POST")
+	sync := func(clusterName string) (int, SyncResponse) {
+		body, _ := json.Marshal(SyncEvent{AddResources: []*db.Resource{{Kind: "Pod", UID: clusterName + "/pod3",
+			Properties: map[string]interface{}{"kind": "pod", "name": "pod3"}}}})
+		request := httptest.NewRequest("POST", "/aggregator/clusters/"+clusterName+"/sync", bytes.NewReader(body))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		var response SyncResponse
+		_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response
+	}
+
+	assert.NoError(t, checkGraphLimits(ctx))
+	assert.Equal(t, 2, currentGraphUsage().Nodes)
+	status, _ := sync("new")
+	assert.Equal(t, http.StatusOK, status, "The graph has 2 nodes of 4.")
+
+	recordGraphUsage(4, 0, time.Now())
+	status, response := sync("other")
+	assert.Equal(t, http.StatusInsufficientStorage, status, "The graph is full, new clusters are rejected.")
+	assert.Equal(t, ERROR_GRAPH_LIMIT_REACHED, response.ErrorCode)
+	status, _ = sync("known")
+	assert.Equal(t, http.StatusOK, status, "The clusters in the graph are still accepted.")
+
+	config.Cfg.GraphLimitRejectClusters = "false"
+	status, _ = sync("other")
+	assert.Equal(t, http.StatusOK, status)
+}
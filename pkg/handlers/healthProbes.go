@@ -12,34 +12,32 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
-
-	"github.com/golang/glog"
-	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
 )
 
 // LivenessProbe is used to check if this service is alive.
 func LivenessProbe(w http.ResponseWriter, r *http.Request) {
-	glog.V(2).Info("livenessProbe")
+	logger.V(2).Info("livenessProbe")
 	fmt.Fprint(w, "OK")
 }
 
-// ReadinessProbe checks if Redis is available.
+// ReadinessProbe runs the readiness checks of the subsystems, e.g. Redis and the warm up, and responds with their
+// status. It responds 503 when a required check fails.
 func ReadinessProbe(w http.ResponseWriter, r *http.Request) {
-	glog.V(2).Info("readinessProbe - Checking Redis connection.")
-
-	// Go straight to the pool's Dial because we don't actually want to play by the pool's
-	// rules here - just want a connection unrelated to all the other ones,
-	conn, err := db.Pool.Dial()
-	if err != nil {
-		// Respond with error.
-		glog.Warning("Unable to reach Redis.")
-		http.Error(w, "Unable to reach Redis.", 503)
-		return
+	logger.V(2).Info("readinessProbe - Running the readiness checks.")
+	status := checkReadiness()
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		for _, check := range status.Checks {
+			if check.Status == "failing" {
+				logger.Warningf("Not ready, the %s check is failing: %s", check.Name, check.Reason)
+			}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if encodeError := json.NewEncoder(w).Encode(status); encodeError != nil {
+		logger.Error("Error responding to the readiness probe: ", encodeError)
 	}
-
-	defer conn.Close()
-	// Respond with success
-	fmt.Fprint(w, "OK")
 }
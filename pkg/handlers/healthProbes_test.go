@@ -4,9 +4,13 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // Test the liveness probe.
@@ -63,10 +67,47 @@ func TestReadinessProbe_unableToConnect(t *testing.T) {
 			status, http.StatusServiceUnavailable)
 	}
 
-	// Check the response body is what we expect.
-	expected := "Unable to reach Redis.\n"
-	if rr.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			rr.Body.String(), expected)
+	// Check the response body details the failing check.
+	var status ReadinessStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatal(err)
 	}
+	if status.Ready || status.Checks[0] != (ReadinessCheckStatus{Name: "datastore", Status: "failing",
+		Reason: "Unable to reach Redis.", Required: true}) {
+		t.Errorf("handler returned unexpected body: got %+v", status)
+	}
+}
+
+// Test the readiness probe with the checks of the subsystems.
+func TestReadinessProbe_checks(t *testing.T) {
+	readinessChecksMutex.Lock()
+	prevChecks := append([]readinessEntry{}, readinessChecks...)
+	readinessChecksMutex.Unlock()
+	defer func() {
+		readinessChecksMutex.Lock()
+		readinessChecks = prevChecks
+		readinessChecksMutex.Unlock()
+	}()
+	useTestDatastore(t)
+	RegisterReadinessCheck("warm-up", true, func() error { return nil })
+	RegisterReadinessCheck("rbac-cache", false, func() error { return errors.New("not synced") })
+
+	rr := httptest.NewRecorder()
+	ReadinessProbe(rr, httptest.NewRequest("GET", "/readiness", nil))
+	assert.Equal(t, http.StatusOK, rr.Code, "The optional checks don't fail the probe.")
+	var status ReadinessStatus
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+	assert.True(t, status.Ready)
+	assert.Equal(t, []ReadinessCheckStatus{
+		{Name: "datastore", Status: "ok", Required: true},
+		{Name: "warm-up", Status: "ok", Required: true},
+		{Name: "event-sink", Status: "ok"},
+		{Name: "rbac-cache", Status: "degraded", Reason: "not synced"},
+	}, status.Checks)
+
+	RegisterReadinessCheck("warm-up", true, func() error { return errors.New("Warming up: schema") })
+	rr = httptest.NewRecorder()
+	ReadinessProbe(rr, httptest.NewRequest("GET", "/readiness", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"name":"warm-up","status":"failing","reason":"Warming up: schema"`)
 }
@@ -9,21 +9,36 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
-	"github.com/golang/glog"
+	"context"
+	"sync"
+
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
 	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
 )
 
+// The jobs the handlers leave running in the background after responding, e.g. the summary updates.
+// The tests wait for them before replacing the datastore.
+var backgroundJobs = sync.WaitGroup{}
+
+// Runs the job in a goroutine tracked by backgroundJobs.
+func runInBackground(job func()) {
+	backgroundJobs.Add(1)
+	go func() {
+		defer backgroundJobs.Done()
+		job()
+	}()
+}
+
 // returns the total number of nodes on cluster
-func computeNodeCount(clusterName string) int {
-	resp, err := db.TotalNodes(clusterName)
+func computeNodeCount(ctx context.Context, clusterName string) int {
+	resp, err := db.TotalNodes(ctx, clusterName)
 	if err != nil {
-		glog.Errorf("Error node count for cluster %s: %s", clusterName, err)
+		logger.Errorf("Error node count for cluster %s: %s", clusterName, err)
 		return 0
 	}
 
 	if resp.Empty() { // Just 1 would be just the header
-		glog.Info("Cluster ", clusterName, " doesn't have any nodes")
+		logger.Info("Cluster ", clusterName, " doesn't have any nodes")
 		return 0
 	}
 	//Iterating to next record to get count - count is in the first index(0) of the first record
@@ -33,22 +48,22 @@ func computeNodeCount(clusterName string) int {
 		if count, ok := countInterface.(int); ok {
 			return count
 		} else {
-			glog.Errorf("Could not parse node count results for cluster %s", clusterName)
+			logger.Errorf("Could not parse node count results for cluster %s", clusterName)
 		}
 	}
 	return 0
 }
 
 // computeIntraEdges counts the nubmer of intra edges returned form db
-func computeIntraEdges(clusterName string) int {
-	resp, err := db.TotalIntraEdges(clusterName)
+func computeIntraEdges(ctx context.Context, clusterName string) int {
+	resp, err := db.TotalIntraEdges(ctx, clusterName)
 	if err != nil {
-		glog.Errorf("Error fetching edge count for cluster %s: %s", clusterName, err)
+		logger.Errorf("Error fetching edge count for cluster %s: %s", clusterName, err)
 		return 0
 	}
 
 	if resp.Empty() { // Just 1 would be just the header
-		glog.Info("Cluster ", clusterName, " doesn't have any edges")
+		logger.Info("Cluster ", clusterName, " doesn't have any edges")
 		return 0
 	}
 	//Iterating to next record to get count - count is in the first index(0) of the first record
@@ -58,28 +73,28 @@ func computeIntraEdges(clusterName string) int {
 		if count, ok := countInterface.(int); ok {
 			return count
 		} else {
-			glog.Errorf("Could not parse edge count results for cluster %s", clusterName)
+			logger.Errorf("Could not parse edge count results for cluster %s", clusterName)
 		}
 	}
 
 	return 0
 }
 
-func assertClusterNode(clusterName string) bool {
+func assertClusterNode(ctx context.Context, clusterName string) bool {
 	if clusterName == "local-cluster" || config.Cfg.SkipClusterValidation == "true" {
-		_, err := db.MergeDummyCluster(clusterName)
+		_, err := db.MergeDummyCluster(ctx, clusterName)
 		if err != nil {
-			glog.Error("Could not merge local cluster Cluster resource: ", err)
+			logger.Error("Could not merge local cluster Cluster resource: ", err)
 			return false
 		}
 	} else {
-		resp, err := db.CheckClusterResource(clusterName)
+		resp, err := db.CheckClusterResource(ctx, clusterName)
 		if err != nil {
-			glog.Error("Could not check cluster resource by name: ", err)
+			logger.Error("Could not check cluster resource by name: ", err)
 			return false
 		}
 		if resp.Empty() {
-			glog.Infof("Cluster %s does not exist.", clusterName)
+			logger.Infof("Cluster %s does not exist.", clusterName)
 			return false
 		}
 		//Iterating to next record to get count - count is in the first index(0) of the first record
@@ -91,7 +106,7 @@ func assertClusterNode(clusterName string) bool {
 					return false
 				}
 			} else {
-				glog.Errorf("Could not parse Cluster count results for cluster %s", clusterName)
+				logger.Errorf("Could not parse Cluster count results for cluster %s", clusterName)
 			}
 		}
 	}
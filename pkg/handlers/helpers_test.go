@@ -9,6 +9,9 @@ The source code for this program is not published or otherwise divested of its t
 package handlers
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"testing"
 
 	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
@@ -16,10 +19,22 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// Runs the test against a new in-memory datastore, or the RedisGraph at REDISGRAPH_TEST_ADDRESS when it's set. Waits
+// for the background jobs of the previous tests first, and for those of the test before restoring the previous
+// datastore.
+func useTestDatastore(t testing.TB) {
+	backgroundJobs.Wait()
+	restore := db.UseTestDatastore()
+	t.Cleanup(func() {
+		backgroundJobs.Wait()
+		restore()
+	})
+}
+
 type MockCache struct {
 }
 
-func (mc MockCache) Query(input string) (*rg2.QueryResult, error) {
+func (mc MockCache) Query(ctx context.Context, input string) (*rg2.QueryResult, error) {
 	//res := [][]string{{"Header"}, {"100"}}
 
 	return &rg2.QueryResult{}, nil
@@ -29,6 +44,15 @@ func TestNodeCount(t *testing.T) {
 	fakeCache := MockCache{}
 	db.Store = fakeCache
 
-	count := computeNodeCount("anyinput")
+	count := computeNodeCount(context.Background(), "anyinput")
 	assert.Equal(t, 0, count)
 }
+
+func TestSyncErrorStatus(t *testing.T) {
+	retryable := &db.BatchError{Op: "insert", Err: errors.New("EOF"), Retryable: true}
+	assert.Equal(t, http.StatusServiceUnavailable, syncErrorStatus(retryable))
+	partial := &db.PartialError{Op: "insert", Errors: map[string]error{
+		"a": &db.ResourceError{Op: "insert", UID: "a", Err: errors.New("Invalid query")},
+	}}
+	assert.Equal(t, http.StatusBadRequest, syncErrorStatus(partial))
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Properties of the search filters tracked by the index advisor, the next ones are ignored.
+const indexAdvisorMaxProperties = 1000
+
+// Properties the index advisor never recommends. The kind is matched by the node label, and the labels are a list.
+var unindexedProperties = map[string]bool{"kind": true, "label": true}
+
+// Searches filtering on a property of the nodes with a label.
+type propertySearches struct {
+	label    string
+	property string
+	searches int
+	latency  time.Duration // Total time of the searches.
+}
+
+var (
+	propertySearchStats      = make(map[string]*propertySearches) // Keyed by label.property
+	propertySearchStatsMutex = sync.Mutex{}
+)
+
+// An index recommended by the index advisor, with the estimated benefit.
+type IndexRecommendation struct {
+	Label         string  `json:"label"`
+	Property      string  `json:"property"`
+	Searches      int     `json:"searches"` // Searches filtering on the property since the aggregator started.
+	MeanLatencyMS float64 `json:"meanLatencyMs"`
+	Nodes         int     `json:"nodes"` // Nodes with the label, each search scans all of them without the index.
+	// Estimated nodes the searches scanned, the index would only scan the matching ones.
+	ScannedNodes int64 `json:"scannedNodes"`
+	Created      bool  `json:"created,omitempty"` // Created by the index advisor, with INDEX_ADVISOR_AUTO_CREATE.
+}
+
+// Response body for IndexAdvisor.
+type IndexAdvice struct {
+	AutoCreate      bool                  `json:"autoCreate"`
+	MinSearches     int                   `json:"minSearches"`
+	Recommendations []IndexRecommendation `json:"recommendations"` // Highest scanned nodes first.
+}
+
+// Counts the properties filtered by a search, for the index advisor. Searches without a kind label are skipped,
+// RedisGraph indexes are on the properties of a label.
+func observeSearchFilters(compiled db.CompiledSearch, duration time.Duration) {
+	label := compiled.Label()
+	if label == "" {
+		return
+	}
+	seen := make(map[string]bool)
+	propertySearchStatsMutex.Lock()
+	defer propertySearchStatsMutex.Unlock()
+	for _, filter := range compiled.Filters {
+		key := label + "." + filter.Property
+		if unindexedProperties[filter.Property] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		stats, ok := propertySearchStats[key]
+		if !ok {
+			if len(propertySearchStats) >= indexAdvisorMaxProperties {
+				continue
+			}
+			stats = &propertySearches{label: label, property: filter.Property}
+			propertySearchStats[key] = stats
+		}
+		stats.searches++
+		stats.latency += duration
+	}
+}
+
+// Returns the properties with at least INDEX_ADVISOR_MIN_SEARCHES searches and no index, highest scanned nodes
+// first.
+func indexRecommendations(ctx context.Context) ([]IndexRecommendation, error) {
+	hot := []propertySearches{}
+	propertySearchStatsMutex.Lock()
+	for _, stats := range propertySearchStats {
+		if stats.searches >= config.Cfg.IndexAdvisorMinSearches {
+			hot = append(hot, *stats)
+		}
+	}
+	propertySearchStatsMutex.Unlock()
+
+	recommendations := []IndexRecommendation{}
+	if len(hot) == 0 {
+		return recommendations, nil
+	}
+	indexes, err := db.PropertyIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]int)
+	for _, p := range hot {
+		indexed := false
+		for _, property := range indexes[p.label] {
+			indexed = indexed || property == p.property
+		}
+		if indexed {
+			continue
+		}
+		count, ok := nodes[p.label]
+		if !ok {
+			if count, err = db.LabelNodeCount(ctx, p.label); err != nil {
+				return nil, err
+			}
+			nodes[p.label] = count
+		}
+		recommendations = append(recommendations, IndexRecommendation{Label: p.label, Property: p.property,
+			Searches: p.searches, Nodes: count, ScannedNodes: int64(p.searches) * int64(count),
+			MeanLatencyMS: float64(p.latency.Milliseconds()) / float64(p.searches)})
+	}
+	sort.Slice(recommendations, func(i, j int) bool {
+		if recommendations[i].ScannedNodes != recommendations[j].ScannedNodes {
+			return recommendations[i].ScannedNodes > recommendations[j].ScannedNodes
+		}
+		return recommendations[i].Label+"."+recommendations[i].Property <
+			recommendations[j].Label+"."+recommendations[j].Property
+	})
+	return recommendations, nil
+}
+
+// Creates the recommended indexes when INDEX_ADVISOR_AUTO_CREATE is true, and returns the recommendations.
+func adviseIndexes(ctx context.Context) ([]IndexRecommendation, error) {
+	recommendations, err := indexRecommendations(ctx)
+	if err != nil || config.Cfg.IndexAdvisorAutoCreate != "true" {
+		return recommendations, err
+	}
+	for i, recommendation := range recommendations {
+		if err = db.CreatePropertyIndex(ctx, recommendation.Label, recommendation.Property); err != nil {
+			return recommendations, err
+		}
+		recommendations[i].Created = true
+		logger.Infof("Created the index on :%s(%s), %d searches scanned about %d nodes without it.",
+			recommendation.Label, recommendation.Property, recommendation.Searches, recommendation.ScannedNodes)
+	}
+	return recommendations, nil
+}
+
+// IndexAdvisorJob logs the indexes recommended for the properties searched the most, and creates them when
+// INDEX_ADVISOR_AUTO_CREATE is true.
+func IndexAdvisorJob() {
+	if config.Cfg.IndexAdvisorRateMS <= 0 {
+		logger.Info("Disabled the index advisor, INDEX_ADVISOR_RATE_MS is 0.")
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.Cfg.IndexAdvisorRateMS) * time.Millisecond)
+		ctx := db.WithLane(context.Background(), db.BulkLane)
+		recommendations, err := adviseIndexes(ctx)
+		if err != nil {
+			logger.Warning("Error checking the index recommendations: ", err)
+			continue
+		}
+		for _, recommendation := range recommendations {
+			if !recommendation.Created {
+				logger.Infof("Recommended an index on :%s(%s), %d searches scanned about %d nodes without it.",
+					recommendation.Label, recommendation.Property, recommendation.Searches,
+					recommendation.ScannedNodes)
+			}
+		}
+	}
+}
+
+// IndexAdvisor responds with the indexes recommended for the properties searched the most and their estimated
+// benefit. It doesn't create them, the IndexAdvisorJob does with INDEX_ADVISOR_AUTO_CREATE.
+func IndexAdvisor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	recommendations, err := indexRecommendations(r.Context())
+	if err != nil {
+		logger.Warning("Error reading the index recommendations: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	response := IndexAdvice{AutoCreate: config.Cfg.IndexAdvisorAutoCreate == "true",
+		MinSearches: config.Cfg.IndexAdvisorMinSearches, Recommendations: recommendations}
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to IndexAdvisor: ", encodeError)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexAdvisor(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	defer func() {
+		propertySearchStatsMutex.Lock()
+		propertySearchStats = make(map[string]*propertySearches)
+		propertySearchStatsMutex.Unlock()
+	}()
+	useTestDatastore(t)
+	config.Cfg.KindLabels, config.Cfg.IndexAdvisorAutoCreate, config.Cfg.IndexAdvisorMinSearches = "true", "false", 2
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Pod {_uid:'c1/p1', kind:'pod', status:'Running', namespace:'a'}), "+
+		"(:Pod {_uid:'c1/p2', kind:'pod', status:'Failed', namespace:'b'}), "+
+		"(:Node {_uid:'c1/n1', kind:'node', name:'n1'})")
+	assert.NoError(t, err)
+	assert.NoError(t, db.CreatePropertyIndex(ctx, "Pod", "namespace"))
+
+	for _, search := range []string{"kind:pod status:Running", "kind:pod status:Failed namespace:a",
+		"kind:pod status:Running,Failed namespace:b", "kind:node name:n1", "status:Running", "status:Failed"} {
+		w := httptest.NewRecorder()
+		Search(w, httptest.NewRequest("POST", "/aggregator/search",
+			strings.NewReader(`{"search": "`+search+`"}`)))
+		assert.Equal(t, http.StatusOK, w.Code, search)
+	}
+
+	advice := func() IndexAdvice {
+		w := httptest.NewRecorder()
+		IndexAdvisor(w, httptest.NewRequest("GET", "/aggregator/admin/indexes/advisor", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response IndexAdvice
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+	response := advice()
+	assert.False(t, response.AutoCreate)
+	assert.Equal(t, 2, response.MinSearches)
+	if assert.Len(t, response.Recommendations, 1, "Pod namespace is indexed, Node name has a single search.") {
+		recommendation := response.Recommendations[0]
+		assert.Equal(t, "Pod", recommendation.Label)
+		assert.Equal(t, "status", recommendation.Property)
+		assert.Equal(t, 3, recommendation.Searches, "Searches without a kind aren't counted.")
+		assert.Equal(t, 2, recommendation.Nodes)
+		assert.Equal(t, int64(6), recommendation.ScannedNodes)
+	}
+
+	recommendations, err := adviseIndexes(ctx)
+	assert.NoError(t, err)
+	assert.False(t, recommendations[0].Created, "Only created with INDEX_ADVISOR_AUTO_CREATE.")
+
+	config.Cfg.IndexAdvisorAutoCreate = "true"
+	recommendations, err = adviseIndexes(ctx)
+	assert.NoError(t, err)
+	assert.True(t, recommendations[0].Created)
+	indexes, err := db.PropertyIndexes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"namespace", "status"}, indexes["Pod"])
+	assert.Empty(t, advice().Recommendations)
+}
@@ -11,27 +11,38 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang/glog"
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
 	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
-var ApplicationLastUpdated time.Time
-var previousAppInstance int
+// Clusters with subscription changes since the last pass of the intercluster edge builder.
+// A change in the hub (local-cluster) rebuilds the edges of all clusters.
+var (
+	interClusterChanges      = make(map[string]struct{})
+	interClusterFullRebuild  = true // The first pass rebuilds all the edges.
+	interClusterChangesMutex = sync.Mutex{}
+	policyEdgesChanged       = true // Policy, binding or placement rule changes since the last pass.
+)
 
-func getApplicationUpdateTime() time.Time {
-	return ApplicationLastUpdated
-}
+// Clusters with remote subscriptions seen by the builder. Only used by the builder goroutine.
+var subscriptionClusters = make(map[string]struct{})
+
+var previousAppInstance int
+var previousPolicyInstance int
 
 func currAppInstance() int {
 	n, err := rand.Int(rand.Reader, big.NewInt(99999))
 	if err != nil {
-		glog.Error("Not able to generate random number for appInstance")
+		logger.Error("Not able to generate random number for appInstance")
 		if previousAppInstance == 99999 {
 			return previousAppInstance - 1
 		}
@@ -40,53 +51,131 @@ func currAppInstance() int {
 	return int(n.Int64())
 }
 
-// runs all the specific inter-cluster relationships we want to connect
-func BuildInterClusterEdges() {
-	var tranforms = []struct {
-		transfrom   func() (rg2.QueryResult, error)
-		description string
-		getUpdate   func() time.Time
-	}{
-		{
-			buildSubscriptions,
-			"connecting subscription edges",
-			getApplicationUpdateTime,
-		},
+// Marks the cluster to recompute its intercluster edges in the next pass.
+func markInterClusterChange(clusterName string) {
+	interClusterChangesMutex.Lock()
+	defer interClusterChangesMutex.Unlock()
+	if clusterName == "local-cluster" {
+		interClusterFullRebuild = true
+		return
 	}
+	interClusterChanges[clusterName] = struct{}{}
+}
 
+// Marks the policy edges to be rebuilt in the next pass.
+func markPolicyChange() {
+	interClusterChangesMutex.Lock()
+	defer interClusterChangesMutex.Unlock()
+	policyEdgesChanged = true
+}
+
+// Returns and clears the changes since the last pass.
+func takeInterClusterChanges() (clusters map[string]struct{}, fullRebuild bool) {
+	interClusterChangesMutex.Lock()
+	defer interClusterChangesMutex.Unlock()
+	clusters, fullRebuild = interClusterChanges, interClusterFullRebuild
+	interClusterChanges, interClusterFullRebuild = make(map[string]struct{}), false
+	return clusters, fullRebuild
+}
+
+// Returns and clears whether the policy edges changed since the last pass.
+func takePolicyChange() bool {
+	interClusterChangesMutex.Lock()
+	defer interClusterChangesMutex.Unlock()
+	changed := policyEdgesChanged
+	policyEdgesChanged = false
+	return changed
+}
+
+// Builds the intercluster relationships, only for the clusters that changed since the last pass.
+// Passes are deferred while the syncs load the graph, see edgeBuildSchedule.
+func BuildInterClusterEdges() {
+	wait := time.Duration(config.EdgeBuildRateMS()) * time.Millisecond
+	var deferredSince time.Time
 	for {
-		interval := time.Duration(config.Cfg.EdgeBuildRateMS) * time.Millisecond
-		time.Sleep(interval)
-
-		glog.V(3).Info("Building intercluster edges")
-
-		for _, edgeFunc := range tranforms {
-			// if no updates have been made during the sleep skip edge building
-			// logic here is if timestamp < current time - interval
-			updateTime := edgeFunc.getUpdate()
-			// Comment out the Next 3 lines if you want to test intercluster locally
-			if updateTime.Before(time.Now().Add(-interval)) {
-				glog.V(3).Infof("Skipping %s because nothing has changed", edgeFunc.description)
-				continue
+		time.Sleep(wait)
+
+		var decision string
+		deferredFor := time.Duration(0)
+		if !deferredSince.IsZero() {
+			deferredFor = time.Since(deferredSince)
+		}
+		load := db.CurrentWriteLoad()
+		decision, wait = edgeBuildSchedule(load, deferredFor)
+		metrics.InterClusterEdgeSchedule.WithLabelValues(decision).Inc()
+		if decision == edgeBuildDeferred {
+			if deferredSince.IsZero() {
+				deferredSince = time.Now()
 			}
-			glog.V(3).Infof("Running  %s because change observed", edgeFunc.description)
-			_, err := edgeFunc.transfrom()
-			if err != nil {
-				glog.Errorf("Error %s : %s", edgeFunc.description, err)
+			logger.V(3).Infof("Deferring intercluster edges, write load: %.1f writes/s, %.1f ms latency",
+				load.WriteQPS, load.LatencyMS)
+			continue
+		}
+		deferredSince = time.Time{}
+
+		if takePolicyChange() {
+			if err := buildPolicyEdges(); err != nil {
+				logger.Error("Error connecting policy edges: ", err)
+				markPolicyChange() // Retry in the next pass.
+			}
+		}
+
+		clusters, fullRebuild := takeInterClusterChanges()
+		if !fullRebuild && len(clusters) == 0 {
+			logger.V(3).Info("Skipping intercluster edges because nothing has changed")
+			metrics.InterClusterEdgeClusters.WithLabelValues("skipped").Add(float64(len(subscriptionClusters)))
+			continue
+		}
+		logger.V(3).Infof("Building intercluster edges. Full rebuild: %t, changed clusters: %d", fullRebuild, len(clusters))
+		if fullRebuild {
+			clusters = nil
+		}
+		processed, err := buildSubscriptions(clusters)
+		if err != nil {
+			logger.Error("Error connecting subscription edges: ", err)
+			// Retry the clusters in the next pass.
+			for clusterName := range clusters {
+				markInterClusterChange(clusterName)
+			}
+			if fullRebuild {
+				markInterClusterChange("local-cluster")
+			}
+			continue
+		}
+		recordInterClusterEdgeBuild(time.Now())
+		metrics.InterClusterEdgeClusters.WithLabelValues("processed").Add(float64(len(processed)))
+		skipped := 0
+		for clusterName := range subscriptionClusters {
+			if _, ok := processed[clusterName]; !ok {
+				skipped++
 			}
 		}
+		metrics.InterClusterEdgeClusters.WithLabelValues("skipped").Add(float64(skipped))
 	}
 }
 
-func getUIDsForSubscriptions() (*rg2.QueryResult, error) {
-	query := "MATCH (n {kind: 'subscription'}) RETURN n._uid"
-	uidResults, err := db.Store.Query(query)
+// Matches the subscriptions the way the compiled searches do, by their kind label only while KIND_LABELS is enabled
+// and the graph has the label, so the nodes stored before the labels are found too.
+func getUIDsForSubscriptions(ctx context.Context) (*rg2.QueryResult, error) {
+	kindLabels, err := searchKindLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := db.CompileSearchWithKindLabels("kind:subscription", kindLabels)
+	if err != nil {
+		return nil, err
+	}
+	query := strings.TrimSuffix(compiled.Query, "RETURN n") + "RETURN n._uid"
+	uidResults, err := db.Store.Query(ctx, query)
 	return uidResults, err
 }
 
-func buildSubscriptions() (rg2.QueryResult, error) {
+// Connects the remote subscriptions of the clusters to their hosting subscription on the hub.
+// Rebuilds the edges of all clusters when clusters is nil. Returns the clusters processed.
+func buildSubscriptions(clusters map[string]struct{}) (map[string]struct{}, error) {
 	// Record start time
 	start := time.Now()
+	ctx := db.WithoutWriteLoad(db.WithLane(context.Background(), db.BulkLane))
 	currentAppInstance := currAppInstance()
 	// Making sure that this instanceID is different from the previous
 	for currentAppInstance == previousAppInstance {
@@ -94,17 +183,27 @@ func buildSubscriptions() (rg2.QueryResult, error) {
 	}
 
 	// list of remote subscriptions
-	query := "MATCH (n:Subscription) WHERE n.cluster <> 'local-cluster' RETURN n._uid, n._hostingSubscription"
-	remoteSubscriptions, err := db.Store.Query(query)
+	query := "MATCH (n:Subscription) WHERE n.cluster <> 'local-cluster' RETURN n._uid, n._hostingSubscription, n.cluster"
+	if clusters != nil {
+		conditions := make([]string, 0, len(clusters))
+		for clusterName := range clusters {
+			conditions = append(conditions, db.SanitizeQuery("n.cluster='%s'", clusterName))
+		}
+		/* #nosec G201 - Input is sanitized above. */
+		query = "MATCH (n:Subscription) WHERE " + strings.Join(conditions, " OR ") +
+			" RETURN n._uid, n._hostingSubscription, n.cluster"
+	}
+	remoteSubscriptions, err := db.Store.Query(ctx, query)
 	if err != nil {
-		return rg2.QueryResult{}, err
+		return nil, err
 	}
+	seen := make(map[string]struct{}) // Clusters with remote subscriptions.
 	if !remoteSubscriptions.Empty() { //Check if any results are returned
 		// list of hub subscriptions
 		query = "MATCH (n:Subscription) WHERE  n.cluster='local-cluster' RETURN n._uid, n.namespace+'/'+n.name"
-		hubSubscriptons, err := db.Store.Query(query)
+		hubSubscriptons, err := db.Store.Query(ctx, query)
 		if err != nil {
-			return rg2.QueryResult{}, err
+			return nil, err
 		}
 
 		//Adding all hubsubscriptions to a map: key is subscription's "namespace+'/'+name", value is UID
@@ -116,14 +215,11 @@ func buildSubscriptions() (rg2.QueryResult, error) {
 
 		for remoteSubscriptions.Next() {
 			remoteRecord := remoteSubscriptions.Record()
-			var remoteSub [2]string
-
-			if _, ok := remoteRecord.GetByIndex(0).(string); ok {
-				remoteSub[0] = remoteRecord.GetByIndex(0).(string)
-			}
-			if _, ok := remoteRecord.GetByIndex(1).(string); ok {
-				remoteSub[1] = remoteRecord.GetByIndex(1).(string)
+			var remoteSub [3]string
+			for i := range remoteSub {
+				remoteSub[i], _ = remoteRecord.GetByIndex(i).(string)
 			}
+			seen[remoteSub[2]] = struct{}{}
 			var hubSubUID string
 			var ok bool
 			if remoteSub[1] != "" {
@@ -131,41 +227,72 @@ func buildSubscriptions() (rg2.QueryResult, error) {
 			}
 			if ok {
 				// Add an edge between remoteSub and hubSub.
-				query0 := db.SanitizeQuery("MATCH (hubSub:Subscription {_uid: '%s'}), (remoteSub:Subscription {_uid: '%s'}) CREATE (remoteSub)-[:hostedSub {_interCluster: true,app_instance: %d}]->(hubSub)",
-					hubSubUID, remoteSub[0], currentAppInstance)
-				resp, err := db.Store.Query(query0)
+				query0 := db.SanitizeQuery("MATCH (hubSub:Subscription {_uid: '%s'}), (remoteSub:Subscription {_uid: '%s'}) CREATE (remoteSub)-[:hostedSub ",
+					hubSubUID, remoteSub[0]) + db.InterClusterEdgeProperties("hostedSub", currentAppInstance) + "]->(hubSub)"
+				resp, err := db.Store.Query(db.WithWrite(ctx), query0)
 				if err != nil {
-					glog.Errorf("Error %s : %s", query, err) //Logging error so that loop will continue
+					logger.Errorf("Error %s : %s", query, err) //Logging error so that loop will continue
 				} else {
-					glog.V(4).Info("Number of edges created by query: ", query, " is : ", resp.RelationshipsCreated())
+					db.ObserveEdgeType("hostedSub")
+					logger.V(4).Info("Number of edges created by query: ", query, " is : ", resp.RelationshipsCreated())
 				}
 			}
 		}
-		//Delete interclusters with other instance ids after all hub subscriptions are processed
+	}
+
+	//Delete interclusters with other instance ids after all hub subscriptions are processed
+	if clusters == nil {
 		deleteOldInstance := db.SanitizeQuery("MATCH ()-[e {_interCluster:true}]->() WHERE (type(e)='hostedSub' OR type(e)='usedBy' OR type(e)='deployedBy') AND e.app_instance<>%d DELETE e",
 			currentAppInstance)
-		_, err = db.Store.Query(deleteOldInstance)
-		if err != nil {
-			return rg2.QueryResult{}, err
+		if _, err = db.Store.Query(db.WithWrite(ctx), deleteOldInstance); err != nil {
+			return nil, err
 		}
-	} else {
-		//Delete interclusters because there is no remote subscriptions
-		deleteOldInstance := db.SanitizeQuery("MATCH ()-[e {_interCluster:true}]->() WHERE (type(e)='hostedSub' OR type(e)='usedBy' OR type(e)='deployedBy') AND e.app_instance<>%d DELETE e",
-			currentAppInstance)
-		_, err = db.Store.Query(deleteOldInstance)
-		if err != nil {
-			return rg2.QueryResult{}, err
+		subscriptionClusters = seen
+		previousAppInstance = currentAppInstance
+		logEdgeBuildTime(start)
+		return seen, nil
+	}
+	for clusterName := range clusters {
+		deleteOldInstance := db.SanitizeQuery("MATCH (s:Subscription {cluster:'%s'})-[e:hostedSub {_interCluster:true}]->() WHERE e.app_instance<>%d DELETE e",
+			clusterName, currentAppInstance)
+		if _, err = db.Store.Query(db.WithWrite(ctx), deleteOldInstance); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[clusterName]; ok {
+			subscriptionClusters[clusterName] = struct{}{}
+		} else {
+			delete(subscriptionClusters, clusterName)
 		}
-
 	}
 	previousAppInstance = currentAppInstance // Next iteration we dont want to use this ID
+	logEdgeBuildTime(start)
+	return clusters, nil
+}
+
+// Rebuilds the edges from the policies and their placements to the clusters and resources they target.
+func buildPolicyEdges() error {
+	start := time.Now()
+	ctx := db.WithoutWriteLoad(db.WithLane(context.Background(), db.BulkLane))
+	instance := currAppInstance()
+	for instance == previousPolicyInstance {
+		instance = currAppInstance()
+	}
+	created, err := db.BuildPolicyEdges(ctx, instance)
+	if err != nil {
+		return err
+	}
+	previousPolicyInstance = instance
+	logger.V(3).Infof("Created %d policy edges in %s", created, time.Since(start))
+	return nil
+}
+
+func logEdgeBuildTime(start time.Time) {
 	// Record elapsed time
 	elapsed := time.Since(start)
 	// Log a warning if it takes more than 100ms.
 	if elapsed.Nanoseconds() > 100*1000*1000 {
-		glog.Warningf("Intercluster edge deletion and re-creation took %s", elapsed)
+		logger.Warningf("Intercluster edge deletion and re-creation took %s", elapsed)
 	} else {
-		glog.V(4).Infof("Intercluster edge deletion and re-creation took %s", elapsed)
+		logger.V(4).Infof("Intercluster edge deletion and re-creation took %s", elapsed)
 	}
-	return rg2.QueryResult{}, nil
 }
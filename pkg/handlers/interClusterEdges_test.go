@@ -0,0 +1,108 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func hostedSubEdges(t *testing.T, clusterName string) int {
+	result, err := db.Store.Query(context.Background(),
+		"MATCH (s:Subscription {cluster:'"+clusterName+"'})-[e:hostedSub {_interCluster:true}]->() RETURN count(e)")
+	if !assert.Nil(t, err) || !assert.True(t, result.Next()) {
+		t.FailNow()
+	}
+	return result.Record().GetByIndex(0).(int)
+}
+
+func Test_buildSubscriptions_incremental(t *testing.T) {
+	useTestDatastore(t)
+	prevClusters := subscriptionClusters
+	subscriptionClusters = make(map[string]struct{})
+	defer func() { subscriptionClusters = prevClusters }()
+
+	_, err := db.Store.Query(context.Background(), "CREATE "+
+		"(:Subscription {_uid:'local-cluster/hub', cluster:'local-cluster', namespace:'app', name:'sub'}), "+
+		"(:Subscription {_uid:'c1/sub', cluster:'c1', _hostingSubscription:'app/sub'}), "+
+		"(:Subscription {_uid:'c2/sub', cluster:'c2', _hostingSubscription:'app/sub'})")
+	assert.Nil(t, err)
+
+	processed, err := buildSubscriptions(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"c1": {}, "c2": {}}, processed)
+	assert.Equal(t, 1, hostedSubEdges(t, "c1"))
+	assert.Equal(t, 1, hostedSubEdges(t, "c2"))
+	edges, err := db.Edges(context.Background(), db.EdgeOptions{Cluster: "c1", EdgeTypes: []string{"hostedSub"}})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(edges.Items)) {
+		assert.Equal(t, "hosting-subscription", edges.Items[0].Provenance.Rule)
+		assert.Equal(t, "local-cluster", edges.Items[0].Provenance.SourceHub)
+		assert.NotEmpty(t, edges.Items[0].Provenance.CreatedBy)
+	}
+
+	// Only the changed cluster is recomputed and its previous edge is replaced.
+	_, err = db.Store.Query(context.Background(), "MATCH (s:Subscription {_uid:'c2/sub'}) DELETE s")
+	assert.Nil(t, err)
+	processed, err = buildSubscriptions(map[string]struct{}{"c1": {}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"c1": {}}, processed)
+	assert.Equal(t, 1, hostedSubEdges(t, "c1"))
+	assert.Equal(t, map[string]struct{}{"c1": {}, "c2": {}}, subscriptionClusters)
+
+	processed, err = buildSubscriptions(map[string]struct{}{"c2": {}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"c2": {}}, processed)
+	assert.Equal(t, map[string]struct{}{"c1": {}}, subscriptionClusters)
+}
+
+func Test_markInterClusterChange(t *testing.T) {
+	takeInterClusterChanges()
+
+	markInterClusterChange("c1")
+	clusters, fullRebuild := takeInterClusterChanges()
+	assert.Equal(t, map[string]struct{}{"c1": {}}, clusters)
+	assert.False(t, fullRebuild)
+
+	markInterClusterChange("local-cluster")
+	clusters, fullRebuild = takeInterClusterChanges()
+	assert.Empty(t, clusters)
+	assert.True(t, fullRebuild)
+}
+
+func Test_getUIDsForSubscriptions(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	uids := func() []string {
+		result, err := getUIDsForSubscriptions(context.Background())
+		assert.Nil(t, err)
+		uids := []string{}
+		for result.Next() {
+			uids = append(uids, result.Record().GetByIndex(0).(string))
+		}
+		return uids
+	}
+
+	// Stored before the kind labels.
+	_, err := db.Store.Query(context.Background(), "CREATE (:Resource {_uid:'c1/sub', kind:'subscription'}), "+
+		"(:Resource {_uid:'c1/pod', kind:'pod'})")
+	assert.Nil(t, err)
+	for _, kindLabels := range []string{"true", "false"} {
+		config.Cfg.KindLabels = kindLabels
+		assert.Equal(t, []string{"c1/sub"}, uids(), kindLabels)
+	}
+
+	_, err = db.Store.Query(context.Background(), "MATCH (n {_uid:'c1/sub'}) DELETE n")
+	assert.Nil(t, err)
+	_, err = db.Store.Query(context.Background(), "CREATE (:Subscription {_uid:'c2/sub', kind:'subscription'})")
+	assert.Nil(t, err)
+	for _, kindLabels := range []string{"true", "false"} {
+		config.Cfg.KindLabels = kindLabels
+		assert.Equal(t, []string{"c2/sub"}, uids(), kindLabels)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Inventory - Object sent by the collector before a resync with the hash of each of its resources.
+type Inventory struct {
+	Resources []InventoryItem `json:"resources"`
+	RequestId int             `json:"requestId"`
+}
+
+// InventoryItem - UID and hash of a resource in the cluster.
+type InventoryItem struct {
+	UID  string `json:"uid"`
+	Hash string `json:"hash"`
+}
+
+// InventoryResponse - Response to an Inventory
+type InventoryResponse struct {
+	Needed    []string `json:"needed"` // UIDs missing or changed in the datastore, the resync must send them in full.
+	Version   string   `json:"version"`
+	RequestId int      `json:"requestId"`
+}
+
+// ClusterInventory compares the resources of the collector with the datastore and responds with the UIDs the next
+// resync needs in full. The resync sends the rest of the resources in unchangedResources, by UID only.
+func ClusterInventory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+
+	var inventory Inventory
+	if err := json.NewDecoder(r.Body).Decode(&inventory); err != nil {
+		logger.Warning("Error decoding inventory from cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+
+	hashes, err := db.ResourceHashes(r.Context(), clusterName)
+	if err != nil {
+		logger.Warning("Error reading resource hashes for cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	response := InventoryResponse{
+		Needed:    neededResources(clusterName, inventory.Resources, hashes),
+		Version:   config.AGGREGATOR_API_VERSION,
+		RequestId: inventory.RequestId,
+	}
+	logger.V(2).Infof("Inventory from cluster %s with %d resources, %d needed in full.",
+		clusterName, len(inventory.Resources), len(response.Needed))
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to Inventory: ", encodeError)
+	}
+}
+
+// Returns the UIDs of the inventory missing from the datastore or stored with a different or no hash.
+func neededResources(clusterName string, items []InventoryItem, hashes map[string]string) []string {
+	needed := []string{}
+	for _, item := range items {
+		// Resources are stored with the normalized UID, the collector still refers to them with its own.
+		uid, _, err := db.NormalizeUID(item.UID, clusterName)
+		if err != nil {
+			uid = item.UID
+		}
+		if stored, ok := hashes[uid]; !ok || stored == "" || stored != item.Hash {
+			needed = append(needed, item.UID)
+		}
+	}
+	return needed
+}
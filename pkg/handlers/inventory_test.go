@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_neededResources(t *testing.T) {
+	hashes := map[string]string{"c1/same": "h1", "c1/changed": "h1", "c1/nohash": ""}
+	needed := neededResources("c1", []InventoryItem{
+		{UID: "c1/same", Hash: "h1"},
+		{UID: "c1/changed", Hash: "h2"},
+		{UID: "c1/nohash", Hash: "h1"},
+		{UID: "c1/new", Hash: "h1"},
+	}, hashes)
+	assert.Equal(t, []string{"c1/changed", "c1/nohash", "c1/new"}, needed)
+}
+
+func Test_resyncCluster_unchangedResources(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+
+	_, err := db.Store.Query(ctx, "CREATE (:Cluster {name: 'c1', kind: 'cluster'})")
+	assert.Nil(t, err)
+	pod := func(name, hash string) *db.Resource {
+		return &db.Resource{Kind: "Pod", UID: "c1/" + name, Hash: hash,
+			Properties: map[string]interface{}{"kind": "Pod", "name": name, "cluster": "c1"}}
+	}
+	insertResult := db.ChunkedInsert(ctx, []*db.Resource{pod("a", "h1"), pod("b", "h1"), pod("c", "h1")}, "c1")
+	assert.Equal(t, 3, insertResult.SuccessfulResources)
+
+	hashes, err := db.ResourceHashes(ctx, "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"c1/a": "h1", "c1/b": "h1", "c1/c": "h1"}, hashes)
+
+	// The collector sends b in full because it changed, a by UID only, and c is gone.
+	metrics := InitSyncMetrics("c1")
+	stats, err := resyncCluster(ctx, "c1", []*db.Resource{pod("b", "h2")}, []string{"c1/a", "c1/missing"}, nil, &metrics)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.TotalUpdated)
+	assert.Equal(t, 1, stats.TotalDeleted)
+	assert.Equal(t, []SyncError{{ResourceUID: "c1/missing", Message: "Unchanged resource not found, it must be sent in full.",
+		Code: ERROR_UNCHANGED_RESOURCE_NOT_FOUND}}, stats.AddErrors)
+
+	hashes, err = db.ResourceHashes(ctx, "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"c1/a": "h1", "c1/b": "h2"}, hashes)
+}
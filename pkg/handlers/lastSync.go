@@ -0,0 +1,96 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Last successful sync of a cluster and the response sent to its collector.
+type LastSync struct {
+	Cluster  string       `json:"cluster"`
+	Received time.Time    `json:"received"`
+	ClearAll bool         `json:"clearAll"`
+	Response SyncResponse `json:"response"`
+}
+
+// Last successful sync of each cluster. Also kept in redis, so it's still there after the aggregator restarts.
+var (
+	lastSyncs      = make(map[string]LastSync)
+	lastSyncsMutex = sync.RWMutex{}
+)
+
+// Keeps the response to a successful sync as the last one of the cluster.
+func recordLastSync(clusterName string, clearAll bool, response SyncResponse) {
+	lastSync := LastSync{Cluster: clusterName, Received: time.Now(), ClearAll: clearAll, Response: response}
+	lastSyncsMutex.Lock()
+	lastSyncs[clusterName] = lastSync
+	lastSyncsMutex.Unlock()
+	runInBackground(func() {
+		entry, err := json.Marshal(lastSync)
+		if err == nil {
+			err = db.RecordLastSync(context.Background(), clusterName, lastSync.Received, entry)
+		}
+		if err != nil {
+			logger.Warning("Error recording the last sync of cluster ", clusterName, ": ", err)
+		}
+	})
+}
+
+// Returns the last successful sync of the cluster, from memory or else from redis. False when there's none.
+func getLastSync(ctx context.Context, clusterName string) (LastSync, bool, error) {
+	lastSyncsMutex.RLock()
+	lastSync, ok := lastSyncs[clusterName]
+	lastSyncsMutex.RUnlock()
+	if ok {
+		return lastSync, true, nil
+	}
+	entry, err := db.LastSync(ctx, clusterName)
+	if err != nil || entry == nil {
+		return lastSync, false, err
+	}
+	if err = json.Unmarshal(entry, &lastSync); err != nil {
+		return lastSync, false, err
+	}
+	lastSyncsMutex.Lock()
+	if _, ok := lastSyncs[clusterName]; !ok { // A sync may have come in while reading.
+		lastSyncs[clusterName] = lastSync
+	}
+	lastSyncsMutex.Unlock()
+	return lastSync, true, nil
+}
+
+// ClusterLastSync responds with the last successful sync of a cluster and the response sent to its collector, to
+// check that data is flowing without waiting for the next sync. Responds with 404 when there's none.
+func ClusterLastSync(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+
+	lastSync, ok, err := getLastSync(r.Context(), clusterName)
+	if err != nil {
+		logger.Warning("Error reading the last sync of cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	if !ok {
+		respondError(w, http.StatusNotFound, ERROR_SYNC_NOT_FOUND, "No successful sync from cluster "+clusterName,
+			map[string]string{"cluster": clusterName})
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(lastSync); encodeError != nil {
+		logger.Error("Error responding to ClusterLastSync: ", encodeError)
+	}
+}
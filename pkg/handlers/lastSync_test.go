@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClusterLastSync(t *testing.T) {
+	useTestDatastore(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/lastSync", ClusterLastSync)
+	get := func(clusterName string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/aggregator/clusters/"+clusterName+"/lastSync", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("bad=cluster").Code)
+	assert.Equal(t, http.StatusNotFound, get("last-sync").Code)
+
+	recordLastSync("last-sync", true, SyncResponse{TotalAdded: 3, TotalResources: 3, RequestId: 7})
+	w := get("last-sync")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var lastSync LastSync
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lastSync))
+	assert.Equal(t, "last-sync", lastSync.Cluster)
+	assert.True(t, lastSync.ClearAll)
+	assert.Equal(t, 3, lastSync.Response.TotalAdded)
+	assert.Equal(t, 7, lastSync.Response.RequestId)
+
+	// After a restart, the last sync is read from redis.
+	assert.Eventually(t, func() bool {
+		entry, _ := db.LastSync(context.Background(), "last-sync")
+		return entry != nil
+	}, time.Second, 10*time.Millisecond)
+	lastSyncsMutex.Lock()
+	delete(lastSyncs, "last-sync")
+	lastSyncsMutex.Unlock()
+	lastSync = LastSync{}
+	w = get("last-sync")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lastSync))
+	assert.Equal(t, 7, lastSync.Response.RequestId)
+}
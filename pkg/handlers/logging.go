@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/logging"
+)
+
+// Verbosity changes of the logging admin API. Both are optional.
+type LoggingRequest struct {
+	Verbosity *int `json:"verbosity"` // Global verbosity, of the modules without their own.
+	// Verbosity of each module, -1 to go back to the global verbosity.
+	Modules map[string]int `json:"modules"`
+}
+
+// Logging responds with the logging backend and the verbosity of each module. A PUT changes the verbosities in the
+// body first, the V messages of a module are logged up to its verbosity.
+func Logging(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPut {
+		var request LoggingRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+			return
+		}
+		current := logging.Levels()
+		for module := range request.Modules {
+			if _, ok := current.Modules[module]; !ok {
+				respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+					logging.ErrUnknownModule.Error()+" "+module, map[string]string{"parameter": "modules"})
+				return
+			}
+		}
+		if request.Verbosity != nil {
+			if *request.Verbosity < 0 {
+				respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "verbosity can't be negative",
+					map[string]string{"parameter": "verbosity"})
+				return
+			}
+			_ = logging.SetVerbosity("", *request.Verbosity)
+		}
+		for module, level := range request.Modules {
+			_ = logging.SetVerbosity(module, level) // The modules are known.
+		}
+		logger.Infof("Changed the log verbosity to %v", logging.Levels().Modules)
+	}
+	if encodeError := json.NewEncoder(w).Encode(logging.Levels()); encodeError != nil {
+		logger.Error("Error responding to Logging: ", encodeError)
+	}
+}
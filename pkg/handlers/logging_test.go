@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Logging(t *testing.T) {
+	prevVerbosity := logging.Verbosity("")
+	defer func() {
+		_ = logging.SetVerbosity("", prevVerbosity)
+		_ = logging.SetVerbosity("dbconnector", -1)
+	}()
+
+	send := func(method, body string) (*httptest.ResponseRecorder, logging.LevelStatus) {
+		w := httptest.NewRecorder()
+		Logging(w, httptest.NewRequest(method, "/aggregator/admin/logging", strings.NewReader(body)))
+		var status logging.LevelStatus
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+		}
+		return w, status
+	}
+
+	w, status := send("GET", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "glog", status.Backend)
+	assert.Contains(t, status.Modules, "handlers")
+
+	w, status = send("PUT", `{"verbosity": 3, "modules": {"dbconnector": 6}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, status.Verbosity)
+	assert.Equal(t, 6, status.Modules["dbconnector"])
+	assert.Equal(t, 3, status.Modules["handlers"])
+	assert.Equal(t, []string{"dbconnector"}, status.Overrides)
+
+	_, status = send("PUT", `{"modules": {"dbconnector": -1}}`)
+	assert.Equal(t, 3, status.Modules["dbconnector"])
+	assert.Empty(t, status.Overrides)
+
+	for _, body := range []string{`{"modules": {"missing": 1}}`, `{"verbosity": -2}`, `verbosity`} {
+		w, _ = send("PUT", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
@@ -14,7 +14,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/golang/glog"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
 )
 
 // Track clusters with pending requests.
@@ -32,8 +32,13 @@ type SyncMetrics struct {
 	NodeSyncEnd   time.Time
 	EdgeSyncStart time.Time
 	EdgeSyncEnd   time.Time
+	Chunks        int    // Chunks written by the chunked operations of the sync.
+	RequestId     int    // Request id of the sync, recorded with its tombstones.
+	PayloadHash   string // Hash of the payload of a resync, it resumes from the checkpoint of the same payload.
 }
 
+const progressLogInterval = 10 // Chunks between the progress logs of a long chunked operation.
+
 func InitSyncMetrics(clusterName string) SyncMetrics {
 	s := SyncMetrics{clusterName: clusterName, syncStart: time.Now()}
 	PendingRequestsMutex.Lock()
@@ -43,25 +48,37 @@ func InitSyncMetrics(clusterName string) SyncMetrics {
 }
 
 func (m SyncMetrics) CompleteSyncEvent() {
-	glog.V(2).Info("Completed sync of cluster: ", m.clusterName)
+	logger.V(2).Info("Completed sync of cluster: ", m.clusterName)
 	PendingRequestsMutex.Lock()
 	delete(PendingRequests, m.clusterName)
 	PendingRequestsMutex.Unlock()
 }
 
+// Counts the chunks of the sync and logs the progress of the operations with many chunks.
+// Used as the db.ProgressFunc of the sync.
+func (m *SyncMetrics) observeChunk(p db.ChunkProgress) {
+	m.Chunks++
+	if p.Chunk%progressLogInterval == 0 || (p.Chunk == p.Chunks && p.Chunks >= progressLogInterval) {
+		logger.V(2).Infof("Sync of cluster %s: %s chunk %d of %d, %d of %d resources done, %d errors, took %s",
+			m.clusterName, p.Op, p.Chunk, p.Chunks, p.Done, p.Total, p.Errors, p.Elapsed)
+	}
+}
+
 func (m SyncMetrics) LogPerformanceMetrics(syncEvent SyncEvent) {
 	elapsed := time.Since(m.syncStart)
 	if int(elapsed.Seconds()) > 1 {
-		glog.Warningf("SyncResources from %s took %s", m.clusterName, elapsed)
-		glog.Warningf(
+		logger.Warningf("SyncResources from %s took %s", m.clusterName, elapsed)
+		logger.Warningf(
 			"Increased processing time {request: %d, add: %d, update: %d, delete: %d edge add: %d edge delete: %d}",
 			syncEvent.RequestId, len(syncEvent.AddResources), len(syncEvent.UpdateResources),
 			len(syncEvent.DeleteResources), len(syncEvent.AddEdges), len(syncEvent.DeleteEdges))
-		glog.Warning("  > Nodes sync took: ", m.NodeSyncEnd.Sub(m.NodeSyncStart))
-		glog.Warning("  > Edges sync took: ", m.EdgeSyncEnd.Sub(m.EdgeSyncStart))
+		logger.Warning("  > Nodes sync took: ", m.NodeSyncEnd.Sub(m.NodeSyncStart))
+		logger.Warning("  > Edges sync took: ", m.EdgeSyncEnd.Sub(m.EdgeSyncStart))
+		logger.Warning("  > Chunks written: ", m.Chunks)
 	} else {
-		glog.V(4).Infof("SyncResources from %s took %s", m.clusterName, elapsed)
-		glog.V(4).Info("  > Nodes sync took: ", m.NodeSyncEnd.Sub(m.NodeSyncStart))
-		glog.V(4).Info("  > Edges sync took: ", m.EdgeSyncEnd.Sub(m.EdgeSyncStart))
+		logger.V(4).Infof("SyncResources from %s took %s", m.clusterName, elapsed)
+		logger.V(4).Info("  > Nodes sync took: ", m.NodeSyncEnd.Sub(m.NodeSyncStart))
+		logger.V(4).Info("  > Edges sync took: ", m.EdgeSyncEnd.Sub(m.EdgeSyncStart))
+		logger.V(4).Info("  > Chunks written: ", m.Chunks)
 	}
 }
@@ -0,0 +1,462 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/logging"
+)
+
+// Paths of the API discovery endpoints.
+const (
+	OPENAPI_PATH       = "/aggregator/openapi.json"
+	API_DISCOVERY_PATH = "/aggregator/apis"
+)
+
+// An endpoint of the aggregator API, documented in the OpenAPI document. The schemas of the bodies are generated
+// from the types the handlers decode and encode, so they can't drift from the API.
+type apiOperation struct {
+	id          string // operationId, the name of the handler.
+	method      string
+	path        string // Path of the route, the {name} segments are the path parameters.
+	tag         string // sync, search, status or admin.
+	summary     string
+	params      []apiParam
+	request     interface{} // Value of the type of the JSON body, nil without a body.
+	response    interface{} // Value of the type of the JSON response, nil without one.
+	status      int         // Status of the successful responses, 200 when it's 0.
+	contentType string      // Of the response when it isn't JSON.
+}
+
+// A query parameter of an operation.
+type apiParam struct {
+	name        string
+	typ         string // OpenAPI type, string when it's empty.
+	description string
+}
+
+// Descriptions of the path parameters.
+var apiPathParams = map[string]string{
+	"id":       "Name of the cluster.",
+	"uid":      "UID of the resource, without the cluster prefix.",
+	"property": "Property of the resource stored in the blob store.",
+	"capture":  "Id of the sync capture.",
+	"code":     "Error code.",
+}
+
+var (
+	debugQueriesParam = apiParam{"debugQueries", "boolean", "true to return the queries run, with the admin token."}
+	limitParam        = apiParam{"limit", "integer", "Max number of items returned."}
+	sinceParam        = apiParam{"since", "string", "RFC3339 time, only the items since then."}
+	clusterParam      = apiParam{"cluster", "string", "Name of a cluster."}
+)
+
+// Every endpoint of the aggregator, the routes of main.go.
+var apiOperations = []apiOperation{
+	{id: "LivenessProbe", method: "GET", path: "/liveness", tag: "status", summary: "Liveness probe.",
+		contentType: "text/plain"},
+	{id: "ReadinessProbe", method: "GET", path: "/readiness", tag: "status",
+		summary: "Readiness probe, with the status of each readiness check.", response: ReadinessStatus{}},
+	{id: "SyncResources", method: "POST", path: "/aggregator/clusters/{id}/sync", tag: "sync",
+		summary: "Adds, updates and deletes the resources and edges of the cluster.", request: SyncEvent{},
+		response: SyncResponse{}},
+	{id: "ClusterInventory", method: "POST", path: "/aggregator/clusters/{id}/inventory", tag: "sync",
+		summary: "Compares the inventory of the collector with the resources of the cluster.", request: Inventory{},
+		response: InventoryResponse{}},
+	{id: "ClusterStatus", method: "GET", path: "/aggregator/clusters/{id}/status", tag: "sync",
+		summary: "Status of the syncs of the cluster.", response: ClusterStatusResponse{}},
+	{id: "SyncSchema", method: "GET", path: "/aggregator/sync/schema", tag: "sync",
+		summary: "JSON Schema of the sync payloads.", contentType: "application/schema+json"},
+	{id: "CollectorSession", method: "GET", path: "/aggregator/clusters/{id}/session", tag: "sync",
+		summary: "Upgrades to a WebSocket session streaming the syncs of the collector.", status: 101},
+	{id: "CompileSearch", method: "POST", path: "/aggregator/search/compile", tag: "search",
+		summary: "Compiles a search to its query.", params: []apiParam{debugQueriesParam},
+		request: CompileSearchRequest{}, response: CompileSearchResponse{}},
+	{id: "Search", method: "POST", path: "/aggregator/search", tag: "search",
+		summary: "Runs a search and returns the matching resources.", params: []apiParam{debugQueriesParam},
+		request: SearchRequest{}, response: SearchResponse{}},
+	{id: "Aggregate", method: "POST", path: "/aggregator/search/aggregate", tag: "search",
+		summary: "Counts the resources of a search by the groupBy properties.", params: []apiParam{debugQueriesParam},
+		request: AggregateRequest{}, response: AggregateResponse{}},
+	{id: "ExplainSearch", method: "POST", path: "/aggregator/search/explain", tag: "search",
+		summary: "Execution plan of the query of a search, profiled on request.", params: []apiParam{debugQueriesParam},
+		request: ExplainSearchRequest{}, response: ExplainSearchResponse{}},
+	{id: "RelatedResources", method: "GET", path: "/aggregator/clusters/{id}/resources/{uid}/related",
+		tag: "search", summary: "Resources related to the resource.", params: []apiParam{
+			{"types", "string", "Comma separated edge types to follow."},
+			{"kinds", "string", "Comma separated kinds returned."},
+			{"direction", "string", "outgoing, incoming or both."},
+			{"depth", "integer", "Hops followed."},
+			{"minWeight", "number", "Min weight of the intercluster edges followed."},
+			limitParam},
+		response: db.RelatedResult{}},
+	{id: "OwnershipTree", method: "GET", path: "/aggregator/clusters/{id}/resources/{uid}/owned", tag: "search",
+		summary: "Resources owned by the resource.", params: []apiParam{limitParam}, response: db.OwnershipTree{}},
+	{id: "DeletedResources", method: "GET", path: "/aggregator/clusters/{id}/deleted", tag: "search",
+		summary: "Resources deleted from the cluster.", params: []apiParam{sinceParam,
+			{"kind", "string", "Kind of the resources."}, {"name", "string", "Name of the resources."},
+			{"namespace", "string", "Namespace of the resources."}, limitParam},
+		response: []db.Tombstone{}},
+	{id: "ResourceBlob", method: "GET", path: "/aggregator/clusters/{id}/resources/{uid}/blobs/{property}",
+		tag: "search", summary: "Value of a property of the resource stored in the blob store."},
+	{id: "Edges", method: "GET", path: "/aggregator/edges", tag: "search",
+		summary: "Edges of the graph, with a summary of the nodes they connect.", params: []apiParam{clusterParam,
+			{"type", "string", "Comma separated edge types."},
+			{"interCluster", "boolean", "true for the intercluster edges only, false without them."},
+			{"minWeight", "number", "Min weight of the intercluster edges."}, limitParam},
+		response: db.EdgesResult{}},
+	{id: "Schema", method: "GET", path: "/aggregator/schema", tag: "search",
+		summary: "Kinds, properties and edge types of the graph.",
+		params:  []apiParam{{"kinds", "string", "Comma separated kinds."}}, response: db.Schema{}},
+	{id: "ErrorDocs", method: "GET", path: "/errors", tag: "status", summary: "Documentation of every error code.",
+		response: []ErrorDoc{}},
+	{id: "ErrorDoc", method: "GET", path: "/errors/{code}", tag: "status",
+		summary: "Documentation of the error code.", response: ErrorDoc{}},
+	{id: "OpenAPI", method: "GET", path: OPENAPI_PATH, tag: "status", summary: "This OpenAPI document."},
+	{id: "APIDiscovery", method: "GET", path: API_DISCOVERY_PATH, tag: "status",
+		summary: "Version and endpoints of the API.", response: APIDiscoveryResponse{}},
+
+	{id: "Metrics", method: "GET", path: "/metrics", tag: "admin", summary: "Prometheus metrics.",
+		contentType: "text/plain"},
+	{id: "CompareDatastores", method: "GET", path: "/aggregator/admin/datastores/compare", tag: "admin",
+		summary: "Compares the primary and secondary datastores.", response: db.StoreComparison{}},
+	{id: "CompactGraph", method: "POST", path: "/aggregator/admin/compact", tag: "admin",
+		summary: "Compacts the graph.", response: db.CompactionStats{}},
+	{id: "SyncHistory", method: "GET", path: "/aggregator/clusters/{id}/history", tag: "admin",
+		summary: "Stats of the last syncs of the cluster.", params: []apiParam{sinceParam},
+		response: []db.SyncStats{}},
+	{id: "ClusterLastSync", method: "GET", path: "/aggregator/clusters/{id}/lastSync", tag: "admin",
+		summary: "Last successful sync of the cluster.", response: LastSync{}},
+	{id: "ClusterResyncDiff", method: "GET", path: "/aggregator/clusters/{id}/resyncDiff", tag: "admin",
+		summary: "Differences found by the last resync of the cluster.", params: []apiParam{limitParam},
+		response: ResyncDiff{}},
+	{id: "Tombstones", method: "GET", path: "/aggregator/clusters/{id}/tombstones", tag: "admin",
+		summary: "Tombstones of the resources deleted from the cluster.",
+		params:  []apiParam{sinceParam, {"uid", "string", "UID of a resource."}}, response: []db.Tombstone{}},
+	{id: "RemapCluster", method: "POST", path: "/aggregator/clusters/{id}/remap", tag: "admin",
+		summary: "Moves the resources of the cluster to a new cluster name.",
+		params:  []apiParam{{"to", "string", "New name of the cluster."}}, response: db.ClusterRemap{}},
+	{id: "QuarantineCluster", method: "POST", path: "/aggregator/clusters/{id}/quarantine", tag: "admin",
+		summary:  "Quarantines the cluster, its syncs are rejected.",
+		params:   []apiParam{{"reason", "string", "Why the cluster is quarantined."}},
+		response: db.ClusterQuarantine{}},
+	{id: "LiftQuarantine", method: "DELETE", path: "/aggregator/clusters/{id}/quarantine", tag: "admin",
+		summary: "Lifts the quarantine of the cluster.", response: db.ClusterQuarantine{}},
+	{id: "QuarantinedClusters", method: "GET", path: "/aggregator/admin/quarantines", tag: "admin",
+		summary: "Quarantined clusters.", response: []db.ClusterQuarantine{}},
+	{id: "SyncCaptures", method: "GET", path: "/aggregator/clusters/{id}/captures", tag: "admin",
+		summary: "Syncs of the cluster captured for debugging.", response: []SyncCapture{}},
+	{id: "DownloadSyncCapture", method: "GET", path: "/aggregator/clusters/{id}/captures/{capture}", tag: "admin",
+		summary: "Payload of a sync capture.", contentType: "application/gzip"},
+	{id: "ReplaySyncCapture", method: "POST", path: "/aggregator/clusters/{id}/captures/{capture}/replay",
+		tag: "admin", summary: "Replays a sync capture against a replay graph.",
+		params: []apiParam{{"graph", "string", "Name of the replay graph."},
+			{"reset", "boolean", "true to empty the replay graph first."}},
+		response: ReplayResponse{}},
+	{id: "EdgeTypeStats", method: "GET", path: "/aggregator/admin/edges/stats", tag: "admin",
+		summary: "Count of the edges of each type by cluster.", params: []apiParam{clusterParam},
+		response: EdgeTypeStatsResponse{}},
+	{id: "PruneEdges", method: "DELETE", path: "/aggregator/edges", tag: "admin",
+		summary: "Deletes the edges of a type.", params: []apiParam{{"type", "string", "Edge type, required."},
+			clusterParam, {"dryRun", "boolean", "true to only count the edges."}},
+		response: PruneEdgesResponse{}},
+	{id: "UIDCollisions", method: "GET", path: "/aggregator/admin/uidcollisions", tag: "admin",
+		summary: "UIDs sent by more than one cluster.", params: []apiParam{sinceParam},
+		response: []db.UIDCollision{}},
+	{id: "PropertyCardinalityReport", method: "GET", path: "/aggregator/admin/cardinality", tag: "admin",
+		summary: "Properties with the most distinct values.", params: []apiParam{limitParam},
+		response: []PropertyCardinality{}},
+	{id: "IndexAdvisor", method: "GET", path: "/aggregator/admin/indexes/advisor", tag: "admin",
+		summary: "Indexes recommended for the properties searched the most.", response: IndexAdvice{}},
+	{id: "Relabel", method: "POST", path: "/aggregator/admin/relabel", tag: "admin",
+		summary: "Applies the KIND_MAPPINGS to the graph.", response: []RelabelResult{}},
+	{id: "ClusterlessNodes", method: "GET", path: "/aggregator/admin/clusterless-nodes", tag: "admin",
+		summary: "Last check for nodes without the cluster property.", response: ClusterlessNodesReport{}},
+	{id: "RepairClusterlessNodes", method: "POST", path: "/aggregator/admin/clusterless-nodes", tag: "admin",
+		summary: "Repairs or deletes the nodes without the cluster property now.", response: ClusterlessNodesReport{}},
+	{id: "CreateTopologySnapshot", method: "POST", path: "/aggregator/admin/topology/snapshots", tag: "admin",
+		summary: "Takes a topology snapshot.", response: db.TopologySnapshot{}},
+	{id: "TopologySnapshots", method: "GET", path: "/aggregator/admin/topology/snapshots", tag: "admin",
+		summary: "Topology snapshots.", response: []db.TopologySnapshot{}},
+	{id: "TopologyDiff", method: "GET", path: "/aggregator/admin/topology/diff", tag: "admin",
+		summary: "Differences between two topology snapshots.", params: []apiParam{
+			{"from", "string", "RFC3339 time of the first snapshot."},
+			{"to", "string", "RFC3339 time of the second snapshot, now by default."},
+			{"dropPercent", "integer", "Percent of resources dropped reported."},
+			{"minDrop", "integer", "Resources dropped reported."}},
+		response: db.TopologyDiff{}},
+	{id: "StartRebuild", method: "POST", path: "/aggregator/admin/rebuild", tag: "admin",
+		summary: "Starts a rebuild of the graph.", request: RebuildRequest{}, response: RebuildProgress{},
+		status: http.StatusAccepted},
+	{id: "GetRebuild", method: "GET", path: "/aggregator/admin/rebuild", tag: "admin",
+		summary: "Progress of the rebuild.", response: RebuildProgress{}},
+	{id: "UpdateRebuild", method: "PATCH", path: "/aggregator/admin/rebuild", tag: "admin",
+		summary: "Changes the rebuild in progress.", request: RebuildRequest{}, response: RebuildProgress{}},
+	{id: "CancelRebuild", method: "DELETE", path: "/aggregator/admin/rebuild", tag: "admin",
+		summary: "Cancels the rebuild in progress.", response: RebuildProgress{}},
+	{id: "GetFaultInjection", method: "GET", path: "/aggregator/admin/faults", tag: "admin",
+		summary: "Faults injected into the datastore queries.", response: db.FaultInjection{}},
+	{id: "SetFaultInjection", method: "PUT", path: "/aggregator/admin/faults", tag: "admin",
+		summary: "Replaces the faults injected.", request: db.FaultInjection{}, response: db.FaultInjection{}},
+	{id: "GetReadOnly", method: "GET", path: "/aggregator/admin/readonly", tag: "admin",
+		summary: "Read-only mode of the aggregator.", response: db.ReadOnlyMode{}},
+	{id: "SetReadOnly", method: "PUT", path: "/aggregator/admin/readonly", tag: "admin",
+		summary: "Enables or disables the manual read-only mode.", request: readOnlyRequest{},
+		response: db.ReadOnlyMode{}},
+	{id: "GetLogging", method: "GET", path: "/aggregator/admin/logging", tag: "admin",
+		summary: "Logging backend and verbosities.", response: logging.LevelStatus{}},
+	{id: "SetLogging", method: "PUT", path: "/aggregator/admin/logging", tag: "admin",
+		summary: "Changes the verbosities.", request: LoggingRequest{}, response: logging.LevelStatus{}},
+	{id: "SessionDirective", method: "POST", path: "/aggregator/clusters/{id}/session/directives", tag: "admin",
+		summary: "Pushes a directive to the session of the collector.", request: Directive{},
+		status: http.StatusAccepted},
+	{id: "WatchEvents", method: "GET", path: "/aggregator/admin/watch", tag: "admin",
+		summary: "Upgrades to a WebSocket streaming the applied changes matching the filter.", status: 101,
+		params: []apiParam{{"filter", "", "Property filters of the events, in the search syntax, e.g. kind:pod."}}},
+}
+
+// An endpoint in the API discovery.
+type APIEndpoint struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	OperationID string `json:"operationId"`
+	Summary     string `json:"summary"`
+	Admin       bool   `json:"admin"` // Served on ADMIN_ADDRESS when it's set.
+}
+
+// Response body for APIDiscovery.
+type APIDiscoveryResponse struct {
+	Version    string        `json:"version"`    // AGGREGATOR_API_VERSION
+	OpenAPI    string        `json:"openapi"`    // Path of the OpenAPI document.
+	SyncSchema string        `json:"syncSchema"` // Path of the JSON Schema of the sync payloads.
+	Endpoints  []APIEndpoint `json:"endpoints"`
+}
+
+// The OpenAPI document, generated once.
+var (
+	openAPIDocument []byte
+	openAPIOnce     sync.Once
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+var pathParamRegex = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Generates the schemas of the types, named types are added to the components once and referenced.
+type openAPISchemas struct {
+	components map[string]interface{}
+	names      map[reflect.Type]string
+}
+
+// Returns the name of the component of a named type, with the package when another type has the same name.
+func (s *openAPISchemas) name(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	taken := make(map[string]bool, len(s.names))
+	for _, n := range s.names {
+		taken[n] = true
+	}
+	if !taken[string(name)] {
+		return string(name)
+	}
+	pkg := []rune(t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:])
+	pkg[0] = unicode.ToUpper(pkg[0])
+	return string(pkg) + string(name)
+}
+
+func (s *openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = s.name(t)
+			s.names[t] = name
+			s.components[name] = s.object(t) // Registered first, so the recursive types reference it.
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{} // Any value, e.g. interface{}.
+}
+
+// Returns the schema of the JSON object of the struct, with its fields as encoding/json encodes them.
+func (s *openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	s.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s *openAPISchemas) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(embedded, properties) // Promoted like encoding/json does.
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+	}
+}
+
+// Returns the OpenAPI v3 document of the operations.
+func buildOpenAPI(operations []apiOperation) map[string]interface{} {
+	schemas := &openAPISchemas{components: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+	errorResponse := map[string]interface{}{"description": "Error, see the code at GET /errors/{code}.",
+		"content": map[string]interface{}{"application/json": map[string]interface{}{
+			"schema": schemas.schema(reflect.TypeOf(ErrorResponse{}))}}}
+	paths := make(map[string]interface{})
+	for _, op := range operations {
+		parameters := []interface{}{}
+		for _, match := range pathParamRegex.FindAllStringSubmatch(op.path, -1) {
+			parameters = append(parameters, map[string]interface{}{"name": match[1], "in": "path", "required": true,
+				"description": apiPathParams[match[1]], "schema": map[string]interface{}{"type": "string"}})
+		}
+		for _, param := range op.params {
+			typ := param.typ
+			if typ == "" {
+				typ = "string"
+			}
+			parameters = append(parameters, map[string]interface{}{"name": param.name, "in": "query",
+				"description": param.description, "schema": map[string]interface{}{"type": typ}})
+		}
+		success := map[string]interface{}{"description": "Success."}
+		switch {
+		case op.response != nil:
+			success["content"] = map[string]interface{}{"application/json": map[string]interface{}{
+				"schema": schemas.schema(reflect.TypeOf(op.response))}}
+		case op.contentType != "":
+			success["content"] = map[string]interface{}{op.contentType: map[string]interface{}{}}
+		}
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		operation := map[string]interface{}{
+			"operationId": op.id,
+			"summary":     op.summary,
+			"tags":        []string{op.tag},
+			"parameters":  parameters,
+			"responses":   map[string]interface{}{strconv.Itoa(status): success, "default": errorResponse},
+		}
+		if op.tag == "admin" {
+			operation["description"] = "Served on ADMIN_ADDRESS when it's set."
+		}
+		if op.request != nil {
+			operation["requestBody"] = map[string]interface{}{"required": true,
+				"content": map[string]interface{}{"application/json": map[string]interface{}{
+					"schema": schemas.schema(reflect.TypeOf(op.request))}}}
+		}
+		path, ok := paths[op.path].(map[string]interface{})
+		if !ok {
+			path = make(map[string]interface{})
+			paths[op.path] = path
+		}
+		path[strings.ToLower(op.method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title": "Search aggregator",
+			"description": "API of the search aggregator, for the collectors, the search clients and the admins. " +
+				"The fields of the request bodies are matched case-insensitive.",
+			"version": config.AGGREGATOR_API_VERSION,
+		},
+		"tags": []interface{}{
+			map[string]interface{}{"name": "sync", "description": "Syncs of the collectors."},
+			map[string]interface{}{"name": "search", "description": "Searches of the graph."},
+			map[string]interface{}{"name": "status", "description": "Probes and documentation."},
+			map[string]interface{}{"name": "admin", "description": "Administration of the aggregator."},
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas.components},
+	}
+}
+
+// OpenAPI responds with the OpenAPI v3 document of the aggregator API.
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		var err error
+		if openAPIDocument, err = json.Marshal(buildOpenAPI(apiOperations)); err != nil {
+			logger.Error("Error generating the OpenAPI document: ", err)
+		}
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPIDocument); err != nil {
+		logger.Error("Error responding to OpenAPI: ", err)
+	}
+}
+
+// APIDiscovery responds with the version of the API and its endpoints, sorted by path.
+func APIDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	response := APIDiscoveryResponse{Version: config.AGGREGATOR_API_VERSION, OpenAPI: OPENAPI_PATH,
+		SyncSchema: "/aggregator/sync/schema", Endpoints: make([]APIEndpoint, 0, len(apiOperations))}
+	for _, op := range apiOperations {
+		response.Endpoints = append(response.Endpoints, APIEndpoint{Method: op.method, Path: op.path,
+			OperationID: op.id, Summary: op.summary, Admin: op.tag == "admin"})
+	}
+	sort.SliceStable(response.Endpoints, func(i, j int) bool {
+		return response.Endpoints[i].Path < response.Endpoints[j].Path
+	})
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to APIDiscovery: ", encodeError)
+	}
+}
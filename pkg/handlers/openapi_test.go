@@ -0,0 +1,134 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Matches the routes of main.go, e.g. router.HandleFunc("/aggregator/search", handlers.Search).Methods("POST")
+var routeRegex = regexp.MustCompile(`(?s)\.Handle(?:Func)?\(([^,]+),[^\n]*?\)\.?\s*Methods\(([^)]*)\)`)
+
+func getOpenAPI(t *testing.T) map[string]interface{} {
+	w := httptest.NewRecorder()
+	OpenAPI(w, httptest.NewRequest(http.MethodGet, OPENAPI_PATH, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var document map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &document))
+	return document
+}
+
+// Every route of main.go is documented.
+func Test_OpenAPI_DocumentsEveryRoute(t *testing.T) {
+	source, err := ioutil.ReadFile("../../main.go")
+	assert.Nil(t, err)
+	paths := getOpenAPI(t)["paths"].(map[string]interface{})
+	constants := map[string]string{"handlers.OPENAPI_PATH": OPENAPI_PATH,
+		"handlers.API_DISCOVERY_PATH": API_DISCOVERY_PATH}
+
+	routes := routeRegex.FindAllStringSubmatch(string(source), -1)
+	assert.True(t, len(routes) > 40, "Expected the routes of main.go, found %d", len(routes))
+	for _, route := range routes {
+		path := strings.Trim(route[1], `"`)
+		if constant, ok := constants[path]; ok {
+			path = constant
+		}
+		for _, method := range strings.Split(route[2], ",") {
+			method = strings.ToLower(strings.Trim(strings.TrimSpace(method), `"`))
+			operations, ok := paths[path].(map[string]interface{})
+			assert.True(t, ok, "Path %s isn't documented", path)
+			assert.Contains(t, operations, method, "%s %s isn't documented", method, path)
+		}
+	}
+}
+
+// Collects the $ref of a schema.
+func collectRefs(value interface{}, refs map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" {
+				refs[ref] = true
+			}
+			collectRefs(item, refs)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectRefs(item, refs)
+		}
+	}
+}
+
+// Every $ref resolves to a component.
+func Test_OpenAPI_RefsResolve(t *testing.T) {
+	document := getOpenAPI(t)
+	assert.Equal(t, "3.0.3", document["openapi"])
+	assert.Equal(t, config.AGGREGATOR_API_VERSION, document["info"].(map[string]interface{})["version"])
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	refs := make(map[string]bool)
+	collectRefs(document, refs)
+	assert.Contains(t, refs, "#/components/schemas/ErrorResponse")
+	for ref := range refs {
+		assert.Contains(t, schemas, strings.TrimPrefix(ref, "#/components/schemas/"), "Unresolved %s", ref)
+	}
+}
+
+// The schemas are built from the handler types, with their JSON names.
+func Test_OpenAPI_SchemasFromTypes(t *testing.T) {
+	document := getOpenAPI(t)
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	syncEvent := schemas["SyncEvent"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, syncEvent, "AddResources", "Fields without a json tag keep their Go name.")
+	assert.Contains(t, syncEvent, "clearAll")
+	assert.NotContains(t, syncEvent, "mappedFields", "Unexported fields aren't in the schema.")
+	assert.Equal(t, "array", syncEvent["AddResources"].(map[string]interface{})["type"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "date-time"}, syncEvent["sentAt"])
+
+	// Unexported types are capitalized.
+	assert.Contains(t, schemas, "ReadOnlyRequest")
+
+	sync := document["paths"].(map[string]interface{})["/aggregator/clusters/{id}/sync"].(map[string]interface{})
+	post := sync["post"].(map[string]interface{})
+	assert.Equal(t, "SyncResources", post["operationId"])
+	parameters := post["parameters"].([]interface{})
+	assert.Equal(t, "id", parameters[0].(map[string]interface{})["name"])
+	assert.Equal(t, "path", parameters[0].(map[string]interface{})["in"])
+	assert.Contains(t, post, "requestBody")
+	assert.Contains(t, post["responses"], "200")
+	assert.Contains(t, post["responses"], "default")
+}
+
+func Test_APIDiscovery(t *testing.T) {
+	w := httptest.NewRecorder()
+	APIDiscovery(w, httptest.NewRequest(http.MethodGet, API_DISCOVERY_PATH, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response APIDiscoveryResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.Equal(t, config.AGGREGATOR_API_VERSION, response.Version)
+	assert.Equal(t, OPENAPI_PATH, response.OpenAPI)
+	assert.Equal(t, len(apiOperations), len(response.Endpoints))
+	for i := 1; i < len(response.Endpoints); i++ {
+		assert.True(t, response.Endpoints[i-1].Path <= response.Endpoints[i].Path, "Endpoints aren't sorted")
+	}
+	for _, endpoint := range response.Endpoints {
+		if endpoint.Method == "POST" && endpoint.Path == "/aggregator/admin/compact" {
+			assert.True(t, endpoint.Admin)
+		}
+		if endpoint.Method == "POST" && endpoint.Path == "/aggregator/search" {
+			assert.False(t, endpoint.Admin)
+		}
+	}
+}
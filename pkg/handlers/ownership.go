@@ -0,0 +1,73 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Stores the owner chains of the added and updated resources: the depth of each resource in its chain, and an
+// ownedBy edge to the direct owner of the added ones unless the collector sent it. Updated resources keep their edge,
+// the collector sends the edge changes when an owner changes.
+func addOwnerEdges(syncEvent *SyncEvent) {
+	sent := make(map[db.Edge]bool, len(syncEvent.AddEdges))
+	for _, e := range syncEvent.AddEdges {
+		if e.EdgeType == db.OWNED_BY_EDGE {
+			sent[db.Edge{SourceUID: e.SourceUID, DestUID: e.DestUID, EdgeType: e.EdgeType}] = true
+		}
+	}
+	for _, r := range syncEvent.AddResources {
+		e, ok := r.OwnerEdge()
+		if !ok {
+			continue
+		}
+		if key := (db.Edge{SourceUID: e.SourceUID, DestUID: e.DestUID, EdgeType: e.EdgeType}); !sent[key] {
+			sent[key] = true
+			syncEvent.AddEdges = append(syncEvent.AddEdges, e)
+		}
+	}
+	for _, resources := range [][]*db.Resource{syncEvent.AddResources, syncEvent.UpdateResources} {
+		for _, r := range resources {
+			if len(r.OwnerChain) > 0 && r.Properties != nil {
+				r.Properties[db.OWNER_DEPTH_PROPERTY] = int64(len(r.OwnerChain))
+			}
+		}
+	}
+}
+
+// OwnershipTree responds with the resources owned by a resource, e.g. all the children of an Application, as a
+// tree of owners. Use the limit parameter to bound the resources returned at each level.
+func OwnershipTree(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	uid, _, err := db.NormalizeUID(clusterName+"/"+mux.Vars(r)["uid"], clusterName)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_UID, "Invalid resource UID: "+err.Error(), nil)
+		return
+	}
+	limit, err := intParam(r, "limit", 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid limit parameter: "+err.Error(),
+			map[string]string{"parameter": "limit"})
+		return
+	}
+	access, status, err := searchAccess(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+
+	tree, err := db.OwnershipTreeOf(r.Context(), uid, searchLimit(limit), access)
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(tree); encodeError != nil {
+		logger.Error("Error responding to OwnershipTree: ", encodeError)
+	}
+}
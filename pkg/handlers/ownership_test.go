@@ -0,0 +1,68 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_addOwnerEdges(t *testing.T) {
+	chain := []db.OwnerReference{{UID: "c1/r", Kind: "ReplicaSet"}, {UID: "c1/d", Kind: "Deployment"}}
+	syncEvent := SyncEvent{
+		AddResources: []*db.Resource{
+			{UID: "c1/p1", Kind: "Pod", OwnerChain: chain, Properties: map[string]interface{}{"kind": "Pod"}},
+			{UID: "c1/p2", Kind: "Pod", OwnerChain: chain, Properties: map[string]interface{}{"kind": "Pod"}},
+			{UID: "c1/d", Kind: "Deployment", Properties: map[string]interface{}{"kind": "Deployment"}},
+		},
+		UpdateResources: []*db.Resource{
+			{UID: "c1/r", Kind: "ReplicaSet", OwnerChain: chain[1:], Properties: map[string]interface{}{}},
+		},
+		// The collector already sent the edge of p2.
+		AddEdges: []db.Edge{{SourceUID: "c1/p2", SourceKind: "Pod", DestUID: "c1/r", DestKind: "ReplicaSet",
+			EdgeType: "ownedBy"}},
+	}
+	addOwnerEdges(&syncEvent)
+
+	assert.Equal(t, []db.Edge{
+		{SourceUID: "c1/p2", SourceKind: "Pod", DestUID: "c1/r", DestKind: "ReplicaSet", EdgeType: "ownedBy"},
+		{SourceUID: "c1/p1", SourceKind: "Pod", DestUID: "c1/r", DestKind: "ReplicaSet", EdgeType: "ownedBy"},
+	}, syncEvent.AddEdges, "Updated resources keep their edges")
+	assert.Equal(t, int64(2), syncEvent.AddResources[0].Properties["_ownerDepth"])
+	assert.NotContains(t, syncEvent.AddResources[2].Properties, "_ownerDepth", "Resources without chain unchanged")
+	assert.Equal(t, int64(1), syncEvent.UpdateResources[0].Properties["_ownerDepth"])
+}
+
+func Test_OwnershipTree(t *testing.T) {
+	useTestDatastore(t)
+
+	_, err := db.Store.Query(context.Background(), "CREATE "+
+		"(:Pod {_uid:'c1/p', kind:'pod'})-[:ownedBy]->(:ReplicaSet {_uid:'c1/r', kind:'replicaset'})")
+	assert.NoError(t, err)
+
+	request := mux.SetURLVars(httptest.NewRequest("GET", "/aggregator/clusters/c1/resources/r/owned", nil),
+		map[string]string{"id": "c1", "uid": "r"})
+	response := httptest.NewRecorder()
+	OwnershipTree(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	var tree db.OwnershipTree
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&tree))
+	assert.Equal(t, "c1/r", tree.UID)
+	if assert.Len(t, tree.Children, 1) {
+		assert.Equal(t, "c1/p", tree.Children[0].UID)
+	}
+
+	request = mux.SetURLVars(httptest.NewRequest("GET", "/aggregator/clusters/c1/resources/r/owned?limit=all", nil),
+		map[string]string{"id": "c1", "uid": "r"})
+	response = httptest.NewRecorder()
+	OwnershipTree(response, request)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Objects of the sync payload the PAYLOAD_MAPPINGS apply to.
+const (
+	PAYLOAD_SYNC_EVENT      = "syncEvent"      // The fields of the SyncEvent, e.g. clearAll.
+	PAYLOAD_RESOURCE        = "resource"       // The added and updated resources.
+	PAYLOAD_DELETE_RESOURCE = "deleteResource" // The deleted resources.
+	PAYLOAD_EDGE            = "edge"           // The added and deleted edges.
+)
+
+// A mapping from PAYLOAD_MAPPINGS, moves a legacy field of the payloads of older collectors to its current field and
+// converts its type. e.g. {"object": "resource", "from": "resourceUID", "to": "uid"} or
+// {"object": "resource", "from": "properties.restartCount", "to": "properties.restarts", "type": "int"}
+type PayloadMapping struct {
+	Object string `json:"object"`         // resource, deleteResource, edge or syncEvent.
+	From   string `json:"from"`           // Legacy field, a dotted path for nested fields, e.g. properties.apiVersion
+	To     string `json:"to,omitempty"`   // Current field, the legacy one when it's only converted.
+	Type   string `json:"type,omitempty"` // string, int, float or bool, the value is converted to it.
+
+	from []string
+	to   []string
+}
+
+// Mappings parsed from PAYLOAD_MAPPINGS by object, parsed again when the config changes.
+var (
+	payloadMappingsConfig string
+	payloadMappings       map[string][]PayloadMapping
+	payloadMappingsMutex  = sync.Mutex{}
+)
+
+// Parses the mappings. Invalid mappings are logged and skipped, so they don't reject every sync.
+func parsePayloadMappings(value string) map[string][]PayloadMapping {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var parsed []PayloadMapping
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		logger.Error("Error parsing PAYLOAD_MAPPINGS, no mappings are applied: ", err)
+		return nil
+	}
+	mappings := make(map[string][]PayloadMapping)
+	for i, m := range parsed {
+		if m.To == "" {
+			m.To = m.From
+		}
+		m.from, m.to = strings.Split(m.From, "."), strings.Split(m.To, ".")
+		var err error
+		switch {
+		case m.Object != PAYLOAD_SYNC_EVENT && m.Object != PAYLOAD_RESOURCE && m.Object != PAYLOAD_DELETE_RESOURCE &&
+			m.Object != PAYLOAD_EDGE:
+			err = fmt.Errorf("unknown object %q", m.Object)
+		case m.From == "" || containsEmpty(m.from) || containsEmpty(m.to):
+			err = fmt.Errorf("invalid field %q to %q", m.From, m.To)
+		case m.Object == PAYLOAD_SYNC_EVENT && (len(m.from) > 1 || len(m.to) > 1):
+			err = fmt.Errorf("only the top level fields of the syncEvent are mapped")
+		case m.Type != "" && m.Type != "string" && m.Type != "int" && m.Type != "float" && m.Type != "bool":
+			err = fmt.Errorf("unknown type %q", m.Type)
+		case m.From == m.To && m.Type == "":
+			err = fmt.Errorf("the field %q is mapped to itself without a type", m.From)
+		}
+		if err != nil {
+			logger.Errorf("Skipping payload mapping %d from PAYLOAD_MAPPINGS: %s", i, err)
+			continue
+		}
+		mappings[m.Object] = append(mappings[m.Object], m)
+	}
+	return mappings
+}
+
+func containsEmpty(values []string) bool {
+	for _, v := range values {
+		if v == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func currentPayloadMappings() map[string][]PayloadMapping {
+	payloadMappingsMutex.Lock()
+	defer payloadMappingsMutex.Unlock()
+	if payloadMappingsConfig != config.Cfg.PayloadMappings {
+		payloadMappingsConfig = config.Cfg.PayloadMappings
+		payloadMappings = parsePayloadMappings(payloadMappingsConfig)
+	}
+	return payloadMappings
+}
+
+// Returns the key of the fields matching the field case-insensitive, same as json.Unmarshal.
+func lookupPayloadKey(fields map[string]interface{}, field string) (string, bool) {
+	if _, ok := fields[field]; ok {
+		return field, true
+	}
+	for key := range fields {
+		if strings.EqualFold(key, field) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Converts a value decoded with UseNumber to the type of the mapping.
+func convertPayloadValue(value interface{}, toType string) (interface{}, error) {
+	switch value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}, []interface{}:
+		if toType != "" {
+			return nil, fmt.Errorf("can't convert an object or array to %s", toType)
+		}
+	}
+	s := fmt.Sprint(value)
+	switch toType {
+	case "string":
+		return s, nil
+	case "int":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f == float64(int64(f)) {
+			return int64(f), nil
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	case "bool":
+		switch strings.ToLower(s) {
+		case "true", "1", "yes":
+			return true, nil
+		case "false", "0", "no", "":
+			return false, nil
+		}
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("can't convert %q to %s", s, toType)
+}
+
+// Applies the mappings to the fields of an object. The legacy field is removed, and it doesn't replace a current
+// field already set. Returns the number of fields mapped.
+func (m PayloadMapping) apply(fields map[string]interface{}) (int, error) {
+	parent := fields
+	for _, field := range m.from[:len(m.from)-1] {
+		key, ok := lookupPayloadKey(parent, field)
+		if !ok {
+			return 0, nil
+		}
+		if parent, ok = parent[key].(map[string]interface{}); !ok {
+			return 0, nil
+		}
+	}
+	key, ok := lookupPayloadKey(parent, m.from[len(m.from)-1])
+	if !ok {
+		return 0, nil
+	}
+	value, err := convertPayloadValue(parent[key], m.Type)
+	if err != nil {
+		return 0, fmt.Errorf("field %s: %s", m.From, err)
+	}
+	delete(parent, key)
+
+	target := fields
+	for _, field := range m.to[:len(m.to)-1] {
+		if key, ok := lookupPayloadKey(target, field); ok {
+			field = key
+		}
+		next, ok := target[field].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			target[field] = next
+		}
+		target = next
+	}
+	if current, ok := lookupPayloadKey(target, m.to[len(m.to)-1]); ok && m.From != m.To {
+		if target[current] != nil {
+			return 0, nil // The collector sent both, the current field wins.
+		}
+		delete(target, current)
+	}
+	target[m.to[len(m.to)-1]] = value
+	return 1, nil
+}
+
+// Decodes the next element of an array of the payload into v, with the mappings of the object applied. Returns the
+// number of fields mapped.
+func decodeMapped(dec *json.Decoder, mappings []PayloadMapping, v interface{}) (int, error) {
+	if len(mappings) == 0 {
+		return 0, dec.Decode(v)
+	}
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return 0, err
+	}
+	mapped, count, err := mapPayloadObject(raw, mappings)
+	if err != nil {
+		return 0, err
+	}
+	return count, json.Unmarshal(mapped, v)
+}
+
+// Returns the JSON object with the mappings applied, unchanged when there's nothing to map.
+func mapPayloadObject(raw json.RawMessage, mappings []PayloadMapping) (json.RawMessage, int, error) {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber() // Keeps the numbers as they were sent.
+	if err := dec.Decode(&fields); err != nil || fields == nil {
+		return raw, 0, nil // Not an object, decoding it reports the error.
+	}
+	mapped := 0
+	for _, m := range mappings {
+		count, err := m.apply(fields)
+		if err != nil {
+			return nil, 0, err
+		}
+		mapped += count
+	}
+	if mapped == 0 {
+		return raw, 0, nil
+	}
+	encoded, err := json.Marshal(fields)
+	return encoded, mapped, err
+}
+
+// Returns the current field of a top level field of the syncEvent, and its value converted when the mapping has a
+// type. The value is nil when it isn't converted.
+func mapSyncEventKey(dec *json.Decoder, mappings []PayloadMapping, key string) (string, json.RawMessage, error) {
+	for _, m := range mappings {
+		if !strings.EqualFold(m.From, key) {
+			continue
+		}
+		if m.Type == "" {
+			return m.To, nil, nil
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return "", nil, err
+		}
+		var value interface{}
+		valueDec := json.NewDecoder(bytes.NewReader(raw))
+		valueDec.UseNumber()
+		if err := valueDec.Decode(&value); err != nil {
+			return "", nil, err
+		}
+		converted, err := convertPayloadValue(value, m.Type)
+		if err != nil {
+			return "", nil, fmt.Errorf("field %s: %s", m.From, err)
+		}
+		encoded, err := json.Marshal(converted)
+		return m.To, encoded, err
+	}
+	return key, nil, nil
+}
+
+// Counts the legacy fields mapped in a sync of the cluster, to find the clusters still running older collectors.
+func observePayloadMappings(clusterName string, mapped int) {
+	if mapped == 0 {
+		return
+	}
+	logger.V(2).Infof("Mapped %d legacy fields of the sync from cluster %s with the PAYLOAD_MAPPINGS.", mapped,
+		clusterName)
+	metrics.PayloadMappedFields.WithLabelValues(metrics.ClusterLabel(clusterName)).Add(float64(mapped))
+}
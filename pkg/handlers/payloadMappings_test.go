@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func usePayloadMappings(t *testing.T, mappings string) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.PayloadMappings = mappings
+}
+
+func Test_parsePayloadMappings(t *testing.T) {
+	mappings := parsePayloadMappings(`[
+		{"object": "resource", "from": "resourceUID", "to": "uid"},
+		{"object": "resource", "from": "rev", "type": "int"},
+		{"object": "pod", "from": "a", "to": "b"},
+		{"object": "edge", "from": "", "to": "edgeType"},
+		{"object": "edge", "from": "a..b", "to": "edgeType"},
+		{"object": "syncEvent", "from": "meta.resync", "to": "clearAll"},
+		{"object": "resource", "from": "kind", "type": "date"},
+		{"object": "resource", "from": "kind"}
+	]`)
+	if assert.Len(t, mappings[PAYLOAD_RESOURCE], 2, "The invalid mappings are skipped.") {
+		assert.Equal(t, "rev", mappings[PAYLOAD_RESOURCE][1].To)
+	}
+	assert.Empty(t, mappings[PAYLOAD_EDGE])
+	assert.Empty(t, mappings[PAYLOAD_SYNC_EVENT])
+	assert.Nil(t, parsePayloadMappings(`{"object": "resource"}`))
+}
+
+func Test_convertPayloadValue(t *testing.T) {
+	for _, test := range []struct {
+		value    interface{}
+		toType   string
+		expected interface{}
+	}{
+		{"12", "int", int64(12)},
+		{12.0, "int", int64(12)},
+		{"1.5", "float", 1.5},
+		{true, "string", "true"},
+		{"True", "bool", true},
+		{"0", "bool", false},
+		{nil, "int", nil},
+	} {
+		converted, err := convertPayloadValue(test.value, test.toType)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, converted)
+	}
+	_, err := convertPayloadValue("1.5", "int")
+	assert.Error(t, err)
+	_, err = convertPayloadValue(map[string]interface{}{}, "string")
+	assert.Error(t, err)
+}
+
+// Syncs of an older collector decode to the same SyncEvent as the current payload.
+func Test_decodeSyncEvent_payloadMappings(t *testing.T) {
+	usePayloadMappings(t, `[
+		{"object": "resource", "from": "resourceUID", "to": "uid"},
+		{"object": "resource", "from": "rev", "type": "int"},
+		{"object": "resource", "from": "properties.restartCount", "to": "properties.restarts", "type": "int"},
+		{"object": "deleteResource", "from": "resourceUID", "to": "uid"},
+		{"object": "edge", "from": "type", "to": "edgeType"},
+		{"object": "syncEvent", "from": "resync", "to": "clearAll", "type": "bool"}
+	]`)
+	legacy := `{
+		"resync": "true",
+		"addResources": [{"kind": "Pod", "resourceUID": "c1/a", "Properties": {"name": "a", "restartCount": "3"}}],
+		"updateResources": [{"kind": "Pod", "uid": "c1/b", "resourceUID": "c1/old", "rev": "7", "properties": {}}],
+		"deleteResources": [{"resourceUID": "c1/c"}],
+		"addEdges": [{"SourceUID": "c1/a", "DestUID": "c1/b", "type": "ownedBy"}]
+	}`
+	var syncEvent SyncEvent
+	assert.NoError(t, decodeSyncEvent(strings.NewReader(legacy), &syncEvent))
+	assert.True(t, syncEvent.ClearAll)
+	assert.Equal(t, []*db.Resource{{Kind: "Pod", UID: "c1/a",
+		Properties: map[string]interface{}{"name": "a", "restarts": float64(3)}}}, syncEvent.AddResources)
+	if assert.Len(t, syncEvent.UpdateResources, 1) {
+		assert.Equal(t, "c1/b", syncEvent.UpdateResources[0].UID, "The current field wins.")
+		assert.Equal(t, int64(7), syncEvent.UpdateResources[0].Rev)
+	}
+	assert.Equal(t, []DeleteResourceEvent{{UID: "c1/c"}}, syncEvent.DeleteResources)
+	assert.Equal(t, []db.Edge{{SourceUID: "c1/a", DestUID: "c1/b", EdgeType: "ownedBy"}}, syncEvent.AddEdges)
+	assert.Equal(t, 6, syncEvent.mappedFields)
+
+	// The current payloads are unchanged.
+	var current, expected SyncEvent
+	assert.NoError(t, decodeSyncEvent(strings.NewReader(testSyncBody), &current))
+	usePayloadMappings(t, "")
+	assert.NoError(t, decodeSyncEvent(strings.NewReader(testSyncBody), &expected))
+	assert.Equal(t, expected, current)
+
+	usePayloadMappings(t, `[{"object": "resource", "from": "rev", "type": "int"}]`)
+	err := decodeSyncEvent(strings.NewReader(`{"addResources": [{"uid": "c1/a", "rev": "seven"}]}`), &SyncEvent{})
+	assert.Error(t, err)
+}
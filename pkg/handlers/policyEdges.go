@@ -0,0 +1,25 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Tells whether a sync can change the policy edges: it adds or updates a policy, binding or placement rule, or it
+// deletes resources of the hub, where the replicas of the policies are. The deletes in the managed clusters only
+// take the edges of their resources with them.
+func policyEdgesUpdated(clusterName string, syncEvent SyncEvent) bool {
+	if clusterName == "local-cluster" && (syncEvent.ClearAll || len(syncEvent.DeleteResources) > 0) {
+		return true
+	}
+	for _, resources := range [][]*db.Resource{syncEvent.AddResources, syncEvent.UpdateResources} {
+		for _, resource := range resources {
+			if db.IsPolicyKind(resource.Properties["kind"]) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_policyEdgesUpdated(t *testing.T) {
+	pod := &db.Resource{UID: "c1/pod", Properties: map[string]interface{}{"kind": "Pod"}}
+	policy := &db.Resource{UID: "c1/policy", Properties: map[string]interface{}{"kind": "Policy"}}
+	deletes := []DeleteResourceEvent{{UID: "c1/old"}}
+
+	assert.False(t, policyEdgesUpdated("c1", SyncEvent{AddResources: []*db.Resource{pod}}))
+	assert.True(t, policyEdgesUpdated("c1", SyncEvent{UpdateResources: []*db.Resource{pod, policy}}))
+	assert.False(t, policyEdgesUpdated("c1", SyncEvent{DeleteResources: deletes}))
+	assert.True(t, policyEdgesUpdated("local-cluster", SyncEvent{DeleteResources: deletes}))
+}
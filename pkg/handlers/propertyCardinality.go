@@ -0,0 +1,183 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Properties identifying a resource, unique by design, so they're never capped.
+var identityProperties = map[string]bool{"kind": true, "cluster": true, "name": true, "namespace": true,
+	"created": true, "selflink": true, "apiversion": true, "apigroup": true}
+
+const cardinalityExamples = 3 // Values kept to show what a property looks like in the report.
+
+// Distinct values of a property of a kind, as in the cardinality report.
+type PropertyCardinality struct {
+	Kind           string    `json:"kind"`
+	Property       string    `json:"property"` // Label keys are label.<key>
+	DistinctValues int       `json:"distinctValues"`
+	Capped         bool      `json:"capped"`
+	CappedAt       time.Time `json:"cappedAt"`
+	DroppedValues  int       `json:"droppedValues"` // Values not stored since the property was capped.
+	Examples       []string  `json:"examples"`
+}
+
+// Tracks the distinct values of a property. The hashes are dropped once the property is capped, the count is kept.
+type cardinalityTracker struct {
+	PropertyCardinality
+	hashes map[uint64]struct{}
+}
+
+var (
+	cardinalities      = make(map[string]*cardinalityTracker) // Keyed by kind.property, the kind lowercased.
+	cardinalitiesMutex = sync.Mutex{}
+)
+
+// Tells whether the distinct values of the property are tracked and capped.
+func isCappableProperty(uncapped map[string]bool, kind, property string) bool {
+	property = strings.ToLower(property)
+	if strings.HasPrefix(property, "_") || identityProperties[property] {
+		return false
+	}
+	return !uncapped[property] && !uncapped[strings.ToLower(kind)+"."+property]
+}
+
+// Counts the values of a property and tells whether the value can be stored, false once the property has more
+// distinct values than PROPERTY_CARDINALITY_LIMIT. Must hold cardinalitiesMutex.
+func trackPropertyValue(kind, property, value string, now time.Time) bool {
+	key := strings.ToLower(kind) + "." + property
+	t, ok := cardinalities[key]
+	if !ok {
+		t = &cardinalityTracker{PropertyCardinality: PropertyCardinality{Kind: strings.ToLower(kind),
+			Property: property}, hashes: make(map[uint64]struct{})}
+		cardinalities[key] = t
+	}
+	if t.Capped {
+		t.DroppedValues++
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(value)) // #nosec G104 - Write on a hash never returns an error.
+	hash := h.Sum64()
+	if _, seen := t.hashes[hash]; seen {
+		return true
+	}
+	if len(t.hashes) >= config.Cfg.PropertyCardinalityLimit {
+		logger.Warningf("Property %s of kind %s has more than %d distinct values, it's no longer stored.",
+			property, t.Kind, config.Cfg.PropertyCardinalityLimit)
+		t.Capped, t.CappedAt, t.DroppedValues, t.hashes = true, now, 1, nil
+		metrics.CappedProperties.Inc()
+		return false
+	}
+	t.hashes[hash] = struct{}{}
+	t.DistinctValues = len(t.hashes)
+	if len(t.Examples) < cardinalityExamples {
+		t.Examples = append(t.Examples, value)
+	}
+	return true
+}
+
+// Counts the distinct values of the properties and label keys of the added and updated resources, and removes
+// the ones with more distinct values than PROPERTY_CARDINALITY_LIMIT since the aggregator started. Nodes keep the
+// values stored before the property was capped.
+func capPropertyCardinality(clusterName string, syncEvent *SyncEvent, now time.Time) {
+	if config.Cfg.PropertyCardinalityLimit <= 0 {
+		return
+	}
+	uncapped := make(map[string]bool)
+	for _, property := range config.ParseList(config.Cfg.UncappedProperties) {
+		uncapped[strings.ToLower(property)] = true
+	}
+	dropped := 0
+	capProperties := func(resources []*db.Resource) {
+		for _, r := range resources {
+			kind, _ := r.Properties["kind"].(string)
+			for property, value := range r.Properties {
+				if !isCappableProperty(uncapped, kind, property) {
+					continue
+				}
+				if labels, ok := value.(map[string]interface{}); ok && property == "label" {
+					for key, labelValue := range labels {
+						labelProperty := "label." + key
+						if isCappableProperty(uncapped, kind, labelProperty) &&
+							!trackPropertyValue(kind, labelProperty, fmt.Sprint(labelValue), now) {
+							delete(labels, key)
+							dropped++
+						}
+					}
+					continue
+				}
+				if !trackPropertyValue(kind, property, fmt.Sprint(value), now) {
+					delete(r.Properties, property)
+					dropped++
+				}
+			}
+		}
+	}
+	cardinalitiesMutex.Lock()
+	capProperties(syncEvent.AddResources)
+	capProperties(syncEvent.UpdateResources)
+	cardinalitiesMutex.Unlock()
+	if dropped > 0 {
+		logger.V(3).Infof("Dropped %d values of capped properties from cluster %s", dropped, clusterName)
+	}
+}
+
+// Returns the tracked properties, capped first and then by distinct values, highest first.
+func propertyCardinalities(limit int) []PropertyCardinality {
+	cardinalitiesMutex.Lock()
+	report := make([]PropertyCardinality, 0, len(cardinalities))
+	for _, t := range cardinalities {
+		entry := t.PropertyCardinality
+		entry.Examples = append([]string{}, t.Examples...)
+		report = append(report, entry)
+	}
+	cardinalitiesMutex.Unlock()
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Capped != report[j].Capped {
+			return report[i].Capped
+		}
+		if report[i].DistinctValues != report[j].DistinctValues {
+			return report[i].DistinctValues > report[j].DistinctValues
+		}
+		return report[i].Kind+"."+report[i].Property < report[j].Kind+"."+report[j].Property
+	})
+	if limit > 0 && len(report) > limit {
+		report = report[:limit]
+	}
+	return report
+}
+
+// PropertyCardinalityReport responds with the distinct values of the properties of each kind since the aggregator
+// started, capped properties first. Use the limit parameter to get more or fewer properties, defaults to 50 and
+// 0 returns all of them.
+func PropertyCardinalityReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	limit := 50
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 0 {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+				"Invalid limit parameter, expected a number, 0 for all", map[string]string{"parameter": "limit"})
+			return
+		}
+	}
+	if encodeError := json.NewEncoder(w).Encode(propertyCardinalities(limit)); encodeError != nil {
+		logger.Error("Error responding to PropertyCardinalityReport: ", encodeError)
+	}
+}
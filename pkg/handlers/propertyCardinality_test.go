@@ -0,0 +1,53 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_capPropertyCardinality(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.PropertyCardinalityLimit = 3
+	config.Cfg.UncappedProperties = "pod.podIP"
+	defer func() {
+		cardinalitiesMutex.Lock()
+		cardinalities = make(map[string]*cardinalityTracker)
+		cardinalitiesMutex.Unlock()
+	}()
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	pod := func(i int) *db.Resource {
+		return &db.Resource{Kind: "Pod", UID: fmt.Sprintf("c1/pod%d", i), Properties: map[string]interface{}{
+			"kind": "Pod", "name": fmt.Sprintf("pod%d", i), "podIP": fmt.Sprintf("10.0.0.%d", i), "status": "Running",
+			"startedAt": fmt.Sprintf("2021-06-01T09:0%d:00Z", i),
+			"label":     map[string]interface{}{"app": "web", "hash": fmt.Sprint(i)}}}
+	}
+	syncEvent := SyncEvent{AddResources: []*db.Resource{pod(1), pod(2), pod(3)}}
+	capPropertyCardinality("c1", &syncEvent, now)
+	assert.Equal(t, "2021-06-01T09:03:00Z", syncEvent.AddResources[2].Properties["startedAt"])
+
+	syncEvent = SyncEvent{UpdateResources: []*db.Resource{pod(4), pod(1)}}
+	capPropertyCardinality("c1", &syncEvent, now)
+	for _, r := range syncEvent.UpdateResources {
+		assert.NotContains(t, r.Properties, "startedAt", "Capped properties aren't stored, even with a known value")
+		assert.Equal(t, map[string]interface{}{"app": "web"}, r.Properties["label"])
+		assert.Equal(t, "Running", r.Properties["status"])
+		assert.Contains(t, r.Properties, "name")
+		assert.Contains(t, r.Properties, "podIP")
+	}
+
+	report := propertyCardinalities(2)
+	assert.Equal(t, 2, len(report))
+	assert.Equal(t, PropertyCardinality{Kind: "pod", Property: "label.hash", DistinctValues: 3, Capped: true,
+		CappedAt: now, DroppedValues: 2, Examples: []string{"1", "2", "3"}}, report[0])
+	assert.Equal(t, "startedAt", report[1].Property)
+	assert.Equal(t, 4, len(propertyCardinalities(0)), "Only status, startedAt and the label keys are tracked")
+}
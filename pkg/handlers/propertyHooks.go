@@ -0,0 +1,265 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Mutates the properties of a resource received from a collector before it's stored.
+// Returning an error rejects the resource, and the error is reported to the collector for that resource.
+type PropertyHook func(clusterName string, resource *db.Resource) error
+
+type namedHook struct {
+	name string
+	hook PropertyHook
+}
+
+var (
+	propertyHooks      []namedHook
+	propertyHooksMutex = sync.RWMutex{}
+)
+
+// Registers an in-process hook, run on the added and updated resources of every sync after the
+// PROPERTY_TRANSFORMS. Hooks run in the order they are registered. Intended to be called from init().
+func RegisterPropertyHook(name string, hook PropertyHook) {
+	propertyHooksMutex.Lock()
+	defer propertyHooksMutex.Unlock()
+	propertyHooks = append(propertyHooks, namedHook{name: name, hook: hook})
+}
+
+// A transform from PROPERTY_TRANSFORMS, sets the target property from a JSONPath of the properties or a value.
+// e.g. {"target": "apigroup", "source": "$.apiversion", "pattern": "^(.*)/[^/]*$", "replacement": "$1"}
+type PropertyTransform struct {
+	Kind        string      `json:"kind,omitempty"`        // Only resources of this kind, all kinds when empty.
+	Target      string      `json:"target"`                // Property to set.
+	Source      string      `json:"source,omitempty"`      // JSONPath of the value, e.g. $.label.app or $.label['app.kubernetes.io/name']
+	Value       interface{} `json:"value,omitempty"`       // Value used when there's no source, or no value is found.
+	Function    string      `json:"function,omitempty"`    // lower, upper or trim, applied to string values.
+	Pattern     string      `json:"pattern,omitempty"`     // Regex the string value must match or it isn't set.
+	Replacement string      `json:"replacement,omitempty"` // Replaces the matches of the pattern, e.g. $1
+	Required    bool        `json:"required,omitempty"`    // Reject the resource when no value is found.
+
+	path    []string
+	pattern *regexp.Regexp
+}
+
+// Transforms parsed from PROPERTY_TRANSFORMS, parsed again when the config changes.
+var (
+	transformsConfig string
+	transforms       []PropertyTransform
+	transformsMutex  = sync.Mutex{}
+)
+
+var targetPropertyRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parses a JSONPath of the properties, only field names are supported, e.g. $.label.app or $.label['app.k8s.io/name']
+func parsePropertyPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %s must start with $", path)
+	}
+	var segments []string
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated field in JSONPath %s", path)
+			}
+			segments = append(segments, rest[2:end])
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			segments = append(segments, rest[1:end+1])
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("Unsupported JSONPath %s, only fields are supported", path)
+		}
+		if segments[len(segments)-1] == "" {
+			return nil, fmt.Errorf("Empty field in JSONPath %s", path)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("JSONPath %s must have at least one field", path)
+	}
+	return segments, nil
+}
+
+// Parses the transforms. Invalid transforms are logged and skipped, so they don't reject every resource.
+func parsePropertyTransforms(value string) []PropertyTransform {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var parsed []PropertyTransform
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		logger.Error("Error parsing PROPERTY_TRANSFORMS, no transforms are applied: ", err)
+		return nil
+	}
+	valid := make([]PropertyTransform, 0, len(parsed))
+	for i, t := range parsed {
+		var err error
+		switch {
+		case !targetPropertyRegex.MatchString(t.Target) || t.Target == "kind" || t.Target == "cluster":
+			err = fmt.Errorf("invalid target property %q", t.Target)
+		case t.Source == "" && t.Value == nil:
+			err = fmt.Errorf("source or value is required")
+		case t.Function != "" && t.Function != "lower" && t.Function != "upper" && t.Function != "trim":
+			err = fmt.Errorf("unknown function %q", t.Function)
+		}
+		if err == nil && t.Source != "" {
+			t.path, err = parsePropertyPath(t.Source)
+		}
+		if err == nil && t.Pattern != "" {
+			t.pattern, err = regexp.Compile(t.Pattern)
+		}
+		if err != nil {
+			logger.Errorf("Skipping property transform %d from PROPERTY_TRANSFORMS: %s", i, err)
+			continue
+		}
+		t.Kind = strings.ToLower(t.Kind)
+		valid = append(valid, t)
+	}
+	return valid
+}
+
+func currentPropertyTransforms() []PropertyTransform {
+	transformsMutex.Lock()
+	defer transformsMutex.Unlock()
+	if transformsConfig != config.Cfg.PropertyTransforms {
+		transformsConfig = config.Cfg.PropertyTransforms
+		transforms = parsePropertyTransforms(transformsConfig)
+	}
+	return transforms
+}
+
+func lookupProperty(properties map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = properties
+	for _, field := range path {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = fields[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Applies the transform to the resource, resources of other kinds are left unchanged.
+func (t PropertyTransform) apply(resource *db.Resource) error {
+	if kind, _ := resource.Properties["kind"].(string); t.Kind != "" && t.Kind != strings.ToLower(kind) {
+		return nil
+	}
+	var value interface{}
+	found := false
+	if t.Source != "" {
+		value, found = lookupProperty(resource.Properties, t.path)
+	}
+	if found && (t.Function != "" || t.pattern != nil) {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("Property transform for %s: %s isn't a string", t.Target, t.Source)
+		}
+		switch t.Function {
+		case "lower":
+			s = strings.ToLower(s)
+		case "upper":
+			s = strings.ToUpper(s)
+		case "trim":
+			s = strings.TrimSpace(s)
+		}
+		if t.pattern != nil {
+			found = t.pattern.MatchString(s)
+			s = t.pattern.ReplaceAllString(s, t.Replacement)
+		}
+		value = s
+	}
+	if !found && t.Value != nil { // The value is set as is.
+		value, found = t.Value, true
+	}
+	if !found {
+		if t.Required {
+			return fmt.Errorf("Property transform for %s: no value found for %s", t.Target, t.Source)
+		}
+		return nil
+	}
+	resource.Properties[t.Target] = value
+	return nil
+}
+
+// Runs a hook, reporting a panic as the error of the resource.
+func runPropertyHook(h namedHook, clusterName string, resource *db.Resource) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Property hook %s failed: %v", h.name, r)
+		}
+	}()
+	if err = h.hook(clusterName, resource); err != nil {
+		err = fmt.Errorf("Property hook %s failed: %s", h.name, err)
+	}
+	return err
+}
+
+// Mutates the added and updated resources in the syncEvent with the PROPERTY_TRANSFORMS and the registered hooks.
+// Removes the resources a transform or hook failed for, and returns a SyncResponse holding only their errors.
+func applyPropertyHooks(clusterName string, syncEvent *SyncEvent) SyncResponse {
+	rejected := SyncResponse{}
+	transforms := currentPropertyTransforms()
+	propertyHooksMutex.RLock()
+	hooks := propertyHooks
+	propertyHooksMutex.RUnlock()
+	if len(transforms) == 0 && len(hooks) == 0 {
+		return rejected
+	}
+
+	mutate := func(resource *db.Resource) error {
+		if resource.Properties == nil {
+			resource.Properties = make(map[string]interface{})
+		}
+		kind := resource.Properties["kind"]
+		for _, t := range transforms {
+			if err := t.apply(resource); err != nil {
+				return err
+			}
+		}
+		for _, h := range hooks {
+			if err := runPropertyHook(h, clusterName, resource); err != nil {
+				return err
+			}
+		}
+		if resource.Properties["kind"] != kind { // The kind is the node label, changing it would orphan the node.
+			return fmt.Errorf("Property hooks must not change the kind of a resource")
+		}
+		return nil
+	}
+	mutateResources := func(resources []*db.Resource) ([]*db.Resource, []SyncError) {
+		kept := make([]*db.Resource, 0, len(resources))
+		var errs []SyncError
+		for _, r := range resources {
+			if err := mutate(r); err != nil {
+				logger.V(2).Infof("Rejecting resource [%s] from cluster %s: %s", r.UID, clusterName, err)
+				errs = append(errs,
+					SyncError{ResourceUID: r.UID, Message: err.Error(), Code: ERROR_PROPERTY_HOOK_FAILED})
+				continue
+			}
+			kept = append(kept, r)
+		}
+		return kept, errs
+	}
+	syncEvent.AddResources, rejected.AddErrors = mutateResources(syncEvent.AddResources)
+	syncEvent.UpdateResources, rejected.UpdateErrors = mutateResources(syncEvent.UpdateResources)
+	return rejected
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parsePropertyPath(t *testing.T) {
+	path, err := parsePropertyPath("$.label['app.kubernetes.io/name']")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"label", "app.kubernetes.io/name"}, path)
+	path, err = parsePropertyPath("$.label.app")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"label", "app"}, path)
+
+	for _, invalid := range []string{"label", "$", "$.", "$.items[0]", "$['open"} {
+		_, err = parsePropertyPath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func Test_parsePropertyTransforms(t *testing.T) {
+	transforms := parsePropertyTransforms(`[
+		{"target": "apigroup", "source": "$.apiversion"},
+		{"target": "kind", "value": "pod"},
+		{"target": "x", "source": "$.a", "function": "reverse"},
+		{"target": "y", "source": "$.a", "pattern": "("},
+		{"target": "z"}
+	]`)
+	assert.Len(t, transforms, 1) // The invalid transforms are skipped.
+	assert.Nil(t, parsePropertyTransforms(`not json`))
+}
+
+func Test_applyPropertyHooks(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	prevHooks := propertyHooks
+	defer func() { propertyHooks = prevHooks }()
+	config.Cfg.PropertyTransforms = `[
+		{"target": "apigroup", "source": "$.apiversion", "pattern": "^(.*)/[^/]*$", "replacement": "$1"},
+		{"kind": "Pod", "target": "costCenter", "source": "$.label['cost-center']", "function": "upper", "value": "none"},
+		{"kind": "Secret", "target": "owner", "source": "$.label.owner", "required": true}
+	]`
+	propertyHooks = nil
+	RegisterPropertyHook("fail", func(clusterName string, r *db.Resource) error {
+		if r.Properties["name"] == "bad" {
+			return errors.New("bad name")
+		}
+		return nil
+	})
+	RegisterPropertyHook("panic", func(clusterName string, r *db.Resource) error {
+		if r.Properties["name"] == "panic" {
+			panic("oops")
+		}
+		return nil
+	})
+	resource := func(uid, kind, name string, label map[string]interface{}) *db.Resource {
+		return &db.Resource{UID: uid, Properties: map[string]interface{}{
+			"kind": kind, "name": name, "apiversion": "apps/v1", "label": label}}
+	}
+	syncEvent := SyncEvent{
+		AddResources: []*db.Resource{
+			resource("c1/p1", "Pod", "a", map[string]interface{}{"cost-center": "eng"}),
+			resource("c1/p2", "Pod", "b", nil),
+			resource("c1/s1", "Secret", "c", nil), // Missing the required owner label.
+			resource("c1/p3", "Pod", "bad", nil),
+		},
+		UpdateResources: []*db.Resource{resource("c1/p4", "Pod", "panic", nil)},
+	}
+
+	rejected := applyPropertyHooks("c1", &syncEvent)
+
+	assert.Len(t, syncEvent.AddResources, 2)
+	assert.Equal(t, "apps", syncEvent.AddResources[0].Properties["apigroup"])
+	assert.Equal(t, "ENG", syncEvent.AddResources[0].Properties["costCenter"])
+	assert.Equal(t, "none", syncEvent.AddResources[1].Properties["costCenter"])
+	assert.Len(t, syncEvent.UpdateResources, 0)
+	assert.Equal(t, []SyncError{
+		{ResourceUID: "c1/s1", Message: "Property transform for owner: no value found for $.label.owner",
+			Code: ERROR_PROPERTY_HOOK_FAILED},
+		{ResourceUID: "c1/p3", Message: "Property hook fail failed: bad name", Code: ERROR_PROPERTY_HOOK_FAILED},
+	}, rejected.AddErrors)
+	assert.Equal(t, []SyncError{{ResourceUID: "c1/p4", Message: "Property hook panic failed: oops",
+		Code: ERROR_PROPERTY_HOOK_FAILED}}, rejected.UpdateErrors)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// How long the quarantines read from Redis are used, so the quarantines set on another replica apply.
+var quarantinesRefresh = 10 * time.Second
+
+var (
+	quarantines         map[string]db.ClusterQuarantine // By cluster, nil until they're read from Redis.
+	quarantinesLoadedAt time.Time
+	quarantinesMutex    = sync.Mutex{}
+)
+
+// Reads the quarantines from Redis when they're older than maxAge. Called with the mutex.
+func loadQuarantines(ctx context.Context, maxAge time.Duration) error {
+	if quarantines != nil && time.Since(quarantinesLoadedAt) < maxAge {
+		return nil
+	}
+	list, err := db.Quarantines(ctx)
+	if err != nil {
+		return err
+	}
+	quarantines = make(map[string]db.ClusterQuarantine, len(list))
+	for _, quarantine := range list {
+		quarantines[quarantine.Cluster] = quarantine
+	}
+	quarantinesLoadedAt = time.Now()
+	return nil
+}
+
+// Returns the quarantine of the cluster, false when its syncs are accepted. When the quarantines can't be read, the
+// last ones read are used.
+func clusterQuarantine(ctx context.Context, clusterName string) (db.ClusterQuarantine, bool) {
+	quarantinesMutex.Lock()
+	defer quarantinesMutex.Unlock()
+	if err := loadQuarantines(ctx, quarantinesRefresh); err != nil {
+		logger.Warning("Error reading the quarantined clusters: ", err)
+	}
+	quarantine, quarantined := quarantines[clusterName]
+	return quarantine, quarantined
+}
+
+// QuarantineCluster rejects the syncs of the cluster with 423 until the quarantine is lifted with a DELETE, to stop a
+// collector that is corrupting the graph. The resources of the cluster stay searchable. Lifting the quarantine asks
+// the collector for a resync, so it catches up with the changes it couldn't send.
+func QuarantineCluster(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, "Invalid cluster "+clusterName+": "+err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+	// Waits for the sync in progress, the next ones see the quarantine.
+	ctx, syncState, err := lockClusterSync(r.Context(), clusterName)
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	defer syncState.unlock()
+
+	quarantinesMutex.Lock()
+	defer quarantinesMutex.Unlock()
+	if err := loadQuarantines(ctx, 0); err != nil { // Read again, another replica may have changed them.
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE,
+			"Error reading the quarantined clusters: "+err.Error(), nil)
+		return
+	}
+	quarantine, quarantined := quarantines[clusterName]
+	updated := make(map[string]db.ClusterQuarantine, len(quarantines)+1)
+	for name, q := range quarantines {
+		updated[name] = q
+	}
+	if r.Method == http.MethodDelete {
+		if !quarantined {
+			respondError(w, http.StatusNotFound, ERROR_QUARANTINE_NOT_FOUND,
+				"Cluster "+clusterName+" isn't quarantined.", map[string]string{"cluster": clusterName})
+			return
+		}
+		delete(updated, clusterName)
+	} else {
+		if !quarantined {
+			quarantine = db.ClusterQuarantine{Cluster: clusterName, Since: time.Now()}
+		}
+		quarantine.Reason = r.URL.Query().Get("reason")
+		updated[clusterName] = quarantine
+	}
+	if err := db.SaveQuarantines(ctx, sortedQuarantines(updated)); err != nil {
+		logger.Warning("Error saving the quarantine of cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE,
+			"Error saving the quarantine: "+err.Error(), nil)
+		return
+	}
+	quarantines = updated
+
+	if r.Method == http.MethodDelete {
+		logger.Infof("Lifted the quarantine of cluster %s, requesting a resync.", clusterName)
+		requestResync(clusterName, "quarantine lifted")
+	} else {
+		logger.Warningf("Quarantined cluster %s, its syncs are rejected. Reason: %s", clusterName, quarantine.Reason)
+	}
+	if encodeError := json.NewEncoder(w).Encode(quarantine); encodeError != nil {
+		logger.Error("Error responding to QuarantineCluster: ", encodeError)
+	}
+}
+
+// QuarantinedClusters responds with the quarantined clusters.
+func QuarantinedClusters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	quarantinesMutex.Lock()
+	err := loadQuarantines(r.Context(), quarantinesRefresh)
+	list := sortedQuarantines(quarantines)
+	quarantinesMutex.Unlock()
+	if err != nil {
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE,
+			"Error reading the quarantined clusters: "+err.Error(), nil)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(list); encodeError != nil {
+		logger.Error("Error responding to QuarantinedClusters: ", encodeError)
+	}
+}
+
+// Returns the quarantines by cluster name.
+func sortedQuarantines(byCluster map[string]db.ClusterQuarantine) []db.ClusterQuarantine {
+	list := make([]db.ClusterQuarantine, 0, len(byCluster))
+	for _, quarantine := range byCluster {
+		list = append(list, quarantine)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Cluster < list[j].Cluster })
+	return list
+}
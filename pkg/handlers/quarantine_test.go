@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantineCluster(t *testing.T) {
+	resetQuarantines := func() {
+		quarantinesMutex.Lock()
+		quarantines = nil
+		quarantinesMutex.Unlock()
+	}
+	defer func() {
+		resetQuarantines()
+	}()
+	useTestDatastore(t)
+	resetQuarantines()
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/quarantine", QuarantineCluster).Methods("POST", "DELETE")
+	router.HandleFunc("/aggregator/admin/quarantines", QuarantinedClusters).Methods("GET")
+	ctx := context.Background()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/aggregator/clusters/q1/quarantine?reason=bad+UIDs", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	quarantine, quarantined := clusterQuarantine(ctx, "q1")
+	assert.True(t, quarantined)
+	assert.Equal(t, "bad UIDs", quarantine.Reason)
+	_, quarantined = clusterQuarantine(ctx, "q2")
+	assert.False(t, quarantined)
+
+	// The quarantines are kept in Redis.
+	resetQuarantines()
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/aggregator/admin/quarantines", nil))
+	var list []db.ClusterQuarantine
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&list))
+	assert.Len(t, list, 1)
+	assert.Equal(t, "q1", list[0].Cluster)
+	assert.Equal(t, quarantine.Since.Unix(), list[0].Since.Unix())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/aggregator/clusters/q1/quarantine", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	_, quarantined = clusterQuarantine(ctx, "q1")
+	assert.False(t, quarantined)
+	_, state, err := lockClusterSync(ctx, "q1")
+	assert.NoError(t, err)
+	_, ok := state.checkEpoch("q1", &SyncEvent{})
+	state.unlock()
+	assert.False(t, ok, "The cluster resyncs once the quarantine is lifted.")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/aggregator/clusters/q1/quarantine", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	stored, err := db.Quarantines(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
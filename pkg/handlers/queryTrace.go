@@ -0,0 +1,48 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Tells whether the request has the bearer ADMIN_TOKEN. Always false when ADMIN_TOKEN isn't set.
+func isAdminRequest(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return config.Cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(config.Cfg.AdminToken)) == 1
+}
+
+// Returns a context tracing the queries of the request when it asks for them with ?debugQueries=true, and the
+// trace, nil when not requested. Fails with the status code to respond with when the request isn't from an admin.
+func debugQueries(r *http.Request) (context.Context, *db.QueryTrace, int, error) {
+	if r.URL.Query().Get("debugQueries") != "true" {
+		return r.Context(), nil, http.StatusOK, nil
+	}
+	if config.Cfg.AdminToken == "" {
+		return nil, nil, http.StatusForbidden, withErrorCode(errors.New(
+			"debugQueries is disabled, set ADMIN_TOKEN to enable it"), ERROR_FEATURE_DISABLED,
+			map[string]string{"feature": "debugQueries"})
+	}
+	if !isAdminRequest(r) {
+		return nil, nil, http.StatusUnauthorized, errors.New("debugQueries requires the admin token")
+	}
+	logger.Infof("Tracing the queries of %s %s", r.Method, r.URL.Path)
+	ctx, trace := db.WithQueryTrace(r.Context())
+	return ctx, trace, http.StatusOK, nil
+}
+
+// Returns the queries of the trace, nil without a trace.
+func tracedQueries(trace *db.QueryTrace) []db.TracedQuery {
+	if trace == nil {
+		return nil
+	}
+	return trace.Queries()
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchDebugQueries(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	_, err := db.Store.Query(context.Background(), "CREATE (:Pod {_uid:'c1/p1', kind:'pod', name:'web'})")
+	assert.NoError(t, err)
+
+	search := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/aggregator/search?debugQueries=true",
+			strings.NewReader(`{"search": "kind:pod"}`))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		Search(w, r)
+		return w
+	}
+
+	config.Cfg.AdminToken = ""
+	assert.Equal(t, http.StatusForbidden, search("secret").Code, "Disabled without ADMIN_TOKEN")
+	config.Cfg.AdminToken = "secret"
+	assert.Equal(t, http.StatusUnauthorized, search("").Code)
+	assert.Equal(t, http.StatusUnauthorized, search("wrong").Code)
+
+	w := search("secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response SearchResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, 1, len(response.Items))
+	assert.NotEmpty(t, response.Queries)
+	last := response.Queries[len(response.Queries)-1]
+	assert.Contains(t, last.Query, "n.kind = 'pod'")
+	assert.Empty(t, last.Error)
+}
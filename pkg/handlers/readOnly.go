@@ -0,0 +1,74 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Body of a PUT to the read-only mode.
+type readOnlyRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Replaced in tests.
+var redisMemory = db.RedisMemory
+
+// ReadOnly responds with the read-only mode of the aggregator. A PUT enables or disables the manual read-only mode,
+// the automatic one stays enabled while the memory of Redis is above READ_ONLY_MEMORY_PERCENT.
+func ReadOnly(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPut {
+		var request readOnlyRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+			return
+		}
+		db.SetReadOnly(request.Enabled, request.Reason, time.Now())
+	}
+	if encodeError := json.NewEncoder(w).Encode(db.CurrentReadOnlyMode()); encodeError != nil {
+		logger.Error("Error responding to ReadOnly: ", encodeError)
+	}
+}
+
+// Checks the memory of Redis against READ_ONLY_MEMORY_PERCENT.
+func checkRedisMemory(ctx context.Context) error {
+	used, max, err := redisMemory(ctx)
+	if err != nil {
+		return err
+	}
+	db.RecordRedisMemory(used, max, time.Now())
+	return nil
+}
+
+// Checks the memory of Redis every READ_ONLY_CHECK_RATE_MS, the aggregator is read-only while it's above
+// READ_ONLY_MEMORY_PERCENT of maxmemory.
+func ReadOnlyJob() {
+	if config.Cfg.ReadOnlyMemoryPercent <= 0 {
+		logger.Info("Disabled the automatic read-only mode, READ_ONLY_MEMORY_PERCENT isn't set.")
+		return
+	}
+	if config.Cfg.ReadOnlyCheckRateMS <= 0 {
+		logger.Info("Disabled the automatic read-only mode, READ_ONLY_CHECK_RATE_MS is 0.")
+		return
+	}
+	warnedMaxMemory := false
+	for {
+		ctx := db.WithLane(context.Background(), db.BulkLane)
+		if err := checkRedisMemory(ctx); err != nil {
+			logger.Warning("Error checking the memory of Redis for the read-only mode: ", err)
+		} else if db.CurrentReadOnlyMode().MemoryMax == 0 && !warnedMaxMemory {
+			logger.Warning("Redis has no maxmemory, the memory doesn't enable the read-only mode.")
+			warnedMaxMemory = true
+		}
+		time.Sleep(time.Duration(config.Cfg.ReadOnlyCheckRateMS) * time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	prevMemory := redisMemory
+	t.Cleanup(func() {
+		db.SetReadOnly(false, "", time.Now())
+		db.RecordRedisMemory(0, 100, time.Now())
+		redisMemory = prevMemory
+	})
+	useTestDatastore(t)
+	config.Cfg.SkipClusterValidation = "true"
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Pod {_uid:'c1/p1', cluster:'c1', kind:'pod', name:'a'})")
+	assert.NoError(t, err)
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", SyncResources).Methods("POST")
+	router.HandleFunc("/aggregator/admin/readonly", ReadOnly).Methods("GET", "PUT")
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+	sync := func() (int, SyncResponse) {
+		body, _ := json.Marshal(SyncEvent{AddResources: []*db.Resource{{Kind: "Pod", UID: "c1/p2",
+			Properties: map[string]interface{}{"kind": "pod", "name": "b"}}}})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/aggregator/clusters/c1/sync", bytes.NewReader(body)))
+		var response SyncResponse
+		_ = json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response
+	}
+
+	recorder := serve("PUT", "/aggregator/admin/readonly", `{"enabled": true, "reason": "Redis maintenance"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var mode db.ReadOnlyMode
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&mode))
+	assert.True(t, mode.Enabled)
+	assert.Equal(t, "Redis maintenance", mode.Reason)
+
+	status, response := sync()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, ERROR_READ_ONLY, response.ErrorCode)
+	w := httptest.NewRecorder()
+	Search(w, httptest.NewRequest("POST", "/aggregator/search", strings.NewReader(`{"search": "kind:pod"}`)))
+	assert.Equal(t, http.StatusOK, w.Code, "The searches are served from the existing data.")
+	assert.Contains(t, w.Body.String(), "c1/p1")
+
+	assert.Equal(t, http.StatusBadRequest, serve("PUT", "/aggregator/admin/readonly", `{"enabled": 1}`).Code)
+	assert.Equal(t, http.StatusOK, serve("PUT", "/aggregator/admin/readonly", `{"enabled": false}`).Code)
+	status, _ = sync()
+	assert.Equal(t, http.StatusOK, status)
+
+	// Enabled by the memory of Redis.
+	config.Cfg.ReadOnlyMemoryPercent = 90
+	redisMemory = func(ctx context.Context) (int64, int64, error) { return 95, 100, nil }
+	assert.NoError(t, checkRedisMemory(ctx))
+	assert.NoError(t, json.NewDecoder(serve("GET", "/aggregator/admin/readonly", "").Body).Decode(&mode))
+	assert.True(t, mode.Enabled)
+	assert.False(t, mode.Manual)
+	assert.Contains(t, mode.Reason, "READ_ONLY_MEMORY_PERCENT")
+}
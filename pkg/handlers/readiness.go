@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Checks whether a subsystem is ready, returns the reason when it isn't.
+type ReadinessCheck func() error
+
+type readinessEntry struct {
+	name     string
+	required bool
+	check    ReadinessCheck
+}
+
+// Status of the checks of the readiness probe, in its response.
+type ReadinessStatus struct {
+	Ready  bool                   `json:"ready"`
+	Checks []ReadinessCheckStatus `json:"checks"`
+}
+
+type ReadinessCheckStatus struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"` // ok, failing when a required check fails, degraded for the others.
+	Reason   string `json:"reason,omitempty"`
+	Required bool   `json:"required"`
+}
+
+var (
+	readinessChecks      []readinessEntry // In the order they were registered.
+	readinessChecksMutex = sync.Mutex{}
+)
+
+func init() {
+	RegisterReadinessCheck("datastore", true, datastoreReady)
+	RegisterReadinessCheck("warm-up", true, func() error {
+		if warming, step := warmingUp(time.Now()); warming {
+			return errors.New("Warming up: " + step)
+		}
+		return nil
+	})
+	RegisterReadinessCheck("event-sink", false, eventSinkReady)
+}
+
+// RegisterReadinessCheck adds the check of a subsystem to the readiness probe, replacing the one with the same name.
+// The aggregator isn't ready while a required check fails, the other checks are reported as degraded.
+func RegisterReadinessCheck(name string, required bool, check ReadinessCheck) {
+	readinessChecksMutex.Lock()
+	defer readinessChecksMutex.Unlock()
+	entry := readinessEntry{name: name, required: required, check: check}
+	for i := range readinessChecks {
+		if readinessChecks[i].name == name {
+			readinessChecks[i] = entry
+			return
+		}
+	}
+	readinessChecks = append(readinessChecks, entry)
+}
+
+// Runs the readiness checks. Ready when all the required ones pass.
+func checkReadiness() ReadinessStatus {
+	readinessChecksMutex.Lock()
+	checks := append([]readinessEntry{}, readinessChecks...)
+	readinessChecksMutex.Unlock()
+
+	status := ReadinessStatus{Ready: true, Checks: make([]ReadinessCheckStatus, 0, len(checks))}
+	for _, entry := range checks {
+		checkStatus := ReadinessCheckStatus{Name: entry.name, Status: "ok", Required: entry.required}
+		if err := entry.check(); err != nil {
+			checkStatus.Status, checkStatus.Reason = "degraded", err.Error()
+			if entry.required {
+				checkStatus.Status = "failing"
+				status.Ready = false
+			}
+		}
+		status.Checks = append(status.Checks, checkStatus)
+	}
+	return status
+}
+
+// Dials Redis outside of the pool, so the check doesn't play by the pool's rules or wait for a connection.
+func datastoreReady() error {
+	conn, err := db.Pool.Dial()
+	if err != nil {
+		return errors.New("Unable to reach Redis.")
+	}
+	return conn.Close()
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// States of a rebuild of the graph.
+const (
+	REBUILD_RUNNING   = "Running"   // Waves start as the previous one completes.
+	REBUILD_PAUSED    = "Paused"    // The current wave is tracked, the next one doesn't start.
+	REBUILD_COMPLETED = "Completed" // Every cluster resynced or timed out.
+	REBUILD_CANCELED  = "Canceled"
+)
+
+const (
+	defaultRebuildWaveSize    = 5
+	defaultRebuildWaveTimeout = 10 * time.Minute
+	rebuildCheckInterval      = 5 * time.Second
+	rebuildResyncReason       = "The graph is being rebuilt."
+)
+
+// Body of the requests to start a rebuild and to change the one in progress. Zero values keep the current settings.
+type RebuildRequest struct {
+	WaveSize      int      `json:"waveSize,omitempty"`      // Clusters asked to resync at a time.
+	WaveTimeoutMS int      `json:"waveTimeoutMS,omitempty"` // Time for the clusters of a wave to resync.
+	Clusters      []string `json:"clusters,omitempty"`      // Start only, defaults to every cluster with a Cluster node.
+	Paused        *bool    `json:"paused,omitempty"`
+}
+
+// Progress of a rebuild, as in the rebuild admin API.
+type RebuildProgress struct {
+	State         string    `json:"state"`
+	WaveSize      int       `json:"waveSize"`
+	WaveTimeoutMS int       `json:"waveTimeoutMS"`
+	Wave          int       `json:"wave"`  // Current wave, from 1.
+	Waves         int       `json:"waves"` // Estimated from the pending clusters and the wave size.
+	Total         int       `json:"total"`
+	Completed     int       `json:"completed"`
+	Pending       int       `json:"pending"`
+	InProgress    []string  `json:"inProgress"`
+	TimedOut      []string  `json:"timedOut"` // Clusters that didn't resync in their wave.
+	Percent       float64   `json:"percent"`  // Clusters completed or timed out.
+	StartedAt     time.Time `json:"startedAt"`
+	CompletedAt   time.Time `json:"completedAt"` // Zero until the rebuild completes or is canceled.
+}
+
+// Rebuilds the graph from the resyncs of the collectors, a wave of clusters at a time, e.g. after the datastore
+// was replaced. The clusters of a wave are asked to resync, and the next wave starts when all of them resynced or
+// the wave timed out. Clusters that resync on their own before their wave count as completed.
+type rebuild struct {
+	progress    RebuildProgress
+	pending     []string
+	inProgress  map[string]bool
+	waveStarted time.Time
+}
+
+var (
+	currentRebuild *rebuild
+	rebuildMutex   = sync.Mutex{}
+	// Asks a cluster to resync, replaced in tests.
+	requestRebuildResync = func(clusterName string) { requestResync(clusterName, rebuildResyncReason) }
+)
+
+func newRebuild(clusters []string, waveSize int, waveTimeout time.Duration, now time.Time) *rebuild {
+	return &rebuild{
+		progress: RebuildProgress{State: REBUILD_RUNNING, WaveSize: waveSize,
+			WaveTimeoutMS: int(waveTimeout / time.Millisecond), Total: len(clusters), StartedAt: now},
+		pending:    append([]string{}, clusters...),
+		inProgress: make(map[string]bool),
+	}
+}
+
+// Tells whether the rebuild is in progress, running or paused. Must hold rebuildMutex.
+func (b *rebuild) active() bool {
+	return b.progress.State == REBUILD_RUNNING || b.progress.State == REBUILD_PAUSED
+}
+
+// Times out the current wave and starts the next one when it's due. Returns the clusters of the started wave,
+// for the caller to ask them to resync after releasing rebuildMutex. Must hold rebuildMutex.
+func (b *rebuild) advance(now time.Time) []string {
+	if !b.active() {
+		return nil
+	}
+	if len(b.inProgress) > 0 {
+		if now.Sub(b.waveStarted) < time.Duration(b.progress.WaveTimeoutMS)*time.Millisecond {
+			return nil
+		}
+		for clusterName := range b.inProgress {
+			logger.Warningf("Cluster %s didn't resync in wave %d of the rebuild.", clusterName, b.progress.Wave)
+			b.progress.TimedOut = append(b.progress.TimedOut, clusterName)
+		}
+		b.inProgress = make(map[string]bool)
+	}
+	if len(b.pending) == 0 {
+		b.progress.State, b.progress.CompletedAt = REBUILD_COMPLETED, now
+		logger.Infof("Rebuild completed, %d clusters resynced and %d timed out.", b.progress.Completed,
+			len(b.progress.TimedOut))
+		return nil
+	}
+	if b.progress.State == REBUILD_PAUSED {
+		return nil
+	}
+	size := b.progress.WaveSize
+	if size > len(b.pending) {
+		size = len(b.pending)
+	}
+	wave := b.pending[:size]
+	b.pending = b.pending[size:]
+	for _, clusterName := range wave {
+		b.inProgress[clusterName] = true
+	}
+	b.progress.Wave++
+	b.waveStarted = now
+	logger.Infof("Starting wave %d of the rebuild with %d clusters, %d pending.", b.progress.Wave, len(wave),
+		len(b.pending))
+	return wave
+}
+
+// Counts the resync of the cluster. Must hold rebuildMutex.
+func (b *rebuild) resynced(clusterName string) {
+	if !b.active() {
+		return
+	}
+	if b.inProgress[clusterName] {
+		delete(b.inProgress, clusterName)
+		b.progress.Completed++
+		return
+	}
+	for i, pending := range b.pending {
+		if pending == clusterName {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			b.progress.Completed++
+			return
+		}
+	}
+}
+
+// Returns a copy of the progress with the counts and estimates filled in. Must hold rebuildMutex.
+func (b *rebuild) status() RebuildProgress {
+	progress := b.progress
+	progress.Pending = len(b.pending)
+	progress.InProgress = make([]string, 0, len(b.inProgress))
+	for clusterName := range b.inProgress {
+		progress.InProgress = append(progress.InProgress, clusterName)
+	}
+	progress.TimedOut = append([]string{}, b.progress.TimedOut...)
+	progress.Waves = progress.Wave + (len(b.pending)+progress.WaveSize-1)/progress.WaveSize
+	if progress.Total > 0 {
+		progress.Percent = float64(progress.Completed+len(progress.TimedOut)) * 100 / float64(progress.Total)
+	} else {
+		progress.Percent = 100
+	}
+	return progress
+}
+
+func setRebuildMetrics(progress RebuildProgress) {
+	metrics.RebuildClusters.WithLabelValues("pending").Set(float64(progress.Pending))
+	metrics.RebuildClusters.WithLabelValues("inProgress").Set(float64(len(progress.InProgress)))
+	metrics.RebuildClusters.WithLabelValues("completed").Set(float64(progress.Completed))
+	metrics.RebuildClusters.WithLabelValues("timedOut").Set(float64(len(progress.TimedOut)))
+}
+
+// Advances the current rebuild and asks the clusters of the started wave to resync.
+func stepRebuild(now time.Time) {
+	rebuildMutex.Lock()
+	if currentRebuild == nil {
+		rebuildMutex.Unlock()
+		return
+	}
+	wave := currentRebuild.advance(now)
+	progress := currentRebuild.status()
+	rebuildMutex.Unlock()
+	setRebuildMetrics(progress)
+	for _, clusterName := range wave {
+		requestRebuildResync(clusterName)
+	}
+}
+
+// Counts a successful resync of the cluster for the rebuild in progress, and starts the next wave when it was the
+// last cluster of the current one.
+func observeRebuildResync(clusterName string) {
+	rebuildMutex.Lock()
+	active := currentRebuild != nil && currentRebuild.active()
+	if active {
+		currentRebuild.resynced(clusterName)
+	}
+	rebuildMutex.Unlock()
+	if active {
+		stepRebuild(time.Now())
+	}
+}
+
+// Advances the rebuild until it completes or is replaced.
+func runRebuild(b *rebuild) {
+	for {
+		stepRebuild(time.Now())
+		time.Sleep(rebuildCheckInterval)
+		rebuildMutex.Lock()
+		done := currentRebuild != b || !b.active()
+		rebuildMutex.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+func decodeRebuildRequest(r *http.Request) (RebuildRequest, error) {
+	var request RebuildRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err == io.EOF { // Empty body, keep the defaults.
+		err = nil
+	}
+	if err == nil && (request.WaveSize < 0 || request.WaveTimeoutMS < 0) {
+		err = errInvalidRebuildSettings
+	}
+	return request, err
+}
+
+var errInvalidRebuildSettings = errors.New("waveSize and waveTimeoutMS can't be negative")
+
+func respondRebuildProgress(w http.ResponseWriter, status int, progress RebuildProgress) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if encodeError := json.NewEncoder(w).Encode(progress); encodeError != nil {
+		logger.Error("Error responding with the rebuild progress: ", encodeError)
+	}
+}
+
+// StartRebuild asks the clusters to resync in waves to rebuild the graph, and responds with the progress.
+// Responds 409 when a rebuild is already in progress.
+func StartRebuild(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeRebuildRequest(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	clusters := request.Clusters
+	if len(clusters) == 0 {
+		clusters, err = db.ClusterNames(r.Context())
+		if err != nil {
+			logger.Warning("Error reading the clusters to rebuild: ", err)
+			respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+			return
+		}
+	}
+	for _, clusterName := range clusters {
+		if err := db.ValidateClusterName(clusterName); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER,
+				"Invalid cluster "+clusterName+": "+err.Error(), map[string]string{"cluster": clusterName})
+			return
+		}
+	}
+	waveSize, waveTimeout := defaultRebuildWaveSize, defaultRebuildWaveTimeout
+	if request.WaveSize > 0 {
+		waveSize = request.WaveSize
+	}
+	if request.WaveTimeoutMS > 0 {
+		waveTimeout = time.Duration(request.WaveTimeoutMS) * time.Millisecond
+	}
+
+	rebuildMutex.Lock()
+	if currentRebuild != nil && currentRebuild.active() {
+		progress := currentRebuild.status()
+		rebuildMutex.Unlock()
+		respondRebuildProgress(w, http.StatusConflict, progress)
+		return
+	}
+	b := newRebuild(dedupe(clusters), waveSize, waveTimeout, time.Now())
+	if request.Paused != nil && *request.Paused {
+		b.progress.State = REBUILD_PAUSED
+	}
+	currentRebuild = b
+	progress := b.status()
+	rebuildMutex.Unlock()
+	logger.Infof("Starting a rebuild of the graph from %d clusters, %d at a time.", progress.Total, waveSize)
+	go runRebuild(b)
+	respondRebuildProgress(w, http.StatusAccepted, progress)
+}
+
+// GetRebuild responds with the progress of the last rebuild, or 404 when none was started.
+func GetRebuild(w http.ResponseWriter, r *http.Request) {
+	rebuildMutex.Lock()
+	if currentRebuild == nil {
+		rebuildMutex.Unlock()
+		respondError(w, http.StatusNotFound, ERROR_REBUILD_NOT_FOUND, "No rebuild was started.", nil)
+		return
+	}
+	progress := currentRebuild.status()
+	rebuildMutex.Unlock()
+	respondRebuildProgress(w, http.StatusOK, progress)
+}
+
+// UpdateRebuild changes the wave size or timeout of the rebuild in progress, or pauses and resumes it.
+// The changes apply from the next wave.
+func UpdateRebuild(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeRebuildRequest(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	rebuildMutex.Lock()
+	b := currentRebuild
+	if b == nil || !b.active() {
+		rebuildMutex.Unlock()
+		respondError(w, http.StatusNotFound, ERROR_REBUILD_NOT_FOUND, "No rebuild in progress.", nil)
+		return
+	}
+	if request.WaveSize > 0 {
+		b.progress.WaveSize = request.WaveSize
+	}
+	if request.WaveTimeoutMS > 0 {
+		b.progress.WaveTimeoutMS = request.WaveTimeoutMS
+	}
+	if request.Paused != nil {
+		b.progress.State = REBUILD_RUNNING
+		if *request.Paused {
+			b.progress.State = REBUILD_PAUSED
+		}
+	}
+	rebuildMutex.Unlock()
+	stepRebuild(time.Now()) // Start the next wave right away when resumed.
+	rebuildMutex.Lock()
+	progress := b.status()
+	rebuildMutex.Unlock()
+	respondRebuildProgress(w, http.StatusOK, progress)
+}
+
+// CancelRebuild stops the rebuild in progress. The clusters already asked to resync still resync.
+func CancelRebuild(w http.ResponseWriter, r *http.Request) {
+	rebuildMutex.Lock()
+	b := currentRebuild
+	if b == nil || !b.active() {
+		rebuildMutex.Unlock()
+		respondError(w, http.StatusNotFound, ERROR_REBUILD_NOT_FOUND, "No rebuild in progress.", nil)
+		return
+	}
+	b.progress.State, b.progress.CompletedAt = REBUILD_CANCELED, time.Now()
+	progress := b.status()
+	rebuildMutex.Unlock()
+	logger.Info("Canceled the rebuild of the graph in wave ", progress.Wave)
+	respondRebuildProgress(w, http.StatusOK, progress)
+}
+
+// Removes the repeated names, keeping the order.
+func dedupe(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rebuild(t *testing.T) {
+	start := time.Now()
+	b := newRebuild([]string{"c1", "c2", "c3", "c4", "c5"}, 2, time.Minute, start)
+
+	assert.Equal(t, []string{"c1", "c2"}, b.advance(start))
+	assert.Nil(t, b.advance(start), "The next wave waits for the current one.")
+	b.resynced("c1")
+	b.resynced("c4") // Resynced on its own before its wave.
+	assert.Equal(t, 2, b.status().Waves)
+
+	// c2 doesn't resync in time.
+	assert.Equal(t, []string{"c3", "c5"}, b.advance(start.Add(time.Minute)))
+	b.progress.State = REBUILD_PAUSED
+	b.resynced("c3")
+	b.resynced("c5")
+	status := b.status()
+	assert.Equal(t, 4, status.Completed)
+	assert.Equal(t, []string{"c2"}, status.TimedOut)
+	assert.Equal(t, float64(100), status.Percent)
+
+	assert.Nil(t, b.advance(start.Add(2*time.Minute)))
+	assert.Equal(t, REBUILD_COMPLETED, b.progress.State)
+	assert.Equal(t, 2, b.progress.Wave)
+}
+
+func Test_rebuild_paused(t *testing.T) {
+	start := time.Now()
+	b := newRebuild([]string{"c1", "c2"}, 1, time.Minute, start)
+	b.progress.State = REBUILD_PAUSED
+	assert.Nil(t, b.advance(start))
+	assert.Equal(t, REBUILD_PAUSED, b.progress.State)
+
+	b.progress.State = REBUILD_RUNNING
+	assert.Equal(t, []string{"c1"}, b.advance(start))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Header with the id of a request, sent by the caller or set by RecoverPanics. It's in the response too.
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// Body of the response to a request that panicked.
+type PanicResponse struct {
+	Error     string `json:"error"`
+	RequestId string `json:"requestId"` // Also in the X-Request-Id header, to find the stack in the logs.
+	Path      string `json:"path"`
+}
+
+// Returns a random id for a request without one.
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// RecoverPanics is the middleware of the routers. A handler that panics gets a 500 with the request id instead of a
+// dropped connection, and the stack is logged with the route, the cluster and the request id. The panics are counted
+// by route in the search_aggregator_handler_panics_total metric.
+func RecoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(REQUEST_ID_HEADER)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = newRequestID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestID)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered) // Aborts the response on purpose, the server doesn't log it.
+			}
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			metrics.HandlerPanics.WithLabelValues(route).Inc()
+			logger.Errorf("Panic handling %s %s for cluster %q, request id %s, from %s: %v\n%s", r.Method,
+				r.URL.Path, mux.Vars(r)["id"], requestID, r.RemoteAddr, recovered, debug.Stack())
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError) // Ignored when the handler already wrote the status.
+			body := PanicResponse{Error: "Internal server error", RequestId: requestID, Path: r.URL.Path}
+			if encodeError := json.NewEncoder(w).Encode(body); encodeError != nil {
+				logger.Error("Error responding to the request that panicked: ", encodeError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(RecoverPanics)
+	router.HandleFunc("/aggregator/clusters/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		var resources map[string]int
+		resources["pods"]++ // Assignment to a nil map.
+	})
+	router.HandleFunc("/liveness", LivenessProbe)
+	panics := metrics.HandlerPanics.WithLabelValues("/aggregator/clusters/{id}/status")
+	before := testutil.ToFloat64(panics)
+
+	request := httptest.NewRequest("GET", "/aggregator/clusters/c1/status", nil)
+	request.Header.Set(REQUEST_ID_HEADER, "abc123")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "abc123", recorder.Header().Get(REQUEST_ID_HEADER))
+	var body PanicResponse
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+	assert.Equal(t, PanicResponse{Error: "Internal server error", RequestId: "abc123",
+		Path: "/aggregator/clusters/c1/status"}, body)
+	assert.Equal(t, before+1, testutil.ToFloat64(panics), "Counted by route, not by path.")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/liveness", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, recorder.Header().Get(REQUEST_ID_HEADER), 16, "A request id is generated when there's none.")
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+var errRelabelRunning = errors.New("The KIND_MAPPINGS are already being applied")
+
+var (
+	relabelRunning bool
+	relabelMutex   = sync.Mutex{}
+)
+
+// Nodes and edges updated by a kind mapping.
+type RelabelResult struct {
+	From     db.KindRef      `json:"from"`
+	To       db.KindRef      `json:"to"`
+	Clusters int             `json:"clusters"` // Clusters with nodes of the old kind and API group.
+	Stats    db.RelabelStats `json:"stats"`
+}
+
+// Applies the KIND_MAPPINGS to the nodes of each cluster in batches of RELABEL_BATCH_SIZE. The syncs of a cluster wait
+// for each batch, the edges of the relabeled nodes are read and recreated in it.
+func relabelGraph(ctx context.Context) ([]RelabelResult, error) {
+	relabelMutex.Lock()
+	if relabelRunning {
+		relabelMutex.Unlock()
+		return nil, errRelabelRunning
+	}
+	relabelRunning = true
+	relabelMutex.Unlock()
+	defer func() {
+		relabelMutex.Lock()
+		relabelRunning = false
+		relabelMutex.Unlock()
+	}()
+
+	batchSize := config.Cfg.RelabelBatchSize
+	if batchSize <= 0 {
+		batchSize = config.DEFAULT_RELABEL_BATCH_SIZE
+	}
+	results := []RelabelResult{}
+	for _, m := range db.KindMappings() {
+		result := RelabelResult{From: m.From, To: m.To}
+		clusters, err := db.KindMappingClusters(ctx, m)
+		if err != nil {
+			return results, err
+		}
+		result.Clusters = len(clusters)
+		for _, clusterName := range clusters {
+			for {
+				lockCtx, syncState, err := lockClusterSync(ctx, clusterName)
+				if err != nil {
+					return results, err
+				}
+				stats, err := db.RelabelBatch(lockCtx, m, clusterName, batchSize)
+				syncState.unlock()
+				if err != nil {
+					logger.Warningf("Error relabeling the %s nodes of cluster %s: %s", m.From.Kind, clusterName, err)
+					return append(results, result), err
+				}
+				if stats.Nodes == 0 {
+					break
+				}
+				result.Stats.Nodes += stats.Nodes
+				result.Stats.Edges += stats.Edges
+			}
+			requestSummaryUpdate(clusterName)
+		}
+		if result.Stats.Nodes > 0 {
+			logger.Infof("Relabeled %d %s nodes as %s %s in %d clusters, recreated %d edges.", result.Stats.Nodes,
+				m.From.Kind, m.To.Kind, m.To.Apigroup, result.Clusters, result.Stats.Edges)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Applies the KIND_MAPPINGS to the graph every RELABEL_RATE_MS, for the resources stored before a mapping was added
+// and the ones still sent with the old kind by the collectors.
+func RelabelJob() {
+	if config.Cfg.RelabelRateMS <= 0 {
+		logger.Info("Disabled the relabel job, RELABEL_RATE_MS is 0.")
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.Cfg.RelabelRateMS) * time.Millisecond)
+		if len(db.KindMappings()) == 0 {
+			continue
+		}
+		ctx := db.WithLane(context.Background(), db.BulkLane)
+		if _, err := relabelGraph(ctx); err != nil && err != errRelabelRunning {
+			logger.Warning("Error applying the KIND_MAPPINGS: ", err)
+		}
+	}
+}
+
+// Relabel applies the KIND_MAPPINGS to the graph now, and responds with the nodes and edges updated by each mapping.
+func Relabel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	results, err := relabelGraph(r.Context())
+	if err == errRelabelRunning {
+		respondError(w, http.StatusConflict, ERROR_OPERATION_IN_PROGRESS, err.Error(),
+			map[string]string{"operation": "relabel"})
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, ERROR_INTERNAL,
+			"Error applying the KIND_MAPPINGS: "+err.Error(), nil)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(results); encodeError != nil {
+		logger.Error("Error responding to Relabel: ", encodeError)
+	}
+}
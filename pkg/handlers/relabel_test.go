@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelabel(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.RelabelBatchSize = 1
+	config.Cfg.KindMappings = `[{"from": {"kind": "HorizontalPodAutoscaler", "apigroup": "autoscaling"},
+		"to": {"apigroup": "autoscaling.k8s.io"}}]`
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE "+
+		"(:HorizontalPodAutoscaler {_uid:'c1/a', kind:'horizontalpodautoscaler', apigroup:'autoscaling', cluster:'c1'}), "+
+		"(:HorizontalPodAutoscaler {_uid:'c1/b', kind:'horizontalpodautoscaler', apigroup:'autoscaling', cluster:'c1'}), "+
+		"(:HorizontalPodAutoscaler {_uid:'c2/a', kind:'horizontalpodautoscaler', apigroup:'autoscaling', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	Relabel(w, httptest.NewRequest("POST", "/aggregator/admin/relabel", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var results []RelabelResult
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "HorizontalPodAutoscaler", results[0].To.Kind)
+		assert.Equal(t, 2, results[0].Clusters)
+		assert.Equal(t, db.RelabelStats{Nodes: 3}, results[0].Stats)
+	}
+
+	relabelMutex.Lock()
+	relabelRunning = true
+	relabelMutex.Unlock()
+	w = httptest.NewRecorder()
+	Relabel(w, httptest.NewRequest("POST", "/aggregator/admin/relabel", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	relabelMutex.Lock()
+	relabelRunning = false
+	relabelMutex.Unlock()
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Parses an optional integer query parameter, returns the default when it's not set.
+func intParam(r *http.Request, name string, defaultValue int) (int, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(param)
+}
+
+// Parses the optional minWeight query parameter, a weight from 0 to 1 of the edges returned, 0 when it's not set.
+func weightParam(r *http.Request) (float64, error) {
+	param := r.URL.Query().Get("minWeight")
+	if param == "" {
+		return 0, nil
+	}
+	weight, err := strconv.ParseFloat(param, 64)
+	if err == nil && (weight < 0 || weight > 1) {
+		err = fmt.Errorf("%g isn't between 0 and 1", weight)
+	}
+	return weight, err
+}
+
+// RelatedResources responds with the resources related to a resource, up to depth hops away.
+// Use the types parameter to follow only some edge types, direction to follow them only one way, kinds to return
+// only some kinds, limit to bound the resources reached at each hop and minWeight to skip the uncertain edges.
+func RelatedResources(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	uid, _, err := db.NormalizeUID(clusterName+"/"+mux.Vars(r)["uid"], clusterName)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_UID, "Invalid resource UID: "+err.Error(), nil)
+		return
+	}
+
+	opts := db.RelatedOptions{
+		EdgeTypes: config.ParseList(r.URL.Query().Get("types")),
+		Kinds:     config.ParseList(r.URL.Query().Get("kinds")),
+		Direction: r.URL.Query().Get("direction"),
+	}
+	if opts.Depth, err = intParam(r, "depth", 1); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid depth parameter: "+err.Error(),
+			map[string]string{"parameter": "depth"})
+		return
+	}
+	limit, err := intParam(r, "limit", 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid limit parameter: "+err.Error(),
+			map[string]string{"parameter": "limit"})
+		return
+	}
+	opts.HopLimit = searchLimit(limit)
+	if opts.MinWeight, err = weightParam(r); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid minWeight parameter: "+err.Error(),
+			map[string]string{"parameter": "minWeight"})
+		return
+	}
+	var status int
+	if opts.Access, status, err = searchAccess(r); err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+
+	related, err := db.RelatedResources(r.Context(), uid, opts)
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(related); encodeError != nil {
+		logger.Error("Error responding to RelatedResources: ", encodeError)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// RemapCluster moves the resources, history and tombstones of a cluster to the name in the to parameter, for a
+// cluster that was detached and imported again under a new name. The syncs of both clusters wait for the remap.
+func RemapCluster(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	from, to := mux.Vars(r)["id"], r.URL.Query().Get("to")
+	for _, clusterName := range []string{from, to} {
+		if err := db.ValidateClusterName(clusterName); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER,
+				"Invalid cluster "+clusterName+": "+err.Error(), map[string]string{"cluster": clusterName})
+			return
+		}
+		if clusterName == "local-cluster" {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER,
+				"The resources of local-cluster can't be remapped", map[string]string{"cluster": clusterName})
+			return
+		}
+	}
+	if from == to {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "The to parameter must be a new cluster name",
+			map[string]string{"parameter": "to"})
+		return
+	}
+
+	// Locked in order, so two remaps of the same clusters can't wait for each other.
+	clusters := []string{from, to}
+	sort.Strings(clusters)
+	ctx := r.Context()
+	for _, clusterName := range clusters {
+		lockCtx, syncState, err := lockClusterSync(ctx, clusterName)
+		if err != nil {
+			respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+			return
+		}
+		defer syncState.unlock()
+		ctx = lockCtx // Canceled when the lock of either cluster is lost.
+	}
+
+	remap, err := db.RemapCluster(ctx, from, to)
+	if err == db.ErrRemapConflict {
+		respondError(w, http.StatusConflict, ERROR_REMAP_CONFLICT,
+			"Cluster "+to+" already has resources, the resources of "+from+" can't be moved to it",
+			map[string]string{"cluster": to})
+		return
+	}
+	if err != nil {
+		logger.Warning("Error remapping cluster ", from, " to ", to, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE,
+			"Error remapping the cluster: "+err.Error(), nil)
+		return
+	}
+	logger.Infof("Remapped cluster %s to %s in %d ms. Resources: %d Cluster node: %s", from, to, remap.DurationMS,
+		remap.Resources, remap.ClusterNode)
+	markInterClusterChange(from)
+	markInterClusterChange(to)
+	markPolicyChange()
+	requestSummaryUpdate(to)
+
+	if encodeError := json.NewEncoder(w).Encode(remap); encodeError != nil {
+		logger.Error("Error responding to RemapCluster: ", encodeError)
+	}
+}
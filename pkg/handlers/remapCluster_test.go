@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemapCluster(t *testing.T) {
+	useTestDatastore(t)
+	_, err := db.Store.Query(context.Background(), "CREATE (:Cluster {_uid:'cluster__new', kind:'cluster', name:'new'}), "+
+		"(:Pod {_uid:'old/a', kind:'pod', cluster:'old'}), (:Pod {_uid:'c2/a', kind:'pod', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/remap", RemapCluster)
+	post := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", url, nil))
+		return w
+	}
+
+	w := post("/aggregator/clusters/old/remap?to=new")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var remap db.ClusterRemap
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&remap))
+	assert.Equal(t, 1, remap.Resources)
+	assert.Equal(t, "none", remap.ClusterNode)
+
+	assert.Equal(t, http.StatusConflict, post("/aggregator/clusters/new/remap?to=c2").Code)
+	assert.Equal(t, http.StatusBadRequest, post("/aggregator/clusters/new/remap?to=new").Code)
+	assert.Equal(t, http.StatusBadRequest, post("/aggregator/clusters/new/remap?to=local-cluster").Code)
+	assert.Equal(t, http.StatusBadRequest, post("/aggregator/clusters/new/remap").Code)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/eventsink"
+)
+
+// How often the retry job looks for failed resources due for a retry.
+const resourceRetryWait = time.Second
+
+// Writes again the failed resources of the cluster due for a retry, while the syncs of the cluster wait so a newer
+// sync can't be overwritten. Returns the number written.
+func retryClusterResources(ctx context.Context, clusterName string, now time.Time) (int, error) {
+	ctx, syncState, err := lockClusterSync(ctx, clusterName)
+	if err != nil {
+		return 0, err
+	}
+	defer syncState.unlock()
+
+	inserts, updates := []*db.RetryEntry{}, []*db.RetryEntry{}
+	for _, entry := range db.TakeDueRetries(clusterName, now) {
+		if entry.Op == db.RETRY_INSERT {
+			inserts = append(inserts, entry)
+		} else {
+			updates = append(updates, entry)
+		}
+	}
+	succeeded := 0
+	if len(inserts) > 0 {
+		resources := retryEntryResources(inserts)
+		insertResponse := db.ChunkedInsert(ctx, resources, clusterName)
+		publishResources(ctx, clusterName, 0, eventsink.NodeAdded, resources, insertResponse)
+		succeeded += db.CompleteRetries(clusterName, inserts, insertResponse, now)
+	}
+	if len(updates) > 0 {
+		resources := retryEntryResources(updates)
+		updateResponse := db.ChunkedUpdate(ctx, resources)
+		publishResources(ctx, clusterName, 0, eventsink.NodeUpdated, resources, updateResponse)
+		succeeded += db.CompleteRetries(clusterName, updates, updateResponse, now)
+	}
+	if succeeded > 0 {
+		logger.Infof("Retried %d failed resources of cluster %s.", succeeded, clusterName)
+		requestSummaryUpdate(clusterName)
+	}
+	return succeeded, nil
+}
+
+func retryEntryResources(entries []*db.RetryEntry) []*db.Resource {
+	resources := make([]*db.Resource, len(entries))
+	for i, entry := range entries {
+		resources[i] = entry.Resource
+	}
+	return resources
+}
+
+// Retries the resources that failed to be inserted or updated with an error of their own, with a backoff doubled by
+// each failed retry, until RESOURCE_RETRY_ATTEMPTS retries failed. Without it they'd be missing or stale until the
+// next resync of their cluster.
+func ResourceRetryJob() {
+	if config.Cfg.ResourceRetryAttempts <= 0 {
+		logger.Info("Disabled the resource retry job, RESOURCE_RETRY_ATTEMPTS is 0.")
+		return
+	}
+	for {
+		time.Sleep(resourceRetryWait)
+		if db.IsReadOnly() {
+			continue // The resources wait until the writes are accepted again.
+		}
+		for _, clusterName := range db.DueRetryClusters(time.Now()) {
+			ctx := db.WithLane(context.Background(), db.BulkLane)
+			if _, err := retryClusterResources(ctx, clusterName, time.Now()); err != nil {
+				logger.Warning("Error retrying the failed resources of cluster ", clusterName, ": ", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_retryClusterResources(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.ResourceRetryAttempts = 3
+	defer db.DropRetries("retry1")
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__retry1', kind:'cluster', name:'retry1'}), "+
+		"(:Pod {_uid:'retry1/b', kind:'Pod', name:'b', cluster:'retry1'})")
+	assert.NoError(t, err)
+
+	failed := map[string]error{"retry1/a": errors.New("boom"), "retry1/b": errors.New("boom")}
+	now := time.Now()
+	db.QueueRetries("retry1", db.RETRY_INSERT, []*db.Resource{{UID: "retry1/a", Properties: map[string]interface{}{
+		"kind": "pod", "name": "a", "cluster": "retry1"}}}, failed, now)
+	db.QueueRetries("retry1", db.RETRY_UPDATE, []*db.Resource{{UID: "retry1/b", Properties: map[string]interface{}{
+		"kind": "Pod", "name": "b2", "cluster": "retry1"}}}, failed, now)
+
+	written, err := retryClusterResources(ctx, "retry1", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, written, "Waiting for the backoff")
+
+	written, err = retryClusterResources(ctx, "retry1", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, written)
+	assert.Empty(t, db.PendingRetries()["retry1"])
+	result, err := db.Store.Query(ctx, "MATCH (n {cluster:'retry1'}) RETURN n.name ORDER BY n.name")
+	assert.NoError(t, err)
+	names := []interface{}{}
+	for result.Next() {
+		names = append(names, result.Record().GetByIndex(0))
+	}
+	assert.Equal(t, []interface{}{"a", "b2"}, names)
+}
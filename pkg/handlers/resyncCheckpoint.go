@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+var resyncCheckpointInterval = 2000 // Resources compared and written between two checkpoints of a resync.
+
+// Returns whether the resync of the payload is checkpointed.
+func resyncCheckpoints(payloadHash string) bool {
+	return payloadHash != "" && config.Cfg.ResyncCheckpointMaxAgeMS > 0
+}
+
+// Returns the checkpoint of the interrupted resync of the same payload, saved within RESYNC_CHECKPOINT_MAX_AGE_MS,
+// or a new checkpoint to start from.
+func resumeResyncCheckpoint(ctx context.Context, clusterName, payloadHash string) db.ResyncCheckpoint {
+	checkpoint := db.ResyncCheckpoint{Hash: payloadHash, Phase: db.ResyncNodesPhase, Started: time.Now()}
+	if !resyncCheckpoints(payloadHash) {
+		return checkpoint
+	}
+	maxAge := time.Duration(config.Cfg.ResyncCheckpointMaxAgeMS) * time.Millisecond
+	previous, found, err := db.ResyncCheckpointOf(ctx, clusterName, maxAge)
+	if err != nil {
+		logger.Warning("Error reading the resync checkpoint of cluster ", clusterName, ", starting over: ", err)
+		return checkpoint
+	}
+	if !found || previous.Hash != payloadHash {
+		return checkpoint
+	}
+	logger.Infof("Resuming the resync of cluster %s started at %s from its checkpoint, phase %s with %d resources "+
+		"reconciled.", clusterName, previous.Started.Format(time.RFC3339), previous.Phase, previous.Resources)
+	return previous
+}
+
+// Saves the progress of the resync. A resync that can't save its checkpoint starts over if it's interrupted.
+func saveResyncCheckpoint(ctx context.Context, clusterName string, checkpoint *db.ResyncCheckpoint) {
+	if !resyncCheckpoints(checkpoint.Hash) {
+		return
+	}
+	checkpoint.SavedAt = time.Now()
+	maxAge := time.Duration(config.Cfg.ResyncCheckpointMaxAgeMS) * time.Millisecond
+	if err := db.SaveResyncCheckpoint(ctx, clusterName, *checkpoint, maxAge); err != nil {
+		logger.Warning("Error saving the resync checkpoint of cluster ", clusterName, ": ", err)
+	}
+}
+
+// Deletes the checkpoint of a completed resync.
+func deleteResyncCheckpoint(ctx context.Context, clusterName, payloadHash string) {
+	if !resyncCheckpoints(payloadHash) {
+		return
+	}
+	if err := db.DeleteResyncCheckpoint(ctx, clusterName); err != nil {
+		logger.Warning("Error deleting the resync checkpoint of cluster ", clusterName, ": ", err)
+	}
+}
+
+// Returns whether the sync ran for longer than RESYNC_TIME_BUDGET_MS. Only checkpointed resyncs are interrupted,
+// the others would start over each time.
+func resyncTimeBudgetExceeded(metrics *SyncMetrics) bool {
+	if config.Cfg.ResyncTimeBudgetMS <= 0 || !resyncCheckpoints(metrics.PayloadHash) || metrics.syncStart.IsZero() {
+		return false
+	}
+	return time.Since(metrics.syncStart) > time.Duration(config.Cfg.ResyncTimeBudgetMS)*time.Millisecond
+}
+
+// Returns the retryable error of a resync interrupted by the time budget, the collector sends it again and it
+// resumes from the checkpoint.
+func pauseResync(clusterName string, checkpoint db.ResyncCheckpoint) error {
+	logger.Infof("Paused the resync of cluster %s after RESYNC_TIME_BUDGET_MS, phase %s with %d resources reconciled.",
+		clusterName, checkpoint.Phase, checkpoint.Resources)
+	return fmt.Errorf("%w: the resync ran for longer than RESYNC_TIME_BUDGET_MS, send it again to resume it",
+		db.ErrRetryable)
+}
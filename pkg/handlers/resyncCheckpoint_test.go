@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resyncCluster_checkpoint(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	prevInterval := resyncCheckpointInterval
+	defer func() {
+		resyncCheckpointInterval = prevInterval
+	}()
+	useTestDatastore(t)
+	config.Cfg.ResyncCheckpointMaxAgeMS, config.Cfg.ResyncTimeBudgetMS = 60000, 1
+	resyncCheckpointInterval = 2
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__cp', kind:'cluster', name:'cp'}), "+
+		"(:Pod {_uid:'cp/gone', kind:'pod', cluster:'cp'})")
+	assert.NoError(t, err)
+
+	resources := func() []*db.Resource {
+		list := []*db.Resource{}
+		for _, name := range []string{"e", "d", "c", "b", "a"} {
+			list = append(list, &db.Resource{UID: "cp/" + name, Kind: "Pod",
+				Properties: map[string]interface{}{"kind": "pod", "cluster": "cp", "name": name}})
+		}
+		return list
+	}
+	metrics := func(hash string) *SyncMetrics {
+		return &SyncMetrics{syncStart: time.Now().Add(-time.Minute), PayloadHash: hash}
+	}
+
+	// Over the time budget, the resync stops after the first segment of UIDs.
+	stats, err := resyncCluster(ctx, "cp", resources(), nil, nil, metrics("h1"))
+	assert.True(t, db.IsRetryable(err))
+	assert.Equal(t, 2, stats.TotalAdded)
+	checkpoint, found, err := db.ResyncCheckpointOf(ctx, "cp", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, db.ResyncNodesPhase, checkpoint.Phase)
+	assert.Equal(t, "cp/b", checkpoint.Watermark)
+	assert.Equal(t, 2, checkpoint.Resources)
+	assert.Equal(t, 3, computeNodeCount(ctx, "cp"), "Nothing is deleted before the resources are reconciled.")
+
+	// The same payload resumes after the watermark, the next one stops before the edges.
+	stats, err = resyncCluster(ctx, "cp", resources(), nil, nil, metrics("h1"))
+	assert.True(t, db.IsRetryable(err))
+	assert.Equal(t, 2, stats.TotalAdded)
+	stats, err = resyncCluster(ctx, "cp", resources(), nil, nil, metrics("h1"))
+	assert.True(t, db.IsRetryable(err))
+	assert.Equal(t, 1, stats.TotalAdded)
+	assert.Equal(t, 1, stats.TotalDeleted)
+	checkpoint, _, _ = db.ResyncCheckpointOf(ctx, "cp", time.Minute)
+	assert.Equal(t, db.ResyncEdgesPhase, checkpoint.Phase)
+	assert.Equal(t, 5, checkpoint.Resources)
+
+	// Within the budget, the resync completes and drops its checkpoint.
+	config.Cfg.ResyncTimeBudgetMS = 0
+	stats, err = resyncCluster(ctx, "cp", resources(), nil, nil, metrics("h1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.TotalAdded+stats.TotalDeleted)
+	resyncDiffsMutex.Lock()
+	assert.Equal(t, 5, resyncDiffs["cp"].Resumed)
+	resyncDiffsMutex.Unlock()
+	_, found, err = db.ResyncCheckpointOf(ctx, "cp", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, 5, computeNodeCount(ctx, "cp"))
+
+	// Another payload starts over.
+	assert.NoError(t, db.SaveResyncCheckpoint(ctx, "cp", db.ResyncCheckpoint{Hash: "h1",
+		Phase: db.ResyncEdgesPhase, SavedAt: time.Now()}, time.Minute))
+	stats, err = resyncCluster(ctx, "cp", resources()[1:], nil, nil, metrics("h2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.TotalDeleted, "cp/e isn't in the payload.")
+}
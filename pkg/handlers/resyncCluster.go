@@ -12,13 +12,14 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"reflect"
+	"sort"
 	"strconv"
 	"time"
 
-	"github.com/golang/glog"
 	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/eventsink"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
@@ -26,115 +27,137 @@ func getEdgeUID(sourceUID string, edgeType string, destUID string) string {
 	return fmt.Sprintf("%s-%s->%s", sourceUID, edgeType, destUID)
 }
 
-func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge, metrics *SyncMetrics) (stats SyncResponse, err error) {
-	glog.Info("Resync for cluster: ", clusterName, " edges to insert: ", len(edges))
+// Replaces the resources and edges of the cluster with the given ones. The resources in unchanged are kept
+// as they are, the collector left them out of the resync because they match its inventory.
+func resyncCluster(ctx context.Context, clusterName string, resources []*db.Resource, unchanged []string,
+	edges []db.Edge, metrics *SyncMetrics) (stats SyncResponse, err error) {
+	logger.Info("Resync for cluster: ", clusterName, " edges to insert: ", len(edges))
 
-	// First get the existing resources from the datastore for the cluster
-	result, error := db.Store.Query(db.SanitizeQuery("MATCH (n {cluster: '%s'}) RETURN n", clusterName))
-
-	if error != nil {
-		glog.Error("Error getting existing resources for cluster ", clusterName)
-		err = error // For return value.
+	// The resources sent again are kept if a previous resync queued them for the lazy deleter.
+	sentUIDs := make([]string, 0, len(resources)+len(unchanged))
+	for _, resource := range resources {
+		sentUIDs = append(sentUIDs, resource.UID)
 	}
-	// Build a map with all the current resources by UID.
-	// Build a map of duplicated resources.
+	sentUIDs = append(sentUIDs, unchanged...)
+	if canceled := db.CancelPendingDeletes(clusterName, sentUIDs); len(canceled) > 0 {
+		logger.V(2).Infof("Canceled %d pending deletes for cluster %s.", len(canceled), clusterName)
+	}
+
+	consistency := resyncConsistency{resources: len(resources) + len(unchanged), edges: len(edges),
+		received: time.Now()}
+	// Huge clusters are read page by page and merge-joined with the sorted resources, existingResources only gets the
+	// resources to delete.
+	var pager *resyncPager
 	var existingResources = make(map[string]*rg2.Node)
-	var duplicatedResources = make(map[string]int)
-	for result.Next() {
-		record := result.Record()
-		if rgNode, ok := record.GetByIndex(0).(*rg2.Node); ok {
-			if existingResourceUID, ok := rgNode.Properties["_uid"].(string); ok {
-				if _, exists := existingResources[existingResourceUID]; exists {
-					dupeCount, dupeExists := duplicatedResources[existingResourceUID]
-					if !dupeExists {
-						duplicatedResources[existingResourceUID] = 1
-					} else {
-						duplicatedResources[existingResourceUID] = dupeCount + 1
-					}
-				} else {
-					existingResources[existingResourceUID] = rgNode
-				}
-			}
-		}
+	if pagedResyncDiff(ctx, clusterName) {
+		pager = newResyncPager(ctx, clusterName, unchanged)
+	} else {
+		existingResources, err = loadResyncResources(ctx, clusterName, unchanged, &stats, &consistency)
 	}
 
-	// Delete duplicated records. We have to delete all records with the duplicated UID and recreate.
-	if len(duplicatedResources) > 0 {
-		glog.Warningf("RedisGraph contains duplicate records for some UIDs in cluster %s. Total uids duplicates: %d",
-			clusterName, len(duplicatedResources))
-		for dupeUID, dupeCount := range duplicatedResources {
-			_, delError := db.Store.Query(db.SanitizeQuery("MATCH (n {_uid:'%s'}) DELETE n", dupeUID))
-			if delError != nil {
-				glog.Error("Error deleting duplicates for ", dupeUID, delError)
-			}
-			glog.V(3).Infof("Deleted %d duplicates of UID %s", dupeCount, dupeUID)
-			delete(existingResources, dupeUID) // Delete from existing resources.
+	// An interrupted resync of the same payload resumes from its checkpoint. The resources it reconciled are kept as
+	// they are, without comparing them again.
+	checkpoint := resumeResyncCheckpoint(ctx, clusterName, metrics.PayloadHash)
+	sort.Slice(resources, func(i, j int) bool { return resources[i].UID < resources[j].UID })
+	pending := resources
+	if checkpoint.Phase == db.ResyncEdgesPhase {
+		pending = nil
+	} else if checkpoint.Watermark != "" {
+		pending = resources[sort.Search(len(resources), func(i int) bool {
+			return resources[i].UID > checkpoint.Watermark
+		}):]
+	}
+	if pager != nil && len(pending) < len(resources) {
+		resumed, pageErr := pager.until(resources[len(resources)-len(pending)-1].UID)
+		if pageErr != nil {
+			return stats, pageErr
+		}
+		for uid, node := range resumed {
+			existingResources[uid] = node
 		}
 	}
+	for _, resource := range resources[:len(resources)-len(pending)] {
+		delete(existingResources, resource.UID)
+	}
+	diff := newResyncDiff(clusterName, len(unchanged))
+	diff.Resumed = len(resources) - len(pending)
 
-	// Loop through incoming resources and check if each resource exist and if it needs to be updated.
-	var resourcesToAdd = make([]*db.Resource, 0)
-	var resourcesToUpdate = make([]*db.Resource, 0)
-	for _, newResource := range resources {
-		existingResource, exist := existingResources[newResource.UID]
-
-		if !exist {
-			// Resource needs to be added.
-			resourcesToAdd = append(resourcesToAdd, newResource)
-		} else {
-			// Resource exists, but we need to check if it needs to be updated.
-			newEncodedProperties, encodeError := newResource.EncodeProperties()
-			if encodeError != nil {
-				// Assume we need to update this resource if we hit an encoding error.
-				glog.Warning("Error encoding properties of resource. ", encodeError)
-				resourcesToUpdate = append(resourcesToUpdate, newResource)
-			} else {
-				for key, value := range newEncodedProperties {
-					var isInterface bool
-					var existingProperty, stringValue string
-					_, interfaceTypeTrue := value.([]interface{})
-					existingInterface, existingInterfaceTypeTrue := existingResource.Properties[key].([]interface{})
-					if interfaceTypeTrue && existingInterfaceTypeTrue {
-						isInterface = true
-					} else {
-						// Need to compare everything other than interfaces as strings
-						// because that's what we get from RedisGraph.
-						stringValue = valueToString(value)
-						existingProperty = valueToString(existingResource.Properties[key])
-					}
-					if (isInterface && !reflect.DeepEqual(newResource.Properties[key], existingInterface)) ||
-						existingProperty != stringValue {
-						resourcesToUpdate = append(resourcesToUpdate, newResource)
-						break
-					}
-				}
+	// The resources are compared and written by segments of UIDs. The checkpoint moves past each segment written
+	// without errors, until a segment fails.
+	metrics.NodeSyncStart = time.Now()
+	reconciled := true
+	for len(pending) > 0 {
+		segment := pending
+		if len(segment) > resyncCheckpointInterval {
+			segment = segment[:resyncCheckpointInterval]
+		}
+		pending = pending[len(segment):]
+		existing := existingResources
+		if pager != nil {
+			var pageErr error
+			if existing, pageErr = pager.until(segment[len(segment)-1].UID); pageErr != nil {
+				return stats, pageErr
+			}
+		}
+		resourcesToAdd, resourcesToUpdate := compareResyncResources(segment, existing, &diff)
+		if pager != nil {
+			for uid, node := range existing { // Not sent, they're deleted.
+				existingResources[uid] = node
 			}
-			// Remove the resource because it has been proccessed.
-			// Any resources remaining when we are done will need to be deleted.
-			delete(existingResources, newResource.UID)
 		}
-	}
-
-	// INSERT Resources
 
-	metrics.NodeSyncStart = time.Now()
-	insertResponse := db.ChunkedInsert(resourcesToAdd, clusterName)
-	stats.TotalAdded = insertResponse.SuccessfulResources // could be 0
-	if insertResponse.ConnectionError != nil {
-		err = insertResponse.ConnectionError
-	} else if len(insertResponse.ResourceErrors) != 0 {
-		stats.AddErrors = processSyncErrors(insertResponse.ResourceErrors, "inserted")
-	}
+		// INSERT Resources
+
+		insertResponse := db.ChunkedInsert(ctx, resourcesToAdd, clusterName)
+		stats.TotalAdded += insertResponse.SuccessfulResources // could be 0
+		publishResources(ctx, clusterName, metrics.RequestId, eventsink.NodeAdded, resourcesToAdd, insertResponse)
+		if opErr := insertResponse.Err(); db.IsRetryable(opErr) {
+			err = opErr
+		} else if opErr != nil {
+			stats.AddErrors = append(stats.AddErrors, processSyncErrors(insertResponse.ResourceErrors, "inserted")...)
+			stats.RetryQueued = append(stats.RetryQueued, db.QueueRetries(clusterName, db.RETRY_INSERT,
+				resourcesToAdd, insertResponse.ResourceErrors, time.Now())...)
+		}
 
-	// UPDATE Resources
+		// UPDATE Resources
+
+		updateResponse := db.ChunkedUpdate(ctx, resourcesToUpdate)
+		stats.TotalUpdated += updateResponse.SuccessfulResources // could be 0
+		publishResources(ctx, clusterName, metrics.RequestId, eventsink.NodeUpdated, resourcesToUpdate, updateResponse)
+		if opErr := updateResponse.Err(); db.IsRetryable(opErr) {
+			err = opErr
+		} else if opErr != nil {
+			stats.UpdateErrors = append(stats.UpdateErrors, processSyncErrors(updateResponse.ResourceErrors, "updated")...)
+			stats.RetryQueued = append(stats.RetryQueued, db.QueueRetries(clusterName, db.RETRY_UPDATE,
+				resourcesToUpdate, updateResponse.ResourceErrors, time.Now())...)
+		}
 
-	updateResponse := db.ChunkedUpdate(resourcesToUpdate)
-	stats.TotalUpdated = updateResponse.SuccessfulResources // could be 0
-	if updateResponse.ConnectionError != nil {
-		err = updateResponse.ConnectionError
-	} else if len(updateResponse.ResourceErrors) != 0 {
-		stats.UpdateErrors = processSyncErrors(updateResponse.ResourceErrors, "updated")
+		reconciled = reconciled && insertResponse.Err() == nil && updateResponse.Err() == nil
+		if reconciled {
+			checkpoint.Watermark = segment[len(segment)-1].UID
+			checkpoint.Resources += len(segment)
+			saveResyncCheckpoint(ctx, clusterName, &checkpoint)
+		}
+		if reconciled && len(pending) > 0 && resyncTimeBudgetExceeded(metrics) {
+			return stats, pauseResync(clusterName, checkpoint)
+		}
+	}
+	if pager != nil {
+		rest, pageErr := pager.until("")
+		if pageErr != nil {
+			return stats, pageErr
+		}
+		for uid, node := range rest {
+			existingResources[uid] = node
+		}
+		for _, uid := range pager.missingUnchanged() {
+			stats.AddErrors = append(stats.AddErrors, unchangedNotFound(uid))
+		}
+		consistency.duplicateResources = pager.duplicates
+		logger.Infof("Paged resync diff of cluster %s read %d pages of %d nodes in %s.", clusterName, pager.pages,
+			pager.pageSize, pager.pageTime)
 	}
+	observeResyncDiff(diff)
 
 	// DELETE Resources
 
@@ -142,27 +165,50 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 	for _, resource := range existingResources {
 		deleteUIDS = append(deleteUIDS, resource.Properties["_uid"].(string))
 	}
-	deleteResponse := db.ChunkedDelete(deleteUIDS)
-	stats.TotalDeleted = deleteResponse.SuccessfulResources // could be 0
-	if deleteResponse.ConnectionError != nil {
-		err = deleteResponse.ConnectionError
-	} else if len(deleteResponse.ResourceErrors) != 0 {
-		stats.DeleteErrors = processSyncErrors(deleteResponse.ResourceErrors, "deleted")
+	// Large deletes are left to the lazy deleter, so they don't hold up the other queries. The resources stay in
+	// the graph until then.
+	deleteLazily := db.ShouldDeleteLazily(len(deleteUIDS))
+	if deleteLazily {
+		db.QueueDeletes(clusterName, deleteUIDS)
+		stats.TotalDeleted = len(deleteUIDS)
+		tombstones := resyncTombstones(existingResources, nil, time.Now())
+		publishDeletes(ctx, clusterName, metrics.RequestId, tombstones, db.ChunkedOperationResult{})
+		runInBackground(func() { recordTombstones(clusterName, metrics.RequestId, tombstones) })
+	} else {
+		deleteResponse := db.ChunkedDelete(ctx, deleteUIDS)
+		stats.TotalDeleted = deleteResponse.SuccessfulResources // could be 0
+		if opErr := deleteResponse.Err(); db.IsRetryable(opErr) {
+			err = opErr
+		} else if opErr != nil {
+			stats.DeleteErrors = processSyncErrors(deleteResponse.ResourceErrors, "deleted")
+		}
+		if deleteResponse.ConnectionError == nil && len(existingResources) > 0 {
+			tombstones := resyncTombstones(existingResources, deleteResponse.ResourceErrors, time.Now())
+			publishDeletes(ctx, clusterName, metrics.RequestId, tombstones, deleteResponse)
+			runInBackground(func() { recordTombstones(clusterName, metrics.RequestId, tombstones) })
+		}
 	}
 
 	metrics.NodeSyncEnd = time.Now()
+	if reconciled && err == nil {
+		checkpoint.Phase, checkpoint.Watermark = db.ResyncEdgesPhase, ""
+		saveResyncCheckpoint(ctx, clusterName, &checkpoint)
+		if resyncTimeBudgetExceeded(metrics) {
+			return stats, pauseResync(clusterName, checkpoint)
+		}
+	}
 
 	// RE-SYNC Edges
 
 	metrics.EdgeSyncStart = time.Now()
 
-	currEdgesCount := computeIntraEdges(clusterName)
-	glog.V(4).Info("Number of intra edges for cluster ", clusterName, " before removing duplicates: ", currEdgesCount)
+	currEdgesCount := computeIntraEdges(ctx, clusterName)
+	logger.V(4).Info("Number of intra edges for cluster ", clusterName, " before removing duplicates: ", currEdgesCount)
 
-	currEdges, edgesError := db.Store.Query(fmt.Sprintf("MATCH (s {cluster:'%s'})-[r]->(d {cluster:'%s'}) WHERE (r._interCluster <> true) OR (r._interCluster IS NULL) RETURN s._uid, type(r), d._uid",
+	currEdges, edgesError := db.Store.Query(ctx, fmt.Sprintf("MATCH (s {cluster:'%s'})-[r]->(d {cluster:'%s'}) WHERE (r._interCluster <> true) OR (r._interCluster IS NULL) RETURN s._uid, type(r), d._uid",
 		clusterName, clusterName))
 	if edgesError != nil {
-		glog.Warning("Error getting all existing edges for cluster ", clusterName, edgesError)
+		logger.Warning("Error getting all existing edges for cluster ", clusterName, edgesError)
 		err = edgesError
 	}
 	var existingEdges = make(map[string]db.Edge)
@@ -188,22 +234,23 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 		}
 	}
 
-	glog.V(4).Info("Duplicate edge count: ", dupCount)
+	logger.V(4).Info("Duplicate edge count: ", dupCount)
+	consistency.duplicateEdges = dupCount
 
 	//Redisgraph 2.0 supports addition of duplicate edges. Delete duplicate edges, if any, in the cluster
-	dupEdgedeleted, delEdgesError := db.Store.Query(fmt.Sprintf("MATCH (s {cluster:'%s'})-[r]->(d {cluster:'%s'}) WHERE (r._interCluster <> true) OR (r._interCluster IS NULL) WITH s as source, d as dest, TYPE(r) as edge, COLLECT (r) AS edges WHERE size(edges) >1 UNWIND edges[1..] AS dupedges DELETE dupedges", clusterName, clusterName))
+	dupEdgedeleted, delEdgesError := db.DeleteDuplicateEdges(ctx, clusterName)
 	if delEdgesError != nil {
-		glog.Warning("Error deleting duplicate edges for cluster ", clusterName, delEdgesError)
+		logger.Warning("Error deleting duplicate edges for cluster ", clusterName, delEdgesError)
 		err = delEdgesError
 	} else {
-		glog.V(4).Info("For cluster, ", clusterName, ": Deleted duplicate edges: ", dupEdgedeleted.RelationshipsDeleted())
+		logger.V(4).Info("For cluster, ", clusterName, ": Deleted duplicate edges: ", dupEdgedeleted.RelationshipsDeleted())
 	}
 
-	currEdgesCount = computeIntraEdges(clusterName)
-	glog.V(4).Info("Number of intra edges for cluster ", clusterName, " after removing duplicates: ", currEdgesCount)
+	currEdgesCount = computeIntraEdges(ctx, clusterName)
+	logger.V(4).Info("Number of intra edges for cluster ", clusterName, " after removing duplicates: ", currEdgesCount)
 
 	existingEdgesMapLength := len(existingEdges)
-	glog.V(4).Info("Existing edges map length: ", len(existingEdges))
+	logger.V(4).Info("Existing edges map length: ", len(existingEdges))
 
 	var verifyEdges = make(map[string]bool)
 
@@ -217,72 +264,210 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 		}
 	}
 	if len(verifyEdges) != len(edges) {
-		glog.Error("There are duplicate edges in the payload from cluster: ", clusterName)
+		logger.Error("There are duplicate edges in the payload from cluster: ", clusterName)
 	}
 
 	// Compute edges to delete.
 	// These are the remaining objects in existingEdges after processing all the incoming new edges.
 	var edgesToDelete = make([]db.Edge, 0)
 	for _, e := range existingEdges {
+		if deleteLazily {
+			// Deleting the node deletes its edges.
+			_, sourceQueued := existingResources[e.SourceUID]
+			_, destQueued := existingResources[e.DestUID]
+			if sourceQueued || destQueued {
+				continue
+			}
+		}
 		edgesToDelete = append(edgesToDelete, e)
 	}
 
 	expectedEdgesAfterProcessing := existingEdgesMapLength + len(edgesToAdd) - len(edgesToDelete)
 	if expectedEdgesAfterProcessing != len(edges) {
-		glog.Warningf("For cluster %s expectedEdgesAfterProcessing [%d] doesn't match received len(edges) [%d]",
+		consistency.edgeMismatch = expectedEdgesAfterProcessing - len(edges)
+		if consistency.edgeMismatch < 0 {
+			consistency.edgeMismatch = -consistency.edgeMismatch
+		}
+		logger.Warningf("For cluster %s expectedEdgesAfterProcessing [%d] doesn't match received len(edges) [%d]",
 			clusterName, expectedEdgesAfterProcessing, len(edges))
 	}
 	// INSERT Edges
-	glog.V(4).Info("Resync for cluster ", clusterName, ": Number of edges to insert: ", len(edgesToAdd))
-	insertEdgeResponse := db.ChunkedInsertEdge(edgesToAdd, clusterName)
+	logger.V(4).Info("Resync for cluster ", clusterName, ": Number of edges to insert: ", len(edgesToAdd))
+	insertEdgeResponse := db.ChunkedInsertEdge(ctx, edgesToAdd, clusterName)
 	stats.TotalEdgesAdded = insertEdgeResponse.SuccessfulResources // could be 0
-	if insertEdgeResponse.ConnectionError != nil {
-		err = insertEdgeResponse.ConnectionError
-	} else if len(insertEdgeResponse.ResourceErrors) != 0 {
+	publishEdges(ctx, clusterName, metrics.RequestId, eventsink.EdgeAdded, edgesToAdd, insertEdgeResponse)
+	if opErr := insertEdgeResponse.Err(); db.IsRetryable(opErr) {
+		err = opErr
+	} else if opErr != nil {
 		stats.AddEdgeErrors = processSyncErrors(insertEdgeResponse.ResourceErrors, "inserted by edge")
 	}
 
 	if len(edgesToAdd) != insertEdgeResponse.EdgesAdded {
-		glog.V(4).Info("Edges to add len: ", len(edgesToAdd))
-		glog.V(4).Info("Edge add errors: ", len(insertEdgeResponse.ResourceErrors))
-		glog.V(4).Info("Edge add errors: ", insertEdgeResponse.ResourceErrors)
-		currEdgesCount = computeIntraEdges(clusterName)
-		glog.V(4).Infof("Number of intra edges for cluster %s after adding edges: %d",
+		logger.V(4).Info("Edges to add len: ", len(edgesToAdd))
+		logger.V(4).Info("Edge add errors: ", len(insertEdgeResponse.ResourceErrors))
+		logger.V(4).Info("Edge add errors: ", insertEdgeResponse.ResourceErrors)
+		currEdgesCount = computeIntraEdges(ctx, clusterName)
+		logger.V(4).Infof("Number of intra edges for cluster %s after adding edges: %d",
 			clusterName, currEdgesCount)
-		glog.V(4).Info("currEdgesCount: ", currEdgesCount, " incoming edges: ", len(edges))
-		glog.V(4).Infof("Added edge count %d didn't match expected number: %d",
+		logger.V(4).Info("currEdgesCount: ", currEdgesCount, " incoming edges: ", len(edges))
+		logger.V(4).Infof("Added edge count %d didn't match expected number: %d",
 			insertEdgeResponse.EdgesAdded, len(edgesToAdd))
 	}
 
 	// DELETE Edges
-	glog.V(4).Info("Resync for cluster ", clusterName, ": Number of edges to delete: ", len(edgesToDelete))
-	deleteEdgeResponse := db.ChunkedDeleteEdge(edgesToDelete, clusterName)
+	logger.V(4).Info("Resync for cluster ", clusterName, ": Number of edges to delete: ", len(edgesToDelete))
+	deleteEdgeResponse := db.ChunkedDeleteEdge(ctx, edgesToDelete, clusterName)
 	stats.TotalEdgesDeleted = deleteEdgeResponse.SuccessfulResources // could be 0
-	if deleteEdgeResponse.ConnectionError != nil {
-		err = deleteEdgeResponse.ConnectionError
-	} else if len(deleteEdgeResponse.ResourceErrors) != 0 {
+	publishEdges(ctx, clusterName, metrics.RequestId, eventsink.EdgeDeleted, edgesToDelete, deleteEdgeResponse)
+	if opErr := deleteEdgeResponse.Err(); db.IsRetryable(opErr) {
+		err = opErr
+	} else if opErr != nil {
 		stats.DeleteEdgeErrors = processSyncErrors(deleteEdgeResponse.ResourceErrors, "removed by edge")
 	}
 
 	if len(edgesToDelete) != deleteEdgeResponse.EdgesDeleted {
-		glog.V(4).Info("Edges to delete: len", len(edgesToDelete))
-		glog.V(4).Info("Edge delete errors: ", len(deleteEdgeResponse.ResourceErrors))
-		glog.V(4).Info("Edge delete errors: ", deleteEdgeResponse.ResourceErrors)
-		currEdgesCount = computeIntraEdges(clusterName)
-		glog.V(4).Info("Number of intra edges for cluster ", clusterName, " after deleting edges: ", currEdgesCount)
-		glog.V(4).Info("currEdgesCount: ", currEdgesCount, " incoming edges: ", len(edges))
-		glog.V(4).Infof("Deleted edge count %d didn't match expected number: %d",
+		logger.V(4).Info("Edges to delete: len", len(edgesToDelete))
+		logger.V(4).Info("Edge delete errors: ", len(deleteEdgeResponse.ResourceErrors))
+		logger.V(4).Info("Edge delete errors: ", deleteEdgeResponse.ResourceErrors)
+		currEdgesCount = computeIntraEdges(ctx, clusterName)
+		logger.V(4).Info("Number of intra edges for cluster ", clusterName, " after deleting edges: ", currEdgesCount)
+		logger.V(4).Info("currEdgesCount: ", currEdgesCount, " incoming edges: ", len(edges))
+		logger.V(4).Infof("Deleted edge count %d didn't match expected number: %d",
 			deleteEdgeResponse.EdgesDeleted, len(edgesToDelete))
 	}
 
+	if deleted, delError := db.DeleteOrphanPlaceholders(ctx, clusterName); delError != nil {
+		logger.Warning("Error deleting orphan placeholder nodes for cluster ", clusterName, ": ", delError)
+	} else if deleted > 0 {
+		logger.V(3).Infof("Deleted %d orphan placeholder nodes for cluster %s.", deleted, clusterName)
+	}
+
 	// There's no need to UPDATE edges because edges don't have properties yet.
 
 	metrics.EdgeSyncEnd = time.Now()
-	glog.V(4).Infof("resyncCluster complete. Done updating resources for cluster %s, preparing response", clusterName)
+	// Only complete resyncs are scored, a failed one didn't compare everything.
+	if err == nil {
+		deleteResyncCheckpoint(ctx, clusterName, metrics.PayloadHash)
+		consistency.errors = len(stats.AddErrors) + len(stats.UpdateErrors) + len(stats.DeleteErrors) +
+			len(stats.AddEdgeErrors) + len(stats.DeleteEdgeErrors)
+		observeResyncConsistency(clusterName, consistency)
+	}
+	logger.V(4).Infof("resyncCluster complete. Done updating resources for cluster %s, preparing response", clusterName)
 
 	return stats, err
 }
 
+// Returns the stored resources of the cluster by UID, without the unchanged ones, which are kept. The duplicated
+// resources are deleted and left out, so they're added again.
+func loadResyncResources(ctx context.Context, clusterName string, unchanged []string, stats *SyncResponse,
+	consistency *resyncConsistency) (map[string]*rg2.Node, error) {
+	var err error
+	// First get the existing resources from the datastore for the cluster
+	result, error := db.Store.Query(ctx, db.SanitizeQuery("MATCH (n {cluster: '%s'}) RETURN n", clusterName))
+
+	if error != nil {
+		logger.Error("Error getting existing resources for cluster ", clusterName)
+		err = error // For return value.
+	}
+	// Build a map with all the current resources by UID.
+	// Build a map of duplicated resources.
+	var existingResources = make(map[string]*rg2.Node)
+	var duplicatedResources = make(map[string]int)
+	for result.Next() {
+		record := result.Record()
+		// Placeholders stay until their resource arrives or their edges are gone.
+		if rgNode, ok := record.GetByIndex(0).(*rg2.Node); ok && !db.IsPlaceholder(rgNode.Properties) {
+			if existingResourceUID, ok := rgNode.Properties["_uid"].(string); ok {
+				if _, exists := existingResources[existingResourceUID]; exists {
+					dupeCount, dupeExists := duplicatedResources[existingResourceUID]
+					if !dupeExists {
+						duplicatedResources[existingResourceUID] = 1
+					} else {
+						duplicatedResources[existingResourceUID] = dupeCount + 1
+					}
+				} else {
+					existingResources[existingResourceUID] = rgNode
+				}
+			}
+		}
+	}
+
+	for _, dupeCount := range duplicatedResources {
+		consistency.duplicateResources += dupeCount
+	}
+
+	// Delete duplicated records. We have to delete all records with the duplicated UID and recreate.
+	if len(duplicatedResources) > 0 {
+		logger.Warningf("RedisGraph contains duplicate records for some UIDs in cluster %s. Total uids duplicates: %d",
+			clusterName, len(duplicatedResources))
+		for dupeUID, dupeCount := range duplicatedResources {
+			_, delError := db.Store.Query(db.WithWrite(ctx), db.SanitizeQuery("MATCH (n {_uid:'%s'}) DELETE n", dupeUID))
+			if delError != nil {
+				logger.Error("Error deleting duplicates for ", dupeUID, delError)
+			}
+			logger.V(3).Infof("Deleted %d duplicates of UID %s", dupeCount, dupeUID)
+			delete(existingResources, dupeUID) // Delete from existing resources.
+		}
+	}
+
+	// Keep the unchanged resources. If one is gone, ask the collector to send it in full with the next sync.
+	for _, uid := range unchanged {
+		if _, exist := existingResources[uid]; !exist {
+			stats.AddErrors = append(stats.AddErrors, unchangedNotFound(uid))
+			continue
+		}
+		delete(existingResources, uid)
+	}
+	return existingResources, err
+}
+
+// Returns the error of an unchanged resource that isn't stored, the collector sends it in full with the next sync.
+func unchangedNotFound(uid string) SyncError {
+	return SyncError{ResourceUID: uid, Message: "Unchanged resource not found, it must be sent in full.",
+		Code: ERROR_UNCHANGED_RESOURCE_NOT_FOUND}
+}
+
+// Compares the resources with their node. Returns the ones to add and the ones to update, and removes the ones that
+// exist from the existing resources, the resources left there are deleted.
+func compareResyncResources(resources []*db.Resource, existingResources map[string]*rg2.Node,
+	diff *ResyncDiff) ([]*db.Resource, []*db.Resource) {
+	var resourcesToAdd = make([]*db.Resource, 0)
+	var resourcesToUpdate = make([]*db.Resource, 0)
+	for _, newResource := range resources {
+		existingResource, exist := existingResources[newResource.UID]
+
+		if !exist {
+			// Resource needs to be added.
+			resourcesToAdd = append(resourcesToAdd, newResource)
+			diff.Added++
+		} else {
+			// Resource exists, but we need to check if it needs to be updated.
+			existingHash, _ := existingResource.Properties[db.HASH_PROPERTY].(string)
+			// The hashed and redacted properties are compared with their stored value.
+			storedResource := newResource.Protected()
+			newEncodedProperties, encodeError := storedResource.EncodeProperties()
+			if newResource.Hash != "" && newResource.Hash != existingHash {
+				resourcesToUpdate = append(resourcesToUpdate, newResource)
+				diff.observe(newResource, resyncHashChanged, "")
+			} else if encodeError != nil {
+				// Assume we need to update this resource if we hit an encoding error.
+				logger.Warning("Error encoding properties of resource. ", encodeError)
+				resourcesToUpdate = append(resourcesToUpdate, newResource)
+				diff.observe(newResource, resyncEncodingError, "")
+			} else if property := changedProperty(storedResource, newEncodedProperties, existingResource); property != "" {
+				resourcesToUpdate = append(resourcesToUpdate, newResource)
+				diff.observe(newResource, resyncPropertyDiff, property)
+			} else {
+				diff.observe(newResource, resyncUnchanged, "")
+			}
+			// Remove the resource because it has been proccessed.
+			// Any resources remaining when we are done will need to be deleted.
+			delete(existingResources, newResource.UID)
+		}
+	}
+	return resourcesToAdd, resourcesToUpdate
+}
+
 func valueToString(value interface{}) string {
 	var stringValue string
 	switch typedVal := value.(type) {
@@ -294,7 +479,7 @@ func valueToString(value interface{}) string {
 		if _, ok := typedVal.(string); ok {
 			stringValue = typedVal.(string)
 		} else {
-			glog.Warning("Unable to parse string value from interface{} :  ", typedVal)
+			logger.Warning("Unable to parse string value from interface{} :  ", typedVal)
 		}
 	}
 	return stringValue
@@ -4,7 +4,12 @@
 package handlers
 
 import (
+	"context"
 	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_getEdgeUID(t *testing.T) {
@@ -15,3 +20,29 @@ func Test_getEdgeUID(t *testing.T) {
 		t.Errorf("Failed building edge UID. Expected: source-type->dest but got: %s", result)
 	}
 }
+
+func Test_resyncCluster_lazyDeletes(t *testing.T) {
+	useTestDatastore(t)
+	t.Cleanup(config.Snapshot())
+	config.Cfg.LazyDeleteThreshold = 1
+	defer db.DropPendingDeletes("c1")
+	ctx := context.Background()
+
+	_, err := db.Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Pod {_uid:'c1/a', kind:'pod', cluster:'c1'}), (:Pod {_uid:'c1/b', kind:'pod', cluster:'c1'}), "+
+		"(:Pod {_uid:'c1/c', kind:'pod', cluster:'c1'})")
+	assert.NoError(t, err)
+
+	// The deletes are over the threshold, they are queued and the pods are still in the graph.
+	stats, err := resyncCluster(ctx, "c1", []*db.Resource{}, []string{"c1/c"}, []db.Edge{}, &SyncMetrics{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.TotalDeleted)
+	assert.Equal(t, map[string]int{"c1": 2}, db.PendingDeletes())
+	assert.Equal(t, 3, computeNodeCount(ctx, "c1"))
+
+	// A pod sent again is kept.
+	resource := &db.Resource{UID: "c1/a", Kind: "Pod", Properties: map[string]interface{}{"kind": "pod", "cluster": "c1"}}
+	_, err = resyncCluster(ctx, "c1", []*db.Resource{resource}, []string{"c1/c"}, []db.Edge{}, &SyncMetrics{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"c1": 1}, db.PendingDeletes())
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Resyncs in a row a resource is updated by a property change before it's churning. The collector sends the same
+// resource every resync, so a property changing every time usually comes from an unstable encoding.
+const resyncChurnStreak = 3
+
+// Outcomes of comparing a resource of a resync with its node, the labels of the comparison metric.
+const (
+	resyncUnchanged     = "unchanged"     // Same properties, not written.
+	resyncHashChanged   = "hash"          // The collector sent a hash different from the node's.
+	resyncEncodingError = "encodingError" // Couldn't encode the properties to compare them, updated anyway.
+	resyncPropertyDiff  = "property"      // A property is different from the node's.
+)
+
+// Outcomes of the comparisons of a resync, as in the resync diff admin API.
+type ResyncDiff struct {
+	Cluster                string             `json:"cluster"`
+	Resync                 time.Time          `json:"resync"`
+	Added                  int                `json:"added"`     // Not in the graph yet.
+	Skipped                int                `json:"skipped"`   // Left out of the resync by the collector, unchanged.
+	Resumed                int                `json:"resumed"`   // Reconciled by the interrupted resync it resumed.
+	Unchanged              int                `json:"unchanged"` // Compared with their node, not written.
+	UpdatedByHash          int                `json:"updatedByHash"`
+	UpdatedByEncodingError int                `json:"updatedByEncodingError"`
+	UpdatedByProperty      map[string]int     `json:"updatedByProperty"` // By the first property that changed.
+	Churning               []ChurningResource `json:"churning"`
+}
+
+// Resource updated by a property change in the last resyncs in a row.
+type ChurningResource struct {
+	UID      string `json:"uid"`
+	Kind     string `json:"kind"`
+	Property string `json:"property"` // First property that changed in the last resync.
+	Resyncs  int    `json:"resyncs"`  // Resyncs in a row the resource was updated.
+}
+
+var (
+	resyncDiffs      = make(map[string]ResyncDiff)                  // Last resync of each cluster.
+	resyncChurn      = make(map[string]map[string]ChurningResource) // Cluster -> UID -> updates in a row.
+	resyncDiffsMutex = sync.Mutex{}
+)
+
+func newResyncDiff(clusterName string, skipped int) ResyncDiff {
+	return ResyncDiff{Cluster: clusterName, Resync: time.Now(), Skipped: skipped,
+		UpdatedByProperty: make(map[string]int)}
+}
+
+// Returns the first property, in alphabetical order, of the resource that is different from its node. Empty when
+// they're the same. Properties are compared as strings, because that's what we get from RedisGraph, except lists.
+func changedProperty(resource *db.Resource, encodedProperties map[string]interface{}, node *rg2.Node) string {
+	changed := ""
+	for key, value := range encodedProperties {
+		if changed != "" && key > changed {
+			continue
+		}
+		_, isList := value.([]interface{})
+		existingList, existingIsList := node.Properties[key].([]interface{})
+		if isList && existingIsList {
+			if !reflect.DeepEqual(resource.Properties[key], existingList) {
+				changed = key
+			}
+		} else if valueToString(value) != valueToString(node.Properties[key]) {
+			changed = key
+		}
+	}
+	return changed
+}
+
+// Records the comparison of a resource with its node. property is the one that changed for resyncPropertyDiff.
+func (d *ResyncDiff) observe(resource *db.Resource, outcome, property string) {
+	metrics.ResyncComparisons.WithLabelValues(outcome).Inc()
+	switch outcome {
+	case resyncUnchanged:
+		d.Unchanged++
+	case resyncHashChanged:
+		d.UpdatedByHash++
+	case resyncEncodingError:
+		d.UpdatedByEncodingError++
+	case resyncPropertyDiff:
+		d.UpdatedByProperty[property]++
+		metrics.ResyncPropertyUpdates.WithLabelValues(property).Inc()
+		kind, _ := resource.Properties["kind"].(string)
+		d.Churning = append(d.Churning, ChurningResource{UID: resource.UID, Kind: kind, Property: property})
+	}
+}
+
+// Keeps the diff as the last resync of the cluster. The resources updated by a property change are counted with the
+// previous resyncs, the others start over.
+func observeResyncDiff(diff ResyncDiff) {
+	resyncDiffsMutex.Lock()
+	defer resyncDiffsMutex.Unlock()
+	previous := resyncChurn[diff.Cluster]
+	churn := make(map[string]ChurningResource, len(diff.Churning))
+	churning := []ChurningResource{}
+	for _, resource := range diff.Churning {
+		resource.Resyncs = previous[resource.UID].Resyncs + 1
+		churn[resource.UID] = resource
+		if resource.Resyncs >= resyncChurnStreak {
+			churning = append(churning, resource)
+		}
+	}
+	sort.Slice(churning, func(i, j int) bool {
+		if churning[i].Resyncs != churning[j].Resyncs {
+			return churning[i].Resyncs > churning[j].Resyncs
+		}
+		return churning[i].UID < churning[j].UID
+	})
+	if len(churning) > 0 {
+		logger.V(2).Infof("%d resources of cluster %s were updated by the last %d resyncs, e.g. %s by its %s property.",
+			len(churning), diff.Cluster, resyncChurnStreak, churning[0].UID, churning[0].Property)
+	}
+	diff.Churning = churning
+	resyncChurn[diff.Cluster] = churn
+	resyncDiffs[diff.Cluster] = diff
+	metrics.SetClusterGauge(metrics.ResyncChurningResources, diff.Cluster,
+		float64(len(churning)))
+}
+
+// ClusterResyncDiff responds with the outcomes of comparing the resources of the last resync of a cluster with the graph,
+// and the resources updated by every resync. Use the limit parameter to get more or fewer churning resources,
+// defaults to 50 and 0 returns all of them.
+func ClusterResyncDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	limit := 50
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 0 {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+				"Invalid limit parameter, expected a number, 0 for all", map[string]string{"parameter": "limit"})
+			return
+		}
+	}
+
+	resyncDiffsMutex.Lock()
+	diff, ok := resyncDiffs[clusterName]
+	resyncDiffsMutex.Unlock()
+	if !ok {
+		respondError(w, http.StatusNotFound, ERROR_SYNC_NOT_FOUND,
+			"No resync from cluster "+clusterName+" since the aggregator started",
+			map[string]string{"cluster": clusterName})
+		return
+	}
+	if limit > 0 && len(diff.Churning) > limit {
+		diff.Churning = diff.Churning[:limit]
+	}
+	if encodeError := json.NewEncoder(w).Encode(diff); encodeError != nil {
+		logger.Error("Error responding to ClusterResyncDiff: ", encodeError)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_changedProperty(t *testing.T) {
+	node := &rg2.Node{Properties: map[string]interface{}{"kind": "pod", "restarts": 3,
+		"label": []interface{}{"app=a"}, "status": "Running"}}
+	resource := &db.Resource{Properties: map[string]interface{}{"kind": "pod", "restarts": int64(3),
+		"label": []interface{}{"app=a"}, "status": "Running"}}
+	assert.Equal(t, "", changedProperty(resource, resource.Properties, node))
+
+	resource.Properties["status"], resource.Properties["restarts"] = "Failed", int64(4)
+	assert.Equal(t, "restarts", changedProperty(resource, resource.Properties, node),
+		"The first property that changed in alphabetical order.")
+	resource.Properties["label"] = []interface{}{"app=b"}
+	assert.Equal(t, "label", changedProperty(resource, resource.Properties, node))
+}
+
+func Test_changedProperty_protected(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.HashedProperties, config.Cfg.RedactedProperties, config.Cfg.PropertyHashKey = "name", "email", "key"
+	node := &rg2.Node{Properties: map[string]interface{}{"kind": "pod", "name": db.HashValue("web"),
+		"email": db.REDACTED_VALUE}}
+	resource := &db.Resource{Properties: map[string]interface{}{"kind": "pod", "name": "web",
+		"email": "user@example.com"}}
+	stored := resource.Protected()
+	encoded, err := stored.EncodeProperties()
+	assert.NoError(t, err)
+	assert.Equal(t, "", changedProperty(stored, encoded, node), "The stored values are compared")
+	assert.Equal(t, "web", resource.Properties["name"], "The resource written is protected when it's inserted")
+}
+
+func Test_resyncCluster_diff(t *testing.T) {
+	useTestDatastore(t)
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__diff', kind:'cluster', name:'diff'})")
+	assert.NoError(t, err)
+
+	resources := func(resync int) []*db.Resource {
+		return []*db.Resource{
+			{UID: "diff/a", Kind: "Pod", Properties: map[string]interface{}{"kind": "pod", "cluster": "diff",
+				"status": fmt.Sprintf("Running %d", resync)}},
+			{UID: "diff/b", Kind: "Pod", Properties: map[string]interface{}{"kind": "pod", "cluster": "diff",
+				"status": "Running"}},
+		}
+	}
+	for resync := 0; resync < 4; resync++ {
+		_, err = resyncCluster(ctx, "diff", resources(resync), []string{}, []db.Edge{}, &SyncMetrics{})
+		assert.NoError(t, err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/resyncDiff", ClusterResyncDiff)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/aggregator/clusters/diff/resyncDiff", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var diff ResyncDiff
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, 1, diff.Unchanged)
+	assert.Equal(t, map[string]int{"status": 1}, diff.UpdatedByProperty)
+	assert.Equal(t, []ChurningResource{{UID: "diff/a", Kind: "pod", Property: "status", Resyncs: 3}}, diff.Churning)
+
+	// The streak starts over once the resource is unchanged.
+	_, err = resyncCluster(ctx, "diff", resources(3), []string{}, []db.Edge{}, &SyncMetrics{})
+	assert.NoError(t, err)
+	resyncDiffsMutex.Lock()
+	assert.Empty(t, resyncDiffs["diff"].Churning)
+	resyncDiffsMutex.Unlock()
+
+	for _, url := range []string{"/aggregator/clusters/diff/resyncDiff?limit=x", "/aggregator/clusters/none/resyncDiff"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		assert.NotEqual(t, http.StatusOK, w.Code, url)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Reads the stored resources of a huge cluster for its resync diff, one page at a time ordered by UID, so the diff
+// merge-joins them with the sorted resources sent instead of loading every node of the cluster at once. Only the
+// page read and the resources to delete are kept in memory.
+type resyncPager struct {
+	ctx         context.Context
+	clusterName string
+	pageSize    int
+	unchanged   map[string]bool // UIDs of the unchanged resources, true once found.
+	page        []*rg2.Node     // Nodes read and not compared yet, ordered by UID.
+	last        string          // UID of the last node read, the next page starts after it.
+	lastID      int64           // ID of the last node read, to continue with the duplicates of its UID.
+	done        bool            // The last page was read.
+	duplicates  int             // Duplicated nodes deleted.
+	pages       int             // Pages read.
+	pageTime    time.Duration   // Spent reading the pages.
+}
+
+// Tells whether the resync of the cluster compares its resources page by page, when it has more nodes than
+// RESYNC_PAGED_DIFF_NODES.
+func pagedResyncDiff(ctx context.Context, clusterName string) bool {
+	if config.Cfg.ResyncPagedDiffNodes <= 0 {
+		return false
+	}
+	nodes := computeNodeCount(ctx, clusterName)
+	if nodes <= config.Cfg.ResyncPagedDiffNodes {
+		return false
+	}
+	logger.Infof("Resync of cluster %s compares its %d nodes page by page, above RESYNC_PAGED_DIFF_NODES.",
+		clusterName, nodes)
+	return true
+}
+
+func newResyncPager(ctx context.Context, clusterName string, unchanged []string) *resyncPager {
+	pageSize := config.Cfg.ResyncDiffPageSize
+	if pageSize <= 0 {
+		pageSize = config.DEFAULT_RESYNC_DIFF_PAGE_SIZE
+	}
+	p := &resyncPager{ctx: ctx, clusterName: clusterName, pageSize: pageSize,
+		unchanged: make(map[string]bool, len(unchanged)), lastID: -1}
+	for _, uid := range unchanged {
+		p.unchanged[uid] = false
+	}
+	return p
+}
+
+func pagedNodeUID(node *rg2.Node) string {
+	uid, _ := node.Properties["_uid"].(string)
+	return uid
+}
+
+// Reads the next page of nodes, ordered by UID and then by ID so the duplicates of a UID split across pages are
+// all read. Each page scans every node of the graph: the cluster property isn't indexed, and the _uid indexes are by
+// label and only match equal UIDs. So the diff of a cluster with N nodes costs N/RESYNC_DIFF_PAGE_SIZE scans of the
+// graph, quadratic in the size of the cluster, the price of holding only a page in memory. A bigger page trades
+// memory for fewer scans, the pages and the time spent reading them are logged once the diff is done.
+func (p *resyncPager) next() error {
+	start := time.Now()
+	defer func() {
+		p.pages++
+		p.pageTime += time.Since(start)
+	}()
+	/* #nosec G201 - Input is sanitized. */
+	query := db.SanitizeQuery("MATCH (n {cluster:'%s'}) WHERE n._uid > '%s' OR (n._uid = '%s' AND id(n) > ",
+		p.clusterName, p.last, p.last) + fmt.Sprintf("%d) RETURN n ORDER BY n._uid, id(n) LIMIT %d", p.lastID, p.pageSize)
+	result, err := db.Store.Query(p.ctx, query)
+	if err != nil {
+		return err
+	}
+	rows := 0
+	for result.Next() {
+		rows++
+		if node, ok := result.Record().GetByIndex(0).(*rg2.Node); ok {
+			p.last, p.lastID = pagedNodeUID(node), int64(node.ID)
+			p.page = append(p.page, node)
+		}
+	}
+	p.done = rows < p.pageSize
+	return nil
+}
+
+// Returns the stored resources with a UID up to uid, all the remaining ones when it's empty, by UID. The duplicated
+// resources are deleted and left out, so they're added again, and the unchanged ones are left out so they're kept.
+// The placeholders stay until their resource arrives or their edges are gone.
+func (p *resyncPager) until(uid string) (map[string]*rg2.Node, error) {
+	nodes := []*rg2.Node{}
+	for {
+		for len(p.page) > 0 && (uid == "" || pagedNodeUID(p.page[0]) <= uid) {
+			nodes = append(nodes, p.page[0])
+			p.page = p.page[1:]
+		}
+		if len(p.page) > 0 || p.done {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	existing := make(map[string]*rg2.Node, len(nodes))
+	copies := make(map[string]int)
+	for _, node := range nodes {
+		if nodeUID := pagedNodeUID(node); nodeUID != "" && !db.IsPlaceholder(node.Properties) {
+			existing[nodeUID] = node
+			copies[nodeUID]++
+		}
+	}
+	for nodeUID, count := range copies {
+		if count > 1 {
+			// Same as a resync loading every node, all the copies are deleted and the resource is added again.
+			query := db.SanitizeQuery("MATCH (n {_uid:'%s'}) DELETE n", nodeUID)
+			if _, err := db.Store.Query(db.WithWrite(p.ctx), query); err != nil {
+				logger.Error("Error deleting duplicates for ", nodeUID, err)
+			}
+			logger.V(3).Infof("Deleted %d duplicates of UID %s", count-1, nodeUID)
+			p.duplicates += count - 1
+			delete(existing, nodeUID)
+		}
+	}
+	for nodeUID := range existing {
+		if _, ok := p.unchanged[nodeUID]; ok {
+			p.unchanged[nodeUID] = true
+			delete(existing, nodeUID)
+		}
+	}
+	return existing, nil
+}
+
+// Returns the unchanged resources that weren't found, sorted. Called once every page is read.
+func (p *resyncPager) missingUnchanged() []string {
+	missing := []string{}
+	for uid, found := range p.unchanged {
+		if !found {
+			missing = append(missing, uid)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func pagedUIDs(nodes map[string]*rg2.Node) []string {
+	uids := []string{}
+	for uid := range nodes {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	return uids
+}
+
+func Test_resyncPager(t *testing.T) {
+	useTestDatastore(t)
+	t.Cleanup(config.Snapshot())
+	config.Cfg.ResyncDiffPageSize = 2
+	ctx := context.Background()
+
+	_, err := db.Store.Query(ctx, "CREATE (:Pod {_uid:'c1/a', cluster:'c1'}), (:Pod {_uid:'c1/b', cluster:'c1'}), "+
+		"(:Pod {_uid:'c1/b', cluster:'c1'}), (:Pod {_uid:'c1/b', cluster:'c1'}), (:Pod {_uid:'c1/c', cluster:'c1'}), "+
+		"(:Pod {_uid:'c1/d', cluster:'c1', _placeholder:true}), (:Pod {_uid:'c1/e', cluster:'c1'}), "+
+		"(:Pod {_uid:'c1/f', cluster:'c1'}), (:Pod {_uid:'c2/a', cluster:'c2'})")
+	assert.NoError(t, err)
+
+	pager := newResyncPager(ctx, "c1", []string{"c1/c", "c1/z"})
+	existing, err := pager.until("c1/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1/a"}, pagedUIDs(existing), "The copies of c1/b across pages are all deleted.")
+	assert.Equal(t, 2, pager.duplicates)
+	assert.Equal(t, 5, computeNodeCount(ctx, "c1"))
+
+	existing, err = pager.until("c1/d")
+	assert.NoError(t, err)
+	assert.Empty(t, existing, "The unchanged resource and the placeholder are left out.")
+
+	existing, err = pager.until("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1/e", "c1/f"}, pagedUIDs(existing))
+	assert.Equal(t, []string{"c1/z"}, pager.missingUnchanged())
+}
+
+func Test_resyncCluster_paged(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	ctx := context.Background()
+
+	resync := func(pagedDiffNodes int) SyncResponse {
+		config.Cfg.ResyncDiffPageSize, config.Cfg.ResyncPagedDiffNodes = 2, pagedDiffNodes
+		useTestDatastore(t)
+		_, err := db.Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+			"(:Pod {_uid:'c1/a', kind:'pod', cluster:'c1', name:'a'}), "+
+			"(:Pod {_uid:'c1/b', kind:'pod', cluster:'c1', name:'b'}), (:Pod {_uid:'c1/c', kind:'pod', cluster:'c1'}), "+
+			"(:Pod {_uid:'c1/c', kind:'pod', cluster:'c1'}), (:Pod {_uid:'c1/d', kind:'pod', cluster:'c1'}), "+
+			"(:Pod {_uid:'c1/f', kind:'pod', cluster:'c1'})")
+		assert.NoError(t, err)
+		resources := []*db.Resource{
+			{UID: "c1/a", Kind: "Pod", Properties: map[string]interface{}{"kind": "pod", "cluster": "c1", "name": "a"}},
+			{UID: "c1/b", Kind: "Pod", Properties: map[string]interface{}{"kind": "pod", "cluster": "c1", "name": "b2"}},
+			{UID: "c1/c", Kind: "Pod", Properties: map[string]interface{}{"kind": "pod", "cluster": "c1"}},
+			{UID: "c1/e", Kind: "Pod", Properties: map[string]interface{}{"kind": "pod", "cluster": "c1"}},
+		}
+		stats, err := resyncCluster(ctx, "c1", resources, []string{"c1/d", "c1/z"}, []db.Edge{}, &SyncMetrics{})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, computeNodeCount(ctx, "c1"))
+		return stats
+	}
+
+	loaded := resync(0)
+	paged := resync(1)
+	assert.Equal(t, 2, paged.TotalAdded, "The duplicated c1/c and the new c1/e are added.")
+	assert.Equal(t, 1, paged.TotalUpdated)
+	assert.Equal(t, 1, paged.TotalDeleted)
+	assert.Equal(t, loaded.TotalAdded, paged.TotalAdded)
+	assert.Equal(t, loaded.TotalUpdated, paged.TotalUpdated)
+	assert.Equal(t, loaded.TotalDeleted, paged.TotalDeleted)
+	assert.Equal(t, loaded.AddErrors, paged.AddErrors)
+}
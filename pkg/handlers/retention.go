@@ -0,0 +1,59 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"time"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Drops the added resources already expired by the RETENTION_POLICIES, and the edges to them. Expired updated
+// resources are deleted instead, they are in the graph. The keepPerOwner limits are enforced by the reaper only.
+func filterExpiredResources(clusterName string, syncEvent *SyncEvent, now time.Time) {
+	policies := db.RetentionPolicies()
+	if len(policies) == 0 {
+		return
+	}
+	isExpired := func(r *db.Resource) bool {
+		for _, p := range policies {
+			if p.Matches(r.Properties) && p.Expired(r.Properties, now) {
+				return true
+			}
+		}
+		return false
+	}
+
+	dropped := make(map[string]bool)
+	added := make([]*db.Resource, 0, len(syncEvent.AddResources))
+	for _, r := range syncEvent.AddResources {
+		if isExpired(r) {
+			dropped[r.UID] = true
+			continue
+		}
+		added = append(added, r)
+	}
+	updated := make([]*db.Resource, 0, len(syncEvent.UpdateResources))
+	for _, r := range syncEvent.UpdateResources {
+		if isExpired(r) {
+			dropped[r.UID] = true
+			syncEvent.DeleteResources = append(syncEvent.DeleteResources,
+				DeleteResourceEvent{UID: r.UID, DeletedAt: now, Reason: "retention"})
+			continue
+		}
+		updated = append(updated, r)
+	}
+	if len(dropped) == 0 {
+		return
+	}
+	edges := make([]db.Edge, 0, len(syncEvent.AddEdges))
+	for _, e := range syncEvent.AddEdges {
+		if !dropped[e.SourceUID] && !dropped[e.DestUID] {
+			edges = append(edges, e)
+		}
+	}
+	logger.V(3).Infof("Dropped %d expired resources and %d edges from cluster %s", len(dropped),
+		len(syncEvent.AddEdges)-len(edges), clusterName)
+	syncEvent.AddResources, syncEvent.UpdateResources, syncEvent.AddEdges = added, updated, edges
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_filterExpiredResources(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.RetentionPolicies = `[{"kind": "Event", "maxAgeMinutes": 60}]`
+
+	syncEvent := SyncEvent{
+		AddResources: []*db.Resource{
+			{UID: "c1/e1", Properties: map[string]interface{}{"kind": "Event", "created": "2021-06-01T10:00:00Z"}},
+			{UID: "c1/e2", Properties: map[string]interface{}{"kind": "Event", "created": "2021-06-01T11:30:00Z"}},
+			{UID: "c1/pod", Properties: map[string]interface{}{"kind": "Pod", "created": "2021-06-01T10:00:00Z"}},
+		},
+		UpdateResources: []*db.Resource{
+			{UID: "c1/e3", Properties: map[string]interface{}{"kind": "Event", "created": "2021-06-01T09:00:00Z"}},
+		},
+		AddEdges: []db.Edge{
+			{SourceUID: "c1/e1", SourceKind: "Event", DestUID: "c1/pod", DestKind: "Pod", EdgeType: "refersTo"},
+			{SourceUID: "c1/e2", SourceKind: "Event", DestUID: "c1/pod", DestKind: "Pod", EdgeType: "refersTo"},
+		},
+	}
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	filterExpiredResources("c1", &syncEvent, now)
+
+	assert.Equal(t, 2, len(syncEvent.AddResources))
+	assert.Equal(t, "c1/e2", syncEvent.AddResources[0].UID)
+	assert.Empty(t, syncEvent.UpdateResources)
+	assert.Equal(t, []DeleteResourceEvent{{UID: "c1/e3", DeletedAt: now, Reason: "retention"}}, syncEvent.DeleteResources)
+	assert.Equal(t, 1, len(syncEvent.AddEdges))
+	assert.Equal(t, "c1/e2", syncEvent.AddEdges[0].SourceUID)
+}
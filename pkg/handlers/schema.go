@@ -0,0 +1,36 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Schema responds with the kinds, their properties and the edge types in the graph, for the search autocomplete.
+// Use the kinds parameter to get only some kinds. It's kept as resources are written, so it doesn't query the graph.
+func Schema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	schema := db.CurrentSchema()
+	if kinds := config.ParseList(r.URL.Query().Get("kinds")); len(kinds) > 0 {
+		wanted := make(map[string]bool, len(kinds))
+		for _, kind := range kinds {
+			wanted[strings.ToLower(kind)] = true
+		}
+		filtered := make([]db.SchemaKind, 0, len(kinds))
+		for _, kind := range schema.Kinds {
+			if wanted[kind.Kind] {
+				filtered = append(filtered, kind)
+			}
+		}
+		schema.Kinds = filtered
+	}
+	if encodeError := json.NewEncoder(w).Encode(schema); encodeError != nil {
+		logger.Error("Error responding to Schema: ", encodeError)
+	}
+}
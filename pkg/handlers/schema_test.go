@@ -0,0 +1,26 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Schema(t *testing.T) {
+	db.ObserveEdgeType("ownedBy")
+
+	response := httptest.NewRecorder()
+	Schema(response, httptest.NewRequest("GET", "/aggregator/schema?kinds=NoSuchKind", nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	var schema db.Schema
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&schema))
+	assert.Empty(t, schema.Kinds)
+	assert.Contains(t, schema.EdgeTypes, "ownedBy")
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/rbac"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Request body for Search.
+type SearchRequest struct {
+	Search string   `json:"search"` // Saved search in the console syntax, e.g. "kind:pod namespace:default"
+	Limit  int      `json:"limit"`  // Max number of items to return, capped by SEARCH_RESULT_LIMIT.
+	Facets []string `json:"facets"` // Properties to count the matching resources by, e.g. kind, cluster or label.
+	// Sorts the items and returns a nextCursor for the next page when more resources match.
+	Paginate bool   `json:"paginate"`
+	Cursor   string `json:"cursor"` // nextCursor of the previous page, implies paginate.
+	SortBy   string `json:"sortBy"` // Property the pages are sorted by, then the UID. Defaults to _uid.
+}
+
+// Response body for Search.
+type SearchResponse struct {
+	Items     []map[string]interface{} `json:"items"`     // Properties of the matching resources.
+	Truncated bool                     `json:"truncated"` // More resources matched than the limit.
+	// Cursor for the next page of a paginated search, only when it was truncated.
+	NextCursor string `json:"nextCursor,omitempty"`
+	// Number of resources matching the search by value of each requested facet, highest first.
+	Facets map[string][]db.FacetValue `json:"facets,omitempty"`
+	// Queries run for the search, only with ?debugQueries=true and the admin token.
+	Queries []db.TracedQuery `json:"queries,omitempty"`
+}
+
+// Returns the limit to apply to a search, the requested one capped by SEARCH_RESULT_LIMIT.
+func searchLimit(requested int) int {
+	if requested <= 0 || (config.Cfg.SearchResultLimit > 0 && requested > config.Cfg.SearchResultLimit) {
+		return config.Cfg.SearchResultLimit
+	}
+	return requested
+}
+
+// Writes the error from a search query with the matching status code.
+func searchError(w http.ResponseWriter, err error) {
+	var costErr db.QueryCostError
+	switch {
+	case errors.As(err, &costErr), errors.Is(err, db.ErrInvalidEdgeType), errors.Is(err, db.ErrInvalidDirection),
+		errors.Is(err, db.ErrInvalidFacet), errors.Is(err, db.ErrInvalidGroupBy), errors.Is(err, db.ErrInvalidCursor):
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_SEARCH, err.Error(), nil)
+	case errors.Is(err, db.ErrSearchTimeout):
+		respondError(w, http.StatusGatewayTimeout, ERROR_SEARCH_TIMEOUT, err.Error(), nil)
+	default:
+		logger.Warning("Error running search query: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+	}
+}
+
+// Returns the resources the user of the request can see when RBAC_FILTER is enabled, nil for every resource.
+// The user is in the Impersonate-User and Impersonate-Group headers, set by the search API in front of the aggregator.
+// The headers are only trusted on the INTERNAL_ADDRESS listeners or with the admin token, the collectors of the
+// managed clusters connect to AGGREGATOR_ADDRESS and could claim to be any user.
+func searchAccess(r *http.Request) (*db.ResourceAccess, int, error) {
+	if config.Cfg.RBACFilter != "true" {
+		return nil, http.StatusOK, nil
+	}
+	user := rbac.User{Name: r.Header.Get("Impersonate-User"), Groups: r.Header.Values("Impersonate-Group")}
+	if user.Name == "" {
+		return nil, http.StatusUnauthorized, withErrorCode(errors.New(
+			"Impersonate-User header is required when RBAC_FILTER is enabled."), ERROR_IMPERSONATION_REQUIRED, nil)
+	}
+	if !internalRequest(r) && !isAdminRequest(r) {
+		logger.Warning("Rejected request impersonating ", user.Name, " without the admin token for ", r.URL.Path)
+		return nil, http.StatusForbidden, withErrorCode(errors.New(
+			"Impersonate-User header is only accepted on INTERNAL_ADDRESS or with the admin token."),
+			ERROR_IMPERSONATION_UNTRUSTED, nil)
+	}
+	access, err := rbac.Access(user)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	return &access, http.StatusOK, nil
+}
+
+// Search runs a saved search against the graph and returns the matching resources, bounded by the search limits.
+func Search(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var request SearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Warning("Error decoding body of search request: ", err)
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+	access, status, err := searchAccess(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	ctx, trace, status, err := debugQueries(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	kindLabels, err := searchKindLabels(ctx)
+	if err != nil {
+		logger.Warning("Error reading node labels for search request: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	compiled, err := db.CompileSearchWithKindLabels(request.Search, kindLabels)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_SEARCH, err.Error(), nil)
+		return
+	}
+	if access != nil {
+		compiled = compiled.WithAccess(*access)
+	}
+
+	query := compiled.Query
+	paginate := request.Paginate || request.Cursor != ""
+	if paginate {
+		if query, err = searchPageQuery(request, compiled); err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_SEARCH, err.Error(), nil)
+			return
+		}
+	}
+
+	limit := searchLimit(request.Limit)
+	queryLimit := 0
+	if limit > 0 {
+		queryLimit = limit + 1 // One more to know if the results were truncated.
+	}
+	start := time.Now()
+	result, err := db.SearchQuery(ctx, query, queryLimit)
+	if err != nil {
+		searchError(w, err)
+		return
+	}
+	observeSearchFilters(compiled, time.Since(start))
+	response := SearchResponse{Items: []map[string]interface{}{}}
+	for result.Next() {
+		if limit > 0 && len(response.Items) == limit {
+			response.Truncated = true
+			break
+		}
+		if node, ok := result.Record().GetByIndex(0).(*rg2.Node); ok {
+			response.Items = append(response.Items, node.Properties)
+		}
+	}
+	if paginate && response.Truncated {
+		last := response.Items[len(response.Items)-1]
+		response.NextCursor = db.NewSearchCursor(request.Search, request.SortBy, last).Encode()
+	}
+
+	if len(request.Facets) > 0 {
+		if response.Facets, err = db.SearchFacets(ctx, compiled, request.Facets, limit); err != nil {
+			searchError(w, err)
+			return
+		}
+	}
+	response.Queries = tracedQueries(trace)
+
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to Search: ", encodeError)
+	}
+}
+
+// Returns the query for the page of a paginated search, after the cursor of the request.
+func searchPageQuery(request SearchRequest, compiled db.CompiledSearch) (string, error) {
+	var cursor *db.SearchCursor
+	if request.Cursor != "" {
+		decoded, err := db.DecodeSearchCursor(request.Cursor, request.Search, request.SortBy)
+		if err != nil {
+			return "", err
+		}
+		cursor = &decoded
+	}
+	return compiled.PageQuery(request.SortBy, cursor)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchPagination(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.SearchResultLimit = 2
+	_, err := db.Store.Query(context.Background(), "CREATE (:Pod {_uid:'c1/p3', kind:'pod', name:'a'}), "+
+		"(:Pod {_uid:'c1/p1', kind:'pod', name:'c'}), (:Pod {_uid:'c1/p2', kind:'pod', name:'b'})")
+	assert.NoError(t, err)
+
+	search := func(body string) (*httptest.ResponseRecorder, SearchResponse) {
+		w := httptest.NewRecorder()
+		Search(w, httptest.NewRequest("POST", "/aggregator/search", strings.NewReader(body)))
+		var response SearchResponse
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		}
+		return w, response
+	}
+
+	// The limit over SEARCH_RESULT_LIMIT is capped.
+	_, first := search(`{"search": "kind:pod", "paginate": true, "sortBy": "name", "limit": 10}`)
+	assert.True(t, first.Truncated)
+	assert.Len(t, first.Items, 2)
+	assert.Equal(t, "c1/p3", first.Items[0]["_uid"])
+	assert.Equal(t, "c1/p2", first.Items[1]["_uid"])
+	assert.NotEmpty(t, first.NextCursor)
+
+	w, second := search(`{"search": "kind:pod", "sortBy": "name", "cursor": "` + first.NextCursor + `"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, second.Truncated)
+	assert.Empty(t, second.NextCursor)
+	if assert.Len(t, second.Items, 1) {
+		assert.Equal(t, "c1/p1", second.Items[0]["_uid"])
+	}
+
+	w, _ = search(`{"search": "kind:pod", "sortBy": "_uid", "cursor": "` + first.NextCursor + `"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "The cursor is sorted by name")
+
+	_, unsorted := search(`{"search": "kind:pod"}`)
+	assert.True(t, unsorted.Truncated)
+	assert.Empty(t, unsorted.NextCursor, "Only paginated searches have a cursor")
+}
+
+func Test_searchAccess_impersonation(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.RBACFilter, config.Cfg.AdminToken = "true", "secret"
+	request := func(internal bool, token string) *http.Request {
+		r := httptest.NewRequest("POST", "/aggregator/search", nil)
+		r.Header.Set("Impersonate-User", "alice")
+		r.Header.Add("Impersonate-Group", "system:masters")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if internal {
+			r = r.WithContext(WithInternalListener(r.Context()))
+		}
+		return r
+	}
+
+	// A collector on AGGREGATOR_ADDRESS can't claim to be any user.
+	_, status, err := searchAccess(request(false, ""))
+	assert.Equal(t, http.StatusForbidden, status)
+	var coded *codedError
+	assert.True(t, errors.As(err, &coded))
+	assert.Equal(t, ERROR_IMPERSONATION_UNTRUSTED, coded.code)
+	_, status, _ = searchAccess(request(false, "wrong"))
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Trusted, the access is read from the RBAC cache.
+	for _, r := range []*http.Request{request(true, ""), request(false, "secret")} {
+		_, status, _ = searchAccess(r)
+		assert.NotEqual(t, http.StatusForbidden, status)
+	}
+}
+
+func TestCompileSearch_rbac(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.RBACFilter = "true"
+
+	// The estimated count would tell how many resources the user can't see.
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"search": "kind:pod"}`)
+	CompileSearch(w, httptest.NewRequest("POST", "/aggregator/search/compile", body))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// A raw sync payload captured to reproduce how it was indexed.
+type SyncCapture struct {
+	ID             int64     `json:"id"`
+	Received       time.Time `json:"received"`
+	ClearAll       bool      `json:"clearAll"`
+	Status         int       `json:"status"`         // Status the sync was answered with.
+	Size           int       `json:"size"`           // Bytes of the payload.
+	CompressedSize int       `json:"compressedSize"` // Bytes kept in memory.
+	payload        []byte    // Gzip compressed.
+}
+
+var (
+	syncCaptures      = make(map[string][]SyncCapture) // Last SYNC_CAPTURE_COUNT syncs of each cluster, oldest first.
+	syncCapturesMutex = sync.RWMutex{}
+	lastSyncCaptureID int64
+)
+
+// Compresses the body of a sync as it's read. Stops copying once the compressed payload is larger than
+// SYNC_CAPTURE_MAX_BYTES, so a large sync isn't held in memory a second time.
+type syncCaptureWriter struct {
+	compressed bytes.Buffer
+	gzip       *gzip.Writer // Nil once the payload is too large or failed to compress.
+	size       int          // Bytes of the payload.
+}
+
+func (c *syncCaptureWriter) Write(p []byte) (int, error) {
+	c.size += len(p)
+	if c.gzip == nil {
+		return len(p), nil
+	}
+	if _, err := c.gzip.Write(p); err != nil {
+		logger.Warning("Error compressing the sync payload: ", err)
+		c.drop()
+	} else if c.compressed.Len() > config.Cfg.SyncCaptureMaxBytes {
+		c.drop()
+	}
+	return len(p), nil // The sync is read whether it's captured or not.
+}
+
+// Releases the compressed payload, it won't be captured.
+func (c *syncCaptureWriter) drop() {
+	c.gzip = nil
+	c.compressed = bytes.Buffer{}
+}
+
+// Completes the compressed payload and returns it, false when it's too large or failed to compress.
+func (c *syncCaptureWriter) payload() ([]byte, bool) {
+	if c.gzip == nil {
+		return nil, false
+	}
+	if err := c.gzip.Close(); err != nil {
+		logger.Warning("Error compressing the sync payload: ", err)
+		c.drop()
+		return nil, false
+	}
+	if c.compressed.Len() > config.Cfg.SyncCaptureMaxBytes {
+		c.drop()
+		return nil, false
+	}
+	return c.compressed.Bytes(), true
+}
+
+// Returns the body to read the sync from, compressing what's read into the returned writer when SYNC_CAPTURE_COUNT
+// is set. The writer is nil when the syncs aren't captured.
+func captureSyncBody(body io.Reader) (io.Reader, *syncCaptureWriter) {
+	if config.Cfg.SyncCaptureCount <= 0 {
+		return body, nil
+	}
+	captured := &syncCaptureWriter{}
+	captured.gzip = gzip.NewWriter(&captured.compressed)
+	return io.TeeReader(body, captured), captured
+}
+
+// Keeps the compressed payload of a sync, dropping the oldest capture of the cluster beyond SYNC_CAPTURE_COUNT.
+// Payloads larger than SYNC_CAPTURE_MAX_BYTES once compressed aren't kept.
+func captureSync(clusterName string, captured *syncCaptureWriter, clearAll bool, status int, received time.Time) {
+	payload, ok := captured.payload()
+	if !ok {
+		logger.V(2).Infof("Not capturing the sync from cluster %s, its %d bytes compress to more than "+
+			"SYNC_CAPTURE_MAX_BYTES.", clusterName, captured.size)
+		return
+	}
+
+	capture := SyncCapture{
+		ID:             atomic.AddInt64(&lastSyncCaptureID, 1),
+		Received:       received,
+		ClearAll:       clearAll,
+		Status:         status,
+		Size:           captured.size,
+		CompressedSize: len(payload),
+		payload:        payload,
+	}
+	syncCapturesMutex.Lock()
+	defer syncCapturesMutex.Unlock()
+	captures := append(syncCaptures[clusterName], capture)
+	if len(captures) > config.Cfg.SyncCaptureCount {
+		captures = captures[len(captures)-config.Cfg.SyncCaptureCount:]
+	}
+	syncCaptures[clusterName] = captures
+}
+
+// Returns the capture of the cluster with the ID, false when it isn't kept anymore.
+func getSyncCapture(clusterName string, id int64) (SyncCapture, bool) {
+	syncCapturesMutex.RLock()
+	defer syncCapturesMutex.RUnlock()
+	for _, capture := range syncCaptures[clusterName] {
+		if capture.ID == id {
+			return capture, true
+		}
+	}
+	return SyncCapture{}, false
+}
+
+// Returned by replaySync for a captured payload that isn't a valid sync, e.g. the body of a rejected sync.
+var errInvalidCapture = errors.New("Invalid sync capture")
+
+// Result of replaying a captured sync into a replay graph.
+type ReplayResponse struct {
+	Graph   string
+	Capture int64
+	SyncResponse
+}
+
+// Applies a captured sync to the replay graph of the context, with the same UID normalization, excluded kinds,
+// owner edges and property hooks as the sync. The resources of a captured resync are replaced, the unchanged ones
+// it left out aren't in the payload. The revisions of the updates aren't checked.
+func replaySync(ctx context.Context, clusterName string, capture SyncCapture) (SyncResponse, error) {
+	response := SyncResponse{Version: config.AGGREGATOR_API_VERSION}
+	reader, err := gzip.NewReader(bytes.NewReader(capture.payload))
+	if err != nil {
+		return response, fmt.Errorf("%w: %s", errInvalidCapture, err)
+	}
+	var syncEvent SyncEvent
+	if err := decodeSyncEvent(reader, &syncEvent); err != nil {
+		return response, fmt.Errorf("%w: %s", errInvalidCapture, err)
+	}
+	response.RequestId = syncEvent.RequestId
+
+	rejected := prepareSyncEvent(clusterName, &syncEvent)
+	addClusterProperties(clusterName, syncEvent.AddResources)
+	addClusterProperties(clusterName, syncEvent.UpdateResources)
+	if err := db.PrepareReplayCluster(ctx, clusterName, syncEvent.ClearAll); err != nil {
+		return response, err
+	}
+	// Completes the response with the errors of the rejected resources and edges.
+	respond := func(err error) (SyncResponse, error) {
+		appendRejected(&response, rejected)
+		return response, err
+	}
+
+	insertResponse := db.ChunkedInsert(ctx, syncEvent.AddResources, clusterName)
+	response.TotalAdded = insertResponse.SuccessfulResources
+	response.AddErrors = processSyncErrors(insertResponse.ResourceErrors, "inserted")
+	if err := insertResponse.ConnectionError; err != nil {
+		return respond(err)
+	}
+	updateResponse := db.ChunkedUpdate(ctx, syncEvent.UpdateResources)
+	response.TotalUpdated = updateResponse.SuccessfulResources
+	response.UpdateErrors = processSyncErrors(updateResponse.ResourceErrors, "updated")
+	if err := updateResponse.ConnectionError; err != nil {
+		return respond(err)
+	}
+	deleteResponse := db.ChunkedDelete(ctx, deletedUIDs(syncEvent))
+	response.TotalDeleted = deleteResponse.SuccessfulResources
+	response.DeleteErrors = processSyncErrors(deleteResponse.ResourceErrors, "deleted")
+	if err := deleteResponse.ConnectionError; err != nil {
+		return respond(err)
+	}
+	insertEdgeResponse := db.ChunkedInsertEdge(ctx, syncEvent.AddEdges, clusterName)
+	response.TotalEdgesAdded = insertEdgeResponse.SuccessfulResources
+	response.AddEdgeErrors = processSyncErrors(insertEdgeResponse.ResourceErrors, "inserted by edge")
+	if err := insertEdgeResponse.ConnectionError; err != nil {
+		return respond(err)
+	}
+	deleteEdgeResponse := db.ChunkedDeleteEdge(ctx, syncEvent.DeleteEdges, clusterName)
+	response.TotalEdgesDeleted = deleteEdgeResponse.SuccessfulResources
+	response.DeleteEdgeErrors = processSyncErrors(deleteEdgeResponse.ResourceErrors, "removed by edge")
+	if err := deleteEdgeResponse.ConnectionError; err != nil {
+		return respond(err)
+	}
+
+	response.TotalResources = computeNodeCount(ctx, clusterName)
+	response.TotalEdges = computeIntraEdges(ctx, clusterName)
+	return respond(nil)
+}
+
+// Returns the capture in the request path. Responds with the error and returns false when it isn't kept.
+func requestedSyncCapture(w http.ResponseWriter, r *http.Request) (SyncCapture, bool) {
+	clusterName := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(mux.Vars(r)["capture"], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, "Invalid capture ID: "+err.Error(),
+			map[string]string{"parameter": "capture"})
+		return SyncCapture{}, false
+	}
+	capture, ok := getSyncCapture(clusterName, id)
+	if !ok {
+		respondError(w, http.StatusNotFound, ERROR_CAPTURE_NOT_FOUND,
+			fmt.Sprintf("Capture %d of cluster %s not found", id, clusterName),
+			map[string]string{"cluster": clusterName, "capture": strconv.FormatInt(id, 10)})
+	}
+	return capture, ok
+}
+
+// SyncCaptures responds with the syncs captured for a cluster, oldest first, without their payloads.
+func SyncCaptures(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	syncCapturesMutex.RLock()
+	captures := append([]SyncCapture{}, syncCaptures[clusterName]...)
+	syncCapturesMutex.RUnlock()
+	if encodeError := json.NewEncoder(w).Encode(captures); encodeError != nil {
+		logger.Error("Error responding to SyncCaptures: ", encodeError)
+	}
+}
+
+// DownloadSyncCapture responds with the gzip compressed payload of a captured sync, as the collector sent it.
+func DownloadSyncCapture(w http.ResponseWriter, r *http.Request) {
+	capture, ok := requestedSyncCapture(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"%s-sync-%d.json.gz\"", mux.Vars(r)["id"], capture.ID))
+	if _, err := w.Write(capture.payload); err != nil {
+		logger.Error("Error responding to DownloadSyncCapture: ", err)
+	}
+}
+
+// ReplaySyncCapture applies a captured sync to a test graph, REPLAY_GRAPH_SUFFIX appended to GRAPH_NAME unless the
+// graph parameter is set, and responds with the stats of the replay and the queries it ran. Use reset=true to
+// delete the test graph first.
+func ReplaySyncCapture(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	capture, ok := requestedSyncCapture(w, r)
+	if !ok {
+		return
+	}
+	graph, err := db.ReplayGraph(r.URL.Query().Get("graph"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, err.Error(),
+			map[string]string{"parameter": "graph"})
+		return
+	}
+	ctx := db.WithLane(db.WithGraph(r.Context(), graph), db.BulkLane)
+	if r.URL.Query().Get("reset") == "true" {
+		if err := db.ResetReplayGraph(ctx, graph); err != nil {
+			respondError(w, http.StatusInternalServerError, ERROR_INTERNAL,
+				"Error deleting the replay graph: "+err.Error(), nil)
+			return
+		}
+	}
+
+	clusterName := mux.Vars(r)["id"]
+	logger.Infof("Replaying sync capture %d of cluster %s into graph %s", capture.ID, clusterName, graph)
+	ctx, trace := db.WithQueryTrace(ctx)
+	syncResponse, err := replaySync(ctx, clusterName, capture)
+	syncResponse.Queries = trace.Queries()
+	status := http.StatusOK
+	if err != nil {
+		logger.Warning("Error replaying sync capture of cluster ", clusterName, ": ", err)
+		switch {
+		case errors.Is(err, errInvalidCapture):
+			status = http.StatusBadRequest
+		case db.IsRetryable(err):
+			status = http.StatusServiceUnavailable
+		default:
+			status = http.StatusInternalServerError
+		}
+	}
+	w.WriteHeader(status)
+	response := ReplayResponse{Graph: graph, Capture: capture.ID, SyncResponse: syncResponse}
+	if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+		logger.Error("Error responding to ReplaySyncCapture: ", encodeError)
+	}
+}
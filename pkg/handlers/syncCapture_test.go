@@ -0,0 +1,150 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+const capturedSync = `{"addResources": [
+	{"kind": "Pod", "uid": "replayed-cluster/p1", "properties": {"kind": "Pod", "name": "web"}},
+	{"kind": "Pod", "uid": "replayed-cluster/p2", "properties": {"kind": "Pod", "name": "db"}}],
+	"addEdges": [{"SourceUID": "replayed-cluster/p1", "SourceKind": "Pod", "DestUID": "replayed-cluster/p2",
+		"DestKind": "Pod", "EdgeType": "usedBy"}]}`
+
+// Returns the capture of the payload, as read by a sync.
+func readSyncCapture(t *testing.T, payload string) *syncCaptureWriter {
+	body, captured := captureSyncBody(strings.NewReader(payload))
+	var syncEvent SyncEvent
+	assert.NoError(t, decodeSyncEvent(body, &syncEvent))
+	return captured
+}
+
+func Test_captureSync(t *testing.T) {
+	cluster := "captured-cluster"
+	t.Cleanup(config.Snapshot())
+	defer func() {
+		syncCapturesMutex.Lock()
+		delete(syncCaptures, cluster)
+		syncCapturesMutex.Unlock()
+	}()
+
+	config.Cfg.SyncCaptureCount = 0
+	_, captured := captureSyncBody(strings.NewReader(capturedSync))
+	assert.Nil(t, captured, "Disabled by default")
+
+	config.Cfg.SyncCaptureCount, config.Cfg.SyncCaptureMaxBytes = 2, 1024
+	received := time.Now()
+	for i := 0; i < 3; i++ {
+		captureSync(cluster, readSyncCapture(t, capturedSync), i == 0, http.StatusOK, received)
+	}
+	syncCapturesMutex.RLock()
+	captures := syncCaptures[cluster]
+	syncCapturesMutex.RUnlock()
+	if assert.Len(t, captures, 2, "Only the last SYNC_CAPTURE_COUNT syncs are kept") {
+		assert.False(t, captures[0].ClearAll)
+		assert.Equal(t, len(capturedSync), captures[1].Size)
+		assert.Less(t, captures[1].CompressedSize, captures[1].Size)
+		_, ok := getSyncCapture(cluster, captures[1].ID)
+		assert.True(t, ok)
+		_, ok = getSyncCapture(cluster, captures[0].ID-1)
+		assert.False(t, ok, "The oldest capture was dropped")
+
+		reader, err := gzip.NewReader(strings.NewReader(string(captures[1].payload)))
+		assert.NoError(t, err)
+		payload, _ := ioutil.ReadAll(reader)
+		assert.Equal(t, capturedSync, string(payload), "The payload is kept as the collector sent it")
+	}
+
+	config.Cfg.SyncCaptureMaxBytes = 10
+	captureSync(cluster, readSyncCapture(t, capturedSync), false, http.StatusOK, received)
+	syncCapturesMutex.RLock()
+	assert.Equal(t, captures[1].ID, syncCaptures[cluster][1].ID, "Payloads over the max bytes aren't kept")
+	syncCapturesMutex.RUnlock()
+}
+
+func Test_ReplaySyncCapture(t *testing.T) {
+	cluster := "replayed-cluster"
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.AdminToken, config.Cfg.SyncCaptureCount, config.Cfg.SyncCaptureMaxBytes = "secret", 1, 1024
+	defer func() {
+		syncCapturesMutex.Lock()
+		delete(syncCaptures, cluster)
+		syncCapturesMutex.Unlock()
+	}()
+	captureSync(cluster, readSyncCapture(t, capturedSync), false, http.StatusOK, time.Now())
+	capture := syncCaptures[cluster][0]
+
+	request := func(handler http.HandlerFunc, method, path, token string,
+		vars map[string]string) *httptest.ResponseRecorder {
+		r := mux.SetURLVars(httptest.NewRequest(method, path, nil), vars)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		RequireAdmin(handler)(w, r) // As served in main.go.
+		return w
+	}
+	vars := map[string]string{"id": cluster, "capture": strconv.FormatInt(capture.ID, 10)}
+	path := "/aggregator/clusters/" + cluster + "/captures/" + vars["capture"]
+
+	assert.Equal(t, http.StatusUnauthorized, request(DownloadSyncCapture, "GET", path, "", vars).Code)
+	// The admin listener without ADMIN_TOKEN.
+	config.Cfg.AdminToken, config.Cfg.AdminAddress = "", ":3011"
+	assert.Equal(t, http.StatusOK, request(DownloadSyncCapture, "GET", path, "", vars).Code)
+	config.Cfg.AdminToken, config.Cfg.AdminAddress = "secret", ""
+	w := request(SyncCaptures, "GET", "/aggregator/clusters/"+cluster+"/captures", "secret",
+		map[string]string{"id": cluster})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var captures []SyncCapture
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&captures))
+	assert.Len(t, captures, 1)
+
+	w = request(DownloadSyncCapture, "GET", path, "secret", vars)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	assert.Equal(t, capture.payload, w.Body.Bytes())
+	assert.Equal(t, http.StatusNotFound, request(DownloadSyncCapture, "GET", path, "secret",
+		map[string]string{"id": "other-cluster", "capture": vars["capture"]}).Code)
+
+	assert.Equal(t, http.StatusBadRequest,
+		request(ReplaySyncCapture, "POST", path+"/replay?graph=search-db", "secret", vars).Code,
+		"The search index can't be replayed into")
+	w = request(ReplaySyncCapture, "POST", path+"/replay?reset=true", "secret", vars)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response ReplayResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "search-db-replay", response.Graph)
+	assert.Equal(t, 2, response.TotalAdded)
+	assert.Equal(t, 1, response.TotalEdgesAdded)
+	assert.Equal(t, 2, response.TotalResources)
+	assert.NotEmpty(t, response.Queries)
+
+	replayed, err := db.Store.Query(db.WithGraph(context.Background(), "search-db-replay"),
+		"MATCH (n {cluster: 'replayed-cluster'}) RETURN count(n)")
+	assert.NoError(t, err)
+	assert.True(t, replayed.Next())
+	assert.Equal(t, 2, replayed.Record().GetByIndex(0))
+	primary, err := db.Store.Query(context.Background(), "MATCH (n {cluster: 'replayed-cluster'}) RETURN count(n)")
+	assert.NoError(t, err)
+	assert.True(t, primary.Next())
+	assert.Equal(t, 0, primary.Record().GetByIndex(0), "The search index isn't changed")
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Serializes the sync requests from a cluster and tracks its sync epoch.
+// The epoch changes on every resync. Deltas carry the epoch of the last resync the collector saw,
+// so a delta built against the state before a resync is detected as stale and rejected.
+// With SYNC_LOCKS=redis the lock is also taken in redis and the epoch is kept there, so the syncs of a cluster are
+// serialized across the replicas of the aggregator.
+type clusterSyncState struct {
+	lock  chan struct{} // Holds one token while a sync for the cluster is being processed.
+	epoch int64         // Written atomically while holding the lock, so currentEpoch can read it without the lock.
+	// 1 when a resync was requested from the collector, its next delta is rejected. Accessed atomically.
+	resyncRequested int32
+	redisLock       *db.SyncLock  // Held with the lock in redis mode.
+	stopRenewal     chan struct{} // Closed by unlock to stop renewing the redis lock.
+	renewalDone     chan struct{}
+	cancel          context.CancelFunc // Cancels the context of the sync holding the lock.
+}
+
+// Returns true when the syncs are locked in redis, see SYNC_LOCKS.
+func redisSyncLocks() bool {
+	return config.Cfg.SyncLocks == "redis"
+}
+
+func syncLockTTL() time.Duration {
+	ttl := time.Duration(config.Cfg.SyncLockTTLMS) * time.Millisecond
+	if ttl <= 0 {
+		ttl = time.Duration(config.DEFAULT_SYNC_LOCK_TTL_MS) * time.Millisecond
+	}
+	return ttl
+}
+
+var (
+	clusterSyncStates      = make(map[string]*clusterSyncState)
+	clusterSyncStatesMutex = sync.Mutex{}
+)
+
+func getClusterSyncState(clusterName string) *clusterSyncState {
+	clusterSyncStatesMutex.Lock()
+	defer clusterSyncStatesMutex.Unlock()
+	state, ok := clusterSyncStates[clusterName]
+	if !ok {
+		state = &clusterSyncState{lock: make(chan struct{}, 1)}
+		clusterSyncStates[clusterName] = state
+	}
+	return state
+}
+
+// Waits until no other sync for the cluster is in progress, or the context is done. Returns the context for the
+// writes of the sync, canceled when the redis lock is lost so a replica that lost the lock stops writing.
+// The caller must call unlock() when the sync completes.
+func lockClusterSync(ctx context.Context, clusterName string) (context.Context, *clusterSyncState, error) {
+	state := getClusterSyncState(clusterName)
+	select {
+	case state.lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	var lockCtx context.Context
+	lockCtx, state.cancel = context.WithCancel(ctx)
+	if !redisSyncLocks() {
+		return lockCtx, state, nil
+	}
+	if err := state.lockRedis(ctx, clusterName); err != nil {
+		state.cancel()
+		<-state.lock
+		return nil, nil, err
+	}
+	return lockCtx, state, nil
+}
+
+// Takes the redis lock of the cluster and loads its epoch, held until unlock. Must be called while holding the lock.
+func (s *clusterSyncState) lockRedis(ctx context.Context, clusterName string) error {
+	ttl := syncLockTTL()
+	lock, err := db.AcquireSyncLock(ctx, clusterName, ttl)
+	if err != nil {
+		return err
+	}
+	epoch, resyncRequested, err := db.SyncEpoch(ctx, clusterName)
+	if err != nil {
+		releaseSyncLock(lock)
+		return err
+	}
+	atomic.StoreInt64(&s.epoch, epoch)
+	requested := int32(0)
+	if resyncRequested {
+		requested = 1
+	}
+	atomic.StoreInt32(&s.resyncRequested, requested)
+	s.redisLock, s.stopRenewal, s.renewalDone = lock, make(chan struct{}), make(chan struct{})
+	go renewSyncLock(lock, ttl, s.cancel, s.stopRenewal, s.renewalDone)
+	return nil
+}
+
+// Extends the redis lock every third of its ttl until stopped, or the lock is lost and the sync is canceled.
+func renewSyncLock(lock *db.SyncLock, ttl time.Duration, cancelSync context.CancelFunc, stop <-chan struct{},
+	done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+		err := lock.Extend(ctx, ttl)
+		cancel()
+		if err == db.ErrSyncLockLost {
+			logger.Warningf("Lost the sync lock of cluster %s with token %d, another replica may be syncing it. "+
+				"Canceling the sync.", lock.Cluster, lock.Token)
+			cancelSync()
+			return
+		} else if err != nil {
+			logger.Warningf("Error extending the sync lock of cluster %s: %s", lock.Cluster, err)
+		}
+	}
+}
+
+func releaseSyncLock(lock *db.SyncLock) {
+	ctx, cancel := context.WithTimeout(context.Background(), syncLockTTL())
+	defer cancel()
+	if err := lock.Release(ctx); err != nil {
+		logger.Warningf("Error releasing the sync lock of cluster %s with token %d: %s", lock.Cluster, lock.Token, err)
+	}
+}
+
+func (s *clusterSyncState) unlock() {
+	if s.redisLock != nil {
+		close(s.stopRenewal)
+		<-s.renewalDone
+		releaseSyncLock(s.redisLock)
+		s.redisLock = nil
+	}
+	s.cancel()
+	<-s.lock
+}
+
+// Fails with db.ErrSyncLockLost when another replica took the redis lock since, so a sync isn't committed by a
+// replica that lost the lock. Must be called while holding the lock.
+func (s *clusterSyncState) checkLock(ctx context.Context) error {
+	if s.redisLock == nil {
+		return nil
+	}
+	return s.redisLock.Check(ctx)
+}
+
+// Saves the epoch started by a resync, or adopted from a delta, in redis mode, fails with db.ErrSyncLockLost when another replica took the
+// lock since. Must be called while holding the lock.
+func (s *clusterSyncState) saveEpoch(ctx context.Context) error {
+	if s.redisLock == nil {
+		return nil
+	}
+	return s.redisLock.SetEpoch(ctx, s.epoch)
+}
+
+// Starts a new epoch for a resync. Must be called while holding the lock.
+// Epochs are based on time so they keep increasing when the aggregator restarts.
+func (s *clusterSyncState) nextEpoch() int64 {
+	next := time.Now().UnixNano()
+	if next <= s.epoch {
+		next = s.epoch + 1
+	}
+	atomic.StoreInt64(&s.epoch, next)
+	return next
+}
+
+// Returns the current epoch without waiting for the sync in progress.
+func (s *clusterSyncState) currentEpoch() int64 {
+	return atomic.LoadInt64(&s.epoch)
+}
+
+// Returns the current epoch of the cluster, from redis in redis mode since another replica may have synced it.
+func clusterEpoch(ctx context.Context, clusterName string) int64 {
+	if !redisSyncLocks() {
+		return getClusterSyncState(clusterName).currentEpoch()
+	}
+	epoch, _, err := db.SyncEpoch(ctx, clusterName)
+	if err != nil {
+		logger.Warningf("Error reading the sync epoch of cluster %s: %s", clusterName, err)
+	}
+	return epoch
+}
+
+// Returns true if a delta with the given epoch was built against an older resync.
+// Deltas without an epoch are from collectors that don't support the handshake and are always accepted.
+// Must be called while holding the lock.
+func (s *clusterSyncState) isStale(epoch int64) bool {
+	return epoch != 0 && epoch != s.epoch
+}
+
+// Applies the epoch handshake to a sync event. A resync starts a new epoch, a delta must carry the current one, or
+// sets it when it's unknown. Returns the epoch to send back to the collector and false if the delta is stale and must
+// be rejected.
+// Must be called while holding the lock.
+func (s *clusterSyncState) checkEpoch(clusterName string, syncEvent *SyncEvent) (int64, bool) {
+	if syncEvent.ClearAll {
+		atomic.StoreInt32(&s.resyncRequested, 0)
+		return s.nextEpoch(), true
+	}
+	if atomic.LoadInt32(&s.resyncRequested) == 1 {
+		logger.Warningf("Rejecting delta from cluster %s, a resync was requested.", clusterName)
+		return s.epoch, false
+	}
+	if s.epoch == 0 && syncEvent.Epoch != 0 {
+		// The aggregator restarted since the last resync of the collector, or the epoch was lost from redis. The graph
+		// kept the resources of that resync, so the delta is applied and its epoch becomes the current one.
+		logger.Infof("Adopting epoch %d from the delta of cluster %s, the current epoch is unknown.", syncEvent.Epoch,
+			clusterName)
+		atomic.StoreInt64(&s.epoch, syncEvent.Epoch)
+		return s.epoch, true
+	}
+	if s.isStale(syncEvent.Epoch) {
+		logger.Warningf("Rejecting sync from cluster %s with stale epoch %d. Current epoch is %d, collector must resync.",
+			clusterName, syncEvent.Epoch, s.epoch)
+		metrics.StaleSyncEvents.Inc()
+		return s.epoch, false
+	}
+	return s.epoch, true
+}
+
+// Asks the collector of the cluster for a resync. Pushed to its session when it has one, otherwise its next delta
+// is rejected with 409 so it resyncs.
+func requestResync(clusterName, reason string) {
+	if _, pushed := PushDirective(clusterName, Directive{Action: DIRECTIVE_RESYNC, Reason: reason}); pushed {
+		return
+	}
+	atomic.StoreInt32(&getClusterSyncState(clusterName).resyncRequested, 1)
+	if redisSyncLocks() {
+		ctx, cancel := context.WithTimeout(context.Background(), syncLockTTL())
+		defer cancel()
+		if err := db.RequestSyncResync(ctx, clusterName); err != nil {
+			logger.Warningf("Error requesting a resync of cluster %s: %s", clusterName, err)
+		}
+	}
+}
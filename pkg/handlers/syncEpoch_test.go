@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkEpoch(t *testing.T) {
+	_, state, err := lockClusterSync(context.Background(), "epoch-cluster")
+	assert.NoError(t, err)
+	defer state.unlock()
+
+	epoch, ok := state.checkEpoch("epoch-cluster", &SyncEvent{ClearAll: true})
+	assert.True(t, ok, "A resync is always accepted.")
+	assert.NotZero(t, epoch)
+
+	_, ok = state.checkEpoch("epoch-cluster", &SyncEvent{Epoch: epoch})
+	assert.True(t, ok, "A delta with the current epoch should be accepted.")
+	_, ok = state.checkEpoch("epoch-cluster", &SyncEvent{})
+	assert.True(t, ok, "A delta without epoch should be accepted.")
+
+	next, ok := state.checkEpoch("epoch-cluster", &SyncEvent{ClearAll: true})
+	assert.True(t, ok)
+	assert.Greater(t, next, epoch, "A resync should start a newer epoch.")
+
+	current, ok := state.checkEpoch("epoch-cluster", &SyncEvent{Epoch: epoch})
+	assert.False(t, ok, "A delta from before the last resync should be rejected.")
+	assert.Equal(t, next, current)
+}
+
+func Test_checkEpoch_unknown(t *testing.T) {
+	_, state, err := lockClusterSync(context.Background(), "restarted-cluster")
+	assert.NoError(t, err)
+	defer state.unlock()
+
+	// The aggregator restarted since the last resync of the collector.
+	epoch, ok := state.checkEpoch("restarted-cluster", &SyncEvent{Epoch: 42})
+	assert.True(t, ok, "The delta should be accepted when the current epoch is unknown.")
+	assert.Equal(t, int64(42), epoch)
+	_, ok = state.checkEpoch("restarted-cluster", &SyncEvent{Epoch: 42})
+	assert.True(t, ok)
+	_, ok = state.checkEpoch("restarted-cluster", &SyncEvent{Epoch: 41})
+	assert.False(t, ok, "The adopted epoch should be the current one.")
+}
+
+func Test_checkEpoch_resyncRequested(t *testing.T) {
+	requestResync("resync-cluster", "test") // No session, the next delta is rejected.
+	_, state, err := lockClusterSync(context.Background(), "resync-cluster")
+	assert.NoError(t, err)
+	defer state.unlock()
+
+	_, ok := state.checkEpoch("resync-cluster", &SyncEvent{})
+	assert.False(t, ok, "A delta should be rejected until the cluster resyncs.")
+	_, ok = state.checkEpoch("resync-cluster", &SyncEvent{ClearAll: true})
+	assert.True(t, ok)
+	_, ok = state.checkEpoch("resync-cluster", &SyncEvent{})
+	assert.True(t, ok, "A delta after the resync should be accepted.")
+}
+
+func Test_lockClusterSync_canceled(t *testing.T) {
+	_, state, err := lockClusterSync(context.Background(), "locked-cluster")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = lockClusterSync(ctx, "locked-cluster")
+	assert.Equal(t, context.DeadlineExceeded, err, "Expected to give up waiting for a sync in progress.")
+
+	state.unlock()
+	_, state, err = lockClusterSync(context.Background(), "locked-cluster")
+	assert.NoError(t, err, "Expected lock after the previous sync completed.")
+	state.unlock()
+}
+
+func Test_lockClusterSync_redis(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.SyncLocks = "redis"
+	ctx := context.Background()
+
+	// Another replica syncs the cluster.
+	other, err := db.AcquireSyncLock(ctx, "replicated-cluster", time.Minute)
+	assert.NoError(t, err)
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, _, err = lockClusterSync(timeout, "replicated-cluster")
+	assert.Equal(t, context.DeadlineExceeded, err, "Expected to wait for the sync of the other replica.")
+	assert.NoError(t, other.SetEpoch(ctx, 42))
+	assert.NoError(t, other.Release(ctx))
+
+	_, state, err := lockClusterSync(ctx, "replicated-cluster")
+	assert.NoError(t, err)
+	_, ok := state.checkEpoch("replicated-cluster", &SyncEvent{Epoch: 42})
+	assert.True(t, ok, "The delta carries the epoch of the resync on the other replica.")
+	epoch, ok := state.checkEpoch("replicated-cluster", &SyncEvent{ClearAll: true})
+	assert.True(t, ok)
+	assert.NoError(t, state.saveEpoch(ctx))
+	state.unlock()
+	assert.Equal(t, epoch, clusterEpoch(ctx, "replicated-cluster"))
+
+	requestResync("replicated-cluster", "test")
+	getClusterSyncState("replicated-cluster").resyncRequested = 0 // As seen by another replica.
+	_, state, err = lockClusterSync(ctx, "replicated-cluster")
+	assert.NoError(t, err)
+	defer state.unlock()
+	_, ok = state.checkEpoch("replicated-cluster", &SyncEvent{Epoch: epoch})
+	assert.False(t, ok, "The resync requested by any replica is kept in redis.")
+}
+
+func Test_lockClusterSync_lost(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.SyncLocks, config.Cfg.SyncLockTTLMS = "redis", 150
+	ctx := context.Background()
+
+	syncCtx, state, err := lockClusterSync(ctx, "lost-cluster")
+	assert.NoError(t, err)
+	defer state.unlock()
+	assert.NoError(t, state.checkLock(syncCtx))
+
+	// The lock expires while the sync is stalled, and another replica takes it.
+	conn := db.Pool.Get()
+	_, err = conn.Do("DEL", db.SYNC_LOCK_KEY_PREFIX+"lost-cluster")
+	conn.Close()
+	assert.NoError(t, err)
+	other, err := db.AcquireSyncLock(ctx, "lost-cluster", time.Minute)
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, other.Release(ctx)) }()
+
+	select {
+	case <-syncCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the sync to be canceled once the lock is lost.")
+	}
+	assert.Equal(t, db.ErrSyncLockLost, state.checkLock(ctx), "The sync can't be committed.")
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Adds the fingerprint of the resources to the response, except the ones that failed.
+func addFingerprints(response *SyncResponse, resources []*db.Resource, failed map[string]error) {
+	if response.Fingerprints == nil {
+		response.Fingerprints = make(map[string]string, len(resources))
+	}
+	for _, resource := range resources {
+		if _, isFailed := failed[resource.UID]; isFailed {
+			continue
+		}
+		fingerprint, err := resource.Fingerprint()
+		if err != nil {
+			logger.V(3).Info("No fingerprint for resource ", resource.UID, ": ", err)
+			continue
+		}
+		response.Fingerprints[resource.UID] = fingerprint
+	}
+}
+
+// Returns the UIDs of the sync errors, to skip their resources.
+func syncErrorUIDs(errorLists ...[]SyncError) map[string]error {
+	uids := make(map[string]error)
+	for _, syncErrors := range errorLists {
+		for _, syncError := range syncErrors {
+			uids[syncError.ResourceUID] = nil
+		}
+	}
+	return uids
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_addFingerprints(t *testing.T) {
+	resources := []*db.Resource{
+		{UID: "c1/pod-1", Properties: map[string]interface{}{"kind": "Pod", "name": "pod-1", "_hash": "abc"}},
+		{UID: "c1/pod-2", Properties: map[string]interface{}{"kind": "Pod", "name": "pod-2"}},
+		{UID: "c1/empty", Properties: map[string]interface{}{}},
+	}
+	response := SyncResponse{}
+	addFingerprints(&response, resources, map[string]error{"c1/pod-2": errors.New("insert failed")})
+	expected, err := resources[0].Fingerprint()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"c1/pod-1": expected}, response.Fingerprints,
+		"The failed resources and the ones without properties have no fingerprint.")
+
+	addFingerprints(&response, resources[1:2], syncErrorUIDs([]SyncError{{ResourceUID: "c1/pod-3"}}))
+	assert.Len(t, response.Fingerprints, 2, "The fingerprints of the updates are added to the inserted ones.")
+
+	encoded, _ := json.Marshal(SyncResponse{})
+	assert.NotContains(t, string(encoded), "Fingerprints", "Only in the response to a sync that asked for them.")
+}
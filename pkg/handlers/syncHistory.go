@@ -0,0 +1,75 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Builds the stats kept in the sync history from the response sent to the collector.
+func newSyncStats(status int, clearAll bool, response SyncResponse, start time.Time) db.SyncStats {
+	now := time.Now()
+	return db.SyncStats{
+		Timestamp:    now,
+		RequestId:    response.RequestId,
+		ClearAll:     clearAll,
+		Status:       status,
+		Added:        response.TotalAdded,
+		Updated:      response.TotalUpdated,
+		Deleted:      response.TotalDeleted,
+		EdgesAdded:   response.TotalEdgesAdded,
+		EdgesDeleted: response.TotalEdgesDeleted,
+		Errors: len(response.AddErrors) + len(response.UpdateErrors) + len(response.DeleteErrors) +
+			len(response.AddEdgeErrors) + len(response.DeleteEdgeErrors),
+		DurationMS:     now.Sub(start).Milliseconds(),
+		TotalResources: response.TotalResources,
+	}
+}
+
+func recordSyncStats(clusterName string, stats db.SyncStats) {
+	err := db.RecordSyncStats(context.Background(), clusterName, stats)
+	if err != nil {
+		logger.Warning("Error recording sync history for cluster ", clusterName, ": ", err)
+	}
+}
+
+// SyncHistory responds with the stats of the syncs from a cluster, oldest first.
+// Use the since parameter (RFC3339) to get only the recent syncs, defaults to the whole retention period.
+func SyncHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+
+	since := time.Now().Add(-time.Duration(config.SyncHistoryRetentionHours()) * time.Hour)
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+				"Invalid since parameter, expected RFC3339 time: "+err.Error(), map[string]string{"parameter": "since"})
+			return
+		}
+	}
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+
+	history, err := db.SyncHistory(r.Context(), clusterName, since)
+	if err != nil {
+		logger.Warning("Error reading sync history for cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(history); encodeError != nil {
+		logger.Error("Error responding to SyncHistory: ", encodeError)
+	}
+}
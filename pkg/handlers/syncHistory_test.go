@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newSyncStats(t *testing.T) {
+	response := SyncResponse{
+		RequestId:    7,
+		TotalAdded:   3,
+		TotalDeleted: 1,
+		AddErrors:    []SyncError{{ResourceUID: "a", Message: "bad"}},
+		DeleteErrors: []SyncError{{ResourceUID: "b", Message: "bad"}},
+	}
+	stats := newSyncStats(http.StatusBadRequest, true, response, time.Now().Add(-time.Second))
+
+	assert.Equal(t, 7, stats.RequestId)
+	assert.True(t, stats.ClearAll)
+	assert.Equal(t, http.StatusBadRequest, stats.Status)
+	assert.Equal(t, 3, stats.Added)
+	assert.Equal(t, 1, stats.Deleted)
+	assert.Equal(t, 2, stats.Errors)
+	assert.GreaterOrEqual(t, stats.DurationMS, int64(1000))
+}
+
+func Test_SyncHistory_badRequest(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/history", SyncHistory)
+
+	for _, url := range []string{
+		"/aggregator/clusters/cluster1/history?since=yesterday",
+		"/aggregator/clusters/bad=cluster/history",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+}
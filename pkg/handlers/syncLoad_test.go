@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/generator"
+	"github.com/stretchr/testify/assert"
+)
+
+// Syncs the synthetic clusters to an in-memory graph, returns the router of the sync handler.
+func useSyncLoad(tb testing.TB) *mux.Router {
+	tb.Cleanup(config.Snapshot())
+	useTestDatastore(tb)
+	config.Cfg.SkipClusterValidation = "true"
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", SyncResources).Methods("POST")
+	return router
+}
+
+func TestSyncResources_load(t *testing.T) {
+	router := useSyncLoad(t)
+	opts := generator.LoadOptions{Options: generator.Options{Clusters: 2, Nodes: 200, Edges: 300, Seed: 1},
+		Deltas: 3, ChurnPercent: 10, Concurrency: 2}
+	report, err := generator.LoadTest(context.Background(), router, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Resyncs.Count)
+	assert.Zero(t, report.Resyncs.Failed)
+	assert.Equal(t, 6, report.Deltas.Count)
+	assert.Zero(t, report.Deltas.Failed)
+
+	ctx := context.Background()
+	for _, clusterName := range report.Clusters {
+		assert.Equal(t, 200, computeNodeCount(ctx, clusterName), "The deleted resources were replaced.")
+	}
+}
+
+// Measures a resync and the following deltas of a synthetic cluster, to catch the regressions of the diff and the
+// chunked writers, e.g. go test ./pkg/handlers -run ^$ -bench SyncResources -benchmem
+func BenchmarkSyncResources(b *testing.B) {
+	router := useSyncLoad(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		_, err := generator.LoadTest(ctx, router, generator.LoadOptions{Options: generator.Options{Nodes: 1000,
+			Edges: 1500, Seed: int64(i)}, Deltas: 5, ChurnPercent: 5})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -12,16 +12,20 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/open-cluster-management/search-aggregator/pkg/config"
 
 	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/eventsink"
 )
 
 // SyncEvent - Object sent by the collector with the resources to change.
@@ -31,15 +35,36 @@ type SyncEvent struct {
 	AddResources    []*db.Resource
 	UpdateResources []*db.Resource
 	DeleteResources []DeleteResourceEvent
+	// Resync only. UIDs of the resources the collector didn't send because they are unchanged since its inventory.
+	UnchangedResources []string `json:"unchangedResources,omitempty"`
 
 	AddEdges    []db.Edge
 	DeleteEdges []db.Edge
 	RequestId   int
+	Epoch       int64 // Epoch of the last resync seen by the collector. Deltas from an older epoch are rejected.
+	// Optional, when the collector sent the sync by its clock. Used to detect clock skew.
+	SentAt time.Time `json:"sentAt,omitempty"`
+	// Optional, URL of the collector the aggregator pings to tell a collector that is down from an empty cluster.
+	HealthURL string `json:"healthURL,omitempty"`
+	// Optional, true to get the fingerprint of each resource stored by the sync in the response.
+	Fingerprints bool `json:"fingerprints,omitempty"`
+	// Optional on deltas, the EdgeChecksum of the last response. The edges of the delta are only applied when it
+	// matches the stored edges, otherwise the response asks for an edge resync.
+	BaseEdgeChecksum string `json:"baseEdgeChecksum,omitempty"`
+	// Optional on deltas, true when AddEdges has every edge of the collector, to replace the stored edges without a
+	// resync. Sent after a response asked for an edge resync.
+	EdgeResync bool `json:"edgeResync,omitempty"`
+	// Optional, true to get the EdgeChecksum in the response without sending a base checksum, e.g. with a resync.
+	EdgeChecksum bool `json:"edgeChecksum,omitempty"`
+
+	mappedFields int // Legacy fields mapped by the PAYLOAD_MAPPINGS while decoding.
 }
 
 // DeleteResourceEvent - Contains the information needed to delete an existing resource.
 type DeleteResourceEvent struct {
-	UID string `json:"uid,omitempty"`
+	UID       string    `json:"uid,omitempty"`
+	DeletedAt time.Time `json:"deletedAt,omitempty"` // Optional, when the collector saw the resource deleted.
+	Reason    string    `json:"reason,omitempty"`    // Optional, why the resource was deleted.
 }
 
 // SyncResponse - Response to a SyncEvent
@@ -58,12 +83,47 @@ type SyncResponse struct {
 	DeleteEdgeErrors  []SyncError
 	Version           string
 	RequestId         int
+	Epoch             int64 // Current epoch for the cluster, must be sent with the following deltas.
+	// Load of the aggregator when responding, so collectors can adapt their send rate.
+	QueueDepth       int // Syncs in progress, including this one.
+	RequestLimit     int // Syncs in progress before new syncs are rejected with 429.
+	SuggestedDelayMS int // How long to wait before the next sync, 0 when the aggregator isn't busy.
+	MaxPayloadHint   int // Suggested max number of resources and edges in the next sync, 0 for no limit.
+	// Updates not applied because the node changed since the revision they were based on.
+	Conflicts []SyncConflict `json:",omitempty"`
+	// Fingerprint of each resource stored by the sync by UID, only when the sync asked for them. See
+	// db.Resource.Fingerprint, the collector compares them with its own to find the encoding differences.
+	Fingerprints map[string]string `json:",omitempty"`
+	// Checksum of the stored edges of the cluster after the sync, see db.EdgeChecksum. Only when the sync sent a base
+	// checksum, an edge resync or asked for it, the collector sends it as the baseEdgeChecksum of its next delta.
+	EdgeChecksum string `json:",omitempty"`
+	// The baseEdgeChecksum didn't match the stored edges, the edges of the delta weren't applied. The collector sends
+	// all its edges with edgeResync.
+	EdgeResyncRequired bool `json:",omitempty"`
+	// UIDs of the resources in AddErrors and UpdateErrors the aggregator retries, with RESOURCE_RETRY_ATTEMPTS. The
+	// collector doesn't need to send them again.
+	RetryQueued []string `json:",omitempty"`
+	// Fields of the payload not matching the sync schema, with SYNC_SCHEMA_VALIDATION warn or enforce.
+	SchemaErrors []SchemaError `json:",omitempty"`
+	// Code of the error when the sync failed, documented by GET /errors/{code}.
+	ErrorCode ErrorCode `json:",omitempty"`
+	// Queries run for the sync, only with ?debugQueries=true and the admin token.
+	Queries []db.TracedQuery `json:",omitempty"`
 }
 
 // SyncError is used to respond with errors.
 type SyncError struct {
 	ResourceUID string
-	Message     string // Often comes out of a golang error using .Error()
+	Message     string    // Often comes out of a golang error using .Error()
+	Code        ErrorCode `json:",omitempty"` // Stable code of the error, documented by GET /errors/{code}.
+}
+
+// SyncConflict is used to respond with the updates sent with a revision that isn't the current one. The collector
+// re-reads the resource and sends it again with the current revision, or without one to overwrite the node.
+type SyncConflict struct {
+	ResourceUID string
+	ExpectedRev int64
+	CurrentRev  int64 // 0 when the resource doesn't exist.
 }
 
 // SyncResources - Process Add, Update, and Delete events.
@@ -72,28 +132,75 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	clusterName := params["id"]
 
-	// Limit amount of concurrent requests to prevent overloading Redis.
-	// Give priority to the local-cluster, because it's the hub and this is how we debug search.
-	// TODO: The next step is to degrade performance instead of rejecting the request.
-	//       We will give priority to nodes over edges after reaching certain load.
-	//       Will also prioritize small updates over a large resync.
-	if len(PendingRequests) >= config.Cfg.RequestLimit && clusterName != "local-cluster" {
-		glog.Warningf("Too many pending requests (%d). Rejecting sync from %s", len(PendingRequests), clusterName)
-		http.Error(w, "Aggregator has many pending requests, retry later.", http.StatusTooManyRequests)
+	if tooManyRequests(clusterName) {
+		response := SyncResponse{Version: config.AGGREGATOR_API_VERSION, ErrorCode: ERROR_TOO_MANY_REQUESTS}
+		setBackpressure(&response, pendingRequestCount())
+		w.Header().Set("Retry-After", strconv.Itoa(int(throttleRetryAfter/time.Second)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		if encodeError := json.NewEncoder(w).Encode(response); encodeError != nil {
+			logger.Error("Error responding to SyncEvent:", encodeError, response)
+		}
 		return
 	}
 
-	glog.V(2).Info("Starting SyncResources() for cluster: ", clusterName)
+	ctx, trace, status, err := debugQueries(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" { // Compressed by collectors sending large resyncs.
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_BODY, "Invalid gzip body: "+err.Error(), nil)
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+
+	status, response := processSync(ctx, clusterName, body) // Canceled when the collector disconnects.
+	response.Queries = tracedQueries(trace)
+	w.WriteHeader(status)
+	encodeError := json.NewEncoder(w).Encode(response)
+	if encodeError != nil {
+		logger.Error("Error responding to SyncEvent:", encodeError, response)
+	}
+}
+
+// Limit amount of concurrent requests to prevent overloading Redis.
+// Give priority to the local-cluster, because it's the hub and this is how we debug search.
+// TODO: The next step is to degrade performance instead of rejecting the request.
+// We will give priority to nodes over edges after reaching certain load.
+func tooManyRequests(clusterName string) bool {
+	if pending := pendingRequestCount(); pending >= config.RequestLimit() && clusterName != "local-cluster" {
+		logger.Warningf("Too many pending requests (%d). Rejecting sync from %s", pending, clusterName)
+		return true
+	}
+	return false
+}
+
+// Processes the sync event read from the body and returns the status code and response for the collector.
+// Used for the sync requests and the sync messages of collector sessions.
+func processSync(ctx context.Context, clusterName string, body io.Reader) (int, SyncResponse) {
+	logger.V(2).Info("Starting SyncResources() for cluster: ", clusterName)
 	metrics := InitSyncMetrics(clusterName)
 	defer metrics.CompleteSyncEvent()
+	ctx = db.WithProgress(ctx, metrics.observeChunk)
 
 	subscriptionUpdated := false                // flag to decide the time when last suscription was changed
 	subscriptionUIDMap := make(map[string]bool) // map to hold exisiting subscription uids
 	response := SyncResponse{Version: config.AGGREGATOR_API_VERSION}
+	var rejectedUIDs SyncResponse // errors for resources and edges with invalid UIDs
+	knownCluster := false         // the health is only tracked for clusters with a Cluster node
+	var syncEvent SyncEvent
+	var syncHash string // Hash of the payload to detect the same sync sent again, empty when it isn't detected.
+	body, captured := captureSyncBody(body)
 
-	// Function that sends the current response and the given status code.
-	// If you want to bail out early, make sure to call return right after.
-	respond := func(status int) {
+	// Function that completes the current response with the given status code.
+	// If you want to bail out early, return its results right away.
+	respond := func(status int) (int, SyncResponse) {
 		statusMessage := fmt.Sprintf(
 			"Responding to cluster %s with requestId %d, status %d, stats: {Added: %d, Updated: %d, Deleted: %d, Edges Added: %d, Edges Deleted: %d, Total Resources: %d, Total Edges: %d}",
 			clusterName,
@@ -107,56 +214,146 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 			response.TotalResources,
 			response.TotalEdges,
 		)
+		appendRejected(&response, rejectedUIDs)
+		setBackpressure(&response, pendingRequestCount())
+		if status != http.StatusOK && response.ErrorCode == "" {
+			response.ErrorCode = syncErrorCode(status)
+		}
 		if status == http.StatusOK {
-			glog.Infof(statusMessage)
+			logger.Infof(statusMessage)
 		} else {
-			glog.Errorf(statusMessage)
+			logger.Errorf(statusMessage)
+		}
+		stats := newSyncStats(status, syncEvent.ClearAll, response, metrics.syncStart)
+		runInBackground(func() { recordSyncStats(clusterName, stats) })
+		if status == http.StatusOK {
+			recordLastSync(clusterName, syncEvent.ClearAll, response)
 		}
-		w.WriteHeader(status)
-		encodeError := json.NewEncoder(w).Encode(response)
-		if encodeError != nil {
-			glog.Error("Error responding to SyncEvent:", encodeError, response)
+		recordSyncHash(clusterName, syncHash, status, response, time.Now())
+		if captured != nil {
+			clearAll, received := syncEvent.ClearAll, metrics.syncStart
+			runInBackground(func() { captureSync(clusterName, captured, clearAll, status, received) })
 		}
+		if knownCluster {
+			observeClusterSync(clusterName, status, time.Now())
+		}
+		if syncEvent.ClearAll && status == http.StatusOK {
+			runInBackground(func() { observeRebuildResync(clusterName) })
+		}
+		return status, response
 	}
 
-	var syncEvent SyncEvent
-	err := json.NewDecoder(r.Body).Decode(&syncEvent)
+	// Checked before reading the body, and again once the sync holds the lock of the cluster.
+	if quarantine, quarantined := clusterQuarantine(ctx, clusterName); quarantined {
+		logger.Warningf("Rejected sync from quarantined cluster %s, quarantined since %s: %s", clusterName,
+			quarantine.Since.Format(time.RFC3339), quarantine.Reason)
+		return respond(http.StatusLocked)
+	}
+	if db.IsReadOnly() {
+		logger.Warningf("Rejected sync from cluster %s, the aggregator is read-only: %s", clusterName,
+			db.CurrentReadOnlyMode().Reason)
+		response.ErrorCode = ERROR_READ_ONLY
+		return respond(http.StatusServiceUnavailable)
+	}
+	if rejectedByGraphLimits(ctx, clusterName) {
+		response.ErrorCode = ERROR_GRAPH_LIMIT_REACHED
+		return respond(http.StatusInsufficientStorage)
+	}
+	body, schemaErrors, err := validateSyncSchema(clusterName, body)
 	if err != nil {
-		glog.Error("Error decoding body of syncEvent: ", err)
-		respond(http.StatusBadRequest)
-		return
+		logger.Error("Error reading body of syncEvent: ", err)
+		response.ErrorCode = ERROR_INVALID_BODY
+		return respond(http.StatusBadRequest)
+	}
+	if response.SchemaErrors = schemaErrors; len(schemaErrors) > 0 && config.Cfg.SyncSchemaValidation == "enforce" {
+		response.ErrorCode = ERROR_SCHEMA_VIOLATION
+		return respond(http.StatusBadRequest)
+	}
+	err = decodeSyncEvent(body, &syncEvent)
+	if err != nil {
+		logger.Error("Error decoding body of syncEvent: ", err)
+		response.ErrorCode = ERROR_INVALID_BODY
+		return respond(http.StatusBadRequest)
 	}
+	observePayloadMappings(clusterName, syncEvent.mappedFields)
 	response.RequestId = syncEvent.RequestId
-	glog.V(3).Infof(
+	metrics.RequestId = syncEvent.RequestId
+	observeClockSkew(clusterName, syncEvent.SentAt, metrics.syncStart)
+	logger.V(3).Infof(
 		"Processing Request { request: %d, add: %d, update: %d, delete: %d edge add: %d edge delete: %d }",
 		syncEvent.RequestId, len(syncEvent.AddResources), len(syncEvent.UpdateResources),
 		len(syncEvent.DeleteResources), len(syncEvent.AddEdges), len(syncEvent.DeleteEdges))
 
 	err = db.ValidateClusterName(clusterName)
 	if err != nil {
-		glog.Warning("Invalid Cluster Name: ", clusterName)
-		respond(http.StatusBadRequest)
-		return
+		logger.Warning("Invalid Cluster Name: ", clusterName)
+		response.ErrorCode = ERROR_INVALID_CLUSTER
+		return respond(http.StatusBadRequest)
+	}
+	if syncEvent.HealthURL != "" {
+		recordCollectorHealthURL(clusterName, syncEvent.HealthURL)
+	}
+	syncHash = syncEventHash(syncEvent)
+	if previous, duplicate := checkDuplicateSync(clusterName, syncHash, syncEvent.ClearAll); duplicate {
+		// The collector is stuck sending the same sync, it gets the response of the last one. The sync still counts
+		// for the health and the stats of the cluster, the last one succeeded so the cluster is known.
+		previous.RequestId = syncEvent.RequestId
+		response, knownCluster = previous, true
+		return respond(http.StatusOK)
 	}
 
+	rejectedUIDs = prepareSyncEvent(clusterName, &syncEvent)
+	filterExpiredResources(clusterName, &syncEvent, time.Now())
+	capPropertyCardinality(clusterName, &syncEvent, time.Now())
+
 	// Validate that we have a Cluster CRD so we can build edges on create
-	if !assertClusterNode(clusterName) {
-		glog.Warningf(
+	if !assertClusterNode(ctx, clusterName) {
+		logger.Warningf(
 			"Warning, couldn't find a Cluster node with name: %s. This means that the sync request came from a managed cluster that hasn’t joined. Rejecting the incoming sync request.", clusterName)
-		respond(http.StatusBadRequest)
-		return
+		response.ErrorCode = ERROR_CLUSTER_NOT_JOINED
+		return respond(http.StatusBadRequest)
 	}
+	knownCluster = true
+	// Large values of the BLOB_PROPERTIES go to the blob store, before waiting for the previous sync.
+	offloadBlobProperties(ctx, clusterName, &syncEvent)
 
-	// add cluster fields
-	for i := range syncEvent.AddResources {
-		syncEvent.AddResources[i].Properties["cluster"] = clusterName
+	// Process one sync at a time for each cluster, so a delta can't interleave with a resync. The writes use the
+	// context of the lock, canceled when another replica takes it.
+	ctx, syncState, err := lockClusterSync(ctx, clusterName)
+	if err != nil {
+		logger.Warningf("Sync from cluster %s canceled while waiting for the previous sync to complete: %s",
+			clusterName, err)
+		return respond(http.StatusServiceUnavailable)
+	}
+	defer syncState.unlock()
+	if _, quarantined := clusterQuarantine(ctx, clusterName); quarantined {
+		return respond(http.StatusLocked)
+	}
+	prevEpoch := syncState.currentEpoch()
+	epoch, ok := syncState.checkEpoch(clusterName, &syncEvent)
+	response.Epoch = epoch
+	if !ok {
+		return respond(http.StatusConflict)
 	}
-	for i := range syncEvent.UpdateResources {
-		syncEvent.UpdateResources[i].Properties["cluster"] = clusterName
+	if epoch != prevEpoch {
+		if err := syncState.saveEpoch(ctx); err != nil {
+			logger.Warningf("Error saving the epoch of the sync from cluster %s: %s", clusterName, err)
+			return respond(http.StatusServiceUnavailable)
+		}
+	}
+
+	// add cluster fields, and the CLUSTER_PROPERTIES set by the hub
+	addClusterProperties(clusterName, syncEvent.AddResources)
+	rejectedByPolicy, err := resolveUIDCollisions(ctx, clusterName, &syncEvent, time.Now())
+	rejectedUIDs.AddErrors = append(rejectedUIDs.AddErrors, rejectedByPolicy...)
+	if err != nil {
+		logger.Warning("Error resolving the UID collisions of the resources from cluster ", clusterName, err)
+		return respond(syncErrorStatus(err))
 	}
+	addClusterProperties(clusterName, syncEvent.UpdateResources)
 
 	// let us store the Current Subscription Uids in a map [String] -> boolean
-	uidresults, uiderr := getUIDsForSubscriptions()
+	uidresults, uiderr := getUIDsForSubscriptions(ctx)
 	if uiderr == nil {
 		if !uidresults.Empty() {
 			for uidresults.Next() {
@@ -167,15 +364,26 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 		}
 
 	} else {
-		glog.Warningf("Error Fetching Subscriptions %s", uiderr)
+		logger.Warningf("Error Fetching Subscriptions %s", uiderr)
 	}
 
 	// This usually indicates that something has gone wrong, basically that the collector detected we
 	// are out of sync and wants us to resync.
 	if syncEvent.ClearAll {
-		stats, err := resyncCluster(clusterName, syncEvent.AddResources, syncEvent.AddEdges, &metrics)
-		if err != nil {
-			glog.Warning("Error on resyncCluster. ", clusterName, err)
+		// Resyncs use the bulk lane, so they don't hold up the deltas from other clusters.
+		resyncCtx := db.WithLane(ctx, db.BulkLane)
+		// The collector sends the same payload again after an interrupted resync, it resumes from its checkpoint.
+		if metrics.PayloadHash = syncHash; syncHash == "" && config.Cfg.ResyncCheckpointMaxAgeMS > 0 {
+			metrics.PayloadHash = payloadHash(syncEvent)
+		}
+		db.DropRetries(clusterName) // The resync sends every resource again.
+		stats, err := resyncCluster(resyncCtx, clusterName, syncEvent.AddResources, syncEvent.UnchangedResources,
+			syncEvent.AddEdges, &metrics)
+		if db.IsRetryable(err) {
+			logger.Warning("Error on resyncCluster, the collector will retry. ", clusterName, err)
+			return respond(http.StatusServiceUnavailable)
+		} else if err != nil {
+			logger.Warning("Error on resyncCluster. ", clusterName, err)
 		} else {
 			response.TotalAdded = stats.TotalAdded
 			response.TotalUpdated = stats.TotalUpdated
@@ -187,88 +395,141 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 			response.DeleteErrors = stats.DeleteErrors
 			response.AddEdgeErrors = stats.AddEdgeErrors
 			response.DeleteEdgeErrors = stats.DeleteEdgeErrors
+			response.RetryQueued = stats.RetryQueued
+			if syncEvent.Fingerprints {
+				addFingerprints(&response, syncEvent.AddResources, syncErrorUIDs(stats.AddErrors, stats.UpdateErrors))
+			}
 		}
 
 	} else {
+		// The resources queued for the lazy deleter are still in the graph. The added ones are replaced, so they
+		// aren't duplicated, and the updated ones are kept.
+		lazyUIDs := make([]string, 0, len(syncEvent.AddResources))
+		for _, resource := range syncEvent.AddResources {
+			lazyUIDs = append(lazyUIDs, resource.UID)
+		}
+		if replaced := db.CancelPendingDeletes(clusterName, lazyUIDs); len(replaced) > 0 {
+			if err := db.ChunkedDelete(ctx, replaced).Err(); err != nil {
+				logger.Warning("Error deleting the pending deletes added again for cluster ", clusterName, err)
+				db.QueueDeletes(clusterName, replaced)
+				return respond(syncErrorStatus(err))
+			}
+		}
+		lazyUIDs = lazyUIDs[:0]
+		for _, resource := range syncEvent.UpdateResources {
+			lazyUIDs = append(lazyUIDs, resource.UID)
+		}
+		db.CancelPendingDeletes(clusterName, lazyUIDs)
+		// The failed resources waiting for a retry are superseded by the ones sent again or deleted.
+		supersededUIDs := append([]string{}, lazyUIDs...)
+		for _, resource := range syncEvent.AddResources {
+			supersededUIDs = append(supersededUIDs, resource.UID)
+		}
+		for _, de := range syncEvent.DeleteResources {
+			supersededUIDs = append(supersededUIDs, de.UID)
+		}
+		db.CancelRetries(clusterName, supersededUIDs)
+		// Read before the resources are written, the checksum is of the edges before the delta.
+		if err := prepareEdgeSync(ctx, clusterName, &syncEvent, &response); err != nil {
+			logger.Warning("Error reading the stored edges for the edge sync of cluster ", clusterName, err)
+			return respond(syncErrorStatus(err))
+		}
+
 		// INSERT Resources
 
 		metrics.NodeSyncStart = time.Now()
-		insertResponse := db.ChunkedInsert(syncEvent.AddResources, clusterName)
+		insertResponse := db.ChunkedInsert(ctx, syncEvent.AddResources, clusterName)
 		response.TotalAdded = insertResponse.SuccessfulResources // could be 0
-		if insertResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
-		} else if len(insertResponse.ResourceErrors) != 0 {
+		publishResources(ctx, clusterName, syncEvent.RequestId, eventsink.NodeAdded, syncEvent.AddResources,
+			insertResponse)
+		if syncEvent.Fingerprints && insertResponse.ConnectionError == nil {
+			addFingerprints(&response, syncEvent.AddResources, insertResponse.ResourceErrors)
+		}
+		if err := insertResponse.Err(); err != nil {
 			response.AddErrors = processSyncErrors(insertResponse.ResourceErrors, "inserted")
-			respond(http.StatusBadRequest)
-			return
+			response.RetryQueued = db.QueueRetries(clusterName, db.RETRY_INSERT, syncEvent.AddResources,
+				insertResponse.ResourceErrors, time.Now())
+			return respond(syncErrorStatus(err))
 		}
 
 		// UPDATE Resources
 
-		updateResponse := db.ChunkedUpdate(syncEvent.UpdateResources)
+		updates, conflicts, err := db.CheckRevisions(ctx, syncEvent.UpdateResources)
+		if err != nil {
+			logger.Warning("Error reading the revisions of the updated resources for cluster ", clusterName, err)
+			return respond(syncErrorStatus(err))
+		}
+		response.Conflicts = processRevisionConflicts(conflicts)
+		updateResponse := db.ChunkedUpdate(ctx, updates)
 		response.TotalUpdated = updateResponse.SuccessfulResources // could be 0
-		if updateResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
-		} else if len(updateResponse.ResourceErrors) != 0 {
+		publishResources(ctx, clusterName, syncEvent.RequestId, eventsink.NodeUpdated, updates, updateResponse)
+		if syncEvent.Fingerprints && updateResponse.ConnectionError == nil {
+			addFingerprints(&response, updates, updateResponse.ResourceErrors)
+		}
+		if err := updateResponse.Err(); err != nil {
 			response.UpdateErrors = processSyncErrors(updateResponse.ResourceErrors, "updated")
-			respond(http.StatusBadRequest)
-			return
+			response.RetryQueued = db.QueueRetries(clusterName, db.RETRY_UPDATE, updates,
+				updateResponse.ResourceErrors, time.Now())
+			return respond(syncErrorStatus(err))
 		}
 
 		// DELETE Resources
 
-		// reformat to []string
-		deleteUIDS := make([]string, 0, len(syncEvent.DeleteResources))
-		for _, de := range syncEvent.DeleteResources {
-			deleteUIDS = append(deleteUIDS, de.UID)
+		deleteUIDS := deletedUIDs(syncEvent)
+		for _, uid := range deleteUIDS {
 			// If we are deleting any subscriptions better run interclusteredges - Setting flag to true
 			if !subscriptionUpdated {
-				if _, ok := subscriptionUIDMap[de.UID]; ok {
+				if _, ok := subscriptionUIDMap[uid]; ok {
 					subscriptionUpdated = true
 				}
 			}
-
 		}
 
-		deleteResponse := db.ChunkedDelete(deleteUIDS)
+		// The kind, name and namespace of the resources are read before they're gone, for the deleted API.
+		tombstones := deleteTombstones(syncEvent.DeleteResources, time.Now(), clockSkewCorrection(clusterName))
+		if err := db.DescribeTombstones(ctx, tombstones); err != nil {
+			logger.Warning("Error reading the resources deleted by cluster ", clusterName, ": ", err)
+		}
+		deleteResponse := db.BatchedDelete(ctx, clusterName, deleteUIDS)
 		response.TotalDeleted = deleteResponse.SuccessfulResources // could be 0
-		if deleteResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
-		} else if len(deleteResponse.ResourceErrors) != 0 {
+		publishDeletes(ctx, clusterName, syncEvent.RequestId, tombstones, deleteResponse)
+		if err := deleteResponse.Err(); err != nil {
 			response.DeleteErrors = processSyncErrors(deleteResponse.ResourceErrors, "deleted")
-			respond(http.StatusBadRequest)
-			return
+			return respond(syncErrorStatus(err))
+		}
+		if len(tombstones) > 0 {
+			runInBackground(func() { recordTombstones(clusterName, syncEvent.RequestId, tombstones) })
 		}
 		metrics.NodeSyncEnd = time.Now()
 
 		// Insert Edges
 		metrics.EdgeSyncStart = time.Now()
-		glog.V(4).Info("Sync cluster ", clusterName, ": Number of edges to insert: ", len(syncEvent.AddEdges))
-		insertEdgeResponse := db.ChunkedInsertEdge(syncEvent.AddEdges, clusterName)
+		logger.V(4).Info("Sync cluster ", clusterName, ": Number of edges to insert: ", len(syncEvent.AddEdges))
+		insertEdgeResponse := db.ChunkedInsertEdge(ctx, syncEvent.AddEdges, clusterName)
 		response.TotalEdgesAdded = insertEdgeResponse.SuccessfulResources // could be 0
-		if insertEdgeResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
-		} else if len(insertEdgeResponse.ResourceErrors) != 0 {
+		publishEdges(ctx, clusterName, syncEvent.RequestId, eventsink.EdgeAdded, syncEvent.AddEdges,
+			insertEdgeResponse)
+		if err := insertEdgeResponse.Err(); err != nil {
 			response.AddEdgeErrors = processSyncErrors(insertEdgeResponse.ResourceErrors, "inserted by edge")
-			respond(http.StatusBadRequest)
-			return
+			return respond(syncErrorStatus(err))
 		}
 
 		// Delete Edges
-		glog.V(4).Info("Sync cluster ", clusterName, ": Number of edges to delete: ", len(syncEvent.DeleteEdges))
-		deleteEdgeResponse := db.ChunkedDeleteEdge(syncEvent.DeleteEdges, clusterName)
+		logger.V(4).Info("Sync cluster ", clusterName, ": Number of edges to delete: ", len(syncEvent.DeleteEdges))
+		deleteEdgeResponse := db.BatchedDeleteEdge(ctx, clusterName, syncEvent.DeleteEdges)
 		response.TotalEdgesDeleted = deleteEdgeResponse.SuccessfulResources // could be 0
-		if deleteEdgeResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
-		} else if len(deleteEdgeResponse.ResourceErrors) != 0 {
+		publishEdges(ctx, clusterName, syncEvent.RequestId, eventsink.EdgeDeleted, syncEvent.DeleteEdges,
+			deleteEdgeResponse)
+		if err := deleteEdgeResponse.Err(); err != nil {
 			response.DeleteEdgeErrors = processSyncErrors(deleteEdgeResponse.ResourceErrors, "removed by edge")
-			respond(http.StatusBadRequest)
-			return
+			return respond(syncErrorStatus(err))
+		}
+		if len(syncEvent.DeleteResources) > 0 || len(syncEvent.DeleteEdges) > 0 {
+			if deleted, err := db.DeleteOrphanPlaceholders(ctx, clusterName); err != nil {
+				logger.Warning("Error deleting orphan placeholder nodes for cluster ", clusterName, ": ", err)
+			} else if deleted > 0 {
+				logger.V(3).Infof("Deleted %d orphan placeholder nodes for cluster %s.", deleted, clusterName)
+			}
 		}
 
 		metrics.EdgeSyncEnd = time.Now()
@@ -276,18 +537,28 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 	metrics.SyncEnd = time.Now()
 	metrics.LogPerformanceMetrics(syncEvent)
 
-	glog.V(2).Infof("syncResources complete. Done updating resources for cluster %s, preparing response", clusterName)
-	response.TotalResources = computeNodeCount(clusterName) // This goes out to the DB, so it can take a second
-	response.TotalEdges = computeIntraEdges(clusterName)
+	logger.V(2).Infof("syncResources complete. Done updating resources for cluster %s, preparing response", clusterName)
+	response.TotalResources = computeNodeCount(ctx, clusterName) // This goes out to the DB, so it can take a second
+	response.TotalEdges = computeIntraEdges(ctx, clusterName)
+	if wantsEdgeChecksum(syncEvent) {
+		response.EdgeChecksum = storedEdgeChecksum(ctx, clusterName)
+	}
 
-	respond(http.StatusOK)
+	// The writes of a replica that lost the lock may have interleaved with the sync of the new owner.
+	if err := syncState.checkLock(ctx); err != nil {
+		logger.Warningf("Error committing the sync from cluster %s, requesting a resync: %s", clusterName, err)
+		requestResync(clusterName, "sync lock lost")
+		return respond(http.StatusServiceUnavailable)
+	}
+	status, syncResponse := respond(http.StatusOK)
+	requestSummaryUpdate(clusterName)
 
-	// update the timestamp if we made any changes Kind = Subscription
+	// recompute the intercluster edges of the cluster if we made any changes Kind = Subscription
 
 	// if any Node with kind Subscription Added then subscriptionUpdated
 	for i := range syncEvent.AddResources {
 		if (!subscriptionUpdated) && (syncEvent.AddResources[i].Properties["kind"] == "Subscription") {
-			glog.V(3).Infof("Will trigger Intercluster - Added Node %s ", syncEvent.AddResources[i].Properties["name"])
+			logger.V(3).Infof("Will trigger Intercluster - Added Node %s ", syncEvent.AddResources[i].Properties["name"])
 			subscriptionUpdated = true
 			break
 		}
@@ -295,7 +566,7 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 	if !subscriptionUpdated {
 		for i := range syncEvent.UpdateResources {
 			if (!subscriptionUpdated) && (syncEvent.UpdateResources[i].Properties["kind"] == "Subscription") {
-				glog.V(3).Infof("Will trigger Intercluster - Updated Node %s ",
+				logger.V(3).Infof("Will trigger Intercluster - Updated Node %s ",
 					syncEvent.UpdateResources[i].Properties["name"])
 				subscriptionUpdated = true
 				break
@@ -304,18 +575,97 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if subscriptionUpdated {
-		ApplicationLastUpdated = time.Now()
+		markInterClusterChange(clusterName)
+	}
+	if policyEdgesUpdated(clusterName, syncEvent) {
+		markPolicyChange()
 	}
+	return status, syncResponse
+}
+
+// internal function to inline the revision conflicts
+func processRevisionConflicts(conflicts []db.RevisionConflict) []SyncConflict {
+	var ret []SyncConflict
+	for _, c := range conflicts {
+		logger.V(2).Infof("Resource %s not updated, expected revision %d but it's %d", c.UID, c.ExpectedRev, c.CurrentRev)
+		ret = append(ret, SyncConflict{ResourceUID: c.UID, ExpectedRev: c.ExpectedRev, CurrentRev: c.CurrentRev})
+	}
+	return ret
+}
+
+// Returns the status of a sync that failed with the error of a graph operation. Service unavailable tells the
+// collector to retry the sync, bad request that the resources in the errors are rejected.
+func syncErrorStatus(err error) int {
+	if db.IsRetryable(err) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// Returns the code of a sync that failed with the status, without a more specific one.
+func syncErrorCode(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ERROR_WRITE_FAILED
+	case http.StatusConflict:
+		return ERROR_EPOCH_CONFLICT
+	}
+	return statusErrorCode(status)
+}
+
+// Prepares the resources and edges of a sync before anything is written, the same way for a sync and its replay.
+// Adds the owner edges, normalizes the UIDs, drops the excluded kinds and applies the property transforms and hooks.
+// Returns the errors of the resources and edges rejected on the way.
+func prepareSyncEvent(clusterName string, syncEvent *SyncEvent) SyncResponse {
+	addOwnerEdges(syncEvent)
+	// Normalize UIDs and reject the ones that would create unreachable nodes.
+	rejected := validateUIDs(clusterName, syncEvent)
+	filterExcludedKinds(clusterName, syncEvent)
+	// Mutate the properties with the configured transforms and hooks, rejecting the resources they fail for.
+	rejectedByHooks := applyPropertyHooks(clusterName, syncEvent)
+	rejected.AddErrors = append(rejected.AddErrors, rejectedByHooks.AddErrors...)
+	rejected.UpdateErrors = append(rejected.UpdateErrors, rejectedByHooks.UpdateErrors...)
+	return rejected
+}
+
+// Sets the cluster of the resources, and the CLUSTER_PROPERTIES set by the hub.
+func addClusterProperties(clusterName string, resources []*db.Resource) {
+	for _, r := range resources {
+		r.Properties["cluster"] = clusterName
+		r.AddClusterProperties(clusterName)
+	}
+}
+
+// Appends the errors of the resources and edges rejected before the writes to the response.
+func appendRejected(response *SyncResponse, rejected SyncResponse) {
+	response.AddErrors = append(response.AddErrors, rejected.AddErrors...)
+	response.UpdateErrors = append(response.UpdateErrors, rejected.UpdateErrors...)
+	response.DeleteErrors = append(response.DeleteErrors, rejected.DeleteErrors...)
+	response.AddEdgeErrors = append(response.AddEdgeErrors, rejected.AddEdgeErrors...)
+	response.DeleteEdgeErrors = append(response.DeleteEdgeErrors, rejected.DeleteEdgeErrors...)
+}
+
+// Returns the UIDs of the deleted resources of the sync.
+func deletedUIDs(syncEvent SyncEvent) []string {
+	uids := make([]string, 0, len(syncEvent.DeleteResources))
+	for _, de := range syncEvent.DeleteResources {
+		uids = append(uids, de.UID)
+	}
+	return uids
 }
 
 // internal function to inline the errors
 func processSyncErrors(re map[string]error, verb string) []SyncError {
+	if len(re) == 0 {
+		return nil
+	}
 	ret := []SyncError{}
 	for uid, e := range re {
-		glog.Errorf("Resource %s cannot be %s: %s", uid, verb, e)
+		logger.Errorf("Resource %s cannot be %s: %s", uid, verb, e)
 		ret = append(ret, SyncError{
 			ResourceUID: uid,
 			Message:     e.Error(),
+			Code:        ERROR_WRITE_FAILED,
 		})
 	}
 
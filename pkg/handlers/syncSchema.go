@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	_ "embed" // For the sync schema.
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Version of the sync schema the payloads are validated against, at the end of its $id.
+const SYNC_SCHEMA_VERSION = "v1"
+
+// Errors reported for a payload, the next ones are counted in a last error.
+const syncSchemaMaxErrors = 20
+
+//go:embed syncSchema.v1.json
+var syncSchemaJSON []byte
+
+var syncSchema = loadSyncSchema()
+
+// A field of a sync payload that doesn't match the sync schema.
+type SchemaError struct {
+	Field   string // Path of the field, e.g. addResources.3.uid, (root) for the payload.
+	Message string
+}
+
+func loadSyncSchema() *gojsonschema.Schema {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(syncSchemaJSON))
+	if err != nil {
+		panic(fmt.Sprintf("Invalid sync schema %s: %v", SYNC_SCHEMA_VERSION, err))
+	}
+	return schema
+}
+
+// Returns the fields of the payload that don't match the sync schema, nil when the payload isn't JSON, the decoder
+// reports it.
+func syncSchemaErrors(payload []byte) []SchemaError {
+	result, err := syncSchema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil || result.Valid() {
+		return nil
+	}
+	schemaErrors := []SchemaError{}
+	for i, resultError := range result.Errors() {
+		if i == syncSchemaMaxErrors {
+			schemaErrors = append(schemaErrors, SchemaError{Field: "(root)",
+				Message: fmt.Sprintf("%d more errors", len(result.Errors())-syncSchemaMaxErrors)})
+			break
+		}
+		schemaErrors = append(schemaErrors, SchemaError{Field: resultError.Field(),
+			Message: resultError.Description()})
+	}
+	return schemaErrors
+}
+
+// Validates the sync payload against the sync schema when SYNC_SCHEMA_VALIDATION is warn or enforce, and returns
+// the body to decode with the fields that don't match. The payload is read in full to validate it, the decoder
+// streams it otherwise.
+func validateSyncSchema(clusterName string, body io.Reader) (io.Reader, []SchemaError, error) {
+	mode := config.Cfg.SyncSchemaValidation
+	if mode != "warn" && mode != "enforce" {
+		return body, nil, nil
+	}
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	schemaErrors := syncSchemaErrors(payload)
+	if len(schemaErrors) > 0 {
+		metrics.SyncSchemaErrors.WithLabelValues(metrics.ClusterLabel(clusterName)).Inc()
+		action := "Processing"
+		if mode == "enforce" {
+			action = "Rejected"
+		}
+		logger.Warningf("%s sync from cluster %s not matching the sync schema %s, %d errors, first at %s: %s",
+			action, clusterName, SYNC_SCHEMA_VERSION, len(schemaErrors), schemaErrors[0].Field,
+			schemaErrors[0].Message)
+	}
+	return bytes.NewReader(payload), schemaErrors, nil
+}
+
+// SyncSchema responds with the JSON Schema of the sync payloads, for the collectors to validate them before sending.
+func SyncSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	if _, err := w.Write(syncSchemaJSON); err != nil {
+		logger.Error("Error responding to SyncSchema: ", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_syncSchemaErrors(t *testing.T) {
+	assert.Empty(t, syncSchemaErrors([]byte(testSyncBody)))
+	assert.Nil(t, syncSchemaErrors([]byte(`{"addResources": [`)), "The decoder reports the invalid JSON.")
+
+	schemaErrors := syncSchemaErrors([]byte(`{"requestId": "42", "addResources": [
+		{"kind": "Pod", "uid": "c1/a", "properties": {"name": "a"}},
+		{"kind": "Pod", "properties": {"name": 3, "label": {"app": "web"}}}],
+		"addEdges": [{"SourceUID": "c1/a", "DestUID": ""}], "baseEdgeChecksum": "abc"}`))
+	fields := []string{}
+	for _, schemaError := range schemaErrors {
+		fields = append(fields, schemaError.Field)
+	}
+	assert.ElementsMatch(t, []string{"requestId", "addResources.1", "addResources.1.properties.name",
+		"addEdges.0", "addEdges.0.DestUID", "baseEdgeChecksum"}, fields)
+
+	resources := make([]string, syncSchemaMaxErrors+5)
+	for i := range resources {
+		resources[i] = `{"kind": "Pod", "uid": "c1/a"}`
+	}
+	schemaErrors = syncSchemaErrors([]byte(`{"addResources": [` + strings.Join(resources, ",") + `]}`))
+	assert.Len(t, schemaErrors, syncSchemaMaxErrors+1)
+	assert.Equal(t, SchemaError{Field: "(root)", Message: "5 more errors"}, schemaErrors[syncSchemaMaxErrors])
+}
+
+func Test_validateSyncSchema(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	invalid := `{"requestId": 7, "deleteResources": [{"deletedAt": "yesterday"}]}`
+	counter := metrics.SyncSchemaErrors.WithLabelValues("s1")
+	before := testutil.ToFloat64(counter)
+
+	config.Cfg.SyncSchemaValidation = "off"
+	body, schemaErrors, err := validateSyncSchema("s1", strings.NewReader(invalid))
+	assert.NoError(t, err)
+	assert.Nil(t, schemaErrors)
+
+	config.Cfg.SyncSchemaValidation = "warn"
+	body, schemaErrors, err = validateSyncSchema("s1", strings.NewReader(invalid))
+	assert.NoError(t, err)
+	assert.Len(t, schemaErrors, 2, "The uid is missing and deletedAt isn't a date-time.")
+	payload, _ := ioutil.ReadAll(body)
+	assert.Equal(t, invalid, string(payload), "The body is decoded after the validation.")
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+
+	config.Cfg.SyncSchemaValidation = "enforce"
+	status, response := processSync(context.Background(), "s1", strings.NewReader(invalid))
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Len(t, response.SchemaErrors, 2)
+	assert.Zero(t, response.TotalDeleted)
+
+	recorder := httptest.NewRecorder()
+	SyncSchema(recorder, httptest.NewRequest("GET", "/aggregator/sync/schema", nil))
+	var schema map[string]interface{}
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&schema))
+	assert.True(t, strings.HasSuffix(schema["$id"].(string), "/"+SYNC_SCHEMA_VERSION))
+}
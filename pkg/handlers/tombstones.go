@@ -0,0 +1,158 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Builds the tombstones of the resources deleted by the collector.
+// Uses the time the delete was received when the collector doesn't send the deletion time. The deletion times are
+// corrected by the skew of the collector clock, see clockSkewCorrection.
+func deleteTombstones(deletes []DeleteResourceEvent, received time.Time, skew time.Duration) []db.Tombstone {
+	tombstones := make([]db.Tombstone, 0, len(deletes))
+	for _, de := range deletes {
+		deletedAt := de.DeletedAt.Add(-skew)
+		if de.DeletedAt.IsZero() {
+			deletedAt = received
+		}
+		tombstones = append(tombstones, db.Tombstone{
+			UID:        de.UID,
+			DeletedAt:  deletedAt,
+			Reason:     de.Reason,
+			RecordedAt: received,
+		})
+	}
+	return tombstones
+}
+
+// Builds the tombstones of the nodes removed by a resync, skipping the ones that failed to delete.
+func resyncTombstones(nodes map[string]*rg2.Node, failed map[string]error, received time.Time) []db.Tombstone {
+	tombstones := make([]db.Tombstone, 0, len(nodes))
+	for uid, node := range nodes {
+		if _, ok := failed[uid]; ok {
+			continue
+		}
+		tombstone := db.Tombstone{UID: uid, DeletedAt: received, Reason: db.RESYNC_DELETE_REASON, RecordedAt: received}
+		tombstone.Kind, _ = node.Properties["kind"].(string)
+		tombstone.Name, _ = node.Properties["name"].(string)
+		tombstone.Namespace, _ = node.Properties["namespace"].(string)
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones
+}
+
+// Records the tombstones of the resources deleted by the sync with the request id.
+func recordTombstones(clusterName string, requestID int, tombstones []db.Tombstone) {
+	for i := range tombstones {
+		tombstones[i].RequestId = requestID
+	}
+	err := db.RecordTombstones(context.Background(), clusterName, tombstones)
+	if err != nil {
+		logger.Warning("Error recording tombstones for cluster ", clusterName, ": ", err)
+	}
+}
+
+// Tombstones responds with the resources deleted from a cluster, oldest first.
+// Use the since parameter (RFC3339) to get only the recent deletions and the uid parameter to get a single resource.
+func Tombstones(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+
+	since := time.Now().Add(-time.Duration(config.TombstoneRetentionHours()) * time.Hour)
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+				"Invalid since parameter, expected RFC3339 time: "+err.Error(), map[string]string{"parameter": "since"})
+			return
+		}
+	}
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+
+	tombstones, err := db.Tombstones(r.Context(), clusterName, since, r.URL.Query().Get("uid"))
+	if err != nil {
+		logger.Warning("Error reading tombstones for cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(tombstones); encodeError != nil {
+		logger.Error("Error responding to Tombstones: ", encodeError)
+	}
+}
+
+const deletedResourcesLimit = 100 // Default number of resources returned by the deleted API.
+
+// DeletedResources responds with the resources recently deleted from a cluster, newest first, with the request id of
+// the sync that deleted them. Use the since parameter (RFC3339), the kind, name and namespace parameters to find a
+// resource and limit to bound the response. With RBAC_FILTER, only the resources the user can see are returned.
+func DeletedResources(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	since := time.Now().Add(-time.Duration(config.TombstoneRetentionHours()) * time.Hour)
+	if sinceParam := query.Get("since"); sinceParam != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+				"Invalid since parameter, expected RFC3339 time: "+err.Error(), map[string]string{"parameter": "since"})
+			return
+		}
+	}
+	limit, err := intParam(r, "limit", deletedResourcesLimit)
+	if err != nil || limit <= 0 {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+			"Invalid limit parameter, expected a positive number", map[string]string{"parameter": "limit"})
+		return
+	}
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_CLUSTER, err.Error(),
+			map[string]string{"cluster": clusterName})
+		return
+	}
+	access, status, err := searchAccess(r)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+
+	tombstones, err := db.Tombstones(r.Context(), clusterName, since, "")
+	if err != nil {
+		logger.Warning("Error reading tombstones for cluster ", clusterName, ": ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	kind, name, namespace := query.Get("kind"), query.Get("name"), query.Get("namespace")
+	deleted := []db.Tombstone{}
+	for i := len(tombstones) - 1; i >= 0 && len(deleted) < limit; i-- {
+		tombstone := tombstones[i]
+		if (kind != "" && !strings.EqualFold(tombstone.Kind, kind)) || (name != "" && tombstone.Name != name) ||
+			(namespace != "" && tombstone.Namespace != namespace) {
+			continue
+		}
+		if access != nil && !access.Allows(clusterName, tombstone.Namespace) {
+			continue
+		}
+		deleted = append(deleted, tombstone)
+	}
+	if encodeError := json.NewEncoder(w).Encode(deleted); encodeError != nil {
+		logger.Error("Error responding to DeletedResources: ", encodeError)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deleteTombstones(t *testing.T) {
+	received := time.Now()
+	deletedAt := received.Add(-time.Minute)
+	tombstones := deleteTombstones([]DeleteResourceEvent{
+		{UID: "c1/a"},
+		{UID: "c1/b", DeletedAt: deletedAt, Reason: "Evicted"},
+	}, received, 0)
+
+	assert.Equal(t, []db.Tombstone{
+		{UID: "c1/a", DeletedAt: received, RecordedAt: received},
+		{UID: "c1/b", DeletedAt: deletedAt, Reason: "Evicted", RecordedAt: received},
+	}, tombstones)
+
+	// The deletion time sent by a collector with a clock an hour ahead is an hour too late.
+	tombstones = deleteTombstones([]DeleteResourceEvent{{UID: "c1/b", DeletedAt: deletedAt.Add(time.Hour)}},
+		received, time.Hour)
+	assert.Equal(t, deletedAt, tombstones[0].DeletedAt)
+}
+
+func Test_resyncTombstones(t *testing.T) {
+	nodes := map[string]*rg2.Node{
+		"c1/a": {Properties: map[string]interface{}{"kind": "pod", "name": "a", "namespace": "default"}},
+		"c1/b": {Properties: map[string]interface{}{"kind": "pod", "name": "b"}},
+	}
+	tombstones := resyncTombstones(nodes, map[string]error{"c1/b": errors.New("failed")}, time.Now())
+
+	assert.Equal(t, 1, len(tombstones))
+	assert.Equal(t, "c1/a", tombstones[0].UID)
+	assert.Equal(t, "default", tombstones[0].Namespace)
+	assert.Equal(t, db.RESYNC_DELETE_REASON, tombstones[0].Reason)
+}
+
+func Test_Tombstones(t *testing.T) {
+	useTestDatastore(t)
+
+	now := time.Now()
+	recordTombstones("cluster1", 7, deleteTombstones([]DeleteResourceEvent{
+		{UID: "cluster1/a", DeletedAt: now.Add(-2 * time.Hour), Reason: "Evicted"},
+		{UID: "cluster1/b"},
+	}, now, 0))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/tombstones", Tombstones)
+	get := func(url string) (int, []db.Tombstone) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		var tombstones []db.Tombstone
+		_ = json.NewDecoder(w.Body).Decode(&tombstones)
+		return w.Code, tombstones
+	}
+
+	code, tombstones := get("/aggregator/clusters/cluster1/tombstones")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(tombstones))
+	assert.Equal(t, "cluster1/a", tombstones[0].UID)
+	assert.Equal(t, "Evicted", tombstones[0].Reason)
+
+	_, tombstones = get("/aggregator/clusters/cluster1/tombstones?uid=cluster1/b")
+	assert.Equal(t, 1, len(tombstones))
+
+	since := now.Add(-time.Hour).UTC().Format(time.RFC3339)
+	_, tombstones = get("/aggregator/clusters/cluster1/tombstones?since=" + since)
+	assert.Equal(t, 1, len(tombstones))
+	assert.Equal(t, "cluster1/b", tombstones[0].UID)
+
+	code, _ = get("/aggregator/clusters/cluster1/tombstones?since=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestDeletedResources(t *testing.T) {
+	useTestDatastore(t)
+	_, err := db.Store.Query(context.Background(), "CREATE (:Pod {_uid:'cluster1/a', kind:'pod', name:'web', "+
+		"namespace:'default', cluster:'cluster1'})")
+	assert.NoError(t, err)
+
+	now := time.Now()
+	tombstones := deleteTombstones([]DeleteResourceEvent{{UID: "cluster1/a", DeletedAt: now.Add(-time.Hour)},
+		{UID: "cluster1/b", DeletedAt: now.Add(-time.Minute)}}, now, 0)
+	assert.NoError(t, db.DescribeTombstones(context.Background(), tombstones))
+	recordTombstones("cluster1", 42, tombstones)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/deleted", DeletedResources)
+	get := func(url string) (int, []db.Tombstone) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		var deleted []db.Tombstone
+		_ = json.NewDecoder(w.Body).Decode(&deleted)
+		return w.Code, deleted
+	}
+
+	code, deleted := get("/aggregator/clusters/cluster1/deleted")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(deleted))
+	assert.Equal(t, "cluster1/b", deleted[0].UID) // Newest first.
+	assert.Equal(t, "web", deleted[1].Name)
+	assert.Equal(t, 42, deleted[1].RequestId)
+
+	_, deleted = get("/aggregator/clusters/cluster1/deleted?kind=Pod&name=web&namespace=default")
+	assert.Equal(t, 1, len(deleted))
+	assert.Equal(t, "cluster1/a", deleted[0].UID)
+
+	_, deleted = get("/aggregator/clusters/cluster1/deleted?limit=1")
+	assert.Equal(t, 1, len(deleted))
+
+	code, _ = get("/aggregator/clusters/cluster1/deleted?limit=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/aggregator/clusters/cluster1/deleted?since=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+const (
+	topologyDropPercent = 20 // Default share of the resources of a count lost for a drop to be unexpected.
+	topologyMinDrop     = 10 // Default resources of a count lost for a drop to be unexpected.
+	topologyLoggedDrops = 5  // Drops listed in the log by the snapshot job.
+)
+
+// Counts the resources and stores the snapshot. Logs the unexpected drops since the previous snapshot.
+func saveTopologySnapshot(ctx context.Context, now time.Time) (db.TopologySnapshot, error) {
+	snapshot, err := db.TakeTopologySnapshot(ctx, now)
+	if err != nil {
+		return snapshot, err
+	}
+	previous, found, err := db.TopologySnapshotAt(ctx, now)
+	if err != nil {
+		logger.Warning("Error reading the previous topology snapshot: ", err)
+	} else if found {
+		diff := db.DiffTopology(previous, snapshot, topologyDropPercent, topologyMinDrop)
+		if diff.Drops > 0 {
+			logger.Warningf("%d resource counts dropped unexpectedly since the topology snapshot of %s, %d to %d "+
+				"resources in total. The biggest drops:", diff.Drops, previous.TakenAt.Format(time.RFC3339),
+				diff.Before, diff.After)
+			for i, change := range diff.Changes {
+				if i == topologyLoggedDrops || !change.Drop {
+					break
+				}
+				logger.Warningf("  cluster %s kind %s namespace %q: %d to %d", change.Cluster, change.Kind,
+					change.Namespace, change.Before, change.After)
+			}
+		}
+	}
+	return snapshot, db.SaveTopologySnapshot(ctx, snapshot)
+}
+
+// Takes a topology snapshot every TOPOLOGY_SNAPSHOT_RATE_MS, so there's one from before a loss of resources to
+// compare with.
+func TopologySnapshotJob() {
+	if config.Cfg.TopologySnapshotRateMS <= 0 {
+		logger.Info("Disabled the topology snapshots, TOPOLOGY_SNAPSHOT_RATE_MS is 0.")
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.Cfg.TopologySnapshotRateMS) * time.Millisecond)
+		ctx := db.WithLane(context.Background(), db.BulkLane)
+		if _, err := saveTopologySnapshot(ctx, time.Now()); err != nil {
+			logger.Warning("Error taking the topology snapshot: ", err)
+		}
+	}
+}
+
+// CreateTopologySnapshot takes a topology snapshot now and responds with its totals, without the counts.
+func CreateTopologySnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	snapshot, err := saveTopologySnapshot(r.Context(), time.Now())
+	if err != nil {
+		logger.Warning("Error taking the topology snapshot: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	snapshot.Counts = nil
+	if encodeError := json.NewEncoder(w).Encode(snapshot); encodeError != nil {
+		logger.Error("Error responding to CreateTopologySnapshot: ", encodeError)
+	}
+}
+
+// TopologySnapshots responds with the stored topology snapshots, oldest first, without their counts.
+func TopologySnapshots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	snapshots, err := db.TopologySnapshots(r.Context())
+	if err != nil {
+		logger.Warning("Error reading the topology snapshots: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	for i := range snapshots {
+		snapshots[i].Counts = nil
+	}
+	if encodeError := json.NewEncoder(w).Encode(snapshots); encodeError != nil {
+		logger.Error("Error responding to TopologySnapshots: ", encodeError)
+	}
+}
+
+// Reads a time parameter, RFC3339. Returns the zero time when it's not set.
+func timeParam(r *http.Request, name string) (time.Time, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, param)
+}
+
+// Returns the last snapshot taken at or before the time, with the status to respond with when there's none.
+func topologySnapshotAt(ctx context.Context, at time.Time) (db.TopologySnapshot, int, error) {
+	snapshot, found, err := db.TopologySnapshotAt(ctx, at)
+	if err != nil {
+		return snapshot, http.StatusServiceUnavailable, err
+	}
+	if !found {
+		return snapshot, http.StatusNotFound, withErrorCode(fmt.Errorf("no topology snapshot taken at or before %s",
+			at.Format(time.RFC3339)), ERROR_SNAPSHOT_NOT_FOUND, map[string]string{"time": at.Format(time.RFC3339)})
+	}
+	return snapshot, http.StatusOK, nil
+}
+
+// TopologyDiff responds with the changes of the resource counts between the snapshots taken at or before the from
+// and to times (RFC3339). Without from it compares the last snapshot, without to it compares with the counts now.
+// Use dropPercent and minDrop to tune the drops flagged as unexpected.
+func TopologyDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	from, err := timeParam(r, "from")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+			"Invalid from parameter, expected RFC3339 time: "+err.Error(), map[string]string{"parameter": "from"})
+		return
+	}
+	to, err := timeParam(r, "to")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+			"Invalid to parameter, expected RFC3339 time: "+err.Error(), map[string]string{"parameter": "to"})
+		return
+	}
+	dropPercent, err := intParam(r, "dropPercent", topologyDropPercent)
+	if err != nil || dropPercent < 0 || dropPercent > 100 {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+			"Invalid dropPercent parameter, expected a number from 0 to 100",
+			map[string]string{"parameter": "dropPercent"})
+		return
+	}
+	minDrop, err := intParam(r, "minDrop", topologyMinDrop)
+	if err != nil || minDrop < 0 {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+			"Invalid minDrop parameter, expected a positive number", map[string]string{"parameter": "minDrop"})
+		return
+	}
+
+	now := time.Now()
+	if from.IsZero() {
+		from = now
+	}
+	before, status, err := topologySnapshotAt(r.Context(), from)
+	if err != nil {
+		respondStatusError(w, status, err)
+		return
+	}
+	after := db.TopologySnapshot{}
+	if to.IsZero() {
+		after, err = db.TakeTopologySnapshot(r.Context(), now)
+		status = http.StatusServiceUnavailable
+	} else {
+		after, status, err = topologySnapshotAt(r.Context(), to)
+	}
+	if err != nil {
+		logger.Warning("Error reading the topology snapshots: ", err)
+		respondStatusError(w, status, err)
+		return
+	}
+
+	diff := db.DiffTopology(before, after, dropPercent, minDrop)
+	if encodeError := json.NewEncoder(w).Encode(diff); encodeError != nil {
+		logger.Error("Error responding to TopologyDiff: ", encodeError)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopologyDiff(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	config.Cfg.TopologyRetentionHours = 48
+	ctx := context.Background()
+	_, err := db.Store.Query(ctx, "CREATE (:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Pod {_uid:'c1/a', kind:'pod', cluster:'c1', namespace:'default'}), "+
+		"(:Pod {_uid:'c1/b', kind:'pod', cluster:'c1', namespace:'default'})")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	CreateTopologySnapshot(w, httptest.NewRequest("POST", "/aggregator/admin/topology/snapshots", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var snapshot db.TopologySnapshot
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&snapshot))
+	assert.Equal(t, 2, snapshot.Total)
+	assert.Nil(t, snapshot.Counts)
+
+	w = httptest.NewRecorder()
+	TopologySnapshots(w, httptest.NewRequest("GET", "/aggregator/admin/topology/snapshots", nil))
+	var snapshots []db.TopologySnapshot
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&snapshots))
+	assert.Equal(t, 1, len(snapshots))
+
+	_, err = db.Store.Query(ctx, "MATCH (n:Pod {_uid:'c1/a'}) DELETE n")
+	assert.NoError(t, err)
+	get := func(query string) (int, db.TopologyDiff) {
+		w := httptest.NewRecorder()
+		TopologyDiff(w, httptest.NewRequest("GET", "/aggregator/admin/topology/diff?"+query, nil))
+		var diff db.TopologyDiff
+		_ = json.NewDecoder(w.Body).Decode(&diff)
+		return w.Code, diff
+	}
+
+	code, diff := get("minDrop=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, diff.Drops)
+	assert.Equal(t, []db.TopologyChange{{Cluster: "c1", Kind: "pod", Namespace: "default", Before: 2, After: 1,
+		Delta: -1, Drop: true}}, diff.Changes)
+
+	_, diff = get("") // Below the default minDrop.
+	assert.Equal(t, 0, diff.Drops)
+
+	code, _ = get("from=" + url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339)))
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get("to=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("dropPercent=200")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
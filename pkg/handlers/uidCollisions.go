@@ -0,0 +1,156 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Policies for the resources sent with the UID of a resource in another cluster, from UID_COLLISION_POLICY.
+const (
+	UID_COLLISION_KEEP_NEWEST = "keep-newest" // Keep the resource created last, the other one is deleted or rejected.
+	UID_COLLISION_REJECT      = "reject"      // Reject the incoming resource, the first cluster to report it wins.
+	UID_COLLISION_SUFFIX      = "suffix"      // Keep both, the UIDs are told apart by their cluster prefix.
+)
+
+// Reason of the tombstones of the resources replaced by the keep-newest policy.
+const UID_COLLISION_DELETE_REASON = "Replaced by a newer resource with the same UID in another cluster"
+
+// Applies the UID_COLLISION_POLICY to the added resources with the UID of a resource in another cluster, e.g. from
+// a restored or cloned cluster. Removes the rejected resources from the syncEvent and returns their errors.
+// Every collision is recorded for the admin report.
+func resolveUIDCollisions(ctx context.Context, clusterName string, syncEvent *SyncEvent, now time.Time) (
+	[]SyncError, error) {
+	if len(syncEvent.AddResources) == 0 {
+		return nil, nil
+	}
+	policy := config.Cfg.UIDCollisionPolicy
+	if policy != UID_COLLISION_KEEP_NEWEST && policy != UID_COLLISION_REJECT && policy != UID_COLLISION_SUFFIX {
+		logger.Warningf("Unknown UID_COLLISION_POLICY %q, using %s.", policy, UID_COLLISION_SUFFIX)
+		policy = UID_COLLISION_SUFFIX
+	}
+	uids := make([]string, 0, len(syncEvent.AddResources))
+	for _, r := range syncEvent.AddResources {
+		uids = append(uids, r.UID)
+	}
+	found, err := db.FindUIDCollisions(ctx, clusterName, uids)
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+
+	var rejected []SyncError
+	var collisions []db.UIDCollision
+	replaced := map[string][]db.CollidingNode{} // Keyed by cluster.
+	added := make([]*db.Resource, 0, len(syncEvent.AddResources))
+	for _, r := range syncEvent.AddResources {
+		existing := found[r.UID]
+		if len(existing) == 0 {
+			added = append(added, r)
+			continue
+		}
+		action := "kept"
+		switch policy {
+		case UID_COLLISION_REJECT:
+			action = "rejected"
+		case UID_COLLISION_KEEP_NEWEST:
+			action = "rejected"
+			if created, _ := r.Properties["created"].(string); newerThanAll(created, existing) {
+				action = "replaced"
+			}
+		}
+		for _, node := range existing {
+			collision := db.UIDCollision{UID: r.UID, Cluster: clusterName, ExistingUID: node.UID,
+				ExistingCluster: node.Cluster, Policy: policy, Action: action, DetectedAt: now}
+			collision.Kind, _ = r.Properties["kind"].(string)
+			collision.Name, _ = r.Properties["name"].(string)
+			collisions = append(collisions, collision)
+			if action == "replaced" {
+				replaced[node.Cluster] = append(replaced[node.Cluster], node)
+			}
+		}
+		metrics.UIDCollisions.WithLabelValues(action).Inc()
+		logger.V(2).Infof("Resource %s from cluster %s has the UID of %s, %s by the %s policy", r.UID, clusterName,
+			existing[0].UID, action, policy)
+		if action == "rejected" {
+			rejected = append(rejected, SyncError{ResourceUID: r.UID, Code: ERROR_UID_COLLISION,
+				Message: "A resource with the same UID exists in cluster " + existing[0].Cluster})
+			continue
+		}
+		added = append(added, r)
+	}
+	syncEvent.AddResources = added
+
+	for cluster, nodes := range replaced {
+		deleteUIDs := make([]string, 0, len(nodes))
+		tombstones := make([]db.Tombstone, 0, len(nodes))
+		for _, node := range nodes {
+			deleteUIDs = append(deleteUIDs, node.UID)
+			tombstones = append(tombstones, db.Tombstone{UID: node.UID, DeletedAt: now,
+				Reason: UID_COLLISION_DELETE_REASON, RecordedAt: now})
+		}
+		if opErr := db.ChunkedDelete(ctx, deleteUIDs).Err(); opErr != nil {
+			return rejected, opErr
+		}
+		cluster, requestID := cluster, syncEvent.RequestId
+		runInBackground(func() { recordTombstones(cluster, requestID, tombstones) })
+	}
+	runInBackground(func() { recordUIDCollisions(collisions) })
+	return rejected, nil
+}
+
+// Tells whether the creation time is after the creation time of all the nodes, nodes without one are older.
+// A resource without a creation time is never newer, and ties keep the resource reported first.
+func newerThanAll(created string, nodes []db.CollidingNode) bool {
+	createdTime, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return false
+	}
+	for _, node := range nodes {
+		nodeTime, err := time.Parse(time.RFC3339, node.Created)
+		if err == nil && !createdTime.After(nodeTime) {
+			return false
+		}
+	}
+	return true
+}
+
+func recordUIDCollisions(collisions []db.UIDCollision) {
+	err := db.RecordUIDCollisions(context.Background(), collisions)
+	if err != nil {
+		logger.Warning("Error recording UID collisions: ", err)
+	}
+}
+
+// UIDCollisions responds with the UID collisions detected across clusters, oldest first.
+// Use the since parameter (RFC3339) to get only the recent collisions, defaults to the whole retention period.
+func UIDCollisions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	since := time.Now().Add(-time.Duration(config.Cfg.CollisionRetentionHours) * time.Hour)
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER,
+				"Invalid since parameter, expected RFC3339 time: "+err.Error(), map[string]string{"parameter": "since"})
+			return
+		}
+	}
+
+	collisions, err := db.UIDCollisions(r.Context(), since)
+	if err != nil {
+		logger.Warning("Error reading UID collisions: ", err)
+		respondError(w, http.StatusServiceUnavailable, ERROR_DATASTORE_UNAVAILABLE, err.Error(), nil)
+		return
+	}
+	if encodeError := json.NewEncoder(w).Encode(collisions); encodeError != nil {
+		logger.Error("Error responding to UIDCollisions: ", encodeError)
+	}
+}
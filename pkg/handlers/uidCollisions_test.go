@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resolveUIDCollisions(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	useTestDatastore(t)
+	ctx := context.Background()
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	pod := func(uid, created string) *db.Resource {
+		return &db.Resource{Kind: "Pod", UID: uid,
+			Properties: map[string]interface{}{"kind": "Pod", "name": "a", "created": created, "cluster": uid[:2]}}
+	}
+	insert := db.ChunkedInsert(ctx, []*db.Resource{pod("c1/a", "2021-06-01T09:00:00Z")}, "")
+	assert.Equal(t, 1, insert.SuccessfulResources)
+
+	config.Cfg.UIDCollisionPolicy = UID_COLLISION_SUFFIX
+	event := SyncEvent{AddResources: []*db.Resource{pod("c2/a", "2021-06-01T09:30:00Z"), pod("c2/b", "")}}
+	rejected, err := resolveUIDCollisions(ctx, "c2", &event, now)
+	assert.Nil(t, err)
+	assert.Empty(t, rejected)
+	assert.Equal(t, 2, len(event.AddResources))
+
+	config.Cfg.UIDCollisionPolicy = UID_COLLISION_REJECT
+	event = SyncEvent{AddResources: []*db.Resource{pod("c2/a", "2021-06-01T09:30:00Z"), pod("c2/b", "")}}
+	rejected, err = resolveUIDCollisions(ctx, "c2", &event, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []SyncError{{ResourceUID: "c2/a", Message: "A resource with the same UID exists in cluster c1",
+		Code: ERROR_UID_COLLISION}}, rejected)
+	assert.Equal(t, []*db.Resource{pod("c2/b", "")}, event.AddResources)
+
+	// The older resource is rejected, the newer one replaces c1/a.
+	config.Cfg.UIDCollisionPolicy = UID_COLLISION_KEEP_NEWEST
+	event = SyncEvent{AddResources: []*db.Resource{pod("c2/a", "2021-06-01T08:00:00Z")}}
+	rejected, err = resolveUIDCollisions(ctx, "c2", &event, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rejected))
+	event = SyncEvent{AddResources: []*db.Resource{pod("c2/a", "2021-06-01T09:30:00Z")}}
+	rejected, err = resolveUIDCollisions(ctx, "c2", &event, now)
+	assert.Nil(t, err)
+	assert.Empty(t, rejected)
+	assert.Equal(t, 1, len(event.AddResources))
+	found, err := db.FindUIDCollisions(ctx, "c2", []string{"c2/a"})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+}
+
+func Test_newerThanAll(t *testing.T) {
+	nodes := []db.CollidingNode{{Created: "2021-06-01T09:00:00Z"}, {Created: ""}}
+	assert.True(t, newerThanAll("2021-06-01T10:00:00Z", nodes))
+	assert.False(t, newerThanAll("2021-06-01T09:00:00Z", nodes))
+	assert.False(t, newerThanAll("", nodes))
+}
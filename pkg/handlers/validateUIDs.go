@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Normalizes the UIDs in the syncEvent in place and removes the resources and edges with UIDs that can't be fixed.
+// Returns a SyncResponse holding only the errors for the rejected items.
+func validateUIDs(clusterName string, syncEvent *SyncEvent) SyncResponse {
+	rejected := SyncResponse{}
+
+	// Returns the normalized UID, or an error if the UID was rejected.
+	normalize := func(uid string) (string, error) {
+		normalized, reason, err := db.NormalizeUID(uid, clusterName)
+		if err != nil {
+			metrics.InvalidUIDs.WithLabelValues("rejected", reason).Inc()
+			logger.V(2).Infof("Rejecting UID [%s] from cluster %s: %s", uid, clusterName, err)
+		} else if reason != "" {
+			metrics.InvalidUIDs.WithLabelValues("normalized", reason).Inc()
+			logger.V(4).Infof("Normalized UID [%s] from cluster %s to [%s]", uid, clusterName, normalized)
+		}
+		return normalized, err
+	}
+
+	validateResources := func(resources []*db.Resource) ([]*db.Resource, []SyncError) {
+		valid := make([]*db.Resource, 0, len(resources))
+		var errs []SyncError
+		for _, r := range resources {
+			uid, err := normalize(r.UID)
+			if err != nil {
+				errs = append(errs, invalidUIDError(r.UID, err))
+				continue
+			}
+			r.UID = uid
+			valid = append(valid, r)
+		}
+		return valid, errs
+	}
+
+	validateEdges := func(edges []db.Edge) ([]db.Edge, []SyncError) {
+		valid := make([]db.Edge, 0, len(edges))
+		var errs []SyncError
+		for _, e := range edges {
+			sourceUID, sourceErr := normalize(e.SourceUID)
+			destUID, destErr := normalize(e.DestUID)
+			if sourceErr != nil {
+				errs = append(errs, invalidUIDError(e.SourceUID, sourceErr))
+				continue
+			}
+			if destErr != nil {
+				errs = append(errs, invalidUIDError(e.DestUID, destErr))
+				continue
+			}
+			e.SourceUID, e.DestUID = sourceUID, destUID
+			valid = append(valid, e)
+		}
+		return valid, errs
+	}
+
+	syncEvent.AddResources, rejected.AddErrors = validateResources(syncEvent.AddResources)
+	syncEvent.UpdateResources, rejected.UpdateErrors = validateResources(syncEvent.UpdateResources)
+
+	deleteResources := make([]DeleteResourceEvent, 0, len(syncEvent.DeleteResources))
+	for _, de := range syncEvent.DeleteResources {
+		uid, err := normalize(de.UID)
+		if err != nil {
+			rejected.DeleteErrors = append(rejected.DeleteErrors, invalidUIDError(de.UID, err))
+			continue
+		}
+		de.UID = uid
+		deleteResources = append(deleteResources, de)
+	}
+	syncEvent.DeleteResources = deleteResources
+
+	unchangedResources := make([]string, 0, len(syncEvent.UnchangedResources))
+	for _, unchangedUID := range syncEvent.UnchangedResources {
+		uid, err := normalize(unchangedUID)
+		if err != nil {
+			rejected.AddErrors = append(rejected.AddErrors, invalidUIDError(unchangedUID, err))
+			continue
+		}
+		unchangedResources = append(unchangedResources, uid)
+	}
+	syncEvent.UnchangedResources = unchangedResources
+
+	syncEvent.AddEdges, rejected.AddEdgeErrors = validateEdges(syncEvent.AddEdges)
+	syncEvent.DeleteEdges, rejected.DeleteEdgeErrors = validateEdges(syncEvent.DeleteEdges)
+
+	return rejected
+}
+
+func invalidUIDError(uid string, err error) SyncError {
+	return SyncError{ResourceUID: uid, Message: err.Error(), Code: ERROR_INVALID_UID}
+}
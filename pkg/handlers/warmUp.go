@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+)
+
+// Progress of the warm up. The readiness probe fails until it's done, or for WARM_UP_TIMEOUT_MS at most.
+type warmUpStatus struct {
+	started  time.Time
+	finished time.Time
+	step     string // Step in progress, empty once finished.
+}
+
+var (
+	warmUp      warmUpStatus
+	warmUpMutex = sync.RWMutex{}
+)
+
+func setWarmUpStep(step string) {
+	warmUpMutex.Lock()
+	defer warmUpMutex.Unlock()
+	warmUp.step = step
+}
+
+// Returns whether the readiness probe waits for the warm up, and the step in progress. It doesn't wait when the
+// warm up didn't start or is disabled, or once it's done or WARM_UP_TIMEOUT_MS is over.
+func warmingUp(now time.Time) (bool, string) {
+	warmUpMutex.RLock()
+	defer warmUpMutex.RUnlock()
+	timeout := time.Duration(config.Cfg.WarmUpTimeoutMS) * time.Millisecond
+	if timeout <= 0 || warmUp.started.IsZero() || !warmUp.finished.IsZero() || now.Sub(warmUp.started) >= timeout {
+		return false, ""
+	}
+	return true, warmUp.step
+}
+
+// Waits for the datastore, then preloads its UID indexes, the schema and the summaries of the clusters before the
+// aggregator reports ready, so the first syncs and searches don't all hit a cold aggregator. A step that fails is
+// logged and skipped, the caches also fill up as the resources are written.
+func WarmUp() {
+	start := time.Now()
+	warmUpMutex.Lock()
+	warmUp = warmUpStatus{started: start, step: "datastore"}
+	warmUpMutex.Unlock()
+	ctx := db.WithLane(context.Background(), db.BulkLane)
+
+	for err := db.PingDatastore(); err != nil; err = db.PingDatastore() {
+		logger.V(2).Info("Warm up waiting for the datastore: ", err)
+		time.Sleep(time.Second)
+	}
+
+	setWarmUpStep("uidIndexes")
+	kinds, err := db.WarmUpUIDIndexes(ctx)
+	if err != nil {
+		logger.Warning("Error warming up the UID indexes: ", err)
+	}
+
+	setWarmUpStep("schema")
+	edgeTypes, err := db.WarmUpSchema(ctx, kinds)
+	if err != nil {
+		logger.Warning("Error warming up the schema: ", err)
+	}
+
+	setWarmUpStep("clusterSummaries")
+	summaries := 0
+	clusters, err := db.ClusterNames(ctx)
+	if err == nil {
+		var existing map[string]bool
+		if existing, err = db.ClusterSummaryNames(ctx); err == nil {
+			for _, clusterName := range clusters {
+				if !existing[clusterName] {
+					updateClusterSummary(clusterName)
+					summaries++
+				}
+			}
+		}
+	}
+	if err != nil {
+		logger.Warning("Error warming up the cluster summaries: ", err)
+	}
+
+	warmUpMutex.Lock()
+	warmUp.finished, warmUp.step = time.Now(), ""
+	warmUpMutex.Unlock()
+	logger.Infof("Warm up done in %s: %d kinds, %d edge types and %d new cluster summaries", time.Since(start),
+		len(kinds), edgeTypes, summaries)
+}
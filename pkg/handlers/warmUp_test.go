@@ -0,0 +1,59 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_warmingUp(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	prevWarmUp := warmUp
+	defer func() { warmUp = prevWarmUp }()
+	config.Cfg.WarmUpTimeoutMS = 60000
+	now := time.Now()
+
+	warmUp = warmUpStatus{}
+	warming, _ := warmingUp(now)
+	assert.False(t, warming, "Not started")
+
+	warmUp = warmUpStatus{started: now.Add(-time.Second), step: "schema"}
+	warming, step := warmingUp(now)
+	assert.True(t, warming)
+	assert.Equal(t, "schema", step)
+
+	warming, _ = warmingUp(now.Add(time.Minute))
+	assert.False(t, warming, "Timed out")
+
+	config.Cfg.WarmUpTimeoutMS = 0
+	warming, _ = warmingUp(now)
+	assert.False(t, warming, "Disabled")
+}
+
+func TestWarmUp(t *testing.T) {
+	prevWarmUp := warmUp
+	useTestDatastore(t)
+	defer func() { warmUp = prevWarmUp }()
+	ctx := context.Background()
+
+	_, err := db.Store.Query(ctx, "CREATE (c:Cluster {_uid:'cluster__c1', kind:'cluster', name:'c1'}), "+
+		"(:Pod {_uid:'c1/p', kind:'Pod', cluster:'c1', name:'p', status:'Running'})-[:inCluster]->(c)")
+	assert.NoError(t, err)
+
+	WarmUp()
+	warming, _ := warmingUp(time.Now())
+	assert.False(t, warming)
+	assert.False(t, warmUp.finished.IsZero())
+	result, err := db.Store.Query(ctx, "MATCH (s:ClusterSummary {name:'c1'}) RETURN s.totalResources")
+	assert.NoError(t, err)
+	if assert.True(t, result.Next()) {
+		assert.Equal(t, 1, result.Record().GetByIndex(0))
+	}
+}
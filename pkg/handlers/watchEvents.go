@@ -0,0 +1,161 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/open-cluster-management/search-aggregator/pkg/eventsink"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+)
+
+// Events buffered for a subscriber of the watch API. A subscriber falling this far behind is disconnected, so a slow
+// consumer can't hold back the syncs.
+const eventWatcherBuffer = 1024
+
+// A subscriber of the watch API, with its own filter.
+type eventWatcher struct {
+	filter    eventsink.Filter
+	sequence  int64 // Of the last event sent to the subscriber, guarded by eventWatchersMutex.
+	send      chan eventsink.Event
+	done      chan struct{} // Closed when the subscriber disconnects or falls behind.
+	closeOnce sync.Once
+}
+
+var (
+	eventWatchers      = make(map[*eventWatcher]bool)
+	eventWatchersMutex = sync.Mutex{}
+)
+
+// WatchEvents upgrades the request to a WebSocket streaming the changes applied by the syncs, one JSON text frame per
+// event, as they're published to EVENT_SINK. The filter parameter, in the search syntax, e.g. kind:pod status:Failed,
+// is evaluated before each event is sent, so a subscriber only receives the slice it's interested in.
+func WatchEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := eventsink.ParseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, ERROR_INVALID_PARAMETER, err.Error(),
+			map[string]string{"parameter": "filter"})
+		return
+	}
+	conn, err := sessionUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Warning("Error opening event watch: ", err) // Upgrade already responded.
+		return
+	}
+	watcher := addEventWatcher(filter)
+	defer watcher.close()
+	logger.Infof("Opened event watch with filter %q", r.URL.Query().Get("filter"))
+
+	go watcher.writeEvents(conn)
+	watcher.readMessages(conn)
+	logger.Info("Closed event watch")
+}
+
+func addEventWatcher(filter eventsink.Filter) *eventWatcher {
+	watcher := &eventWatcher{
+		filter: filter,
+		send:   make(chan eventsink.Event, eventWatcherBuffer),
+		done:   make(chan struct{}),
+	}
+	eventWatchersMutex.Lock()
+	eventWatchers[watcher] = true
+	eventWatchersMutex.Unlock()
+	metrics.EventWatchers.Inc()
+	return watcher
+}
+
+func (e *eventWatcher) close() {
+	e.closeOnce.Do(func() {
+		eventWatchersMutex.Lock()
+		delete(eventWatchers, e)
+		eventWatchersMutex.Unlock()
+		close(e.done)
+		metrics.EventWatchers.Dec()
+	})
+}
+
+// Returns whether the watch API has subscribers.
+func hasEventWatchers() bool {
+	eventWatchersMutex.Lock()
+	defer eventWatchersMutex.Unlock()
+	return len(eventWatchers) > 0
+}
+
+// Sends the events matching the filter of each subscriber, numbered for the subscriber. Never blocks, the
+// subscribers whose buffer is full are disconnected.
+func broadcastEvents(events []eventsink.Event) {
+	eventWatchersMutex.Lock()
+	defer eventWatchersMutex.Unlock()
+	for watcher := range eventWatchers {
+		for _, event := range events {
+			if !watcher.filter.Match(event) {
+				continue
+			}
+			watcher.sequence++
+			event.Sequence = watcher.sequence
+			select {
+			case watcher.send <- event:
+				continue
+			default:
+			}
+			logger.Warningf("Disconnecting an event watch, it's more than %d events behind.", eventWatcherBuffer)
+			delete(eventWatchers, watcher)
+			go watcher.close() // Waits for the broadcast to release eventWatchersMutex.
+			break
+		}
+	}
+}
+
+// Discards the messages of the subscriber until the connection is closed, so the pongs are processed.
+func (e *eventWatcher) readMessages(conn *websocket.Conn) {
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait()))
+	})
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(pongWait())); err != nil {
+			return
+		}
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Warning("Error reading from event watch: ", err)
+			}
+			return
+		}
+	}
+}
+
+// Writes the events to the connection and pings the subscriber, until the watch ends.
+// This is the only goroutine writing to the connection.
+func (e *eventWatcher) writeEvents(conn *websocket.Conn) {
+	ticker := time.NewTicker(time.Duration(config.Cfg.SessionPingIntervalMS) * time.Millisecond)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	writeWait := pongWait()
+	for {
+		select {
+		case event := <-e.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(event); err != nil {
+				logger.Warning("Error writing to event watch: ", err)
+				e.close()
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				e.close()
+				return
+			}
+		case <-e.done:
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+			return
+		}
+	}
+}
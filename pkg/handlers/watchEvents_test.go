@@ -0,0 +1,112 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/eventsink"
+	"github.com/stretchr/testify/assert"
+)
+
+func eventWatcherCount() int {
+	eventWatchersMutex.Lock()
+	defer eventWatchersMutex.Unlock()
+	return len(eventWatchers)
+}
+
+// Opens a watch with the filter against a test server, and waits until the aggregator registered it.
+func dialWatch(t *testing.T, server *httptest.Server, filter string) *websocket.Conn {
+	watchURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/aggregator/admin/watch?filter=" +
+		url.QueryEscape(filter)
+	previous := eventWatcherCount()
+	conn, _, err := websocket.DefaultDialer.Dial(watchURL, nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return eventWatcherCount() > previous }, time.Second, 10*time.Millisecond)
+	return conn
+}
+
+func readWatchEvent(t *testing.T, conn *websocket.Conn) eventsink.Event {
+	var event eventsink.Event
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	assert.NoError(t, conn.ReadJSON(&event))
+	return event
+}
+
+func Test_WatchEvents(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.EventSink = "" // The watch API works without the event sink.
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/admin/watch", WatchEvents)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	failed := dialWatch(t, server, "kind:pod status:Failed")
+	defer failed.Close()
+	edges := dialWatch(t, server, "op:edgeAdded")
+	defer edges.Close()
+
+	// Each subscriber only receives the events matching its filter.
+	ctx := context.Background()
+	resources := []*db.Resource{
+		{UID: "c1/pod-1", Properties: map[string]interface{}{"kind": "pod", "status": "Running"}},
+		{UID: "c1/pod-2", Properties: map[string]interface{}{"kind": "pod", "status": "Failed"}},
+		{UID: "c1/pod-3", Properties: map[string]interface{}{"kind": "pod", "status": "Failed"}},
+	}
+	publishResources(ctx, "c1", 1, eventsink.NodeUpdated, resources, db.ChunkedOperationResult{})
+	publishEdges(ctx, "c1", 1, eventsink.EdgeAdded, []db.Edge{{SourceUID: "c1/pod-2", EdgeType: "runsOn",
+		DestUID: "c1/node-1"}}, db.ChunkedOperationResult{})
+
+	event := readWatchEvent(t, failed)
+	assert.Equal(t, "c1/pod-2", event.UID)
+	assert.Equal(t, int64(1), event.Sequence)
+	event = readWatchEvent(t, failed)
+	assert.Equal(t, "c1/pod-3", event.UID)
+	assert.Equal(t, int64(2), event.Sequence)
+	event = readWatchEvent(t, edges)
+	assert.Equal(t, eventsink.EdgeAdded, event.Op)
+	assert.Equal(t, "c1/pod-2", event.SourceUID)
+	assert.Equal(t, int64(1), event.Sequence)
+	assert.Empty(t, queuedEvents(), "Nothing is queued for the event sink without EVENT_SINK.")
+
+	// Closed watches are removed.
+	failed.Close()
+	edges.Close()
+	assert.Eventually(t, func() bool { return !hasEventWatchers() }, time.Second, 10*time.Millisecond)
+}
+
+func Test_WatchEvents_invalidFilter(t *testing.T) {
+	w := httptest.NewRecorder()
+	WatchEvents(w, httptest.NewRequest("GET", "/aggregator/admin/watch?filter=status", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), string(ERROR_INVALID_PARAMETER))
+}
+
+// A subscriber that falls behind is disconnected instead of holding back the syncs.
+func Test_broadcastEvents_slowWatcher(t *testing.T) {
+	watcher := addEventWatcher(eventsink.Filter{})
+	defer watcher.close()
+
+	events := make([]eventsink.Event, eventWatcherBuffer+1)
+	for i := range events {
+		events[i] = eventsink.Event{Op: eventsink.NodeDeleted, Cluster: "c1", UID: "c1/pod"}
+	}
+	broadcastEvents(events)
+	select {
+	case <-watcher.done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "The watcher wasn't disconnected")
+	}
+	assert.Len(t, watcher.send, eventWatcherBuffer)
+}
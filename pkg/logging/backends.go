@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package logging
+
+import (
+	"github.com/golang/glog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Frames between the backend and the code logging: the Logger or Verbose method and the Log of the backend.
+const callerDepth = 2
+
+// Writes the logs with glog, configured by its flags, e.g. -logtostderr. The verbosity is the one of the module,
+// not the -v flag.
+type glogBackend struct{}
+
+func (glogBackend) Log(severity Severity, module, message string) {
+	switch severity {
+	case WarningLog:
+		glog.WarningDepth(callerDepth, message)
+	case ErrorLog:
+		glog.ErrorDepth(callerDepth, message)
+	case FatalLog:
+		glog.FatalDepth(callerDepth, message)
+	default:
+		glog.InfoDepth(callerDepth, message)
+	}
+}
+
+func (glogBackend) Flush() {
+	glog.Flush()
+}
+
+// Writes the logs as JSON with zap, with the module of each message.
+type zapBackend struct {
+	logger *zap.Logger
+}
+
+// Returns a backend writing JSON logs to stderr with zap, for log collectors parsing structured logs.
+func NewZapBackend() (Backend, error) {
+	cfg := zap.NewProductionConfig()
+	cfg.Sampling = nil // The verbosity of the modules already limits the messages.
+	cfg.DisableStacktrace = true
+	cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	logger, err := cfg.Build(zap.AddCallerSkip(callerDepth))
+	if err != nil {
+		return nil, err
+	}
+	return zapBackend{logger: logger}, nil
+}
+
+func (b zapBackend) Log(severity Severity, module, message string) {
+	field := zap.String("module", module)
+	switch severity {
+	case WarningLog:
+		b.logger.Warn(message, field)
+	case ErrorLog:
+		b.logger.Error(message, field)
+	case FatalLog:
+		b.logger.Fatal(message, field)
+	default:
+		b.logger.Info(message, field)
+	}
+}
+
+func (b zapBackend) Flush() {
+	_ = b.logger.Sync() // Fails for stderr on some platforms, there's nothing to flush then.
+}
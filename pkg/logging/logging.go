@@ -0,0 +1,179 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package logging writes the logs of the aggregator through a pluggable backend, glog by default, with a verbosity
+// for each module that can be changed while the aggregator runs.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Severity of a log message.
+type Severity int
+
+const (
+	InfoLog Severity = iota
+	WarningLog
+	ErrorLog
+	FatalLog // Exits after logging.
+)
+
+// Backend writes the log messages. Log is called 2 frames below the code logging, so backends can report its
+// file and line.
+type Backend interface {
+	Log(severity Severity, module, message string)
+	Flush()
+}
+
+// Returned by SetVerbosity for a module without a logger.
+var ErrUnknownModule = errors.New("Unknown module")
+
+var (
+	backend     Backend = glogBackend{}
+	backendName         = "glog"
+
+	// Verbosity of each module with its own, the other modules use the global one.
+	modules         = make(map[string]bool)
+	moduleVerbosity = make(map[string]int)
+	verbosity       int
+	mutex           = sync.RWMutex{}
+)
+
+// Sets the backend writing the logs, e.g. NewZapBackend.
+func SetBackend(name string, b Backend) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	backend, backendName = b, name
+}
+
+func currentBackend() Backend {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return backend
+}
+
+// Flushes the logs written by the backend, call it before exiting.
+func Flush() {
+	currentBackend().Flush()
+}
+
+// Sets the verbosity of the module, or the global verbosity when module is empty. The V messages of a module are
+// logged up to its verbosity. A negative level on a module removes its own, it goes back to the global one.
+func SetVerbosity(module string, level int) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	switch {
+	case module == "":
+		verbosity = level
+	case !modules[module]:
+		return fmt.Errorf("%w %s", ErrUnknownModule, module)
+	case level < 0:
+		delete(moduleVerbosity, module)
+	default:
+		moduleVerbosity[module] = level
+	}
+	return nil
+}
+
+// Returns the verbosity of the module, its own or the global one.
+func Verbosity(module string) int {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if level, ok := moduleVerbosity[module]; ok {
+		return level
+	}
+	return verbosity
+}
+
+// Current backend and verbosities, as in the logging admin API.
+type LevelStatus struct {
+	Backend   string         `json:"backend"`
+	Verbosity int            `json:"verbosity"` // Global verbosity.
+	Modules   map[string]int `json:"modules"`   // Verbosity of each module, its own or the global one.
+	Overrides []string       `json:"overrides"` // Modules with their own verbosity.
+}
+
+// Returns the backend and the verbosity of each module.
+func Levels() LevelStatus {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	status := LevelStatus{Backend: backendName, Verbosity: verbosity, Modules: make(map[string]int, len(modules)),
+		Overrides: []string{}}
+	for module := range modules {
+		status.Modules[module] = verbosity
+		if level, ok := moduleVerbosity[module]; ok {
+			status.Modules[module] = level
+			status.Overrides = append(status.Overrides, module)
+		}
+	}
+	sort.Strings(status.Overrides)
+	return status
+}
+
+// Logs the messages of a module, e.g. dbconnector or handlers, with the methods of glog.
+type Logger struct {
+	module string
+}
+
+// Returns the logger of the module, registering it so its verbosity can be set.
+func Module(name string) Logger {
+	mutex.Lock()
+	defer mutex.Unlock()
+	modules[name] = true
+	return Logger{module: name}
+}
+
+func (l Logger) Info(args ...interface{}) {
+	currentBackend().Log(InfoLog, l.module, fmt.Sprint(args...))
+}
+
+func (l Logger) Infof(format string, args ...interface{}) {
+	currentBackend().Log(InfoLog, l.module, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Warning(args ...interface{}) {
+	currentBackend().Log(WarningLog, l.module, fmt.Sprint(args...))
+}
+
+func (l Logger) Warningf(format string, args ...interface{}) {
+	currentBackend().Log(WarningLog, l.module, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Error(args ...interface{}) {
+	currentBackend().Log(ErrorLog, l.module, fmt.Sprint(args...))
+}
+
+func (l Logger) Errorf(format string, args ...interface{}) {
+	currentBackend().Log(ErrorLog, l.module, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Fatal(args ...interface{}) {
+	currentBackend().Log(FatalLog, l.module, fmt.Sprint(args...))
+}
+
+// Returns whether the messages of the level are logged for the module, like glog.V.
+func (l Logger) V(level int) Verbose {
+	return Verbose{enabled: level <= Verbosity(l.module), module: l.module}
+}
+
+// Logs the messages of a verbosity level when it's enabled for the module.
+type Verbose struct {
+	enabled bool
+	module  string
+}
+
+func (v Verbose) Info(args ...interface{}) {
+	if v.enabled {
+		currentBackend().Log(InfoLog, v.module, fmt.Sprint(args...))
+	}
+}
+
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v.enabled {
+		currentBackend().Log(InfoLog, v.module, fmt.Sprintf(format, args...))
+	}
+}
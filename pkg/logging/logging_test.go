@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package logging
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Keeps the messages logged, to check what is logged at each verbosity.
+type recordingBackend struct {
+	messages []string
+}
+
+func (b *recordingBackend) Log(severity Severity, module, message string) {
+	b.messages = append(b.messages, module+": "+message)
+}
+
+func (b *recordingBackend) Flush() {}
+
+func TestVerbosity(t *testing.T) {
+	recorder := &recordingBackend{}
+	prevBackend, prevName := currentBackend(), Levels().Backend
+	SetBackend("recording", recorder)
+	defer func() {
+		SetBackend(prevName, prevBackend)
+		_ = SetVerbosity("", 0)
+		_ = SetVerbosity("test-db", -1)
+	}()
+	db, handlers := Module("test-db"), Module("test-handlers")
+
+	_ = SetVerbosity("", 2)
+	db.V(3).Info("hidden")
+	db.V(2).Infof("shown %d", 2)
+	handlers.Warning("always ", "shown")
+	assert.Equal(t, []string{"test-db: shown 2", "test-handlers: always shown"}, recorder.messages)
+
+	recorder.messages = nil
+	assert.NoError(t, SetVerbosity("test-db", 5))
+	db.V(5).Info("debug")
+	handlers.V(5).Info("hidden")
+	assert.Equal(t, []string{"test-db: debug"}, recorder.messages)
+	assert.Equal(t, 5, Levels().Modules["test-db"])
+	assert.Equal(t, 2, Levels().Modules["test-handlers"])
+	assert.Contains(t, Levels().Overrides, "test-db")
+	assert.Equal(t, "recording", Levels().Backend)
+
+	assert.NoError(t, SetVerbosity("test-db", -1))
+	assert.Equal(t, 2, Verbosity("test-db"), "Back to the global verbosity")
+	assert.True(t, errors.Is(SetVerbosity("missing", 1), ErrUnknownModule))
+}
+
+func TestNewZapBackend(t *testing.T) {
+	backend, err := NewZapBackend()
+	assert.NoError(t, err)
+	backend.Log(InfoLog, "test", "Logged with zap")
+	backend.Flush()
+}
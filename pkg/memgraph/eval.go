@@ -0,0 +1,720 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Variables bound while executing a query.
+type row map[string]interface{}
+
+func (r row) with(name string, value interface{}) row {
+	next := make(row, len(r)+1)
+	for k, v := range r {
+		next[k] = v
+	}
+	if name != "" {
+		next[name] = value
+	}
+	return next
+}
+
+// Scope for evaluating an expression. Aggregates are computed by the projection beforehand.
+type scope struct {
+	vars       row
+	aggregates map[*funcExpr]interface{}
+}
+
+var aggregateFuncs = map[string]bool{"count": true, "collect": true, "sum": true, "min": true, "max": true, "avg": true}
+
+func evalExpr(e expr, s scope) (interface{}, error) {
+	switch typed := e.(type) {
+	case literalExpr:
+		return typed.value, nil
+	case variableExpr:
+		value, ok := s.vars[typed.name]
+		if !ok {
+			return nil, fmt.Errorf("%s not defined", typed.name)
+		}
+		return value, nil
+	case propertyExpr:
+		target, err := evalExpr(typed.target, s)
+		if err != nil {
+			return nil, err
+		}
+		switch t := target.(type) {
+		case nil:
+			return nil, nil
+		case *node:
+			return t.props[typed.key], nil
+		case *edge:
+			return t.props[typed.key], nil
+		case map[string]interface{}:
+			return t[typed.key], nil
+		}
+		return nil, fmt.Errorf("Type mismatch: expected a node, relationship or map to access property %s", typed.key)
+	case indexExpr:
+		return evalIndex(typed, s)
+	case listExpr:
+		list := make([]interface{}, 0, len(typed.items))
+		for _, item := range typed.items {
+			value, err := evalExpr(item, s)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case *mapExpr:
+		m := make(map[string]interface{}, len(typed.keys))
+		for i, key := range typed.keys {
+			value, err := evalExpr(typed.values[i], s)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case unaryExpr:
+		operand, err := evalExpr(typed.operand, s)
+		if err != nil {
+			return nil, err
+		}
+		if typed.op == "NOT" {
+			return not(operand)
+		}
+		switch t := operand.(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			return -t, nil
+		case float64:
+			return -t, nil
+		}
+		return nil, fmt.Errorf("Type mismatch: can't negate %v", operand)
+	case isNullExpr:
+		operand, err := evalExpr(typed.operand, s)
+		if err != nil {
+			return nil, err
+		}
+		return (operand == nil) != typed.not, nil
+	case binaryExpr:
+		return evalBinary(typed, s)
+	case *funcExpr:
+		if aggregateFuncs[typed.name] {
+			value, ok := s.aggregates[typed]
+			if !ok {
+				return nil, fmt.Errorf("Aggregate function %s is not allowed here", typed.name)
+			}
+			return value, nil
+		}
+		args := make([]interface{}, 0, len(typed.args))
+		for _, arg := range typed.args {
+			value, err := evalExpr(arg, s)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, value)
+		}
+		return callFunc(typed.name, args)
+	}
+	return nil, fmt.Errorf("Unsupported expression %T", e)
+}
+
+func evalIndex(e indexExpr, s scope) (interface{}, error) {
+	target, err := evalExpr(e.target, s)
+	if err != nil || target == nil {
+		return nil, err
+	}
+	list, ok := target.([]interface{})
+	if !ok {
+		if m, isMap := target.(map[string]interface{}); isMap && !e.slice {
+			key, err := evalExpr(e.index, s)
+			if err != nil {
+				return nil, err
+			}
+			return m[fmt.Sprint(key)], nil
+		}
+		return nil, fmt.Errorf("Type mismatch: expected a list, got %v", target)
+	}
+	position := func(bound expr, defaultValue int) (int, error) {
+		if bound == nil {
+			return defaultValue, nil
+		}
+		value, err := evalExpr(bound, s)
+		if err != nil {
+			return 0, err
+		}
+		i, ok := value.(int64)
+		if !ok {
+			return 0, fmt.Errorf("Type mismatch: list index must be an integer")
+		}
+		if i < 0 {
+			i += int64(len(list))
+		}
+		return int(i), nil
+	}
+	if !e.slice {
+		i, err := position(e.index, 0)
+		if err != nil || i < 0 || i >= len(list) {
+			return nil, err
+		}
+		return list[i], nil
+	}
+	from, err := position(e.from, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := position(e.to, len(list))
+	if err != nil {
+		return nil, err
+	}
+	from, to = clamp(from, 0, len(list)), clamp(to, 0, len(list))
+	if from >= to {
+		return []interface{}{}, nil
+	}
+	return append([]interface{}{}, list[from:to]...), nil
+}
+
+func clamp(value, low, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
+
+func evalBinary(e binaryExpr, s scope) (interface{}, error) {
+	left, err := evalExpr(e.left, s)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalExpr(e.right, s)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "AND", "OR", "XOR":
+		return logical(e.op, left, right)
+	case "=":
+		return equal(left, right), nil
+	case "<>":
+		return not(equal(left, right))
+	case "<", ">", "<=", ">=":
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		c, ok := compare(left, right)
+		if !ok {
+			return nil, nil
+		}
+		switch e.op {
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		}
+		return c >= 0, nil
+	case "IN":
+		if right == nil {
+			return nil, nil
+		}
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Type mismatch: IN expects a list")
+		}
+		var result interface{} = false
+		for _, item := range list {
+			switch equal(left, item) {
+			case true:
+				return true, nil
+			case nil:
+				result = nil
+			}
+		}
+		return result, nil
+	case "=~":
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return nil, nil
+		}
+		// The regular expression matches the whole string.
+		re, err := regexp.Compile("^(?:" + r + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression %s: %s", r, err)
+		}
+		return re.MatchString(l), nil
+	case "CONTAINS", "STARTS WITH", "ENDS WITH":
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return nil, nil
+		}
+		switch e.op {
+		case "CONTAINS":
+			return strings.Contains(l, r), nil
+		case "STARTS WITH":
+			return strings.HasPrefix(l, r), nil
+		}
+		return strings.HasSuffix(l, r), nil
+	case "+":
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		if l, ok := left.([]interface{}); ok {
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+			return append(append([]interface{}{}, l...), right), nil
+		}
+		_, lstr := left.(string)
+		_, rstr := right.(string)
+		if lstr || rstr {
+			return toString(left) + toString(right), nil
+		}
+		return arithmetic(e.op, left, right)
+	case "-", "*", "/":
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return arithmetic(e.op, left, right)
+	}
+	return nil, fmt.Errorf("Unsupported operator %s", e.op)
+}
+
+// Three-valued logic, nil is unknown.
+func logical(op string, left, right interface{}) (interface{}, error) {
+	l, lok := left.(bool)
+	r, rok := right.(bool)
+	if (left != nil && !lok) || (right != nil && !rok) {
+		return nil, fmt.Errorf("Type mismatch: %s expects booleans", op)
+	}
+	switch op {
+	case "AND":
+		if (lok && !l) || (rok && !r) {
+			return false, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return true, nil
+	case "OR":
+		if (lok && l) || (rok && r) {
+			return true, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return false, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return l != r, nil
+}
+
+func not(value interface{}) (interface{}, error) {
+	switch t := value.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return !t, nil
+	}
+	return nil, fmt.Errorf("Type mismatch: NOT expects a boolean")
+}
+
+// Returns true, false or nil when either value is null.
+func equal(left, right interface{}) interface{} {
+	if left == nil || right == nil {
+		return nil
+	}
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return l == r
+		}
+		return false
+	}
+	switch l := left.(type) {
+	case []interface{}:
+		r, ok := right.([]interface{})
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		var result interface{} = true
+		for i := range l {
+			switch equal(l[i], r[i]) {
+			case false:
+				return false
+			case nil:
+				result = nil
+			}
+		}
+		return result
+	case map[string]interface{}:
+		return valueKey(left) == valueKey(right)
+	}
+	return left == right
+}
+
+// Orders numbers, strings and booleans. Returns false if the values can't be compared.
+func compare(left, right interface{}) (int, bool) {
+	if l, ok := toFloat(left); ok {
+		r, ok := toFloat(right)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch l := left.(type) {
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(l, r), true
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l == r:
+			return 0, true
+		case !l:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch t := value.(type) {
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	}
+	return 0, false
+}
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	l, lint := left.(int64)
+	r, rint := right.(int64)
+	if lint && rint {
+		switch op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		}
+		if r == 0 {
+			return nil, fmt.Errorf("Division by zero")
+		}
+		return l / r, nil
+	}
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("Type mismatch: %s expects numbers", op)
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	}
+	return lf / rf, nil
+}
+
+func toString(value interface{}) string {
+	switch t := value.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func callFunc(name string, args []interface{}) (interface{}, error) {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return nil
+	}
+	switch name {
+	case "type":
+		if e, ok := arg(0).(*edge); ok {
+			return e.relType, nil
+		}
+		return nil, nil
+	case "labels":
+		if n, ok := arg(0).(*node); ok {
+			if n.label == "" {
+				return []interface{}{}, nil
+			}
+			return []interface{}{n.label}, nil
+		}
+		return nil, nil
+	case "id":
+		switch t := arg(0).(type) {
+		case *node:
+			return int64(t.id), nil
+		case *edge:
+			return int64(t.id), nil
+		}
+		return nil, nil
+	case "keys":
+		var props map[string]interface{}
+		switch t := arg(0).(type) {
+		case *node:
+			props = t.props
+		case *edge:
+			props = t.props
+		case map[string]interface{}:
+			props = t
+		default:
+			return nil, nil
+		}
+		keys := make([]string, 0, len(props))
+		for key := range props {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		list := make([]interface{}, len(keys))
+		for i, key := range keys {
+			list[i] = key
+		}
+		return list, nil
+	case "tolower", "toupper", "trim":
+		s, ok := arg(0).(string)
+		if !ok {
+			return nil, nil
+		}
+		switch name {
+		case "tolower":
+			return strings.ToLower(s), nil
+		case "toupper":
+			return strings.ToUpper(s), nil
+		}
+		return strings.TrimSpace(s), nil
+	case "substring":
+		s, ok1 := arg(0).(string)
+		start, ok2 := arg(1).(int64)
+		if !ok1 || !ok2 {
+			return nil, nil
+		}
+		if start < 0 || start > int64(len(s)) {
+			return nil, fmt.Errorf("substring start is out of range")
+		}
+		s = s[start:]
+		if len(args) > 2 {
+			length, ok := arg(2).(int64)
+			if !ok || length < 0 {
+				return nil, fmt.Errorf("substring length must be a positive integer")
+			}
+			if length < int64(len(s)) {
+				s = s[:length]
+			}
+		}
+		return s, nil
+	case "tostring":
+		if arg(0) == nil {
+			return nil, nil
+		}
+		return toString(arg(0)), nil
+	case "tointeger":
+		switch t := arg(0).(type) {
+		case int64:
+			return t, nil
+		case float64:
+			return int64(t), nil
+		case string:
+			if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return nil, nil
+	case "size":
+		switch t := arg(0).(type) {
+		case []interface{}:
+			return int64(len(t)), nil
+		case string:
+			return int64(len(t)), nil
+		}
+		return nil, nil
+	case "exists":
+		return arg(0) != nil, nil
+	case "range":
+		start, ok1 := arg(0).(int64)
+		end, ok2 := arg(1).(int64)
+		step, ok3 := int64(1), true
+		if len(args) > 2 {
+			step, ok3 = arg(2).(int64)
+		}
+		if !ok1 || !ok2 || !ok3 || step == 0 {
+			return nil, fmt.Errorf("range expects integers and a step other than 0")
+		}
+		list := []interface{}{}
+		for i := start; (step > 0 && i <= end) || (step < 0 && i >= end); i += step {
+			list = append(list, i)
+		}
+		return list, nil
+	case "coalesce":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unknown function '%s'", name)
+}
+
+// Computes an aggregate function over the rows of a group.
+func aggregate(f *funcExpr, rows []row) (interface{}, error) {
+	values := []interface{}{}
+	seen := map[string]bool{}
+	for _, r := range rows {
+		if f.star {
+			values = append(values, true)
+			continue
+		}
+		if len(f.args) != 1 {
+			return nil, fmt.Errorf("%s expects one argument", f.name)
+		}
+		value, err := evalExpr(f.args[0], scope{vars: r})
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		if f.distinct {
+			key := valueKey(value)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		values = append(values, value)
+	}
+
+	switch f.name {
+	case "count":
+		return int64(len(values)), nil
+	case "collect":
+		return values, nil
+	case "min", "max":
+		var result interface{}
+		for _, value := range values {
+			c, ok := compare(value, result)
+			if result == nil || (ok && ((f.name == "min" && c < 0) || (f.name == "max" && c > 0))) {
+				result = value
+			}
+		}
+		return result, nil
+	}
+	var sum interface{} = int64(0)
+	for _, value := range values {
+		var err error
+		if sum, err = arithmetic("+", sum, value); err != nil {
+			return nil, err
+		}
+	}
+	if f.name == "avg" {
+		if len(values) == 0 {
+			return nil, nil
+		}
+		total, _ := toFloat(sum)
+		return total / float64(len(values)), nil
+	}
+	return sum, nil
+}
+
+// Finds the aggregate functions used in an expression.
+func findAggregates(e expr, found []*funcExpr) []*funcExpr {
+	switch typed := e.(type) {
+	case *funcExpr:
+		if aggregateFuncs[typed.name] {
+			return append(found, typed)
+		}
+		for _, arg := range typed.args {
+			found = findAggregates(arg, found)
+		}
+	case propertyExpr:
+		return findAggregates(typed.target, found)
+	case indexExpr:
+		for _, child := range []expr{typed.target, typed.index, typed.from, typed.to} {
+			if child != nil {
+				found = findAggregates(child, found)
+			}
+		}
+	case listExpr:
+		for _, item := range typed.items {
+			found = findAggregates(item, found)
+		}
+	case *mapExpr:
+		for _, value := range typed.values {
+			found = findAggregates(value, found)
+		}
+	case binaryExpr:
+		return findAggregates(typed.right, findAggregates(typed.left, found))
+	case unaryExpr:
+		return findAggregates(typed.operand, found)
+	case isNullExpr:
+		return findAggregates(typed.operand, found)
+	}
+	return found
+}
+
+// Key that identifies a value, used for grouping and DISTINCT.
+func valueKey(value interface{}) string {
+	switch t := value.(type) {
+	case nil:
+		return "null"
+	case *node:
+		return fmt.Sprintf("node:%d", t.id)
+	case *edge:
+		return fmt.Sprintf("edge:%d", t.id)
+	case string:
+		return strconv.Quote(t)
+	case []interface{}:
+		keys := make([]string, len(t))
+		for i, item := range t {
+			keys[i] = valueKey(item)
+		}
+		return "[" + strings.Join(keys, ",") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k, v := range t {
+			keys = append(keys, strconv.Quote(k)+":"+valueKey(v))
+		}
+		sort.Strings(keys)
+		return "{" + strings.Join(keys, ",") + "}"
+	}
+	return fmt.Sprintf("%T:%v", value, value)
+}
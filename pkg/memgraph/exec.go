@@ -0,0 +1,696 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type stats struct {
+	labelsAdded          int
+	nodesCreated         int
+	nodesDeleted         int
+	propertiesSet        int
+	relationshipsCreated int
+	relationshipsDeleted int
+	indicesCreated       int
+	indicesDeleted       int
+	executionTime        time.Duration
+}
+
+type result struct {
+	columns []string // Nil when the query doesn't return anything.
+	rows    [][]interface{}
+	stats   stats
+}
+
+// Runs an openCypher query against the graph. The query is applied completely or not at all.
+// The caller holds the graph mutex.
+func (g *Graph) execute(query string) (*result, error) {
+	return g.executeProfiled(query, nil)
+}
+
+// Runs the query like execute, and calls observe after each clause with the rows it produced and its time.
+func (g *Graph) executeProfiled(query string, observe func(clause interface{}, rows int, elapsed time.Duration)) (
+	*result, error) {
+	start := time.Now()
+	clauses, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := len(g.labels.list)
+	g.journal = nil
+	res := &result{}
+	rows := []row{{}}
+	for i, clause := range clauses {
+		clauseStart := time.Now()
+		rows, err = g.executeClause(clause, rows, res)
+		if err == nil && observe != nil {
+			produced := len(rows)
+			if res.columns != nil {
+				produced = len(res.rows) // RETURN and CALL produce the rows of the result.
+			}
+			observe(clause, produced, time.Since(clauseStart))
+		}
+		if err == nil && res.columns != nil && i < len(clauses)-1 {
+			err = fmt.Errorf("RETURN and CALL must be the last clause")
+		}
+		if err != nil {
+			g.rollback()
+			return nil, err
+		}
+	}
+	g.journal = nil
+	res.stats.labelsAdded = len(g.labels.list) - labels
+	res.stats.executionTime = time.Since(start)
+	return res, nil
+}
+
+func (g *Graph) executeClause(clause interface{}, rows []row, res *result) ([]row, error) {
+	switch c := clause.(type) {
+	case matchClause:
+		return g.executeMatch(c, rows)
+	case createClause:
+		for _, r := range rows {
+			for _, path := range c.patterns {
+				if err := g.createPath(path, r, &res.stats); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return rows, nil
+	case mergeClause:
+		merged := []row{}
+		for _, r := range rows {
+			matches, err := g.matchPath(c.pattern, r)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				if err = g.createPath(c.pattern, r, &res.stats); err != nil {
+					return nil, err
+				}
+				matches = []row{r}
+			}
+			merged = append(merged, matches...)
+		}
+		return merged, nil
+	case setClause:
+		for _, r := range rows {
+			for _, item := range c.items {
+				value, err := evalExpr(item.value, scope{vars: r})
+				if err != nil {
+					return nil, err
+				}
+				if err = checkProperty(item.key, value); err != nil {
+					return nil, err
+				}
+				switch target := r[item.variable].(type) {
+				case *node:
+					g.setNodeProperty(target, item.key, value)
+				case *edge:
+					g.setEdgeProperty(target, item.key, value)
+				case nil:
+					if _, ok := r[item.variable]; !ok {
+						return nil, fmt.Errorf("%s not defined", item.variable)
+					}
+					continue
+				default:
+					return nil, fmt.Errorf("Type mismatch: can't set a property on %s", item.variable)
+				}
+				res.stats.propertiesSet++
+			}
+		}
+		return rows, nil
+	case deleteClause:
+		for _, r := range rows {
+			for _, target := range c.targets {
+				value, err := evalExpr(target, scope{vars: r})
+				if err != nil {
+					return nil, err
+				}
+				switch t := value.(type) {
+				case nil:
+				case *node:
+					if !t.deleted {
+						res.stats.relationshipsDeleted += g.deleteNode(t)
+						res.stats.nodesDeleted++
+					}
+				case *edge:
+					res.stats.relationshipsDeleted += g.deleteEdge(t)
+				default:
+					return nil, fmt.Errorf("Delete type mismatch, expecting either Node or Relationship")
+				}
+			}
+		}
+		return rows, nil
+	case unwindClause:
+		unwound := []row{}
+		for _, r := range rows {
+			value, err := evalExpr(c.list, scope{vars: r})
+			if err != nil {
+				return nil, err
+			}
+			switch list := value.(type) {
+			case nil:
+			case []interface{}:
+				for _, item := range list {
+					unwound = append(unwound, r.with(c.variable, item))
+				}
+			default:
+				unwound = append(unwound, r.with(c.variable, value))
+			}
+		}
+		return unwound, nil
+	case projectionClause:
+		return g.executeProjection(c, rows, res)
+	case callClause:
+		return nil, g.executeCall(c, res)
+	case createIndexClause:
+		g.executeIndex(c, res)
+		return rows, nil
+	}
+	return nil, fmt.Errorf("Unsupported clause %T", clause)
+}
+
+func (g *Graph) executeMatch(c matchClause, rows []row) ([]row, error) {
+	for _, path := range c.patterns {
+		next := []row{}
+		for _, r := range rows {
+			matches, err := g.matchPath(path, r)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, matches...)
+		}
+		rows = next
+	}
+	if c.where == nil {
+		return rows, nil
+	}
+	return filter(rows, c.where)
+}
+
+func filter(rows []row, where expr) ([]row, error) {
+	kept := []row{}
+	for _, r := range rows {
+		value, err := evalExpr(where, scope{vars: r})
+		if err != nil {
+			return nil, err
+		}
+		if value == true {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// Returns a row for each way the path matches the graph, extending the given row.
+func (g *Graph) matchPath(path pathPattern, r row) ([]row, error) {
+	matches := []row{}
+	candidates, err := g.candidates(path.nodes[0], r)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range candidates {
+		ok, err := g.nodeMatches(n, path.nodes[0], r)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if err = g.extendPath(path, 0, n, r.with(path.nodes[0].variable, n), map[uint64]bool{}, &matches); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Follows the relationship after nodes[i], collecting complete matches.
+func (g *Graph) extendPath(path pathPattern, i int, current *node, r row, used map[uint64]bool, matches *[]row) error {
+	if i == len(path.rels) {
+		*matches = append(*matches, r)
+		return nil
+	}
+	rel, nextPattern := path.rels[i], path.nodes[i+1]
+	type step struct {
+		e    *edge
+		next *node
+	}
+	steps := []step{}
+	if rel.direction >= 0 {
+		for _, e := range sortedEdges(g.out[current.id]) {
+			steps = append(steps, step{e, e.dst})
+		}
+	}
+	if rel.direction <= 0 {
+		for _, e := range sortedEdges(g.in[current.id]) {
+			if rel.direction == 0 && e.src == e.dst {
+				continue // Already followed as an outgoing edge.
+			}
+			steps = append(steps, step{e, e.src})
+		}
+	}
+	for _, s := range steps {
+		if used[s.e.id] || (rel.relType != "" && s.e.relType != rel.relType) {
+			continue
+		}
+		if bound, ok := r[rel.variable]; ok && rel.variable != "" && bound != s.e {
+			continue
+		}
+		ok, err := propsMatch(s.e.props, rel.props, r)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if ok, err = g.nodeMatches(s.next, nextPattern, r); err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		used[s.e.id] = true
+		next := r.with(rel.variable, s.e).with(nextPattern.variable, s.next)
+		err = g.extendPath(path, i+1, s.next, next, used, matches)
+		delete(used, s.e.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Nodes that could match the pattern, using the bound variable or an index when possible.
+func (g *Graph) candidates(pattern nodePattern, r row) ([]*node, error) {
+	if bound, ok := r[pattern.variable]; ok && pattern.variable != "" {
+		n, isNode := bound.(*node)
+		if !isNode {
+			if bound == nil {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("%s is not a node", pattern.variable)
+		}
+		return []*node{n}, nil
+	}
+	if pattern.props != nil {
+		for i, key := range pattern.props.keys {
+			if key != "_uid" {
+				continue
+			}
+			uid, err := evalExpr(pattern.props.values[i], scope{vars: r})
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := uid.(string); ok {
+				return sortedNodes(g.byUID[s]), nil
+			}
+		}
+	}
+	if pattern.label != "" {
+		return sortedNodes(g.byLabel[pattern.label]), nil
+	}
+	return sortedNodes(g.nodes), nil
+}
+
+func (g *Graph) nodeMatches(n *node, pattern nodePattern, r row) (bool, error) {
+	if n.deleted || (pattern.label != "" && n.label != pattern.label) {
+		return false, nil
+	}
+	if bound, ok := r[pattern.variable]; ok && pattern.variable != "" && bound != n {
+		return false, nil
+	}
+	return propsMatch(n.props, pattern.props, r)
+}
+
+func propsMatch(props map[string]interface{}, pattern *mapExpr, r row) (bool, error) {
+	if pattern == nil {
+		return true, nil
+	}
+	for i, key := range pattern.keys {
+		value, err := evalExpr(pattern.values[i], scope{vars: r})
+		if err != nil {
+			return false, err
+		}
+		if equal(props[key], value) != true {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Creates the nodes and relationships of the path, reusing the nodes bound in the row.
+// The new variables are added to the row.
+func (g *Graph) createPath(path pathPattern, r row, s *stats) error {
+	nodes := make([]*node, len(path.nodes))
+	for i, pattern := range path.nodes {
+		if bound, ok := r[pattern.variable]; ok && pattern.variable != "" {
+			n, isNode := bound.(*node)
+			if !isNode {
+				return fmt.Errorf("%s is not a node", pattern.variable)
+			}
+			nodes[i] = n
+			continue
+		}
+		props, err := evalProps(pattern.props, r)
+		if err != nil {
+			return err
+		}
+		nodes[i] = g.createNode(pattern.label, props)
+		s.nodesCreated++
+		s.propertiesSet += len(nodes[i].props)
+		if pattern.variable != "" {
+			r[pattern.variable] = nodes[i]
+		}
+	}
+	for i, rel := range path.rels {
+		if rel.relType == "" || rel.direction == 0 {
+			return fmt.Errorf("Relationships must have a type and a direction when created")
+		}
+		props, err := evalProps(rel.props, r)
+		if err != nil {
+			return err
+		}
+		src, dst := nodes[i], nodes[i+1]
+		if rel.direction < 0 {
+			src, dst = dst, src
+		}
+		e := g.createEdge(rel.relType, src, dst, props)
+		s.relationshipsCreated++
+		s.propertiesSet += len(e.props)
+		if rel.variable != "" {
+			r[rel.variable] = e
+		}
+	}
+	return nil
+}
+
+func evalProps(pattern *mapExpr, r row) (map[string]interface{}, error) {
+	props := map[string]interface{}{}
+	if pattern == nil {
+		return props, nil
+	}
+	for i, key := range pattern.keys {
+		value, err := evalExpr(pattern.values[i], scope{vars: r})
+		if err != nil {
+			return nil, err
+		}
+		if err = checkProperty(key, value); err != nil {
+			return nil, err
+		}
+		if value != nil {
+			props[key] = value
+		}
+	}
+	return props, nil
+}
+
+// Only scalars and lists can be stored as properties.
+func checkProperty(key string, value interface{}) error {
+	switch v := value.(type) {
+	case nil, string, int64, float64, bool:
+		return nil
+	case []interface{}:
+		for _, item := range v {
+			if err := checkProperty(key, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Property %s can't be set to %v", key, value)
+}
+
+func (g *Graph) executeProjection(c projectionClause, rows []row, res *result) ([]row, error) {
+	aggregates := []*funcExpr{}
+	for _, item := range c.items {
+		aggregates = findAggregates(item.value, aggregates)
+	}
+
+	// Group the rows by the values of the items without aggregates.
+	type group struct {
+		rows []row
+	}
+	groups := []*group{}
+	if len(aggregates) == 0 {
+		for _, r := range rows {
+			groups = append(groups, &group{rows: []row{r}})
+		}
+	} else {
+		byKey := map[string]*group{}
+		for _, r := range rows {
+			key := ""
+			for _, item := range c.items {
+				if len(findAggregates(item.value, nil)) > 0 {
+					continue
+				}
+				value, err := evalExpr(item.value, scope{vars: r})
+				if err != nil {
+					return nil, err
+				}
+				key += valueKey(value) + "|"
+			}
+			if byKey[key] == nil {
+				byKey[key] = &group{}
+				groups = append(groups, byKey[key])
+			}
+			byKey[key].rows = append(byKey[key].rows, r)
+		}
+		if len(groups) == 0 && len(aggregates) > 0 && !hasGroupingKeys(c.items) {
+			groups = append(groups, &group{})
+		}
+	}
+
+	type projected struct {
+		values []interface{}
+		vars   row // Aliases plus, without aggregation, the variables in scope, for ORDER BY.
+	}
+	projectedRows := []projected{}
+	seen := map[string]bool{}
+	for _, grp := range groups {
+		s := scope{vars: row{}, aggregates: map[*funcExpr]interface{}{}}
+		if len(grp.rows) > 0 {
+			s.vars = grp.rows[0]
+		}
+		for _, f := range aggregates {
+			value, err := aggregate(f, grp.rows)
+			if err != nil {
+				return nil, err
+			}
+			s.aggregates[f] = value
+		}
+		p := projected{values: make([]interface{}, len(c.items)), vars: row{}}
+		if len(aggregates) == 0 {
+			p.vars = s.vars.with("", nil)
+		}
+		for i, item := range c.items {
+			value, err := evalExpr(item.value, s)
+			if err != nil {
+				return nil, err
+			}
+			p.values[i] = value
+			p.vars[item.alias] = value
+		}
+		if c.distinct {
+			key := valueKey(p.values)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		projectedRows = append(projectedRows, p)
+	}
+
+	if len(c.orderBy) > 0 {
+		keys := make([][]interface{}, len(projectedRows))
+		for i, p := range projectedRows {
+			for _, item := range c.orderBy {
+				value, err := evalExpr(item.value, scope{vars: p.vars})
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = append(keys[i], value)
+			}
+		}
+		indexes := make([]int, len(projectedRows))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(a, b int) bool {
+			for k, item := range c.orderBy {
+				c := orderCompare(keys[indexes[a]][k], keys[indexes[b]][k])
+				if c != 0 {
+					return (c < 0) != item.descending
+				}
+			}
+			return false
+		})
+		sorted := make([]projected, len(projectedRows))
+		for i, index := range indexes {
+			sorted[i] = projectedRows[index]
+		}
+		projectedRows = sorted
+	}
+
+	skip, err := evalCount(c.skip, 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := evalCount(c.limit, len(projectedRows))
+	if err != nil {
+		return nil, err
+	}
+	projectedRows = projectedRows[clamp(skip, 0, len(projectedRows)):]
+	projectedRows = projectedRows[:clamp(limit, 0, len(projectedRows))]
+
+	if c.isReturn {
+		res.columns = make([]string, len(c.items))
+		for i, item := range c.items {
+			res.columns[i] = item.alias
+		}
+		res.rows = make([][]interface{}, len(projectedRows))
+		for i, p := range projectedRows {
+			res.rows[i] = p.values
+		}
+		return nil, nil
+	}
+
+	next := make([]row, len(projectedRows))
+	for i, p := range projectedRows {
+		next[i] = row{}
+		for j, item := range c.items {
+			next[i][item.alias] = p.values[j]
+		}
+	}
+	if c.where == nil {
+		return next, nil
+	}
+	return filter(next, c.where)
+}
+
+func hasGroupingKeys(items []projectionItem) bool {
+	for _, item := range items {
+		if len(findAggregates(item.value, nil)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Orders values for ORDER BY, nulls last.
+func orderCompare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	return 0
+}
+
+func evalCount(e expr, defaultValue int) (int, error) {
+	if e == nil {
+		return defaultValue, nil
+	}
+	value, err := evalExpr(e, scope{vars: row{}})
+	if err != nil {
+		return 0, err
+	}
+	count, ok := value.(int64)
+	if !ok || count < 0 {
+		return 0, fmt.Errorf("SKIP and LIMIT expect a positive integer")
+	}
+	return int(count), nil
+}
+
+// Creates or drops the index, like RedisGraph an index that exists isn't created again.
+func (g *Graph) executeIndex(c createIndexClause, res *result) {
+	for i, property := range g.indexes[c.label] {
+		if property == c.property {
+			if c.drop {
+				g.indexes[c.label] = append(g.indexes[c.label][:i:i], g.indexes[c.label][i+1:]...)
+				res.stats.indicesDeleted++
+			}
+			return
+		}
+	}
+	if !c.drop {
+		g.indexes[c.label] = append(g.indexes[c.label], c.property)
+		res.stats.indicesCreated++
+	}
+}
+
+func (g *Graph) executeCall(c callClause, res *result) error {
+	var columns []string
+	var rows [][]interface{}
+	list := func(column string, values []string) {
+		columns = []string{column}
+		for _, value := range values {
+			rows = append(rows, []interface{}{value})
+		}
+	}
+	switch c.procedure {
+	case "db.labels":
+		list("label", g.labels.list)
+	case "db.propertyKeys":
+		list("propertyKey", g.properties.list)
+	case "db.relationshipTypes":
+		list("relationshipType", g.relTypes.list)
+	case "db.indexes":
+		columns = []string{"type", "label", "properties"}
+		labels := make([]string, 0, len(g.indexes))
+		for label := range g.indexes {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			if properties := g.indexes[label]; len(properties) > 0 {
+				values := make([]interface{}, len(properties))
+				for i, property := range properties {
+					values[i] = property
+				}
+				rows = append(rows, []interface{}{"exact-match", label, values})
+			}
+		}
+	default:
+		return fmt.Errorf("Procedure `%s` is not registered", c.procedure)
+	}
+	if len(c.yield) > 0 {
+		positions := make([]int, len(c.yield))
+		for i, y := range c.yield {
+			positions[i] = -1
+			for j, column := range columns {
+				if column == y {
+					positions[i] = j
+				}
+			}
+			if positions[i] < 0 {
+				return fmt.Errorf("Procedure `%s` does not yield output `%s`", c.procedure, y)
+			}
+		}
+		for i, row := range rows {
+			yielded := make([]interface{}, len(positions))
+			for j, position := range positions {
+				yielded[j] = row[position]
+			}
+			rows[i] = yielded
+		}
+		columns = c.yield
+	}
+	res.columns = columns
+	res.rows = rows
+	if res.rows == nil {
+		res.rows = [][]interface{}{}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"testing"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGraph(t *testing.T) *rg2.Graph {
+	conn, err := NewServer().Dial()
+	assert.Nil(t, err)
+	g := rg2.GraphNew("search-db", conn)
+	return &g
+}
+
+func query(t *testing.T, g *rg2.Graph, q string) *rg2.QueryResult {
+	result, err := g.Query(q)
+	if !assert.Nil(t, err, q) {
+		t.FailNow()
+	}
+	return result
+}
+
+func countOf(t *testing.T, g *rg2.Graph, q string) int {
+	result := query(t, g, q)
+	assert.True(t, result.Next(), q)
+	return result.Record().GetByIndex(0).(int)
+}
+
+// Inserts a cluster with two pods the way the aggregator does.
+func insertTestCluster(t *testing.T, g *rg2.Graph) {
+	query(t, g, "MERGE (c:Cluster {name: 'c1', kind: 'cluster'}) SET c.status = 'OK', c.kubernetesVersion = ''")
+	result := query(t, g, "MATCH (c:Cluster {name: 'c1'}) CREATE "+
+		"(:Pod {_uid:'c1/pod1', kind:'pod', cluster:'c1', name:'pod1', restarts:0, label:['app=a', 'tier=web']})"+
+		"-[:inCluster {_interCluster: true}]->(c), "+
+		"(:Pod {_uid:'c1/pod2', kind:'pod', cluster:'c1', name:'pod2', restarts:3, label:['app=b']})"+
+		"-[:inCluster {_interCluster: true}]->(c)")
+	assert.Equal(t, 2, result.NodesCreated())
+	assert.Equal(t, 2, result.RelationshipsCreated())
+}
+
+func Test_insertAndCount(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	assert.Equal(t, 2, countOf(t, g, "MATCH (n {cluster:'c1'}) RETURN count(n)"))
+	assert.Equal(t, 1, countOf(t, g, "MATCH (c:Cluster {name: 'c1'}) RETURN count(c)"))
+	assert.Equal(t, 0, countOf(t, g, "MATCH (n {cluster:'missing'}) RETURN count(n)"))
+	assert.Equal(t, 1, countOf(t, g, "MATCH (n:Pod) WHERE n.restarts > 1 AND 'app=b' IN n.label RETURN count(n)"))
+	assert.Equal(t, 2, countOf(t, g, `MATCH (n:Pod) WHERE n.name =~ 'pod\\d' RETURN count(n)`))
+	assert.Equal(t, 0, countOf(t, g, "MATCH (n:Pod) WHERE n.name =~ 'pod' RETURN count(n)"),
+		"The whole name must match.")
+	assert.Equal(t, 1, countOf(t, g, "MATCH (n:Pod) WHERE NOT n.name IN ['pod1', 'other'] RETURN count(n)"))
+}
+
+func Test_returnNode(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	result := query(t, g, "MATCH (n {cluster: 'c1'}) RETURN n ORDER BY n.name DESC")
+	names := []string{}
+	for result.Next() {
+		n := result.Record().GetByIndex(0).(*rg2.Node)
+		assert.Equal(t, "Pod", n.Label)
+		assert.Equal(t, "c1", n.Properties["cluster"])
+		names = append(names, n.Properties["name"].(string))
+	}
+	assert.Equal(t, []string{"pod2", "pod1"}, names)
+}
+
+func Test_updateAndDelete(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	result := query(t, g, "MATCH (n0:Pod {_uid: 'c1/pod1'}), (n1:Pod {_uid: 'c1/pod2'}) SET n0.status='Running', n1.restarts=4")
+	assert.Equal(t, 2, result.PropertiesSet())
+	assert.Equal(t, 1, countOf(t, g, "MATCH (n {status:'Running'}) RETURN count(n)"))
+
+	result = query(t, g, "MATCH (n) WHERE (n._uid='c1/pod1' OR n._uid='c1/missing') DELETE n")
+	assert.Equal(t, 1, result.NodesDeleted())
+	assert.Equal(t, 1, result.RelationshipsDeleted())
+	assert.Equal(t, 1, countOf(t, g, "MATCH (n {cluster:'c1'}) RETURN count(n)"))
+}
+
+func Test_substring(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	query(t, g, "MATCH (n {cluster:'c1'}) WHERE n._uid STARTS WITH 'c1/' SET n._uid = 'c2' + substring(n._uid, 2)")
+	assert.Equal(t, 1, countOf(t, g, "MATCH (n {_uid:'c2/pod1'}) RETURN count(n)"))
+	result := query(t, g, "MATCH (n {_uid:'c2/pod2'}) RETURN substring(n.name, 1, 2), substring(n.name, 3, 10)")
+	assert.True(t, result.Next())
+	assert.Equal(t, "od", result.Record().GetByIndex(0))
+	assert.Equal(t, "2", result.Record().GetByIndex(1))
+}
+
+func Test_edges(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	result := query(t, g, "MATCH (s:Pod {_uid: 'c1/pod1'}), (d:Pod) WHERE d._uid='c1/pod2' CREATE (s)-[:ownedBy]->(d)")
+	assert.Equal(t, 1, result.RelationshipsCreated())
+	query(t, g, "MATCH (s {_uid: 'c1/pod1'}), (d) WHERE d._uid='c1/pod2' CREATE (s)-[:ownedBy]->(d)")
+
+	intraEdges := "MATCH (s {cluster:'c1'})-[e]->(d {cluster:'c1'}) WHERE (e._interCluster <> true) OR (e._interCluster IS NULL) RETURN count(e)"
+	assert.Equal(t, 2, countOf(t, g, intraEdges))
+
+	result = query(t, g, "MATCH (s {cluster:'c1'})-[r]->(d {cluster:'c1'}) WHERE (r._interCluster <> true) OR (r._interCluster IS NULL) RETURN s._uid, type(r), d._uid")
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{"c1/pod1", "ownedBy", "c1/pod2"}, result.Record().Values())
+
+	// Removes the duplicate edge, used when resyncing a cluster.
+	result = query(t, g, "MATCH (s {cluster:'c1'})-[r]->(d {cluster:'c1'}) WHERE (r._interCluster <> true) OR (r._interCluster IS NULL) "+
+		"WITH s as source, d as dest, TYPE(r) as edge, COLLECT (r) AS edges WHERE size(edges) >1 UNWIND edges[1..] AS dupedges DELETE dupedges")
+	assert.Equal(t, 1, result.RelationshipsDeleted())
+	assert.Equal(t, 1, countOf(t, g, intraEdges))
+
+	result = query(t, g, "MATCH (s0 {_uid: 'c1/pod1'})-[e0:ownedBy]->(d0 {_uid: 'c1/pod2'}) DELETE e0")
+	assert.Equal(t, 1, result.RelationshipsDeleted())
+	assert.Equal(t, 0, countOf(t, g, intraEdges))
+	assert.Equal(t, 2, countOf(t, g, "MATCH ()-[e {_interCluster:true}]->() WHERE type(e)='inCluster' RETURN count(e)"))
+}
+
+func Test_parameters(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	assert.Equal(t, 1, countOf(t, g, `CYPHER uids=["c1/pod2","c1/missing"] min=1 `+
+		"MATCH (n:Pod) WHERE n._uid IN $uids AND n.restarts > $min RETURN count(n)"))
+	result := query(t, g, `CYPHER edges=[["c1/pod1","c1"],["c1/pod2","c1"]] UNWIND $edges AS edge `+
+		"MATCH (s:Pod {_uid: edge[0]})-[e:inCluster]->(d:Cluster {name: edge[1]}) DELETE e WITH count(*) AS deleted "+
+		"UNWIND $edges AS edge MATCH (s {_uid: edge[0]})-[e:ownedBy]->(d {_uid: edge[1]}) DELETE e")
+	assert.Equal(t, 2, result.RelationshipsDeleted())
+
+	_, err := parse("CYPHER uids=[] MATCH (n) WHERE n._uid IN $missing RETURN n")
+	assert.NotNil(t, err)
+}
+
+func Test_groupAndProcedures(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	result := query(t, g, "MATCH (n {cluster:'c1'}) RETURN n.kind, count(n)")
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{"pod", 2}, result.Record().Values())
+	assert.False(t, result.Next())
+
+	result = query(t, g, "MATCH (n) RETURN distinct labels(n)")
+	labels := 0
+	for result.Next() {
+		labels++
+	}
+	assert.Equal(t, 2, labels)
+
+	result = query(t, g, "CALL db.propertyKeys()")
+	keys := []string{}
+	for result.Next() {
+		keys = append(keys, result.Record().GetByIndex(0).(string))
+	}
+	assert.Contains(t, keys, "_uid")
+	assert.Contains(t, keys, "restarts")
+}
+
+func Test_indexes(t *testing.T) {
+	g := newTestGraph(t)
+	assert.Equal(t, 1, query(t, g, "CREATE INDEX ON :Pod(name)").IndicesCreated())
+	assert.Equal(t, 0, query(t, g, "CREATE INDEX ON :Pod(name)").IndicesCreated(), "The index exists.")
+	query(t, g, "CREATE INDEX ON :Pod(_uid)")
+	query(t, g, "CREATE INDEX ON :Cluster(name)")
+
+	result := query(t, g, "CALL db.indexes() YIELD label, properties")
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{"Cluster", []interface{}{"name"}}, result.Record().Values())
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{"Pod", []interface{}{"name", "_uid"}}, result.Record().Values())
+	assert.False(t, result.Next())
+
+	assert.Equal(t, 1, query(t, g, "DROP INDEX ON :Pod(name)").IndicesDeleted())
+	assert.Equal(t, 0, query(t, g, "DROP INDEX ON :Pod(name)").IndicesDeleted())
+	result = query(t, g, "CALL db.indexes() YIELD properties")
+	assert.True(t, result.Next())
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{[]interface{}{"_uid"}}, result.Record().Values())
+
+	_, err := g.Query("CALL db.indexes() YIELD unknown")
+	assert.NotNil(t, err)
+}
+
+func Test_failedQueryIsRolledBack(t *testing.T) {
+	g := newTestGraph(t)
+	insertTestCluster(t, g)
+
+	_, err := g.Query("MATCH (n {cluster:'c1'}) SET n.status='Gone' WITH n DELETE n.name")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, countOf(t, g, "MATCH (n {status:'Gone'}) RETURN count(n)"))
+
+	_, err = g.Query("MATCH (n {cluster:'c1'}) DELETE n RETURN unknownFunction(n)")
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, countOf(t, g, "MATCH (n {cluster:'c1'}) RETURN count(n)"))
+	assert.Equal(t, 2, countOf(t, g, "MATCH ()-[e:inCluster]->() RETURN count(e)"))
+}
+
+func Test_parseErrors(t *testing.T) {
+	for _, q := range []string{"MATCH (n RETURN n", "RETURN 'unterminated", "MATCH (n)-[*]->(m) RETURN n", "FOO"} {
+		_, err := parse(q)
+		assert.NotNil(t, err, q)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"sort"
+	"sync"
+)
+
+type node struct {
+	id      uint64
+	label   string
+	props   map[string]interface{}
+	deleted bool
+}
+
+type edge struct {
+	id       uint64
+	relType  string
+	src, dst *node
+	props    map[string]interface{}
+	deleted  bool
+}
+
+// Names of labels, properties and relationship types in the order they were first used.
+// The compact response format refers to names by their position.
+type names struct {
+	list  []string
+	index map[string]int
+}
+
+func (n *names) add(name string) int {
+	if i, ok := n.index[name]; ok {
+		return i
+	}
+	if n.index == nil {
+		n.index = make(map[string]int)
+	}
+	n.index[name] = len(n.list)
+	n.list = append(n.list, name)
+	return len(n.list) - 1
+}
+
+// An in-memory property graph.
+type Graph struct {
+	mutex      sync.Mutex
+	nodes      map[uint64]*node
+	edges      map[uint64]*edge
+	byLabel    map[string]map[uint64]*node
+	byUID      map[string]map[uint64]*node // Nodes by _uid, the property used to look up resources.
+	out, in    map[uint64]map[uint64]*edge // Edges by source node and by destination node.
+	nextNodeID uint64
+	nextEdgeID uint64
+	labels     names
+	properties names
+	relTypes   names
+	indexes    map[string][]string // Properties indexed by label, in the order the indexes were created.
+	journal    []func()            // Undoes the changes of the running query, so a failed query leaves no partial writes.
+}
+
+func newGraph() *Graph {
+	return &Graph{
+		nodes:   make(map[uint64]*node),
+		edges:   make(map[uint64]*edge),
+		byLabel: make(map[string]map[uint64]*node),
+		byUID:   make(map[string]map[uint64]*node),
+		out:     make(map[uint64]map[uint64]*edge),
+		in:      make(map[uint64]map[uint64]*edge),
+		indexes: make(map[string][]string),
+	}
+}
+
+func (g *Graph) createNode(label string, props map[string]interface{}) *node {
+	n := &node{id: g.nextNodeID, label: label, props: make(map[string]interface{})}
+	g.nextNodeID++
+	g.nodes[n.id] = n
+	if label != "" {
+		g.labels.add(label)
+		addToIndex(g.byLabel, label, n)
+	}
+	g.journal = append(g.journal, func() {
+		delete(g.nodes, n.id)
+		delete(g.byLabel[n.label], n.id)
+	})
+	for key, value := range props {
+		g.setNodeProperty(n, key, value)
+	}
+	return n
+}
+
+func (g *Graph) createEdge(relType string, src, dst *node, props map[string]interface{}) *edge {
+	e := &edge{id: g.nextEdgeID, relType: relType, src: src, dst: dst, props: make(map[string]interface{})}
+	g.nextEdgeID++
+	g.relTypes.add(relType)
+	g.edges[e.id] = e
+	addEdgeToIndex(g.out, src.id, e)
+	addEdgeToIndex(g.in, dst.id, e)
+	g.journal = append(g.journal, func() {
+		delete(g.edges, e.id)
+		delete(g.out[src.id], e.id)
+		delete(g.in[dst.id], e.id)
+	})
+	for key, value := range props {
+		g.setEdgeProperty(e, key, value)
+	}
+	return e
+}
+
+// Sets a property on the node, a nil value removes the property.
+func (g *Graph) setNodeProperty(n *node, key string, value interface{}) {
+	previous := n.props[key]
+	g.journal = append(g.journal, func() { g.setNodeProperty(n, key, previous) })
+	if key == "_uid" {
+		if uid, ok := n.props[key].(string); ok {
+			delete(g.byUID[uid], n.id)
+		}
+		if uid, ok := value.(string); ok {
+			addToIndex(g.byUID, uid, n)
+		}
+	}
+	if value == nil {
+		delete(n.props, key)
+		return
+	}
+	g.properties.add(key)
+	n.props[key] = value
+}
+
+func (g *Graph) setEdgeProperty(e *edge, key string, value interface{}) {
+	previous := e.props[key]
+	g.journal = append(g.journal, func() { g.setEdgeProperty(e, key, previous) })
+	if value == nil {
+		delete(e.props, key)
+		return
+	}
+	g.properties.add(key)
+	e.props[key] = value
+}
+
+// Deletes the node and its edges. Returns the number of edges deleted.
+func (g *Graph) deleteNode(n *node) int {
+	if n.deleted {
+		return 0
+	}
+	deletedEdges := 0
+	for _, e := range g.out[n.id] {
+		deletedEdges += g.deleteEdge(e)
+	}
+	for _, e := range g.in[n.id] {
+		deletedEdges += g.deleteEdge(e)
+	}
+	n.deleted = true
+	delete(g.nodes, n.id)
+	delete(g.out, n.id)
+	delete(g.in, n.id)
+	if n.label != "" {
+		delete(g.byLabel[n.label], n.id)
+	}
+	if uid, ok := n.props["_uid"].(string); ok {
+		delete(g.byUID[uid], n.id)
+	}
+	g.journal = append(g.journal, func() {
+		n.deleted = false
+		g.nodes[n.id] = n
+		if n.label != "" {
+			addToIndex(g.byLabel, n.label, n)
+		}
+		if uid, ok := n.props["_uid"].(string); ok {
+			addToIndex(g.byUID, uid, n)
+		}
+	})
+	return deletedEdges
+}
+
+// Deletes the edge. Returns 1 if it was deleted, 0 if it was already deleted.
+func (g *Graph) deleteEdge(e *edge) int {
+	if e.deleted {
+		return 0
+	}
+	e.deleted = true
+	delete(g.edges, e.id)
+	delete(g.out[e.src.id], e.id)
+	delete(g.in[e.dst.id], e.id)
+	g.journal = append(g.journal, func() {
+		e.deleted = false
+		g.edges[e.id] = e
+		addEdgeToIndex(g.out, e.src.id, e)
+		addEdgeToIndex(g.in, e.dst.id, e)
+	})
+	return 1
+}
+
+// Reverts the changes recorded in the journal, newest first.
+func (g *Graph) rollback() {
+	journal := g.journal
+	for i := len(journal) - 1; i >= 0; i-- {
+		journal[i]()
+	}
+	g.journal = nil
+}
+
+func addToIndex(index map[string]map[uint64]*node, key string, n *node) {
+	if index[key] == nil {
+		index[key] = make(map[uint64]*node)
+	}
+	index[key][n.id] = n
+}
+
+func addEdgeToIndex(index map[uint64]map[uint64]*edge, nodeID uint64, e *edge) {
+	if index[nodeID] == nil {
+		index[nodeID] = make(map[uint64]*edge)
+	}
+	index[nodeID][e.id] = e
+}
+
+// Returns the nodes in the map sorted by id, so results are predictable.
+func sortedNodes(nodes map[uint64]*node) []*node {
+	list := make([]*node, 0, len(nodes))
+	for _, n := range nodes {
+		list = append(list, n)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+func sortedEdges(edges map[uint64]*edge) []*edge {
+	list := make([]*edge, 0, len(edges))
+	for _, e := range edges {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
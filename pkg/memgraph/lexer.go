@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenInt
+	tokenFloat
+	tokenSymbol
+	tokenParam // $name, the text is the name.
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // Identifier name, unescaped string, number or symbol.
+	start int    // Offset of the token in the query.
+	end   int
+}
+
+// Two character symbols, checked before the single character ones.
+var doubleSymbols = []string{"<>", "<=", ">=", "=~", ".."}
+
+// Splits an openCypher query into tokens.
+func tokenize(query string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(query) && isIdentPart(query[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, query[start:i], start, i})
+		case c == '$' && i+1 < len(query) && isIdentStart(query[i+1]):
+			start := i
+			for i++; i < len(query) && isIdentPart(query[i]); i++ {
+			}
+			tokens = append(tokens, token{tokenParam, query[start+1 : i], start, i})
+		case c == '`':
+			end := strings.IndexByte(query[i+1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated identifier at offset %d", i)
+			}
+			tokens = append(tokens, token{tokenIdent, query[i+1 : i+1+end], i, i + end + 2})
+			i += end + 2
+		case c >= '0' && c <= '9':
+			start := i
+			kind := tokenInt
+			for i < len(query) && query[i] >= '0' && query[i] <= '9' {
+				i++
+			}
+			// A dot followed by a digit is a float, two dots are a range.
+			if i+1 < len(query) && query[i] == '.' && query[i+1] >= '0' && query[i+1] <= '9' {
+				kind = tokenFloat
+				i++
+				for i < len(query) && query[i] >= '0' && query[i] <= '9' {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind, query[start:i], start, i})
+		case c == '\'' || c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			for ; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' && i+1 < len(query) {
+					i++
+					switch query[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(query[i])
+					}
+					continue
+				}
+				sb.WriteByte(query[i])
+			}
+			if i >= len(query) {
+				return nil, fmt.Errorf("Unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokenString, sb.String(), start, i})
+		default:
+			symbol := string(c)
+			for _, s := range doubleSymbols {
+				if strings.HasPrefix(query[i:], s) {
+					symbol = s
+					break
+				}
+			}
+			if !strings.Contains("()[]{},:.+-*/=<>|;", symbol[:1]) {
+				return nil, fmt.Errorf("Unexpected character '%c' at offset %d", c, i)
+			}
+			tokens = append(tokens, token{tokenSymbol, symbol, i, i + len(symbol)})
+			i += len(symbol)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, start: len(query), end: len(query)}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
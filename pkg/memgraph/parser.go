@@ -0,0 +1,824 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expressions
+type expr interface{}
+
+type literalExpr struct{ value interface{} }
+type variableExpr struct{ name string }
+type propertyExpr struct {
+	target expr
+	key    string
+}
+type indexExpr struct {
+	target   expr
+	index    expr
+	from, to expr // Used instead of index for slices, either can be nil.
+	slice    bool
+}
+type listExpr struct{ items []expr }
+type mapExpr struct {
+	keys   []string
+	values []expr
+}
+type binaryExpr struct {
+	op          string // Upper case for keywords, e.g. AND, IN, CONTAINS
+	left, right expr
+}
+type unaryExpr struct {
+	op      string // NOT or -
+	operand expr
+}
+type isNullExpr struct {
+	operand expr
+	not     bool
+}
+type funcExpr struct {
+	name     string // Lower case.
+	args     []expr
+	distinct bool
+	star     bool // count(*)
+}
+
+// Patterns
+type nodePattern struct {
+	variable string
+	label    string
+	props    *mapExpr
+}
+type relPattern struct {
+	variable  string
+	relType   string
+	props     *mapExpr
+	direction int // 1 for ->, -1 for <-, 0 for undirected.
+}
+type pathPattern struct {
+	nodes []nodePattern
+	rels  []relPattern // rels[i] connects nodes[i] and nodes[i+1]
+}
+
+// Clauses
+type matchClause struct {
+	patterns []pathPattern
+	where    expr
+}
+type createClause struct{ patterns []pathPattern }
+type mergeClause struct{ pattern pathPattern }
+type setItem struct {
+	variable, key string
+	value         expr
+}
+type setClause struct{ items []setItem }
+type deleteClause struct{ targets []expr }
+type unwindClause struct {
+	list     expr
+	variable string
+}
+type projectionItem struct {
+	value expr
+	alias string
+}
+type orderItem struct {
+	value      expr
+	descending bool
+}
+type projectionClause struct {
+	items       []projectionItem
+	distinct    bool
+	orderBy     []orderItem
+	skip, limit expr
+	where       expr // Only for WITH.
+	isReturn    bool
+}
+type callClause struct {
+	procedure string
+	yield     []string
+}
+type createIndexClause struct {
+	label, property string
+	drop            bool // DROP INDEX
+}
+
+type parser struct {
+	query  string
+	tokens []token
+	pos    int
+	params map[string]expr // From the CYPHER name=value header of parameterized queries.
+}
+
+// Parses an openCypher query into clauses.
+func parse(query string) ([]interface{}, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{query: query, tokens: tokens, params: make(map[string]expr)}
+	if err = p.parseParams(); err != nil {
+		return nil, err
+	}
+	clauses := []interface{}{}
+	for !p.at(tokenEOF) {
+		if p.acceptSymbol(";") {
+			continue
+		}
+		clause, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) == 0 {
+		return nil, fmt.Errorf("Empty query")
+	}
+	return clauses, nil
+}
+
+// Parses the parameters of a parameterized query, e.g. CYPHER uids=["a","b"] MATCH (n) WHERE n._uid IN $uids
+func (p *parser) parseParams() error {
+	if !p.acceptKeyword("CYPHER") {
+		return nil
+	}
+	for p.at(tokenIdent) && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokenSymbol &&
+		p.tokens[p.pos+1].text == "=" {
+		name := p.next().text
+		p.next()
+		value, err := p.parsePrimary()
+		if err != nil {
+			return err
+		}
+		p.params[name] = value
+	}
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) at(kind tokenKind) bool {
+	return p.peek().kind == kind
+}
+
+func (p *parser) atKeyword(keywords ...string) bool {
+	for i, keyword := range keywords {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		t := p.tokens[p.pos+i]
+		if t.kind != tokenIdent || !strings.EqualFold(t.text, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) acceptKeyword(keywords ...string) bool {
+	if p.atKeyword(keywords...) {
+		p.pos += len(keywords)
+		return true
+	}
+	return false
+}
+
+func (p *parser) atSymbol(symbol string) bool {
+	t := p.peek()
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if p.atSymbol(symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf("Expected '%s'", symbol)
+	}
+	return nil
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("Expected %s", keyword)
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	if !p.at(tokenIdent) {
+		return "", p.errorf("Expected identifier")
+	}
+	return p.next().text, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	near := "end of query"
+	if t.kind != tokenEOF {
+		near = fmt.Sprintf("'%s' at offset %d", p.query[t.start:t.end], t.start)
+	}
+	return fmt.Errorf("%s near %s", fmt.Sprintf(format, args...), near)
+}
+
+func (p *parser) parseClause() (interface{}, error) {
+	switch {
+	case p.acceptKeyword("OPTIONAL"):
+		return nil, p.errorf("OPTIONAL MATCH is not supported")
+	case p.acceptKeyword("MATCH"):
+		patterns, err := p.parsePatterns()
+		if err != nil {
+			return nil, err
+		}
+		clause := matchClause{patterns: patterns}
+		if p.acceptKeyword("WHERE") {
+			if clause.where, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		return clause, nil
+	case p.acceptKeyword("CREATE", "INDEX", "ON"):
+		return p.parseIndex(false)
+	case p.acceptKeyword("DROP", "INDEX", "ON"):
+		return p.parseIndex(true)
+	case p.acceptKeyword("CREATE"):
+		patterns, err := p.parsePatterns()
+		return createClause{patterns}, err
+	case p.acceptKeyword("MERGE"):
+		pattern, err := p.parsePath()
+		return mergeClause{pattern}, err
+	case p.acceptKeyword("SET"):
+		return p.parseSet()
+	case p.acceptKeyword("DETACH", "DELETE"), p.acceptKeyword("DELETE"):
+		clause := deleteClause{}
+		for {
+			target, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			clause.targets = append(clause.targets, target)
+			if !p.acceptSymbol(",") {
+				return clause, nil
+			}
+		}
+	case p.acceptKeyword("UNWIND"):
+		list, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		variable, err := p.expectIdent()
+		return unwindClause{list, variable}, err
+	case p.acceptKeyword("WITH"):
+		return p.parseProjection(false)
+	case p.acceptKeyword("RETURN"):
+		return p.parseProjection(true)
+	case p.acceptKeyword("CALL"):
+		return p.parseCall()
+	}
+	return nil, p.errorf("Unsupported clause")
+}
+
+func (p *parser) parsePatterns() ([]pathPattern, error) {
+	patterns := []pathPattern{}
+	for {
+		pattern, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+		if !p.acceptSymbol(",") {
+			return patterns, nil
+		}
+	}
+}
+
+func (p *parser) parsePath() (pathPattern, error) {
+	path := pathPattern{}
+	node, err := p.parseNode()
+	if err != nil {
+		return path, err
+	}
+	path.nodes = append(path.nodes, node)
+	for p.atSymbol("-") || p.atSymbol("<") {
+		rel, err := p.parseRel()
+		if err != nil {
+			return path, err
+		}
+		node, err := p.parseNode()
+		if err != nil {
+			return path, err
+		}
+		path.rels = append(path.rels, rel)
+		path.nodes = append(path.nodes, node)
+	}
+	return path, nil
+}
+
+func (p *parser) parseNode() (nodePattern, error) {
+	node := nodePattern{}
+	if err := p.expectSymbol("("); err != nil {
+		return node, err
+	}
+	if p.at(tokenIdent) {
+		node.variable = p.next().text
+	}
+	if p.acceptSymbol(":") {
+		label, err := p.expectIdent()
+		if err != nil {
+			return node, err
+		}
+		node.label = label
+	}
+	if p.atSymbol("{") {
+		props, err := p.parseMap()
+		if err != nil {
+			return node, err
+		}
+		node.props = props
+	}
+	return node, p.expectSymbol(")")
+}
+
+// Parses -[e:TYPE {props}]-> or <-[...]- or -[...]-
+func (p *parser) parseRel() (relPattern, error) {
+	rel := relPattern{}
+	incoming := p.acceptSymbol("<")
+	if err := p.expectSymbol("-"); err != nil {
+		return rel, err
+	}
+	if p.acceptSymbol("[") {
+		if p.at(tokenIdent) {
+			rel.variable = p.next().text
+		}
+		if p.acceptSymbol(":") {
+			relType, err := p.expectIdent()
+			if err != nil {
+				return rel, err
+			}
+			rel.relType = relType
+		}
+		if p.atSymbol("*") {
+			return rel, p.errorf("Variable length relationships are not supported")
+		}
+		if p.atSymbol("{") {
+			props, err := p.parseMap()
+			if err != nil {
+				return rel, err
+			}
+			rel.props = props
+		}
+		if err := p.expectSymbol("]"); err != nil {
+			return rel, err
+		}
+	}
+	if err := p.expectSymbol("-"); err != nil {
+		return rel, err
+	}
+	outgoing := p.acceptSymbol(">")
+	switch {
+	case incoming && outgoing:
+		return rel, p.errorf("Relationship can't point in both directions")
+	case incoming:
+		rel.direction = -1
+	case outgoing:
+		rel.direction = 1
+	}
+	return rel, nil
+}
+
+func (p *parser) parseMap() (*mapExpr, error) {
+	m := &mapExpr{}
+	if err := p.expectSymbol("{"); err != nil {
+		return nil, err
+	}
+	if p.acceptSymbol("}") {
+		return m, nil
+	}
+	for {
+		key, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+		m.values = append(m.values, value)
+		if !p.acceptSymbol(",") {
+			return m, p.expectSymbol("}")
+		}
+	}
+}
+
+func (p *parser) parseSet() (interface{}, error) {
+	clause := setClause{}
+	for {
+		variable, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("."); err != nil {
+			return nil, err
+		}
+		key, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		clause.items = append(clause.items, setItem{variable, key, value})
+		if !p.acceptSymbol(",") {
+			return clause, nil
+		}
+	}
+}
+
+func (p *parser) parseProjection(isReturn bool) (interface{}, error) {
+	clause := projectionClause{isReturn: isReturn}
+	clause.distinct = p.acceptKeyword("DISTINCT")
+	for {
+		start := p.peek().start
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item := projectionItem{value: value, alias: strings.TrimSpace(p.query[start:p.tokens[p.pos-1].end])}
+		if p.acceptKeyword("AS") {
+			if item.alias, err = p.expectIdent(); err != nil {
+				return nil, err
+			}
+		}
+		clause.items = append(clause.items, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("ORDER", "BY") {
+		for {
+			value, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{value: value}
+			if p.acceptKeyword("DESC") || p.acceptKeyword("DESCENDING") {
+				item.descending = true
+			} else if !p.acceptKeyword("ASC") {
+				p.acceptKeyword("ASCENDING")
+			}
+			clause.orderBy = append(clause.orderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	var err error
+	if p.acceptKeyword("SKIP") {
+		if clause.skip, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		if clause.limit, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if !isReturn && p.acceptKeyword("WHERE") {
+		if clause.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return clause, nil
+}
+
+func (p *parser) parseCall() (interface{}, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptSymbol(".") {
+		part, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		name += "." + part
+	}
+	if err = p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	if err = p.expectSymbol(")"); err != nil {
+		return nil, p.errorf("Procedure arguments are not supported")
+	}
+	clause := callClause{procedure: name}
+	if p.acceptKeyword("YIELD") {
+		for {
+			column, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			clause.yield = append(clause.yield, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	return clause, nil
+}
+
+// Expression precedence, lowest first: OR, XOR, AND, NOT, comparison, +/-, *//, unary -, postfix.
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseBinary(0)
+}
+
+var binaryLevels = [][]string{
+	{"OR"},
+	{"XOR"},
+	{"AND"},
+}
+
+func (p *parser) parseBinary(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.parseNot()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		matched := ""
+		for _, op := range binaryLevels[level] {
+			if p.acceptKeyword(op) {
+				matched = op
+				break
+			}
+		}
+		if matched == "" {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{matched, left, right}
+	}
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		operand, err := p.parseNot()
+		return unaryExpr{"NOT", operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		switch {
+		case p.atSymbol("=") || p.atSymbol("<>") || p.atSymbol("<") || p.atSymbol(">") ||
+			p.atSymbol("<=") || p.atSymbol(">=") || p.atSymbol("=~"):
+			op = p.next().text
+		case p.acceptKeyword("IN"):
+			op = "IN"
+		case p.acceptKeyword("CONTAINS"):
+			op = "CONTAINS"
+		case p.acceptKeyword("STARTS", "WITH"):
+			op = "STARTS WITH"
+		case p.acceptKeyword("ENDS", "WITH"):
+			op = "ENDS WITH"
+		case p.acceptKeyword("IS", "NOT", "NULL"):
+			left = isNullExpr{left, true}
+			continue
+		case p.acceptKeyword("IS", "NULL"):
+			left = isNullExpr{left, false}
+			continue
+		default:
+			return left, nil
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.atSymbol("+") || p.atSymbol("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.atSymbol("*") || p.atSymbol("/") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.acceptSymbol("-") {
+		operand, err := p.parseUnary()
+		return unaryExpr{"-", operand}, err
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.acceptSymbol("."):
+			key, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			e = propertyExpr{e, key}
+		case p.acceptSymbol("["):
+			ie := indexExpr{target: e}
+			if !p.atSymbol("..") {
+				if ie.index, err = p.parseExpr(); err != nil {
+					return nil, err
+				}
+			}
+			if p.acceptSymbol("..") {
+				ie.slice, ie.from = true, ie.index
+				ie.index = nil
+				if !p.atSymbol("]") {
+					if ie.to, err = p.parseExpr(); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if err = p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+			e = ie
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenString:
+		p.next()
+		return literalExpr{t.text}, nil
+	case tokenInt:
+		p.next()
+		value, err := strconv.ParseInt(t.text, 10, 64)
+		return literalExpr{value}, err
+	case tokenFloat:
+		p.next()
+		value, err := strconv.ParseFloat(t.text, 64)
+		return literalExpr{value}, err
+	case tokenParam:
+		value, ok := p.params[t.text]
+		if !ok {
+			return nil, p.errorf("Missing parameter %s", t.text)
+		}
+		p.next()
+		return value, nil
+	case tokenIdent:
+		p.next()
+		switch strings.ToLower(t.text) {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		case "null":
+			return literalExpr{nil}, nil
+		}
+		if p.acceptSymbol("(") {
+			return p.parseFunc(strings.ToLower(t.text))
+		}
+		return variableExpr{t.text}, nil
+	case tokenSymbol:
+		switch t.text {
+		case "(":
+			p.next()
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expectSymbol(")")
+		case "[":
+			p.next()
+			list := listExpr{}
+			if p.acceptSymbol("]") {
+				return list, nil
+			}
+			for {
+				item, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if !p.acceptSymbol(",") {
+					return list, p.expectSymbol("]")
+				}
+			}
+		case "{":
+			return p.parseMap()
+		}
+	}
+	return nil, p.errorf("Unexpected token")
+}
+
+func (p *parser) parseFunc(name string) (expr, error) {
+	f := &funcExpr{name: name}
+	if p.acceptSymbol("*") {
+		f.star = true
+		return f, p.expectSymbol(")")
+	}
+	f.distinct = p.acceptKeyword("DISTINCT")
+	if p.acceptSymbol(")") {
+		return f, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		f.args = append(f.args, arg)
+		if !p.acceptSymbol(",") {
+			return f, p.expectSymbol(")")
+		}
+	}
+}
+
+// Parses the rest of CREATE INDEX ON or DROP INDEX ON, e.g. :Pod(_uid)
+func (p *parser) parseIndex(drop bool) (interface{}, error) {
+	if err := p.expectSymbol(":"); err != nil {
+		return nil, err
+	}
+	label, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	property, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	return createIndexClause{label, property, drop}, p.expectSymbol(")")
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value types of the RedisGraph compact result set.
+const (
+	valueNull    = 1
+	valueString  = 2
+	valueInteger = 3
+	valueBoolean = 4
+	valueDouble  = 5
+	valueArray   = 6
+	valueEdge    = 7
+	valueNode    = 8
+)
+
+const columnScalar = 1
+
+// Runs the query and returns the reply to GRAPH.QUERY.
+func (g *Graph) query(query string) ([]interface{}, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	res, err := g.execute(query)
+	if err != nil {
+		return nil, err
+	}
+	return g.encode(res), nil
+}
+
+// Runs the query the way RedisGraph replies to GRAPH.RO_QUERY, the queries modifying the graph are rejected.
+func (g *Graph) readOnlyQuery(query string) ([]interface{}, error) {
+	clauses, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, clause := range clauses {
+		switch clause.(type) {
+		case createClause, mergeClause, setClause, deleteClause, createIndexClause:
+			return nil, errors.New("graph.RO_QUERY is to be executed only on read-only queries")
+		}
+	}
+	return g.query(query)
+}
+
+// Runs the query and returns the reply to GRAPH.PROFILE, one operation per clause from the last one, each indented
+// under the next, with the rows it produced and its time.
+func (g *Graph) profile(query string) ([]interface{}, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	operations := []string{}
+	_, err := g.executeProfiled(query, func(clause interface{}, rows int, elapsed time.Duration) {
+		operations = append(operations, fmt.Sprintf("%s | Records produced: %d, Execution time: %f ms",
+			clauseName(clause), rows, float64(elapsed)/float64(time.Millisecond)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	reply := make([]interface{}, len(operations))
+	for i := range operations {
+		reply[i] = strings.Repeat("    ", i) + operations[len(operations)-1-i]
+	}
+	return reply, nil
+}
+
+// Returns the name of the operation of a clause in the replies to GRAPH.EXPLAIN and GRAPH.PROFILE, e.g. Match.
+func clauseName(clause interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintf("%T", clause)[len("memgraph."):], "Clause")
+}
+
+// Encodes the result the way RedisGraph replies to GRAPH.QUERY with --compact.
+func (g *Graph) encode(res *result) []interface{} {
+	statistics := encodeStats(res.stats)
+	if res.columns == nil {
+		return []interface{}{statistics}
+	}
+	header := make([]interface{}, len(res.columns))
+	for i, column := range res.columns {
+		header[i] = []interface{}{int64(columnScalar), column}
+	}
+	records := make([]interface{}, len(res.rows))
+	for i, r := range res.rows {
+		cells := make([]interface{}, len(r))
+		for j, value := range r {
+			cells[j] = g.encodeValue(value)
+		}
+		records[i] = cells
+	}
+	return []interface{}{header, records, statistics}
+}
+
+func (g *Graph) encodeValue(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return []interface{}{int64(valueNull), nil}
+	case string:
+		return []interface{}{int64(valueString), v}
+	case int64:
+		return []interface{}{int64(valueInteger), v}
+	case bool:
+		return []interface{}{int64(valueBoolean), []byte(strconv.FormatBool(v))}
+	case float64:
+		return []interface{}{int64(valueDouble), []byte(strconv.FormatFloat(v, 'f', -1, 64))}
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = g.encodeValue(item)
+		}
+		return []interface{}{int64(valueArray), items}
+	case *node:
+		labels := []interface{}{}
+		if v.label != "" {
+			labels = append(labels, int64(g.labels.add(v.label)))
+		}
+		return []interface{}{int64(valueNode), []interface{}{int64(v.id), labels, g.encodeProps(v.props)}}
+	case *edge:
+		return []interface{}{int64(valueEdge), []interface{}{
+			int64(v.id), int64(g.relTypes.add(v.relType)), int64(v.src.id), int64(v.dst.id), g.encodeProps(v.props),
+		}}
+	}
+	// Maps aren't part of the compact format of this RedisGraph version.
+	return []interface{}{int64(valueString), fmt.Sprint(value)}
+}
+
+func (g *Graph) encodeProps(props map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value := g.encodeValue(props[key])
+		encoded[i] = []interface{}{int64(g.properties.add(key)), value[0], value[1]}
+	}
+	return encoded
+}
+
+func encodeStats(s stats) []interface{} {
+	statistics := []interface{}{}
+	counts := []struct {
+		name  string
+		count int
+	}{
+		{"Labels added", s.labelsAdded},
+		{"Nodes created", s.nodesCreated},
+		{"Nodes deleted", s.nodesDeleted},
+		{"Properties set", s.propertiesSet},
+		{"Relationships created", s.relationshipsCreated},
+		{"Relationships deleted", s.relationshipsDeleted},
+		{"Indices created", s.indicesCreated},
+		{"Indices deleted", s.indicesDeleted},
+	}
+	for _, c := range counts {
+		if c.count > 0 {
+			statistics = append(statistics, fmt.Sprintf("%s: %d", c.name, c.count))
+		}
+	}
+	milliseconds := float64(s.executionTime.Nanoseconds()) / 1e6
+	return append(statistics, fmt.Sprintf("Query internal execution time: %f milliseconds", milliseconds))
+}
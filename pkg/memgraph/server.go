@@ -0,0 +1,558 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package memgraph is an in-memory stand-in for Redis with the RedisGraph module. It understands the subset
+// of openCypher and redis commands used by the aggregator, so the aggregator can run without a redis for
+// tests and local development. Data is lost when the process exits.
+package memgraph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Version of the RedisGraph module reported by MODULE LIST, the features of the Cypher subset match it.
+const moduleVersion = 20412 // 2.4.12
+
+// Holds the graphs, the sorted sets and the strings, shared by all the connections dialed from it.
+type Server struct {
+	mutex    sync.Mutex
+	exec     sync.RWMutex // Held by EXEC, the other commands don't run in the middle of a transaction.
+	graphs   map[string]*Graph
+	sets     map[string]map[string]float64 // Sorted sets, member to score.
+	strings  map[string]string
+	expires  map[string]time.Time
+	versions map[string]int64 // Changes of each key, for WATCH.
+	changes  int64
+}
+
+func NewServer() *Server {
+	return &Server{
+		graphs:   make(map[string]*Graph),
+		sets:     make(map[string]map[string]float64),
+		strings:  make(map[string]string),
+		expires:  make(map[string]time.Time),
+		versions: make(map[string]int64),
+	}
+}
+
+// Opens a connection to the server. Matches the Dial function of redis.Pool.
+func (s *Server) Dial() (redis.Conn, error) {
+	return &conn{server: s}, nil
+}
+
+func (s *Server) graph(name string) *Graph {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	g, ok := s.graphs[name]
+	if !ok {
+		g = newGraph()
+		s.graphs[name] = g
+	}
+	return g
+}
+
+type command struct {
+	name string
+	args []interface{}
+}
+
+// Implements redis.Conn and redis.ConnWithTimeout. Commands run synchronously, so timeouts are ignored.
+type conn struct {
+	server  *Server
+	pending []command // Sent but not received.
+	queued  []command // Inside MULTI.
+	multi   bool
+	closed  bool
+	watched map[string]int64 // Versions of the watched keys, EXEC aborts when one changed.
+}
+
+func (c *conn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *conn) Err() error {
+	if c.closed {
+		return errors.New("redigo: closed")
+	}
+	return nil
+}
+
+func (c *conn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if c.closed {
+		return nil, c.Err()
+	}
+	if commandName == "" {
+		var reply interface{}
+		var err error
+		for len(c.pending) > 0 {
+			reply, err = c.Receive()
+		}
+		return reply, err
+	}
+	for len(c.pending) > 0 {
+		_, _ = c.Receive()
+	}
+	return c.run(command{strings.ToUpper(commandName), args})
+}
+
+func (c *conn) Send(commandName string, args ...interface{}) error {
+	if c.closed {
+		return c.Err()
+	}
+	c.pending = append(c.pending, command{strings.ToUpper(commandName), args})
+	return nil
+}
+
+func (c *conn) Flush() error {
+	return c.Err()
+}
+
+func (c *conn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("memgraph: no pending replies")
+	}
+	cmd := c.pending[0]
+	c.pending = c.pending[1:]
+	return c.run(cmd)
+}
+
+func (c *conn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return c.Do(commandName, args...)
+}
+
+func (c *conn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.Receive()
+}
+
+// Runs the command, or queues it inside a transaction. Error replies are returned as redis.Error.
+func (c *conn) run(cmd command) (interface{}, error) {
+	switch cmd.name {
+	case "MULTI":
+		if c.multi {
+			return nil, redis.Error("ERR MULTI calls can not be nested")
+		}
+		c.multi = true
+		return "OK", nil
+	case "DISCARD":
+		c.multi, c.queued, c.watched = false, nil, nil
+		return "OK", nil
+	case "WATCH", "UNWATCH":
+		if c.multi {
+			return nil, redis.Error("ERR " + cmd.name + " inside MULTI is not allowed")
+		}
+		if cmd.name == "UNWATCH" {
+			c.watched = nil
+			return "OK", nil
+		}
+		if c.watched == nil {
+			c.watched = make(map[string]int64)
+		}
+		for _, key := range cmd.args {
+			name := argString(key)
+			c.watched[name] = c.server.version(name)
+		}
+		return "OK", nil
+	case "EXEC":
+		if !c.multi {
+			return nil, redis.Error("ERR EXEC without MULTI")
+		}
+		c.server.exec.Lock()
+		defer c.server.exec.Unlock()
+		watched := c.watched
+		c.watched = nil
+		for key, version := range watched {
+			if c.server.version(key) != version {
+				c.multi, c.queued = false, nil
+				return nil, nil // Aborted, a watched key changed.
+			}
+		}
+		replies := make([]interface{}, len(c.queued))
+		for i, queued := range c.queued {
+			reply, err := c.server.execute(queued)
+			if err != nil {
+				reply = toRedisError(err)
+			}
+			replies[i] = reply
+		}
+		c.multi, c.queued = false, nil
+		return replies, nil
+	}
+	if c.multi {
+		c.queued = append(c.queued, cmd)
+		return "QUEUED", nil
+	}
+	c.server.exec.RLock()
+	reply, err := c.server.execute(cmd)
+	c.server.exec.RUnlock()
+	if err != nil {
+		return nil, toRedisError(err)
+	}
+	return reply, nil
+}
+
+func toRedisError(err error) redis.Error {
+	if redisErr, ok := err.(redis.Error); ok {
+		return redisErr
+	}
+	return redis.Error(err.Error())
+}
+
+func (s *Server) execute(cmd command) (interface{}, error) {
+	args := make([]string, len(cmd.args))
+	for i, arg := range cmd.args {
+		args[i] = argString(arg)
+	}
+	switch cmd.name {
+	case "PING":
+		return "PONG", nil
+	case "MODULE":
+		if len(args) == 0 || !strings.EqualFold(args[0], "LIST") {
+			return nil, errors.New("ERR only MODULE LIST is supported")
+		}
+		return []interface{}{[]interface{}{"name", "graph", "ver", int64(moduleVersion)}}, nil
+	case "AUTH", "SELECT":
+		return "OK", nil
+	case "FLUSHALL", "FLUSHDB":
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.graphs = make(map[string]*Graph)
+		s.sets = make(map[string]map[string]float64)
+		s.strings = make(map[string]string)
+		s.expires = make(map[string]time.Time)
+		for key := range s.versions {
+			s.changed(key)
+		}
+		return "OK", nil
+	case "GRAPH.QUERY", "GRAPH.RO_QUERY":
+		if len(args) < 2 {
+			return nil, wrongArgs(cmd.name)
+		}
+		if len(args) < 3 || args[2] != "--compact" {
+			return nil, errors.New("ERR only --compact replies are supported")
+		}
+		if cmd.name == "GRAPH.RO_QUERY" {
+			return s.graph(args[0]).readOnlyQuery(args[1])
+		}
+		return s.graph(args[0]).query(args[1])
+	case "GRAPH.EXPLAIN":
+		if len(args) < 2 {
+			return nil, wrongArgs(cmd.name)
+		}
+		clauses, err := parse(args[1])
+		if err != nil {
+			return nil, err
+		}
+		plan := make([]string, len(clauses))
+		for i, clause := range clauses {
+			plan[i] = clauseName(clause)
+		}
+		return strings.Join(plan, "\n"), nil
+	case "GRAPH.PROFILE":
+		if len(args) < 2 {
+			return nil, wrongArgs(cmd.name)
+		}
+		return s.graph(args[0]).profile(args[1])
+	case "GRAPH.DELETE":
+		if len(args) < 1 {
+			return nil, wrongArgs(cmd.name)
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if _, ok := s.graphs[args[0]]; !ok {
+			return nil, errors.New("ERR Invalid graph operation on empty key")
+		}
+		delete(s.graphs, args[0])
+		return "Graph removed", nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch cmd.name {
+	case "DEL":
+		deleted := int64(0)
+		for _, key := range args {
+			if s.exists(key) {
+				deleted++
+			}
+			s.deleteKey(key)
+		}
+		return deleted, nil
+	case "RENAME":
+		if len(args) != 2 {
+			return nil, wrongArgs(cmd.name)
+		}
+		// Graphs, sorted sets and strings share the key space, the renamed key replaces any key with the new name.
+		if g, ok := s.graphs[args[0]]; ok {
+			s.deleteKey(args[1])
+			s.graphs[args[1]] = g
+			delete(s.graphs, args[0])
+			return "OK", nil
+		}
+		if !s.exists(args[0]) {
+			return nil, errors.New("ERR no such key")
+		}
+		delete(s.graphs, args[1])
+		expiry, expires := s.expires[args[0]]
+		set, isSet := s.sets[args[0]]
+		value := s.strings[args[0]]
+		s.deleteKey(args[0])
+		s.deleteKey(args[1])
+		if isSet {
+			s.sets[args[1]] = set
+		} else {
+			s.strings[args[1]] = value
+		}
+		if expires {
+			s.expires[args[1]] = expiry
+		}
+		s.changed(args[1])
+		return "OK", nil
+	case "EXPIRE", "PEXPIRE":
+		if len(args) != 2 {
+			return nil, wrongArgs(cmd.name)
+		}
+		ttl, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errors.New("ERR value is not an integer or out of range")
+		}
+		if !s.exists(args[0]) {
+			return int64(0), nil
+		}
+		unit := time.Second
+		if cmd.name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		s.expires[args[0]] = time.Now().Add(time.Duration(ttl) * unit)
+		s.changed(args[0])
+		return int64(1), nil
+	case "SET":
+		if len(args) < 2 {
+			return nil, wrongArgs(cmd.name)
+		}
+		return s.set(args[0], args[1], args[2:])
+	case "GET":
+		if len(args) != 1 {
+			return nil, wrongArgs(cmd.name)
+		}
+		if _, isSet := s.sets[args[0]]; isSet && s.exists(args[0]) {
+			return nil, errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		if !s.exists(args[0]) {
+			return nil, nil
+		}
+		return []byte(s.strings[args[0]]), nil
+	case "INCR":
+		if len(args) != 1 {
+			return nil, wrongArgs(cmd.name)
+		}
+		value := int64(0)
+		if s.exists(args[0]) {
+			var err error
+			if value, err = strconv.ParseInt(s.strings[args[0]], 10, 64); err != nil {
+				return nil, errors.New("ERR value is not an integer or out of range")
+			}
+		}
+		value++
+		s.strings[args[0]] = strconv.FormatInt(value, 10)
+		s.changed(args[0])
+		return value, nil
+	case "ZADD":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return nil, wrongArgs(cmd.name)
+		}
+		set := s.sortedSet(args[0], true)
+		added := int64(0)
+		for i := 1; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return nil, errors.New("ERR value is not a valid float")
+			}
+			if _, ok := set[args[i+1]]; !ok {
+				added++
+			}
+			set[args[i+1]] = score
+		}
+		s.changed(args[0])
+		return added, nil
+	case "ZRANGEBYSCORE", "ZREMRANGEBYSCORE":
+		if len(args) != 3 {
+			return nil, wrongArgs(cmd.name)
+		}
+		inRange, err := scoreRange(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		set := s.sortedSet(args[0], false)
+		members := []string{}
+		for member, score := range set {
+			if inRange(score) {
+				members = append(members, member)
+			}
+		}
+		if cmd.name == "ZREMRANGEBYSCORE" {
+			for _, member := range members {
+				delete(set, member)
+			}
+			if len(set) == 0 {
+				s.deleteKey(args[0])
+			} else if len(members) > 0 {
+				s.changed(args[0])
+			}
+			return int64(len(members)), nil
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if set[members[i]] != set[members[j]] {
+				return set[members[i]] < set[members[j]]
+			}
+			return members[i] < members[j]
+		})
+		reply := make([]interface{}, len(members))
+		for i, member := range members {
+			reply[i] = []byte(member)
+		}
+		return reply, nil
+	}
+	return nil, fmt.Errorf("ERR unknown command '%s'", cmd.name)
+}
+
+// Checks the expiry of the key. The caller holds the server mutex.
+func (s *Server) exists(key string) bool {
+	if expiry, ok := s.expires[key]; ok && time.Now().After(expiry) {
+		s.deleteKey(key)
+	}
+	_, isSet := s.sets[key]
+	_, isString := s.strings[key]
+	return isSet || isString
+}
+
+func (s *Server) deleteKey(key string) {
+	_, isSet := s.sets[key]
+	_, isString := s.strings[key]
+	if isSet || isString {
+		s.changed(key)
+	}
+	delete(s.sets, key)
+	delete(s.strings, key)
+	delete(s.expires, key)
+}
+
+// Records a change of the key, for the connections watching it. The caller holds the server mutex.
+func (s *Server) changed(key string) {
+	s.changes++
+	s.versions[key] = s.changes
+}
+
+// Returns the version of the key, after its expiry.
+func (s *Server) version(key string) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.exists(key)
+	return s.versions[key]
+}
+
+// Sets the string value of the key, with the NX, XX, EX and PX options. Returns nil when NX or XX didn't match.
+// The caller holds the server mutex.
+func (s *Server) set(key, value string, options []string) (interface{}, error) {
+	var ttl time.Duration
+	nx, xx := false, false
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(options) {
+				return nil, errors.New("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(options[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return nil, errors.New("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.ToUpper(options[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return nil, errors.New("ERR syntax error")
+		}
+	}
+	exists := s.exists(key)
+	if (nx && exists) || (xx && !exists) {
+		return nil, nil
+	}
+	s.deleteKey(key)
+	s.strings[key] = value
+	if ttl > 0 {
+		s.expires[key] = time.Now().Add(ttl)
+	}
+	s.changed(key)
+	return "OK", nil
+}
+
+func (s *Server) sortedSet(key string, create bool) map[string]float64 {
+	if !s.exists(key) && create {
+		s.sets[key] = make(map[string]float64)
+	}
+	return s.sets[key]
+}
+
+// Parses the min and max of ZRANGEBYSCORE, e.g. -inf, (100 or 200.
+func scoreRange(min, max string) (func(float64) bool, error) {
+	parse := func(bound string) (float64, bool, error) {
+		exclusive := strings.HasPrefix(bound, "(")
+		bound = strings.TrimPrefix(bound, "(")
+		switch bound {
+		case "-inf":
+			return math.Inf(-1), exclusive, nil
+		case "+inf", "inf":
+			return math.Inf(1), exclusive, nil
+		}
+		value, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			return 0, false, errors.New("ERR min or max is not a float")
+		}
+		return value, exclusive, nil
+	}
+	low, lowExclusive, err := parse(min)
+	if err != nil {
+		return nil, err
+	}
+	high, highExclusive, err := parse(max)
+	if err != nil {
+		return nil, err
+	}
+	return func(score float64) bool {
+		if score < low || (lowExclusive && score == low) {
+			return false
+		}
+		return score < high || (!highExclusive && score == high)
+	}, nil
+}
+
+func wrongArgs(name string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+func argString(arg interface{}) string {
+	switch a := arg.(type) {
+	case string:
+		return a
+	case []byte:
+		return string(a)
+	case float64:
+		return strconv.FormatFloat(a, 'g', -1, 64)
+	}
+	return fmt.Sprint(arg)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_sortedSets(t *testing.T) {
+	conn, _ := NewServer().Dial()
+
+	_ = conn.Send("MULTI")
+	_ = conn.Send("ZADD", "history", "100", []byte("a"))
+	_ = conn.Send("ZADD", "history", "200", []byte("b"), "300", []byte("c"))
+	_ = conn.Send("ZREMRANGEBYSCORE", "history", "-inf", "(200")
+	_ = conn.Send("EXPIRE", "history", int64(60))
+	replies, err := redis.Values(conn.Do("EXEC"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(1), int64(1)}, replies)
+
+	members, err := redis.Strings(conn.Do("ZRANGEBYSCORE", "history", "0", "+inf"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c"}, members)
+
+	members, _ = redis.Strings(conn.Do("ZRANGEBYSCORE", "history", "(200", "300"))
+	assert.Equal(t, []string{"c"}, members)
+
+	deleted, _ := redis.Int(conn.Do("DEL", "history"))
+	assert.Equal(t, 1, deleted)
+	members, _ = redis.Strings(conn.Do("ZRANGEBYSCORE", "history", "-inf", "+inf"))
+	assert.Empty(t, members)
+}
+
+func Test_expire(t *testing.T) {
+	conn, _ := NewServer().Dial()
+	_, _ = conn.Do("ZADD", "key", "1", "member")
+	_, _ = conn.Do("EXPIRE", "key", int64(-1))
+	members, err := redis.Strings(conn.Do("ZRANGEBYSCORE", "key", "-inf", "+inf"))
+	assert.Nil(t, err)
+	assert.Empty(t, members)
+}
+
+func Test_strings(t *testing.T) {
+	conn, _ := NewServer().Dial()
+
+	value, err := conn.Do("GET", "lock")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	reply, err := redis.String(conn.Do("SET", "lock", "a", "NX", "PX", int64(60000)))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", reply)
+	value, err = conn.Do("SET", "lock", "b", "NX", "PX", int64(60000))
+	assert.Nil(t, err)
+	assert.Nil(t, value, "The key is set already.")
+	owner, _ := redis.String(conn.Do("GET", "lock"))
+	assert.Equal(t, "a", owner)
+
+	count, err := redis.Int64(conn.Do("INCR", "fence"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	count, _ = redis.Int64(conn.Do("INCR", "fence"))
+	assert.Equal(t, int64(2), count)
+	_, err = conn.Do("INCR", "lock")
+	assert.IsType(t, redis.Error(""), err)
+
+	_, _ = conn.Do("PEXPIRE", "lock", int64(-1))
+	value, _ = conn.Do("GET", "lock")
+	assert.Nil(t, value)
+}
+
+func Test_watch(t *testing.T) {
+	server := NewServer()
+	conn, _ := server.Dial()
+	other, _ := server.Dial()
+	_, _ = conn.Do("SET", "key", "a")
+
+	_, _ = conn.Do("WATCH", "key")
+	_ = conn.Send("MULTI")
+	_ = conn.Send("SET", "key", "b")
+	replies, err := redis.Values(conn.Do("EXEC"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"OK"}, replies)
+
+	// The transaction is aborted when another connection changes the watched key.
+	_, _ = conn.Do("WATCH", "key")
+	_, _ = other.Do("SET", "key", "c")
+	_ = conn.Send("MULTI")
+	_ = conn.Send("SET", "key", "d")
+	reply, err := conn.Do("EXEC")
+	assert.Nil(t, err)
+	assert.Nil(t, reply)
+	value, _ := redis.String(conn.Do("GET", "key"))
+	assert.Equal(t, "c", value)
+
+	_, _ = conn.Do("WATCH", "key")
+	_, _ = conn.Do("UNWATCH")
+	_, _ = other.Do("DEL", "key")
+	_ = conn.Send("MULTI")
+	_ = conn.Send("SET", "key", "e")
+	replies, _ = redis.Values(conn.Do("EXEC"))
+	assert.Equal(t, []interface{}{"OK"}, replies)
+}
+
+func Test_commands(t *testing.T) {
+	server := NewServer()
+	conn, _ := server.Dial()
+
+	pong, err := redis.String(conn.Do("PING"))
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", pong)
+
+	_, err = conn.Do("HGET", "key", "field")
+	assert.IsType(t, redis.Error(""), err)
+
+	_, err = conn.Do("GRAPH.QUERY", "g", "CREATE (:Pod {name: 'a'})", "--compact")
+	assert.Nil(t, err)
+	// Graphs are shared by the connections of the server.
+	other, _ := server.Dial()
+	reply, err := redis.Values(other.Do("GRAPH.QUERY", "g", "MATCH (n:Pod) RETURN n.name", "--compact"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(reply))
+
+	// Renaming replaces the graph with the new name.
+	_, err = conn.Do("GRAPH.QUERY", "h", "CREATE (:Pod {name: 'b'}), (:Pod {name: 'c'})", "--compact")
+	assert.Nil(t, err)
+	_, err = conn.Do("RENAME", "h", "g")
+	assert.Nil(t, err)
+	reply, _ = redis.Values(conn.Do("GRAPH.QUERY", "g", "MATCH (n:Pod) RETURN count(n)", "--compact"))
+	assert.Equal(t, []interface{}{[]interface{}{[]interface{}{int64(3), int64(2)}}}, reply[1])
+	_, err = conn.Do("RENAME", "h", "g")
+	assert.NotNil(t, err)
+
+	_, err = conn.Do("GRAPH.QUERY", "g", "MATCH (n:Pod RETURN n", "--compact")
+	assert.IsType(t, redis.Error(""), err)
+
+	_, err = conn.Do("GRAPH.DELETE", "g")
+	assert.Nil(t, err)
+	_, err = conn.Do("GRAPH.DELETE", "g")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, conn.Close())
+	_, err = conn.Do("PING")
+	assert.NotNil(t, err)
+}
+
+func Test_profile(t *testing.T) {
+	conn, _ := NewServer().Dial()
+	_, err := conn.Do("GRAPH.QUERY", "g", "CREATE (:Pod {name:'a'}), (:Pod {name:'b'}), (:Pod {name:'c'})", "--compact")
+	assert.Nil(t, err)
+
+	plan, err := redis.Strings(conn.Do("GRAPH.PROFILE", "g", "MATCH (n:Pod) WHERE n.name <> 'a' RETURN n"))
+	assert.Nil(t, err)
+	if assert.Len(t, plan, 2) {
+		assert.Regexp(t, `^projection \| Records produced: 2, Execution time: [\d.]+ ms$`, plan[0])
+		assert.Regexp(t, `^    match \| Records produced: 2, Execution time: [\d.]+ ms$`, plan[1])
+	}
+
+	_, err = conn.Do("GRAPH.PROFILE", "g", "MATCH (n:Pod RETURN n")
+	assert.NotNil(t, err)
+}
+
+func Test_readOnlyQuery(t *testing.T) {
+	conn, _ := NewServer().Dial()
+	_, err := conn.Do("GRAPH.QUERY", "g", "CREATE (:Pod {name:'a'})", "--compact")
+	assert.Nil(t, err)
+
+	_, err = conn.Do("GRAPH.RO_QUERY", "g", "MATCH (n:Pod) RETURN n.name", "--compact")
+	assert.Nil(t, err)
+	for _, query := range []string{"MATCH (n:Pod) DELETE n", "MATCH (n:Pod) SET n.name = 'b'",
+		"CREATE (:Pod {name:'c'})", "MERGE (:Pod {name:'a'})"} {
+		_, err = conn.Do("GRAPH.RO_QUERY", "g", query, "--compact")
+		assert.NotNil(t, err, query)
+	}
+	reply, err := redis.Values(conn.Do("GRAPH.QUERY", "g", "MATCH (n:Pod) RETURN n.name", "--compact"))
+	assert.Nil(t, err)
+	assert.Len(t, reply[1], 1, "The graph wasn't modified.")
+}
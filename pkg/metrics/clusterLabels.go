@@ -0,0 +1,141 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cluster label of the samples of the clusters without a label of their own, over METRICS_CLUSTER_LABEL_LIMIT.
+const OTHER_CLUSTERS = "other"
+
+// Clusters with their own cluster label, the ones counted under the other label, and the samples recorded for each
+// cluster since the last ranking.
+var (
+	labeledClusters    = make(map[string]bool)
+	otherClusters      = make(map[string]bool)
+	clusterSamples     = make(map[string]int)
+	clusterLabelsMutex = sync.Mutex{}
+)
+
+// Metrics with a cluster label, the series of a cluster are deleted when it loses its label. The cluster health,
+// with a state label too, is handled by the health job.
+func clusterLabelVecs() []interface{ DeleteLabelValues(...string) bool } {
+	return []interface{ DeleteLabelValues(...string) bool }{CollectorUp, DuplicateSyncs, SyncSchemaErrors,
+		ResyncChurningResources, ClusterClockSkew, ClusterConsistencyScore, PayloadMappedFields,
+		EdgeChecksumMismatches}
+}
+
+// Returns the cluster label of a sample of the cluster: its name while it has a label of its own, or "other" once
+// METRICS_CLUSTER_LABEL_LIMIT clusters have one, so a fleet of thousands of clusters doesn't create thousands of
+// series for each metric.
+func ClusterLabel(clusterName string) string {
+	limit := config.Cfg.MetricsClusterLabelLimit
+	if limit <= 0 {
+		return clusterName
+	}
+	clusterLabelsMutex.Lock()
+	defer clusterLabelsMutex.Unlock()
+	clusterSamples[clusterName]++
+	if labeledClusters[clusterName] {
+		return clusterName
+	}
+	if len(labeledClusters) < limit {
+		labeledClusters[clusterName] = true
+		return clusterName
+	}
+	if !otherClusters[clusterName] {
+		otherClusters[clusterName] = true
+		OtherClusters.Set(float64(len(otherClusters)))
+	}
+	return OTHER_CLUSTERS
+}
+
+// Sets the gauge of the cluster. Gauges can't be added up like counters, the gauges of the clusters counted under
+// the other label aren't exported.
+func SetClusterGauge(gauge *prometheus.GaugeVec, clusterName string, value float64) {
+	if label := ClusterLabel(clusterName); label != OTHER_CLUSTERS {
+		gauge.WithLabelValues(label).Set(value)
+	}
+}
+
+// Tells whether the cluster has a label of its own, without recording a sample.
+func HasClusterLabel(clusterName string) bool {
+	if config.Cfg.MetricsClusterLabelLimit <= 0 {
+		return true
+	}
+	clusterLabelsMutex.Lock()
+	defer clusterLabelsMutex.Unlock()
+	return labeledClusters[clusterName]
+}
+
+// Gives the cluster labels to the METRICS_CLUSTER_LABEL_LIMIT clusters with the most samples since the last ranking,
+// the clusters with a label keep it on ties. The series of the clusters that lost their label are deleted, their
+// next samples are counted under the other label. Returns those clusters, sorted.
+func RankClusterLabels() []string {
+	limit := config.Cfg.MetricsClusterLabelLimit
+	clusterLabelsMutex.Lock()
+	defer clusterLabelsMutex.Unlock()
+	clusters := make([]string, 0, len(clusterSamples))
+	for clusterName := range clusterSamples {
+		clusters = append(clusters, clusterName)
+	}
+	for clusterName := range labeledClusters {
+		if _, ok := clusterSamples[clusterName]; !ok {
+			clusters = append(clusters, clusterName)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		a, b := clusters[i], clusters[j]
+		if clusterSamples[a] != clusterSamples[b] {
+			return clusterSamples[a] > clusterSamples[b]
+		}
+		if labeledClusters[a] != labeledClusters[b] {
+			return labeledClusters[a]
+		}
+		return a < b
+	})
+
+	ranked := make(map[string]bool, limit)
+	for i := 0; i < len(clusters) && (limit <= 0 || i < limit); i++ {
+		ranked[clusters[i]] = true
+	}
+	demoted := []string{}
+	for clusterName := range labeledClusters {
+		if !ranked[clusterName] {
+			demoted = append(demoted, clusterName)
+			for _, vec := range clusterLabelVecs() {
+				vec.DeleteLabelValues(clusterName)
+			}
+		}
+	}
+	sort.Strings(demoted)
+	labeledClusters = ranked
+	otherClusters = make(map[string]bool)
+	for clusterName := range clusterSamples {
+		if !ranked[clusterName] {
+			otherClusters[clusterName] = true
+		}
+	}
+	OtherClusters.Set(float64(len(otherClusters)))
+	clusterSamples = make(map[string]int)
+	return demoted
+}
+
+// Ranks the clusters for the cluster labels every METRICS_CLUSTER_RANK_MS, so the busiest clusters keep their own
+// series and the quiet ones share the other label.
+func ClusterLabelsJob() {
+	if config.Cfg.MetricsClusterLabelLimit <= 0 || config.Cfg.MetricsClusterRankMS <= 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.Cfg.MetricsClusterRankMS) * time.Millisecond)
+		RankClusterLabels()
+	}
+}
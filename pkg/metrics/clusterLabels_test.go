@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetClusterLabels() {
+	labeledClusters, otherClusters = make(map[string]bool), make(map[string]bool)
+	clusterSamples = make(map[string]int)
+}
+
+func TestClusterLabel(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.MetricsClusterLabelLimit = 2
+	resetClusterLabels()
+	defer resetClusterLabels()
+
+	assert.Equal(t, "c1", ClusterLabel("c1"))
+	assert.Equal(t, "c2", ClusterLabel("c2"))
+	assert.Equal(t, OTHER_CLUSTERS, ClusterLabel("c3"), "Over the limit")
+	assert.Equal(t, OTHER_CLUSTERS, ClusterLabel("c4"))
+	assert.Equal(t, OTHER_CLUSTERS, ClusterLabel("c3"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(OtherClusters))
+	assert.True(t, HasClusterLabel("c1"))
+	assert.False(t, HasClusterLabel("c3"))
+
+	// The gauges of the other clusters aren't exported.
+	SetClusterGauge(CollectorUp, "c2", 1)
+	SetClusterGauge(CollectorUp, "c4", 1)
+	assert.Equal(t, 1.0, testutil.ToFloat64(CollectorUp.WithLabelValues("c2")))
+	assert.False(t, CollectorUp.DeleteLabelValues(OTHER_CLUSTERS))
+
+	// c3 has the most samples and c2 is a labeled cluster with as many as c4, c1 loses its label.
+	ClusterLabel("c3")
+	ClusterLabel("c2")
+	assert.Equal(t, []string{"c1"}, RankClusterLabels())
+	assert.True(t, HasClusterLabel("c3"))
+	assert.True(t, HasClusterLabel("c2"))
+	assert.False(t, HasClusterLabel("c1"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(OtherClusters), "c1 and c4")
+	assert.Equal(t, OTHER_CLUSTERS, ClusterLabel("c1"))
+
+	// c1 has the only sample since, it takes the label of c3 and c2 keeps its own on the tie.
+	assert.Equal(t, []string{"c3"}, RankClusterLabels())
+	assert.True(t, HasClusterLabel("c1"))
+	assert.True(t, HasClusterLabel("c2"))
+	assert.Equal(t, 0.0, testutil.ToFloat64(OtherClusters))
+
+	config.Cfg.MetricsClusterLabelLimit = 0
+	assert.Equal(t, "c9", ClusterLabel("c9"), "No limit")
+	assert.True(t, HasClusterLabel("c9"))
+}
+
+func TestRankClusterLabels_deletesSeries(t *testing.T) {
+	t.Cleanup(config.Snapshot())
+	config.Cfg.MetricsClusterLabelLimit = 1
+	resetClusterLabels()
+	defer resetClusterLabels()
+
+	DuplicateSyncs.WithLabelValues(ClusterLabel("rank1")).Inc()
+	DuplicateSyncs.WithLabelValues(ClusterLabel("rank2")).Inc()
+	DuplicateSyncs.WithLabelValues(ClusterLabel("rank2")).Inc()
+	assert.Equal(t, 2.0, testutil.ToFloat64(DuplicateSyncs.WithLabelValues(OTHER_CLUSTERS)))
+
+	assert.Equal(t, []string{"rank1"}, RankClusterLabels())
+	assert.False(t, DuplicateSyncs.DeleteLabelValues("rank1"), "Deleted by the ranking")
+	assert.Equal(t, "rank2", ClusterLabel("rank2"))
+	DuplicateSyncs.DeleteLabelValues(OTHER_CLUSTERS)
+}
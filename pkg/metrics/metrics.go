@@ -0,0 +1,348 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "search_aggregator"
+
+var (
+	// Number of UIDs received from collectors that had to be normalized or were rejected.
+	InvalidUIDs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "invalid_uids_total",
+		Help:      "Number of UIDs received from collectors that were normalized or rejected.",
+	}, []string{"action", "reason"})
+
+	// Number of delta syncs rejected because they were built against the state before a resync.
+	StaleSyncEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stale_sync_events_total",
+		Help:      "Number of delta syncs rejected because their epoch was older than the last resync.",
+	})
+
+	// Time queries waited for a datastore connection, by pool lane.
+	ConnectionWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "connection_wait_seconds",
+		Help:      "Time queries waited for a datastore connection, by lane (delta or bulk).",
+		Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 30},
+	}, []string{"lane"})
+
+	// Clusters the intercluster edge builder recomputed or skipped because their subscriptions didn't change.
+	InterClusterEdgeClusters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "intercluster_edge_clusters_total",
+		Help:      "Clusters processed or skipped by the intercluster edge builder.",
+	}, []string{"result"})
+
+	// Whether the collector of each cluster answers the pings of its health URL.
+	CollectorUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "collector_up",
+		Help:      "1 when the collector of the cluster answers the pings of its health URL, 0 when it's down.",
+	}, []string{"cluster"})
+
+	// Syncs skipped because the cluster sent the same payload again.
+	DuplicateSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicate_syncs_total",
+		Help:      "Syncs skipped because the cluster sent the same payload more than DUPLICATE_SYNC_LIMIT times in a row.",
+	}, []string{"cluster"})
+
+	// Sync payloads not matching the sync schema, by cluster.
+	SyncSchemaErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_schema_errors_total",
+		Help:      "Sync payloads not matching the sync schema, rejected or only reported by SYNC_SCHEMA_VALIDATION.",
+	}, []string{"cluster"})
+
+	// Estimated bytes written to the graph, by lane, counted against WRITE_BUDGET_BYTES.
+	WriteBudgetBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "write_budget_bytes_total",
+		Help:      "Estimated bytes written to the graph, by lane (delta or bulk).",
+	}, []string{"lane"})
+
+	// Fraction of WRITE_BUDGET_BYTES used in the last interval, above 1 when the deltas exceeded it.
+	WriteBudgetUtilization = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "write_budget_utilization",
+		Help:      "Fraction of the write budget used in the last interval.",
+	})
+
+	// Time bulk writes waited for the write budget.
+	WriteBudgetDelaySeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "write_budget_delay_seconds",
+		Help:      "Time bulk writes (resyncs and derived edges) waited for the write budget.",
+		Buckets:   []float64{0.01, 0.1, 0.5, 1, 5, 10, 30},
+	})
+
+	// Events of the applied changes, by outcome.
+	EventSinkEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_sink_events_total",
+		Help:      "Events of the applied changes, by outcome (published, filtered out by EVENT_SINK_FILTER, or dropped when the queue was full).",
+	}, []string{"outcome"})
+
+	// Events waiting to be published to the event sink.
+	EventSinkQueue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_sink_queue",
+		Help:      "Events waiting to be published to EVENT_SINK.",
+	})
+
+	// Subscribers of the watch API.
+	EventWatchers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_watchers",
+		Help:      "Number of subscribers streaming the applied changes from the watch API.",
+	})
+
+	// Requests that panicked, by route.
+	HandlerPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_panics_total",
+		Help:      "Requests whose handler panicked and got a 500, by route.",
+	}, []string{"route"})
+
+	// Resources of the resyncs compared with their node, by outcome.
+	ResyncComparisons = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resync_comparisons_total",
+		Help:      "Resources of the resyncs compared with their node, by outcome: unchanged, hash, encodingError or property.",
+	}, []string{"outcome"})
+
+	// Resources of the resyncs updated because a property changed, by the first property that changed.
+	ResyncPropertyUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resync_property_updates_total",
+		Help:      "Resources of the resyncs updated because a property changed, by the first property that changed.",
+	}, []string{"property"})
+
+	// Resources of each cluster updated by a property change in each of the last resyncs.
+	ResyncChurningResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "resync_churning_resources",
+		Help:      "Resources of the cluster updated by a property change in each of its last 3 resyncs.",
+	}, []string{"cluster"})
+
+	// Passes of the intercluster edge builder by scheduling decision, from the write load of the graph.
+	InterClusterEdgeSchedule = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "intercluster_edge_schedule_total",
+		Help:      "Scheduling decisions of the intercluster edge builder: run, idle, deferred or forced.",
+	}, []string{"decision"})
+
+	// Connections discarded by the health check before reuse, by pool.
+	PoolHealthCheckFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pool_health_check_failures_total",
+		Help:      "Datastore connections that failed the PING before reuse and were discarded, by pool.",
+	}, []string{"pool"})
+
+	// Collectors connected with a session, and the directives pushed to them.
+	CollectorSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "collector_sessions",
+		Help:      "Number of collectors connected with a WebSocket session.",
+	})
+	SessionDirectives = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_directives_total",
+		Help:      "Directives pushed to collector sessions, by action.",
+	}, []string{"action"})
+
+	// Compactions of the graph, and how long writes were paused for them.
+	Compactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "compactions_total",
+		Help:      "Compactions of the graph, by result (success or failure).",
+	}, []string{"result"})
+	CompactionSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "compaction_seconds",
+		Help:      "Time writes were paused to copy and swap the graph.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600},
+	})
+
+	// Lookups of the resources a user can see in the RBAC cache.
+	RBACCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rbac_cache_lookups_total",
+		Help:      "Lookups of the resources a search API user can see, by result (hit or miss).",
+	}, []string{"result"})
+
+	// Resources deleted by the retention policies.
+	RetentionDeletes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_deletes_total",
+		Help:      "Resources deleted by the retention policies, by kind.",
+	}, []string{"kind"})
+
+	// Resources sent with the UID of a resource in another cluster.
+	UIDCollisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uid_collisions_total",
+		Help:      "Resources sent with the UID of a resource in another cluster, by action of the collision policy.",
+	}, []string{"action"})
+
+	// Health state of each cluster, 1 for the current state and 0 for the others.
+	ClusterHealth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_health",
+		Help:      "Health state of each cluster (Healthy, Degraded, Stale or Offline), 1 for the current state.",
+	}, []string{"cluster", "state"})
+
+	// Clock skew of the collector of each cluster, measured from the sentAt of its syncs.
+	ClusterClockSkew = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_clock_skew_seconds",
+		Help:      "Collector clock minus the aggregator clock when the last sync of each cluster was received.",
+	}, []string{"cluster"})
+
+	// Consistency score of each cluster from its recent resyncs.
+	ClusterConsistencyScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cluster_consistency_score",
+		Help:      "Consistency of the graph of each cluster from its recent resyncs, 1 when they matched the graph.",
+	}, []string{"cluster"})
+
+	// Writes of delta syncs sharing a query, by operation.
+	WriteBatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "write_batch_size",
+		Help:      "Delta writes from different syncs run with a shared query, by operation (delete or delete edge).",
+		Buckets:   []float64{1, 2, 5, 10, 20, 50, 100},
+	}, []string{"op"})
+
+	// Resources queued by the resyncs and not deleted yet by the lazy deleter.
+	PendingDeletes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_deletes",
+		Help:      "Resources waiting to be deleted by the lazy deleter, still in the graph.",
+	})
+
+	// Properties no longer stored because they have too many distinct values.
+	CappedProperties = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "capped_properties",
+		Help:      "Properties of a kind with more distinct values than PROPERTY_CARDINALITY_LIMIT, no longer stored.",
+	})
+
+	// Clusters of the last rebuild of the graph from collector resyncs.
+	RebuildClusters = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rebuild_clusters",
+		Help:      "Clusters of the last rebuild, by state (pending, inProgress, completed or timedOut).",
+	}, []string{"state"})
+
+	// Nodes and edges of the graph, counted by the graph limits job.
+	GraphObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "graph_objects",
+		Help:      "Nodes and edges of the graph, by type (nodes or edges).",
+	}, []string{"type"})
+
+	// Fraction of GRAPH_MAX_NODES and GRAPH_MAX_EDGES used, only for the caps that are set.
+	GraphLimitUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "graph_limit_utilization",
+		Help:      "Fraction of the cap of the graph used, by type (nodes or edges).",
+	}, []string{"type"})
+
+	// Syncs of new clusters rejected because the graph is near its caps.
+	GraphLimitRejectedSyncs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graph_limit_rejected_syncs_total",
+		Help:      "Syncs of new clusters rejected because the graph is near GRAPH_MAX_NODES or GRAPH_MAX_EDGES.",
+	})
+
+	// Legacy fields of the payloads of older collectors mapped by the PAYLOAD_MAPPINGS.
+	PayloadMappedFields = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payload_mapped_fields_total",
+		Help:      "Legacy fields of the sync payloads mapped to their current fields by PAYLOAD_MAPPINGS, by cluster.",
+	}, []string{"cluster"})
+
+	// Differential edge syncs sent with a base checksum that didn't match the stored edges.
+	EdgeChecksumMismatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "edge_checksum_mismatches_total",
+		Help:      "Deltas whose base edge checksum didn't match the stored edges, each asked for an edge resync.",
+	}, []string{"cluster"})
+
+	// Nodes found without the cluster property by the clusterless nodes job.
+	ClusterlessNodes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clusterless_nodes_total",
+		Help:      "Nodes found without the cluster property, by action (repaired, deleted or unattributed).",
+	}, []string{"action"})
+
+	// Resources that failed to be written, retried by the resource retry job.
+	ResourceRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resource_retries_total",
+		Help:      "Failed resources of the retry queue, by outcome (queued, succeeded, failed, dropped, overflow or superseded).",
+	}, []string{"outcome"})
+
+	// Resources waiting in the retry queue.
+	ResourceRetryQueue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "resource_retry_queue",
+		Help:      "Resources that failed to be written, waiting to be retried.",
+	})
+
+	// Clusters without a cluster label of their own, over METRICS_CLUSTER_LABEL_LIMIT.
+	OtherClusters = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "other_clusters",
+		Help:      "Clusters counted under the other cluster label, with samples since the last ranking.",
+	})
+
+	// 1 while the aggregator is read-only, manually or because of the memory of Redis.
+	ReadOnly = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "read_only",
+		Help:      "1 while the aggregator rejects the writes to the graph and only serves reads.",
+	})
+
+	// Fraction of the maxmemory of Redis used, from the read-only mode checks.
+	RedisMemoryUtilization = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "redis_memory_utilization",
+		Help:      "Fraction of the maxmemory of Redis used.",
+	})
+
+	// Faults injected into the datastore queries when FAULT_INJECTION_ENABLED is true.
+	InjectedFaults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "injected_faults_total",
+		Help:      "Faults injected into the datastore queries, by fault (drop, latency or partial).",
+	}, []string{"fault"})
+
+	// Chunks written by the chunked operations, by operation.
+	ChunkedOperationChunks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chunked_operation_chunks_total",
+		Help:      "Chunks written by the chunked operations, by op (insert, update, delete, insert edge or delete edge).",
+	}, []string{"op"})
+)
+
+func init() {
+	prometheus.MustRegister(InvalidUIDs, StaleSyncEvents, ConnectionWaitSeconds, InterClusterEdgeClusters,
+		PoolHealthCheckFailures, CollectorSessions, SessionDirectives, Compactions, CompactionSeconds,
+		RBACCacheLookups, RetentionDeletes, UIDCollisions, ClusterHealth, CappedProperties,
+		RebuildClusters, InjectedFaults, ChunkedOperationChunks, ClusterClockSkew,
+		PendingDeletes, WriteBatchSize, ClusterConsistencyScore, InterClusterEdgeSchedule,
+		CollectorUp, ResyncComparisons, ResyncPropertyUpdates, ResyncChurningResources, DuplicateSyncs,
+		EventSinkEvents, EventSinkQueue, EventWatchers, HandlerPanics, SyncSchemaErrors,
+		WriteBudgetBytes, WriteBudgetUtilization, WriteBudgetDelaySeconds, GraphObjects, GraphLimitUtilization,
+		GraphLimitRejectedSyncs, ReadOnly, RedisMemoryUtilization,
+		PayloadMappedFields, EdgeChecksumMismatches, ClusterlessNodes, ResourceRetries, ResourceRetryQueue,
+		OtherClusters)
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package rbac caches the resources each user of the search API can see, computed from the RoleBindings,
+// ClusterRoleBindings, Roles and ClusterRoles of the hub, so searches are filtered without a SubjectAccessReview
+// per query.
+package rbac
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/open-cluster-management/search-aggregator/pkg/metrics"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// API group and resource of the ManagedClusters, a ClusterRole granting get or list on them grants the
+// resources of those clusters, e.g. the open-cluster-management:view:<cluster> ClusterRoles.
+const (
+	managedClusterGroup    = "cluster.open-cluster-management.io"
+	managedClusterResource = "managedclusters"
+)
+
+// Returned by Access until the RBAC of the hub is synced.
+var ErrNotSynced = errors.New("The RBAC cache isn't synced with the hub yet")
+
+// A user of the search API, e.g. from the Impersonate-User and Impersonate-Group headers.
+type User struct {
+	Name   string
+	Groups []string
+}
+
+// Key of the user in the cache, the groups are sorted.
+func (u User) key() string {
+	groups := append([]string{}, u.Groups...)
+	sort.Strings(groups)
+	return u.Name + "\n" + strings.Join(groups, "\n")
+}
+
+// Tells whether the subject of a binding is the user or one of their groups.
+func (u User) isSubject(subject rbacv1.Subject) bool {
+	switch subject.Kind {
+	case rbacv1.UserKind:
+		return subject.Name == u.Name
+	case rbacv1.ServiceAccountKind:
+		return "system:serviceaccount:"+subject.Namespace+":"+subject.Name == u.Name
+	case rbacv1.GroupKind:
+		for _, group := range u.Groups {
+			if subject.Name == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A RoleBinding, or a ClusterRoleBinding when namespace is empty.
+type binding struct {
+	namespace string
+	subjects  []rbacv1.Subject
+	roleRef   rbacv1.RoleRef
+}
+
+type cacheEntry struct {
+	user    User
+	access  db.ResourceAccess
+	expires time.Time
+}
+
+// The RBAC resources of the hub, kept up to date by Watch, and the access computed from them by user.
+var (
+	mutex    = sync.RWMutex{}
+	synced   bool
+	bindings = make(map[string]binding)             // By kind/namespace/name.
+	roles    = make(map[string][]rbacv1.PolicyRule) // By namespace/name, "" namespace for ClusterRoles.
+	entries  = make(map[string]cacheEntry)          // By User.key()
+)
+
+// Returns the resources the user can see, from the cache when it was computed less than RBAC_CACHE_TTL_MS ago.
+func Access(user User) (db.ResourceAccess, error) {
+	key := user.key()
+	mutex.RLock()
+	entry, ok := entries[key]
+	isSynced := synced
+	mutex.RUnlock()
+	if !isSynced {
+		return db.ResourceAccess{}, ErrNotSynced
+	}
+	if ok && time.Now().Before(entry.expires) {
+		metrics.RBACCacheLookups.WithLabelValues("hit").Inc()
+		return entry.access, nil
+	}
+	metrics.RBACCacheLookups.WithLabelValues("miss").Inc()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	access := computeAccess(user)
+	ttl := time.Duration(config.Cfg.RBACCacheTTLMS) * time.Millisecond
+	entries[key] = cacheEntry{user: user, access: access, expires: time.Now().Add(ttl)}
+	return access, nil
+}
+
+// Computes the access of the user from the bindings. The caller holds the mutex.
+func computeAccess(user User) db.ResourceAccess {
+	access := db.ResourceAccess{}
+	clusters := map[string]bool{}
+	namespaces := map[string]bool{}
+	for _, b := range bindings {
+		if !isBound(user, b) {
+			continue
+		}
+		roleNamespace := b.namespace
+		if b.roleRef.Kind == "ClusterRole" {
+			roleNamespace = ""
+		}
+		for _, rule := range roles[roleNamespace+"/"+b.roleRef.Name] {
+			if !allowsRead(rule) {
+				continue
+			}
+			switch {
+			case b.namespace != "": // Any resource in the namespace.
+				namespaces[b.namespace] = true
+			case matches(rule.APIGroups, "*") && matches(rule.Resources, "*"):
+				access.All = true
+			case matches(rule.APIGroups, managedClusterGroup) && matches(rule.Resources, managedClusterResource):
+				if len(rule.ResourceNames) == 0 {
+					access.AllClusters = true
+				}
+				for _, name := range rule.ResourceNames {
+					clusters[name] = true
+				}
+			}
+		}
+	}
+	access.Clusters = sortedKeys(clusters)
+	access.Namespaces = sortedKeys(namespaces)
+	return access
+}
+
+func isBound(user User, b binding) bool {
+	for _, subject := range b.subjects {
+		if user.isSubject(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells whether the rule allows reading resources, search lists them.
+func allowsRead(rule rbacv1.PolicyRule) bool {
+	return len(rule.Resources) > 0 && (matches(rule.Verbs, "get") || matches(rule.Verbs, "list"))
+}
+
+// Tells whether the values of a rule are the value or the * wildcard.
+func matches(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Adds, updates or removes a binding, nil removes it. Drops the cached access of its previous and new subjects.
+func setBinding(key string, b *binding) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if previous, ok := bindings[key]; ok {
+		invalidate(previous.subjects)
+		delete(bindings, key)
+	}
+	if b != nil {
+		invalidate(b.subjects)
+		bindings[key] = *b
+	}
+}
+
+// Drops the cached access of the users bound as one of the subjects. The caller holds the mutex.
+func invalidate(subjects []rbacv1.Subject) {
+	for key, entry := range entries {
+		if isBound(entry.user, binding{subjects: subjects}) {
+			delete(entries, key)
+		}
+	}
+}
+
+// Adds, updates or removes a Role or ClusterRole, nil removes it. The rules of a role can grant access to
+// many users, so the whole cache is dropped.
+func setRole(key string, rules []rbacv1.PolicyRule) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if rules == nil {
+		delete(roles, key)
+	} else {
+		roles[key] = rules
+	}
+	entries = make(map[string]cacheEntry)
+}
+
+func setSynced() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	synced = true
+}
+
+// Readiness check of the access cache, failing until it's synced with the hub.
+func Ready() error {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if !synced {
+		return ErrNotSynced
+	}
+	return nil
+}
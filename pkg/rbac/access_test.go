@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rbac
+
+import (
+	"testing"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	db "github.com/open-cluster-management/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func resetCache() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	synced = false
+	bindings = make(map[string]binding)
+	roles = make(map[string][]rbacv1.PolicyRule)
+	entries = make(map[string]cacheEntry)
+}
+
+func Test_Access(t *testing.T) {
+	resetCache()
+	defer resetCache()
+	t.Cleanup(config.Snapshot())
+	config.Cfg.RBACCacheTTLMS = 60000
+
+	alice := User{Name: "alice", Groups: []string{"dev"}}
+	_, err := Access(alice)
+	assert.Equal(t, ErrNotSynced, err)
+	assert.Equal(t, ErrNotSynced, Ready())
+
+	setRole("/view", []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}})
+	setRole("/cluster-admin", []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}})
+	setRole("/view:c1", []rbacv1.PolicyRule{{APIGroups: []string{managedClusterGroup},
+		Resources: []string{managedClusterResource}, ResourceNames: []string{"c1"}, Verbs: []string{"get"}}})
+	setRole("ns2/creator", []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"create"}}})
+	setBinding("rolebindings/ns1/dev-view", &binding{namespace: "ns1",
+		subjects: []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "dev"}},
+		roleRef:  rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"}})
+	setBinding("rolebindings/ns2/creator", &binding{namespace: "ns2",
+		subjects: []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}},
+		roleRef:  rbacv1.RoleRef{Kind: "Role", Name: "creator"}})
+	setBinding("clusterrolebindings//c1", &binding{
+		subjects: []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}},
+		roleRef:  rbacv1.RoleRef{Kind: "ClusterRole", Name: "view:c1"}})
+	setSynced()
+	assert.NoError(t, Ready())
+
+	access, err := Access(alice)
+	assert.NoError(t, err)
+	// ns2 only allows creating pods.
+	assert.Equal(t, db.ResourceAccess{Clusters: []string{"c1"}, Namespaces: []string{"ns1"}}, access)
+	access, _ = Access(User{Name: "bob"})
+	assert.Equal(t, db.ResourceAccess{Clusters: []string{}, Namespaces: []string{}}, access)
+
+	// A new binding drops the cached access of its subjects only.
+	setBinding("clusterrolebindings//admins", &binding{
+		subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Namespace: "ns1", Name: "admin"}, {Kind: rbacv1.GroupKind, Name: "dev"}},
+		roleRef:  rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"}})
+	mutex.RLock()
+	_, aliceCached := entries[alice.key()]
+	_, bobCached := entries[User{Name: "bob"}.key()]
+	mutex.RUnlock()
+	assert.False(t, aliceCached)
+	assert.True(t, bobCached)
+	access, _ = Access(alice)
+	assert.True(t, access.All)
+	access, _ = Access(User{Name: "system:serviceaccount:ns1:admin"})
+	assert.True(t, access.All)
+
+	// Removing the binding takes the access back.
+	setBinding("clusterrolebindings//admins", nil)
+	access, _ = Access(alice)
+	assert.False(t, access.All)
+}
+
+func Test_UserKey(t *testing.T) {
+	assert.Equal(t, User{Name: "a", Groups: []string{"y", "x"}}.key(), User{Name: "a", Groups: []string{"x", "y"}}.key())
+	assert.NotEqual(t, User{Name: "a"}.key(), User{Name: "a", Groups: []string{"x"}}.key())
+}
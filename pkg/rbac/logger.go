@@ -0,0 +1,9 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rbac
+
+import "github.com/open-cluster-management/search-aggregator/pkg/logging"
+
+// Logs of the RBAC cache of the search API. The verbosity is set with the logging admin API.
+var logger = logging.Module("rbac")
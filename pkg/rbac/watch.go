@@ -0,0 +1,111 @@
+// Copyright (c) 2021 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package rbac
+
+import (
+	"time"
+
+	"github.com/open-cluster-management/search-aggregator/pkg/config"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Applies a change of an RBAC resource to the cache.
+type applyFunc func(key string, obj *unstructured.Unstructured, deleted bool)
+
+// Watches the RBAC resources of the hub to keep the access cache up to date. Changes to the bindings drop the
+// cached access of their subjects, changes to the roles drop the whole cache.
+func Watch() {
+	logger.Info("Begin RBAC watch routine for the search API access cache")
+	dynamicFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(config.GetDynamicClient(),
+		10*time.Minute, metav1.NamespaceAll, nil)
+
+	watch := func(resource string, apply applyFunc) cache.InformerSynced {
+		gvr := rbacv1.SchemeGroupVersion.WithResource(resource)
+		informer := dynamicFactory.ForResource(gvr).Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if u, ok := obj.(*unstructured.Unstructured); ok {
+					apply(objectKey(resource, u), u, false)
+				}
+			},
+			UpdateFunc: func(prev interface{}, next interface{}) {
+				if u, ok := next.(*unstructured.Unstructured); ok {
+					apply(objectKey(resource, u), u, false)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if u, ok := obj.(*unstructured.Unstructured); ok {
+					apply(objectKey(resource, u), u, true)
+				}
+			},
+		})
+		return informer.HasSynced
+	}
+	hasSynced := []cache.InformerSynced{
+		watch("roles", applyRole),
+		watch("clusterroles", applyRole),
+		watch("rolebindings", applyBinding),
+		watch("clusterrolebindings", applyBinding),
+	}
+
+	stopper := make(chan struct{})
+	dynamicFactory.Start(stopper)
+	if !cache.WaitForCacheSync(stopper, hasSynced...) {
+		logger.Error("Error syncing the RBAC resources of the hub, searches are rejected.")
+		return
+	}
+	setSynced()
+	logger.Info("RBAC access cache is synced with the hub.")
+}
+
+// Key of a role or binding, e.g. rolebindings/default/view. Roles are keyed without the resource, by
+// namespace/name, so the roleRef of a binding finds them.
+func objectKey(resource string, obj *unstructured.Unstructured) string {
+	if resource == "roles" || resource == "clusterroles" {
+		return obj.GetNamespace() + "/" + obj.GetName()
+	}
+	return resource + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func applyRole(key string, obj *unstructured.Unstructured, deleted bool) {
+	if deleted {
+		setRole(key, nil)
+		return
+	}
+	role := rbacv1.ClusterRole{} // Reads the rules of a Role too.
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &role); err != nil {
+		logger.Warningf("Error reading %s %s for the RBAC cache: %s", obj.GetKind(), key, err)
+		return
+	}
+	rules := role.Rules
+	if rules == nil {
+		rules = []rbacv1.PolicyRule{}
+	}
+	setRole(key, rules)
+}
+
+func applyBinding(key string, obj *unstructured.Unstructured, deleted bool) {
+	if deleted {
+		setBinding(key, nil)
+		return
+	}
+	roleBinding := rbacv1.RoleBinding{} // Reads a ClusterRoleBinding too.
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &roleBinding); err != nil {
+		logger.Warningf("Error reading %s %s for the RBAC cache: %s", obj.GetKind(), key, err)
+		return
+	}
+	setBinding(key, &binding{
+		namespace: roleBinding.Namespace,
+		subjects:  roleBinding.Subjects,
+		roleRef:   roleBinding.RoleRef,
+	})
+}